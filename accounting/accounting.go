@@ -0,0 +1,266 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package accounting converts the transaction history of a set of addresses
+// into double-entry bookkeeping records.  Each transaction moves its amounts
+// between the account of the addresses and an income or expense account, or
+// the account mapped to its counterparty, and the fee it paid to a fee
+// account.  Each asset is booked as a commodity.
+//
+// The records are written as Beancount entries or as the CSV rows of their
+// postings.
+package accounting
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NativeAsset is the id of the asset of the coin of the chain.
+const NativeAsset = "000000000000000000000000"
+
+// Commodity is the name and the number of decimals of the commodity of an
+// asset.  The amounts of the chain are integers of the smallest unit.
+type Commodity struct {
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"`
+}
+
+// Mapping maps the postings of the transactions to the accounts of a ledger
+// and the assets to commodities.  Counterparties maps the addresses of known
+// counterparties to the accounts used instead of the income and expense
+// accounts.
+type Mapping struct {
+	Wallet         string               `json:"wallet"`
+	Income         string               `json:"income"`
+	Expenses       string               `json:"expenses"`
+	Fees           string               `json:"fees"`
+	Counterparties map[string]string    `json:"counterparties"`
+	Commodities    map[string]Commodity `json:"commodities"`
+}
+
+// DefaultMapping returns the mapping used for the accounts and commodities a
+// mapping does not set.
+func DefaultMapping() *Mapping {
+	return &Mapping{
+		Wallet:   "Assets:Asimov",
+		Income:   "Income:Asimov",
+		Expenses: "Expenses:Asimov",
+		Fees:     "Expenses:Asimov:Fees",
+		Commodities: map[string]Commodity{
+			NativeAsset: {Name: "ASC", Decimals: 8},
+		},
+	}
+}
+
+// WithDefaults returns a copy of the mapping whose unset accounts and
+// commodities are those of the default mapping.
+func (m *Mapping) WithDefaults() *Mapping {
+	merged := DefaultMapping()
+	if m == nil {
+		return merged
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&merged.Wallet, &m.Wallet},
+		{&merged.Income, &m.Income},
+		{&merged.Expenses, &m.Expenses},
+		{&merged.Fees, &m.Fees},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	merged.Counterparties = m.Counterparties
+	for asset, commodity := range m.Commodities {
+		merged.Commodities[asset] = commodity
+	}
+	return merged
+}
+
+// Commodity returns the commodity of an asset.  The assets without a mapped
+// commodity are named after their id, without decimals.
+func (m *Mapping) Commodity(asset string) Commodity {
+	if commodity, ok := m.Commodities[asset]; ok {
+		return commodity
+	}
+	return Commodity{Name: "A" + strings.ToUpper(strings.TrimLeft(asset, "0"))}
+}
+
+// Accounts returns the accounts of the mapping in ascending order, without
+// duplicates.
+func (m *Mapping) Accounts() []string {
+	seen := map[string]struct{}{
+		m.Wallet: {}, m.Income: {}, m.Expenses: {}, m.Fees: {},
+	}
+	for _, account := range m.Counterparties {
+		seen[account] = struct{}{}
+	}
+	accounts := make([]string, 0, len(seen))
+	for account := range seen {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// Amount is an amount of an asset in its smallest unit.
+type Amount struct {
+	Value int64
+	Asset string
+}
+
+// Transaction is a transaction of the history of the addresses.  Amounts is
+// the net change of their balance by asset without the fees, which they paid.
+type Transaction struct {
+	Txid           string
+	Time           time.Time
+	Direction      string
+	Counterparties []string
+	Amounts        []Amount
+	Fees           []Amount
+}
+
+// Posting is a posting of a transaction to an account.
+type Posting struct {
+	Account string
+	Amount
+}
+
+// Postings returns the balanced postings of a transaction.  The amounts move
+// between the wallet account and the account of the counterparty, or the
+// income or expense account, and the fees from the wallet account to the fee
+// account.
+func (m *Mapping) Postings(tx *Transaction) []Posting {
+	counterparty := ""
+	for _, addr := range tx.Counterparties {
+		if account, ok := m.Counterparties[addr]; ok {
+			counterparty = account
+			break
+		}
+	}
+
+	var postings []Posting
+	for _, amount := range tx.Amounts {
+		if amount.Value == 0 {
+			continue
+		}
+		other := counterparty
+		if other == "" && amount.Value > 0 {
+			other = m.Income
+		} else if other == "" {
+			other = m.Expenses
+		}
+		postings = append(postings,
+			Posting{Account: m.Wallet, Amount: amount},
+			Posting{Account: other, Amount: Amount{-amount.Value, amount.Asset}})
+	}
+	for _, fee := range tx.Fees {
+		if fee.Value == 0 {
+			continue
+		}
+		postings = append(postings,
+			Posting{Account: m.Wallet, Amount: Amount{-fee.Value, fee.Asset}},
+			Posting{Account: m.Fees, Amount: fee})
+	}
+	return postings
+}
+
+// FormatValue formats an amount of an asset in the units of its commodity.
+func (m *Mapping) FormatValue(amount Amount) string {
+	decimals := m.Commodity(amount.Asset).Decimals
+	if decimals <= 0 {
+		return strconv.FormatInt(amount.Value, 10)
+	}
+	sign, value := "", amount.Value
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	digits := strconv.FormatInt(value, 10)
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	point := len(digits) - decimals
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// quote returns a string literal of Beancount.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// WriteBeancount writes the transactions as Beancount entries.  When opened
+// is not nil, the accounts of the mapping are opened at that time first.
+func WriteBeancount(w io.Writer, txs []Transaction, m *Mapping, opened *time.Time) error {
+	if opened != nil {
+		date := opened.UTC().Format("2006-01-02")
+		for _, account := range m.Accounts() {
+			if _, err := fmt.Fprintf(w, "%s open %s\n", date, account); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	for i := range txs {
+		tx := &txs[i]
+		payee := ""
+		if len(tx.Counterparties) > 0 {
+			payee = tx.Counterparties[0]
+		}
+		_, err := fmt.Fprintf(w, "%s * %s %s\n  txid: %s\n",
+			tx.Time.UTC().Format("2006-01-02"), quote(payee),
+			quote(tx.Direction), quote(tx.Txid))
+		if err != nil {
+			return err
+		}
+		for _, p := range m.Postings(tx) {
+			_, err := fmt.Fprintf(w, "  %s  %s %s\n", p.Account,
+				m.FormatValue(p.Amount), m.Commodity(p.Asset).Name)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvHeader is the header of the CSV records.
+var csvHeader = []string{"date", "txid", "direction", "counterparty",
+	"account", "amount", "commodity"}
+
+// WriteCSV writes a CSV record for each posting of the transactions, preceded
+// by a header when header is set.
+func WriteCSV(w io.Writer, txs []Transaction, m *Mapping, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	for i := range txs {
+		tx := &txs[i]
+		date := tx.Time.UTC().Format(time.RFC3339)
+		counterparty := strings.Join(tx.Counterparties, " ")
+		for _, p := range m.Postings(tx) {
+			err := cw.Write([]string{date, tx.Txid, tx.Direction,
+				counterparty, p.Account, m.FormatValue(p.Amount),
+				m.Commodity(p.Asset).Name})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
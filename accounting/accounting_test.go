@@ -0,0 +1,141 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package accounting
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestPostings ensures the postings of the transactions balance and use the
+// mapped accounts.
+func TestPostings(t *testing.T) {
+	m := (&Mapping{
+		Income:         "Income:Sales",
+		Counterparties: map[string]string{"0xbob": "Liabilities:Bob"},
+	}).WithDefaults()
+
+	tests := []struct {
+		tx   Transaction
+		want []Posting
+	}{
+		{
+			Transaction{Direction: "receive", Counterparties: []string{"0xalice"},
+				Amounts: []Amount{{150, NativeAsset}}},
+			[]Posting{
+				{"Assets:Asimov", Amount{150, NativeAsset}},
+				{"Income:Sales", Amount{-150, NativeAsset}},
+			},
+		},
+		{
+			Transaction{Direction: "send", Counterparties: []string{"0xalice", "0xbob"},
+				Amounts: []Amount{{-100, NativeAsset}, {0, "0001"}},
+				Fees:    []Amount{{2, NativeAsset}}},
+			[]Posting{
+				{"Assets:Asimov", Amount{-100, NativeAsset}},
+				{"Liabilities:Bob", Amount{100, NativeAsset}},
+				{"Assets:Asimov", Amount{-2, NativeAsset}},
+				{"Expenses:Asimov:Fees", Amount{2, NativeAsset}},
+			},
+		},
+		{
+			Transaction{Direction: "send", Amounts: []Amount{{-7, "0001"}}},
+			[]Posting{
+				{"Assets:Asimov", Amount{-7, "0001"}},
+				{"Expenses:Asimov", Amount{7, "0001"}},
+			},
+		},
+	}
+	for i, test := range tests {
+		postings := m.Postings(&test.tx)
+		if !reflect.DeepEqual(postings, test.want) {
+			t.Errorf("#%d: Postings = %v, want %v", i, postings, test.want)
+		}
+		balance := make(map[string]int64)
+		for _, p := range postings {
+			balance[p.Asset] += p.Value
+		}
+		for asset, sum := range balance {
+			if sum != 0 {
+				t.Errorf("#%d: postings of %s sum to %d", i, asset, sum)
+			}
+		}
+	}
+}
+
+// TestFormatValue ensures the amounts are formatted with the decimals of their
+// commodity.
+func TestFormatValue(t *testing.T) {
+	m := DefaultMapping()
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{Amount{150000000, NativeAsset}, "1.50000000"},
+		{Amount{-5, NativeAsset}, "-0.00000005"},
+		{Amount{0, NativeAsset}, "0.00000000"},
+		{Amount{-42, "0001"}, "-42"},
+	}
+	for _, test := range tests {
+		if got := m.FormatValue(test.amount); got != test.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", test.amount, got, test.want)
+		}
+	}
+	if name := m.Commodity("000000010000000000000002").Name; name != "A10000000000000002" {
+		t.Errorf("Commodity name = %s", name)
+	}
+}
+
+// TestWriters ensures the Beancount entries and CSV records are written as
+// expected.
+func TestWriters(t *testing.T) {
+	m := DefaultMapping()
+	txs := []Transaction{{
+		Txid:           "ab",
+		Time:           time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC),
+		Direction:      "send",
+		Counterparties: []string{"0xalice"},
+		Amounts:        []Amount{{-100000000, NativeAsset}},
+		Fees:           []Amount{{1000, NativeAsset}},
+	}}
+
+	var buf bytes.Buffer
+	opened := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := WriteBeancount(&buf, txs, m, &opened); err != nil {
+		t.Fatalf("WriteBeancount: %v", err)
+	}
+	want := `2019-01-01 open Assets:Asimov
+2019-01-01 open Expenses:Asimov
+2019-01-01 open Expenses:Asimov:Fees
+2019-01-01 open Income:Asimov
+
+2020-03-04 * "0xalice" "send"
+  txid: "ab"
+  Assets:Asimov  -1.00000000 ASC
+  Expenses:Asimov  1.00000000 ASC
+  Assets:Asimov  -0.00001000 ASC
+  Expenses:Asimov:Fees  0.00001000 ASC
+
+`
+	if buf.String() != want {
+		t.Errorf("WriteBeancount:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteCSV(&buf, txs, m, true); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	want = `date,txid,direction,counterparty,account,amount,commodity
+2020-03-04T05:06:07Z,ab,send,0xalice,Assets:Asimov,-1.00000000,ASC
+2020-03-04T05:06:07Z,ab,send,0xalice,Expenses:Asimov,1.00000000,ASC
+2020-03-04T05:06:07Z,ab,send,0xalice,Assets:Asimov,-0.00001000,ASC
+2020-03-04T05:06:07Z,ab,send,0xalice,Expenses:Asimov:Fees,0.00001000,ASC
+`
+	if buf.String() != want {
+		t.Errorf("WriteCSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
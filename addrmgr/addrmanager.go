@@ -26,6 +26,7 @@ import (
 	"errors"
 	"github.com/AsimovNetwork/asimov/common"
 	fnet "github.com/AsimovNetwork/asimov/common/net"
+	"github.com/AsimovNetwork/asimov/crypto/sha3"
 	"github.com/AsimovNetwork/asimov/protos"
 )
 
@@ -698,9 +699,29 @@ func (a *AddrManager) reset() {
 }
 
 // HostToNetAddress returns a netaddress given a host address.  If the address
-// is a Tor .onion address this will be taken care of.  Else if the host is
-// not an IP address it will be resolved (via Tor if required).
+// is a Tor .onion address or an I2P .b32.i2p address this will be taken care
+// of.  Else if the host is not an IP address it will be resolved (via Tor if
+// required).
 func (a *AddrManager) HostToNetAddress(host string, port uint16, services common.ServiceFlag) (*protos.NetAddress, error) {
+	// Tor v3 address is 56 char base32 + ".onion" and I2P address is 52
+	// char base32 + ".b32.i2p".
+	if len(host) == 62 && host[56:] == ".onion" {
+		key, err := decodeTorV3(host[:56])
+		if err != nil {
+			return nil, err
+		}
+		return protos.NewNetAddressNetwork(protos.NetTorV3, key, port,
+			services), nil
+	}
+	if len(host) == 60 && host[52:] == ".b32.i2p" {
+		hash, err := base32NoPadding.DecodeString(strings.ToUpper(host[:52]))
+		if err != nil {
+			return nil, err
+		}
+		return protos.NewNetAddressNetwork(protos.NetI2P, hash, port,
+			services), nil
+	}
+
 	// Tor address is 16 char base32 + ".onion"
 	var ip net.IP
 	if len(host) == 22 && host[16:] == ".onion" {
@@ -728,10 +749,59 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services common
 	return protos.NewNetAddressIPPort(ip, port, services), nil
 }
 
+// base32NoPadding is the base32 encoding of the Tor v3 and I2P addresses.
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// torV3Version is the version byte of the Tor v3 .onion addresses.
+const torV3Version = 0x03
+
+// torV3Checksum returns the checksum of the .onion address of the public key
+// of a Tor v3 hidden service.
+func torV3Checksum(key []byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(key)
+	h.Write([]byte{torV3Version})
+	return h.Sum(nil)[:2]
+}
+
+// encodeTorV3 returns the host of the .onion address, without the suffix, of
+// the public key of a Tor v3 hidden service.
+func encodeTorV3(key []byte) string {
+	data := append(append(append([]byte(nil), key...), torV3Checksum(key)...),
+		torV3Version)
+	return strings.ToLower(base32NoPadding.EncodeToString(data))
+}
+
+// decodeTorV3 returns the public key of a Tor v3 hidden service given the host
+// of its .onion address, without the suffix.
+func decodeTorV3(host string) ([]byte, error) {
+	data, err := base32NoPadding.DecodeString(strings.ToUpper(host))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 35 || data[34] != torV3Version {
+		return nil, fmt.Errorf("%s.onion is not a Tor v3 address", host)
+	}
+	key := data[:32]
+	checksum := torV3Checksum(key)
+	if data[32] != checksum[0] || data[33] != checksum[1] {
+		return nil, fmt.Errorf("%s.onion has an invalid checksum", host)
+	}
+	return key, nil
+}
+
 // ipString returns a string for the ip from the provided NetAddress. If the
 // ip is in the range used for Tor addresses then it will be transformed into
-// the relevant .onion address.
+// the relevant .onion address.  The Tor v3 and I2P addresses are returned as
+// their .onion and .b32.i2p addresses.
 func ipString(na *protos.NetAddress) string {
+	if IsTorV3(na) {
+		return encodeTorV3(na.Addr) + ".onion"
+	}
+	if IsI2P(na) {
+		return strings.ToLower(base32NoPadding.EncodeToString(na.Addr)) + ".b32.i2p"
+	}
 	if IsOnionCatTor(na) {
 		// We know now that na.IP is long enough.
 		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
@@ -789,37 +859,54 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 			}
 			factor *= 1.2
 		}
-	} else {
-		// new node.
-		// XXX use a closure/function to avoid repeating this.
-		large := 1 << 30
-		factor := 1.0
-		for {
-			// Pick a random bucket.
-			bucket := a.rand.Intn(len(a.addrNew))
-			if len(a.addrNew[bucket]) == 0 {
-				continue
-			}
-			// Then, a random entry in it.
-			var ka *KnownAddress
-			nth := a.rand.Intn(len(a.addrNew[bucket]))
-			for _, value := range a.addrNew[bucket] {
-				if nth == 0 {
-					ka = value
-				}
-				nth--
-			}
-			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
-				log.Tracef("Selected %v from new bucket",
-					NetAddressKey(ka.na))
-				return ka
+	}
+	return a.pickNew()
+}
+
+// pickNew returns a random address of the new table, favoring the addresses
+// most likely to be reachable.  The new table must not be empty and the
+// address manager must be locked.
+func (a *AddrManager) pickNew() *KnownAddress {
+	large := 1 << 30
+	factor := 1.0
+	for {
+		// Pick a random bucket.
+		bucket := a.rand.Intn(len(a.addrNew))
+		if len(a.addrNew[bucket]) == 0 {
+			continue
+		}
+		// Then, a random entry in it.
+		var ka *KnownAddress
+		nth := a.rand.Intn(len(a.addrNew[bucket]))
+		for _, value := range a.addrNew[bucket] {
+			if nth == 0 {
+				ka = value
 			}
-			factor *= 1.2
+			nth--
 		}
+		randval := a.rand.Intn(large)
+		if float64(randval) < (factor * ka.chance() * float64(large)) {
+			log.Tracef("Selected %v from new bucket",
+				NetAddressKey(ka.na))
+			return ka
+		}
+		factor *= 1.2
 	}
 }
 
+// GetNewAddress returns a random address of the new table, which holds the
+// addresses never connected to, or nil when it is empty.  It is used by the
+// feeler connections to test the addresses before they are needed.
+func (a *AddrManager) GetNewAddress() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.nNew == 0 {
+		return nil
+	}
+	return a.pickNew()
+}
+
 func (a *AddrManager) find(addr *protos.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -976,7 +1063,7 @@ func (a *AddrManager) SetServices(addr *protos.NetAddress, services common.Servi
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *protos.NetAddress, priority AddressPriority) error {
 	if !IsRoutable(na) {
-		return fmt.Errorf("address %s is not routable", na.IP)
+		return fmt.Errorf("address %s is not routable", ipString(na))
 	}
 
 	a.lamtx.Lock()
@@ -1014,8 +1101,8 @@ func getReachabilityFrom(localAddr, remoteAddr *protos.NetAddress) int {
 		return Unreachable
 	}
 
-	if IsOnionCatTor(remoteAddr) {
-		if IsOnionCatTor(localAddr) {
+	if IsOnionCatTor(remoteAddr) || IsTorV3(remoteAddr) {
+		if IsOnionCatTor(localAddr) || IsTorV3(localAddr) {
 			return Private
 		}
 
@@ -1042,6 +1129,12 @@ func getReachabilityFrom(localAddr, remoteAddr *protos.NetAddress) int {
 		return Ipv6Weak
 	}
 
+	// The hidden services are reachable from any network through their
+	// proxies.
+	if IsTorV3(localAddr) || IsI2P(localAddr) {
+		return Default
+	}
+
 	if IsIPv4(remoteAddr) {
 		if IsRoutable(localAddr) && IsIPv4(localAddr) {
 			return Ipv4
@@ -1095,11 +1188,10 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *protos.NetAddress) *protos
 		}
 	}
 	if bestAddress != nil {
-		log.Debugf("Suggesting address %s:%d for %s:%d", bestAddress.IP,
-			bestAddress.Port, remoteAddr.IP, remoteAddr.Port)
+		log.Debugf("Suggesting address %s for %s", NetAddressKey(bestAddress),
+			NetAddressKey(remoteAddr))
 	} else {
-		log.Debugf("No worthy address for %s:%d", remoteAddr.IP,
-			remoteAddr.Port)
+		log.Debugf("No worthy address for %s", NetAddressKey(remoteAddr))
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
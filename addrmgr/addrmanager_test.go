@@ -396,6 +396,34 @@ func TestGetAddress(t *testing.T) {
 	}
 }
 
+func TestGetNewAddress(t *testing.T) {
+	n := addrmgr.New("testgetnewaddress", defaultTestNetAdapter)
+
+	// Get an address from an empty set (should error)
+	if rv := n.GetNewAddress(); rv != nil {
+		t.Errorf("GetNewAddress failed: got: %v want: %v\n", rv, nil)
+	}
+
+	// Add a new address and get it
+	err := n.AddAddressByIP(someIP + ":8333")
+	if err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	ka := n.GetNewAddress()
+	if ka == nil {
+		t.Fatalf("Did not get an address where there is one in the new table")
+	}
+	if ka.NetAddress().IP.String() != someIP {
+		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP.String(), someIP)
+	}
+
+	// Mark this as a good address, which moves it to the tried table
+	n.Good(ka.NetAddress())
+	if rv := n.GetNewAddress(); rv != nil {
+		t.Errorf("GetNewAddress failed: got: %v want: %v\n", rv, nil)
+	}
+}
+
 func TestGetBestLocalAddress(t *testing.T) {
 	localAddrs := []protos.NetAddress{
 		{IP: net.ParseIP("192.168.0.100")},
@@ -515,3 +543,55 @@ func TestNetAddressKey(t *testing.T) {
 	}
 
 }
+
+// TestHiddenServiceAddresses ensures the Tor v3 and I2P addresses are parsed
+// from and formatted to their host names, and are routable.
+func TestHiddenServiceAddresses(t *testing.T) {
+	amgr := addrmgr.New("testhiddenserviceaddresses", nil)
+	tests := []struct {
+		host    string
+		network protos.NetworkID
+		valid   bool
+	}{
+		{"2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion", protos.NetTorV3, true},
+		// The checksum of the address is wrong.
+		{"2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wia.onion", protos.NetTorV3, false},
+		{"ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p", protos.NetI2P, true},
+	}
+	for i, test := range tests {
+		na, err := amgr.HostToNetAddress(test.host, 8333, common.SFNodeNetwork)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("#%d: invalid host %s accepted", i, test.host)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: HostToNetAddress: %v", i, err)
+			continue
+		}
+		if na.NetworkID() != test.network || na.IP != nil {
+			t.Errorf("#%d: unexpected network %d and ip %v", i,
+				na.NetworkID(), na.IP)
+		}
+		if key := addrmgr.NetAddressKey(na); key != test.host+":8333" {
+			t.Errorf("#%d: NetAddressKey got %s want %s:8333", i, key, test.host)
+		}
+		if !addrmgr.IsRoutable(na) {
+			t.Errorf("#%d: %s is not routable", i, test.host)
+		}
+		if key := addrmgr.GroupKey(na); !strings.Contains(key, ":") {
+			t.Errorf("#%d: unexpected group key %s", i, key)
+		}
+		if err := amgr.AddLocalAddress(na, addrmgr.ManualPrio); err != nil {
+			t.Errorf("#%d: AddLocalAddress: %v", i, err)
+		}
+	}
+
+	// A hidden service is advertised to the peers of any network.
+	remote := protos.NewNetAddressIPPort(net.ParseIP("204.124.1.1"), 8333, 0)
+	if best := amgr.GetBestLocalAddress(remote); best.IP != nil {
+		t.Errorf("GetBestLocalAddress: got %s want a hidden service",
+			addrmgr.NetAddressKey(best))
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASMap maps IP prefixes to the autonomous system (AS) announcing them, so
+// the peers can be diversified across hosting providers rather than only
+// across network groups.
+type ASMap struct {
+	// prefixes maps the prefix lengths, in bits of the 16 byte form of the
+	// addresses, to the masked prefixes of this length and their AS.
+	prefixes map[int]map[string]uint32
+
+	// lengths holds the prefix lengths of prefixes from the longest to the
+	// shortest, so the longest matching prefix is found first.
+	lengths []int
+}
+
+// LoadASMap loads an AS map from a text file with one '<prefix>/<bits> <asn>'
+// entry per line, such as '203.0.113.0/24 AS64496'.  The 'AS' prefix of the
+// AS numbers is optional.  Empty lines and lines starting with '#' are
+// ignored.
+func LoadASMap(path string) (*ASMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &ASMap{prefixes: make(map[int]map[string]uint32)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := m.add(text); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// add adds a '<prefix>/<bits> <asn>' entry to the map.
+func (m *ASMap) add(entry string) error {
+	fields := strings.Fields(entry)
+	if len(fields) != 2 {
+		return fmt.Errorf("malformed entry %q", entry)
+	}
+	_, ipNet, err := net.ParseCIDR(fields[0])
+	if err != nil {
+		return err
+	}
+	asn, err := strconv.ParseUint(strings.TrimPrefix(
+		strings.ToUpper(fields[1]), "AS"), 10, 32)
+	if err != nil || asn == 0 {
+		return fmt.Errorf("invalid AS number %q", fields[1])
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if bits == 8*net.IPv4len {
+		ones += 8 * (net.IPv6len - net.IPv4len)
+	}
+	mask := net.CIDRMask(ones, 8*net.IPv6len)
+	prefix := ipNet.IP.To16().Mask(mask)
+
+	if _, ok := m.prefixes[ones]; !ok {
+		m.prefixes[ones] = make(map[string]uint32)
+		m.lengths = append(m.lengths, ones)
+		sort.Sort(sort.Reverse(sort.IntSlice(m.lengths)))
+	}
+	m.prefixes[ones][string(prefix)] = uint32(asn)
+	return nil
+}
+
+// Lookup returns the AS announcing the longest prefix of the passed IP, or 0
+// when it is unknown or the map is nil.
+func (m *ASMap) Lookup(ip net.IP) uint32 {
+	if m == nil {
+		return 0
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return 0
+	}
+	for _, ones := range m.lengths {
+		prefix := ip.Mask(net.CIDRMask(ones, 8*net.IPv6len))
+		if asn, ok := m.prefixes[ones][string(prefix)]; ok {
+			return asn
+		}
+	}
+	return 0
+}
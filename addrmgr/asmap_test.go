@@ -0,0 +1,68 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestASMap ensures AS maps are loaded from their text form and map the IPs
+// to the AS of their longest prefix.
+func TestASMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmap")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "asmap.txt")
+	data := "# test map\n" +
+		"203.0.0.0/8 AS64496\n" +
+		"203.0.113.0/24 64497\n" +
+		"\n" +
+		"2001:db8::/32 as64498\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	m, err := LoadASMap(path)
+	if err != nil {
+		t.Fatalf("LoadASMap: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want uint32
+	}{
+		{"203.0.113.7", 64497},
+		{"203.1.2.3", 64496},
+		{"198.51.100.1", 0},
+		{"2001:db8::1", 64498},
+		{"2001:db9::1", 0},
+	}
+	for _, test := range tests {
+		if got := m.Lookup(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("Lookup(%s) = %d, want %d", test.ip, got, test.want)
+		}
+	}
+
+	var nilMap *ASMap
+	if got := nilMap.Lookup(net.ParseIP("203.0.113.7")); got != 0 {
+		t.Errorf("Lookup on nil map = %d, want 0", got)
+	}
+
+	bad := []string{"203.0.113.0/24", "203.0.113.0 64497", "203.0.113.0/24 ASX"}
+	for _, entry := range bad {
+		if err := ioutil.WriteFile(path, []byte(entry), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if _, err := LoadASMap(path); err == nil {
+			t.Errorf("LoadASMap accepted malformed entry %q", entry)
+		}
+	}
+}
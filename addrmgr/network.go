@@ -117,6 +117,18 @@ func IsOnionCatTor(na *protos.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
+// IsTorV3 returns whether or not the passed address is the address of a Tor
+// v3 hidden service.
+func IsTorV3(na *protos.NetAddress) bool {
+	return na.Network == protos.NetTorV3
+}
+
+// IsI2P returns whether or not the passed address is the address of an I2P
+// destination.
+func IsI2P(na *protos.NetAddress) bool {
+	return na.Network == protos.NetI2P
+}
+
 // IsRFC1918 returns whether or not the passed address is part of the IPv4
 // private network address space as defined by RFC1918 (10.0.0.0/8,
 // 172.16.0.0/12, or 192.168.0.0/16).
@@ -212,7 +224,12 @@ func IsRFC6598(na *protos.NetAddress) bool {
 // considered invalid under the following circumstances:
 // IPv4: It is either a zero or all bits set address.
 // IPv6: It is either a zero or RFC3849 documentation address.
+// Tor v3 and I2P: It does not have the 32 bytes of their addresses.
 func IsValid(na *protos.NetAddress) bool {
+	if IsTorV3(na) || IsI2P(na) {
+		return len(na.Addr) == 32
+	}
+
 	// IsUnspecified returns if address is 0, so only all bits set, and
 	// RFC3849 need to be explicitly checked.
 	return na.IP != nil && !(na.IP.IsUnspecified() ||
@@ -232,7 +249,8 @@ func IsRoutable(na *protos.NetAddress) bool {
 // GroupKey returns a string representing the network group an address is part
 // of.  This is the /16 for IPv4, the /32 (/36 for he.net) for IPv6, the string
 // "local" for a local address, the string "tor:key" where key is the /4 of the
-// onion address for Tor address, and the string "unroutable" for an unroutable
+// onion address for Tor address, "i2p:key" where key is the /4 of the I2P
+// address for I2P address, and the string "unroutable" for an unroutable
 // address.
 func GroupKey(na *protos.NetAddress) string {
 	if IsLocal(na) {
@@ -241,6 +259,12 @@ func GroupKey(na *protos.NetAddress) string {
 	if !IsRoutable(na) {
 		return "unroutable"
 	}
+	if IsTorV3(na) {
+		return fmt.Sprintf("tor:%d", na.Addr[0]&((1<<4)-1))
+	}
+	if IsI2P(na) {
+		return fmt.Sprintf("i2p:%d", na.Addr[0]&((1<<4)-1))
+	}
 	if IsIPv4(na) {
 		return na.IP.Mask(net.CIDRMask(16, 32)).String()
 	}
@@ -5,6 +5,8 @@ package ainterface
 
 import (
 	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
 )
 
 type Consensus interface {
@@ -13,6 +15,27 @@ type Consensus interface {
 	GetRoundInterval() int64
 }
 
+// Engine holds the rules of a consensus deciding who may produce a block and
+// how the block is sealed.  The block chain and the block template generator
+// go through it, so a consensus engine can be plugged in without changing the
+// block validation.
+type Engine interface {
+	// Prepare checks the coinbase of the header may produce a block at its
+	// round and slot, given the validators of the round.  It is run both
+	// on the blocks about to be produced and on the blocks connected.
+	Prepare(header *protos.BlockHeader, validators []*common.Address) error
+
+	// Finalize is run on a produced block once its transactions are
+	// selected and its state root is set, before it is sealed.
+	Finalize(block *protos.MsgBlock) error
+
+	// Seal signs the header by the passed account.
+	Seal(header *protos.BlockHeader, account *crypto.Account) error
+
+	// VerifySeal checks the header is sealed by its coinbase.
+	VerifySeal(header *protos.BlockHeader) error
+}
+
 type BlockNode interface {
 	Hash() common.Hash
 	StateRoot() common.Hash
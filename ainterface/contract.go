@@ -44,6 +44,28 @@ type AssetInfo struct {
 	History     []uint64 `json:"history"`
 }
 
+// RewardSplit is the distribution of the subsidy and fees of a block.  The
+// foundation receives the Foundation share of the reward of every asset, the
+// Burn share is not paid out, and the validator receives the rest.  The shares
+// are in basis points of common.RewardSplitBasis.
+type RewardSplit struct {
+	Foundation int64
+	Burn       int64
+}
+
+// Shares returns the parts of the passed reward which go to the foundation
+// and are burned, rounded down.
+func (s *RewardSplit) Shares(reward int64) (foundation, burn int64) {
+	return shareOf(reward, s.Foundation), shareOf(reward, s.Burn)
+}
+
+// shareOf returns the passed share, in basis points, of the value rounded
+// down, without overflowing for any value.
+func shareOf(value, share int64) int64 {
+	return value/common.RewardSplitBasis*share +
+		value%common.RewardSplitBasis*share/common.RewardSplitBasis
+}
+
 // ContractManager provides a generic interface that the is called when system contract state
 // need to be validated and each round started from the tip of the main chain for the
 // purpose of supporting system contracts.
@@ -54,6 +76,10 @@ type ContractManager interface {
 	// Get latest contract by height.
 	GetActiveContractByHeight(height int32, contractAddr common.ContractCode) *chaincfg.ContractInfo
 
+	// GetContractVersions returns all the versions of a system contract
+	// ordered by activation height, including the scheduled ones.
+	GetContractVersions(contractAddr common.ContractCode) []chaincfg.ContractInfo
+
 	GetContractAddressByAsset(
 		gas uint64,
 		block *asiutil.Block,
@@ -72,6 +98,12 @@ type ContractManager interface {
 		stateDB vm.StateDB,
 		chainConfig *params.ChainConfig) (map[protos.Asset]int32, error)
 
+	// Get the distribution of the block reward from state.  It returns
+	// false when the active contract does not set the distribution.
+	GetRewardSplit(block *asiutil.Block,
+		stateDB vm.StateDB,
+		chainConfig *params.ChainConfig) (*RewardSplit, bool, error)
+
 	// Get template from state
 	GetTemplate(block *asiutil.Block,
 		gas uint64,
@@ -0,0 +1,271 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Condition identifies an operational condition which raises alerts.
+type Condition string
+
+// These constants define the monitored operational conditions.
+const (
+	// CondStuckSync is raised when the best block did not change for a
+	// longer period than expected.
+	CondStuckSync Condition = "stucksync"
+
+	// CondDiskSpace is raised when the free space of a data directory
+	// falls below the configured threshold.
+	CondDiskSpace Condition = "diskspace"
+
+	// CondPeerCount is raised when the number of connected peers falls
+	// below the configured threshold.
+	CondPeerCount Condition = "peercount"
+
+	// CondMissedSlot is raised when the local validator did not produce a
+	// block in its slot.
+	CondMissedSlot Condition = "missedslot"
+
+	// CondDatabase is raised when a database operation failed.
+	CondDatabase Condition = "database"
+
+	// CondPanic is raised when a subsystem panicked and was restarted.
+	CondPanic Condition = "panic"
+
+	// CondSafeMode is raised while the chain is in safe mode.
+	CondSafeMode Condition = "safemode"
+)
+
+// Severity defines how urgent an alert is.
+type Severity int
+
+// These constants define the severity of alerts.
+const (
+	SevInfo Severity = iota
+	SevWarning
+	SevCritical
+)
+
+// severityStrings is a map of severities back to their names for pretty
+// printing.
+var severityStrings = map[Severity]string{
+	SevInfo:     "INFO",
+	SevWarning:  "WARNING",
+	SevCritical: "CRITICAL",
+}
+
+// String returns the Severity in human-readable form.
+func (s Severity) String() string {
+	if str, ok := severityStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown Severity (%d)", int(s))
+}
+
+// Alert describes a single occurrence of an operational condition.
+type Alert struct {
+	Node      string
+	Condition Condition
+	Severity  Severity
+	Message   string
+	Resolved  bool
+	Time      time.Time
+}
+
+// Subject returns a short single line summary of the alert.
+func (a *Alert) Subject() string {
+	state := a.Severity.String()
+	if a.Resolved {
+		state = "RESOLVED"
+	}
+	if a.Node == "" {
+		return fmt.Sprintf("[%s] %s", state, a.Condition)
+	}
+	return fmt.Sprintf("[%s] %s on %s", state, a.Condition, a.Node)
+}
+
+// String returns the alert as a human readable text.
+func (a *Alert) String() string {
+	return fmt.Sprintf("%s: %s (%s)", a.Subject(), a.Message,
+		a.Time.UTC().Format(time.RFC3339))
+}
+
+// Channel is the interface implemented by the alert delivery backends.
+type Channel interface {
+	// Name returns a short name of the channel used in logs.
+	Name() string
+
+	// Send delivers the passed alert.
+	Send(a *Alert) error
+}
+
+const (
+	// defaultMinInterval is the default minimum duration between two
+	// alerts of the same condition.
+	defaultMinInterval = time.Minute * 30
+
+	// channelQueueSize is the maximum number of alerts waiting to be sent
+	// through a channel.  Alerts raised while the queue is full are
+	// dropped rather than blocking the caller.
+	channelQueueSize = 32
+)
+
+// Config is a descriptor containing the alert manager configuration.
+type Config struct {
+	// Node is a name identifying the local node in the alerts.
+	Node string
+
+	// Channels are the backends every alert is sent to.
+	Channels []Channel
+
+	// MinInterval is the minimum duration between two alerts of the same
+	// condition.  Occurrences within this window are suppressed.
+	MinInterval time.Duration
+
+	// Now returns the current time.  It defaults to time.Now and may be
+	// replaced by tests.
+	Now func() time.Time
+}
+
+// conditionState tracks the alerts sent for a condition.
+type conditionState struct {
+	active     bool
+	lastSent   time.Time
+	suppressed int
+}
+
+// Manager rate limits alerts per condition and sends them to the configured
+// channels.
+type Manager struct {
+	cfg    Config
+	mtx    sync.Mutex
+	state  map[Condition]*conditionState
+	queues []chan *Alert
+}
+
+// New returns a new alert manager.  The alerts are sent through each channel
+// by a goroutine of its own, so a slow or unreachable backend delays neither
+// the caller nor the other channels.
+func New(cfg *Config) *Manager {
+	c := *cfg
+	if c.MinInterval <= 0 {
+		c.MinInterval = defaultMinInterval
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+	m := &Manager{
+		cfg:    c,
+		state:  make(map[Condition]*conditionState),
+		queues: make([]chan *Alert, len(c.Channels)),
+	}
+	for i, ch := range c.Channels {
+		m.queues[i] = make(chan *Alert, channelQueueSize)
+		go deliver(ch, m.queues[i])
+	}
+	return m
+}
+
+// Raise reports an occurrence of the given condition.  The alert is sent
+// unless another alert of the same condition was sent within the configured
+// minimum interval.  It returns whether the alert was sent.
+//
+// This function is safe for concurrent access.
+func (m *Manager) Raise(cond Condition, sev Severity, format string, args ...interface{}) bool {
+	now := m.cfg.Now()
+	m.mtx.Lock()
+	st, ok := m.state[cond]
+	if !ok {
+		st = &conditionState{}
+		m.state[cond] = st
+	}
+	st.active = true
+	if !st.lastSent.IsZero() && now.Sub(st.lastSent) < m.cfg.MinInterval {
+		st.suppressed++
+		m.mtx.Unlock()
+		return false
+	}
+	suppressed := st.suppressed
+	st.suppressed = 0
+	st.lastSent = now
+	m.mtx.Unlock()
+
+	msg := fmt.Sprintf(format, args...)
+	if suppressed > 0 {
+		msg = fmt.Sprintf("%s (%d similar alerts suppressed)", msg, suppressed)
+	}
+	m.send(&Alert{
+		Node:      m.cfg.Node,
+		Condition: cond,
+		Severity:  sev,
+		Message:   msg,
+		Time:      now,
+	})
+	return true
+}
+
+// Resolve reports that the given condition cleared.  A resolution alert is
+// only sent when the condition was previously raised, and the rate limit of
+// the condition is reset so a new occurrence is reported immediately.
+//
+// This function is safe for concurrent access.
+func (m *Manager) Resolve(cond Condition, format string, args ...interface{}) bool {
+	m.mtx.Lock()
+	st, ok := m.state[cond]
+	if !ok || !st.active {
+		m.mtx.Unlock()
+		return false
+	}
+	delete(m.state, cond)
+	m.mtx.Unlock()
+
+	m.send(&Alert{
+		Node:      m.cfg.Node,
+		Condition: cond,
+		Severity:  SevInfo,
+		Message:   fmt.Sprintf(format, args...),
+		Resolved:  true,
+		Time:      m.cfg.Now(),
+	})
+	return true
+}
+
+// Active returns whether the given condition is currently raised.
+func (m *Manager) Active(cond Condition) bool {
+	m.mtx.Lock()
+	st, ok := m.state[cond]
+	m.mtx.Unlock()
+	return ok && st.active
+}
+
+// send queues the alert to every channel without blocking.  The alert is
+// dropped for the channels whose queue is full.
+func (m *Manager) send(a *Alert) {
+	log.Warnf("%v", a)
+	for i, queue := range m.queues {
+		select {
+		case queue <- a:
+		default:
+			log.Errorf("Dropping alert for %s: %d alerts already "+
+				"waiting to be sent", m.cfg.Channels[i].Name(),
+				channelQueueSize)
+		}
+	}
+}
+
+// deliver sends the alerts of the passed queue through the channel in the
+// order they were raised.  Delivery errors are logged since there is no other
+// place to report them.  It runs for the lifetime of the process and must be
+// run as a goroutine.
+func deliver(ch Channel, queue <-chan *Alert) {
+	for a := range queue {
+		if err := ch.Send(a); err != nil {
+			log.Errorf("Unable to send alert through %s: %v", ch.Name(), err)
+		}
+	}
+}
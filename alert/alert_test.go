@@ -0,0 +1,194 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package alert
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockChannel records the alerts sent through it.
+type mockChannel struct {
+	alerts chan *Alert
+}
+
+func newMockChannel() *mockChannel {
+	return &mockChannel{alerts: make(chan *Alert, channelQueueSize)}
+}
+
+func (c *mockChannel) Name() string { return "mock" }
+
+func (c *mockChannel) Send(a *Alert) error {
+	c.alerts <- a
+	return nil
+}
+
+// wait returns the next n alerts sent through the channel.
+func (c *mockChannel) wait(t *testing.T, n int) []*Alert {
+	t.Helper()
+	alerts := make([]*Alert, 0, n)
+	for len(alerts) < n {
+		select {
+		case a := <-c.alerts:
+			alerts = append(alerts, a)
+		case <-time.After(time.Second * 10):
+			t.Fatalf("got %d alerts, want %d", len(alerts), n)
+		}
+	}
+	return alerts
+}
+
+// TestRateLimit ensures alerts of the same condition are rate limited and the
+// limit is reset once the condition is resolved.
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	ch := newMockChannel()
+	m := New(&Config{
+		Node:        "node1",
+		Channels:    []Channel{ch},
+		MinInterval: time.Minute,
+		Now:         func() time.Time { return now },
+	})
+
+	if !m.Raise(CondPeerCount, SevWarning, "only %d peers", 1) {
+		t.Fatal("first alert was not sent")
+	}
+	if m.Raise(CondPeerCount, SevWarning, "only %d peers", 0) {
+		t.Fatal("alert within the interval was not suppressed")
+	}
+	if !m.Raise(CondDiskSpace, SevCritical, "disk full") {
+		t.Fatal("alert of another condition was suppressed")
+	}
+
+	now = now.Add(time.Minute)
+	if !m.Raise(CondPeerCount, SevWarning, "only %d peers", 0) {
+		t.Fatal("alert after the interval was not sent")
+	}
+
+	if !m.Resolve(CondPeerCount, "recovered") {
+		t.Fatal("resolution was not sent")
+	}
+	if m.Resolve(CondPeerCount, "recovered") {
+		t.Fatal("resolution of an inactive condition was sent")
+	}
+	if !m.Raise(CondPeerCount, SevWarning, "only %d peers", 0) {
+		t.Fatal("alert after resolution was suppressed")
+	}
+
+	alerts := ch.wait(t, 5)
+	if !strings.Contains(alerts[2].Message, "1 similar alerts suppressed") {
+		t.Errorf("unexpected message %q", alerts[2].Message)
+	}
+	if got := alerts[3].Subject(); got != "[RESOLVED] peercount on node1" {
+		t.Errorf("unexpected subject %q", got)
+	}
+	select {
+	case a := <-ch.alerts:
+		t.Errorf("unexpected alert %v", a)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+// blockingChannel is a channel whose sends block until it is released.
+type blockingChannel struct {
+	release chan struct{}
+}
+
+func (c *blockingChannel) Name() string { return "blocking" }
+
+func (c *blockingChannel) Send(a *Alert) error {
+	<-c.release
+	return nil
+}
+
+// TestBlockedChannel ensures a channel which does not return delays neither
+// the caller raising the alerts nor the other channels.
+func TestBlockedChannel(t *testing.T) {
+	blocked := &blockingChannel{release: make(chan struct{})}
+	defer close(blocked.release)
+	ch := newMockChannel()
+	m := New(&Config{Channels: []Channel{blocked, ch}})
+
+	raised := make(chan struct{})
+	go func() {
+		// Overflow the queue of the blocked channel.
+		for i := 0; i < channelQueueSize+2; i++ {
+			m.Raise(Condition(string(rune('a'+i))), SevWarning, "alert %d", i)
+		}
+		close(raised)
+	}()
+	select {
+	case <-raised:
+	case <-time.After(time.Second * 10):
+		t.Fatal("Raise blocked by a channel not returning")
+	}
+	ch.wait(t, channelQueueSize)
+}
+
+// TestSMTPTimeout ensures a mail to a server which never answers gives up
+// once the timeout of the channel elapsed.
+func TestSMTPTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		// Accept the connection but never send the greeting.
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second * 10)
+		}
+	}()
+
+	c := &SMTPChannel{
+		Server:  listener.Addr().String(),
+		From:    "node@example.com",
+		To:      []string{"ops@example.com"},
+		Timeout: time.Millisecond * 100,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Send(&Alert{Condition: CondStuckSync, Time: time.Unix(0, 0)})
+	}()
+	select {
+	case err := <-errs:
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			t.Fatalf("Send = %v, want a timeout", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Send did not time out")
+	}
+}
+
+// TestSlackChannel ensures the Slack channel posts the alert text.
+func TestSlackChannel(t *testing.T) {
+	texts := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		texts <- body["text"]
+	}))
+	defer srv.Close()
+
+	a := &Alert{
+		Condition: CondStuckSync,
+		Severity:  SevWarning,
+		Message:   "stuck",
+		Time:      time.Unix(0, 0),
+	}
+	if err := NewSlackChannel(srv.URL).Send(a); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := <-texts; got != a.String() {
+		t.Errorf("got text %q, want %q", got, a.String())
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SlackChannel posts alerts to a Slack incoming webhook.
+type SlackChannel struct {
+	URL    string
+	Client *http.Client
+}
+
+// Ensure SlackChannel implements the Channel interface.
+var _ Channel = (*SlackChannel)(nil)
+
+// NewSlackChannel returns a channel posting to the given Slack webhook URL.
+func NewSlackChannel(url string) *SlackChannel {
+	return &SlackChannel{
+		URL:    url,
+		Client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+// Name returns the name of the channel.
+func (c *SlackChannel) Name() string {
+	return "slack"
+}
+
+// Send posts the alert to the webhook.
+func (c *SlackChannel) Send(a *Alert) error {
+	payload, err := json.Marshal(map[string]string{"text": a.String()})
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Post(c.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// defaultSMTPTimeout is the default duration a mail may take to be sent,
+// from dialing the server to the end of the session.
+const defaultSMTPTimeout = time.Second * 30
+
+// SMTPChannel mails alerts through an SMTP server.
+type SMTPChannel struct {
+	// Server is the host:port of the SMTP server.
+	Server string
+
+	// User and Pass are used for PLAIN authentication when User is set.
+	User string
+	Pass string
+
+	From string
+	To   []string
+
+	// Timeout bounds the duration of a mail, from dialing the server to
+	// the end of the session.  It defaults to defaultSMTPTimeout.
+	Timeout time.Duration
+}
+
+// Ensure SMTPChannel implements the Channel interface.
+var _ Channel = (*SMTPChannel)(nil)
+
+// Name returns the name of the channel.
+func (c *SMTPChannel) Name() string {
+	return "smtp"
+}
+
+// Send mails the alert to all recipients.  Unlike smtp.SendMail, it gives up
+// once the timeout of the channel elapsed, so an unresponsive server does not
+// hold the alerts of the channel forever.
+func (c *SMTPChannel) Send(a *Alert) error {
+	host, _, err := net.SplitHostPort(c.Server)
+	if err != nil {
+		return err
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", c.Server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err := client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if c.User != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("server %s does not support AUTH", c.Server)
+		}
+		err := client.Auth(smtp.PlainAuth("", c.User, c.Pass, host))
+		if err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, to := range c.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", a.Subject())
+	fmt.Fprintf(&msg, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(a.String())
+	msg.WriteString("\r\n")
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
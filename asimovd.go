@@ -127,7 +127,11 @@ func flowdMain(serverChan chan<- *servers.NodeServer) error {
 	}()
 
 	// Load StateDB
-	stateDB, err := ethdb.NewLDBDatabase(cfg.StateDir, 768, 1024)
+	openStateDB := ethdb.NewLDBDatabase
+	if cfg.ReadReplica {
+		openStateDB = ethdb.NewLDBDatabaseReadOnly
+	}
+	stateDB, err := openStateDB(cfg.StateDir, 768, 1024)
 	if err != nil {
 		mainLog.Errorf("%v", err)
 		return err
@@ -222,6 +226,18 @@ func loadBlockDB(cfg *chaincfg.FConfig) (database.Transactor, error) {
 		removeRegressionDB(dbPath)
 	}
 
+	// A read replica never writes to the database, which must exist.
+	if cfg.ReadReplica {
+		mainLog.Infof("Loading block database from '%s' read-only", dbPath)
+		db, err := dbdriver.OpenReadOnly(database.FFLDB, dbPath,
+			chaincfg.ActiveNetParams.Net)
+		if err != nil {
+			return nil, err
+		}
+		mainLog.Info("Block database loaded")
+		return db, nil
+	}
+
 	mainLog.Infof("Loading block database from '%s'", dbPath)
 	db, err := dbdriver.Open(database.FFLDB, dbPath, chaincfg.ActiveNetParams.Net)
 	if err != nil {
@@ -263,6 +279,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run the offline transaction commands instead of the node when one is
+	// given on the command line.
+	if len(os.Args) > 1 && isTxCommand(os.Args[1]) {
+		if err := txCommandMain(); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Call serviceMain on Windows to handle running as a service.  When
 	// the return isService flag is true, exit now since we ran as a
 	// service.  Otherwise, just fall through to normal operation.
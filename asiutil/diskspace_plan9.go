@@ -0,0 +1,14 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package asiutil
+
+import (
+	"errors"
+)
+
+// DiskSpace is not supported on Plan 9 and always returns an error.
+func DiskSpace(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk space query is not supported on plan9")
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package asiutil
+
+import (
+	"syscall"
+)
+
+// DiskSpace returns the number of bytes available to an unprivileged user and
+// the total size in bytes of the file system holding path.
+func DiskSpace(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize),
+		uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
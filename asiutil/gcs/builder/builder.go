@@ -12,6 +12,7 @@ import (
 
 	"github.com/AsimovNetwork/asimov/asiutil/gcs"
 	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
 )
 
 const (
@@ -321,6 +322,54 @@ func BuildBasicFilter(block *protos.MsgBlock, prevOutScripts [][]byte) (*gcs.Fil
 	return b.Build()
 }
 
+// BuildContractFilter builds a contract GCS filter from a block and its
+// virtual block.  Besides the scripts of the basic filter, a contract filter
+// contains the scripts of the outputs created by the virtual block, which pay
+// the transfers of the contracts, and the addresses the scripts pay to,
+// including the addresses of the contracts called.  The previous output
+// scripts are those spent by both blocks.
+func BuildContractFilter(block *protos.MsgBlock, vblock *protos.MsgVBlock,
+	prevOutScripts [][]byte) (*gcs.Filter, error) {
+
+	blockHash := block.BlockHash()
+	b := WithKeyHash(&blockHash)
+	if _, err := b.Key(); err != nil {
+		return nil, err
+	}
+
+	addScript := func(script []byte) {
+		if len(script) == 0 {
+			return
+		}
+		b.AddEntry(script)
+
+		// Wallets watching an address match it whatever the kind of
+		// script paying to it.
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(script)
+		if err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			b.AddEntry(addr.ScriptAddress())
+		}
+	}
+
+	txs := block.Transactions
+	if vblock != nil {
+		txs = append(txs[:len(txs):len(txs)], vblock.VTransactions...)
+	}
+	for _, tx := range txs {
+		for _, txOut := range tx.TxOut {
+			addScript(txOut.PkScript)
+		}
+	}
+	for _, prevScript := range prevOutScripts {
+		addScript(prevScript)
+	}
+
+	return b.Build()
+}
+
 // GetFilterHash returns the double-SHA256 of the filter.
 func GetFilterHash(filter *gcs.Filter) (common.Hash, error) {
 	filterData, err := filter.NBytes()
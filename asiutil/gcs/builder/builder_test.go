@@ -12,6 +12,7 @@ import (
 	"github.com/AsimovNetwork/asimov/asiutil/gcs"
 	"github.com/AsimovNetwork/asimov/asiutil/gcs/builder"
 	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/txscript"
 )
 
@@ -245,3 +246,61 @@ func BuilderTest(b *builder.GCSBuilder, hash *common.Hash, p uint8, addrBytes []
 		t.Fatal("Filter size increased with duplicate items")
 	}
 }
+
+// TestBuildContractFilter ensures a contract filter matches the scripts and
+// the addresses of the outputs of a block and its virtual block, and the
+// spent scripts.
+func TestBuildContractFilter(t *testing.T) {
+	addr, err := asiutil.DecodeAddress(testAddr)
+	if err != nil {
+		t.Fatalf("Address decode failed: %s", err.Error())
+	}
+	addrScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("Address script build failed: %s", err.Error())
+	}
+	contract := make([]byte, common.AddressLength)
+	contract[0] = common.ContractHashAddrID
+	contract[common.AddressLength-1] = 0x01
+	contractScript, err := txscript.PayToContractHash(contract)
+	if err != nil {
+		t.Fatalf("Contract script build failed: %s", err.Error())
+	}
+
+	tx := protos.NewMsgTx(protos.TxVersion)
+	tx.AddTxOut(protos.NewTxOut(1, contractScript, protos.Asset{}))
+	block := protos.NewMsgBlock(&protos.BlockHeader{Height: 1})
+	block.AddTransaction(tx)
+	vtx := protos.NewMsgTx(protos.TxVersion)
+	vtx.AddTxOut(protos.NewTxOut(1, addrScript, protos.Asset{}))
+	vblock := &protos.MsgVBlock{}
+	vblock.AddTransaction(vtx)
+	spent := []byte("spent script")
+
+	f, err := builder.BuildContractFilter(block, vblock, [][]byte{spent})
+	if err != nil {
+		t.Fatalf("BuildContractFilter failed: %s", err)
+	}
+	blockHash := block.BlockHash()
+	key := builder.DeriveKey(&blockHash)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"contract script", contractScript},
+		{"contract address", contract},
+		{"virtual block script", addrScript},
+		{"virtual block address", addr.ScriptAddress()},
+		{"spent script", spent},
+	}
+	for _, test := range tests {
+		match, err := f.Match(key, test.data)
+		if err != nil {
+			t.Fatalf("Filter match failed: %s", err)
+		}
+		if !match {
+			t.Errorf("Filter didn't match the %s", test.name)
+		}
+	}
+
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package audit implements an append-only log recording the acceptance
+// decisions of the node for blocks and transactions.
+//
+// Every record is written as a single line of JSON.  Records carry a sequence
+// number and the hash of the previous line so any modification or removal of
+// a record breaks the chain and is detected by Verify.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Object identifies the kind of object a record is about.
+type Object string
+
+// These constants define the kinds of audited objects.
+const (
+	ObjBlock Object = "block"
+	ObjTx    Object = "tx"
+	ObjKey   Object = "key"
+)
+
+// Decision is the outcome of processing an object.
+type Decision string
+
+// These constants define the audited decisions.
+const (
+	Accepted Decision = "accepted"
+	Rejected Decision = "rejected"
+	Orphan   Decision = "orphan"
+	Rotated  Decision = "rotated"
+)
+
+// These constants define the origins of objects which were not received from
+// a peer.
+const (
+	OriginLocal = "local"
+	OriginRPC   = "rpc"
+)
+
+// lastLineWindow is the number of bytes read from the end of an existing log
+// in order to find its last record.
+const lastLineWindow = 64 * 1024
+
+// Record is a single entry of the audit log.
+type Record struct {
+	Seq      uint64   `json:"seq"`
+	Time     string   `json:"time"`
+	Object   Object   `json:"object"`
+	Hash     string   `json:"hash"`
+	Height   int32    `json:"height,omitempty"`
+	Origin   string   `json:"origin"`
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+	Prev     string   `json:"prev"`
+}
+
+// Log is an append-only audit log.  A nil Log discards all records so callers
+// do not need to check whether auditing is enabled.
+type Log struct {
+	mtx  sync.Mutex
+	file *os.File
+	seq  uint64
+	prev string
+	now  func() time.Time
+}
+
+// Open opens the audit log at the passed path, creating it when it does not
+// exist, and continues the record chain of an existing log.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{file: file, now: time.Now}
+	last, err := lastLine(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if last != nil {
+		var r Record
+		if err := json.Unmarshal(last, &r); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("corrupt audit log %s: %v", path, err)
+		}
+		l.seq = r.Seq
+		l.prev = lineHash(last)
+	}
+	return l, nil
+}
+
+// lastLine returns the last non-empty line of the passed file, or nil when the
+// file is empty.
+func lastLine(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+	offset := size - lastLineWindow
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, size-offset)
+	if _, err := file.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = bytes.TrimRight(buf, "\n")
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	return buf, nil
+}
+
+// lineHash returns the hex encoded hash of a record line.
+func lineHash(line []byte) string {
+	hash := sha256.Sum256(line)
+	return hex.EncodeToString(hash[:])
+}
+
+// Record appends a record about the passed object to the log.  A non-nil err
+// marks the object as rejected with the error as the reason.
+//
+// This function is safe for concurrent access.
+func (l *Log) Record(obj Object, hash fmt.Stringer, height int32, origin string,
+	decision Decision, reason error) {
+
+	if l == nil {
+		return
+	}
+	r := Record{
+		Object:   obj,
+		Hash:     hash.String(),
+		Height:   height,
+		Origin:   origin,
+		Decision: decision,
+	}
+	if reason != nil {
+		r.Reason = reason.Error()
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	r.Seq = l.seq + 1
+	r.Time = l.now().UTC().Format(time.RFC3339Nano)
+	r.Prev = l.prev
+	line, err := json.Marshal(&r)
+	if err != nil {
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return
+	}
+	l.seq = r.Seq
+	l.prev = lineHash(line)
+}
+
+// Block records the decision about a block.  A non-nil err marks the block as
+// rejected.
+func (l *Log) Block(hash fmt.Stringer, height int32, origin string, isOrphan bool, err error) {
+	decision := Accepted
+	switch {
+	case err != nil:
+		decision = Rejected
+	case isOrphan:
+		decision = Orphan
+	}
+	l.Record(ObjBlock, hash, height, origin, decision, err)
+}
+
+// Tx records the decision about a transaction.  A non-nil err marks the
+// transaction as rejected.
+func (l *Log) Tx(hash fmt.Stringer, origin string, isOrphan bool, err error) {
+	decision := Accepted
+	switch {
+	case err != nil:
+		decision = Rejected
+	case isOrphan:
+		decision = Orphan
+	}
+	l.Record(ObjTx, hash, 0, origin, decision, err)
+}
+
+// Close syncs and closes the log.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// Verify reads an audit log and ensures the records form an unbroken chain.
+// It returns the number of verified records.
+func Verify(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	var seq uint64
+	var prev string
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return seq, fmt.Errorf("record after %d: %v", seq, err)
+		}
+		if seq > 0 && (rec.Seq != seq+1 || rec.Prev != prev) {
+			return seq, fmt.Errorf("record %d does not follow record %d",
+				rec.Seq, seq)
+		}
+		seq = rec.Seq
+		prev = lineHash(line)
+	}
+	return seq, scanner.Err()
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestLogChain ensures records survive reopening the log and tampering with a
+// record is detected.
+func TestLogChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	l.Block(common.Hash{1}, 5, "127.0.0.1:8777", false, nil)
+	l.Tx(common.Hash{2}, OriginRPC, false, errors.New("insufficient fee"))
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Reopening must continue the chain.
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	l.Block(common.Hash{3}, 6, OriginLocal, true, nil)
+	l.Close()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	n, err := Verify(bytes.NewReader(content))
+	if err != nil || n != 3 {
+		t.Fatalf("Verify: got %d records, err %v", n, err)
+	}
+	if !bytes.Contains(content, []byte(`"decision":"rejected","reason":"insufficient fee"`)) ||
+		!bytes.Contains(content, []byte(`"decision":"orphan"`)) {
+		t.Errorf("unexpected log content %s", content)
+	}
+
+	tampered := bytes.Replace(content, []byte("insufficient fee"),
+		[]byte("sufficient fee"), 1)
+	if _, err := Verify(bytes.NewReader(tampered)); err == nil {
+		t.Error("Verify: tampered log was not detected")
+	}
+
+	// A nil log discards records.
+	var nilLog *Log
+	nilLog.Tx(common.Hash{}, OriginLocal, false, nil)
+}
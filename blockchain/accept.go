@@ -6,6 +6,8 @@ package blockchain
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/database"
@@ -23,7 +25,7 @@ import (
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) maybeAcceptBlock(block *asiutil.Block, vblock *asiutil.VBlock,
-	receipts types.Receipts, logs []*types.Log,
+	receipts types.Receipts, logs []*types.Log, arrival time.Time,
 	flags common.BehaviorFlags) (bool, error) {
 	// The height of this block is one more than the referenced previous
 	// block.
@@ -34,7 +36,10 @@ func (b *BlockChain) maybeAcceptBlock(block *asiutil.Block, vblock *asiutil.VBlo
 		return false, ruleError(ErrPreviousBlockUnknown, str)
 	} else if b.index.NodeStatus(prevNode).KnownInvalid() {
 		str := fmt.Sprintf("previous block %s is known to be invalid", prevHash)
-		return false, ruleError(ErrInvalidAncestorBlock, str)
+		err := ruleError(ErrInvalidAncestorBlock, str)
+		b.checkInvalidChain(prevNode.weight+uint64(block.MsgBlock().Header.Weight),
+			block.Hash(), err)
+		return false, err
 	}
 
 	fastAdd := flags&common.BFFastAdd == common.BFFastAdd
@@ -56,6 +61,13 @@ func (b *BlockChain) maybeAcceptBlock(block *asiutil.Block, vblock *asiutil.VBlo
 		if err != nil {
 			return false, err
 		}
+
+		// Reject the blocks of the validators penalized with the
+		// reject mode.
+		err = b.checkPenalty(blockHeader.CoinBase, round.Round)
+		if err != nil {
+			return false, err
+		}
 	}
 
 	// Insert the block into the database if it's not already there.  Even
@@ -72,6 +84,10 @@ func (b *BlockChain) maybeAcceptBlock(block *asiutil.Block, vblock *asiutil.VBlo
 		if dberr != nil {
 			return dberr
 		}
+		dberr = dbPutBlockArrival(dbTx, block.Hash(), arrival)
+		if dberr != nil {
+			return dberr
+		}
 		if fastAdd && vblock != nil {
 			dberr = dbStoreVBlock(dbTx, vblock)
 		}
@@ -95,6 +111,9 @@ func (b *BlockChain) maybeAcceptBlock(block *asiutil.Block, vblock *asiutil.VBlo
 	if err != nil {
 		return false, err
 	}
+	if !fastAdd {
+		b.checkEquivocation(newNode)
+	}
 
 	// Connect the passed block to the chain while respecting proper chain
 	// selection according to the chain with the most proof of work.  This
@@ -0,0 +1,155 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+)
+
+// BlockArrival describes when a main chain block was received by the node
+// compared to the timestamp set by its validator.
+type BlockArrival struct {
+	Height    int32
+	Hash      common.Hash
+	Validator common.Address
+	Timestamp int64
+	Arrival   time.Time
+}
+
+// Delay returns the time elapsed between the timestamp of the block and its
+// arrival.  A negative delay means the block arrived before its timestamp,
+// which denotes a validator clock running ahead.
+func (a *BlockArrival) Delay() time.Duration {
+	return a.Arrival.Sub(time.Unix(a.Timestamp, 0))
+}
+
+// ValidatorArrivals summarizes the arrival delays of the blocks produced by a
+// validator.
+type ValidatorArrivals struct {
+	Validator  common.Address
+	Blocks     int
+	LastHeight int32
+	Min        time.Duration
+	Max        time.Duration
+	Mean       time.Duration
+	Median     time.Duration
+}
+
+// dbPutBlockArrival stores the time the block with the passed hash was
+// received by the node.  The time is serialized as the number of milliseconds
+// since the unix epoch.
+func dbPutBlockArrival(dbTx database.Tx, hash *common.Hash, arrival time.Time) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(blockArrivalBucketName)
+	if err != nil {
+		return err
+	}
+	var serialized [8]byte
+	byteOrder.PutUint64(serialized[:], uint64(arrival.UnixNano()/int64(time.Millisecond)))
+	return bucket.Put(hash[:], serialized[:])
+}
+
+// dbFetchBlockArrival returns the time the block with the passed hash was
+// received by the node, and false when it was not recorded, as for the blocks
+// connected before the node recorded arrivals.
+func dbFetchBlockArrival(dbTx database.Tx, hash *common.Hash) (time.Time, bool) {
+	bucket := dbTx.Metadata().Bucket(blockArrivalBucketName)
+	if bucket == nil {
+		return time.Time{}, false
+	}
+	serialized := bucket.Get(hash[:])
+	if len(serialized) != 8 {
+		return time.Time{}, false
+	}
+	millis := int64(byteOrder.Uint64(serialized))
+	return time.Unix(0, millis*int64(time.Millisecond)), true
+}
+
+// BlockArrivals returns the arrivals of the main chain blocks from the start
+// height to the end height inclusive.  The blocks whose arrival was not
+// recorded are skipped.
+//
+// Note that the blocks received while the node catches up with the network
+// arrive long after their timestamp, so their delays only reflect the sync.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockArrivals(startHeight, endHeight int32) ([]BlockArrival, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	if tip := b.bestChain.Tip().height; endHeight > tip {
+		endHeight = tip
+	}
+
+	var arrivals []BlockArrival
+	err := b.db.View(func(dbTx database.Tx) error {
+		for height := startHeight; height <= endHeight; height++ {
+			node := b.bestChain.NodeByHeight(height)
+			if node == nil {
+				continue
+			}
+			arrival, ok := dbFetchBlockArrival(dbTx, &node.hash)
+			if !ok {
+				continue
+			}
+			arrivals = append(arrivals, BlockArrival{
+				Height:    node.height,
+				Hash:      node.hash,
+				Validator: node.coinbase,
+				Timestamp: node.timestamp,
+				Arrival:   arrival,
+			})
+		}
+		return nil
+	})
+	return arrivals, err
+}
+
+// SummarizeArrivals groups the passed block arrivals by validator and
+// computes the statistics of their delays.  The result is sorted by validator
+// address.
+func SummarizeArrivals(arrivals []BlockArrival) []ValidatorArrivals {
+	delays := make(map[common.Address][]time.Duration)
+	lastHeights := make(map[common.Address]int32)
+	for i := range arrivals {
+		a := &arrivals[i]
+		delays[a.Validator] = append(delays[a.Validator], a.Delay())
+		if a.Height > lastHeights[a.Validator] {
+			lastHeights[a.Validator] = a.Height
+		}
+	}
+
+	summaries := make([]ValidatorArrivals, 0, len(delays))
+	for validator, ds := range delays {
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		var sum time.Duration
+		for _, d := range ds {
+			sum += d
+		}
+		median := ds[len(ds)/2]
+		if len(ds)%2 == 0 {
+			median = (ds[len(ds)/2-1] + ds[len(ds)/2]) / 2
+		}
+		summaries = append(summaries, ValidatorArrivals{
+			Validator:  validator,
+			Blocks:     len(ds),
+			LastHeight: lastHeights[validator],
+			Min:        ds[0],
+			Max:        ds[len(ds)-1],
+			Mean:       sum / time.Duration(len(ds)),
+			Median:     median,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Validator.Hex() < summaries[j].Validator.Hex()
+	})
+	return summaries
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestSummarizeArrivals ensures the arrival delays are grouped by validator
+// and summarized correctly.
+func TestSummarizeArrivals(t *testing.T) {
+	slow := common.Address{2}
+	fast := common.Address{1}
+	arrival := func(height int32, validator common.Address, delay time.Duration) BlockArrival {
+		timestamp := int64(1600000000 + height*5)
+		return BlockArrival{
+			Height:    height,
+			Validator: validator,
+			Timestamp: timestamp,
+			Arrival:   time.Unix(timestamp, 0).Add(delay),
+		}
+	}
+	arrivals := []BlockArrival{
+		arrival(1, slow, 3*time.Second),
+		arrival(2, fast, -100*time.Millisecond),
+		arrival(3, slow, time.Second),
+		arrival(4, slow, 8*time.Second),
+		arrival(5, fast, 300*time.Millisecond),
+	}
+
+	summaries := SummarizeArrivals(arrivals)
+	if len(summaries) != 2 {
+		t.Fatalf("got %d summaries, want 2", len(summaries))
+	}
+	want := []ValidatorArrivals{{
+		Validator:  fast,
+		Blocks:     2,
+		LastHeight: 5,
+		Min:        -100 * time.Millisecond,
+		Max:        300 * time.Millisecond,
+		Mean:       100 * time.Millisecond,
+		Median:     100 * time.Millisecond,
+	}, {
+		Validator:  slow,
+		Blocks:     3,
+		LastHeight: 4,
+		Min:        time.Second,
+		Max:        8 * time.Second,
+		Mean:       4 * time.Second,
+		Median:     3 * time.Second,
+	}}
+	for i := range want {
+		if summaries[i] != want[i] {
+			t.Errorf("summary %d: got %+v, want %+v", i, summaries[i], want[i])
+		}
+	}
+
+	if len(SummarizeArrivals(nil)) != 0 {
+		t.Error("summaries returned without arrivals")
+	}
+}
@@ -89,7 +89,7 @@ func (b *BlockChain) FetchUtxoView(tx *asiutil.Tx, dolock bool) (*txo.UtxoViewpo
 	if dolock {
 		b.chainLock.RLock()
 	}
-	err := FetchUtxosMain(view, b.db, neededSet)
+	err := b.utxoCache.fetchEntries(view, neededSet)
 	if dolock {
 		b.chainLock.RUnlock()
 	}
@@ -114,18 +114,13 @@ func (b *BlockChain) FetchUtxoEntry(outpoint protos.OutPoint) (*txo.UtxoEntry, e
 }
 
 func (b *BlockChain) fetchUtxoEntry(outpoint protos.OutPoint) (*txo.UtxoEntry, error) {
-
-	var entry *txo.UtxoEntry
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		entry, err = dbFetchUtxoEntry(dbTx, outpoint)
-		return err
-	})
+	view := txo.NewUtxoViewpoint()
+	err := b.utxoCache.fetchEntries(view, map[protos.OutPoint]struct{}{outpoint: {}})
 	if err != nil {
 		return nil, err
 	}
 
-	return entry, nil
+	return view.LookupEntry(outpoint), nil
 }
 
 func (b *BlockChain) FetchUtxoViewByAddressAndAsset(view *txo.UtxoViewpoint, address []byte, asset *protos.Asset) (*[]protos.OutPoint, error) {
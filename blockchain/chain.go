@@ -18,6 +18,7 @@ import (
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+	"github.com/AsimovNetwork/asimov/tracing"
 	"github.com/AsimovNetwork/asimov/txscript"
 	"github.com/AsimovNetwork/asimov/vm/fvm"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core"
@@ -71,6 +72,7 @@ type BlockLocator []*common.Hash
 type orphanBlock struct {
 	block      *asiutil.Block
 	expiration time.Time
+	arrival    time.Time
 }
 
 // BestState houses information about the current best block and other info
@@ -128,12 +130,16 @@ type BlockChain struct {
 	// separate mutex.
 	checkpoints         []chaincfg.Checkpoint
 	checkpointsByHeight map[int32]*chaincfg.Checkpoint
+	assumeValid         *common.Hash
 	db                  database.Transactor
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
 	indexManager        IndexManager
+	sigCache            *txscript.SigCache
+	utxoCache           *utxoCache
 	contractManager     ainterface.ContractManager
 	roundManager        ainterface.IRoundManager
+	engine              ainterface.Engine
 
 	// chainLock protects concurrent access to the vast majority of the
 	// fields in this struct below this point.
@@ -225,6 +231,56 @@ type BlockChain struct {
 	vmConfig vm.Config
 
 	feesChan chan interface{}
+
+	// pauseReason is set while the acceptance of new blocks is paused,
+	// for example because a data directory is running out of space.  It
+	// is protected by the pause lock.
+	pauseLock   sync.RWMutex
+	pauseReason string
+
+	// safeModeReason is set while the chain is in safe mode, after a deep
+	// reorganize or an invalid chain with more weight than the best chain
+	// was seen, until an operator acknowledges it.  It is protected by the
+	// safe mode lock.
+	safeModeLock       sync.RWMutex
+	safeModeReason     string
+	safeModeReorgDepth int32
+
+	// penalties are the penalties applied to misbehaving validators
+	// according to the penalty rules.  They are protected by the penalty
+	// lock.  slotBlocks are the recent blocks by round and slot, used to
+	// detect equivocations, and are protected by the chain lock.
+	penaltyLock  sync.RWMutex
+	penalties    map[common.Address]*ValidatorPenalty
+	penaltyRules PenaltyRules
+	slotBlocks   map[penaltySlot]*blockNode
+
+	// forensicDir is the directory forensic dumps of blocks diverging from
+	// the computed state are written to.  Dumps are disabled when empty.
+	forensicDir string
+
+	// pruneTarget is the size, in bytes, the stored blocks are pruned to,
+	// and pruneDepth the number of blocks below the best block which are
+	// never pruned.  Pruning is disabled when the target is zero.
+	pruneTarget uint64
+	pruneDepth  int32
+
+	// readOnly is set when the databases are opened read-only.  The chain
+	// state is then loaded as found and never written.
+	readOnly bool
+
+	// traceSpan is the span of the block being processed, the parent of
+	// the spans of its validation.  It is protected by the chain lock.
+	traceSpan *tracing.Span
+
+	// txTraceSpan is the span of the transaction being connected, the
+	// parent of the spans of its contract executions.  It is protected by
+	// the chain lock.
+	txTraceSpan *tracing.Span
+
+	// txTracer, when set, traces the contract executions of the
+	// transaction being connected.  It is protected by the chain lock.
+	txTracer vm.Tracer
 }
 
 // HaveBlock returns whether or not the chain instance has the block represented
@@ -286,6 +342,11 @@ func (b *BlockChain) GetOrphanRoot(hash *common.Hash) *common.Hash {
 	return orphanRoot
 }
 
+// Engine returns the consensus engine of the chain.
+func (b *BlockChain) Engine() ainterface.Engine {
+	return b.engine
+}
+
 func (b *BlockChain) GetStateCache() state.Database {
 	return b.stateCache
 }
@@ -331,7 +392,7 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 // It also imposes a maximum limit on the number of outstanding orphan
 // blocks and will remove the oldest received orphan block if the limit is
 // exceeded.
-func (b *BlockChain) addOrphanBlock(block *asiutil.Block) {
+func (b *BlockChain) addOrphanBlock(block *asiutil.Block, arrival time.Time) {
 	// Remove expired orphan blocks.
 	for _, oBlock := range b.orphans {
 		if time.Now().After(oBlock.expiration) {
@@ -365,6 +426,7 @@ func (b *BlockChain) addOrphanBlock(block *asiutil.Block) {
 	oBlock := &orphanBlock{
 		block:      block,
 		expiration: expiration,
+		arrival:    arrival,
 	}
 	b.orphans[*block.Hash()] = oBlock
 
@@ -625,6 +687,18 @@ func (b *BlockChain) connectBlock(node *blockNode, block *asiutil.Block,
 	state := newBestState(node, blockSize, numTxns,
 		curTotalTxns+numTxns, block.MsgBlock().Header.Timestamp)
 
+	// Record the intent to connect the block before writing it to any
+	// store.  It is removed along with the update of the chain state.
+	err = b.putChainIntent(blockIntentKeyName, &chainIntent{
+		op:       intentConnect,
+		hash:     node.hash,
+		height:   node.height,
+		prevHash: *prevHash,
+	})
+	if err != nil {
+		return err
+	}
+
 	// save receipts
 	if receipts != nil {
 		// batch := b.ethDB.NewBatch()
@@ -640,22 +714,22 @@ func (b *BlockChain) connectBlock(node *blockNode, block *asiutil.Block,
 			return err
 		}
 
-		// Add the block hash and height to the block index which tracks
-		// the main chain.
-		err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
+		// The block is connected once the transaction is committed.
+		err = dbRemoveChainIntent(dbTx, blockIntentKeyName)
 		if err != nil {
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
+		// Add the block hash and height to the block index which tracks
+		// the main chain.
+		err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
 		if err != nil {
 			return err
 		}
 
-		// Update the balance using the state of the utxo view.
+		// Update the balance using the state of the utxo view.  The
+		// utxo set itself is updated through the utxo cache once the
+		// block is connected.
 		err = dbPutBalance(dbTx, view)
 		if err != nil {
 			return err
@@ -693,7 +767,8 @@ func (b *BlockChain) connectBlock(node *blockNode, block *asiutil.Block,
 			}
 		}
 
-		return nil
+		// Prune the oldest blocks when they exceed the target size.
+		return b.pruneBlocks(dbTx, node)
 	})
 	if err != nil {
 		return err
@@ -702,6 +777,16 @@ func (b *BlockChain) connectBlock(node *blockNode, block *asiutil.Block,
 	log.Infof("connectBlock success: height=%d, round=%d, slot=%d, hash=%s, stateRoot=%s",
 		node.height, node.round.Round, node.slot, node.hash.String(), node.stateRoot.String())
 
+	// Record the utxos spent and created by the block in the utxo cache,
+	// which writes them to the database in batches.  A failed flush keeps
+	// them in the cache to be written by the next one.
+	b.utxoCache.commit(view, true)
+	if b.utxoCache.needsFlush() {
+		if err := b.utxoCache.flush(node); err != nil {
+			log.Errorf("Unable to flush the utxo cache: %v", err)
+		}
+	}
+
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.Commit()
@@ -774,6 +859,25 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *asiutil.Block, view
 	state := newBestState(prevNode, blockSize, numTxns,
 		newTotalTxns, prevNode.GetTime())
 
+	// Record the intent to disconnect the block before writing it to any
+	// store.  It is removed along with the update of the chain state.
+	err = b.putChainIntent(blockIntentKeyName, &chainIntent{
+		op:       intentDisconnect,
+		hash:     node.hash,
+		height:   node.height,
+		prevHash: node.hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write the utxo cache so the view restoring the utxo set can be
+	// written to the database directly, along with the block it is at.
+	err = b.utxoCache.flush(node)
+	if err != nil {
+		return err
+	}
+
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state)
@@ -781,6 +885,12 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *asiutil.Block, view
 			return err
 		}
 
+		// The block is disconnected once the transaction is committed.
+		err = dbRemoveChainIntent(dbTx, blockIntentKeyName)
+		if err != nil {
+			return err
+		}
+
 		// Remove the block hash and height from the block index which
 		// tracks the main chain.
 		err = dbRemoveBlockIndex(dbTx, block.Hash(), node.height)
@@ -795,6 +905,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *asiutil.Block, view
 		if err != nil {
 			return err
 		}
+		err = dbPutUtxoCacheState(dbTx, &prevNode.hash, prevNode.height)
+		if err != nil {
+			return err
+		}
 
 		//Update the balance using the state of the utxo view.
 		//
@@ -843,6 +957,8 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *asiutil.Block, view
 
 	log.Infof("disconnectBlock success: height=%d,round=%d,slot=%d,hash=%s,stateRoot=%s",
 		node.height, node.round.Round, node.slot, node.hash.String(), node.stateRoot.String())
+	b.utxoCache.commit(view, false)
+
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.Commit()
@@ -915,7 +1031,7 @@ func countVtxSpentOutpus(vblock *asiutil.VBlock) int {
 // This function may modify node statuses in the block index without flushing.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error {
+func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) (err error) {
 
 	// Nothing to do if no reorganize nodes were provided.
 	if detachNodes.Len() == 0 && attachNodes.Len() == 0 {
@@ -990,7 +1106,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = fetchInputUtxos(view, b.db, block)
+		err = fetchInputUtxos(view, b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1011,7 +1127,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		detachSpentTxOuts = append(detachSpentTxOuts, stxos)
 		detachVBlocks = append(detachVBlocks, vblock)
 
-		err = disconnectTransactions(view, b.db, block, stxos, vblock)
+		err = disconnectTransactions(view, b.utxoCache, block, stxos, vblock)
 		if err != nil {
 			return err
 		}
@@ -1055,11 +1171,11 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() && vblock != nil {
-			err := fetchInputUtxos(view, b.db, block)
+			err := fetchInputUtxos(view, b.utxoCache, block)
 			if err != nil {
 				return err
 			}
-			err = connectTransactions(view, b.db, block, vblock, nil)
+			err = connectTransactions(view, b.utxoCache, block, vblock, nil)
 			if err != nil {
 				return err
 			}
@@ -1081,10 +1197,11 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
 		var msgvblock protos.MsgVBlock
-		receipts, allLogs, err := b.checkConnectBlock(n, block, view, nil, &msgvblock)
+		receipts, allLogs, err := b.checkConnectBlock(n, block, view, nil, &msgvblock, common.BFNone)
 		if err != nil {
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
+				b.recordInvalidBlock(n, block, err)
 				for de := e.Next(); de != nil; de = de.Next() {
 					dn := de.Value.(*blockNode)
 					b.index.SetStatusFlags(dn, statusInvalidAncestor)
@@ -1108,6 +1225,34 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	// disconnected.
 	view = txo.NewUtxoViewpoint()
 	view.SetBestHash(&b.bestChain.Tip().hash)
+
+	// Record the intent to reorganize to the new best block, so a
+	// reorganize interrupted midway is resumed on start.
+	err = b.putChainIntent(reorgIntentKeyName, &chainIntent{
+		op:       intentReorganize,
+		hash:     newBest.hash,
+		height:   newBest.height,
+		prevHash: oldBest.hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	// A reorganize failing midway is not resumed on start, the chain is
+	// left at the best block reached.
+	defer func() {
+		if err == nil {
+			return
+		}
+		rmErr := b.db.Update(func(dbTx database.Tx) error {
+			return dbRemoveChainIntent(dbTx, reorgIntentKeyName)
+		})
+		if rmErr != nil {
+			log.Warnf("Unable to remove the intent of the failed "+
+				"reorganize to block %v: %v", newBest.hash, rmErr)
+		}
+	}()
+
 	// Disconnect blocks from the main chain.
 	for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
 		n := e.Value.(*blockNode)
@@ -1116,14 +1261,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := fetchInputUtxos(view, b.db, block)
+		err := fetchInputUtxos(view, b.utxoCache, block)
 		if err != nil {
 			return err
 		}
 
 		// Update the view to unspend all of the spent txos and remove
 		// the utxos created by the block.
-		err = disconnectTransactions(view, b.db, block, detachSpentTxOuts[i], vblock)
+		err = disconnectTransactions(view, b.utxoCache, block, detachSpentTxOuts[i], vblock)
 		if err != nil {
 			return err
 		}
@@ -1145,7 +1290,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := fetchInputUtxos(view, b.db, block)
+		err := fetchInputUtxos(view, b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1156,7 +1301,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// details are generated.
 		stxos := make([]txo.SpentTxOut, 0, countSpentOutputs(block) + countVtxSpentOutpus(vblock))
 
-		err = connectTransactions(view, b.db, block, vblock, &stxos)
+		err = connectTransactions(view, b.utxoCache, block, vblock, &stxos)
 		if err != nil {
 			return err
 		}
@@ -1173,6 +1318,13 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		b.updateFees(block)
 	}
 
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbRemoveChainIntent(dbTx, reorgIntentKeyName)
+	})
+	if err != nil {
+		return err
+	}
+
 	// Log the point where the chain forked and old and new best chain
 	// heads.
 	if forkNode != nil {
@@ -1220,6 +1372,7 @@ func (b *BlockChain) updateFees(block *asiutil.Block) {
 // The flags modify the behavior of this function as follows:
 //  - BFFastAdd: Avoids several expensive transaction validation operations.
 //    This is useful when using checkpoints.
+//  - BFAssumeValid: The scripts of the block are not verified.
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) connectBestChain(node *blockNode, block *asiutil.Block, vblock *asiutil.VBlock,
@@ -1264,11 +1417,12 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *asiutil.Block, vbl
 		var err error
 		if !fastAdd {
 			var msgvblock protos.MsgVBlock
-			receipts, logs, err = b.checkConnectBlock(node, block, view, &stxos, &msgvblock)
+			receipts, logs, err = b.checkConnectBlock(node, block, view, &stxos, &msgvblock, flags)
 			if err == nil {
 				b.index.SetStatusFlags(node, statusValid)
 			} else if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(node, statusValidateFailed)
+				b.recordInvalidBlock(node, block, err)
 			} else {
 				return false, err
 			}
@@ -1286,11 +1440,11 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *asiutil.Block, vbl
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := fetchInputUtxos(view, b.db, block)
+			err := fetchInputUtxos(view, b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
-			err = connectTransactions(view, b.db, block, vblock, &stxos)
+			err = connectTransactions(view, b.utxoCache, block, vblock, &stxos)
 			if err != nil {
 				return false, err
 			}
@@ -1325,7 +1479,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *asiutil.Block, vbl
 		return true, nil
 	}
 
-	needReorg := node.weight > b.bestChain.tip().weight
+	needReorg := b.preferChain(node)
 	// We're extending (or creating) a side chain, but the cumulative
 	// work for this new side chain is not enough to make it the new chain.
 	if !needReorg {
@@ -1356,6 +1510,11 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *asiutil.Block, vbl
 	// Reorganize the chain.
 	log.Infof("REORGANIZE: Block %v is causing a reorganize.", node.hash)
 	err := b.reorganizeChain(detachNodes, attachNodes)
+	if _, ok := err.(RuleError); ok {
+		b.checkInvalidChain(node.weight, &node.hash, err)
+	} else if err == nil {
+		b.checkReorgDepth(detachNodes.Len(), node)
+	}
 
 	// Either getReorganizeNodes or reorganizeChain could have made unsaved
 	// changes to the block index, so flush regardless of whether there was an
@@ -1368,6 +1527,19 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *asiutil.Block, vbl
 	return err == nil, err
 }
 
+// StateRent returns the state rent of the block at the passed height, nil
+// when state rent is disabled.
+func (b *BlockChain) StateRent(height int32) *state.StateRent {
+	if !b.chainParams.StateRentActive(height) {
+		return nil
+	}
+	return &state.StateRent{
+		Height: uint64(height),
+		Start:  uint64(b.chainParams.StateRent.Height),
+		Period: uint64(b.chainParams.StateRent.Period),
+	}
+}
+
 // ConnectTransaction updates the view by adding all new utxos created by the
 // passed transaction and marking all utxos that the transactions spend as
 // spent.  In addition, when the 'stxos' argument is not nil, it will be updated
@@ -1378,9 +1550,14 @@ func (b *BlockChain) ConnectTransaction(block *asiutil.Block, txidx int, view *t
 	receipt *types.Receipt, err error, gasUsed uint64, vtx *protos.MsgTx, feeLockItems map[protos.Asset]*txo.LockItem) {
 
 	scriptClass := txscript.NonStandardTy
-	txbaseGas := uint64(tx.MsgTx().SerializeSize() * common.GasPerByte)
+	txbaseGas := txBaseGas(tx.MsgTx())
 	coinbase := IsCoinBase(tx)
 	gas := uint64(tx.MsgTx().TxContract.GasLimit)
+	if !coinbase && gas < txbaseGas {
+		str := fmt.Sprintf("ConnectTransaction: tx %v gas limit %d is less than "+
+			"its base gas %d", tx.Hash(), gas, txbaseGas)
+		return nil, ruleError(ErrBadGasLimit, str), 0, nil, nil
+	}
 	leftOverGas := gas - txbaseGas
 	snapshot := -1
 	executeVMFailed := false
@@ -1388,6 +1565,19 @@ func (b *BlockChain) ConnectTransaction(block *asiutil.Block, txidx int, view *t
 	var callerAddr common.Address
 	var vmtx *virtualtx.VirtualTransaction
 
+	// The storage of the contracts left untouched is archived while state
+	// rent is enabled.
+	stateDB.SetStateRent(b.StateRent(block.Height()))
+
+	// The contract code run by the transaction is charged less gas for the
+	// first access of the accounts and storage slots declared by its access
+	// list, which txBaseGas charged for.
+	if tx.MsgTx().HasAccessList() {
+		stateDB.PrepareAccessList(tx.MsgTx().TxContract.AccessList)
+	} else {
+		stateDB.PrepareAccessList(nil)
+	}
+
 	defer func() {
 		view.AddViewTx(tx.Hash(), tx.MsgTx())
 		gasUsed = gas - leftOverGas
@@ -1509,6 +1699,19 @@ func (b *BlockChain) ConnectTransaction(block *asiutil.Block, txidx int, view *t
 		return
 	}
 
+	// Revive the archived storage witnessed by the transaction.  No error
+	// may be returned once the state is modified, since the state is not
+	// reverted when a transaction fails to connect.
+	if tx.MsgTx().HasStorageWitness() {
+		errt := stateDB.ReviveStorage(tx.MsgTx().TxContract.Witnesses)
+		if errt != nil {
+			str := fmt.Sprintf("transaction %v failed to revive storage: %v",
+				tx.Hash(), errt)
+			err = ruleError(ErrBadStorageWitness, str)
+			return
+		}
+	}
+
 	if scriptClass < txscript.CreateTy || scriptClass > txscript.VoteTy {
 		return
 	}
@@ -1719,7 +1922,13 @@ func (b *BlockChain) connectContract(
 	// in order to retention accuracy, mul 10000 for contract to check
 	gasPrice := fee*10000/int64(tx.MsgTx().TxContract.GasLimit)
 	context := fvm.NewFVMContext(caller, new(big.Int).SetInt64(gasPrice), block, b, view, voteValue)
-	vmenv := vm.NewFVMWithVtx(context, stateDB, chaincfg.ActiveNetParams.FvmParam, *b.GetVmConfig(), vtx)
+	context.TraceSpan = b.txTraceSpan
+	vmConfig := *b.GetVmConfig()
+	if b.txTracer != nil {
+		vmConfig.Debug = true
+		vmConfig.Tracer = b.txTracer
+	}
+	vmenv := vm.NewFVMWithVtx(context, stateDB, chaincfg.ActiveNetParams.FvmParam, vmConfig, vtx)
 	var ret []byte
 	switch contractCode {
 	case txscript.VoteTy:
@@ -2322,6 +2531,18 @@ func (b *BlockChain) MainChainHasBlock(hash *common.Hash) bool {
 	return node != nil && b.bestChain.Contains(node)
 }
 
+// IndexedBlockHeight returns the height of the block with the given hash when
+// it is in the block index, whether on the main chain or on a side chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IndexedBlockHeight(hash *common.Hash) (int32, bool) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return 0, false
+	}
+	return node.height, true
+}
+
 // BlockLocatorFromHash returns a block locator for the passed block hash.
 // See BlockLocator for details on the algorithm used to create a block locator.
 //
@@ -2789,6 +3010,12 @@ type Config struct {
 	// checkpoints.
 	Checkpoints []chaincfg.Checkpoint
 
+	// AssumeValid is the hash of a block assumed valid: the scripts of its
+	// ancestors are not verified.
+	//
+	// This field can be nil to verify the scripts of all the blocks.
+	AssumeValid *common.Hash
+
 	// TimeSource defines the median time source to use for things such as
 	// block processing and determining whether or not the chain is current.
 	//
@@ -2811,6 +3038,15 @@ type Config struct {
 	// signature cache.
 	// HashCache *txscript.HashCache
 
+	// SigCache defines a signature cache to use when validating the
+	// scripts of the blocks.  Sharing it with the mempool saves verifying
+	// the signatures of the transactions it admitted again when they are
+	// included in a block.
+	//
+	// This field can be nil if the caller is not interested in using a
+	// signature cache.
+	SigCache *txscript.SigCache
+
 	// State DB
 	StateDB database.Database
 
@@ -2820,11 +3056,59 @@ type Config struct {
 
 	RoundManager ainterface.IRoundManager
 
+	// Engine decides who may produce the blocks and seals them.  It
+	// defaults to the RoundEngine.
+	Engine ainterface.Engine
+
 	// ContractManager defines a contract manager to use when initializing the
 	// chain and validating system state any time.
 	ContractManager ainterface.ContractManager
 
 	FeesChan chan interface{}
+
+	// ForensicDir is the directory forensic dumps of blocks whose computed
+	// state root or gas usage does not match their header are written to.
+	// No dumps are written when it is empty.
+	ForensicDir string
+
+	// SafeModeReorgDepth is the number of blocks a reorganize must detach
+	// from the best chain to put the chain in safe mode.  Deep reorganizes
+	// do not enter safe mode when it is zero.
+	SafeModeReorgDepth int32
+
+	// PruneTarget is the size, in bytes, the oldest blocks and their spend
+	// journal entries are pruned to.  The blocks are not pruned when it is
+	// zero.
+	PruneTarget uint64
+
+	// PruneDepth is the number of blocks below the best block which are
+	// never pruned, so reorganizes up to that depth can be processed.
+	PruneDepth int32
+
+	// UtxoCacheMaxSize is the size, in bytes, of the cache of unspent
+	// transaction outputs.  The modified outputs are written to the
+	// database with every block when it is zero.
+	UtxoCacheMaxSize uint64
+
+	// PenaltyRules are the penalties applied to the validators whose
+	// equivocations or invalid blocks are seen.
+	PenaltyRules PenaltyRules
+
+	// ReadOnly is set when the databases are opened read-only, as they are
+	// by a read replica.  The chain state is loaded as found: the pending
+	// migrations fail the start, the interrupted operations are neither
+	// rolled back nor resumed and the utxo set is recovered in the cache
+	// only.  No block may be processed.
+	ReadOnly bool
+}
+
+// ErrReadOnly is returned when a block is processed by a chain whose databases
+// are opened read-only.
+var ErrReadOnly = errors.New("the chain is read-only")
+
+// ReadOnly returns whether the databases of the chain are opened read-only.
+func (b *BlockChain) ReadOnly() bool {
+	return b.readOnly
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -2872,10 +3156,13 @@ func New(config *Config, fconfig *chaincfg.FConfig) (*BlockChain, error) {
 	b := BlockChain{
 		checkpoints:         config.Checkpoints,
 		checkpointsByHeight: checkpointsByHeight,
+		assumeValid:         config.AssumeValid,
 		db:                  config.DB,
 		chainParams:         params,
 		timeSource:          config.TimeSource,
 		indexManager:        config.IndexManager,
+		sigCache:            config.SigCache,
+		utxoCache:           newUtxoCache(config.DB, config.UtxoCacheMaxSize),
 		index:               newBlockIndex(config.DB, params),
 		bestChain:           newChainView(nil),
 		orphans:             make(map[common.Hash]*orphanBlock),
@@ -2886,9 +3173,20 @@ func New(config *Config, fconfig *chaincfg.FConfig) (*BlockChain, error) {
 		ethDB:               config.StateDB,
 		templateIndex:       config.TemplateIndex,
 		roundManager:        config.RoundManager,
+		engine:              config.Engine,
 		contractManager:     config.ContractManager,
 		vmConfig:            *vmConfig,
 		feesChan:            config.FeesChan,
+		forensicDir:         config.ForensicDir,
+		safeModeReorgDepth:  config.SafeModeReorgDepth,
+		pruneTarget:         config.PruneTarget,
+		pruneDepth:          config.PruneDepth,
+		penaltyRules:        config.PenaltyRules,
+		slotBlocks:          make(map[penaltySlot]*blockNode),
+		readOnly:            config.ReadOnly,
+	}
+	if b.engine == nil {
+		b.engine = RoundEngine{}
 	}
 
 	if err := b.contractManager.Init(&b, params.GenesisBlock.Transactions[0].TxOut[0].Data); err != nil {
@@ -2898,8 +3196,22 @@ func New(config *Config, fconfig *chaincfg.FConfig) (*BlockChain, error) {
 
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
-	// will be initialized to contain only the genesis block.
-	if err := b.initChainState(int64(config.ChainParams.ChainStartTime)); err != nil {
+	// will be initialized to contain only the genesis block.  The schema of
+	// an existing chain state is upgraded first.
+	chainStartTime := int64(config.ChainParams.ChainStartTime)
+	if err := b.initChainState(chainStartTime, config.Interrupt); err != nil {
+		return nil, err
+	}
+	if err := b.rollbackBlockIntent(); err != nil {
+		return nil, err
+	}
+	if err := b.recoverUtxoSet(); err != nil {
+		return nil, err
+	}
+	if err := b.loadSafeMode(); err != nil {
+		return nil, err
+	}
+	if err := b.loadPenalties(); err != nil {
 		return nil, err
 	}
 
@@ -2920,6 +3232,11 @@ func New(config *Config, fconfig *chaincfg.FConfig) (*BlockChain, error) {
 		return nil, err
 	}
 
+	if err := b.resumeReorganize(); err != nil {
+		return nil, err
+	}
+	bestNode = b.bestChain.Tip()
+
 	log.Infof("Chain state (height %d, hash %v, totaltx %d)",
 		bestNode.height, bestNode.hash, b.stateSnapshot.TotalTxns)
 
@@ -2962,6 +3279,16 @@ func DecodeCreateContractData(data []byte) (uint16, string, []byte, bool) {
 	return category, templateName, constructor, true
 }
 
+// EncodeCreateContractData encodes the data of a contract creation according
+// to the create contract protocol, see DecodeCreateContractData.
+func EncodeCreateContractData(category uint16, templateName string, constructor []byte) []byte {
+	data := make([]byte, 6, 6+len(templateName)+len(constructor))
+	binary.BigEndian.PutUint16(data[0:2], category)
+	binary.BigEndian.PutUint32(data[2:6], uint32(len(templateName)))
+	data = append(data, templateName...)
+	return append(data, constructor...)
+}
+
 // Template protocol is consist of header and content:
 // header=[type] [name length][byte code length][abi length][source length]
 //        2bytes 4bytes       4bytes            4bytes      4bytes
@@ -3041,10 +3368,12 @@ func getVoteValue(view *txo.UtxoViewpoint, tx *asiutil.Tx, voteId *txo.VoteId, a
 }
 
 // Prepare initializes the consensus fields of a block header according to the
-// rules of a particular engine. The changes are executed inline.
+// rules of a particular engine. The changes are executed inline.  It also
+// returns the distribution of the block reward.
 // This method will lock the chain, and it will be released in Commit or Rollback method.
 func (b *BlockChain) Prepare(header *protos.BlockHeader, gasFloor, gasCeil uint64) (
-	stateDB *state.StateDB, feepool map[protos.Asset]int32, contractOut *protos.TxOut, err error) {
+	stateDB *state.StateDB, feepool map[protos.Asset]int32, contractOut *protos.TxOut,
+	split *ainterface.RewardSplit, err error) {
 	b.chainLock.RLock()
 	parent := b.GetTip()
 	if parent.Round() > header.Round || (parent.Round() == header.Round && parent.slot >= header.SlotIndex) {
@@ -3078,6 +3407,10 @@ func (b *BlockChain) Prepare(header *protos.BlockHeader, gasFloor, gasCeil uint6
 	}
 	feepool, err = b.GetAcceptFees(block,
 		stateDB, chaincfg.ActiveNetParams.FvmParam, header.Height)
+	if err != nil {
+		return
+	}
+	split, err = b.calcRewardSplit(parent, stateDB, header.Height, header.Timestamp)
 	return
 }
 
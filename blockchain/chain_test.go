@@ -1041,3 +1041,73 @@ func TestReorganizeChain(t *testing.T) {
 //		log.Infof("receipts = %v, allLogs = %v, feeLockItems = %v", receipts, allLogs, feeLockItems)
 //	}
 //}
+
+// TestReadOnlyChain ensures a read-only chain accepts no block and leaves the
+// utxo cache and the intents of the database as found.
+func TestReadOnlyChain(t *testing.T) {
+	parivateKeyList := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e", //privateKey0
+	}
+	_, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(parivateKeyList, 10)
+	if err != nil || chain == nil {
+		t.Fatalf("createFakeChainByPrivateKeys error %v", err)
+	}
+	defer teardownFunc()
+
+	tip := chain.bestChain.Tip()
+	intent := chainIntent{
+		op:       intentConnect,
+		hash:     common.Hash{0x01},
+		height:   tip.height + 1,
+		prevHash: tip.hash,
+	}
+	if err := chain.putChainIntent(blockIntentKeyName, &intent); err != nil {
+		t.Fatalf("putChainIntent: %v", err)
+	}
+	intent.op = intentReorganize
+	if err := chain.putChainIntent(reorgIntentKeyName, &intent); err != nil {
+		t.Fatalf("putChainIntent: %v", err)
+	}
+	chain.utxoCache.mtx.Lock()
+	chain.utxoCache.put(protos.OutPoint{Index: 1}, nil, true)
+	chain.utxoCache.mtx.Unlock()
+
+	chain.readOnly = true
+	if !chain.ReadOnly() {
+		t.Fatal("chain not read-only")
+	}
+	block := asiutil.NewBlock(netParam.GenesisBlock)
+	if _, _, err := chain.ProcessBlock(block, nil, nil, nil, common.BFNone); err != ErrReadOnly {
+		t.Errorf("ProcessBlock on a read-only chain returned %v, want %v", err, ErrReadOnly)
+	}
+	if err := chain.FlushUtxoCache(); err != nil {
+		t.Errorf("FlushUtxoCache: %v", err)
+	}
+	if chain.utxoCache.dirty != 1 {
+		t.Errorf("%d dirty outputs left after a read-only flush, want 1", chain.utxoCache.dirty)
+	}
+	if err := chain.rollbackBlockIntent(); err != nil {
+		t.Errorf("rollbackBlockIntent: %v", err)
+	}
+	if err := chain.resumeReorganize(); err != nil {
+		t.Errorf("resumeReorganize: %v", err)
+	}
+	err = chain.db.View(func(dbTx database.Tx) error {
+		for _, key := range [][]byte{blockIntentKeyName, reorgIntentKeyName} {
+			intent, err := dbFetchChainIntent(dbTx, key)
+			if err != nil {
+				return err
+			}
+			if intent == nil {
+				t.Errorf("intent %s removed from a read-only chain", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dbFetchChainIntent: %v", err)
+	}
+	if chain.bestChain.Tip() != tip {
+		t.Error("best chain of a read-only chain changed")
+	}
+}
@@ -74,6 +74,10 @@ var (
 	assetsSetBucketName = []byte("assetsSet")
 
 	signatureSetBucketName = []byte("signatureSet")
+
+	// blockArrivalBucketName is the name of the db bucket used to house
+	// the time the blocks were received by the node.
+	blockArrivalBucketName = []byte("blockarrival")
 )
 
 // errNotInMainChain signifies that a block hash or height that is not in the
@@ -1229,6 +1233,12 @@ func (b *BlockChain) createChainState(chainStartTime int64) error {
 			return err
 		}
 
+		// The buckets are created in their latest format.
+		err = dbPutSchemaVersions(dbTx, latestSchemaVersions(migrations))
+		if err != nil {
+			return err
+		}
+
 		err = dbPutBalance(dbTx, view)
 		if err != nil {
 			return err
@@ -1238,6 +1248,10 @@ func (b *BlockChain) createChainState(chainStartTime int64) error {
 		if err != nil {
 			return err
 		}
+		err = dbPutUtxoCacheState(dbTx, &node.hash, node.height)
+		if err != nil {
+			return err
+		}
 
 		// Store the genesis block into the database.
 		return dbStoreBlock(dbTx, genesisBlock)
@@ -1247,8 +1261,9 @@ func (b *BlockChain) createChainState(chainStartTime int64) error {
 
 // initChainState attempts to load and initialize the chain state from the
 // database.  When the db does not yet contain any chain state, both it and the
-// chain state are initialized to the genesis block.
-func (b *BlockChain) initChainState(chainStartTime int64) error {
+// chain state are initialized to the genesis block.  Otherwise the pending
+// migrations of its schema are run before it is loaded.
+func (b *BlockChain) initChainState(chainStartTime int64, interrupt <-chan struct{}) error {
 	// Determine the state of the chain database. We may need to initialize
 	// everything from scratch or upgrade certain buckets.
 	var initialized bool
@@ -1261,11 +1276,19 @@ func (b *BlockChain) initChainState(chainStartTime int64) error {
 	}
 
 	if !initialized {
+		if b.readOnly {
+			return fmt.Errorf("the read-only database holds no chain")
+		}
+
 		// At this point the database has not already been initialized, so
 		// initialize both it and the chain state to the genesis block.
 		return b.createChainState(chainStartTime)
 	}
 
+	if err := runMigrations(b.db, migrations, b.readOnly, interrupt); err != nil {
+		return err
+	}
+
 	// Attempt to load the chain state from the database.
 	err = b.db.View(func(dbTx database.Tx) error {
 		// Fetch the stored chain state from the database metadata.
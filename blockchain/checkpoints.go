@@ -44,6 +44,31 @@ func (b *BlockChain) LatestCheckpoint() *chaincfg.Checkpoint {
 	return &b.checkpoints[len(b.checkpoints)-1]
 }
 
+// AssumeValid returns the hash of the block assumed valid, whose ancestors'
+// scripts are not verified, or nil when the scripts of all the blocks are.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AssumeValid() *common.Hash {
+	return b.assumeValid
+}
+
+// isAssumedValid returns whether the passed block node is an ancestor of the
+// block assumed valid, either as asserted by the caller with the
+// BFAssumeValid flag or because the block assumed valid is known and descends
+// from it.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode, flags common.BehaviorFlags) bool {
+	if b.assumeValid == nil {
+		return false
+	}
+	if flags&common.BFAssumeValid == common.BFAssumeValid {
+		return true
+	}
+	assumed := b.index.LookupNode(b.assumeValid)
+	return assumed != nil && assumed.Ancestor(node.height) == node
+}
+
 // verifyCheckpoint returns whether the passed block height and hash combination
 // match the checkpoint data.  It also returns true if there is no checkpoint
 // data for the passed block height.
@@ -0,0 +1,55 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestIsAssumedValid ensures only the ancestors of the block assumed valid
+// skip their scripts, whether the block is known or asserted by the caller.
+func TestIsAssumedValid(t *testing.T) {
+	branch0 := chainedNodes(nil, 5, 0)
+	branch1 := chainedNodes(branch0[1], 3, 1)
+	index := newBlockIndex(nil, &chaincfg.DevelopNetParams)
+	for _, node := range append(branch0, branch1...) {
+		index.AddNode(node)
+	}
+	unknown := chainedNodes(branch0[4], 1, 2)[0]
+
+	b := &BlockChain{index: index}
+	if b.isAssumedValid(branch0[0], common.BFAssumeValid) {
+		t.Fatalf("block assumed valid without an assumevalid block")
+	}
+
+	b.assumeValid = &branch0[3].hash
+	tests := []struct {
+		name  string
+		node  *blockNode
+		flags common.BehaviorFlags
+		want  bool
+	}{
+		{"ancestor", branch0[2], common.BFNone, true},
+		{"assumed block", branch0[3], common.BFNone, true},
+		{"descendant", branch0[4], common.BFNone, false},
+		{"common ancestor of a side chain", branch0[1], common.BFNone, true},
+		{"side chain", branch1[1], common.BFNone, false},
+		{"asserted by the caller", unknown, common.BFAssumeValid, true},
+	}
+	for _, test := range tests {
+		if got := b.isAssumedValid(test.node, test.flags); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// The ancestors of an unknown block assumed valid run their scripts.
+	b.assumeValid = &unknown.hash
+	if b.isAssumedValid(branch0[2], common.BFNone) {
+		t.Errorf("ancestor of an unknown block assumed valid")
+	}
+}
@@ -80,6 +80,11 @@ func (m *ManagerTmp) Init(chain fvm.ChainContext, dataBytes [] byte) error {
 	return nil
 }
 
+// GetContractVersions returns all the versions of a system contract.
+func (m *ManagerTmp) GetContractVersions(delegateAddr common.ContractCode) []chaincfg.ContractInfo {
+	return m.genesisDataCache[delegateAddr]
+}
+
 // Get latest contract by height.
 func (m *ManagerTmp) GetActiveContractByHeight(height int32, delegateAddr common.ContractCode) *chaincfg.ContractInfo {
 	contracts, ok := m.genesisDataCache[delegateAddr]
@@ -407,6 +412,13 @@ func (m *ManagerTmp) GetTemplate(
 }
 
 
+func (m *ManagerTmp) GetRewardSplit(
+	block *asiutil.Block,
+	stateDB vm.StateDB,
+	chainConfig *params.ChainConfig) (*ainterface.RewardSplit, bool, error) {
+	return nil, false, nil
+}
+
 func (m *ManagerTmp) GetFees(
 	block *asiutil.Block,
 	stateDB vm.StateDB,
@@ -1028,7 +1040,6 @@ func newFakeChain(paramstmp *chaincfg.Params) (*BlockChain, func(), error) {
 		WSModules:            chaincfg.DefaultWSModules,
 		DevelopNet:           true,
 		Consensustype:        "poa",
-		MaxTimeOffset:        30,
 	}
 
 	consensus := common.GetConsensus(cfg.Consensustype)
@@ -1761,7 +1772,7 @@ func (b *BlockChain) calcGasUsed(node *blockNode, block *asiutil.Block, view *tx
 
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err := fetchInputUtxos(view, b.db, block)
+	err := fetchInputUtxos(view, b.utxoCache, block)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -0,0 +1,57 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// RoundEngine is the consensus engine of the round based consensuses, solo,
+// poa and satoshiplus: each slot of a round belongs to a validator, which
+// signs the blocks it produces with its key.  It is the engine of the chains
+// configured without one.
+type RoundEngine struct{}
+
+// Prepare ensures the coinbase of the header is the validator of its slot.
+// It is part of the ainterface.Engine interface.
+func (RoundEngine) Prepare(header *protos.BlockHeader, validators []*common.Address) error {
+	if int(header.SlotIndex) >= len(validators) ||
+		*validators[header.SlotIndex] != header.CoinBase {
+		str := fmt.Sprintf("miner invalid: height=%d, round=%d, slot=%d, miner=%v",
+			header.Height, header.Round, header.SlotIndex, header.CoinBase.String())
+		return ruleError(ErrValidatorMismatch, str)
+	}
+	return nil
+}
+
+// Finalize does nothing as the round based consensuses have no consensus data
+// in the blocks.  It is part of the ainterface.Engine interface.
+func (RoundEngine) Finalize(block *protos.MsgBlock) error {
+	return nil
+}
+
+// Seal signs the hash of the header by the account.  It is part of the
+// ainterface.Engine interface.
+func (RoundEngine) Seal(header *protos.BlockHeader, account *crypto.Account) error {
+	blockHash := header.BlockHash()
+	signature, err := crypto.Sign(blockHash[:], (*ecdsa.PrivateKey)(&account.PrivateKey))
+	if err != nil {
+		return err
+	}
+	copy(header.SigData[:], signature)
+	return nil
+}
+
+// VerifySeal ensures the header is signed by its coinbase.  It is part of the
+// ainterface.Engine interface.
+func (RoundEngine) VerifySeal(header *protos.BlockHeader) error {
+	blockHash := header.BlockHash()
+	return AddressVerifySignature(blockHash[:], &header.CoinBase, header.SigData[:])
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// TestRoundEngine ensures the round engine only accepts the validator of the
+// slot of a header, and verifies the seals it makes.
+func TestRoundEngine(t *testing.T) {
+	acc, err := crypto.NewAccount("0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e")
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	other := common.Address{0x66, 0x01}
+	header := &protos.BlockHeader{
+		Height:    1,
+		Round:     1,
+		SlotIndex: 1,
+		CoinBase:  *acc.Address,
+	}
+	engine := RoundEngine{}
+
+	err = engine.Prepare(header, []*common.Address{acc.Address, &other})
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrValidatorMismatch {
+		t.Fatalf("Prepare: got error %v, want %v", err, ErrValidatorMismatch)
+	}
+	err = engine.Prepare(header, []*common.Address{acc.Address})
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrValidatorMismatch {
+		t.Fatalf("Prepare out of range: got error %v, want %v", err, ErrValidatorMismatch)
+	}
+	if err := engine.Prepare(header, []*common.Address{&other, acc.Address}); err != nil {
+		t.Fatalf("Prepare: unexpected error %v", err)
+	}
+
+	if err := engine.Seal(header, acc); err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if err := engine.VerifySeal(header); err != nil {
+		t.Fatalf("VerifySeal: unexpected error %v", err)
+	}
+	header.CoinBase = other
+	if err := engine.VerifySeal(header); err == nil {
+		t.Fatal("VerifySeal: expected an error for a seal of another producer")
+	}
+}
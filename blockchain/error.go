@@ -284,6 +284,27 @@ const (
 
 	// ErrFailedSerializedBlock indicates failed to get serialized bytes for block
 	ErrFailedSerializedBlock
+
+	// ErrBadAccessList indicates the access list of a transaction declares
+	// an account or a storage slot twice, or is carried by a coinbase.
+	ErrBadAccessList
+
+	// ErrAccessListInactive indicates a transaction carries an access list
+	// before the activation of access lists.
+	ErrAccessListInactive
+
+	// ErrBadStorageWitness indicates the storage witnesses of a transaction
+	// witness a contract or a storage slot twice, carry an empty slot, are
+	// carried by a coinbase, or do not match the archived storage.
+	ErrBadStorageWitness
+
+	// ErrStateRentInactive indicates a transaction carries storage
+	// witnesses while state rent is not enabled.
+	ErrStateRentInactive
+
+	// ErrPenalizedValidator indicates a block was produced by a validator
+	// whose penalty rejects its blocks.
+	ErrPenalizedValidator
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -360,6 +381,11 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrStxoMismatch:         "ErrStxoMismatch",
 	ErrNotInMainChain:       "ErrNotInMainChain",
 	ErrFailedSerializedBlock: "ErrFailedSerializedBlock",
+	ErrBadAccessList:         "ErrBadAccessList",
+	ErrAccessListInactive:    "ErrAccessListInactive",
+	ErrBadStorageWitness:     "ErrBadStorageWitness",
+	ErrStateRentInactive:     "ErrStateRentInactive",
+	ErrPenalizedValidator:    "ErrPenalizedValidator",
 }
 
 // String returns the ErrorCode as a human-readable name.
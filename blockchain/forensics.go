@@ -0,0 +1,269 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/vm"
+)
+
+const (
+	// forensicDumpExt is the file extension of the forensic dumps.
+	forensicDumpExt = ".json"
+
+	// forensicTraceLimit is the maximum number of steps traced per
+	// transaction, which bounds the size of a dump.
+	forensicTraceLimit = 100000
+)
+
+// ForensicAccount is the state of an account accessed by a block before the
+// block was connected.
+type ForensicAccount struct {
+	Address  string            `json:"address"`
+	Exists   bool              `json:"exists"`
+	Balance  string            `json:"balance"`
+	Nonce    uint64            `json:"nonce"`
+	CodeHash string            `json:"codehash"`
+	Storage  map[string]string `json:"storage,omitempty"`
+}
+
+// ForensicTxTrace is the execution trace of a transaction of a block which
+// failed to connect, re-executed on the state of the parent of the block.
+type ForensicTxTrace struct {
+	TxHash     string         `json:"txhash"`
+	GasUsed    uint64         `json:"gasused"`
+	Failed     bool           `json:"failed"`
+	Error      string         `json:"error,omitempty"`
+	StructLogs []vm.StructLog `json:"structlogs"`
+}
+
+// ForensicDump holds everything needed to analyze a block which failed to
+// connect because the computed state did not match its header.
+type ForensicDump struct {
+	BlockHash         string            `json:"blockhash"`
+	Height            int32             `json:"height"`
+	Time              int64             `json:"time"`
+	Reason            string            `json:"reason"`
+	ParentStateRoot   string            `json:"parentstateroot"`
+	ExpectedStateRoot string            `json:"expectedstateroot"`
+	ComputedStateRoot string            `json:"computedstateroot"`
+	ExpectedGasUsed   uint64            `json:"expectedgasused"`
+	ComputedGasUsed   uint64            `json:"computedgasused"`
+	Block             string            `json:"block"`
+	PreState          []ForensicAccount `json:"prestate"`
+	Receipts          types.Receipts    `json:"receipts"`
+	Trace             []ForensicTxTrace `json:"trace"`
+	TraceError        string            `json:"traceerror,omitempty"`
+}
+
+// traceBlock executes the transactions of the block again on the state of its
+// parent, with a struct logger tracing their contract executions, and returns
+// the trace of each transaction executed until the first error.  The state of
+// the chain is left untouched.  The utxos spent by the block are read from the
+// utxo set, so the block can only be traced while its parent is the best
+// block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) traceBlock(node *blockNode, block *asiutil.Block) ([]ForensicTxTrace, error) {
+	if node.parent != b.bestChain.Tip() {
+		return nil, errors.New("the parent of the block is not the best block")
+	}
+	statedb, err := state.New(node.parent.stateRoot, b.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	view := txo.NewUtxoViewpoint()
+	view.SetBestHash(&node.parent.hash)
+	if err := fetchInputUtxos(view, b.utxoCache, block); err != nil {
+		return nil, err
+	}
+
+	var stxos []txo.SpentTxOut
+	traces := make([]ForensicTxTrace, 0, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		fee, _, err := CheckTransactionInputs(tx, node.height, view, b)
+		if err != nil {
+			return traces, err
+		}
+		tracer := vm.NewStructLogger(&vm.LogConfig{
+			DisableMemory: true,
+			Limit:         forensicTraceLimit,
+		})
+		statedb.Prepare(*tx.Hash(), *block.Hash(), i)
+		b.txTracer = tracer
+		receipt, err, gasUsed, _, _ := b.ConnectTransaction(block, i, view,
+			tx, &stxos, statedb, fee)
+		b.txTracer = nil
+		if err != nil {
+			return traces, err
+		}
+		trace := ForensicTxTrace{
+			TxHash:     tx.Hash().String(),
+			GasUsed:    gasUsed,
+			Failed:     receipt != nil && receipt.Status == types.ReceiptStatusFailed,
+			StructLogs: tracer.StructLogs(),
+		}
+		if err := tracer.Error(); err != nil {
+			trace.Error = err.Error()
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// dumpForensics writes a forensic dump of a block whose execution resulted in
+// a state diverging from its header.  The pre-state of every account and
+// storage slot accessed by the block is read from the state of the parent, and
+// the block is executed again to trace its transactions.  Failures are only
+// logged since the block is rejected anyway.
+func (b *BlockChain) dumpForensics(node *blockNode, block *asiutil.Block,
+	statedb *state.StateDB, receipts types.Receipts, computedRoot common.Hash,
+	computedGas uint64, reason error) {
+
+	if b.forensicDir == "" {
+		return
+	}
+
+	header := &block.MsgBlock().Header
+	dump := &ForensicDump{
+		BlockHash:         node.hash.UnprefixString(),
+		Height:            node.height,
+		Time:              time.Now().Unix(),
+		Reason:            reason.Error(),
+		ParentStateRoot:   node.parent.stateRoot.UnprefixString(),
+		ExpectedStateRoot: header.StateRoot.UnprefixString(),
+		ComputedStateRoot: computedRoot.UnprefixString(),
+		ExpectedGasUsed:   header.GasUsed,
+		ComputedGasUsed:   computedGas,
+		Receipts:          receipts,
+	}
+	if raw, err := block.Bytes(); err == nil {
+		dump.Block = hex.EncodeToString(raw)
+	}
+
+	preState, err := state.New(node.parent.stateRoot, b.stateCache)
+	if err != nil {
+		log.Errorf("Unable to open the parent state of block %v for the "+
+			"forensic dump: %v", node.hash, err)
+	} else {
+		for addr, slots := range statedb.AccessList() {
+			account := ForensicAccount{
+				Address:  addr.String(),
+				Exists:   preState.Exist(addr),
+				Balance:  preState.GetBalance(addr).String(),
+				Nonce:    preState.GetNonce(addr),
+				CodeHash: preState.GetCodeHash(addr).UnprefixString(),
+			}
+			if len(slots) > 0 {
+				account.Storage = make(map[string]string, len(slots))
+				for _, slot := range slots {
+					value := preState.GetState(addr, slot)
+					account.Storage[slot.UnprefixString()] = value.UnprefixString()
+				}
+			}
+			dump.PreState = append(dump.PreState, account)
+		}
+		sort.Slice(dump.PreState, func(i, j int) bool {
+			return dump.PreState[i].Address < dump.PreState[j].Address
+		})
+	}
+
+	dump.Trace, err = b.traceBlock(node, block)
+	if err != nil {
+		log.Warnf("Unable to trace block %v for the forensic dump: %v",
+			node.hash, err)
+		dump.TraceError = err.Error()
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		log.Errorf("Unable to encode the forensic dump of block %v: %v",
+			node.hash, err)
+		return
+	}
+	if err := os.MkdirAll(b.forensicDir, 0700); err != nil {
+		log.Errorf("Unable to create forensic directory: %v", err)
+		return
+	}
+	path := filepath.Join(b.forensicDir, dump.BlockHash+forensicDumpExt)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		log.Errorf("Unable to write forensic dump: %v", err)
+		return
+	}
+	log.Warnf("Block %v diverged from the computed state, forensic dump "+
+		"written to %s", node.hash, path)
+}
+
+// ForensicDumps returns the forensic dumps written so far, ordered by block
+// height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ForensicDumps() ([]*ForensicDump, error) {
+	if b.forensicDir == "" {
+		return nil, nil
+	}
+	files, err := ioutil.ReadDir(b.forensicDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dumps []*ForensicDump
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, forensicDumpExt) {
+			continue
+		}
+		dump, err := b.readForensicDump(filepath.Join(b.forensicDir, name))
+		if err != nil {
+			log.Warnf("Skipping unreadable forensic dump %s: %v", name, err)
+			continue
+		}
+		dumps = append(dumps, dump)
+	}
+	sort.Slice(dumps, func(i, j int) bool {
+		return dumps[i].Height < dumps[j].Height
+	})
+	return dumps, nil
+}
+
+// ForensicDump returns the forensic dump of the block with the passed hash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ForensicDump(hash *common.Hash) (*ForensicDump, error) {
+	if b.forensicDir == "" {
+		return nil, os.ErrNotExist
+	}
+	path := filepath.Join(b.forensicDir, hash.UnprefixString()+forensicDumpExt)
+	return b.readForensicDump(path)
+}
+
+// readForensicDump decodes the forensic dump stored in the passed file.
+func (b *BlockChain) readForensicDump(path string) (*ForensicDump, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dump ForensicDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, err
+	}
+	return &dump, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database/dbimpl/ethdb"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+)
+
+// TestForensicDump ensures forensic dumps record the pre-state of the accessed
+// accounts and can be read back.
+func TestForensicDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forensics")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateCache := state.NewDatabase(ethdb.NewMemDatabase())
+	chain := &BlockChain{
+		forensicDir: dir,
+		stateCache:  stateCache,
+		bestChain:   newChainView(nil),
+	}
+
+	statedb, err := state.New(common.Hash{}, stateCache)
+	if err != nil {
+		t.Fatalf("state.New: %v", err)
+	}
+	addr := common.HexToAddress("0x660000000000000000000000000000000000000001")
+	statedb.AddBalance(addr, big.NewInt(100))
+
+	block := asiutil.NewBlock(&protos.MsgBlock{})
+	node := &blockNode{
+		hash:   *block.Hash(),
+		height: 10,
+		parent: &blockNode{},
+	}
+	chain.dumpForensics(node, block, statedb, nil, common.Hash{1}, 5,
+		errors.New("state root mismatch"))
+
+	dump, err := chain.ForensicDump(block.Hash())
+	if err != nil {
+		t.Fatalf("ForensicDump: %v", err)
+	}
+	if dump.Height != 10 || dump.ComputedGasUsed != 5 ||
+		dump.Reason != "state root mismatch" || dump.Block == "" {
+		t.Errorf("unexpected dump %+v", dump)
+	}
+	if len(dump.PreState) != 1 || dump.PreState[0].Exists ||
+		dump.PreState[0].Balance != "0" {
+		t.Errorf("unexpected pre-state %+v", dump.PreState)
+	}
+
+	// The parent of the block is not the best block, so the block is not
+	// traced.
+	if dump.TraceError == "" || len(dump.Trace) != 0 {
+		t.Errorf("unexpected trace %+v, error %q", dump.Trace, dump.TraceError)
+	}
+
+	dumps, err := chain.ForensicDumps()
+	if err != nil || len(dumps) != 1 {
+		t.Fatalf("ForensicDumps: got %d dumps, err %v", len(dumps), err)
+	}
+}
+
+// TestForensicTrace ensures the transactions of a block are executed again on
+// the state of its parent and traced without changing the chain.
+func TestForensicTrace(t *testing.T) {
+	privateKeys := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e",
+	}
+	accList, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(privateKeys, 10)
+	if err != nil || chain == nil {
+		t.Fatalf("createFakeChainByPrivateKeys: %v", err)
+	}
+	defer teardownFunc()
+
+	validators, filters, _ := chain.GetValidatorsByNode(1, chain.bestChain.tip())
+	var block *asiutil.Block
+	var node *blockNode
+	for i := 0; i < 6; i++ {
+		var txs []*asiutil.Tx
+		if i == 5 {
+			tx, err := chain.createSignUpTx(privateKeys[0], protos.Asset{})
+			if err != nil {
+				t.Fatalf("createSignUpTx: %v", err)
+			}
+			txs = append(txs, tx)
+		}
+		block, node, err = createAndSignBlock(netParam, accList, validators,
+			filters, chain, 1, uint16(i), int32(i), protos.Asset{}, 0,
+			validators[i], txs, 0, chain.GetTip())
+		if err != nil {
+			t.Fatalf("createAndSignBlock: %v", err)
+		}
+		if i == 5 {
+			break
+		}
+		if _, _, err := chain.ProcessBlock(block, nil, nil, nil, 0); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+
+	best := chain.BestSnapshot()
+	traces, err := chain.traceBlock(node, block)
+	if err != nil {
+		t.Fatalf("traceBlock: %v", err)
+	}
+	if len(traces) != len(block.Transactions()) {
+		t.Fatalf("got %d traces, want %d", len(traces),
+			len(block.Transactions()))
+	}
+	for i, tx := range block.Transactions() {
+		if traces[i].TxHash != tx.Hash().String() {
+			t.Errorf("trace %d of tx %s, want %s", i, traces[i].TxHash,
+				tx.Hash())
+		}
+	}
+	// The sign up transaction calls the consensus contract.
+	if len(traces[0].StructLogs) == 0 {
+		t.Errorf("contract call of the sign up transaction not traced")
+	}
+	if chain.BestSnapshot().Hash != best.Hash {
+		t.Errorf("best block changed by the trace")
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// CheckBlockHeader validates a block header against its parent, which must be
+// known and not invalid, without its block.  It performs the header checks of
+// ProcessBlock, including the slot, round and timestamp rules and the
+// checkpoints.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckBlockHeader(header *protos.BlockHeader) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(&header.PrevBlock)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %s is unknown", header.PrevBlock)
+		return ruleError(ErrPreviousBlockUnknown, str)
+	}
+	if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %s is known to be invalid",
+			header.PrevBlock)
+		return ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	if err := checkBlockHeaderSanity(header, prevNode); err != nil {
+		return err
+	}
+
+	var err error
+	round := prevNode.round
+	for round.Round < header.Round {
+		round, err = b.roundManager.GetNextRound(round)
+		if err != nil {
+			return err
+		}
+	}
+	return b.checkBlockHeaderContext(header, prevNode, round)
+}
+
+// PreciousBlock makes the chain ending with the block of the passed hash the
+// best chain when it has the same weight as the current best chain.  A block
+// only replaces the best chain when its chain has more weight otherwise, so
+// this lets operators settle a tie between competing blocks explicitly.  It
+// does nothing when the block is already on the best chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PreciousBlock(hash *common.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is unknown", hash)
+	}
+	if b.bestChain.Contains(node) {
+		return nil
+	}
+
+	status := b.index.NodeStatus(node)
+	switch {
+	case status.KnownInvalid():
+		return fmt.Errorf("block %s is known to be invalid", hash)
+	case !status.HaveData():
+		return fmt.Errorf("block %s data is not available", hash)
+	case node.weight < b.bestChain.Tip().weight:
+		return fmt.Errorf("block %s has a chain weight of %d, less than "+
+			"%d of the best chain", hash, node.weight,
+			b.bestChain.Tip().weight)
+	}
+
+	detachNodes, attachNodes := b.getReorganizeNodes(node)
+	log.Infof("REORGANIZE: Block %v is precious.", node.hash)
+	err := b.reorganizeChain(detachNodes, attachNodes)
+
+	// The block index may have been modified even when the reorganize
+	// failed, so flush it regardless.
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+	return err
+}
+
+// InvalidateBlock marks the block of the passed hash as invalid along with
+// all its descendants, as if it had failed validation.  The best chain is
+// reorganized to the valid block of the most weight when the block is on it.
+// ReconsiderBlock reverses it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *common.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is unknown", hash)
+	}
+	if node.parent == nil {
+		return fmt.Errorf("genesis block %s cannot be invalidated", hash)
+	}
+
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	for _, n := range b.descendants(node) {
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+
+	var err error
+	if b.bestChain.Contains(node) {
+		log.Infof("REORGANIZE: Block %v is invalidated.", node.hash)
+		err = b.reorganizeToBestValid(node.parent)
+	}
+
+	// The block index was modified even when the reorganize failed, so
+	// flush it regardless.
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+	return err
+}
+
+// ReconsiderBlock clears the invalid status of the block of the passed hash,
+// of its descendants and of its ancestors, reversing InvalidateBlock or a
+// failed validation.  The best chain is then reorganized to the valid block
+// of the most weight.  The blocks which really break the rules are marked as
+// invalid again when the reorganize validates them.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *common.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is unknown", hash)
+	}
+
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	for n := node; n != nil; n = n.parent {
+		if b.index.NodeStatus(n)&invalidFlags != 0 {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+	for _, n := range b.descendants(node) {
+		if b.index.NodeStatus(n)&invalidFlags != 0 {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+
+	err := b.reorganizeToBestValid(b.bestChain.Tip())
+
+	// The block index was modified even when the reorganize failed, so
+	// flush it regardless.
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+	return err
+}
+
+// descendants returns the nodes of the block index descending from the
+// passed node, in no particular order.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) descendants(node *blockNode) []*blockNode {
+	var nodes []*blockNode
+	b.index.RLock()
+	for _, n := range b.index.index {
+		if n.height > node.height && n.Ancestor(node.height) == node {
+			nodes = append(nodes, n)
+		}
+	}
+	b.index.RUnlock()
+	return nodes
+}
+
+// bestValidTip returns the block of the most weight which has its data and is
+// not known to be invalid, leaving out the tried blocks.  The passed fallback
+// is returned when no block has more weight.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) bestValidTip(fallback *blockNode,
+	tried map[*blockNode]struct{}) *blockNode {
+
+	best := fallback
+	b.index.RLock()
+	for _, n := range b.index.index {
+		if n.weight <= best.weight || !n.status.HaveData() ||
+			n.status.KnownInvalid() {
+			continue
+		}
+		if _, ok := tried[n]; ok {
+			continue
+		}
+		best = n
+	}
+	b.index.RUnlock()
+	return best
+}
+
+// reorganizeToBestValid reorganizes the best chain to the valid block of the
+// most weight, or to the passed fallback block when none has more weight.
+// The blocks failing validation are marked as invalid and the next best
+// block is tried, so the fallback block must be valid.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reorganizeToBestValid(fallback *blockNode) error {
+	tried := make(map[*blockNode]struct{})
+	for {
+		target := b.bestValidTip(fallback, tried)
+		tried[target] = struct{}{}
+
+		detachNodes, attachNodes := b.getReorganizeNodes(target)
+		err := b.reorganizeChain(detachNodes, attachNodes)
+		if err == nil && b.bestChain.Tip() == target {
+			return nil
+		}
+		if _, ok := err.(RuleError); (err != nil && !ok) || target == fallback {
+			if err == nil {
+				err = fmt.Errorf("unable to reorganize to block %s",
+					target.hash)
+			}
+			return err
+		}
+		if err != nil {
+			log.Warnf("Unable to reorganize to block %v: %v",
+				target.hash, err)
+		}
+	}
+}
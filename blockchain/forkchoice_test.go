@@ -0,0 +1,121 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestPreciousBlock ensures blocks which cannot replace the best chain are
+// refused by PreciousBlock.
+func TestPreciousBlock(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> 3
+	// 	            \-> 2a
+	chain, teardownFunc, err := newFakeChain(&chaincfg.DevelopNetParams)
+	if err != nil || chain == nil {
+		t.Fatalf("newFakeChain error %v", err)
+	}
+	defer teardownFunc()
+
+	mainNodes := chainedNodes(chain.bestChain.Genesis(), 3, 0)
+	sideNodes := chainedNodes(mainNodes[0], 1, 1)
+	for i, node := range mainNodes {
+		node.weight = uint64(i + 1)
+		chain.index.AddNode(node)
+	}
+	sideNode := sideNodes[0]
+	sideNode.weight = 2
+	chain.index.AddNode(sideNode)
+	chain.bestChain.SetTip(tstTip(mainNodes))
+
+	if err := chain.PreciousBlock(&common.Hash{0x01}); err == nil {
+		t.Error("unknown block accepted")
+	}
+	if err := chain.PreciousBlock(&mainNodes[1].hash); err != nil {
+		t.Errorf("block of the best chain refused: %v", err)
+	}
+	if err := chain.PreciousBlock(&sideNode.hash); err == nil {
+		t.Error("block without data accepted")
+	}
+	chain.index.SetStatusFlags(sideNode, statusDataStored)
+	if err := chain.PreciousBlock(&sideNode.hash); err == nil {
+		t.Error("block with less weight than the best chain accepted")
+	}
+	chain.index.SetStatusFlags(sideNode, statusValidateFailed)
+	if err := chain.PreciousBlock(&sideNode.hash); err == nil {
+		t.Error("invalid block accepted")
+	}
+	if chain.bestChain.Tip() != tstTip(mainNodes) {
+		t.Error("best chain changed")
+	}
+}
+
+// TestInvalidateReconsiderBlock ensures InvalidateBlock marks a block and its
+// descendants as invalid and ReconsiderBlock reverses it.
+func TestInvalidateReconsiderBlock(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> 3
+	// 	            \-> 2a -> 3a
+	chain, teardownFunc, err := newFakeChain(&chaincfg.DevelopNetParams)
+	if err != nil || chain == nil {
+		t.Fatalf("newFakeChain error %v", err)
+	}
+	defer teardownFunc()
+
+	mainNodes := chainedNodes(chain.bestChain.Genesis(), 3, 0)
+	sideNodes := chainedNodes(mainNodes[0], 2, 1)
+	for i, node := range mainNodes {
+		node.weight = uint64(i + 1)
+		chain.index.AddNode(node)
+	}
+	for i, node := range sideNodes {
+		node.weight = uint64(i + 2)
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tstTip(mainNodes))
+
+	if err := chain.InvalidateBlock(&common.Hash{0x01}); err == nil {
+		t.Error("unknown block invalidated")
+	}
+	if err := chain.InvalidateBlock(&chain.bestChain.Genesis().hash); err == nil {
+		t.Error("genesis block invalidated")
+	}
+
+	if err := chain.InvalidateBlock(&sideNodes[0].hash); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	if status := chain.index.NodeStatus(sideNodes[0]); status&statusValidateFailed == 0 {
+		t.Errorf("invalidated block status %v", status)
+	}
+	if status := chain.index.NodeStatus(sideNodes[1]); status&statusInvalidAncestor == 0 {
+		t.Errorf("descendant block status %v", status)
+	}
+	for i, node := range mainNodes {
+		if chain.index.NodeStatus(node).KnownInvalid() {
+			t.Errorf("block %d of the best chain invalidated", i+1)
+		}
+	}
+	if chain.bestChain.Tip() != tstTip(mainNodes) {
+		t.Error("best chain changed")
+	}
+
+	if err := chain.ReconsiderBlock(&sideNodes[1].hash); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	for i, node := range sideNodes {
+		if chain.index.NodeStatus(node).KnownInvalid() {
+			t.Errorf("reconsidered block %d still invalid", i)
+		}
+	}
+	if chain.bestChain.Tip() != tstTip(mainNodes) {
+		t.Error("best chain changed")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/txscript"
@@ -310,6 +311,20 @@ func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, n
 	return results, numToSkip, nil
 }
 
+// dbCountAddrIndexEntries returns the number of transactions referenced by the
+// given address key.
+func dbCountAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte) uint32 {
+	var numEntries uint32
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			return numEntries
+		}
+		numEntries += uint32(len(levelData) / txEntrySize)
+	}
+}
+
 // minEntriesToReachLevel returns the minimum number of entries that are
 // required to reach the given address index level.
 func minEntriesToReachLevel(level uint8) int {
@@ -613,20 +628,47 @@ func (idx *AddrIndex) indexPkScript(data writeIndexData, pkScript []byte, txIdx
 	}
 
 	for _, addr := range addrs {
-		addrKey := addr.StandardAddress()
-
-		// Avoid inserting the transaction more than once.  Since the
-		// transactions are indexed serially any duplicates will be
-		// indexed in a row, so checking the most recent entry for the
-		// address is enough to detect duplicates.
-		indexedTxns := data[addrKey]
-		numTxns := len(indexedTxns)
-		if numTxns > 0 && indexedTxns[numTxns-1] == txIdx {
-			continue
-		}
-		indexedTxns = append(indexedTxns, txIdx)
-		data[addrKey] = indexedTxns
+		indexAddress(data, addr.StandardAddress(), txIdx)
+	}
+}
+
+// indexAddress maps the passed address to the associated transaction using
+// the passed map.
+func indexAddress(data writeIndexData, addrKey [addrKeySize]byte, txIdx int) {
+	// Avoid inserting the transaction more than once.  Since the
+	// transactions are indexed serially any duplicates will be
+	// indexed in a row, so checking the most recent entry for the
+	// address is enough to detect duplicates.
+	indexedTxns := data[addrKey]
+	numTxns := len(indexedTxns)
+	if numTxns > 0 && indexedTxns[numTxns-1] == txIdx {
+		return
 	}
+	indexedTxns = append(indexedTxns, txIdx)
+	data[addrKey] = indexedTxns
+}
+
+// createdContract returns the address of the contract created by the passed
+// transaction, given the public key script of the output spent by its first
+// input.  The output of a contract creation does not hold the address of the
+// contract, which is derived from its caller and inputs the same way the
+// chain does when it connects the transaction.
+func createdContract(tx *asiutil.Tx, callerPkScript []byte) (common.Address, bool) {
+	msgTx := tx.MsgTx()
+	if len(msgTx.TxIn) == 0 || len(msgTx.TxOut) == 0 ||
+		txscript.GetScriptClass(msgTx.TxOut[0].PkScript) != txscript.CreateTy {
+		return common.Address{}, false
+	}
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(callerPkScript)
+	if err != nil || len(addrs) == 0 {
+		return common.Address{}, false
+	}
+	caller := addrs[0].StandardAddress()
+	contractAddr, err := crypto.CreateContractAddress(caller[:], []byte{}, tx.GetInputHash())
+	if err != nil {
+		return common.Address{}, false
+	}
+	return contractAddr, true
 }
 
 // indexBlock extract all of the standard addresses from all of the transactions
@@ -646,6 +688,14 @@ func (idx *AddrIndex) indexBlock(data writeIndexData, block *asiutil.Block,
 		// already been proven on the first transaction in the block is
 		// a coinbase.
 		if txIdx < coinbaseIdx {
+			// Index the contracts created by the transaction under
+			// their address, which does not appear in its outputs.
+			if len(tx.MsgTx().TxIn) > 0 {
+				contractAddr, ok := createdContract(tx, stxos[stxoIndex].PkScript)
+				if ok {
+					indexAddress(data, contractAddr, txIdx)
+				}
+			}
 			for range tx.MsgTx().TxIn {
 				// We'll access the slice of all the
 				// transactions spent in this block properly
@@ -849,6 +899,20 @@ func (idx *AddrIndex) TxRegionsForAddress(dbTx database.Tx, addr common.IAddress
 	return regions, skipped, err
 }
 
+// NumTxnsForAddress returns the number of confirmed transactions involving the
+// passed address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) NumTxnsForAddress(addr common.IAddress) (uint32, error) {
+	var numTxns uint32
+	err := idx.db.View(func(dbTx database.Tx) error {
+		addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
+		numTxns = dbCountAddrIndexEntries(addrIdxBucket, addr.StandardAddress())
+		return nil
+	})
+	return numTxns, err
+}
+
 // indexUnconfirmedAddresses modifies the unconfirmed (memory-only) address
 // index to include mappings for the addresses encoded by the passed public key
 // script to the transaction.
@@ -860,27 +924,33 @@ func (idx *AddrIndex) indexUnconfirmedAddresses(pkScript []byte, tx *asiutil.Tx)
 	// admitted to the mempool.
 	_, addresses, _, _ := txscript.ExtractPkScriptAddrs(pkScript)
 	for _, addr := range addresses {
-		// Ignore unsupported address types.
-		addrKey := addr.StandardAddress()
-
-		// Add a mapping from the address to the transaction.
-		idx.unconfirmedLock.Lock()
-		addrIndexEntry := idx.txnsByAddr[addrKey]
-		if addrIndexEntry == nil {
-			addrIndexEntry = make(map[common.Hash]*asiutil.Tx)
-			idx.txnsByAddr[addrKey] = addrIndexEntry
-		}
-		addrIndexEntry[*tx.Hash()] = tx
+		idx.indexUnconfirmedAddress(addr.StandardAddress(), tx)
+	}
+}
 
-		// Add a mapping from the transaction to the address.
-		addrsByTxEntry := idx.addrsByTx[*tx.Hash()]
-		if addrsByTxEntry == nil {
-			addrsByTxEntry = make(map[[addrKeySize]byte]struct{})
-			idx.addrsByTx[*tx.Hash()] = addrsByTxEntry
-		}
-		addrsByTxEntry[addrKey] = struct{}{}
-		idx.unconfirmedLock.Unlock()
+// indexUnconfirmedAddress modifies the unconfirmed (memory-only) address
+// index to include a mapping for the passed address to the transaction.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) indexUnconfirmedAddress(addrKey [addrKeySize]byte, tx *asiutil.Tx) {
+	idx.unconfirmedLock.Lock()
+	defer idx.unconfirmedLock.Unlock()
+
+	// Add a mapping from the address to the transaction.
+	addrIndexEntry := idx.txnsByAddr[addrKey]
+	if addrIndexEntry == nil {
+		addrIndexEntry = make(map[common.Hash]*asiutil.Tx)
+		idx.txnsByAddr[addrKey] = addrIndexEntry
 	}
+	addrIndexEntry[*tx.Hash()] = tx
+
+	// Add a mapping from the transaction to the address.
+	addrsByTxEntry := idx.addrsByTx[*tx.Hash()]
+	if addrsByTxEntry == nil {
+		addrsByTxEntry = make(map[[addrKeySize]byte]struct{})
+		idx.addrsByTx[*tx.Hash()] = addrsByTxEntry
+	}
+	addrsByTxEntry[addrKey] = struct{}{}
 }
 
 // AddUnconfirmedTx adds all addresses related to the transaction to the
@@ -898,7 +968,7 @@ func (idx *AddrIndex) AddUnconfirmedTx(tx *asiutil.Tx, utxoView *txo.UtxoViewpoi
 	// The existence checks are elided since this is only called after the
 	// transaction has already been validated and thus all inputs are
 	// already known to exist.
-	for _, txIn := range tx.MsgTx().TxIn {
+	for i, txIn := range tx.MsgTx().TxIn {
 		entry := utxoView.LookupEntry(txIn.PreviousOutPoint)
 		if entry == nil {
 			// Ignore missing entries.  This should never happen
@@ -907,6 +977,13 @@ func (idx *AddrIndex) AddUnconfirmedTx(tx *asiutil.Tx, utxoView *txo.UtxoViewpoi
 			continue
 		}
 		idx.indexUnconfirmedAddresses(entry.PkScript(), tx)
+
+		// Index the contract created by the transaction.
+		if i == 0 {
+			if contractAddr, ok := createdContract(tx, entry.PkScript()); ok {
+				idx.indexUnconfirmedAddress(contractAddr, tx)
+			}
+		}
 	}
 
 	// Index addresses of all created outputs.
@@ -7,9 +7,10 @@ package indexers
 import (
 	"bytes"
 	"fmt"
-	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/blockchain/mock"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
 	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/txscript"
 	"github.com/AsimovNetwork/asimov/asiutil"
@@ -277,6 +278,13 @@ nextTest:
 					test.name, numDelete, err)
 				continue nextTest
 			}
+			numEntries := dbCountAddrIndexEntries(bucket, test.key)
+			if numEntries != uint32(numExpected) {
+				t.Errorf("dbCountAddrIndexEntries (%s) delete %d: "+
+					"got %d, want %d", test.name, numDelete,
+					numEntries, numExpected)
+				continue nextTest
+			}
 		}
 	}
 }
@@ -289,7 +297,7 @@ func TestConnectBlock(t *testing.T)  {
 
 	addrIndex := NewAddrIndex(nil)
 
-	stxo := make([]blockchain.SpentTxOut, 0)
+	stxo := make([]txo.SpentTxOut, 0)
 	pblock := protos.MsgBlock{}
 	pblock.Header.Height = 101
 
@@ -368,19 +376,19 @@ func TestConnectBlock(t *testing.T)  {
 		})
 		pvblock.AddTransaction(msgtx0)
 
-		stxo = append(stxo, blockchain.SpentTxOut{
+		stxo = append(stxo, txo.SpentTxOut{
 			Amount:   100,
 			Height:   11,
 			Asset:    &asiutil.AsimovAsset,
 			PkScript: pkscript0,
 		})
-		stxo = append(stxo, blockchain.SpentTxOut{
+		stxo = append(stxo, txo.SpentTxOut{
 			Amount:   200,
 			Height:   22,
 			Asset:    &asiutil.AsimovAsset,
 			PkScript: pkscript2,
 		})
-		stxo = append(stxo, blockchain.SpentTxOut{
+		stxo = append(stxo, txo.SpentTxOut{
 			Amount:   300,
 			Height:   33,
 			Asset:    &asiutil.AsimovAsset,
@@ -599,4 +607,29 @@ func TestSerializeAddrIndexEntry(t *testing.T)  {
 			continue
 		}
 	}
-}
\ No newline at end of file
+}
+// TestCreatedContract ensures the address of the contract created by a
+// transaction is derived from its caller and inputs the same way the chain
+// derives it, and that other transactions create no contract.
+func TestCreatedContract(t *testing.T) {
+	caller, _ := common.NewAddressWithId(common.PubKeyHashAddrID, []byte{01, 02, 03, 04})
+	callerScript, _ := txscript.PayToAddrScript(caller)
+	createScript, _ := txscript.PayToContractScript(txscript.CreateTy.String(), nil)
+
+	msgTx := protos.NewMsgTx(protos.TxVersion)
+	msgTx.AddTxIn(protos.NewTxIn(protos.NewOutPoint(&common.Hash{0x01}, 0), nil))
+	msgTx.AddTxOut(protos.NewTxOut(1, createScript, asiutil.AsimovAsset))
+	tx := asiutil.NewTx(msgTx)
+
+	callerKey := caller.StandardAddress()
+	want, _ := crypto.CreateContractAddress(callerKey[:], []byte{}, tx.GetInputHash())
+	got, ok := createdContract(tx, callerScript)
+	if !ok || got != want {
+		t.Fatalf("createdContract: got %v, %v, want %v", got, ok, want)
+	}
+
+	msgTx.TxOut[0].PkScript = callerScript
+	if _, ok := createdContract(asiutil.NewTx(msgTx), callerScript); ok {
+		t.Fatal("contract created by a payment")
+	}
+}
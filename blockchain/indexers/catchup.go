@@ -0,0 +1,137 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/workers"
+)
+
+// catchUpLookahead is the maximum number of blocks loaded ahead of the block
+// being indexed while catching up the indexes.
+const catchUpLookahead = 64
+
+// indexWorkers limits the goroutines loading blocks ahead of the indexes
+// while they catch up with the main chain.  It defaults to one per processor
+// core.
+var indexWorkers = workers.New("index",
+	"goroutines loading blocks while the indexes catch up", workers.PerCPU(1))
+
+// catchUpBlock is a main chain block loaded ahead of its indexing, along
+// with its spend journal when an index needs the spent outputs.
+type catchUpBlock struct {
+	block     *asiutil.Block
+	vblock    *asiutil.VBlock
+	spentTxos []txo.SpentTxOut
+	err       error
+}
+
+// isBlockNotFoundErr returns whether or not the passed error is a
+// database.Error with an error code of database.ErrBlockNotFound.
+func isBlockNotFoundErr(err error) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == database.ErrBlockNotFound
+}
+
+// prunedBlockError returns the error of the indexes which need the main chain
+// block at the passed height to catch up, when the block was pruned.
+// startHeights are the tip heights of the indexes before the catch up.
+func (m *Manager) prunedBlockError(height int32, startHeights []int32) error {
+	var names []string
+	for i, indexer := range m.enabledIndexes {
+		if startHeights[i] < height {
+			names = append(names, indexer.Name())
+		}
+	}
+	return fmt.Errorf("the block at height %d was pruned, so the %s can "+
+		"not be caught up -- disable or drop them, or resync the node "+
+		"without --prune", height, strings.Join(names, ", "))
+}
+
+// checkNotPruned ensures the main chain block at the passed height, the first
+// one the indexes behind the main chain need, is stored.  The blocks are
+// pruned from the oldest ones, so the blocks after it are stored as well.
+func (m *Manager) checkNotPruned(chain *blockchain.BlockChain, height int32,
+	startHeights []int32) error {
+
+	hash, err := chain.BlockHashByHeight(height)
+	if err != nil {
+		return err
+	}
+	var stored bool
+	err = m.db.View(func(dbTx database.Tx) error {
+		var err error
+		stored, err = dbTx.HasBlock(database.NewNormalBlockKey(hash))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return m.prunedBlockError(height, startHeights)
+	}
+	return nil
+}
+
+// loadCatchUpBlock loads the main chain block at the passed height.
+func (m *Manager) loadCatchUpBlock(chain *blockchain.BlockChain, height int32,
+	needsInputs bool) *catchUpBlock {
+
+	hash, err := chain.BlockHashByHeight(height)
+	if err != nil {
+		return &catchUpBlock{err: err}
+	}
+	block, vblock, err := asiutil.GetBlockPair(m.db, hash)
+	if err != nil {
+		if _, ok := err.(asiutil.MissVBlockError); ok && height == 0 {
+			vblock = asiutil.NewVBlock(&protos.MsgVBlock{}, hash)
+		} else {
+			return &catchUpBlock{err: err}
+		}
+	}
+	result := &catchUpBlock{block: block, vblock: vblock}
+	if needsInputs {
+		result.spentTxos, result.err = chain.FetchSpendJournal(block, vblock)
+	}
+	return result
+}
+
+// prefetchBlocks loads the main chain blocks from the start to the end height
+// using up to the size of the index worker pool of goroutines.  The blocks
+// are delivered in order, each on its own channel.  needsInputs returns
+// whether the spend journal of the block at a height is needed.  Loading
+// stops when the quit channel is closed.
+func (m *Manager) prefetchBlocks(chain *blockchain.BlockChain, start, end int32,
+	needsInputs func(int32) bool, quit <-chan struct{}) <-chan chan *catchUpBlock {
+
+	ordered := make(chan chan *catchUpBlock, catchUpLookahead)
+	go func() {
+		defer close(ordered)
+		for height := start; height <= end; height++ {
+			if !indexWorkers.Acquire(quit) {
+				return
+			}
+			result := make(chan *catchUpBlock, 1)
+			select {
+			case ordered <- result:
+			case <-quit:
+				indexWorkers.Release()
+				return
+			}
+			go func(height int32) {
+				defer indexWorkers.Release()
+				result <- m.loadCatchUpBlock(chain, height, needsInputs(height))
+			}(height)
+		}
+	}()
+	return ordered
+}
@@ -22,8 +22,8 @@ const (
 	cfIndexName = "committed filter index"
 )
 
-// Committed filters come in one flavor currently: basic. They are generated
-// and dropped in pairs, and both are indexed by a block's hash.  Besides
+// Committed filters come in two flavors: basic and contract. They are generated
+// and dropped together, and are all indexed by a block's hash.  Besides
 // holding different content, they also live in different buckets.
 var (
 	// cfIndexParentBucketKey is the name of the parent bucket used to
@@ -34,18 +34,21 @@ var (
 	// block hashes to cfilters.
 	cfIndexKeys = [][]byte{
 		[]byte("cf0byhashidx"),
+		[]byte("cf1byhashidx"),
 	}
 
 	// cfHeaderKeys is an array of db bucket names used to house indexes of
 	// block hashes to cf headers.
 	cfHeaderKeys = [][]byte{
 		[]byte("cf0headerbyhashidx"),
+		[]byte("cf1headerbyhashidx"),
 	}
 
 	// cfHashKeys is an array of db bucket names used to house indexes of
 	// block hashes to cf hashes.
 	cfHashKeys = [][]byte{
 		[]byte("cf0hashbyhashidx"),
+		[]byte("cf1hashbyhashidx"),
 	}
 
 	maxFilterType = uint8(len(cfHeaderKeys) - 1)
@@ -112,8 +115,8 @@ func (idx *CfIndex) Name() string {
 }
 
 // Create is invoked when the indexer manager determines the index needs to
-// be created for the first time. It creates buckets for the two hash-based cf
-// indexes (regular only currently).
+// be created for the first time. It creates buckets for the hash-based cf
+// indexes of every filter type.
 func (idx *CfIndex) Create(dbTx database.Tx) error {
 	meta := dbTx.Metadata()
 
@@ -147,7 +150,9 @@ func (idx *CfIndex) Create(dbTx database.Tx) error {
 }
 
 // Checking if there is a new bucket added to this indexer
-// This method is invoked each time when node started.
+// This method is invoked each time when node started.  The filters of a new
+// filter type chain their headers from the genesis block, so the index is
+// rebuilt from the genesis block when a filter type was added.
 func (idx *CfIndex) Check(dbTx database.Tx) error {
 	meta := dbTx.Metadata()
 
@@ -156,27 +161,24 @@ func (idx *CfIndex) Check(dbTx database.Tx) error {
 		return err
 	}
 
-	for _, bucketName := range cfIndexKeys {
-		_, err = cfIndexParentBucket.CreateBucketIfNotExists(bucketName)
-		if err != nil {
-			return err
+	added := false
+	for _, keys := range [][][]byte{cfIndexKeys, cfHeaderKeys, cfHashKeys} {
+		for _, bucketName := range keys {
+			if cfIndexParentBucket.Bucket(bucketName) != nil {
+				continue
+			}
+			_, err = cfIndexParentBucket.CreateBucket(bucketName)
+			if err != nil {
+				return err
+			}
+			added = true
 		}
 	}
 
-	for _, bucketName := range cfHeaderKeys {
-		_, err = cfIndexParentBucket.CreateBucketIfNotExists(bucketName)
-		if err != nil {
-			return err
-		}
+	if added {
+		log.Infof("Rebuilding the %s for the new filter types", cfIndexName)
+		return dbPutIndexerTip(dbTx, cfIndexParentBucketKey, &common.Hash{}, -1)
 	}
-
-	for _, bucketName := range cfHashKeys {
-		_, err = cfIndexParentBucket.CreateBucketIfNotExists(bucketName)
-		if err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -243,7 +245,8 @@ func storeFilter(dbTx database.Tx, block *asiutil.Block, f *gcs.Filter,
 
 // ConnectBlock is invoked by the index manager when a new block has been
 // connected to the main chain. This indexer adds a hash-to-cf mapping for
-// every passed block. This is part of the Indexer interface.
+// every passed block, one for each filter type. This is part of the Indexer
+// interface.
 func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
 	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
 
@@ -256,8 +259,19 @@ func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
 	if err != nil {
 		return err
 	}
+	if err := storeFilter(dbTx, block, f, protos.GCSFilterRegular); err != nil {
+		return err
+	}
 
-	return storeFilter(dbTx, block, f, protos.GCSFilterRegular)
+	var msgVBlock *protos.MsgVBlock
+	if vblock != nil {
+		msgVBlock = vblock.MsgVBlock()
+	}
+	f, err = builder.BuildContractFilter(block.MsgBlock(), msgVBlock, prevScripts)
+	if err != nil {
+		return err
+	}
+	return storeFilter(dbTx, block, f, protos.GCSFilterContract)
 }
 
 // DisconnectBlock is invoked by the index manager when a block has been
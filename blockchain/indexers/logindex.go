@@ -0,0 +1,310 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package indexers
+
+import (
+	"encoding/binary"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+)
+
+const (
+	// logIndexName is the human-readable name for the index.
+	logIndexName = "contract log index"
+
+	// maxLogTopics is the maximum number of topics of a log.
+	maxLogTopics = 4
+
+	// logKeyAddress and logKeyTopic are the kinds of the keys of the
+	// index, which map the contracts and the topics at each position of
+	// the logs to the heights of the blocks with matching logs.
+	logKeyAddress = 'a'
+	logKeyTopic   = 't'
+)
+
+var (
+	// logIndexKey is the key of the contract log index and the db bucket
+	// used to house it.
+	logIndexKey = []byte("logidx")
+)
+
+// LogIndex implements an index of the logs of the contracts.  It maps the
+// address of the contracts and the topics of their logs to the heights of
+// the blocks of the main chain whose receipts hold matching logs, so the logs
+// matching a filter are found without reading the receipts of every block.
+//
+// The layout of the keys of the index is:
+//
+//	address: 'a' <contract address> <block height>
+//	topic:   't' <topic position> <topic> <block height>
+//
+// The heights are big endian so the cursor of the bucket walks the blocks of
+// a contract or a topic in ascending order.  The values are empty.
+type LogIndex struct {
+	db    database.Transactor
+	ethDB database.Database
+}
+
+// Ensure the LogIndex type implements the Indexer interface.
+var _ blockchain.Indexer = (*LogIndex)(nil)
+
+// logIndexKeyPrefix returns the prefix of the keys of the passed contract
+// address or topic.
+func logIndexKeyPrefix(kind byte, position uint8, value []byte) []byte {
+	prefix := make([]byte, 0, 2+len(value)+4)
+	prefix = append(prefix, kind)
+	if kind == logKeyTopic {
+		prefix = append(prefix, position)
+	}
+	return append(prefix, value...)
+}
+
+// logIndexEntryKey returns the key mapping the passed prefix to a block
+// height.
+func logIndexEntryKey(prefix []byte, height int32) []byte {
+	key := make([]byte, len(prefix)+4)
+	copy(key, prefix)
+	binary.BigEndian.PutUint32(key[len(prefix):], uint32(height))
+	return key
+}
+
+// logKeyPrefixes returns the prefixes of the keys of the contracts and topics
+// of the passed receipts, without duplicates.
+func logKeyPrefixes(receipts types.Receipts) [][]byte {
+	seen := make(map[string]struct{})
+	var prefixes [][]byte
+	add := func(prefix []byte) {
+		if _, ok := seen[string(prefix)]; ok {
+			return
+		}
+		seen[string(prefix)] = struct{}{}
+		prefixes = append(prefixes, prefix)
+	}
+	for _, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		for _, l := range receipt.Logs {
+			add(logIndexKeyPrefix(logKeyAddress, 0, l.Address[:]))
+			for i, topic := range l.Topics {
+				if i >= maxLogTopics {
+					break
+				}
+				add(logIndexKeyPrefix(logKeyTopic, uint8(i), topic[:]))
+			}
+		}
+	}
+	return prefixes
+}
+
+// Init initializes the contract log index.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) Init() error {
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) Key() []byte {
+	return logIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) Name() string {
+	return logIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the bucket for the index.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(logIndexKey)
+	return err
+}
+
+// Check is invoked each time the node starts to create the bucket of the
+// index when it is missing.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) Check(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucketIfNotExists(logIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer maps the contracts and topics of
+// the logs of the block to its height.  The receipts of the block are written
+// before the block is connected.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
+	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
+
+	receipts := rawdb.ReadReceipts(idx.ethDB, *block.Hash(), uint64(block.Height()))
+	bucket := dbTx.Metadata().Bucket(logIndexKey)
+	for _, prefix := range logKeyPrefixes(receipts) {
+		err := bucket.Put(logIndexEntryKey(prefix, block.Height()), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the mappings of the
+// contracts and topics of the logs of the block.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) DisconnectBlock(dbTx database.Tx, block *asiutil.Block,
+	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
+
+	receipts := rawdb.ReadReceipts(idx.ethDB, *block.Hash(), uint64(block.Height()))
+	bucket := dbTx.Metadata().Bucket(logIndexKey)
+	for _, prefix := range logKeyPrefixes(receipts) {
+		err := bucket.Delete(logIndexEntryKey(prefix, block.Height()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchBlockRegion is not supported by the contract log index, which does not
+// map keys to block regions.
+//
+// This is part of the Indexer interface.
+func (idx *LogIndex) FetchBlockRegion(key []byte) (*database.BlockRegion, error) {
+	return nil, nil
+}
+
+// dbFetchLogHeights returns the heights of the blocks mapped to the passed
+// prefix from start to end, both included, in ascending order.
+func dbFetchLogHeights(bucket database.Bucket, prefix []byte, start, end int32) []int32 {
+	var heights []int32
+	cursor := bucket.Cursor()
+	for ok := cursor.Seek(logIndexEntryKey(prefix, start)); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if len(key) != len(prefix)+4 || string(key[:len(prefix)]) != string(prefix) {
+			break
+		}
+		height := int32(binary.BigEndian.Uint32(key[len(prefix):]))
+		if height > end {
+			break
+		}
+		heights = append(heights, height)
+	}
+	return heights
+}
+
+// unionHeights returns the heights of both of the passed ascending lists, in
+// ascending order and without duplicates.
+func unionHeights(a, b []int32) []int32 {
+	union := make([]int32, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			union = append(union, a[0])
+			a = a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			union = append(union, b[0])
+			b = b[1:]
+		default:
+			union = append(union, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return union
+}
+
+// intersectHeights returns the heights found in both of the passed ascending
+// lists, in ascending order.
+func intersectHeights(a, b []int32) []int32 {
+	var intersection []int32
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case b[0] < a[0]:
+			b = b[1:]
+		default:
+			intersection = append(intersection, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return intersection
+}
+
+// BlocksWithLogs returns the heights of the blocks from start to end, both
+// included, which may hold logs of one of the passed contracts and with one
+// of the passed topics at each position.  An empty list of contracts or of
+// topics at a position matches any contract or topic.  The logs of the
+// returned blocks must still be filtered, and at least one contract or topic
+// must be passed.
+//
+// This function is safe for concurrent access.
+func (idx *LogIndex) BlocksWithLogs(addrs []common.Address, topics [][]common.Hash,
+	start, end int32) ([]int32, error) {
+
+	var heights []int32
+	filtered := false
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(logIndexKey)
+		restrict := func(prefixes [][]byte) {
+			var matches []int32
+			for _, prefix := range prefixes {
+				matches = unionHeights(matches, dbFetchLogHeights(bucket, prefix, start, end))
+			}
+			if filtered {
+				heights = intersectHeights(heights, matches)
+			} else {
+				heights, filtered = matches, true
+			}
+		}
+
+		if len(addrs) > 0 {
+			prefixes := make([][]byte, 0, len(addrs))
+			for i := range addrs {
+				prefixes = append(prefixes, logIndexKeyPrefix(logKeyAddress, 0, addrs[i][:]))
+			}
+			restrict(prefixes)
+		}
+		for i, position := range topics {
+			if len(position) == 0 || i >= maxLogTopics {
+				continue
+			}
+			prefixes := make([][]byte, 0, len(position))
+			for j := range position {
+				prefixes = append(prefixes, logIndexKeyPrefix(logKeyTopic, uint8(i), position[j][:]))
+			}
+			restrict(prefixes)
+		}
+		return nil
+	})
+	return heights, err
+}
+
+// NewLogIndex returns a new instance of an indexer that is used to map the
+// contracts and topics of the logs of the main chain to the heights of their
+// blocks.  The receipts of the blocks are read from the passed state
+// database.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewLogIndex(db database.Transactor, ethDB database.Database) *LogIndex {
+	log.Info("Contract log index is enabled")
+	return &LogIndex{db: db, ethDB: ethDB}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package indexers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+)
+
+func TestLogKeyPrefixes(t *testing.T) {
+	contract := common.Address{common.ContractHashAddrID, 0x01}
+	transfer := common.Hash{0x0a}
+	approval := common.Hash{0x0b}
+	receipts := types.Receipts{
+		{Logs: []*types.Log{
+			{Address: contract, Topics: []common.Hash{transfer, approval}},
+			{Address: contract, Topics: []common.Hash{transfer}},
+		}},
+		nil,
+		{Logs: []*types.Log{
+			{Address: contract, Topics: []common.Hash{approval}},
+		}},
+	}
+
+	prefixes := logKeyPrefixes(receipts)
+	want := [][]byte{
+		logIndexKeyPrefix(logKeyAddress, 0, contract[:]),
+		logIndexKeyPrefix(logKeyTopic, 0, transfer[:]),
+		logIndexKeyPrefix(logKeyTopic, 1, approval[:]),
+		logIndexKeyPrefix(logKeyTopic, 0, approval[:]),
+	}
+	if !reflect.DeepEqual(prefixes, want) {
+		t.Fatalf("logKeyPrefixes:\n got: %x\nwant: %x", prefixes, want)
+	}
+	if len(want[0]) != 1+common.AddressLength || len(want[1]) != 2+common.HashLength {
+		t.Fatalf("unexpected prefix sizes %d and %d", len(want[0]), len(want[1]))
+	}
+
+	// The heights of the keys sort in ascending order.
+	low := logIndexEntryKey(want[0], 255)
+	high := logIndexEntryKey(want[0], 256)
+	if bytes.Compare(low, high) >= 0 {
+		t.Fatalf("key of height 255 %x sorts after the key of height 256 %x", low, high)
+	}
+}
+
+func TestHeightSets(t *testing.T) {
+	tests := []struct {
+		a, b         []int32
+		union, inter []int32
+	}{
+		{nil, nil, []int32{}, nil},
+		{[]int32{1, 3}, nil, []int32{1, 3}, nil},
+		{nil, []int32{2}, []int32{2}, nil},
+		{[]int32{1, 3, 5}, []int32{2, 3, 6}, []int32{1, 2, 3, 5, 6}, []int32{3}},
+		{[]int32{4, 5}, []int32{4, 5}, []int32{4, 5}, []int32{4, 5}},
+	}
+	for i, test := range tests {
+		if union := unionHeights(test.a, test.b); !reflect.DeepEqual(union, test.union) {
+			t.Errorf("#%d: unionHeights = %v, want %v", i, union, test.union)
+		}
+		if inter := intersectHeights(test.a, test.b); !reflect.DeepEqual(inter, test.inter) {
+			t.Errorf("#%d: intersectHeights = %v, want %v", i, inter, test.inter)
+		}
+	}
+}
@@ -5,20 +5,37 @@
 package indexers
 
 import (
+	"errors"
 	"fmt"
-	"github.com/AsimovNetwork/asimov/blockchain/txo"
-	"github.com/AsimovNetwork/asimov/protos"
+	"sync"
+	"time"
 
+	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/database"
-	"github.com/AsimovNetwork/asimov/asiutil"
+)
+
+const (
+	// backfillMinBlocks is the number of blocks an index must be behind the
+	// main chain to be backfilled in the background instead of caught up
+	// before the chain starts.
+	backfillMinBlocks = 1000
+
+	// backfillPollInterval is the interval at which the backfill checks
+	// whether the indexes at the main chain tip followed it.
+	backfillPollInterval = time.Second
 )
 
 var (
 	// indexTipsBucketName is the name of the db bucket used to house the
 	// current tip of each index.
 	indexTipsBucketName = []byte("idxtips")
+
+	// errBackfillStale indicates the blocks loaded by the backfill are no
+	// longer in the main chain.
+	errBackfillStale = errors.New("backfill blocks no longer in the main chain")
 )
 
 // -----------------------------------------------------------------------------
@@ -132,6 +149,20 @@ func dbIndexDisconnectBlock(dbTx database.Tx, indexer blockchain.Indexer, block
 type Manager struct {
 	db             database.Transactor
 	enabledIndexes []blockchain.Indexer
+
+	// live tells, for each enabled index, whether it follows the main
+	// chain, as opposed to being caught up or backfilled.  caughtUp holds
+	// the tip of the backfilled indexes which reached the main chain in the
+	// last transaction connecting or disconnecting a block, which follow
+	// it once that transaction is committed.  They are protected by mtx,
+	// which is only acquired within database transactions.
+	mtx      sync.Mutex
+	live     []bool
+	caughtUp []*common.Hash
+
+	quit chan struct{}
+	stop sync.Once
+	wg   sync.WaitGroup
 }
 
 // Ensure the Manager type implements the blockchain.IndexManager interface.
@@ -228,9 +259,11 @@ func (m *Manager) maybeCreateIndexes(dbTx database.Tx) error {
 // Init initializes the enabled indexes.  This is called during chain
 // initialization and primarily consists of catching up all indexes to the
 // current best chain tip.  This is necessary since each index can be disabled
-// and re-enabled at any time and attempting to catch-up indexes at the same
-// time new blocks are being downloaded would lead to an overall longer time to
-// catch up due to the I/O contention.
+// and re-enabled at any time.  Indexes which are a few blocks behind are caught
+// up before the chain starts, while the indexes at least backfillMinBlocks
+// behind, such as a new index enabled on an archive node, are backfilled in the
+// background so the validation of the new blocks is not blocked for hours.
+// The backfilled indexes follow the main chain as soon as they reach its tip.
 //
 // This is part of the blockchain.IndexManager interface.
 func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{}) error {
@@ -243,6 +276,10 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		return errInterruptRequested
 	}
 
+	if chain.ReadOnly() {
+		return m.initReadOnly(chain)
+	}
+
 	// Finish and drops that were previously interrupted.
 	if err := m.maybeFinishDrops(interrupt); err != nil {
 		return err
@@ -275,87 +312,257 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 	// reorganized while the index is disabled.  This has to be done in
 	// reverse order because later indexes can depend on earlier ones.
 	for i := len(m.enabledIndexes); i > 0; i-- {
-		indexer := m.enabledIndexes[i-1]
-
-		// Fetch the current tip for the index.
-		var height int32
-		var hash *common.Hash
-		err := m.db.View(func(dbTx database.Tx) error {
-			idxKey := indexer.Key()
-			hash, height, err = dbFetchIndexerTip(dbTx, idxKey)
-			return err
-		})
+		err := m.rollbackOrphans(chain, m.enabledIndexes[i-1], interrupt)
 		if err != nil {
 			return err
 		}
+	}
 
-		// Nothing to do if the index does not have any entries yet.
-		if height == -1 {
-			continue
+	// Fetch the current tip heights for each index along with tracking the
+	// lowest one so the catchup code only needs to start at the earliest
+	// block and is able to skip connecting the block for the indexes that
+	// don't need it.
+	bestHeight := chain.BestSnapshot().Height
+	lowestHeight, indexerHeights, err := m.fetchTipHeights(bestHeight)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to index if all of the indexes are caught up.
+	if lowestHeight == bestHeight {
+		m.mtx.Lock()
+		for i := range m.live {
+			m.live[i] = true
 		}
+		m.mtx.Unlock()
+		return nil
+	}
 
-		// Loop until the tip is a block that exists in the main chain.
-		initialHeight := height
-		for !chain.MainChainHasBlock(hash) {
-			// At this point the index tip is orphaned, so load the
-			// orphaned block from the database directly and
-			// disconnect it from the index.  The block has to be
-			// loaded directly since it is no longer in the main
-			// chain and thus the chain.BlockByHash function would
-			// error.
-			block, vblock, err := asiutil.GetBlockPair(m.db, hash)
-			if err != nil {
+	// The indexes can not be caught up once the blocks they need are
+	// pruned, so the node refuses to start rather than leave them behind.
+	err = m.checkNotPruned(chain, lowestHeight+1, indexerHeights)
+	if err != nil {
+		return err
+	}
+
+	// Backfill the indexes far behind the main chain in the background.
+	// The indexes at the tip follow the main chain meanwhile.
+	if bestHeight-lowestHeight >= backfillMinBlocks {
+		m.mtx.Lock()
+		for i, height := range indexerHeights {
+			m.live[i] = height == bestHeight
+		}
+		m.mtx.Unlock()
+
+		log.Infof("Backfilling indexes from height %d in the background",
+			lowestHeight)
+		if interrupt != nil {
+			go func() {
+				select {
+				case <-interrupt:
+					m.Stop()
+				case <-m.quit:
+				}
+			}()
+		}
+		m.wg.Add(1)
+		go m.backfillHandler(chain)
+		return nil
+	}
+
+	// At this point, one or more indexes are behind the current best chain
+	// tip and need to be caught up, so logger the details and loop through
+	// each block that needs to be indexed.
+	log.Infof("Catching up indexes from height %d to %d", lowestHeight,
+		bestHeight)
+	err = m.catchUp(chain, lowestHeight, bestHeight, indexerHeights,
+		interrupt, false)
+	if err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	for i := range m.live {
+		m.live[i] = true
+	}
+	m.mtx.Unlock()
+
+	log.Infof("Indexes caught up to height %d", bestHeight)
+	return nil
+}
+
+// initReadOnly initializes the enabled indexes of a read-only database.  They
+// can neither be created, dropped nor caught up, so they must exist and be at
+// the best block already.
+func (m *Manager) initReadOnly(chain *blockchain.BlockChain) error {
+	best := chain.BestSnapshot()
+	err := m.db.View(func(dbTx database.Tx) error {
+		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		for _, indexer := range m.enabledIndexes {
+			idxKey := indexer.Key()
+			if indexesBucket == nil || indexesBucket.Get(idxKey) == nil {
+				return fmt.Errorf("the %s does not exist in the "+
+					"read-only database", indexer.Name())
+			}
+			if indexesBucket.Get(indexDropKey(idxKey)) != nil {
+				return fmt.Errorf("the %s is being dropped from the "+
+					"read-only database", indexer.Name())
+			}
+			if err := indexer.Check(dbTx); err != nil {
 				return err
 			}
 
-			// We'll also grab the set of outputs spent by this
-			// block so we can remove them from the index.
-			spentTxos, err := chain.FetchSpendJournal(block, vblock)
+			hash, height, err := dbFetchIndexerTip(dbTx, idxKey)
 			if err != nil {
 				return err
 			}
+			if *hash != best.Hash {
+				return fmt.Errorf("the %s of the read-only database "+
+					"is at height %d instead of the best block "+
+					"(height %d) -- catch it up on a writable "+
+					"database first", indexer.Name(), height,
+					best.Height)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-			// With the block and stxo set for that block retrieved,
-			// we can now update the index itself.
-			err = m.db.Update(func(dbTx database.Tx) error {
-				// Remove all of the index entries associated
-				// with the block and update the indexer tip.
-				err = dbIndexDisconnectBlock(
-					dbTx, indexer, block, spentTxos, vblock)
-				if err != nil {
-					return err
-				}
+	for _, indexer := range m.enabledIndexes {
+		if err := indexer.Init(); err != nil {
+			return err
+		}
+	}
+	m.mtx.Lock()
+	for i := range m.live {
+		m.live[i] = true
+	}
+	m.mtx.Unlock()
+	return nil
+}
 
-				// Update the tip to the previous block.
-				hash = &block.MsgBlock().Header.PrevBlock
-				height--
+// rollbackOrphans disconnects the blocks of the tip of the passed index until
+// it is a block of the main chain.
+func (m *Manager) rollbackOrphans(chain *blockchain.BlockChain, indexer blockchain.Indexer,
+	interrupt <-chan struct{}) error {
 
-				return nil
-			})
+	// Fetch the current tip for the index.
+	var height int32
+	var hash *common.Hash
+	err := m.db.View(func(dbTx database.Tx) error {
+		var err error
+		hash, height, err = dbFetchIndexerTip(dbTx, indexer.Key())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do if the index does not have any entries yet.
+	if height == -1 {
+		return nil
+	}
+
+	// Loop until the tip is a block that exists in the main chain.
+	initialHeight := height
+	for !chain.MainChainHasBlock(hash) {
+		// At this point the index tip is orphaned, so load the
+		// orphaned block from the database directly and disconnect it
+		// from the index.  The block has to be loaded directly since
+		// it is no longer in the main chain and thus the
+		// chain.BlockByHash function would error.
+		block, vblock, err := asiutil.GetBlockPair(m.db, hash)
+		if err != nil {
+			return err
+		}
+
+		// We'll also grab the set of outputs spent by this block so we
+		// can remove them from the index.
+		spentTxos, err := chain.FetchSpendJournal(block, vblock)
+		if err != nil {
+			return err
+		}
+
+		// With the block and stxo set for that block retrieved, we can
+		// now update the index itself.
+		moved := false
+		err = m.db.Update(func(dbTx database.Tx) error {
+			// The chain may have disconnected the tip meanwhile
+			// when the index is backfilled.
+			tipHash, _, err := dbFetchIndexerTip(dbTx, indexer.Key())
 			if err != nil {
 				return err
 			}
+			if !tipHash.IsEqual(hash) {
+				moved = true
+				return nil
+			}
 
-			if interruptRequested(interrupt) {
-				return errInterruptRequested
+			// Remove all of the index entries associated with the
+			// block and update the indexer tip.
+			err = dbIndexDisconnectBlock(
+				dbTx, indexer, block, spentTxos, vblock)
+			if err != nil {
+				return err
 			}
+
+			// Update the tip to the previous block.
+			hash = &block.MsgBlock().Header.PrevBlock
+			height--
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if moved {
+			break
 		}
 
-		if initialHeight != height {
-			log.Infof("Removed %d orphaned blocks from %s "+
-				"(heights %d to %d)", initialHeight-height,
-				indexer.Name(), height+1, initialHeight)
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
 		}
 	}
 
-	// Fetch the current tip heights for each index along with tracking the
-	// lowest one so the catchup code only needs to start at the earliest
-	// block and is able to skip connecting the block for the indexes that
-	// don't need it.
-	bestHeight := chain.BestSnapshot().Height
+	if initialHeight != height {
+		log.Infof("Removed %d orphaned blocks from %s "+
+			"(heights %d to %d)", initialHeight-height,
+			indexer.Name(), height+1, initialHeight)
+	}
+	return nil
+}
+
+// confirmCaughtUp returns whether the index at the passed position follows the
+// main chain.  A backfilled index follows it once its committed tip is the one
+// it reached the main chain with, since the transaction connecting it to the
+// main chain was committed then.  It must be called with the manager lock
+// held.
+func (m *Manager) confirmCaughtUp(i int, tipHash *common.Hash, tipHeight int32) bool {
+	if m.live[i] {
+		return true
+	}
+	if m.caughtUp[i] == nil || !tipHash.IsEqual(m.caughtUp[i]) {
+		return false
+	}
+	log.Infof("%s backfilled, following the main chain from height %d",
+		m.enabledIndexes[i].Name(), tipHeight)
+	m.live[i] = true
+	m.caughtUp[i] = nil
+	return true
+}
+
+// fetchTipHeights returns the tip heights of the enabled indexes, along with
+// the lowest tip height of the indexes which do not follow the main chain,
+// which is the passed best height when all of them do.
+func (m *Manager) fetchTipHeights(bestHeight int32) (int32, []int32, error) {
 	lowestHeight := bestHeight
 	indexerHeights := make([]int32, len(m.enabledIndexes))
-	err = m.db.View(func(dbTx database.Tx) error {
+	err := m.db.View(func(dbTx database.Tx) error {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+
 		for i, indexer := range m.enabledIndexes {
 			idxKey := indexer.Key()
 			hash, height, err := dbFetchIndexerTip(dbTx, idxKey)
@@ -366,77 +573,99 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			log.Debugf("Current %s tip (height %d, hash %v)",
 				indexer.Name(), height, hash)
 			indexerHeights[i] = height
-			if height < lowestHeight {
+			if !m.confirmCaughtUp(i, hash, height) && height < lowestHeight {
 				lowestHeight = height
 			}
 		}
 		return nil
 	})
-	if err != nil {
-		return err
-	}
+	return lowestHeight, indexerHeights, err
+}
 
-	// Nothing to index if all of the indexes are caught up.
-	if lowestHeight == bestHeight {
-		return nil
-	}
+// catchUp connects the main chain blocks after the lowest height up to the end
+// height to the indexes which do not follow the main chain and are behind
+// them.  startHeights are the tip heights of the indexes before the catch up.
+// When backfilling while the chain connects new blocks, errBackfillStale is
+// returned as soon as the loaded blocks are no longer in the main chain.
+func (m *Manager) catchUp(chain *blockchain.BlockChain, lowestHeight, endHeight int32,
+	startHeights []int32, interrupt <-chan struct{}, backfill bool) error {
 
 	// Create a progress logger for the indexing process below.
 	progressLogger := newBlockProgressLogger("Indexed", log)
 
-	// At this point, one or more indexes are behind the current best chain
-	// tip and need to be caught up, so logger the details and loop through
-	// each block that needs to be indexed.
-	log.Infof("Catching up indexes from height %d to %d", lowestHeight,
-		bestHeight)
-	for height := lowestHeight + 1; height <= bestHeight; height++ {
-		// Load the block and vblock for the height since it is required to index
-		// it.
-		hash, err := chain.BlockHashByHeight(height)
-		if err != nil {
-			return err
+	// The blocks are loaded ahead by the index workers, which only read the
+	// tip heights of the indexes before the catch up.
+	needsInputs := func(height int32) bool {
+		for i, indexer := range m.enabledIndexes {
+			if startHeights[i] < height && indexNeedsInputs(indexer) {
+				return true
+			}
 		}
-
-		block, vblock, err := asiutil.GetBlockPair(m.db, hash)
-		if err != nil {
-			if _, ok := err.(asiutil.MissVBlockError); ok && height == 0 {
-				vblock = asiutil.NewVBlock(&protos.MsgVBlock{}, hash)
-			} else {
-				return err
+		return false
+	}
+	done := make(chan struct{})
+	defer close(done)
+	blocks := m.prefetchBlocks(chain, lowestHeight+1, endHeight, needsInputs, done)
+	for height := lowestHeight + 1; height <= endHeight; height++ {
+		result := <-blocks
+		loaded := <-result
+		if loaded.err != nil {
+			// The main chain may be shorter after a reorganization
+			// while backfilling.
+			if backfill && height > chain.BestSnapshot().Height {
+				return errBackfillStale
+			}
+			// The blocks may be pruned while backfilling.
+			if isBlockNotFoundErr(loaded.err) {
+				return m.prunedBlockError(height, startHeights)
 			}
+			return loaded.err
 		}
+		block, vblock, spentTxos := loaded.block, loaded.vblock, loaded.spentTxos
 
 		if interruptRequested(interrupt) {
 			return errInterruptRequested
 		}
 
-		// Connect the block for all indexes that need it.
-		var spentTxos []txo.SpentTxOut
-		for i, indexer := range m.enabledIndexes {
-			// Skip indexes that don't need to be updated with this
-			// block.
-			if indexerHeights[i] >= height {
-				continue
-			}
+		// Connect the block for all indexes that need it.  The tips are
+		// read in the same transaction as the indexes are updated, so
+		// the backfill observes the blocks connected by the chain
+		// meanwhile.
+		err := m.db.Update(func(dbTx database.Tx) error {
+			m.mtx.Lock()
+			defer m.mtx.Unlock()
 
-			// When the index requires all of the referenced txouts
-			// and they haven't been loaded yet, they need to be
-			// retrieved from the spend journal.
-			if spentTxos == nil && indexNeedsInputs(indexer) {
-				spentTxos, err = chain.FetchSpendJournal(block, vblock)
+			if backfill && !chain.MainChainHasBlock(block.Hash()) {
+				return errBackfillStale
+			}
+			prevHash := &block.MsgBlock().Header.PrevBlock
+			for i, indexer := range m.enabledIndexes {
+				// Skip indexes that follow the main chain or
+				// don't need to be updated with this block.
+				if m.live[i] {
+					continue
+				}
+				tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, indexer.Key())
 				if err != nil {
 					return err
 				}
-			}
+				if tipHeight >= height {
+					continue
+				}
+				if backfill && !tipHash.IsEqual(prevHash) {
+					return errBackfillStale
+				}
 
-			err := m.db.Update(func(dbTx database.Tx) error {
-				return dbIndexConnectBlock(
+				err = dbIndexConnectBlock(
 					dbTx, indexer, block, spentTxos, vblock)
-			})
-			if err != nil {
-				return err
+				if err != nil {
+					return err
+				}
 			}
-			indexerHeights[i] = height
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
 		// Log indexing progress.
@@ -446,11 +675,82 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			return errInterruptRequested
 		}
 	}
-
-	log.Infof("Indexes caught up to height %d", bestHeight)
 	return nil
 }
 
+// backfillHandler catches up the indexes which do not follow the main chain
+// while the chain connects new blocks, until all of them reached the tip of
+// the main chain.  It must be run as a goroutine.
+func (m *Manager) backfillHandler(chain *blockchain.BlockChain) {
+	defer m.wg.Done()
+
+	for !interruptRequested(m.quit) {
+		bestHeight := chain.BestSnapshot().Height
+		lowestHeight, indexerHeights, err := m.fetchTipHeights(bestHeight)
+		if err != nil {
+			log.Errorf("Unable to backfill indexes: %v", err)
+			return
+		}
+
+		m.mtx.Lock()
+		behind := false
+		for _, live := range m.live {
+			behind = behind || !live
+		}
+		m.mtx.Unlock()
+		if !behind {
+			log.Infof("Indexes backfilled up to the main chain tip")
+			return
+		}
+
+		// The indexes at the tip follow the main chain from the next
+		// connected block.
+		if lowestHeight >= bestHeight {
+			select {
+			case <-time.After(backfillPollInterval):
+			case <-m.quit:
+			}
+			continue
+		}
+
+		err = m.catchUp(chain, lowestHeight, bestHeight, indexerHeights,
+			m.quit, true)
+		switch err {
+		case nil, errInterruptRequested:
+
+		// The chain was reorganized meanwhile, so rollback the indexes
+		// to the main chain before backfilling them again.
+		case errBackfillStale:
+			for i := len(m.enabledIndexes); i > 0; i-- {
+				m.mtx.Lock()
+				live := m.live[i-1]
+				m.mtx.Unlock()
+				if live {
+					continue
+				}
+				err := m.rollbackOrphans(chain, m.enabledIndexes[i-1], m.quit)
+				if err != nil && err != errInterruptRequested {
+					log.Errorf("Unable to backfill indexes: %v", err)
+					return
+				}
+			}
+
+		default:
+			log.Errorf("Unable to backfill indexes: %v", err)
+			return
+		}
+	}
+}
+
+// Stop stops the backfill of the indexes and waits for it to return.  The
+// indexes resume their backfill when the node restarts.
+func (m *Manager) Stop() {
+	m.stop.Do(func() {
+		close(m.quit)
+	})
+	m.wg.Wait()
+}
+
 // indexNeedsInputs returns whether or not the index needs access to the txouts
 // referenced by the transaction inputs being indexed.
 func indexNeedsInputs(index blockchain.Indexer) bool {
@@ -469,9 +769,27 @@ func indexNeedsInputs(index blockchain.Indexer) bool {
 func (m *Manager) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
 	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
 
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
 	// Call each of the currently active optional indexes with the block
-	// being connected so they can update accordingly.
-	for _, index := range m.enabledIndexes {
+	// being connected so they can update accordingly.  The backfilled
+	// indexes are connected the block once their tip is its parent, and
+	// follow the main chain once the transaction is committed.
+	for i, index := range m.enabledIndexes {
+		if !m.live[i] {
+			tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, index.Key())
+			if err != nil {
+				return err
+			}
+			if !m.confirmCaughtUp(i, tipHash, tipHeight) {
+				if !tipHash.IsEqual(&block.MsgBlock().Header.PrevBlock) {
+					m.caughtUp[i] = nil
+					continue
+				}
+				m.caughtUp[i] = block.Hash()
+			}
+		}
 		err := dbIndexConnectBlock(dbTx, index, block, stxos, vblock)
 		if err != nil {
 			return err
@@ -489,9 +807,27 @@ func (m *Manager) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
 func (m *Manager) DisconnectBlock(dbTx database.Tx, block *asiutil.Block,
 	stxo []txo.SpentTxOut, vblock *asiutil.VBlock) error {
 
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
 	// Call each of the currently active optional indexes with the block
-	// being disconnected so they can update accordingly.
-	for _, index := range m.enabledIndexes {
+	// being disconnected so they can update accordingly.  The backfilled
+	// indexes whose tip is the disconnected block are disconnected it, and
+	// follow the main chain once the transaction is committed.
+	for i, index := range m.enabledIndexes {
+		if !m.live[i] {
+			tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, index.Key())
+			if err != nil {
+				return err
+			}
+			if !m.confirmCaughtUp(i, tipHash, tipHeight) {
+				if !tipHash.IsEqual(block.Hash()) {
+					m.caughtUp[i] = nil
+					continue
+				}
+				m.caughtUp[i] = &block.MsgBlock().Header.PrevBlock
+			}
+		}
 		err := dbIndexDisconnectBlock(dbTx, index, block, stxo, vblock)
 		if err != nil {
 			return err
@@ -508,5 +844,8 @@ func NewManager(db database.Transactor, enabledIndexes []blockchain.Indexer) *Ma
 	return &Manager{
 		db:             db,
 		enabledIndexes: enabledIndexes,
+		live:           make([]bool, len(enabledIndexes)),
+		caughtUp:       make([]*common.Hash, len(enabledIndexes)),
+		quit:           make(chan struct{}),
 	}
 }
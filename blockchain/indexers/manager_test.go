@@ -0,0 +1,411 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// backfillTestBlocks is the number of blocks of the chain the tests backfill.
+const backfillTestBlocks = 20
+
+// testIndex is an index counting the times each block is connected, which
+// runs a hook once a block is connected.
+type testIndex struct {
+	mtx       sync.Mutex
+	connected map[int32]int
+	onConnect func(height int32)
+}
+
+func newTestIndex() *testIndex {
+	return &testIndex{connected: make(map[int32]int)}
+}
+
+func (idx *testIndex) Key() []byte                   { return []byte("testidx") }
+func (idx *testIndex) Name() string                  { return "test index" }
+func (idx *testIndex) Init() error                   { return nil }
+func (idx *testIndex) Create(dbTx database.Tx) error { return nil }
+func (idx *testIndex) Check(dbTx database.Tx) error  { return nil }
+
+func (idx *testIndex) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
+	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
+
+	idx.mtx.Lock()
+	idx.connected[block.Height()]++
+	onConnect := idx.onConnect
+	idx.mtx.Unlock()
+	if onConnect != nil {
+		onConnect(block.Height())
+	}
+	return nil
+}
+
+func (idx *testIndex) DisconnectBlock(dbTx database.Tx, block *asiutil.Block,
+	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
+
+	idx.mtx.Lock()
+	idx.connected[block.Height()]--
+	idx.mtx.Unlock()
+	return nil
+}
+
+func (idx *testIndex) FetchBlockRegion([]byte) (*database.BlockRegion, error) {
+	return nil, nil
+}
+
+// checkConnected ensures the blocks up to the passed height, and only them,
+// were connected once to the index.
+func (idx *testIndex) checkConnected(t *testing.T, height int32) {
+	t.Helper()
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	for h := int32(0); h <= height; h++ {
+		if n := idx.connected[h]; n != 1 {
+			t.Errorf("block %d connected %d times", h, n)
+		}
+	}
+	for h, n := range idx.connected {
+		if h > height && n != 0 {
+			t.Errorf("block %d above height %d connected", h, height)
+		}
+	}
+}
+
+// newBackfillManager returns a new manager of the passed index with its tip
+// created, as Init does before backfilling the indexes far behind the main
+// chain.
+func newBackfillManager(t *testing.T, g *testutil.Generator, idx *testIndex) *Manager {
+	m := NewManager(g.DB(), []blockchain.Indexer{idx})
+	err := m.db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucketIfNotExists(indexTipsBucketName)
+		if err != nil {
+			return err
+		}
+		return m.maybeCreateIndexes(dbTx)
+	})
+	if err != nil {
+		t.Fatalf("maybeCreateIndexes: %v", err)
+	}
+	return m
+}
+
+// startBackfill starts the backfill of the indexes of the passed manager.
+func startBackfill(m *Manager, chain *blockchain.BlockChain) {
+	m.wg.Add(1)
+	go m.backfillHandler(chain)
+}
+
+// indexTipHeight returns the height of the tip of the passed index.
+func indexTipHeight(t *testing.T, m *Manager, idx *testIndex) int32 {
+	var height int32
+	err := m.db.View(func(dbTx database.Tx) error {
+		var err error
+		_, height, err = dbFetchIndexerTip(dbTx, idx.Key())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dbFetchIndexerTip: %v", err)
+	}
+	return height
+}
+
+// waitIndexTip waits for the tip of the passed index to reach the passed
+// height.
+func waitIndexTip(t *testing.T, m *Manager, idx *testIndex, height int32) {
+	deadline := time.Now().Add(10 * time.Second)
+	for indexTipHeight(t, m, idx) < height {
+		if time.Now().After(deadline) {
+			t.Fatalf("index tip at height %d, want %d",
+				indexTipHeight(t, m, idx), height)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connectBlock connects the main chain block at the passed height to the
+// indexes of the manager as the chain does.
+func connectBlock(t *testing.T, m *Manager, chain *blockchain.BlockChain, height int32) {
+	loaded := m.loadCatchUpBlock(chain, height, false)
+	if loaded.err != nil {
+		t.Fatalf("loadCatchUpBlock: %v", loaded.err)
+	}
+	err := m.db.Update(func(dbTx database.Tx) error {
+		return m.ConnectBlock(dbTx, loaded.block, nil, loaded.vblock)
+	})
+	if err != nil {
+		t.Fatalf("ConnectBlock: %v", err)
+	}
+}
+
+// interruptBackfill runs the backfill of the indexes of the passed manager
+// until it connected the block at the passed height to the index, where it is
+// interrupted as when the node shuts down.
+func interruptBackfill(t *testing.T, m *Manager, idx *testIndex,
+	chain *blockchain.BlockChain, height int32) {
+
+	interrupted := make(chan struct{})
+	idx.mtx.Lock()
+	idx.onConnect = func(h int32) {
+		if h == height {
+			m.stop.Do(func() { close(m.quit) })
+			close(interrupted)
+		}
+	}
+	idx.mtx.Unlock()
+	startBackfill(m, chain)
+	select {
+	case <-interrupted:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("backfill did not reach height %d", height)
+	}
+	m.Stop()
+
+	idx.mtx.Lock()
+	idx.onConnect = nil
+	idx.mtx.Unlock()
+}
+
+// TestBackfillInterrupted ensures a backfill interrupted in the middle of its
+// range leaves the index at the last block it connected.
+func TestBackfillInterrupted(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(backfillTestBlocks); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	const interruptHeight = backfillTestBlocks / 2
+	idx := newTestIndex()
+	m := newBackfillManager(t, g, idx)
+	interruptBackfill(t, m, idx, g.Chain(), interruptHeight)
+
+	if height := indexTipHeight(t, m, idx); height != interruptHeight {
+		t.Fatalf("index tip at height %d after the interruption, want %d",
+			height, interruptHeight)
+	}
+	idx.checkConnected(t, interruptHeight)
+}
+
+// TestBackfillResume ensures a backfill resumes from the tip of the index
+// left by an interrupted one without connecting a block twice, and that the
+// index follows the main chain once it reached its tip.
+func TestBackfillResume(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(backfillTestBlocks); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	const interruptHeight = backfillTestBlocks / 2
+	idx := newTestIndex()
+	m := newBackfillManager(t, g, idx)
+	interruptBackfill(t, m, idx, g.Chain(), interruptHeight)
+
+	// Resume the backfill with a new manager, as a restarted node does.
+	m = newBackfillManager(t, g, idx)
+	startBackfill(m, g.Chain())
+	defer m.Stop()
+	waitIndexTip(t, m, idx, backfillTestBlocks)
+	idx.checkConnected(t, backfillTestBlocks)
+
+	// The backfill ends once the chain connects the next block.
+	if _, err := g.Generate(1); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	connectBlock(t, m, g.Chain(), backfillTestBlocks+1)
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * backfillPollInterval):
+		t.Fatal("backfill not ended once the index followed the main chain")
+	}
+	if !m.live[0] {
+		t.Error("backfilled index not following the main chain")
+	}
+	idx.checkConnected(t, backfillTestBlocks+1)
+}
+
+// TestBackfillRollback ensures a backfilled index connected to the main chain
+// in a transaction which is rolled back does not follow the main chain, and
+// that it does once such a transaction is committed.
+func TestBackfillRollback(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(backfillTestBlocks); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	idx := newTestIndex()
+	m := newBackfillManager(t, g, idx)
+	startBackfill(m, g.Chain())
+	waitIndexTip(t, m, idx, backfillTestBlocks)
+	m.Stop()
+
+	if _, err := g.Generate(1); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	loaded := m.loadCatchUpBlock(g.Chain(), backfillTestBlocks+1, false)
+	if loaded.err != nil {
+		t.Fatalf("loadCatchUpBlock: %v", loaded.err)
+	}
+	errRollback := errors.New("rollback")
+	err = m.db.Update(func(dbTx database.Tx) error {
+		err := m.ConnectBlock(dbTx, loaded.block, nil, loaded.vblock)
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("Update: got %v, want %v", err, errRollback)
+	}
+	if m.live[0] {
+		t.Fatal("index following the main chain after a rolled back " +
+			"transaction")
+	}
+	// The test index does not store its entries in the database.
+	idx.mtx.Lock()
+	idx.connected[backfillTestBlocks+1]--
+	idx.mtx.Unlock()
+
+	connectBlock(t, m, g.Chain(), backfillTestBlocks+1)
+	if _, err := g.Generate(1); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	connectBlock(t, m, g.Chain(), backfillTestBlocks+2)
+	if !m.live[0] {
+		t.Error("backfilled index not following the main chain")
+	}
+	idx.checkConnected(t, backfillTestBlocks+2)
+}
+
+// prunedDB is a database whose transactions find none of the pruned blocks,
+// as once the node pruned them.
+type prunedDB struct {
+	database.Transactor
+	pruned map[common.Hash]struct{}
+}
+
+func (db *prunedDB) Begin(writable bool) (database.Tx, error) {
+	dbTx, err := db.Transactor.Begin(writable)
+	if err != nil {
+		return nil, err
+	}
+	return &prunedTx{dbTx, db.pruned}, nil
+}
+
+func (db *prunedDB) View(fn func(dbTx database.Tx) error) error {
+	return db.Transactor.View(func(dbTx database.Tx) error {
+		return fn(&prunedTx{dbTx, db.pruned})
+	})
+}
+
+func (db *prunedDB) Update(fn func(dbTx database.Tx) error) error {
+	return db.Transactor.Update(func(dbTx database.Tx) error {
+		return fn(&prunedTx{dbTx, db.pruned})
+	})
+}
+
+// prunedTx is a transaction of a prunedDB.
+type prunedTx struct {
+	database.Tx
+	pruned map[common.Hash]struct{}
+}
+
+func (tx *prunedTx) isPruned(key *database.BlockKey) bool {
+	var hash common.Hash
+	copy(hash[:], key[:common.HashLength])
+	_, ok := tx.pruned[hash]
+	return ok
+}
+
+func (tx *prunedTx) HasBlock(key *database.BlockKey) (bool, error) {
+	if tx.isPruned(key) {
+		return false, nil
+	}
+	return tx.Tx.HasBlock(key)
+}
+
+func (tx *prunedTx) FetchBlock(key *database.BlockKey) ([]byte, error) {
+	if tx.isPruned(key) {
+		return nil, database.Error{
+			ErrorCode:   database.ErrBlockNotFound,
+			Description: "block " + key.String() + " does not exist",
+		}
+	}
+	return tx.Tx.FetchBlock(key)
+}
+
+// TestInitPruned ensures the indexes behind the main chain are not caught up
+// from pruned blocks, whether the pruned blocks are found while catching up
+// or before.
+func TestInitPruned(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(backfillTestBlocks); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	// Prune the blocks after the genesis one up to the middle of the chain.
+	const prunedHeight = backfillTestBlocks / 2
+	db := &prunedDB{g.DB(), make(map[common.Hash]struct{})}
+	for height := int32(1); height <= prunedHeight; height++ {
+		hash, err := g.Chain().BlockHashByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockHashByHeight: %v", err)
+		}
+		db.pruned[*hash] = struct{}{}
+	}
+
+	// A new index connects the genesis block, then stops at the first
+	// pruned one.
+	idx := newTestIndex()
+	m := NewManager(db, []blockchain.Indexer{idx})
+	err = m.Init(g.Chain(), nil)
+	if err == nil || !strings.Contains(err.Error(), "pruned") {
+		t.Fatalf("Init = %v, want a pruned blocks error", err)
+	}
+	if height := indexTipHeight(t, m, idx); height != 0 {
+		t.Fatalf("index tip at height %d, want 0", height)
+	}
+
+	// Restarting the node with the index behind refuses before catching up.
+	m = NewManager(db, []blockchain.Indexer{idx})
+	err = m.Init(g.Chain(), nil)
+	if err == nil || !strings.Contains(err.Error(), "pruned") {
+		t.Fatalf("Init = %v, want a pruned blocks error", err)
+	}
+	if height := indexTipHeight(t, m, idx); height != 0 {
+		t.Fatalf("index tip at height %d, want 0", height)
+	}
+	idx.checkConnected(t, 0)
+}
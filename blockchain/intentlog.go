@@ -0,0 +1,266 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+)
+
+// The connection of a block writes to several stores: the receipts and the
+// state trie to the state database, the chain state and the indexes to the
+// metadata of the block database in a single transaction, and the utxo set
+// through the utxo cache.  An intent is recorded in the metadata before the
+// first write and removed by the transaction updating the chain state, which
+// is the commit point of the operation.  An intent found on start thus
+// belongs to an operation interrupted before its commit point, whose writes
+// are rolled back.  The writes after the commit point, those of the utxo
+// cache, are rolled forward by recoverUtxoSet.
+//
+// A reorganize disconnects and connects several blocks, each one being
+// committed on its own.  Its intent is recorded once its blocks are validated
+// and removed once they are all connected, or once one of them fails to be, so
+// a reorganize interrupted midway by an unclean shutdown is rolled forward to
+// its new best block on start.
+
+var (
+	// blockIntentKeyName is the name of the db key used to store the intent
+	// of the block being connected or disconnected.
+	blockIntentKeyName = []byte("blockintent")
+
+	// reorgIntentKeyName is the name of the db key used to store the intent
+	// of the reorganize in progress.
+	reorgIntentKeyName = []byte("reorgintent")
+)
+
+// intentOp identifies the operation of an intent.
+type intentOp byte
+
+// These constants define the operations of the intents.
+const (
+	intentConnect intentOp = iota + 1
+	intentDisconnect
+	intentReorganize
+)
+
+// String returns the operation in human-readable form.
+func (op intentOp) String() string {
+	switch op {
+	case intentConnect:
+		return "connection"
+	case intentDisconnect:
+		return "disconnection"
+	case intentReorganize:
+		return "reorganize"
+	}
+	return fmt.Sprintf("unknown operation %d", byte(op))
+}
+
+// chainIntentSize is the size of a serialized intent: the operation, the
+// hash and the height of its block and the hash of the best block before it.
+const chainIntentSize = 1 + common.HashLength + 4 + common.HashLength
+
+// chainIntent is an operation on the chain state in progress.
+type chainIntent struct {
+	op intentOp
+
+	// hash and height identify the block connected or disconnected, or the
+	// new best block of a reorganize.
+	hash   common.Hash
+	height int32
+
+	// prevHash is the hash of the best block before the operation.
+	prevHash common.Hash
+}
+
+// serializeChainIntent returns the serialization of the passed intent.
+func serializeChainIntent(intent *chainIntent) []byte {
+	serialized := make([]byte, chainIntentSize)
+	serialized[0] = byte(intent.op)
+	offset := 1
+	copy(serialized[offset:], intent.hash[:])
+	offset += common.HashLength
+	byteOrder.PutUint32(serialized[offset:], uint32(intent.height))
+	offset += 4
+	copy(serialized[offset:], intent.prevHash[:])
+	return serialized
+}
+
+// deserializeChainIntent decodes an intent from the passed serialization.
+func deserializeChainIntent(serialized []byte) (*chainIntent, error) {
+	if len(serialized) != chainIntentSize {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain intent",
+		}
+	}
+
+	intent := &chainIntent{op: intentOp(serialized[0])}
+	offset := 1
+	copy(intent.hash[:], serialized[offset:])
+	offset += common.HashLength
+	intent.height = int32(byteOrder.Uint32(serialized[offset:]))
+	offset += 4
+	copy(intent.prevHash[:], serialized[offset:])
+	return intent, nil
+}
+
+// dbPutChainIntent uses an existing database transaction to store the passed
+// intent under the passed key.
+func dbPutChainIntent(dbTx database.Tx, key []byte, intent *chainIntent) error {
+	return dbTx.Metadata().Put(key, serializeChainIntent(intent))
+}
+
+// dbFetchChainIntent uses an existing database transaction to fetch the
+// intent stored under the passed key.  A nil intent is returned when there is
+// none.
+func dbFetchChainIntent(dbTx database.Tx, key []byte) (*chainIntent, error) {
+	serialized := dbTx.Metadata().Get(key)
+	if serialized == nil {
+		return nil, nil
+	}
+	return deserializeChainIntent(serialized)
+}
+
+// dbRemoveChainIntent uses an existing database transaction to remove the
+// intent stored under the passed key.
+func dbRemoveChainIntent(dbTx database.Tx, key []byte) error {
+	return dbTx.Metadata().Delete(key)
+}
+
+// putChainIntent stores the passed intent under the passed key in its own
+// database transaction, so it is written before the operation starts.
+func (b *BlockChain) putChainIntent(key []byte, intent *chainIntent) error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		return dbPutChainIntent(dbTx, key, intent)
+	})
+}
+
+// rollbackBlockIntent rolls back the writes of the block connection or
+// disconnection interrupted by an unclean shutdown, if any.  The chain state
+// is left at the best block before the operation, as it was not committed.
+//
+// This function MUST be called after the chain state is loaded.
+func (b *BlockChain) rollbackBlockIntent() error {
+	var intent *chainIntent
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		intent, err = dbFetchChainIntent(dbTx, blockIntentKeyName)
+		return err
+	})
+	if err != nil || intent == nil {
+		return err
+	}
+
+	// The writes of the operation are left on a read-only database.  The
+	// chain state is still at the best block before the operation.
+	if b.readOnly {
+		log.Warnf("Not rolling back the %v of block %v (height %d) "+
+			"interrupted by an unclean shutdown of a read-only "+
+			"database", intent.op, intent.hash, intent.height)
+		return nil
+	}
+
+	tip := b.bestChain.Tip()
+	if intent.prevHash != tip.hash {
+		return database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("interrupted %v of block %v started "+
+				"at block %v which is not the best block %v", intent.op,
+				intent.hash, intent.prevHash, tip.hash),
+		}
+	}
+
+	switch intent.op {
+	case intentConnect:
+		// The receipts are written before the chain state.  They are
+		// written again when the block is connected.
+		rawdb.DeleteReceipts(b.ethDB, intent.hash, uint64(intent.height))
+
+	case intentDisconnect:
+		// The utxo cache is flushed at the block being disconnected,
+		// which is still the best block, so there is nothing to undo.
+
+	default:
+		return database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: fmt.Sprintf("chain intent of %v", intent.op),
+		}
+	}
+
+	log.Infof("Rolled back the %v of block %v (height %d) interrupted by "+
+		"an unclean shutdown", intent.op, intent.hash, intent.height)
+	return b.db.Update(func(dbTx database.Tx) error {
+		return dbRemoveChainIntent(dbTx, blockIntentKeyName)
+	})
+}
+
+// resumeReorganize rolls forward the reorganize interrupted by an unclean
+// shutdown, if any, when its new best block is still preferred to the best
+// block.  A failure to complete it is logged, the chain is then left at the
+// best block reached.
+//
+// This function MUST be called once the chain is fully initialized.
+func (b *BlockChain) resumeReorganize() error {
+	var intent *chainIntent
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		intent, err = dbFetchChainIntent(dbTx, reorgIntentKeyName)
+		return err
+	})
+	if err != nil || intent == nil {
+		return err
+	}
+
+	// The chain is left at the best block reached on a read-only database.
+	if b.readOnly {
+		log.Warnf("Not resuming the reorganize to block %v (height %d) "+
+			"interrupted by an unclean shutdown of a read-only "+
+			"database", intent.hash, intent.height)
+		return nil
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(&intent.hash)
+	switch {
+	case intent.op != intentReorganize:
+		return database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: fmt.Sprintf("reorganize intent of %v", intent.op),
+		}
+
+	case node == nil || b.bestChain.Contains(node):
+		// Nothing to resume.
+
+	case b.index.NodeStatus(node).KnownInvalid() || !b.preferChain(node):
+		log.Infof("Not resuming the reorganize to block %v (height %d) "+
+			"interrupted by an unclean shutdown, the block is no "+
+			"longer preferred", intent.hash, intent.height)
+
+	default:
+		log.Infof("Resuming the reorganize to block %v (height %d) "+
+			"interrupted by an unclean shutdown", intent.hash,
+			intent.height)
+		detachNodes, attachNodes := b.getReorganizeNodes(node)
+		err := b.reorganizeChain(detachNodes, attachNodes)
+		if writeErr := b.index.flushToDB(); writeErr != nil {
+			log.Warnf("Error flushing block index changes to disk: %v",
+				writeErr)
+		}
+		if err != nil {
+			log.Warnf("Unable to resume the reorganize to block %v: %v",
+				intent.hash, err)
+		}
+	}
+
+	return b.db.Update(func(dbTx database.Tx) error {
+		return dbRemoveChainIntent(dbTx, reorgIntentKeyName)
+	})
+}
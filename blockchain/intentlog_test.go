@@ -0,0 +1,246 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+)
+
+// TestChainIntentSerialization ensures the intents round trip through their
+// serialization and corrupt ones are detected.
+func TestChainIntentSerialization(t *testing.T) {
+	intent := &chainIntent{
+		op:       intentReorganize,
+		hash:     common.Hash{0x01, 0x02},
+		height:   1234,
+		prevHash: common.Hash{0x03},
+	}
+	serialized := serializeChainIntent(intent)
+	got, err := deserializeChainIntent(serialized)
+	if err != nil {
+		t.Fatalf("deserializeChainIntent: %v", err)
+	}
+	if !reflect.DeepEqual(got, intent) {
+		t.Errorf("deserialized intent %+v, want %+v", got, intent)
+	}
+
+	_, err = deserializeChainIntent(serialized[1:])
+	if dbErr, ok := err.(database.Error); !ok || dbErr.ErrorCode != database.ErrCorruption {
+		t.Errorf("truncated intent error %v, want a corruption", err)
+	}
+}
+
+// TestChainIntents ensures the intents are removed by the operations once
+// committed, and that an interrupted connection is rolled back.
+func TestChainIntents(t *testing.T) {
+	parivateKeyList := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e", //privateKey0
+	}
+	accList, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(parivateKeyList, 10)
+	if err != nil || chain == nil {
+		t.Fatalf("createFakeChainByPrivateKeys error %v", err)
+	}
+	defer teardownFunc()
+
+	fetchIntent := func(key []byte) *chainIntent {
+		var intent *chainIntent
+		err := chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			intent, err = dbFetchChainIntent(dbTx, key)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("dbFetchChainIntent: %v", err)
+		}
+		return intent
+	}
+
+	validators, filters, _ := chain.GetValidatorsByNode(1, chain.bestChain.tip())
+	var block *asiutil.Block
+	block, _, err = createAndSignBlock(netParam, accList, validators, filters, chain, uint32(1), uint16(0),
+		chain.bestChain.Tip().height, protos.Asset{}, 0,
+		validators[0], nil, 0, chain.bestChain.tip())
+	if err != nil {
+		t.Fatalf("create block error %v", err)
+	}
+	if _, _, err = chain.ProcessBlock(block, nil, nil, nil, common.BFNone); err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	if intent := fetchIntent(blockIntentKeyName); intent != nil {
+		t.Errorf("intent %+v left after connecting a block", intent)
+	}
+
+	// Simulate a connection interrupted after writing the receipts.
+	tip := chain.bestChain.Tip()
+	interrupted := chainIntent{
+		op:       intentConnect,
+		hash:     common.Hash{0x01},
+		height:   tip.height + 1,
+		prevHash: tip.hash,
+	}
+	if err := chain.putChainIntent(blockIntentKeyName, &interrupted); err != nil {
+		t.Fatalf("putChainIntent: %v", err)
+	}
+	rawdb.WriteReceipts(chain.ethDB, interrupted.hash,
+		uint64(interrupted.height), types.Receipts{})
+	if err := chain.rollbackBlockIntent(); err != nil {
+		t.Fatalf("rollbackBlockIntent: %v", err)
+	}
+	if rawdb.ReadReceipts(chain.ethDB, interrupted.hash, uint64(interrupted.height)) != nil {
+		t.Error("receipts of the interrupted connection not rolled back")
+	}
+	if intent := fetchIntent(blockIntentKeyName); intent != nil {
+		t.Errorf("intent %+v left after the rollback", intent)
+	}
+	if chain.bestChain.Tip() != tip {
+		t.Error("best chain changed by the rollback")
+	}
+
+	// An intent started from another block than the best one is corrupt.
+	interrupted.prevHash = common.Hash{0x02}
+	if err := chain.putChainIntent(blockIntentKeyName, &interrupted); err != nil {
+		t.Fatalf("putChainIntent: %v", err)
+	}
+	if err := chain.rollbackBlockIntent(); err == nil {
+		t.Error("intent not started from the best block accepted")
+	}
+
+	// A reorganize to an unknown block is dropped.
+	reorg := chainIntent{
+		op:       intentReorganize,
+		hash:     common.Hash{0x03},
+		height:   tip.height + 1,
+		prevHash: tip.hash,
+	}
+	if err := chain.putChainIntent(reorgIntentKeyName, &reorg); err != nil {
+		t.Fatalf("putChainIntent: %v", err)
+	}
+	if err := chain.resumeReorganize(); err != nil {
+		t.Fatalf("resumeReorganize: %v", err)
+	}
+	if intent := fetchIntent(reorgIntentKeyName); intent != nil {
+		t.Errorf("intent %+v left after resuming the reorganize", intent)
+	}
+	if chain.bestChain.Tip() != tip {
+		t.Error("best chain changed resuming the reorganize")
+	}
+}
+
+// failingDB is a database failing the first update made while the intent of a
+// reorganize is stored, as once the disk is full.
+type failingDB struct {
+	database.Transactor
+	failed bool
+}
+
+func (db *failingDB) Update(fn func(database.Tx) error) error {
+	if !db.failed {
+		var intent *chainIntent
+		err := db.View(func(dbTx database.Tx) error {
+			var err error
+			intent, err = dbFetchChainIntent(dbTx, reorgIntentKeyName)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if intent != nil {
+			db.failed = true
+			return errors.New("update failed")
+		}
+	}
+	return db.Transactor.Update(fn)
+}
+
+// TestFailedReorganize ensures a reorganize failing midway removes its intent,
+// so it is not rolled forward on start.
+func TestFailedReorganize(t *testing.T) {
+	parivateKeyList := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e", //privateKey0
+		"0xd07f68f78fc58e3dc8ea72ff69784aa9542c452a4ee66b2665fa3cccb48441c2", //privateKey1
+		"0x77366e621236e71a77236e0858cd652e92c3af0908527b5bd1542992c4d7cace", //privateKey2
+	}
+	accList, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(parivateKeyList, 3)
+	if err != nil || chain == nil {
+		t.Fatalf("createFakeChainByPrivateKeys error %v", err)
+	}
+	defer teardownFunc()
+
+	// Extend the main chain by two blocks and a side chain from the
+	// genesis block by three blocks.
+	genesisNode, _ := chain.GetNodeByHeight(0)
+	validators, filters, _ := chain.GetValidatorsByNode(1, chain.bestChain.tip())
+	for i := uint16(0); i < 2; i++ {
+		block, _, err := createAndSignBlock(netParam, accList, validators, filters, chain, 1, i,
+			chain.bestChain.Tip().height, protos.Asset{}, 0,
+			validators[i], nil, 0, chain.bestChain.tip())
+		if err != nil {
+			t.Fatalf("create block error %v", err)
+		}
+		if _, _, err = chain.ProcessBlock(block, nil, nil, nil, common.BFNone); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+	tip := chain.bestChain.Tip()
+	sideNode := genesisNode
+	for i := uint16(0); i < 3; i++ {
+		block, node, err := createAndSignBlock(netParam, accList, validators, filters, chain, 1, i,
+			int32(i), protos.Asset{}, 0, validators[i], nil, int32(i+1), sideNode)
+		if err != nil {
+			t.Fatalf("create block error %v", err)
+		}
+		block.MsgBlock().Header.PrevBlock = sideNode.hash
+		sideNode = node
+		chain.index.AddNode(node)
+		err = chain.db.Update(func(dbTx database.Tx) error {
+			return dbStoreBlock(dbTx, block)
+		})
+		if err != nil {
+			t.Fatalf("dbStoreBlock: %v", err)
+		}
+	}
+	if !chain.preferChain(sideNode) {
+		t.Fatal("side chain not preferred to the main chain")
+	}
+
+	// Fail the first block disconnected by the reorganize.
+	db := chain.db
+	chain.db = &failingDB{Transactor: db}
+	detachNodes, attachNodes := chain.getReorganizeNodes(sideNode)
+	chain.chainLock.Lock()
+	err = chain.reorganizeChain(detachNodes, attachNodes)
+	chain.chainLock.Unlock()
+	chain.db = db
+	if err == nil {
+		t.Fatal("reorganizeChain succeeded with a failing database")
+	}
+	err = chain.db.View(func(dbTx database.Tx) error {
+		intent, err := dbFetchChainIntent(dbTx, reorgIntentKeyName)
+		if intent != nil {
+			t.Errorf("intent %+v left after the failed reorganize", intent)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dbFetchChainIntent: %v", err)
+	}
+
+	// The failed reorganize is not rolled forward on start.
+	if err := chain.resumeReorganize(); err != nil {
+		t.Fatalf("resumeReorganize: %v", err)
+	}
+	if chain.bestChain.Tip() != tip {
+		t.Error("failed reorganize rolled forward on start")
+	}
+}
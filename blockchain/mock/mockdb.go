@@ -48,6 +48,10 @@ func (m *MockTx) FetchBlockRegions(regions []database.BlockRegion) ([][]byte, er
 	return nil, nil
 }
 
+func (m *MockTx) PruneBlocks(targetSize uint64, keep *database.BlockKey) ([]database.BlockKey, error) {
+	return nil, nil
+}
+
 func (m *MockTx) Metadata() database.Bucket {
 	return m.metadata
 }
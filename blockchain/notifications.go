@@ -29,6 +29,10 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTAcceptanceResumed indicates the chain accepts new blocks again
+	// after the acceptance was paused.  It carries no data.
+	NTAcceptanceResumed
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -37,6 +41,7 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTAcceptanceResumed: "NTAcceptanceResumed",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -53,6 +58,7 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *asiutil.Block
 // 	- NTBlockConnected:    *asiutil.Block
 // 	- NTBlockDisconnected: [*asiutil.Block, *asiutil.VBlock]
+// 	- NTAcceptanceResumed: nil
 type Notification struct {
 	Type NotificationType
 	Data interface{}
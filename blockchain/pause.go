@@ -0,0 +1,58 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+)
+
+// ErrAcceptancePaused is returned by ProcessBlock while the acceptance of new
+// blocks is paused.  It is not a rule error since the block itself may be
+// perfectly valid.
+var ErrAcceptancePaused = errors.New("block acceptance is paused")
+
+// PauseAcceptance stops the chain from accepting new blocks until
+// ResumeAcceptance is called.  The passed reason is reported by
+// AcceptancePaused.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PauseAcceptance(reason string) {
+	b.pauseLock.Lock()
+	if b.pauseReason == "" {
+		log.Warnf("Pausing block acceptance: %s", reason)
+	}
+	b.pauseReason = reason
+	b.pauseLock.Unlock()
+}
+
+// ResumeAcceptance resumes the acceptance of new blocks after it was paused
+// by PauseAcceptance.  An NTAcceptanceResumed notification is sent when the
+// acceptance was paused, so the blocks refused meanwhile are requested again.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ResumeAcceptance() {
+	b.pauseLock.Lock()
+	paused := b.pauseReason != ""
+	if paused {
+		log.Infof("Resuming block acceptance")
+	}
+	b.pauseReason = ""
+	b.pauseLock.Unlock()
+
+	if paused {
+		b.sendNotification(NTAcceptanceResumed, nil)
+	}
+}
+
+// AcceptancePaused returns whether the acceptance of new blocks is paused
+// along with the reason it was paused for.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AcceptancePaused() (bool, string) {
+	b.pauseLock.RLock()
+	reason := b.pauseReason
+	b.pauseLock.RUnlock()
+	return reason != "", reason
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestAcceptancePaused ensures blocks are refused while the acceptance is
+// paused and the pause reason is reported.
+func TestAcceptancePaused(t *testing.T) {
+	chain := &BlockChain{}
+	if paused, _ := chain.AcceptancePaused(); paused {
+		t.Fatal("new chain should not be paused")
+	}
+
+	chain.PauseAcceptance("disk full")
+	paused, reason := chain.AcceptancePaused()
+	if !paused || reason != "disk full" {
+		t.Fatalf("AcceptancePaused: got (%v, %q), want (true, %q)",
+			paused, reason, "disk full")
+	}
+	_, _, err := chain.ProcessBlock(nil, nil, nil, nil, common.BFNone)
+	if err != ErrAcceptancePaused {
+		t.Fatalf("ProcessBlock: got error %v, want %v", err, ErrAcceptancePaused)
+	}
+
+	var resumed int
+	chain.Subscribe(func(n *Notification) {
+		if n.Type == NTAcceptanceResumed {
+			resumed++
+		}
+	})
+	chain.ResumeAcceptance()
+	if paused, _ := chain.AcceptancePaused(); paused {
+		t.Fatal("chain should not be paused after resume")
+	}
+
+	// Only resuming a paused acceptance is notified.
+	chain.ResumeAcceptance()
+	if resumed != 1 {
+		t.Fatalf("got %d resume notifications, want 1", resumed)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+)
+
+// penaltiesKeyName is the name of the db key used to store the penalties
+// applied to validators, so they survive restarts.
+var penaltiesKeyName = []byte("validatorpenalties")
+
+// equivocationRounds is the number of rounds the blocks are remembered for
+// to detect validators producing two blocks for the same slot.
+const equivocationRounds = 16
+
+// PenaltyMode is how the blocks of a penalized validator are treated by the
+// fork choice.
+type PenaltyMode string
+
+// These constants define the penalty modes.
+const (
+	// PenaltyNone applies no penalty.
+	PenaltyNone PenaltyMode = "none"
+
+	// PenaltyDeprioritize does not count the weight of the blocks of the
+	// validator when choosing between competing chains.  Its blocks are
+	// still accepted on top of the best chain.
+	PenaltyDeprioritize PenaltyMode = "deprioritize"
+
+	// PenaltyReject rejects the new blocks of the validator.
+	PenaltyReject PenaltyMode = "reject"
+)
+
+// EvidenceKind is the kind of misbehavior a validator is penalized for.
+type EvidenceKind string
+
+// These constants define the kinds of evidence.
+const (
+	// EvidenceEquivocation is two signed blocks of the validator for the
+	// same round and slot.
+	EvidenceEquivocation EvidenceKind = "equivocation"
+
+	// EvidenceInvalidBlock is a signed block of the validator which broke
+	// the consensus rules.
+	EvidenceInvalidBlock EvidenceKind = "invalidblock"
+)
+
+// PenaltyRules are the penalties applied for each kind of evidence, and the
+// number of rounds following the evidence they last.  The penalties last
+// until they are cleared when Rounds is zero.
+type PenaltyRules struct {
+	Equivocation PenaltyMode
+	InvalidBlock PenaltyMode
+	Rounds       uint32
+}
+
+// mode returns the penalty mode of the passed kind of evidence.
+func (r *PenaltyRules) mode(kind EvidenceKind) PenaltyMode {
+	var mode PenaltyMode
+	switch kind {
+	case EvidenceEquivocation:
+		mode = r.Equivocation
+	case EvidenceInvalidBlock:
+		mode = r.InvalidBlock
+	}
+	if mode == "" {
+		return PenaltyNone
+	}
+	return mode
+}
+
+// ValidatorPenalty is a penalty applied to a validator from the round of the
+// evidence until the Expires round included, or until it is cleared when
+// Expires is zero.  Blocks are the hashes of the blocks making the evidence.
+type ValidatorPenalty struct {
+	Validator common.Address `json:"validator"`
+	Kind      EvidenceKind   `json:"kind"`
+	Mode      PenaltyMode    `json:"mode"`
+	Round     uint32         `json:"round"`
+	Expires   uint32         `json:"expires"`
+	Blocks    []common.Hash  `json:"blocks"`
+	Reason    string         `json:"reason"`
+	Time      int64          `json:"time"`
+}
+
+// applies returns whether the penalty applies to a block of the passed round.
+func (p *ValidatorPenalty) applies(round uint32) bool {
+	return round >= p.Round && (p.Expires == 0 || round <= p.Expires)
+}
+
+// penaltySlot identifies the slot of a round.
+type penaltySlot struct {
+	round uint32
+	slot  uint16
+}
+
+// loadPenalties restores the penalties stored in the database.
+func (b *BlockChain) loadPenalties() error {
+	b.penalties = make(map[common.Address]*ValidatorPenalty)
+	return b.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(penaltiesKeyName)
+		if serialized == nil {
+			return nil
+		}
+		var penalties []*ValidatorPenalty
+		if err := json.Unmarshal(serialized, &penalties); err != nil {
+			return fmt.Errorf("corrupt validator penalties: %v", err)
+		}
+		for _, p := range penalties {
+			b.penalties[p.Validator] = p
+		}
+		if len(penalties) > 0 {
+			log.Infof("Loaded the penalties of %d validators", len(penalties))
+		}
+		return nil
+	})
+}
+
+// storePenalties writes the penalties to the database.
+//
+// This function MUST be called with the penalty lock held (for writes).
+func (b *BlockChain) storePenalties() error {
+	penalties := b.sortedPenalties()
+	return b.db.Update(func(dbTx database.Tx) error {
+		if len(penalties) == 0 {
+			return dbTx.Metadata().Delete(penaltiesKeyName)
+		}
+		serialized, err := json.Marshal(penalties)
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Put(penaltiesKeyName, serialized)
+	})
+}
+
+// sortedPenalties returns copies of the penalties sorted by validator.
+//
+// This function MUST be called with the penalty lock held (for reads).
+func (b *BlockChain) sortedPenalties() []*ValidatorPenalty {
+	penalties := make([]*ValidatorPenalty, 0, len(b.penalties))
+	for _, p := range b.penalties {
+		penalty := *p
+		penalties = append(penalties, &penalty)
+	}
+	sort.Slice(penalties, func(i, j int) bool {
+		return penalties[i].Validator.Hex() < penalties[j].Validator.Hex()
+	})
+	return penalties
+}
+
+// recordEvidence penalizes the validator of the passed evidence according to
+// the penalty rules.  A penalty already applied to the validator is only
+// replaced by a stricter or longer one.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) recordEvidence(validator common.Address, kind EvidenceKind,
+	round uint32, blocks []common.Hash, reason string) {
+
+	mode := b.penaltyRules.mode(kind)
+	if mode == PenaltyNone {
+		log.Warnf("Validator %s misbehaved in round %d: %s", validator.String(),
+			round, reason)
+		return
+	}
+
+	b.penaltyLock.Lock()
+	defer b.penaltyLock.Unlock()
+	if p, ok := b.penalties[validator]; ok && (p.Mode == PenaltyReject || mode == p.Mode) &&
+		(p.Expires == 0 || p.Expires >= round+b.penaltyRules.Rounds) {
+		return
+	}
+	p := &ValidatorPenalty{
+		Validator: validator,
+		Kind:      kind,
+		Mode:      mode,
+		Round:     round,
+		Blocks:    blocks,
+		Reason:    reason,
+		Time:      time.Now().Unix(),
+	}
+	if b.penaltyRules.Rounds > 0 {
+		p.Expires = round + b.penaltyRules.Rounds
+	}
+	log.Warnf("Penalizing validator %s with mode %s from round %d: %s",
+		validator.String(), mode, round, reason)
+	b.penalties[validator] = p
+	if err := b.storePenalties(); err != nil {
+		log.Errorf("Unable to store the validator penalties: %v", err)
+	}
+}
+
+// checkEquivocation records the evidence of an equivocation when the
+// validator of the passed node already produced another block for its slot.
+// The signature of the block of the node must have been checked.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkEquivocation(node *blockNode) {
+	key := penaltySlot{round: node.round.Round, slot: node.slot}
+	other, ok := b.slotBlocks[key]
+	if !ok {
+		b.slotBlocks[key] = node
+		for k := range b.slotBlocks {
+			if k.round+equivocationRounds < node.round.Round {
+				delete(b.slotBlocks, k)
+			}
+		}
+		return
+	}
+	if other.hash == node.hash || other.coinbase != node.coinbase {
+		return
+	}
+	b.recordEvidence(node.coinbase, EvidenceEquivocation, node.round.Round,
+		[]common.Hash{other.hash, node.hash},
+		fmt.Sprintf("blocks %v and %v for slot %d of round %d", other.hash,
+			node.hash, node.slot, node.round.Round))
+}
+
+// recordInvalidBlock records the evidence of an invalid block.  The evidence
+// is only recorded when the block is signed by its validator, so nobody can
+// make a validator be penalized for a block it did not produce.
+func (b *BlockChain) recordInvalidBlock(node *blockNode, block *asiutil.Block, reason error) {
+	header := &block.MsgBlock().Header
+	if err := b.engine.VerifySeal(header); err != nil {
+		return
+	}
+	b.recordEvidence(node.coinbase, EvidenceInvalidBlock, node.round.Round,
+		[]common.Hash{node.hash}, fmt.Sprintf("invalid block %v at height %d: %v",
+			node.hash, node.height, reason))
+}
+
+// penaltyMode returns the mode of the penalty applied to the blocks of the
+// passed validator in the passed round.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) penaltyMode(validator common.Address, round uint32) PenaltyMode {
+	b.penaltyLock.RLock()
+	defer b.penaltyLock.RUnlock()
+	if p, ok := b.penalties[validator]; ok && p.applies(round) {
+		return p.Mode
+	}
+	return PenaltyNone
+}
+
+// checkPenalty rejects the blocks of the validators penalized with the reject
+// mode.
+func (b *BlockChain) checkPenalty(validator common.Address, round uint32) error {
+	if b.penaltyMode(validator, round) != PenaltyReject {
+		return nil
+	}
+	str := fmt.Sprintf("validator %s is penalized for round %d", validator.String(), round)
+	return ruleError(ErrPenalizedValidator, str)
+}
+
+// preferChain returns whether the chain ending with the passed node should
+// replace the best chain.  The weight of the blocks of the penalized
+// validators is not counted from the fork point of both chains, which leaves
+// the choice on weight unchanged while no validator is penalized.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) preferChain(node *blockNode) bool {
+	tip := b.bestChain.Tip()
+	b.penaltyLock.RLock()
+	penalized := len(b.penalties) > 0
+	b.penaltyLock.RUnlock()
+	if !penalized {
+		return node.weight > tip.weight
+	}
+
+	fork := b.bestChain.FindFork(node)
+	return b.branchWeight(node, fork) > b.branchWeight(tip, fork)
+}
+
+// branchWeight returns the weight of the blocks from the passed fork point,
+// excluded, to the passed node, leaving out the blocks of the penalized
+// validators.
+func (b *BlockChain) branchWeight(node, fork *blockNode) uint64 {
+	var weight uint64
+	for ; node != nil && node != fork; node = node.parent {
+		if b.penaltyMode(node.coinbase, node.round.Round) != PenaltyNone {
+			continue
+		}
+		weight += node.weight
+		if node.parent != nil {
+			weight -= node.parent.weight
+		}
+	}
+	return weight
+}
+
+// ValidatorPenalties returns the penalties applied to validators, sorted by
+// validator.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ValidatorPenalties() []*ValidatorPenalty {
+	b.penaltyLock.RLock()
+	defer b.penaltyLock.RUnlock()
+	return b.sortedPenalties()
+}
+
+// ClearValidatorPenalty lifts the penalty applied to the passed validator.
+// It returns whether the validator was penalized.  Blocks rejected while the
+// penalty applied are not reconsidered until they are received again.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ClearValidatorPenalty(validator common.Address) (bool, error) {
+	b.penaltyLock.Lock()
+	defer b.penaltyLock.Unlock()
+	p, ok := b.penalties[validator]
+	if !ok {
+		return false, nil
+	}
+	delete(b.penalties, validator)
+	if err := b.storePenalties(); err != nil {
+		b.penalties[validator] = p
+		return false, err
+	}
+	log.Infof("Cleared the penalty of validator %s", validator.String())
+	return true, nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestValidatorPenalties ensures equivocations are recorded as penalties
+// which survive restarts, change the fork choice or reject blocks according
+// to their mode, and can be cleared.
+func TestValidatorPenalties(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure, the validator of 3 and 3a equivocating.
+	// 	genesis -> 1 -> 2 -> 3
+	// 	            \-> 2a -> 3a -> 4a
+	chain, teardownFunc, err := newFakeChain(&chaincfg.DevelopNetParams)
+	if err != nil || chain == nil {
+		t.Fatalf("newFakeChain error %v", err)
+	}
+	defer teardownFunc()
+
+	honest := common.Address{0x01}
+	faulty := common.Address{0x02}
+	mainNodes := chainedNodes(chain.bestChain.Genesis(), 3, 0)
+	sideNodes := chainedNodes(mainNodes[0], 3, 0)
+	for i, node := range mainNodes {
+		node.weight = uint64(i + 1)
+		node.coinbase = honest
+		node.slot = uint16(i)
+		chain.index.AddNode(node)
+	}
+	for i, node := range sideNodes {
+		node.weight = uint64(i + 2)
+		node.coinbase = faulty
+		node.slot = uint16(i + 3)
+		chain.index.AddNode(node)
+	}
+	mainNodes[2].coinbase = faulty
+	sideNodes[0].coinbase = honest
+	sideNodes[1].slot = mainNodes[2].slot
+	chain.bestChain.SetTip(tstTip(mainNodes))
+
+	side := tstTip(sideNodes)
+	if !chain.preferChain(side) {
+		t.Fatal("heavier chain not preferred without penalties")
+	}
+
+	chain.penaltyRules = PenaltyRules{Equivocation: PenaltyDeprioritize}
+	for _, node := range append(mainNodes, sideNodes[0], sideNodes[2]) {
+		chain.checkEquivocation(node)
+	}
+	if penalties := chain.ValidatorPenalties(); len(penalties) != 0 {
+		t.Fatalf("penalties recorded without equivocation: %v", penalties)
+	}
+	chain.checkEquivocation(sideNodes[1])
+
+	penalties := chain.ValidatorPenalties()
+	if len(penalties) != 1 || penalties[0].Validator != faulty ||
+		penalties[0].Kind != EvidenceEquivocation || penalties[0].Mode != PenaltyDeprioritize ||
+		len(penalties[0].Blocks) != 2 || penalties[0].Expires != 0 {
+		t.Fatalf("unexpected penalties %+v", penalties)
+	}
+	if chain.preferChain(side) {
+		t.Fatal("chain of a penalized validator preferred")
+	}
+	if err := chain.checkPenalty(faulty, 1); err != nil {
+		t.Fatalf("block of a deprioritized validator rejected: %v", err)
+	}
+
+	// The penalties are restored from the database.
+	chain.penalties = nil
+	if err := chain.loadPenalties(); err != nil {
+		t.Fatalf("loadPenalties: %v", err)
+	}
+	if len(chain.ValidatorPenalties()) != 1 {
+		t.Fatal("penalties not restored")
+	}
+
+	// A stricter penalty replaces the applied one.
+	chain.penaltyRules = PenaltyRules{InvalidBlock: PenaltyReject, Rounds: 2}
+	chain.recordEvidence(faulty, EvidenceInvalidBlock, 1, nil, "bad block")
+	if err := chain.checkPenalty(faulty, 3); !isRuleError(err, ErrPenalizedValidator) {
+		t.Fatalf("block of a rejected validator accepted: %v", err)
+	}
+	if err := chain.checkPenalty(faulty, 4); err != nil {
+		t.Fatalf("block accepted after the penalty expired: %v", err)
+	}
+	if err := chain.checkPenalty(honest, 1); err != nil {
+		t.Fatalf("block of an honest validator rejected: %v", err)
+	}
+
+	cleared, err := chain.ClearValidatorPenalty(faulty)
+	if err != nil || !cleared {
+		t.Fatalf("ClearValidatorPenalty: %v, %v", cleared, err)
+	}
+	if cleared, _ := chain.ClearValidatorPenalty(faulty); cleared {
+		t.Fatal("penalty cleared twice")
+	}
+	if !chain.preferChain(side) {
+		t.Fatal("heavier chain not preferred once the penalty is cleared")
+	}
+	if err := chain.loadPenalties(); err != nil || len(chain.penalties) != 0 {
+		t.Fatalf("cleared penalty restored: %v", err)
+	}
+}
+
+// isRuleError returns whether the passed error is a rule error with the
+// passed code.
+func isRuleError(err error, code ErrorCode) bool {
+	rerr, ok := err.(RuleError)
+	return ok && rerr.ErrorCode == code
+}
@@ -9,11 +9,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/tracing"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+	"time"
 )
 
 // blockExists determines whether a block with the given hash exists either in
@@ -99,7 +102,8 @@ func (b *BlockChain) processOrphans(hash *common.Hash, flags common.BehaviorFlag
 			i--
 
 			// Potentially accept the block into the block chain.
-			_, err := b.maybeAcceptBlock(orphan.block, nil, nil, nil, flags)
+			_, err := b.maybeAcceptBlock(orphan.block, nil, nil, nil,
+				orphan.arrival, flags)
 			if err != nil {
 				return err
 			}
@@ -165,6 +169,28 @@ func (b *BlockChain) GetNodeByRoundSlot(round uint32, slot uint16) *blockNode {
 	return nil
 }
 
+// SlotTime returns the time scheduled for the passed slot of the passed
+// round, which may not be before the round of the tip of the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SlotTime(round uint32, slot uint16) (int64, error) {
+	r := b.bestChain.Tip().round
+	if round < r.Round {
+		str := fmt.Sprintf("round %d is before the round %d of the tip",
+			round, r.Round)
+		return 0, errNotInMainChain(str)
+	}
+	for r.Round < round {
+		next, err := b.roundManager.GetNextRound(r)
+		if err != nil {
+			return 0, err
+		}
+		r = next
+	}
+	return r.RoundStartUnix + r.Duration*int64(slot)/
+		int64(chaincfg.ActiveNetParams.RoundSize), nil
+}
+
 // ProcessBlock is the main workhorse for handling insertion of new blocks into
 // the block chain.  It includes functionality such as rejecting duplicate
 // blocks, ensuring blocks follow all rules, orphan handling, and insertion into
@@ -177,10 +203,36 @@ func (b *BlockChain) GetNodeByRoundSlot(round uint32, slot uint16) *blockNode {
 // This function is safe for concurrent access.
 func (b *BlockChain) ProcessBlock(block *asiutil.Block, vblock *asiutil.VBlock,
 	receipts types.Receipts, logs []*types.Log,
-	flags common.BehaviorFlags) (bool, bool, error) {
+	flags common.BehaviorFlags) (mainChain bool, orphan bool, err error) {
+	arrival := time.Now()
 	b.chainLock.Lock()
 	defer b.chainLock.Unlock()
 
+	span := tracing.StartSpan("blockchain.ProcessBlock", nil)
+	if span.Sampled() {
+		span.SetAttr("block.height", block.Height())
+		span.SetAttr("block.hash", block.Hash().String())
+		span.SetAttr("block.txs", len(block.Transactions()))
+	}
+	b.traceSpan = span
+	defer func() {
+		b.traceSpan = nil
+		span.SetAttr("block.mainchain", mainChain)
+		span.SetAttr("block.orphan", orphan)
+		span.SetError(err)
+		span.End()
+	}()
+
+	if b.readOnly {
+		return false, false, ErrReadOnly
+	}
+
+	// Refuse new blocks while acceptance is paused rather than risk a
+	// partially written block, e.g. when the disk is full.
+	if paused, _ := b.AcceptancePaused(); paused {
+		return false, false, ErrAcceptancePaused
+	}
+
 	blockHash := block.Hash()
 
 	// The block must not already exist in the main chain or side chains.
@@ -243,13 +295,14 @@ func (b *BlockChain) ProcessBlock(block *asiutil.Block, vblock *asiutil.VBlock,
 	}
 	if !prevHashExists {
 		log.Infof("Adding orphan block(%d) %v with parent %v", blockHeader.Height, blockHash, prevHash)
-		b.addOrphanBlock(block)
+		b.addOrphanBlock(block, arrival)
 		return false, true, nil
 	}
 
 	// The block has passed all context independent checks and appears sane
 	// enough to potentially accept it into the block chain.
-	isMainChain, err := b.maybeAcceptBlock(block, vblock, receipts, logs, flags)
+	isMainChain, err := b.maybeAcceptBlock(block, vblock, receipts, logs,
+		arrival, flags)
 	if err != nil {
 		log.Debugf("Reject block %d %v with parent %v %v", blockHeader.Height, blockHash, prevHash, err)
 		return false, false, err
@@ -257,8 +310,9 @@ func (b *BlockChain) ProcessBlock(block *asiutil.Block, vblock *asiutil.VBlock,
 
 	// Accept any orphan blocks that depend on this block (they are
 	// no longer orphans) and repeat for those accepted blocks until
-	// there are no more.
-	err = b.processOrphans(blockHash, flags)
+	// there are no more.  The orphans are not known to be ancestors of
+	// the block assumed valid.
+	err = b.processOrphans(blockHash, flags&^common.BFAssumeValid)
 	if err != nil {
 		log.Debugf("processOrphans %d %v with parent %v %v", blockHeader.Height, blockHash, prevHash, err)
 		return false, false, err
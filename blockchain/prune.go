@@ -0,0 +1,44 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+)
+
+// pruneBlocks deletes the oldest blocks while the stored blocks exceed the
+// prune target, along with the spend journal entries of the deleted blocks of
+// the main chain.  The blocks of the last pruneDepth blocks below the passed
+// best block are kept, so a reorganize detaching them can still be processed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) pruneBlocks(dbTx database.Tx, node *blockNode) error {
+	if b.pruneTarget == 0 || node.height <= b.pruneDepth {
+		return nil
+	}
+
+	keep := node.Ancestor(node.height - b.pruneDepth)
+	keys, err := dbTx.PruneBlocks(b.pruneTarget,
+		database.NewNormalBlockKey(&keep.hash))
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for i := range keys {
+		if keys[i].IsVirtual() {
+			continue
+		}
+		hash := common.BytesToHash(keys[i][:common.HashLength])
+		if err := dbRemoveSpendJournalEntry(dbTx, &hash); err != nil {
+			return err
+		}
+	}
+	log.Infof("Pruned %d blocks below height %d", len(keys), keep.height)
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+	"github.com/AsimovNetwork/asimov/vm/fvm/rlp"
+	"github.com/AsimovNetwork/asimov/vm/fvm/trie"
+)
+
+// emptyCodeHash is the code hash of the accounts without code.
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// replicaBlock is a main chain block along with everything a replica needs to
+// connect it without executing its transactions: the virtual block and the
+// receipts produced by the execution, and the state trie nodes and contract
+// codes added by the block.
+type replicaBlock struct {
+	Block      []byte
+	VBlock     []byte
+	Receipts   []*types.ReceiptForStorage
+	StateNodes [][]byte
+}
+
+// EncodeReplicaBlock returns the hash and the replica encoding of the main
+// chain block at the passed height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) EncodeReplicaBlock(height int32) (*common.Hash, []byte, error) {
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil || node.parent == nil {
+		str := fmt.Sprintf("no block node at height %d exists in the main chain", height)
+		return nil, nil, errNotInMainChain(str)
+	}
+
+	rb := replicaBlock{}
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		rb.Block, err = dbTx.FetchBlock(database.NewNormalBlockKey(&node.hash))
+		if err != nil {
+			return err
+		}
+		rb.VBlock, err = dbTx.FetchBlock(database.NewVirtualBlockKey(&node.hash))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, receipt := range rawdb.ReadReceipts(b.ethDB, node.hash, uint64(node.height)) {
+		rb.Receipts = append(rb.Receipts, (*types.ReceiptForStorage)(receipt))
+	}
+	rb.StateNodes, err = b.stateDiff(node.parent.stateRoot, node.stateRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := rlp.EncodeToBytes(&rb)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &node.hash, data, nil
+}
+
+// stateDiff returns the state trie nodes, storage trie nodes and contract
+// codes reachable from the new state root but not from the old one.
+func (b *BlockChain) stateDiff(oldRoot, newRoot common.Hash) ([][]byte, error) {
+	tdb := b.stateCache.TrieDB()
+	oldTrie, err := trie.New(oldRoot, tdb)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.New(newRoot, tdb)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs [][]byte
+	addNodes := func(it trie.NodeIterator, leaf func(it trie.NodeIterator) error) error {
+		for it.Next(true) {
+			if hash := it.Hash(); hash != (common.Hash{}) {
+				blob, err := tdb.Node(hash)
+				if err != nil {
+					return err
+				}
+				blobs = append(blobs, blob)
+			}
+			if leaf != nil && it.Leaf() {
+				if err := leaf(it); err != nil {
+					return err
+				}
+			}
+		}
+		return it.Error()
+	}
+
+	// Every changed account is a new leaf of the account trie, whose
+	// storage trie and code are diffed against the previous version.
+	account := func(it trie.NodeIterator) error {
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			return err
+		}
+		var oldAcc state.Account
+		oldStorageRoot := common.Hash{}
+		if enc, err := oldTrie.TryGet(it.LeafKey()); err != nil {
+			return err
+		} else if len(enc) > 0 {
+			if err := rlp.DecodeBytes(enc, &oldAcc); err != nil {
+				return err
+			}
+			oldStorageRoot = oldAcc.Root
+		}
+
+		if acc.Root != oldStorageRoot {
+			oldStorage, err := trie.New(oldStorageRoot, tdb)
+			if err != nil {
+				return err
+			}
+			newStorage, err := trie.New(acc.Root, tdb)
+			if err != nil {
+				return err
+			}
+			diff, _ := trie.NewDifferenceIterator(oldStorage.NodeIterator(nil),
+				newStorage.NodeIterator(nil))
+			if err := addNodes(diff, nil); err != nil {
+				return err
+			}
+		}
+
+		codeHash := common.BytesToHash(acc.CodeHash)
+		if codeHash != emptyCodeHash && !bytes.Equal(acc.CodeHash, oldAcc.CodeHash) {
+			code, err := tdb.Node(codeHash)
+			if err != nil {
+				return err
+			}
+			blobs = append(blobs, code)
+		}
+		return nil
+	}
+
+	diff, _ := trie.NewDifferenceIterator(oldTrie.NodeIterator(nil), newTrie.NodeIterator(nil))
+	if err := addNodes(diff, account); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// ConnectReplicaBlock connects a block encoded by EncodeReplicaBlock on a
+// trusted primary node.  The state trie nodes are stored as is and the block
+// is connected with the virtual block and receipts of the primary, skipping
+// the execution of its transactions.  The block must extend the main chain.
+// It returns the hash of the block, and no error when the block is already
+// known.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ConnectReplicaBlock(data []byte) (*common.Hash, error) {
+	var rb replicaBlock
+	if err := rlp.DecodeBytes(data, &rb); err != nil {
+		return nil, err
+	}
+	block, err := asiutil.NewBlockFromBytes(rb.Block)
+	if err != nil {
+		return nil, err
+	}
+	vblock, err := asiutil.NewVBlockFromBytes(rb.VBlock, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	receipts := make(types.Receipts, len(rb.Receipts))
+	var logs []*types.Log
+	for i, receipt := range rb.Receipts {
+		receipts[i] = (*types.Receipt)(receipt)
+		logs = append(logs, receipts[i].Logs...)
+	}
+
+	// Nodes are keyed by the hash of their content, so a corrupted node can
+	// not overwrite any other entry.
+	batch := b.ethDB.NewBatch()
+	for _, blob := range rb.StateNodes {
+		hash := crypto.Keccak256Hash(blob)
+		if err := batch.Put(hash[:], blob); err != nil {
+			return nil, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	stateRoot := block.MsgBlock().Header.StateRoot
+	if _, err := trie.New(stateRoot, b.stateCache.TrieDB()); err != nil {
+		return nil, fmt.Errorf("state %v of block %v is incomplete: %v",
+			stateRoot, block.Hash(), err)
+	}
+
+	isMainChain, isOrphan, err := b.ProcessBlock(block, vblock, receipts, logs,
+		common.BFFastAdd)
+	if err != nil {
+		if rerr, ok := err.(RuleError); ok && rerr.ErrorCode == ErrDuplicateBlock {
+			return block.Hash(), nil
+		}
+		return nil, err
+	}
+	if isOrphan || !isMainChain {
+		return nil, fmt.Errorf("block %v does not extend the main chain",
+			block.Hash())
+	}
+	return block.Hash(), nil
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+)
+
+// ValidatorRoundReport is the performance of a validator during a round.
+// Fullness is the mean ratio of the gas used to the gas limit of its blocks.
+// MeanDelay is the mean arrival delay of the blocks whose arrival was
+// recorded, their number being Arrivals.  Fees is the sum of the asim fees
+// collected by the coinbase of its blocks.
+type ValidatorRoundReport struct {
+	Validator common.Address
+	Expected  int
+	Produced  int
+	Missed    int
+	Fullness  float64
+	Arrivals  int
+	MeanDelay time.Duration
+	Fees      int64
+}
+
+// RoundReport is the performance of the validators of a round of the main
+// chain, sorted by validator address.
+type RoundReport struct {
+	Round       uint32
+	StartHeight int32
+	EndHeight   int32
+	Blocks      int
+	Validators  []ValidatorRoundReport
+}
+
+// roundLastNode returns the last main chain node of the passed round or of
+// the closest round before it, and nil when no main chain block precedes the
+// end of the round.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) roundLastNode(round uint32) *blockNode {
+	// The rounds increase along the chain, so search the highest block
+	// whose round does not follow the passed round.
+	low, high := int32(0), b.bestChain.Height()
+	var last *blockNode
+	for low <= high {
+		mid := low + (high-low)/2
+		node := b.bestChain.NodeByHeight(mid)
+		if node.round.Round <= round {
+			last = node
+			low = mid + 1
+		} else {
+			high = mid - 1
+		}
+	}
+	return last
+}
+
+// RoundReport returns the performance of the validators of a completed round
+// of the main chain: the blocks each one was expected to produce and produced,
+// the fullness of its blocks, their arrival delay at the node, and the fees
+// they collected.
+//
+// Note that the blocks received while the node catches up with the network
+// arrive long after their timestamp, so their delays only reflect the sync.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RoundReport(round uint32) (*RoundReport, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if tip := b.bestChain.Tip(); round >= tip.round.Round {
+		return nil, fmt.Errorf("round %d is not completed, the best "+
+			"block is in round %d", round, tip.round.Round)
+	}
+	last := b.roundLastNode(round)
+	if last == nil {
+		return nil, fmt.Errorf("no block precedes the end of round %d", round)
+	}
+
+	validators, expected, produced, _, err := b.CountRoundMinerInfo(round, last)
+	if err != nil {
+		return nil, err
+	}
+	reports := make(map[common.Address]*ValidatorRoundReport, len(validators))
+	for i, validator := range validators {
+		reports[validator] = &ValidatorRoundReport{
+			Validator: validator,
+			Expected:  int(expected[i]),
+			Produced:  int(produced[i]),
+		}
+		if expected[i] > produced[i] {
+			reports[validator].Missed = int(expected[i] - produced[i])
+		}
+	}
+
+	report := &RoundReport{
+		Round:       round,
+		StartHeight: last.height + 1,
+		EndHeight:   last.height,
+	}
+	delays := make(map[common.Address]time.Duration)
+	unlisted := make(map[common.Address]struct{})
+	err = b.db.View(func(dbTx database.Tx) error {
+		for node := last; node != nil && node.round.Round == round; node = node.parent {
+			report.StartHeight = node.height
+			report.Blocks++
+
+			// The blocks of the validators missing from the list of
+			// the round are not counted by CountRoundMinerInfo.
+			r, ok := reports[node.coinbase]
+			if !ok {
+				r = &ValidatorRoundReport{Validator: node.coinbase}
+				reports[node.coinbase] = r
+				unlisted[node.coinbase] = struct{}{}
+			}
+			if _, ok := unlisted[node.coinbase]; ok {
+				r.Produced++
+			}
+			if node.GasLimit() > 0 {
+				r.Fullness += float64(node.GasUsed()) / float64(node.GasLimit())
+			}
+			if arrival, ok := dbFetchBlockArrival(dbTx, &node.hash); ok {
+				delays[node.coinbase] += arrival.Sub(time.Unix(node.timestamp, 0))
+				r.Arrivals++
+			}
+
+			block, err := dbFetchBlockByNode(dbTx, node)
+			if err != nil {
+				return err
+			}
+			r.Fees += b.blockFees(block)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Validators = make([]ValidatorRoundReport, 0, len(reports))
+	for validator, r := range reports {
+		if r.Produced > 0 {
+			r.Fullness /= float64(r.Produced)
+		}
+		if r.Arrivals > 0 {
+			r.MeanDelay = delays[validator] / time.Duration(r.Arrivals)
+		}
+		report.Validators = append(report.Validators, *r)
+	}
+	sort.Slice(report.Validators, func(i, j int) bool {
+		return report.Validators[i].Validator.Hex() < report.Validators[j].Validator.Hex()
+	})
+	return report, nil
+}
+
+// blockFees returns the asim fees collected by the coinbase of a block, the
+// value of its asim outputs beyond the block subsidy.
+func (b *BlockChain) blockFees(block *asiutil.Block) int64 {
+	if block.Height() == 0 {
+		return 0
+	}
+	txs := block.MsgBlock().Transactions
+	coinbase := txs[len(txs)-1]
+	var value int64
+	for _, txOut := range coinbase.TxOut {
+		if txOut.Asset.Equal(&asiutil.AsimovAsset) {
+			value += txOut.Value
+		}
+	}
+	fees := value - CalcBlockSubsidy(block.Height(), b.chainParams)
+	if fees < 0 {
+		return 0
+	}
+	return fees
+}
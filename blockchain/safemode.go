@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+)
+
+// safeModeKeyName is the name of the db key used to store the reason the
+// chain entered safe mode for, so safe mode survives restarts until it is
+// acknowledged.
+var safeModeKeyName = []byte("safemode")
+
+// enterSafeMode puts the chain in safe mode for the passed reason.  Safe mode
+// does not affect the chain itself but tells the services relying on it that
+// the chain is unstable, until an operator acknowledges it.  The first reason
+// is kept until then.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) enterSafeMode(reason string) {
+	b.safeModeLock.Lock()
+	defer b.safeModeLock.Unlock()
+	if b.safeModeReason != "" {
+		return
+	}
+	log.Warnf("Entering safe mode: %s", reason)
+	b.safeModeReason = reason
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Put(safeModeKeyName, []byte(reason))
+	})
+	if err != nil {
+		log.Errorf("Unable to store safe mode: %v", err)
+	}
+}
+
+// loadSafeMode restores the safe mode stored in the database.
+func (b *BlockChain) loadSafeMode() error {
+	return b.db.View(func(dbTx database.Tx) error {
+		b.safeModeReason = string(dbTx.Metadata().Get(safeModeKeyName))
+		if b.safeModeReason != "" {
+			log.Warnf("Chain is in safe mode: %s", b.safeModeReason)
+		}
+		return nil
+	})
+}
+
+// AcknowledgeSafeMode leaves safe mode once an operator checked the chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AcknowledgeSafeMode() error {
+	b.safeModeLock.Lock()
+	defer b.safeModeLock.Unlock()
+	if b.safeModeReason == "" {
+		return nil
+	}
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Delete(safeModeKeyName)
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Leaving safe mode")
+	b.safeModeReason = ""
+	return nil
+}
+
+// SafeMode returns whether the chain is in safe mode along with the reason it
+// entered safe mode for.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SafeMode() (bool, string) {
+	b.safeModeLock.RLock()
+	reason := b.safeModeReason
+	b.safeModeLock.RUnlock()
+	return reason != "", reason
+}
+
+// checkReorgDepth enters safe mode when a reorganize detached more blocks than
+// the configured safe mode depth.
+func (b *BlockChain) checkReorgDepth(detached int, newTip *blockNode) {
+	if b.safeModeReorgDepth <= 0 || detached < int(b.safeModeReorgDepth) {
+		return
+	}
+	b.enterSafeMode(fmt.Sprintf("reorganize of %d blocks to block %v at "+
+		"height %d", detached, newTip.hash, newTip.height))
+}
+
+// checkInvalidChain enters safe mode when a chain with more weight than the
+// best chain turns out to be invalid, which means validators are producing or
+// relaying an invalid chain.
+func (b *BlockChain) checkInvalidChain(weight uint64, hash *common.Hash, reason error) {
+	if weight <= b.bestChain.Tip().weight {
+		return
+	}
+	b.enterSafeMode(fmt.Sprintf("invalid chain with more weight than the "+
+		"best chain ending at block %v: %v", hash, reason))
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+)
+
+// TestSafeMode ensures the chain enters safe mode on deep reorganizes and
+// heavier invalid chains, and stays in safe mode across restarts until it is
+// acknowledged.
+func TestSafeMode(t *testing.T) {
+	chain, teardownFunc, err := newFakeChain(&chaincfg.DevelopNetParams)
+	if err != nil || chain == nil {
+		t.Fatalf("newFakeChain error %v", err)
+	}
+	defer teardownFunc()
+
+	chain.safeModeReorgDepth = 3
+	tip := chain.bestChain.Tip()
+	chain.checkReorgDepth(2, tip)
+	chain.checkInvalidChain(tip.weight, &tip.hash, errors.New("bad block"))
+	if safeMode, _ := chain.SafeMode(); safeMode {
+		t.Fatal("safe mode entered without reason")
+	}
+
+	chain.checkReorgDepth(3, tip)
+	safeMode, reason := chain.SafeMode()
+	if !safeMode || reason == "" {
+		t.Fatal("safe mode not entered on a deep reorganize")
+	}
+
+	// The first reason is kept and restored on restart.
+	chain.checkInvalidChain(tip.weight+1, &tip.hash, errors.New("bad block"))
+	chain.safeModeReason = ""
+	if err := chain.loadSafeMode(); err != nil {
+		t.Fatalf("loadSafeMode: %v", err)
+	}
+	if _, restored := chain.SafeMode(); restored != reason {
+		t.Fatalf("restored safe mode reason %q, want %q", restored, reason)
+	}
+
+	if err := chain.AcknowledgeSafeMode(); err != nil {
+		t.Fatalf("AcknowledgeSafeMode: %v", err)
+	}
+	if err := chain.loadSafeMode(); err != nil {
+		t.Fatalf("loadSafeMode: %v", err)
+	}
+	if safeMode, _ := chain.SafeMode(); safeMode {
+		t.Fatal("safe mode restored after acknowledgement")
+	}
+
+	chain.checkInvalidChain(tip.weight+1, &tip.hash, errors.New("bad block"))
+	if safeMode, _ := chain.SafeMode(); !safeMode {
+		t.Fatal("safe mode not entered on a heavier invalid chain")
+	}
+}
@@ -8,14 +8,34 @@ import (
 	"fmt"
 	"github.com/AsimovNetwork/asimov/blockchain/txo"
 	"math"
-	"runtime"
 	"time"
 
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/workers"
 )
 
+const (
+	// maxScriptBatch is the maximum number of inputs a worker validates
+	// per batch.  Batching the inputs saves the channel round trips which
+	// otherwise take a significant part of the time of the cheap scripts.
+	maxScriptBatch = 16
+
+	// batchesPerWorker is the number of batches sent to each worker when
+	// the inputs are few enough, so the workers stay busy when the scripts
+	// take uneven times.
+	batchesPerWorker = 4
+)
+
+// scriptWorkers sizes the goroutines validating the input scripts of a
+// transaction or block.  The validation is CPU bound, dominated by the ECDSA
+// signature checks, so it defaults to one per processor usable by the Go
+// scheduler.
+var scriptWorkers = workers.New("script",
+	"goroutines validating the input scripts of a transaction or block",
+	workers.PerProc(1))
+
 // txValidateItem holds a transaction along with which input to validate.
 type txValidateItem struct {
 	txInIndex int
@@ -27,17 +47,18 @@ type txValidateItem struct {
 // inputs.  It provides several channels for communication and a processing
 // function that is intended to be in run multiple goroutines.
 type txValidator struct {
-	validateChan chan *txValidateItem
+	validateChan chan []*txValidateItem
 	quitChan     chan struct{}
 	resultChan   chan error
 	utxoView     *txo.UtxoViewpoint
 	flags        txscript.ScriptFlags
+	sigCache     *txscript.SigCache
 }
 
-// sendResult sends the result of a script pair validation on the internal
-// result channel while respecting the quit channel.  This allows orderly
-// shutdown when the validation process is aborted early due to a validation
-// error in one of the other goroutines.
+// sendResult sends the result of a batch validation on the internal result
+// channel while respecting the quit channel.  This allows orderly shutdown
+// when the validation process is aborted early due to a validation error in
+// one of the other goroutines.
 func (v *txValidator) sendResult(result error) {
 	select {
 	case v.resultChan <- result:
@@ -45,117 +66,166 @@ func (v *txValidator) sendResult(result error) {
 	}
 }
 
-// validateHandler consumes items to validate from the internal validate channel
-// and returns the result of the validation on the internal result channel. It
+// validateItem validates the script pair of the passed transaction input.
+func (v *txValidator) validateItem(txVI *txValidateItem) error {
+	// Ensure the referenced input utxo is available.
+	txIn := txVI.txIn
+	utxo := v.utxoView.LookupEntry(txIn.PreviousOutPoint)
+	if utxo == nil {
+		str := fmt.Sprintf("unable to find unspent "+
+			"output %v referenced from "+
+			"transaction %s:%d",
+			txIn.PreviousOutPoint, txVI.tx.Hash(),
+			txVI.txInIndex)
+		return ruleError(ErrMissingTxOut, str)
+	}
+
+	// Create a new script engine for the script pair.
+	sigScript := txIn.SignatureScript
+	pkScript := utxo.PkScript()
+	inputAmount := utxo.Amount()
+	vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
+		txVI.txInIndex, v.flags, inputAmount, utxo.Asset(), utxo.BlockHeight(),
+		v.sigCache)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse input "+
+			"%s:%d which references output %v - "+
+			"%v (input script "+
+			"bytes %x, prev output script bytes %x)",
+			txVI.tx.Hash(), txVI.txInIndex,
+			txIn.PreviousOutPoint, err,
+			sigScript, pkScript)
+		return ruleError(ErrScriptMalformed, str)
+	}
+
+	// Execute the script pair.
+	if err := vm.Execute(); err != nil {
+		str := fmt.Sprintf("failed to validate input "+
+			"%s:%d which references output %v - "+
+			"%v (input script "+
+			"bytes %x, prev output script bytes %x)",
+			txVI.tx.Hash(), txVI.txInIndex,
+			txIn.PreviousOutPoint, err,
+			sigScript, pkScript)
+		return ruleError(ErrScriptValidation, str)
+	}
+
+	return nil
+}
+
+// validateHandler consumes batches of items to validate from the internal
+// validate channel and returns the result of the validation of each batch on
+// the internal result channel.  It stops validating a batch as soon as the
+// quit channel is closed after another goroutine found an invalid input.  It
 // must be run as a goroutine.
 func (v *txValidator) validateHandler() {
-out:
 	for {
 		select {
-		case txVI := <-v.validateChan:
-			// Ensure the referenced input utxo is available.
-			txIn := txVI.txIn
-			utxo := v.utxoView.LookupEntry(txIn.PreviousOutPoint)
-			if utxo == nil {
-				str := fmt.Sprintf("unable to find unspent "+
-					"output %v referenced from "+
-					"transaction %s:%d",
-					txIn.PreviousOutPoint, txVI.tx.Hash(),
-					txVI.txInIndex)
-				err := ruleError(ErrMissingTxOut, str)
-				v.sendResult(err)
-				break out
+		case batch := <-v.validateChan:
+			var err error
+			for _, txVI := range batch {
+				select {
+				case <-v.quitChan:
+					return
+				default:
+				}
+				if err = v.validateItem(txVI); err != nil {
+					break
+				}
 			}
-
-			// Create a new script engine for the script pair.
-			sigScript := txIn.SignatureScript
-			pkScript := utxo.PkScript()
-			inputAmount := utxo.Amount()
-			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
-				txVI.txInIndex, v.flags, inputAmount, utxo.Asset(), utxo.BlockHeight())
+			v.sendResult(err)
 			if err != nil {
-				str := fmt.Sprintf("failed to parse input "+
-					"%s:%d which references output %v - "+
-					"%v (input script "+
-					"bytes %x, prev output script bytes %x)",
-					txVI.tx.Hash(), txVI.txInIndex,
-					txIn.PreviousOutPoint, err,
-					sigScript, pkScript)
-				err := ruleError(ErrScriptMalformed, str)
-				v.sendResult(err)
-				break out
+				return
 			}
 
-			// Execute the script pair.
-			if err := vm.Execute(); err != nil {
-				str := fmt.Sprintf("failed to validate input "+
-					"%s:%d which references output %v - "+
-					"%v (input script "+
-					"bytes %x, prev output script bytes %x)",
-					txVI.tx.Hash(), txVI.txInIndex,
-					txIn.PreviousOutPoint, err,
-					sigScript, pkScript)
-				err := ruleError(ErrScriptValidation, str)
-				v.sendResult(err)
-				break out
-			}
-
-			// Validation succeeded.
-			v.sendResult(nil)
-
 		case <-v.quitChan:
-			break out
+			return
+		}
+	}
+}
+
+// scriptBatches splits the passed items into the batches validated by the
+// passed number of workers.
+func scriptBatches(items []*txValidateItem, numWorkers int) [][]*txValidateItem {
+	batchSize := (len(items) + numWorkers*batchesPerWorker - 1) /
+		(numWorkers * batchesPerWorker)
+	if batchSize > maxScriptBatch {
+		batchSize = maxScriptBatch
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	batches := make([][]*txValidateItem, 0, (len(items)+batchSize-1)/batchSize)
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
 		}
+		batches = append(batches, items[start:end])
 	}
+	return batches
 }
 
 // Validate validates the scripts for all of the passed transaction inputs using
-// multiple goroutines.
+// multiple goroutines.  The inputs are dispatched in batches and the
+// validation stops at the first invalid input.
 func (v *txValidator) Validate(items []*txValidateItem) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	// Limit the number of goroutines to do script validation based on the
-	// number of processor cores.  This helps ensure the system stays
+	// Limit the number of goroutines to do script validation to the size
+	// of the script worker pool.  This helps ensure the system stays
 	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
+	maxGoRoutines := scriptWorkers.Size()
 	if maxGoRoutines <= 0 {
 		maxGoRoutines = 1
 	}
-	if maxGoRoutines > len(items) {
-		maxGoRoutines = len(items)
+	batches := scriptBatches(items, maxGoRoutines)
+	if maxGoRoutines > len(batches) {
+		maxGoRoutines = len(batches)
+	}
+
+	// Validate a single batch, such as the lone input of a transaction,
+	// without the overhead of the goroutines.
+	if len(batches) == 1 {
+		for _, txVI := range items {
+			if err := v.validateItem(txVI); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	// Start up validation handlers that are used to asynchronously
-	// validate each transaction input.
+	// validate the batches of transaction inputs.
 	for i := 0; i < maxGoRoutines; i++ {
 		go v.validateHandler()
 	}
 
-	// Validate each of the inputs.  The quit channel is closed when any
+	// Validate each of the batches.  The quit channel is closed when any
 	// errors occur so all processing goroutines exit regardless of which
 	// input had the validation error.
-	numInputs := len(items)
-	currentItem := 0
-	processedItems := 0
-	for processedItems < numInputs {
-		// Only send items while there are still items that need to
+	numBatches := len(batches)
+	currentBatch := 0
+	processedBatches := 0
+	for processedBatches < numBatches {
+		// Only send batches while there are still batches that need to
 		// be processed.  The select statement will never select a nil
 		// channel.
-		var validateChan chan *txValidateItem
-		var item *txValidateItem
-		if currentItem < numInputs {
+		var validateChan chan []*txValidateItem
+		var batch []*txValidateItem
+		if currentBatch < numBatches {
 			validateChan = v.validateChan
-			item = items[currentItem]
+			batch = batches[currentBatch]
 		}
 
 		select {
-		case validateChan <- item:
-			currentItem++
+		case validateChan <- batch:
+			currentBatch++
 
 		case err := <-v.resultChan:
-			processedItems++
+			processedBatches++
 			if err != nil {
 				close(v.quitChan)
 				return err
@@ -169,20 +239,23 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 
 // newTxValidator returns a new instance of txValidator to be used for
 // validating transaction scripts asynchronously.
-func newTxValidator(utxoView *txo.UtxoViewpoint, flags txscript.ScriptFlags) *txValidator {
+func newTxValidator(utxoView *txo.UtxoViewpoint, flags txscript.ScriptFlags,
+	sigCache *txscript.SigCache) *txValidator {
 	return &txValidator{
-		validateChan: make(chan *txValidateItem),
+		validateChan: make(chan []*txValidateItem),
 		quitChan:     make(chan struct{}),
 		resultChan:   make(chan error),
 		utxoView:     utxoView,
 		flags:        flags,
+		sigCache:     sigCache,
 	}
 }
 
 // ValidateTransactionScripts validates the scripts for the passed transaction
-// using multiple goroutines.
+// using multiple goroutines.  The signatures found in the signature cache,
+// which may be nil, are not verified again.
 func ValidateTransactionScripts(tx *asiutil.Tx, utxoView *txo.UtxoViewpoint,
-	flags txscript.ScriptFlags) error {
+	flags txscript.ScriptFlags, sigCache *txscript.SigCache) error {
 
 	//cachedHashes, _ := hashCache.GetSigHashes(tx.Hash())
 
@@ -205,14 +278,14 @@ func ValidateTransactionScripts(tx *asiutil.Tx, utxoView *txo.UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, flags)
+	validator := newTxValidator(utxoView, flags, sigCache)
 	return validator.Validate(txValItems)
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
 // the passed block using multiple goroutines.
 func checkBlockScripts(block *asiutil.Block, utxoView *txo.UtxoViewpoint,
-	scriptFlags txscript.ScriptFlags) error {
+	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache) error {
 
 	// Collect all of the transaction inputs and required information for
 	// validation for all transactions in the block into a single slice.
@@ -239,7 +312,7 @@ func checkBlockScripts(block *asiutil.Block, utxoView *txo.UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, scriptFlags)
+	validator := newTxValidator(utxoView, scriptFlags, sigCache)
 	start := time.Now()
 	if err := validator.Validate(txValItems); err != nil {
 		return err
@@ -6,6 +6,7 @@ package blockchain
 
 import (
     "github.com/AsimovNetwork/asimov/asiutil"
+    "github.com/AsimovNetwork/asimov/common"
     "github.com/AsimovNetwork/asimov/blockchain/txo"
     "github.com/AsimovNetwork/asimov/protos"
     "github.com/AsimovNetwork/asimov/txscript"
@@ -82,15 +83,61 @@ func TestCheckBlockScripts(t *testing.T) {
     block := blocks[1]
     view := txo.NewUtxoViewpoint()
     view.SetBestHash(&chain.bestChain.tip().hash)
-    err = fetchInputUtxos(view, chain.db, block)
+    err = fetchInputUtxos(view, chain.utxoCache, block)
     if err != nil {
         t.Errorf("test TestCheckBlockScripts error %v", err)
     }
 
     scriptFlags := txscript.ScriptBip16
-    err = checkBlockScripts(block, view, scriptFlags)
+    err = checkBlockScripts(block, view, scriptFlags, nil)
     if err != nil {
       t.Errorf("Transaction script validation failed: %v\n", err)
       return
     }
 }
+
+// TestScriptBatches ensures the inputs are split in batches keeping every
+// worker busy, up to the maximum batch size.
+func TestScriptBatches(t *testing.T) {
+    tests := []struct {
+        numItems   int
+        numWorkers int
+        want       []int
+    }{
+        {1, 8, []int{1}},
+        {10, 8, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+        {70, 8, []int{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 1}},
+        {100, 1, []int{16, 16, 16, 16, 16, 16, 4}},
+    }
+    for i, test := range tests {
+        items := make([]*txValidateItem, test.numItems)
+        batches := scriptBatches(items, test.numWorkers)
+        if len(batches) != len(test.want) {
+            t.Errorf("#%d: got %d batches, want %d", i, len(batches), len(test.want))
+            continue
+        }
+        for j, batch := range batches {
+            if len(batch) != test.want[j] {
+                t.Errorf("#%d: batch %d has %d items, want %d", i, j,
+                    len(batch), test.want[j])
+            }
+        }
+    }
+}
+
+// TestValidateAbort ensures the validation of many inputs returns the error of
+// an invalid input.
+func TestValidateAbort(t *testing.T) {
+    msgTx := protos.NewMsgTx(protos.TxVersion)
+    for i := 0; i < 200; i++ {
+        prevOut := protos.NewOutPoint(&common.Hash{1}, uint32(i))
+        msgTx.AddTxIn(protos.NewTxIn(prevOut, nil))
+    }
+    tx := asiutil.NewTx(msgTx)
+
+    view := txo.NewUtxoViewpoint()
+    err := ValidateTransactionScripts(tx, view, txscript.ScriptBip16, nil)
+    if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrMissingTxOut {
+        t.Fatalf("ValidateTransactionScripts: got %v, want %v", err, ErrMissingTxOut)
+    }
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/serialization"
+)
+
+// SnapshotVersion is the version of the format written by SnapshotWriter.
+const SnapshotVersion = 1
+
+// maxSnapshotField is the maximum size of a field of a snapshot record.
+const maxSnapshotField = 1 << 25
+
+// snapshotMagic starts every snapshot.
+var snapshotMagic = [8]byte{'a', 's', 'i', 'm', 's', 'n', 'a', 'p'}
+
+// SnapshotRecordKind identifies the content of a snapshot record.
+type SnapshotRecordKind byte
+
+// These constants define the kinds of snapshot records.
+const (
+	// snapshotEnd ends the records, and is followed by the hash of the
+	// snapshot.
+	snapshotEnd SnapshotRecordKind = iota
+
+	// SnapshotBlock is a block or virtual block, whose key is its block
+	// key and value its serialized bytes.
+	SnapshotBlock
+
+	// SnapshotBucket is a metadata bucket identified by its path.  It
+	// precedes the entries of the bucket.
+	SnapshotBucket
+
+	// SnapshotEntry is an entry of the metadata bucket identified by its
+	// path, or of the root of the metadata when the path is empty.
+	SnapshotEntry
+
+	// SnapshotStateNode is a state trie node or contract code, keyed in
+	// the state database by the hash of its value.
+	SnapshotStateNode
+)
+
+// SnapshotHeader describes the block at which a snapshot was taken.
+type SnapshotHeader struct {
+	Net       common.AsimovNet
+	Height    int32
+	Hash      common.Hash
+	StateRoot common.Hash
+}
+
+// SnapshotRecord is a record of a snapshot.  The fields which do not apply
+// to its kind are empty.
+type SnapshotRecord struct {
+	Kind  SnapshotRecordKind
+	Path  [][]byte
+	Key   []byte
+	Value []byte
+}
+
+// SnapshotWriter writes a snapshot, made of a header followed by records and
+// the SHA-256 hash of everything before it.
+type SnapshotWriter struct {
+	w      *bufio.Writer
+	hasher hash.Hash
+	n      int64
+}
+
+// NewSnapshotWriter returns a writer of a snapshot with the passed header to
+// the passed writer.
+func NewSnapshotWriter(w io.Writer, header *SnapshotHeader) (*SnapshotWriter, error) {
+	sw := &SnapshotWriter{hasher: sha256.New()}
+	sw.w = bufio.NewWriter(io.MultiWriter(w, sw.hasher, (*snapshotCounter)(&sw.n)))
+
+	var buf bytes.Buffer
+	buf.Write(snapshotMagic[:])
+	serialization.WriteUint32(&buf, SnapshotVersion)
+	serialization.WriteUint32(&buf, uint32(header.Net))
+	serialization.WriteUint32(&buf, uint32(header.Height))
+	buf.Write(header.Hash[:])
+	buf.Write(header.StateRoot[:])
+	if _, err := sw.w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// Write writes a record.
+func (sw *SnapshotWriter) Write(record *SnapshotRecord) error {
+	if record.Kind == snapshotEnd || record.Kind > SnapshotStateNode {
+		return fmt.Errorf("invalid snapshot record kind %d", record.Kind)
+	}
+	if err := sw.w.WriteByte(byte(record.Kind)); err != nil {
+		return err
+	}
+	if err := serialization.WriteVarInt(sw.w, 0, uint64(len(record.Path))); err != nil {
+		return err
+	}
+	for _, name := range record.Path {
+		if err := serialization.WriteVarBytes(sw.w, 0, name); err != nil {
+			return err
+		}
+	}
+	if err := serialization.WriteVarBytes(sw.w, 0, record.Key); err != nil {
+		return err
+	}
+	return serialization.WriteVarBytes(sw.w, 0, record.Value)
+}
+
+// Close ends the snapshot with its hash.  It returns the hash and the size of
+// the snapshot.  The underlying writer is not closed.
+func (sw *SnapshotWriter) Close() (common.Hash, int64, error) {
+	if err := sw.w.WriteByte(byte(snapshotEnd)); err != nil {
+		return common.Hash{}, 0, err
+	}
+	if err := sw.w.Flush(); err != nil {
+		return common.Hash{}, 0, err
+	}
+	var sum common.Hash
+	copy(sum[:], sw.hasher.Sum(nil))
+	if _, err := sw.w.Write(sum[:]); err != nil {
+		return common.Hash{}, 0, err
+	}
+	if err := sw.w.Flush(); err != nil {
+		return common.Hash{}, 0, err
+	}
+	return sum, sw.n, nil
+}
+
+// snapshotCounter counts the bytes written to a snapshot.
+type snapshotCounter int64
+
+// Write counts the passed bytes.
+func (c *snapshotCounter) Write(p []byte) (int, error) {
+	*c += snapshotCounter(len(p))
+	return len(p), nil
+}
+
+// errSnapshotHash is returned when a snapshot does not match its hash.
+var errSnapshotHash = errors.New("snapshot does not match its hash")
+
+// SnapshotReader reads a snapshot written by SnapshotWriter.
+type SnapshotReader struct {
+	r      *bufio.Reader
+	hasher hash.Hash
+	header SnapshotHeader
+	hash   common.Hash
+	done   bool
+}
+
+// NewSnapshotReader returns a reader of the snapshot read from the passed
+// reader, after reading its header.
+func NewSnapshotReader(r io.Reader) (*SnapshotReader, error) {
+	sr := &SnapshotReader{r: bufio.NewReader(r), hasher: sha256.New()}
+	tr := io.TeeReader(sr.r, sr.hasher)
+
+	var magic [8]byte
+	if _, err := io.ReadFull(tr, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != snapshotMagic {
+		return nil, errors.New("not a snapshot")
+	}
+	var version, net, height uint32
+	if err := serialization.ReadUint32(tr, &version); err != nil {
+		return nil, err
+	}
+	if version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	if err := serialization.ReadUint32(tr, &net); err != nil {
+		return nil, err
+	}
+	if err := serialization.ReadUint32(tr, &height); err != nil {
+		return nil, err
+	}
+	sr.header.Net = common.AsimovNet(net)
+	sr.header.Height = int32(height)
+	if _, err := io.ReadFull(tr, sr.header.Hash[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(tr, sr.header.StateRoot[:]); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// Header returns the header of the snapshot.
+func (sr *SnapshotReader) Header() *SnapshotHeader {
+	return &sr.header
+}
+
+// Next returns the next record of the snapshot.  After the last record, it
+// checks the snapshot against its hash and returns io.EOF.
+func (sr *SnapshotReader) Next() (*SnapshotRecord, error) {
+	if sr.done {
+		return nil, io.EOF
+	}
+	tr := io.TeeReader(sr.r, sr.hasher)
+
+	kind, err := sr.r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	sr.hasher.Write([]byte{kind})
+	if SnapshotRecordKind(kind) == snapshotEnd {
+		copy(sr.hash[:], sr.hasher.Sum(nil))
+		var sum common.Hash
+		if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if sum != sr.hash {
+			return nil, errSnapshotHash
+		}
+		sr.done = true
+		return nil, io.EOF
+	}
+	if SnapshotRecordKind(kind) > SnapshotStateNode {
+		return nil, fmt.Errorf("invalid snapshot record kind %d", kind)
+	}
+
+	record := &SnapshotRecord{Kind: SnapshotRecordKind(kind)}
+	count, err := serialization.ReadVarInt(tr, 0)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if count > 8 {
+		return nil, fmt.Errorf("snapshot bucket path of %d names", count)
+	}
+	for i := uint64(0); i < count; i++ {
+		name, err := serialization.ReadVarBytes(tr, 0, maxSnapshotField, "path")
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		record.Path = append(record.Path, name)
+	}
+	if record.Key, err = serialization.ReadVarBytes(tr, 0, maxSnapshotField, "key"); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if record.Value, err = serialization.ReadVarBytes(tr, 0, maxSnapshotField, "value"); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return record, nil
+}
+
+// Hash returns the hash of the snapshot once Next returned io.EOF.
+func (sr *SnapshotReader) Hash() common.Hash {
+	return sr.hash
+}
+
+// unexpectedEOF turns the end of the snapshot before its end record into an
+// error.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+func TestSnapshotReadWrite(t *testing.T) {
+	header := &SnapshotHeader{
+		Net:       common.TestNet,
+		Height:    1234,
+		Hash:      common.HexToHash("01"),
+		StateRoot: common.HexToHash("02"),
+	}
+	records := []*SnapshotRecord{
+		{Kind: SnapshotBlock, Key: []byte{1, 2}, Value: []byte{3}},
+		{Kind: SnapshotBucket, Path: [][]byte{[]byte("balance"), {0, 1}}},
+		{Kind: SnapshotEntry, Path: [][]byte{[]byte("utxoset")}, Key: []byte{4}, Value: []byte{5, 6}},
+		{Kind: SnapshotEntry, Key: []byte("chainstate"), Value: []byte{7}},
+		{Kind: SnapshotStateNode, Value: []byte{8, 9}},
+	}
+
+	var buf bytes.Buffer
+	sw, err := NewSnapshotWriter(&buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := sw.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Write(&SnapshotRecord{Kind: snapshotEnd}); err == nil {
+		t.Fatal("expected an error writing an end record")
+	}
+	hash, size, err := sw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(buf.Len()) {
+		t.Fatalf("size %d, wrote %d bytes", size, buf.Len())
+	}
+	data := buf.Bytes()
+
+	sr, err := NewSnapshotReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sr.Header(), header) {
+		t.Fatalf("header %+v, want %+v", sr.Header(), header)
+	}
+	for i, want := range records {
+		record, err := sr.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if record.Kind != want.Kind || len(record.Path) != len(want.Path) ||
+			!bytes.Equal(record.Key, want.Key) || !bytes.Equal(record.Value, want.Value) {
+			t.Fatalf("record %d is %+v, want %+v", i, record, want)
+		}
+		for j := range want.Path {
+			if !bytes.Equal(record.Path[j], want.Path[j]) {
+				t.Fatalf("record %d path %q, want %q", i, record.Path, want.Path)
+			}
+		}
+	}
+	if _, err := sr.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the records, got %v", err)
+	}
+	if sr.Hash() != hash {
+		t.Fatalf("hash %x, want %x", sr.Hash(), hash)
+	}
+
+	// A snapshot whose content was altered does not match its hash.
+	corrupted := common.CopyBytes(data)
+	corrupted[len(corrupted)-common.HashLength-3] ^= 1
+	if err := readSnapshot(corrupted); err != errSnapshotHash {
+		t.Fatalf("expected errSnapshotHash reading a corrupted snapshot, got %v", err)
+	}
+
+	// A truncated snapshot is never complete.
+	if err := readSnapshot(data[:len(data)-1]); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF reading a truncated snapshot, got %v", err)
+	}
+}
+
+// readSnapshot reads all the records of a snapshot.
+func readSnapshot(data []byte) error {
+	sr, err := NewSnapshotReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := sr.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func TestSnapshotBlockRow(t *testing.T) {
+	header := protos.BlockHeader{Height: 5}
+	hash := header.BlockHash()
+	var buf bytes.Buffer
+	if err := header.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte(byte(statusDataStored | statusValid))
+	row := buf.Bytes()
+	key := blockIndexKey(&hash, 5)
+
+	status := func(row []byte) blockStatus {
+		return blockStatus(row[len(row)-1])
+	}
+	got, err := snapshotBlockRow(key, row, map[common.Hash]struct{}{hash: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status(got) != statusDataStored|statusValid {
+		t.Fatalf("status of a stored block %v", status(got))
+	}
+	got, err = snapshotBlockRow(key, row, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status(got) != statusValid {
+		t.Fatalf("status of a block left out %v", status(got))
+	}
+	if status(row) != statusDataStored|statusValid {
+		t.Fatal("the row of the snapshot was modified")
+	}
+
+	other := common.HexToHash("03")
+	if _, err := snapshotBlockRow(blockIndexKey(&other, 5), row, nil); err == nil {
+		t.Fatal("expected an error for a row stored under another hash")
+	}
+}
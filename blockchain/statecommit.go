@@ -0,0 +1,246 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/vm/fvm/trie"
+)
+
+// StateKind identifies the part of the chain state covered by a state
+// commitment.
+type StateKind string
+
+// These constants define the parts of the chain state which can be committed.
+const (
+	// StateUtxo is the set of unspent transaction outputs keyed by the
+	// serialized outpoint.
+	StateUtxo StateKind = "utxo"
+
+	// StateAccount is the account trie of the virtual machine keyed by the
+	// hashed account address.
+	StateAccount StateKind = "account"
+)
+
+// StateLeafSize is the maximum number of entries below a prefix for which a
+// state commitment lists the entries themselves.
+const StateLeafSize = 64
+
+// StateEntry is a single entry of the chain state.
+type StateEntry struct {
+	// Key is the database key of the entry.
+	Key []byte
+
+	// Name is a human readable form of the key such as the outpoint of a
+	// utxo or the address of an account, when it is known.
+	Name string
+
+	// ValueHash is the hash of the serialized entry.
+	ValueHash common.Hash
+}
+
+// StateChild is the commitment to the entries whose key extends the prefix of
+// the parent commitment by one byte.
+type StateChild struct {
+	Byte  byte
+	Hash  common.Hash
+	Count int
+}
+
+// StateCommitment is a node of the hash tree over the chain state at a block.
+// Every node commits to the entries whose keys start with its prefix, so two
+// nodes with the same state produce identical commitments and a divergence
+// can be located by descending into the children whose hashes differ.
+type StateCommitment struct {
+	Kind      StateKind
+	BlockHash common.Hash
+	Height    int32
+	Prefix    []byte
+	Hash      common.Hash
+	Count     int
+
+	// Children are the non-empty children ordered by their byte.
+	Children []StateChild
+
+	// Entries lists the entries when there are no more than StateLeafSize
+	// of them.  Entries whose key equals the prefix are always listed.
+	Entries []StateEntry
+}
+
+// stateHasher accumulates the entries of a commitment.
+type stateHasher struct {
+	prefix   []byte
+	children [256]hash.Hash
+	counts   [256]int
+	exact    hash.Hash
+	entries  []StateEntry
+	count    int
+}
+
+// add adds an entry to the commitment.
+func (h *stateHasher) add(key, value []byte, name string) {
+	entry := StateEntry{Key: key, Name: name, ValueHash: sha256.Sum256(value)}
+	h.count++
+	if len(h.entries) <= StateLeafSize || len(key) == len(h.prefix) {
+		h.entries = append(h.entries, entry)
+	}
+
+	var hasher hash.Hash
+	if len(key) == len(h.prefix) {
+		if h.exact == nil {
+			h.exact = sha256.New()
+		}
+		hasher = h.exact
+	} else {
+		b := key[len(h.prefix)]
+		if h.children[b] == nil {
+			h.children[b] = sha256.New()
+		}
+		h.counts[b]++
+		hasher = h.children[b]
+	}
+	hasher.Write(key)
+	hasher.Write(entry.ValueHash[:])
+}
+
+// commitment finalizes the accumulated entries into a commitment.
+func (h *stateHasher) commitment() *StateCommitment {
+	c := &StateCommitment{
+		Prefix: h.prefix,
+		Count:  h.count,
+	}
+	root := sha256.New()
+	if h.exact != nil {
+		root.Write(h.exact.Sum(nil))
+	}
+	for i, child := range h.children {
+		if child == nil {
+			continue
+		}
+		var childHash common.Hash
+		copy(childHash[:], child.Sum(nil))
+		c.Children = append(c.Children, StateChild{
+			Byte:  byte(i),
+			Hash:  childHash,
+			Count: h.counts[i],
+		})
+		root.Write([]byte{byte(i)})
+		root.Write(childHash[:])
+	}
+	copy(c.Hash[:], root.Sum(nil))
+
+	if h.count <= StateLeafSize {
+		c.Entries = h.entries
+	} else {
+		// Only keep the entries matching the prefix exactly since they
+		// are not covered by any child.
+		var exact []StateEntry
+		for _, entry := range h.entries {
+			if len(entry.Key) == len(h.prefix) {
+				exact = append(exact, entry)
+			}
+		}
+		c.Entries = exact
+	}
+	return c
+}
+
+// StateCommitment returns the commitment to the entries of the given kind of
+// chain state whose keys start with the passed prefix.  When blockHash is not
+// nil, an error is returned unless it is the hash of the current best block,
+// which ensures all commitments of a comparison refer to the same state.
+// ErrInterruptRequested is returned when the interrupt channel, which can be
+// nil, is closed before the commitment is computed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) StateCommitment(kind StateKind, prefix []byte,
+	blockHash *common.Hash, interrupt <-chan struct{}) (*StateCommitment, error) {
+
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	best := b.BestSnapshot()
+	if blockHash != nil && *blockHash != best.Hash {
+		return nil, fmt.Errorf("best block is %v at height %d, not %v",
+			best.Hash, best.Height, blockHash)
+	}
+
+	h := &stateHasher{prefix: prefix}
+	switch kind {
+	case StateUtxo:
+		err := b.utxoCache.flush(b.bestChain.Tip())
+		if err != nil {
+			return nil, err
+		}
+		err = b.db.View(func(dbTx database.Tx) error {
+			cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+			for ok := cursor.Seek(prefix); ok; ok = cursor.Next() {
+				key := cursor.Key()
+				if !bytes.HasPrefix(key, prefix) {
+					break
+				}
+				if interruptRequested(interrupt) {
+					return ErrInterruptRequested
+				}
+				h.add(common.CopyBytes(key), cursor.Value(), utxoKeyName(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case StateAccount:
+		tr, err := b.stateCache.OpenTrie(best.StateRoot)
+		if err != nil {
+			return nil, err
+		}
+		it := trie.NewIterator(tr.NodeIterator(prefix))
+		for it.Next() {
+			if !bytes.HasPrefix(it.Key, prefix) {
+				break
+			}
+			if interruptRequested(interrupt) {
+				return nil, ErrInterruptRequested
+			}
+			var name string
+			if addr := tr.GetKey(it.Key); addr != nil {
+				name = common.BytesToAddress(addr).String()
+			}
+			h.add(common.CopyBytes(it.Key), it.Value, name)
+		}
+		if it.Err != nil {
+			return nil, it.Err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown state kind %q", kind)
+	}
+
+	c := h.commitment()
+	c.Kind = kind
+	c.BlockHash = best.Hash
+	c.Height = best.Height
+	return c, nil
+}
+
+// utxoKeyName returns the outpoint of the passed utxo set key as a string.
+func utxoKeyName(key []byte) string {
+	if len(key) <= common.HashLength {
+		return ""
+	}
+	var op protos.OutPoint
+	copy(op.Hash[:], key[:common.HashLength])
+	index, _ := deserializeVLQ(key[common.HashLength:])
+	op.Index = uint32(index)
+	return op.String()
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+)
+
+// TestStateHasher ensures state commitments only depend on the entries and
+// list the entries of small subtrees.
+func TestStateHasher(t *testing.T) {
+	build := func(prefix []byte, n int, value byte) *StateCommitment {
+		h := &stateHasher{prefix: prefix}
+		if len(prefix) > 0 {
+			h.add(prefix, []byte{value}, "")
+		}
+		for i := 0; i < n; i++ {
+			key := append(append([]byte{}, prefix...), byte(i), byte(i>>8))
+			h.add(key, []byte{value, byte(i)}, "")
+		}
+		return h.commitment()
+	}
+
+	a, b := build(nil, 200, 1), build(nil, 200, 1)
+	if a.Hash != b.Hash || a.Count != 200 {
+		t.Fatalf("equal states produced different commitments")
+	}
+	if len(a.Entries) != 0 || len(a.Children) != 200 {
+		t.Errorf("large commitment: got %d entries and %d children, "+
+			"want 0 and 200", len(a.Entries), len(a.Children))
+	}
+	if c := build(nil, 200, 2); c.Hash == a.Hash {
+		t.Errorf("different states produced the same commitment")
+	}
+
+	leaf := build([]byte{7}, 10, 1)
+	if leaf.Count != 11 || len(leaf.Entries) != 11 {
+		t.Errorf("leaf commitment: got %d entries of %d, want 11",
+			len(leaf.Entries), leaf.Count)
+	}
+	large := build([]byte{7}, 100, 1)
+	if len(large.Entries) != 1 || len(large.Entries[0].Key) != 1 {
+		t.Errorf("entries matching the prefix exactly must always be listed")
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+	"github.com/AsimovNetwork/asimov/vm/fvm/rlp"
+	"github.com/AsimovNetwork/asimov/vm/fvm/trie"
+)
+
+// StateExportVersion is the version of the format written by ExportState.
+const StateExportVersion = 1
+
+// emptyStorageRoot is the storage root of the accounts without storage.
+var emptyStorageRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// StateExport describes a state dump written by ExportState.
+type StateExport struct {
+	Height       int32
+	Hash         common.Hash
+	StateRoot    common.Hash
+	Holdings     int
+	Accounts     int
+	StorageSlots int
+	Size         int64
+	DumpHash     [sha256.Size]byte
+}
+
+// holdingKey identifies the outputs of an asset owned by a script.  Id is the
+// token of an indivisible asset and zero otherwise.
+type holdingKey struct {
+	owner string
+	asset protos.Asset
+	id    int64
+}
+
+// stateHoldings aggregates the unspent outputs by owner and asset.  The value
+// of a divisible asset is the total amount and the value of an indivisible
+// asset the number of outputs holding the token.
+type stateHoldings map[holdingKey]int64
+
+// add adds, or removes when sign is negative, an output to the holdings.
+func (h stateHoldings) add(pkScript []byte, asset *protos.Asset, amount int64, sign int64) {
+	// Outputs without a standard address are owned by their script.
+	owner := "script:" + hex.EncodeToString(pkScript)
+	if _, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript); err == nil && len(addrs) > 0 {
+		owner = addrs[0].EncodeAddress()
+	}
+	key := holdingKey{owner: owner, asset: *asset}
+	if asset.IsIndivisible() {
+		key.id = amount
+		amount = 1
+	}
+	h[key] += sign * amount
+	if h[key] == 0 {
+		delete(h, key)
+	}
+}
+
+// lines returns the holdings formatted as dump records, sorted.
+func (h stateHoldings) lines() []string {
+	lines := make([]string, 0, len(h))
+	for key, value := range h {
+		asset := hex.EncodeToString(key.asset.Bytes())
+		if key.asset.IsIndivisible() {
+			for i := int64(0); i < value; i++ {
+				lines = append(lines, fmt.Sprintf("token %s %s %d",
+					key.owner, asset, key.id))
+			}
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("balance %s %s %d", key.owner,
+			asset, value))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// holdingsAt returns the holdings of the unspent outputs after the main chain
+// block at the passed height was connected.  The utxo set only exists at the
+// tip, so the blocks above the height are rolled back with their spend
+// journals.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) holdingsAt(height int32, interrupt <-chan struct{}) (stateHoldings, error) {
+	err := b.utxoCache.flush(b.bestChain.Tip())
+	if err != nil {
+		return nil, err
+	}
+
+	holdings := make(stateHoldings)
+	err = b.db.View(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		err := utxoBucket.ForEach(func(k, serialized []byte) error {
+			if interruptRequested(interrupt) {
+				return ErrInterruptRequested
+			}
+			entry, err := DeserializeUtxoEntry(serialized)
+			if err != nil {
+				return err
+			}
+			holdings.add(entry.PkScript(), entry.Asset(), entry.Amount(), 1)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for node := b.bestChain.Tip(); node.height > height; node = node.parent {
+			if interruptRequested(interrupt) {
+				return ErrInterruptRequested
+			}
+			block, err := dbFetchBlockByNode(dbTx, node)
+			if err != nil {
+				return err
+			}
+			vblockBytes, err := dbTx.FetchBlock(database.NewVirtualBlockKey(&node.hash))
+			if err != nil {
+				return err
+			}
+			vblock, err := asiutil.NewVBlockFromBytes(vblockBytes, &node.hash)
+			if err != nil {
+				return err
+			}
+			for _, txns := range [][]*protos.MsgTx{block.MsgBlock().Transactions,
+				vblock.MsgVBlock().VTransactions} {
+				for _, tx := range txns {
+					for _, txOut := range tx.TxOut {
+						if txscript.IsUnspendable(txOut.PkScript) || txOut.Value <= 0 {
+							continue
+						}
+						holdings.add(txOut.PkScript, &txOut.Asset, txOut.Value, -1)
+					}
+				}
+			}
+			stxos, err := dbFetchSpendJournalEntry(dbTx, block, vblock)
+			if err != nil {
+				return err
+			}
+			for i := range stxos {
+				holdings.add(stxos[i].PkScript, stxos[i].Asset, stxos[i].Amount, 1)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holdings, nil
+}
+
+// ExportState writes a canonical dump of the state after the main chain block
+// at the passed height was connected.  Nodes holding the same chain write the
+// same bytes, so the hash of the dump can be compared independently.
+//
+// The dump is made of one record per line, with space separated fields:
+//
+//	balance <owner> <asset> <amount>   total unspent amount of a divisible asset
+//	token <owner> <asset> <id>         unspent token of an indivisible asset
+//	account <address> <nonce> <balance> <codehash>
+//	storage <address> <key> <value>    contract storage slot of the account above
+//
+// The balance and token records come first, sorted.  The account records
+// follow in the order of the state trie, which is the order of the hash of
+// their address, each followed by its storage records in the order of the
+// hash of their key.  Assets, hashes, keys and values are hex encoded.
+//
+// ErrInterruptRequested is returned when the interrupt channel is closed
+// before the dump is complete.  It can be nil.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportState(height int32, w io.Writer, interrupt <-chan struct{}) (*StateExport, error) {
+	b.chainLock.RLock()
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil {
+		b.chainLock.RUnlock()
+		str := fmt.Sprintf("no block node at height %d exists in the main chain", height)
+		return nil, errNotInMainChain(str)
+	}
+	holdings, err := b.holdingsAt(height, interrupt)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	export := &StateExport{
+		Height:    height,
+		Hash:      node.hash,
+		StateRoot: node.stateRoot,
+	}
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, hasher)}
+	bw := bufio.NewWriter(counter)
+
+	lines := holdings.lines()
+	for _, line := range lines {
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	}
+	export.Holdings = len(lines)
+
+	accounts, err := b.stateCache.OpenTrie(node.stateRoot)
+	if err != nil {
+		return nil, err
+	}
+	it := trie.NewIterator(accounts.NodeIterator(nil))
+	for it.Next() {
+		if interruptRequested(interrupt) {
+			return nil, ErrInterruptRequested
+		}
+		addr := accounts.GetKey(it.Key)
+		if addr == nil {
+			return nil, fmt.Errorf("missing preimage of account %x", it.Key)
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			return nil, err
+		}
+		address := common.BytesToAddress(addr)
+		fmt.Fprintf(bw, "account %s %d %s %x\n", address.EncodeAddress(),
+			acc.Nonce, acc.Balance, acc.CodeHash)
+		export.Accounts++
+
+		if acc.Root == emptyStorageRoot {
+			continue
+		}
+		storage, err := b.stateCache.OpenStorageTrie(crypto.Keccak256Hash(addr), acc.Root)
+		if err != nil {
+			return nil, err
+		}
+		sit := trie.NewIterator(storage.NodeIterator(nil))
+		for sit.Next() {
+			if interruptRequested(interrupt) {
+				return nil, ErrInterruptRequested
+			}
+			key := storage.GetKey(sit.Key)
+			if key == nil {
+				return nil, fmt.Errorf("missing preimage of storage slot "+
+					"%x of account %s", sit.Key, address.EncodeAddress())
+			}
+			var value []byte
+			if _, content, _, err := rlp.Split(sit.Value); err == nil {
+				value = content
+			}
+			fmt.Fprintf(bw, "storage %s %x %x\n", address.EncodeAddress(),
+				key, value)
+			export.StorageSlots++
+		}
+		if sit.Err != nil {
+			return nil, sit.Err
+		}
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	export.Size = counter.n
+	copy(export.DumpHash[:], hasher.Sum(nil))
+	return export, nil
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes to the underlying writer.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
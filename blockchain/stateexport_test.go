@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// TestStateHoldings ensures the unspent outputs are aggregated by owner and
+// asset, rolled back outputs cancel out and the records are sorted.
+func TestStateHoldings(t *testing.T) {
+	addrA, _ := common.NewAddressWithId(common.PubKeyHashAddrID, make([]byte, 20))
+	addrB, _ := common.NewAddressWithId(common.PubKeyHashAddrID,
+		append(make([]byte, 19), 1))
+	scriptA, err := txscript.PayToAddrScript(addrA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptB, err := txscript.PayToAddrScript(addrB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coin := &protos.Asset{Property: 0, Id: 1}
+	token := &protos.Asset{Property: protos.InDivisibleAsset, Id: 2}
+
+	holdings := make(stateHoldings)
+	holdings.add(scriptB, coin, 10, 1)
+	holdings.add(scriptB, coin, 5, 1)
+	holdings.add(scriptA, coin, 7, 1)
+	holdings.add(scriptA, token, 42, 1)
+	holdings.add(scriptA, token, 43, 1)
+	// Roll back an output of each kind.
+	holdings.add(scriptA, coin, 7, -1)
+	holdings.add(scriptA, token, 43, -1)
+	holdings.add([]byte{0x01}, coin, 3, 1)
+
+	want := []string{
+		"balance " + addrB.EncodeAddress() + " 000000000000000000000001 15",
+		"balance script:01 000000000000000000000001 3",
+		"token " + addrA.EncodeAddress() + " 000000010000000000000002 42",
+	}
+	if got := holdings.lines(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines: got %v, want %v", got, want)
+	}
+}
@@ -67,6 +67,15 @@ func (m *Manager) GetActiveContractByHeight(height int32, delegateAddr common.Co
 	return nil
 }
 
+// GetContractVersions returns all the versions of a system contract ordered by
+// activation height, including the ones scheduled above the current height.
+func (m *Manager) GetContractVersions(delegateAddr common.ContractCode) []chaincfg.ContractInfo {
+	contracts := m.genesisDataCache[delegateAddr]
+	versions := make([]chaincfg.ContractInfo, len(contracts))
+	copy(versions, contracts)
+	return versions
+}
+
 // NewContractManager returns an empty struct of Manager
 func NewContractManager() ainterface.ContractManager {
     return &Manager {}
@@ -6,16 +6,24 @@ package syscontract
 import (
 	"errors"
 	"fmt"
+	"github.com/AsimovNetwork/asimov/ainterface"
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/chaincfg"
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/vm/fvm"
+	"github.com/AsimovNetwork/asimov/vm/fvm/abi"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/vm"
 	"github.com/AsimovNetwork/asimov/vm/fvm/params"
 	"math/big"
+	"strings"
 )
 
+// rewardSplitFunc is the function of the validator committee contract which
+// returns the foundation and burned shares of the block reward, in basis
+// points.  The versions of the contract predating it do not define it.
+const rewardSplitFunc = "getRewardSplit"
+
 var validatorCommitteeAddress = vm.ConvertSystemContractAddress(common.ValidatorCommittee)
 
 // GetFees returns an asset list and their valid heights
@@ -69,3 +77,59 @@ func (m *Manager) GetFees(
 
 	return fees, nil
 }
+
+// GetRewardSplit returns the distribution of the block reward voted by the
+// validator committee.  It returns false when the active version of the
+// contract does not define the distribution.
+func (m *Manager) GetRewardSplit(
+	block *asiutil.Block,
+	stateDB vm.StateDB,
+	chainConfig *params.ChainConfig) (*ainterface.RewardSplit, bool, error) {
+
+	officialAddr := chaincfg.OfficialAddress
+	contract := m.GetActiveContractByHeight(block.Height(), common.ValidatorCommittee)
+	if contract == nil {
+		errStr := fmt.Sprintf("Failed to get active contract %s, %d", common.ValidatorCommittee, block.Height())
+		log.Error(errStr)
+		return nil, false, errors.New(errStr)
+	}
+	definition, err := abi.JSON(strings.NewReader(contract.AbiInfo))
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok := definition.Methods[rewardSplitFunc]; !ok {
+		return nil, false, nil
+	}
+
+	runCode, err := fvm.PackFunctionArgs(contract.AbiInfo, rewardSplitFunc)
+	if err != nil {
+		return nil, false, err
+	}
+	result, _, err := fvm.CallReadOnlyFunction(officialAddr, block, m.chain, stateDB, chainConfig,
+		common.SystemContractReadOnlyGas, validatorCommitteeAddress, runCode)
+	if err != nil {
+		log.Errorf("Get reward split failed, error: %s", err)
+		return nil, false, err
+	}
+	var foundation, burn *big.Int
+	outData := []interface{}{
+		&foundation,
+		&burn,
+	}
+	err = fvm.UnPackFunctionResult(contract.AbiInfo, &outData, rewardSplitFunc, result)
+	if err != nil {
+		log.Errorf("Get reward split failed, error: %s", err)
+		return nil, false, err
+	}
+	if foundation.Sign() < 0 || burn.Sign() < 0 ||
+		new(big.Int).Add(foundation, burn).Cmp(big.NewInt(common.RewardSplitBasis)) > 0 {
+		errStr := fmt.Sprintf("invalid reward split, foundation %v and burn %v "+
+			"exceed %d basis points", foundation, burn, common.RewardSplitBasis)
+		return nil, false, errors.New(errStr)
+	}
+
+	return &ainterface.RewardSplit{
+		Foundation: foundation.Int64(),
+		Burn:       burn.Int64(),
+	}, true, nil
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package syscontract
+
+import (
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/protos"
+	"testing"
+)
+
+// TestGetRewardSplitNoContract ensures the reward split fails without an active
+// validator committee contract.
+func TestGetRewardSplitNoContract(t *testing.T) {
+	m := &Manager{}
+	block := asiutil.NewBlock(&protos.MsgBlock{})
+	split, ok, err := m.GetRewardSplit(block, nil, nil)
+	if err == nil || ok || split != nil {
+		t.Errorf("GetRewardSplit without a contract returned %v, %v, %v",
+			split, ok, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// TestCheckConnectBlockTemplate ensures block proposals extending the tip are
+// validated without being connected, and the others are rejected.
+func TestCheckConnectBlockTemplate(t *testing.T) {
+	privateKeyList := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e",
+	}
+	accList, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(privateKeyList, 1)
+	if err != nil || chain == nil {
+		t.Fatalf("create chain error %v", err)
+	}
+	defer teardownFunc()
+
+	genesisNode := chain.bestChain.tip()
+	validators, filters, _ := chain.GetValidatorsByNode(1, genesisNode)
+	block, _, err := createAndSignBlock(
+		netParam, accList, validators, filters, chain, 1, 0, 0,
+		protos.Asset{}, 0, validators[0],
+		nil, 0, genesisNode)
+	if err != nil {
+		t.Fatalf("create block error %v", err)
+	}
+
+	if err := chain.CheckConnectBlockTemplate(block); err != nil {
+		t.Fatalf("CheckConnectBlockTemplate: unexpected error %v", err)
+	}
+	if tip := chain.bestChain.tip(); tip != genesisNode {
+		t.Fatalf("CheckConnectBlockTemplate connected the block, tip %v", tip.hash)
+	}
+
+	// A proposal not extending the tip is rejected.
+	msgBlock := *block.MsgBlock()
+	msgBlock.Header.PrevBlock = common.Hash{0x01}
+	err = chain.CheckConnectBlockTemplate(asiutil.NewBlock(&msgBlock))
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrPrevBlockNotBest {
+		t.Fatalf("CheckConnectBlockTemplate: got error %v, want %v",
+			err, ErrPrevBlockNotBest)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/tracing"
+)
+
+// exportedSpan is the part of a span exported over OTLP checked by the tests.
+type exportedSpan struct {
+	Name         string `json:"name"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+}
+
+// TestContractExecutionSpans ensures the contract executions of the
+// transactions connected are traced as children of the spans of the
+// transactions.
+func TestContractExecutionSpans(t *testing.T) {
+	var mtx sync.Mutex
+	var spans []exportedSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var traces struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&traces); err != nil {
+			t.Errorf("invalid export request: %v", err)
+		}
+		mtx.Lock()
+		for _, rs := range traces.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		mtx.Unlock()
+	}))
+	defer collector.Close()
+
+	tracer := tracing.New(&tracing.Config{Endpoint: collector.URL, SampleRate: 1})
+	tracer.Start()
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+
+	parivateKeyList := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e", //privateKey0
+	}
+	accList, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(parivateKeyList, 10)
+	if err != nil || chain == nil {
+		t.Fatalf("createFakeChainByPrivateKeys error %v", err)
+	}
+	defer teardownFunc()
+
+	validators, filters, _ := chain.GetValidatorsByNode(1, chain.bestChain.tip())
+	block, _, err := createAndSignBlock(netParam, accList, validators, filters, chain, uint32(1), uint16(0),
+		chain.bestChain.Tip().height, protos.Asset{}, 0,
+		validators[0], nil, 0, chain.bestChain.tip())
+	if err != nil {
+		t.Fatalf("create block error %v", err)
+	}
+	if _, _, err = chain.ProcessBlock(block, nil, nil, nil, common.BFNone); err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	tracer.Stop()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	names := make(map[string]string, len(spans))
+	for _, span := range spans {
+		names[span.SpanID] = span.Name
+	}
+	var connected, nested bool
+	for _, span := range spans {
+		switch parent := names[span.ParentSpanID]; {
+		case span.Name == "vm.Call" && parent == "blockchain.ConnectTransaction":
+			connected = true
+		case strings.HasPrefix(span.Name, "vm.") && strings.HasPrefix(parent, "vm."):
+			nested = true
+		}
+	}
+	if !connected {
+		t.Error("no contract call span child of a transaction span")
+	}
+	if !nested {
+		t.Error("no contract execution span child of another one")
+	}
+}
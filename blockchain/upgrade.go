@@ -0,0 +1,259 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// baseSchemaVersion is the schema version of the buckets of the databases
+// created before the schema versions were recorded.
+const baseSchemaVersion = 1
+
+// schemaVersionsBucketName is the name of the db bucket used to house the
+// schema version of each bucket of the chain state.
+var schemaVersionsBucketName = []byte("schemaversions")
+
+// versionedBuckets are the buckets of the chain state which have a schema
+// version.  The optional indexes are not versioned since they can be dropped
+// and rebuilt from the blocks instead.
+var versionedBuckets = [][]byte{
+	blockIndexBucketName,
+	roundIndexBucketName,
+	hashIndexBucketName,
+	spendJournalBucketName,
+	utxoSetBucketName,
+	balanceBucketName,
+	lockSetBucketName,
+	assetsSetBucketName,
+	signatureSetBucketName,
+	blockArrivalBucketName,
+}
+
+// migration upgrades the format of a bucket of the chain state to a schema
+// version.
+type migration struct {
+	// bucket is the name of the bucket upgraded.
+	bucket []byte
+
+	// version is the schema version of the bucket once upgraded.  It must
+	// follow the version of the previous migration of the bucket, or the
+	// base version for the first one.
+	version uint32
+
+	// description describes the change of the format for the logs.
+	description string
+
+	// migrate upgrades the bucket in the passed database transaction.  The
+	// changes are rolled back when it fails.
+	migrate func(dbTx database.Tx, interrupt <-chan struct{}) error
+}
+
+// migrations are the migrations of the chain state, in the order they are run
+// at startup.  A change of the format of a bucket appends a migration to the
+// list, so the databases in the previous format are upgraded in place rather
+// than resynced.
+var migrations = []migration{
+	{blockIndexBucketName, 2, "check no stored transaction is flagged " +
+		"with an access list", checkAccessListFlags},
+}
+
+// checkAccessListFlags ensures none of the stored blocks holds a transaction
+// whose version has the TxFlagAccessList flag.  The flag was an ordinary bit
+// of the version before access lists were added, and such a transaction would
+// now be decoded with an access list it was not validated with.  The blocks
+// pruned, or not downloaded yet, are skipped.
+func checkAccessListFlags(dbTx database.Tx, interrupt <-chan struct{}) error {
+	bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(func(k, _ []byte) error {
+		if interruptRequested(interrupt) {
+			return ErrInterruptRequested
+		}
+		if len(k) != common.HashLength+4 {
+			return nil
+		}
+		hash := common.BytesToHash(k[4:])
+		blockBytes, err := dbTx.FetchBlock(database.NewNormalBlockKey(&hash))
+		if err != nil {
+			if dbErr, ok := err.(database.Error); ok &&
+				dbErr.ErrorCode == database.ErrBlockNotFound {
+				return nil
+			}
+			return err
+		}
+
+		var block protos.MsgBlock
+		if err := block.Deserialize(bytes.NewReader(blockBytes)); err != nil {
+			return fmt.Errorf("block %v can not be decoded: %v", hash, err)
+		}
+		for _, tx := range block.Transactions {
+			if tx.HasAccessList() {
+				return fmt.Errorf("transaction %v of block %v has the "+
+					"access list flag in its version %#x", tx.TxHash(),
+					hash, tx.Version)
+			}
+		}
+		return nil
+	})
+}
+
+// latestSchemaVersions returns the schema version of each versioned bucket
+// once the passed migrations are run, keyed by bucket name.
+func latestSchemaVersions(migrations []migration) map[string]uint32 {
+	versions := make(map[string]uint32, len(versionedBuckets))
+	for _, bucket := range versionedBuckets {
+		versions[string(bucket)] = baseSchemaVersion
+	}
+	for _, m := range migrations {
+		if m.version > versions[string(m.bucket)] {
+			versions[string(m.bucket)] = m.version
+		}
+	}
+	return versions
+}
+
+// dbFetchSchemaVersions returns the schema version of each versioned bucket,
+// keyed by bucket name.  The buckets without a version have the base one.
+func dbFetchSchemaVersions(dbTx database.Tx) map[string]uint32 {
+	versions := make(map[string]uint32, len(versionedBuckets))
+	bucket := dbTx.Metadata().Bucket(schemaVersionsBucketName)
+	for _, name := range versionedBuckets {
+		versions[string(name)] = baseSchemaVersion
+		if bucket == nil {
+			continue
+		}
+		if serialized := bucket.Get(name); len(serialized) == 4 {
+			versions[string(name)] = byteOrder.Uint32(serialized)
+		}
+	}
+	return versions
+}
+
+// dbPutSchemaVersion uses an existing database transaction to store the
+// schema version of the passed bucket.
+func dbPutSchemaVersion(dbTx database.Tx, name []byte, version uint32) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(schemaVersionsBucketName)
+	if err != nil {
+		return err
+	}
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], version)
+	return bucket.Put(name, serialized[:])
+}
+
+// dbPutSchemaVersions uses an existing database transaction to store the
+// passed schema versions, keyed by bucket name.
+func dbPutSchemaVersions(dbTx database.Tx, versions map[string]uint32) error {
+	for _, name := range versionedBuckets {
+		err := dbPutSchemaVersion(dbTx, name, versions[string(name)])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigrations upgrades the schema of the chain state of the passed database
+// by running the migrations the buckets have not been through yet, in order.
+// Each migration runs in its own database transaction along with the update
+// of the version of its bucket, so a failing migration is rolled back and
+// leaves the bucket at its previous version.  The migrations already run are
+// kept.
+//
+// An error is returned when a bucket has a version more recent than the
+// migrations know of, which is the case of a database upgraded by a more
+// recent release, or when migrations are pending on a read-only database.
+func runMigrations(db database.Transactor, migrations []migration,
+	readOnly bool, interrupt <-chan struct{}) error {
+
+	var versions map[string]uint32
+	err := db.View(func(dbTx database.Tx) error {
+		versions = dbFetchSchemaVersions(dbTx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	latest := latestSchemaVersions(migrations)
+	for _, bucket := range versionedBuckets {
+		name := string(bucket)
+		if versions[name] > latest[name] {
+			return fmt.Errorf("the %s bucket of the database has schema "+
+				"version %d, more recent than the version %d supported "+
+				"by this release", name, versions[name], latest[name])
+		}
+	}
+
+	// Select the pending migrations, ensuring each one upgrades its bucket
+	// from the version left by the previous one.
+	var pending []migration
+	next := make(map[string]uint32, len(versions))
+	for name, version := range versions {
+		next[name] = version
+	}
+	for _, m := range migrations {
+		name := string(m.bucket)
+		if _, ok := next[name]; !ok {
+			return fmt.Errorf("migration to version %d of the %s bucket "+
+				"upgrades a bucket without a schema version", m.version,
+				name)
+		}
+		if m.version <= versions[name] {
+			continue
+		}
+		if m.version != next[name]+1 {
+			return fmt.Errorf("migration to version %d of the %s bucket "+
+				"does not follow version %d", m.version, name, next[name])
+		}
+		next[name] = m.version
+		pending = append(pending, m)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if readOnly {
+		return fmt.Errorf("the database schema needs %d migrations, "+
+			"which can not be run on a read-only database", len(pending))
+	}
+
+	log.Infof("Upgrading the database schema, %d migrations to run",
+		len(pending))
+	for i, m := range pending {
+		if interruptRequested(interrupt) {
+			return ErrInterruptRequested
+		}
+
+		name := string(m.bucket)
+		log.Infof("Migration %d of %d: upgrading the %s bucket from "+
+			"version %d to %d: %s", i+1, len(pending), name,
+			m.version-1, m.version, m.description)
+		start := time.Now()
+		err := db.Update(func(dbTx database.Tx) error {
+			if err := m.migrate(dbTx, interrupt); err != nil {
+				return err
+			}
+			return dbPutSchemaVersion(dbTx, m.bucket, m.version)
+		})
+		if err != nil {
+			return fmt.Errorf("migration to version %d of the %s bucket "+
+				"failed and was rolled back: %v", m.version, name, err)
+		}
+		log.Infof("Migration %d of %d done in %v", i+1, len(pending),
+			time.Since(start).Round(time.Millisecond))
+	}
+	log.Infof("Database schema upgraded")
+	return nil
+}
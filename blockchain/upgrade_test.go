@@ -0,0 +1,177 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// TestRunMigrations ensures the migrations of the chain state are run in
+// order, once, and that a failing migration is rolled back.
+func TestRunMigrations(t *testing.T) {
+	chain, teardownFunc, err := newFakeChain(&chaincfg.DevelopNetParams)
+	if err != nil || chain == nil {
+		t.Fatalf("newFakeChain error %v", err)
+	}
+	defer teardownFunc()
+
+	fetchVersions := func() map[string]uint32 {
+		var versions map[string]uint32
+		chain.db.View(func(dbTx database.Tx) error {
+			versions = dbFetchSchemaVersions(dbTx)
+			return nil
+		})
+		return versions
+	}
+	hasKey := func(key string) bool {
+		var found bool
+		chain.db.View(func(dbTx database.Tx) error {
+			found = dbTx.Metadata().Get([]byte(key)) != nil
+			return nil
+		})
+		return found
+	}
+	putKey := func(key string) func(database.Tx, <-chan struct{}) error {
+		return func(dbTx database.Tx, interrupt <-chan struct{}) error {
+			return dbTx.Metadata().Put([]byte(key), []byte{1})
+		}
+	}
+
+	// A new chain state is created with the latest versions.
+	var stored bool
+	chain.db.View(func(dbTx database.Tx) error {
+		stored = dbTx.Metadata().Bucket(schemaVersionsBucketName) != nil
+		return nil
+	})
+	if !stored {
+		t.Fatal("schema versions not stored on creation")
+	}
+	utxoSet := string(utxoSetBucketName)
+	if version := fetchVersions()[utxoSet]; version != baseSchemaVersion {
+		t.Fatalf("utxo set version %d, want %d", version, baseSchemaVersion)
+	}
+
+	// The test migrations follow the migrations of the release.
+	n := len(migrations)
+	errFailed := errors.New("failed")
+	upgrade := append(migrations[:n:n], []migration{
+		{utxoSetBucketName, 2, "test", putKey("migrated2")},
+		{spendJournalBucketName, 2, "test", putKey("journal2")},
+		{utxoSetBucketName, 3, "test",
+			func(dbTx database.Tx, interrupt <-chan struct{}) error {
+				if err := putKey("migrated3")(dbTx, interrupt); err != nil {
+					return err
+				}
+				return errFailed
+			},
+		},
+	}...)
+	if err := runMigrations(chain.db, upgrade, true, nil); err == nil {
+		t.Fatal("migrations run on a read-only database")
+	}
+	if version := fetchVersions()[utxoSet]; version != baseSchemaVersion ||
+		hasKey("migrated2") {
+
+		t.Errorf("utxo set version %d after migrating a read-only "+
+			"database, want %d", version, baseSchemaVersion)
+	}
+	if err := runMigrations(chain.db, upgrade, false, nil); err == nil {
+		t.Fatal("failing migration succeeded")
+	}
+	versions := fetchVersions()
+	if versions[utxoSet] != 2 || versions[string(spendJournalBucketName)] != 2 {
+		t.Errorf("versions %v after failed migration, want 2", versions)
+	}
+	if !hasKey("migrated2") || !hasKey("journal2") {
+		t.Error("changes of the successful migrations lost")
+	}
+	if hasKey("migrated3") {
+		t.Error("changes of the failed migration not rolled back")
+	}
+
+	// The migrations already run are skipped.
+	upgrade[n].migrate = func(database.Tx, <-chan struct{}) error {
+		t.Error("migration run twice")
+		return nil
+	}
+	upgrade[n+2].migrate = putKey("migrated3")
+	if err := runMigrations(chain.db, upgrade, false, nil); err != nil {
+		t.Fatalf("runMigrations: %v", err)
+	}
+	if version := fetchVersions()[utxoSet]; version != 3 || !hasKey("migrated3") {
+		t.Errorf("utxo set version %d after migration, want 3", version)
+	}
+
+	// A database more recent than the migrations is refused.
+	if err := runMigrations(chain.db, upgrade[:n+1], false, nil); err == nil {
+		t.Error("more recent schema version accepted")
+	}
+
+	// The versions of a bucket must follow each other.
+	gap := append(upgrade, migration{utxoSetBucketName, 5, "test",
+		putKey("migrated5")})
+	if err := runMigrations(chain.db, gap, false, nil); err == nil {
+		t.Error("migration skipping a version accepted")
+	}
+	if hasKey("migrated5") {
+		t.Error("migration skipping a version run")
+	}
+}
+
+// TestCheckAccessListFlags ensures a stored block holding a transaction whose
+// version has the access list flag is refused.
+func TestCheckAccessListFlags(t *testing.T) {
+	chain, teardownFunc, err := newFakeChain(&chaincfg.DevelopNetParams)
+	if err != nil || chain == nil {
+		t.Fatalf("newFakeChain error %v", err)
+	}
+	defer teardownFunc()
+
+	check := func() error {
+		return chain.db.Update(func(dbTx database.Tx) error {
+			return checkAccessListFlags(dbTx, nil)
+		})
+	}
+	if err := check(); err != nil {
+		t.Fatalf("checkAccessListFlags: %v", err)
+	}
+
+	// A block whose index entry has no stored block is skipped.
+	header := chaincfg.DevelopNetParams.GenesisBlock.Header
+	header.Height = 1
+	tx := protos.NewMsgTx(protos.TxVersion)
+	tx.SetAccessList([]protos.AccessTuple{{Address: common.Address{0x66, 0x01}}})
+	block := asiutil.NewBlock(&protos.MsgBlock{
+		Header:       header,
+		Transactions: []*protos.MsgTx{tx},
+	})
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(blockIndexBucketName).Put(
+			blockIndexKey(block.Hash(), 1), []byte{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(); err != nil {
+		t.Fatalf("checkAccessListFlags with a missing block: %v", err)
+	}
+
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlock(dbTx, block)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(); err == nil {
+		t.Fatal("block with a flagged transaction accepted")
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// utxoCacheStateKeyName is the name of the db key used to store the block
+// up to which the changes of the utxo cache were written to the utxo set.
+// The blocks of the main chain above it are replayed on start, as their
+// changes were lost by an unclean shutdown.
+var utxoCacheStateKeyName = []byte("utxocachestate")
+
+const (
+	// utxoFlushInterval is the longest the modified outputs are kept in
+	// the utxo cache before they are written to the database.
+	utxoFlushInterval = 5 * time.Minute
+
+	// utxoCacheEntryOverhead is the approximate memory, besides its public
+	// key script, used by a cached output: the outpoint, the entry, its
+	// asset and the map bucket.
+	utxoCacheEntryOverhead = 36 + 72 + 16 + 48
+)
+
+// utxoCacheEntry is an output held by the utxo cache.
+type utxoCacheEntry struct {
+	// entry is nil when the output was spent.
+	entry *txo.UtxoEntry
+
+	// dirty is set when the output differs from the utxo set in the
+	// database.
+	dirty bool
+}
+
+// utxoCache sits in front of the utxo set in the database.  It keeps the
+// outputs read from the database and the ones modified by the connected
+// blocks, which are written in a single database transaction periodically,
+// when the cache exceeds its size and on shutdown, instead of with every
+// block.
+type utxoCache struct {
+	db      database.Transactor
+	maxSize uint64
+
+	mtx       sync.Mutex
+	entries   map[protos.OutPoint]*utxoCacheEntry
+	size      uint64
+	dirty     int
+	lastFlush time.Time
+}
+
+// newUtxoCache returns a utxo cache of the outputs in the passed database,
+// which uses up to maxSize bytes.
+func newUtxoCache(db database.Transactor, maxSize uint64) *utxoCache {
+	return &utxoCache{
+		db:        db,
+		maxSize:   maxSize,
+		entries:   make(map[protos.OutPoint]*utxoCacheEntry),
+		lastFlush: time.Now(),
+	}
+}
+
+// cacheEntrySize returns the approximate memory used by a cached output.
+func cacheEntrySize(entry *txo.UtxoEntry) uint64 {
+	if entry == nil {
+		return utxoCacheEntryOverhead
+	}
+	return utxoCacheEntryOverhead + uint64(len(entry.PkScript()))
+}
+
+// cachedCopy returns an unmodified copy of the passed entry which shares no
+// mutable state with it, since the views modify their entries.
+func cachedCopy(entry *txo.UtxoEntry) *txo.UtxoEntry {
+	entry = entry.Clone()
+	if entry.IsModified() {
+		entry.ResetModified()
+	}
+	if entry.LockItem() != nil {
+		entry.SetLockItem(entry.LockItem().Clone())
+	}
+	return entry
+}
+
+// put replaces the cached output of the passed outpoint.
+//
+// This function MUST be called with the cache lock held.
+func (c *utxoCache) put(outpoint protos.OutPoint, entry *txo.UtxoEntry, dirty bool) {
+	c.remove(outpoint)
+	c.entries[outpoint] = &utxoCacheEntry{entry: entry, dirty: dirty}
+	c.size += cacheEntrySize(entry)
+	if dirty {
+		c.dirty++
+	}
+}
+
+// remove drops the cached output of the passed outpoint.
+//
+// This function MUST be called with the cache lock held.
+func (c *utxoCache) remove(outpoint protos.OutPoint) {
+	cached, ok := c.entries[outpoint]
+	if !ok {
+		return
+	}
+	delete(c.entries, outpoint)
+	c.size -= cacheEntrySize(cached.entry)
+	if cached.dirty {
+		c.dirty--
+	}
+}
+
+// evict drops unmodified outputs until the cache fits in its size.  The
+// modified outputs are only dropped once they were flushed.
+//
+// This function MUST be called with the cache lock held.
+func (c *utxoCache) evict() {
+	for outpoint, cached := range c.entries {
+		if c.size <= c.maxSize {
+			return
+		}
+		if !cached.dirty {
+			c.remove(outpoint)
+		}
+	}
+}
+
+// fetchEntries adds the outputs of the passed outpoints to the view, from
+// the cache when they are cached and from the database otherwise.  Missing
+// outputs are added as nil entries, like FetchUtxosMain does.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) fetchEntries(view *txo.UtxoViewpoint, outpoints map[protos.OutPoint]struct{}) error {
+	if len(outpoints) == 0 {
+		return nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var missing []protos.OutPoint
+	for outpoint := range outpoints {
+		cached, ok := c.entries[outpoint]
+		if !ok {
+			missing = append(missing, outpoint)
+			continue
+		}
+		if cached.entry == nil {
+			view.AddEntry(outpoint, nil)
+			continue
+		}
+		view.AddEntry(outpoint, cachedCopy(cached.entry))
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	err := c.db.View(func(dbTx database.Tx) error {
+		for _, outpoint := range missing {
+			entry, err := dbFetchUtxoEntry(dbTx, outpoint)
+			if err != nil {
+				return err
+			}
+
+			view.AddEntry(outpoint, entry)
+			if entry != nil {
+				c.put(outpoint, cachedCopy(entry), false)
+			}
+		}
+		return nil
+	})
+	c.evict()
+	return err
+}
+
+// commit records the outputs modified by the passed view, which must not
+// have been committed yet.  They are written to the database by the next
+// flush when dirty is set, otherwise the view was already written to the
+// database.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) commit(view *txo.UtxoViewpoint, dirty bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.Entries() {
+		if entry == nil || !entry.IsModified() {
+			continue
+		}
+
+		if entry.IsSpent() {
+			if dirty {
+				c.put(outpoint, nil, true)
+			} else {
+				c.remove(outpoint)
+			}
+			continue
+		}
+		c.put(outpoint, cachedCopy(entry), dirty)
+	}
+	c.evict()
+}
+
+// needsFlush returns whether the modified outputs should be written to the
+// database, because the cache is full of them or they were kept long
+// enough.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) needsFlush() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.dirty == 0 {
+		return false
+	}
+	return c.size > c.maxSize || time.Since(c.lastFlush) >= utxoFlushInterval
+}
+
+// flush writes the modified outputs to the utxo set in the database, along
+// with the passed best block they reflect the utxo set at.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) flush(tip *blockNode) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err := c.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		for outpoint, cached := range c.entries {
+			if !cached.dirty {
+				continue
+			}
+
+			key := outpointKey(outpoint)
+			if cached.entry == nil {
+				err := utxoBucket.Delete(*key)
+				recycleOutpointKey(key)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			serialized, err := serializeUtxoEntry(cached.entry)
+			if err != nil {
+				return err
+			}
+			if err := utxoBucket.Put(*key, serialized); err != nil {
+				return err
+			}
+		}
+
+		return dbPutUtxoCacheState(dbTx, &tip.hash, tip.height)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Flushed %d utxo changes at height %d", c.dirty, tip.height)
+
+	for outpoint, cached := range c.entries {
+		if !cached.dirty {
+			continue
+		}
+		if cached.entry == nil {
+			c.remove(outpoint)
+			continue
+		}
+		cached.dirty = false
+	}
+	c.dirty = 0
+	c.lastFlush = time.Now()
+	c.evict()
+	return nil
+}
+
+// dbPutUtxoCacheState uses an existing database transaction to store the
+// block up to which the utxo set in the database is current.
+func dbPutUtxoCacheState(dbTx database.Tx, hash *common.Hash, height int32) error {
+	serialized := make([]byte, common.HashLength+4)
+	copy(serialized, hash[:])
+	byteOrder.PutUint32(serialized[common.HashLength:], uint32(height))
+	return dbTx.Metadata().Put(utxoCacheStateKeyName, serialized)
+}
+
+// dbFetchUtxoCacheState uses an existing database transaction to fetch the
+// block up to which the utxo set in the database is current.  A nil hash is
+// returned when the state was never stored.
+func dbFetchUtxoCacheState(dbTx database.Tx) (*common.Hash, int32, error) {
+	serialized := dbTx.Metadata().Get(utxoCacheStateKeyName)
+	if serialized == nil {
+		return nil, 0, nil
+	}
+	if len(serialized) != common.HashLength+4 {
+		return nil, 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo cache state",
+		}
+	}
+
+	var hash common.Hash
+	copy(hash[:], serialized)
+	height := int32(byteOrder.Uint32(serialized[common.HashLength:]))
+	return &hash, height, nil
+}
+
+// recoverUtxoSet brings the utxo set in the database up to date with the
+// best chain after an unclean shutdown, by connecting again the blocks
+// whose changes were still in the utxo cache.
+//
+// This function MUST be called after the chain state is loaded.
+func (b *BlockChain) recoverUtxoSet() error {
+	tip := b.bestChain.Tip()
+
+	var hash *common.Hash
+	var height int32
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		hash, height, err = dbFetchUtxoCacheState(dbTx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The utxo set of databases created before the cache, or loaded from
+	// a snapshot, is written with every block.
+	if hash == nil {
+		if b.readOnly {
+			return nil
+		}
+		return b.db.Update(func(dbTx database.Tx) error {
+			return dbPutUtxoCacheState(dbTx, &tip.hash, tip.height)
+		})
+	}
+	if *hash == tip.hash {
+		return nil
+	}
+
+	// The cache is flushed before a block is disconnected, so the utxo
+	// set is always at an ancestor of the best block.
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("utxo set is at block %v (height "+
+				"%d) which is not in the main chain", hash, height),
+		}
+	}
+
+	log.Infof("Recovering the utxo set from height %d to %d after an "+
+		"unclean shutdown", node.height, tip.height)
+
+	for node = b.bestChain.Next(node); node != nil; node = b.bestChain.Next(node) {
+		block, vblock, err := asiutil.GetBlockPair(b.db, &node.hash)
+		if err != nil {
+			return err
+		}
+
+		view := txo.NewUtxoViewpoint()
+		err = fetchInputUtxos(view, b.utxoCache, block)
+		if err != nil {
+			return err
+		}
+		err = connectTransactions(view, b.utxoCache, block, vblock, nil)
+		if err != nil {
+			return err
+		}
+		b.utxoCache.commit(view, true)
+	}
+
+	// The recovered outputs are kept in the cache of a read-only database.
+	if b.readOnly {
+		return nil
+	}
+	return b.utxoCache.flush(tip)
+}
+
+// FlushUtxoCache writes the outputs modified since the last flush of the utxo
+// cache to the database.  It should be called before shutting down, or the
+// blocks connected since the last flush are replayed on the next start.
+// Nothing is written when the databases are opened read-only.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache() error {
+	if b.readOnly {
+		return nil
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.utxoCache.flush(b.bestChain.Tip())
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/database/dbdriver"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// newUtxoCacheTestDB returns a database holding empty utxo and lock sets.
+func newUtxoCacheTestDB(t *testing.T) (database.Database, func()) {
+	dir, err := ioutil.TempDir("", "utxocache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	db, err := dbdriver.Create(testDbType, filepath.Join(dir, "db"), common.DevelopNet)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Create: %v", err)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		if _, err := dbTx.Metadata().CreateBucket(utxoSetBucketName); err != nil {
+			return err
+		}
+		_, err := dbTx.Metadata().CreateBucket(lockSetBucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		t.Fatalf("Update: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// fetchStoredEntry returns the entry of the passed outpoint in the utxo set
+// of the database.
+func fetchStoredEntry(t *testing.T, db database.Database, outpoint protos.OutPoint) *txo.UtxoEntry {
+	var entry *txo.UtxoEntry
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchUtxoEntry(dbTx, outpoint)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dbFetchUtxoEntry: %v", err)
+	}
+	return entry
+}
+
+// addTestOutput adds a modified output of the passed amount to the view.
+func addTestOutput(t *testing.T, view *txo.UtxoViewpoint, outpoint protos.OutPoint, amount int64) {
+	addr, _ := common.NewAddressWithId(common.PubKeyHashAddrID, []byte{1})
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	txOut := &protos.TxOut{Value: amount, PkScript: pkScript, Asset: asiutil.AsimovAsset}
+	view.AddTxOut(outpoint, txOut, false, 1, nil)
+}
+
+// TestUtxoCache ensures the utxo cache serves the outputs modified by the
+// views before they are flushed, and writes them to the database along with
+// the block the utxo set is at.
+func TestUtxoCache(t *testing.T) {
+	db, teardown := newUtxoCacheTestDB(t)
+	defer teardown()
+
+	cache := newUtxoCache(db, 1024*1024)
+	spent := protos.OutPoint{Hash: common.Hash{1}, Index: 0}
+	created := protos.OutPoint{Hash: common.Hash{2}, Index: 1}
+
+	// Store an output in the database, then spend it and create another
+	// one in a view committed to the cache.
+	view := txo.NewUtxoViewpoint()
+	addTestOutput(t, view, spent, 10)
+	err := db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		t.Fatalf("dbPutUtxoView: %v", err)
+	}
+	if fetchStoredEntry(t, db, spent) == nil {
+		t.Fatal("stored output is missing from the database")
+	}
+
+	view = txo.NewUtxoViewpoint()
+	needed := map[protos.OutPoint]struct{}{spent: {}, created: {}}
+	if err := cache.fetchEntries(view, needed); err != nil {
+		t.Fatalf("fetchEntries: %v", err)
+	}
+	if view.LookupEntry(spent) == nil || view.LookupEntry(created) != nil {
+		t.Fatal("fetchEntries did not load the stored output only")
+	}
+	view.LookupEntry(spent).Spend()
+	addTestOutput(t, view, created, 20)
+	cache.commit(view, true)
+
+	// The cache serves the changes while the database doesn't have them.
+	view = txo.NewUtxoViewpoint()
+	if err := cache.fetchEntries(view, needed); err != nil {
+		t.Fatalf("fetchEntries: %v", err)
+	}
+	if view.LookupEntry(spent) != nil {
+		t.Fatal("cache returned the spent output")
+	}
+	entry := view.LookupEntry(created)
+	if entry == nil || entry.Amount() != 20 || entry.IsModified() {
+		t.Fatalf("cache returned %v for the created output", entry)
+	}
+	if fetchStoredEntry(t, db, spent) == nil || fetchStoredEntry(t, db, created) != nil {
+		t.Fatal("changes were written to the database before the flush")
+	}
+
+	// Flushing writes the changes along with the block.
+	tip := &blockNode{hash: common.Hash{3}, height: 2}
+	if err := cache.flush(tip); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if fetchStoredEntry(t, db, spent) != nil || fetchStoredEntry(t, db, created) == nil {
+		t.Fatal("flush did not write the changes to the database")
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		hash, height, err := dbFetchUtxoCacheState(dbTx)
+		if err != nil {
+			return err
+		}
+		if hash == nil || *hash != tip.hash || height != tip.height {
+			t.Fatalf("utxo cache state: got %v at %d, want %v at %d",
+				hash, height, tip.hash, tip.height)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if cache.dirty != 0 || cache.needsFlush() {
+		t.Fatalf("%d outputs are still dirty after the flush", cache.dirty)
+	}
+}
+
+// TestUtxoCacheEviction ensures the utxo cache only drops the outputs which
+// were written to the database to fit in its size.
+func TestUtxoCacheEviction(t *testing.T) {
+	db, teardown := newUtxoCacheTestDB(t)
+	defer teardown()
+
+	cache := newUtxoCache(db, 0)
+	view := txo.NewUtxoViewpoint()
+	for i := uint32(0); i < 4; i++ {
+		outpoint := protos.OutPoint{Hash: common.Hash{1}, Index: i}
+		addTestOutput(t, view, outpoint, 1)
+	}
+	cache.commit(view, true)
+	if len(cache.entries) != 4 || cache.dirty != 4 {
+		t.Fatalf("got %d cached and %d dirty outputs, want 4 and 4",
+			len(cache.entries), cache.dirty)
+	}
+	if !cache.needsFlush() {
+		t.Fatal("full cache does not need a flush")
+	}
+
+	if err := cache.flush(&blockNode{hash: common.Hash{2}, height: 1}); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(cache.entries) != 0 || cache.size != 0 {
+		t.Fatalf("got %d cached outputs of %d bytes after the flush, want none",
+			len(cache.entries), cache.size)
+	}
+	view = txo.NewUtxoViewpoint()
+	outpoint := protos.OutPoint{Hash: common.Hash{1}, Index: 3}
+	err := cache.fetchEntries(view, map[protos.OutPoint]struct{}{outpoint: {}})
+	if err != nil {
+		t.Fatalf("fetchEntries: %v", err)
+	}
+	if view.LookupEntry(outpoint) == nil {
+		t.Fatal("evicted output is missing from the database")
+	}
+}
@@ -0,0 +1,508 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+	"github.com/AsimovNetwork/asimov/vm/fvm/rlp"
+	"github.com/AsimovNetwork/asimov/vm/fvm/trie"
+)
+
+// ErrSnapshotChainExists is returned by LoadSnapshot when the database
+// already holds a chain.
+var ErrSnapshotChainExists = errors.New("the database already holds a chain")
+
+// snapshotSkippedBuckets are the metadata buckets left out of a snapshot: the
+// spend journal, only needed to disconnect the blocks below the snapshot, the
+// arrival times observed locally, and the index of the block files of the
+// database, which is rebuilt as the blocks are stored.
+var snapshotSkippedBuckets = [][]byte{
+	spendJournalBucketName,
+	blockArrivalBucketName,
+	[]byte("ffldb-blockidx"),
+}
+
+// SnapshotInfo describes a snapshot written by DumpSnapshot.
+type SnapshotInfo struct {
+	Header  SnapshotHeader
+	Records int
+	Size    int64
+	Hash    common.Hash
+}
+
+// DumpSnapshot writes a snapshot of the chain state at the best block, from
+// which LoadSnapshot bootstraps a new node.  The snapshot holds the metadata
+// of the chain and its indexes, among which the utxo set, the main chain
+// block index and the rounds, the state trie and contract codes, and the
+// genesis and best blocks along with the blocks holding contract templates.
+// The other blocks and the spend journal are left out, so the node loading
+// the snapshot can not serve or disconnect the blocks below it.
+//
+// The blocks connected while the snapshot is written are not included.
+// ErrInterruptRequested is returned when the interrupt channel, which can be
+// nil, is closed before the snapshot is complete.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpSnapshot(w io.Writer, interrupt <-chan struct{}) (*SnapshotInfo, error) {
+	// The database transaction begins with the chain lock held, so it holds
+	// the state of the best block even once other blocks are connected.
+	b.chainLock.RLock()
+	locked := true
+	defer func() {
+		if locked {
+			b.chainLock.RUnlock()
+		}
+	}()
+
+	// The snapshot holds the utxo set in the database, which must include
+	// the changes held by the utxo cache.
+	err := b.utxoCache.flush(b.bestChain.Tip())
+	if err != nil {
+		return nil, err
+	}
+
+	var info *SnapshotInfo
+	err = b.db.View(func(dbTx database.Tx) error {
+		tip := b.bestChain.Tip()
+		b.chainLock.RUnlock()
+		locked = false
+
+		var err error
+		info, err = b.dumpSnapshot(dbTx, tip, w, interrupt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// dumpSnapshot writes the snapshot of the state of the passed tip, held by
+// the passed database transaction.
+func (b *BlockChain) dumpSnapshot(dbTx database.Tx, tip *blockNode, w io.Writer,
+	interrupt <-chan struct{}) (*SnapshotInfo, error) {
+
+	info := &SnapshotInfo{
+		Header: SnapshotHeader{
+			Net:       b.chainParams.Net,
+			Height:    tip.height,
+			Hash:      tip.hash,
+			StateRoot: tip.stateRoot,
+		},
+	}
+	sw, err := NewSnapshotWriter(w, &info.Header)
+	if err != nil {
+		return nil, err
+	}
+	write := func(record *SnapshotRecord) error {
+		if interruptRequested(interrupt) {
+			return ErrInterruptRequested
+		}
+		info.Records++
+		return sw.Write(record)
+	}
+
+	// The templates are read from the block creating them whenever a
+	// contract is deployed, so their blocks are needed along with the
+	// best block, on which the next block is built.
+	var keys []*database.BlockKey
+	for _, hash := range []*common.Hash{b.chainParams.GenesisHash, &tip.hash} {
+		keys = append(keys, database.NewNormalBlockKey(hash),
+			database.NewVirtualBlockKey(hash))
+	}
+	if b.templateIndex != nil {
+		if bucket := dbTx.Metadata().Bucket(b.templateIndex.Key()); bucket != nil {
+			err := bucket.ForEach(func(k, _ []byte) error {
+				region, err := b.templateIndex.FetchBlockRegion(k)
+				if err != nil {
+					return err
+				}
+				if region != nil {
+					keys = append(keys, region.Key)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	written := make(map[database.BlockKey]struct{})
+	for _, key := range keys {
+		if _, ok := written[*key]; ok {
+			continue
+		}
+		written[*key] = struct{}{}
+		if ok, err := dbTx.HasBlock(key); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		blockBytes, err := dbTx.FetchBlock(key)
+		if err != nil {
+			return nil, err
+		}
+		err = write(&SnapshotRecord{Kind: SnapshotBlock, Key: key[:], Value: blockBytes})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the chain state is stored at the root of the metadata, along
+	// with the buckets.
+	meta := dbTx.Metadata()
+	err = write(&SnapshotRecord{
+		Kind:  SnapshotEntry,
+		Key:   chainStateKeyName,
+		Value: meta.Get(chainStateKeyName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buckets [][]byte
+	err = meta.ForEachBucket(func(k []byte) error {
+		for _, skipped := range snapshotSkippedBuckets {
+			if bytes.Equal(k, skipped) {
+				return nil
+			}
+		}
+		buckets = append(buckets, common.CopyBytes(k))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range buckets {
+		err := dumpSnapshotBucket(meta.Bucket(name), [][]byte{name}, tip, write)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = walkStateNodes(b.stateCache.TrieDB(), tip.stateRoot, func(blob []byte) error {
+		return write(&SnapshotRecord{Kind: SnapshotStateNode, Value: blob})
+	}, interrupt)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Hash, info.Size, err = sw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// dumpSnapshotBucket writes a metadata bucket, its entries and its nested
+// buckets.  Only the main chain blocks up to the passed tip are written from
+// the block index.
+func dumpSnapshotBucket(bucket database.Bucket, path [][]byte, tip *blockNode,
+	write func(*SnapshotRecord) error) error {
+
+	if err := write(&SnapshotRecord{Kind: SnapshotBucket, Path: path}); err != nil {
+		return err
+	}
+	blockIndex := len(path) == 1 && bytes.Equal(path[0], blockIndexBucketName)
+	err := bucket.ForEach(func(k, v []byte) error {
+		if blockIndex {
+			if len(k) != common.HashLength+4 {
+				return fmt.Errorf("invalid block index key %x", k)
+			}
+			node := tip.Ancestor(int32(binary.BigEndian.Uint32(k[:4])))
+			if node == nil || !bytes.Equal(node.hash[:], k[4:]) {
+				return nil
+			}
+		}
+		return write(&SnapshotRecord{Kind: SnapshotEntry, Path: path, Key: k, Value: v})
+	})
+	if err != nil {
+		return err
+	}
+
+	var nested [][]byte
+	err = bucket.ForEachBucket(func(k []byte) error {
+		nested = append(nested, common.CopyBytes(k))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range nested {
+		childPath := append(path[:len(path):len(path)], name)
+		if err := dumpSnapshotBucket(bucket.Bucket(name), childPath, tip, write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkStateNodes passes every state trie node, storage trie node and contract
+// code reachable from the passed state root to fn, which can be nil to only
+// check the state is complete.
+func walkStateNodes(tdb *trie.Database, root common.Hash, fn func(blob []byte) error,
+	interrupt <-chan struct{}) error {
+
+	storageRoots := make(map[common.Hash]struct{})
+	codes := make(map[common.Hash]struct{})
+	var addNodes func(root common.Hash, leaf func(it trie.NodeIterator) error) error
+	addNodes = func(root common.Hash, leaf func(it trie.NodeIterator) error) error {
+		tr, err := trie.New(root, tdb)
+		if err != nil {
+			return err
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+			if interruptRequested(interrupt) {
+				return ErrInterruptRequested
+			}
+			if hash := it.Hash(); hash != (common.Hash{}) {
+				blob, err := tdb.Node(hash)
+				if err != nil {
+					return err
+				}
+				if fn != nil {
+					if err := fn(blob); err != nil {
+						return err
+					}
+				}
+			}
+			if leaf != nil && it.Leaf() {
+				if err := leaf(it); err != nil {
+					return err
+				}
+			}
+		}
+		return it.Error()
+	}
+
+	// Storage tries and codes shared by several accounts are only passed
+	// once.
+	return addNodes(root, func(it trie.NodeIterator) error {
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			return err
+		}
+		if _, ok := storageRoots[acc.Root]; !ok && acc.Root != emptyStorageRoot {
+			storageRoots[acc.Root] = struct{}{}
+			if err := addNodes(acc.Root, nil); err != nil {
+				return err
+			}
+		}
+		codeHash := common.BytesToHash(acc.CodeHash)
+		if _, ok := codes[codeHash]; !ok && codeHash != emptyCodeHash {
+			codes[codeHash] = struct{}{}
+			code, err := tdb.Node(codeHash)
+			if err != nil {
+				return err
+			}
+			if fn != nil {
+				return fn(code)
+			}
+		}
+		return nil
+	})
+}
+
+// LoadSnapshot loads a snapshot written by DumpSnapshot into a database which
+// does not hold a chain yet, so the chain starts from the block of the
+// snapshot.  The snapshot must match the expected hash, which the operator
+// obtains from a trusted source, and its state must be complete.  Nothing is
+// loaded into the database otherwise, though the state database may hold some
+// of the state trie nodes.  ErrSnapshotChainExists is returned when the
+// database already holds a chain.
+//
+// The blocks below the snapshot, but the genesis block and the blocks holding
+// contract templates, are marked as not stored in the block index.
+func LoadSnapshot(db database.Transactor, stateDB database.Database, params *chaincfg.Params,
+	r io.Reader, expected common.Hash) (*SnapshotHeader, error) {
+
+	sr, err := NewSnapshotReader(r)
+	if err != nil {
+		return nil, err
+	}
+	header := sr.Header()
+	if header.Net != params.Net {
+		return nil, fmt.Errorf("snapshot of network %v, not %v", header.Net, params.Net)
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Get(chainStateKeyName) != nil {
+			return ErrSnapshotChainExists
+		}
+
+		stored := make(map[common.Hash]struct{})
+		batch := stateDB.NewBatch()
+		for {
+			record, err := sr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			switch record.Kind {
+			case SnapshotBlock:
+				hash, err := loadSnapshotBlock(dbTx, record, header)
+				if err != nil {
+					return err
+				}
+				stored[*hash] = struct{}{}
+
+			case SnapshotBucket:
+				if _, err := snapshotBucket(meta, record.Path, true); err != nil {
+					return err
+				}
+
+			case SnapshotEntry:
+				bucket, err := snapshotBucket(meta, record.Path, false)
+				if err != nil {
+					return err
+				}
+				value := record.Value
+				if len(record.Path) == 1 && bytes.Equal(record.Path[0], blockIndexBucketName) {
+					value, err = snapshotBlockRow(record.Key, value, stored)
+					if err != nil {
+						return err
+					}
+				}
+				if err := bucket.Put(record.Key, value); err != nil {
+					return err
+				}
+
+			case SnapshotStateNode:
+				// Nodes are keyed by the hash of their content, so a
+				// corrupted node can not overwrite any other entry.
+				hash := crypto.Keccak256Hash(record.Value)
+				if err := batch.Put(hash[:], record.Value); err != nil {
+					return err
+				}
+				if batch.ValueSize() >= database.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						return err
+					}
+					batch.Reset()
+				}
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+
+		if sr.Hash() != expected {
+			return fmt.Errorf("snapshot hash %x does not match the expected "+
+				"hash %x", sr.Hash(), expected)
+		}
+		state, err := deserializeBestChainState(meta.Get(chainStateKeyName))
+		if err != nil {
+			return err
+		}
+		if state.hash != header.Hash || int32(state.height) != header.Height {
+			return fmt.Errorf("snapshot of block %v at height %d holds the "+
+				"chain state of block %v at height %d", header.Hash,
+				header.Height, state.hash, state.height)
+		}
+		for _, hash := range []*common.Hash{params.GenesisHash, &header.Hash} {
+			if _, ok := stored[*hash]; !ok {
+				return fmt.Errorf("snapshot misses block %v", hash)
+			}
+		}
+		return walkStateNodes(trie.NewDatabase(stateDB), header.StateRoot, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// loadSnapshotBlock stores a block of a snapshot and returns its hash.  The
+// best block of the snapshot must commit to its state root.
+func loadSnapshotBlock(dbTx database.Tx, record *SnapshotRecord, header *SnapshotHeader) (*common.Hash, error) {
+	if len(record.Key) != database.BlockKeyLength {
+		return nil, fmt.Errorf("invalid snapshot block key %x", record.Key)
+	}
+	var key database.BlockKey
+	copy(key[:], record.Key)
+	hash := common.BytesToHash(key[:common.HashLength])
+
+	if !key.IsVirtual() {
+		block, err := asiutil.NewBlockFromBytes(record.Value)
+		if err != nil {
+			return nil, err
+		}
+		if *block.Hash() != hash {
+			return nil, fmt.Errorf("snapshot block %v stored as %v",
+				block.Hash(), hash)
+		}
+		if hash == header.Hash && block.MsgBlock().Header.StateRoot != header.StateRoot {
+			return nil, fmt.Errorf("snapshot state root %v, block %v "+
+				"commits to %v", header.StateRoot, hash,
+				block.MsgBlock().Header.StateRoot)
+		}
+	}
+	if err := dbTx.StoreBlock(&key, record.Value); err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
+// snapshotBucket returns the metadata bucket of the passed path, which is
+// created when create is set.
+func snapshotBucket(meta database.Bucket, path [][]byte, create bool) (database.Bucket, error) {
+	bucket := meta
+	for _, name := range path {
+		if create {
+			var err error
+			if bucket, err = bucket.CreateBucketIfNotExists(name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if bucket = bucket.Bucket(name); bucket == nil {
+			return nil, fmt.Errorf("snapshot entry of unknown bucket %q", path)
+		}
+	}
+	return bucket, nil
+}
+
+// snapshotBlockRow returns the block index row of a snapshot, marked as not
+// stored unless the snapshot holds the block.
+func snapshotBlockRow(key, row []byte, stored map[common.Hash]struct{}) ([]byte, error) {
+	if len(key) != common.HashLength+4 {
+		return nil, fmt.Errorf("invalid block index key %x", key)
+	}
+	r := bytes.NewReader(row)
+	var header protos.BlockHeader
+	if err := header.Deserialize(r); err != nil {
+		return nil, err
+	}
+	hash := header.BlockHash()
+	if !bytes.Equal(hash[:], key[4:]) {
+		return nil, fmt.Errorf("block index row of %v stored as %x", hash, key[4:])
+	}
+	offset := len(row) - r.Len()
+	if offset >= len(row) {
+		return nil, fmt.Errorf("block index row of %v has no status", hash)
+	}
+	if _, ok := stored[hash]; ok {
+		return row, nil
+	}
+	row = common.CopyBytes(row)
+	row[offset] &^= byte(statusDataStored)
+	return row, nil
+}
@@ -98,7 +98,7 @@ func connectTransaction(view *txo.UtxoViewpoint, tx *asiutil.Tx, blockHeight int
 // spend as spent, and setting the best hash for the view to the passed block.
 // In addition, when the 'stxos' argument is not nil, it will be updated to
 // append an entry for each spent txout.
-func connectTransactions(view *txo.UtxoViewpoint, db database.Transactor,
+func connectTransactions(view *txo.UtxoViewpoint, utxos *utxoCache,
 	block *asiutil.Block, vblock *asiutil.VBlock,
 	stxos *[]txo.SpentTxOut) error {
     vIdx := 0
@@ -134,7 +134,7 @@ func connectTransactions(view *txo.UtxoViewpoint, db database.Transactor,
 			vIdx++
 		}
 		if vtx != nil {
-			err = fetchVtxInputUtxos(view, db, vtx)
+			err = fetchVtxInputUtxos(view, utxos, vtx)
 			if err != nil {
 				return err
 			}
@@ -186,7 +186,7 @@ func connectTransactions(view *txo.UtxoViewpoint, db database.Transactor,
 // created by the passed block, restoring all utxos the transactions spent by
 // using the provided spent txo information, and setting the best hash for the
 // view to the block before the passed block.
-func disconnectTransactions(view *txo.UtxoViewpoint, db database.Transactor,
+func disconnectTransactions(view *txo.UtxoViewpoint, utxos *utxoCache,
 	block *asiutil.Block, stxos []txo.SpentTxOut,
 	vblock *asiutil.VBlock) error {
 	// Sanity check the correct number of stxos are provided.
@@ -294,7 +294,7 @@ func disconnectTransactions(view *txo.UtxoViewpoint, db database.Transactor,
 			entry.Update(stxo.Amount, stxo.PkScript, stxo.Height, stxo.IsCoinBase, stxo.Asset, nil)
 
 			var lockItem *txo.LockItem
-			err := db.View(func(dbTx database.Tx) error {
+			err := utxos.db.View(func(dbTx database.Tx) error {
 				var err error
 				lockItem, err = dbFetchLockItem(dbTx, *originOut)
 				if lockItem != nil {
@@ -323,6 +323,9 @@ func disconnectTransactions(view *txo.UtxoViewpoint, db database.Transactor,
 // Upon completion of this function, the view will contain an entry for each
 // requested outpoint.  Spent outputs, or those which otherwise don't exist,
 // will result in a nil entry in the view.
+//
+// NOTE: The utxo set in the database lags the main chain by the outputs held
+// in the utxo cache of the chain, which BlockChain.FetchUtxoView accounts for.
 func FetchUtxosMain(view *txo.UtxoViewpoint, db database.Transactor, outpoints map[protos.OutPoint]struct{}) error {
 	// Nothing to do if there are no requested outputs.
 	if len(outpoints) == 0 {
@@ -353,7 +356,7 @@ func FetchUtxosMain(view *txo.UtxoViewpoint, db database.Transactor, outpoints m
 // fetchUtxos loads the unspent transaction outputs for the provided set of
 // outputs into the view from the database as needed unless they already exist
 // in the view in which case they are ignored.
-func fetchUtxos(view *txo.UtxoViewpoint, db database.Transactor, outpoints map[protos.OutPoint]struct{}) error {
+func fetchUtxos(view *txo.UtxoViewpoint, utxos *utxoCache, outpoints map[protos.OutPoint]struct{}) error {
 	// Nothing to do if there are no requested outputs.
 	if len(outpoints) == 0 {
 		return nil
@@ -370,8 +373,8 @@ func fetchUtxos(view *txo.UtxoViewpoint, db database.Transactor, outpoints map[p
 		neededSet[outpoint] = struct{}{}
 	}
 
-	// Request the input utxos from the database.
-	return FetchUtxosMain(view, db, neededSet)
+	// Request the input utxos from the cache or the database.
+	return utxos.fetchEntries(view, neededSet)
 }
 
 // FetchInputUtxos loads the unspent transaction outputs for the inputs
@@ -379,7 +382,7 @@ func fetchUtxos(view *txo.UtxoViewpoint, db database.Transactor, outpoints map[p
 // database as needed.  In particular, referenced entries that are earlier in
 // the block are added to the view and entries that are already in the view are
 // not modified.
-func fetchInputUtxos(view *txo.UtxoViewpoint, db database.Transactor, block *asiutil.Block) error {
+func fetchInputUtxos(view *txo.UtxoViewpoint, utxos *utxoCache, block *asiutil.Block) error {
 	// Build a map of in-flight transactions because some of the inputs in
 	// this block could be referencing other transactions earlier in this
 	// block which are not yet in the chain.
@@ -426,15 +429,15 @@ func fetchInputUtxos(view *txo.UtxoViewpoint, db database.Transactor, block *asi
 		}
 	}
 
-	// Request the input utxos from the database.
-	return FetchUtxosMain(view, db, neededSet)
+	// Request the input utxos from the cache or the database.
+	return utxos.fetchEntries(view, neededSet)
 }
 
 // fetchVtxInputUtxos loads the unspent transaction outputs for the inputs
 // referenced by the transactions in the given tx into the view from the
 // database as needed.  In particular, referenced entries that are already
 // in the view are not modified.
-func fetchVtxInputUtxos(view *txo.UtxoViewpoint, db database.Transactor, vtx *asiutil.Tx) error {
+func fetchVtxInputUtxos(view *txo.UtxoViewpoint, utxos *utxoCache, vtx *asiutil.Tx) error {
 	neededSet := make(map[protos.OutPoint]struct{})
 	for _, txIn := range vtx.MsgTx().TxIn {
 		isVtxMint := asiutil.IsMintOrCreateInput(txIn)
@@ -449,6 +452,6 @@ func fetchVtxInputUtxos(view *txo.UtxoViewpoint, db database.Transactor, vtx *as
 		neededSet[txIn.PreviousOutPoint] = struct{}{}
 	}
 
-	// Request the input utxos from the database.
-	return FetchUtxosMain(view, db, neededSet)
+	// Request the input utxos from the cache or the database.
+	return utxos.fetchEntries(view, neededSet)
 }
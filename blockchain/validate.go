@@ -16,6 +16,7 @@ import (
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/tracing"
 	"github.com/AsimovNetwork/asimov/txscript"
 	"github.com/AsimovNetwork/asimov/vm/fvm"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
@@ -43,6 +44,14 @@ const (
 	// value is halved every SubsidyHalvingInterval blocks.
 	baseSubsidy = 200 * common.XingPerAsimov
 
+	// foundationRewardPeriod is the time, in seconds from the genesis
+	// block, during which the foundation receives its share of the reward
+	// of the blocks past the first subsidy reduction.  It is the period
+	// the blocks were always validated against.  The block templates used
+	// to pay the foundation one more day, which the blocks were not
+	// required to.
+	foundationRewardPeriod = 86400 * 365 * 4
+
 	// MaxBlockSigOpsCost is the maximum number of signature operations
 	// allowed for a block.
 	MaxBlockSigOpsCost = 200000
@@ -277,6 +286,17 @@ func CheckTransactionSanity(tx *asiutil.Tx) error {
 		existingTxOut[txIn.PreviousOutPoint] = struct{}{}
 	}
 
+	if msgTx.HasAccessList() {
+		if err := checkAccessList(msgTx); err != nil {
+			return err
+		}
+	}
+	if msgTx.HasStorageWitness() {
+		if err := checkStorageWitness(msgTx); err != nil {
+			return err
+		}
+	}
+
 	// Coinbase script length must be between min and max length.
 	if IsCoinBase(tx) {
 		slen := len(msgTx.TxIn[0].SignatureScript)
@@ -292,6 +312,13 @@ func CheckTransactionSanity(tx *asiutil.Tx) error {
 				uint32(tx.MsgTx().SerializeSize())*NormalGas)
 			return ruleError(ErrBadGasLimit, errstr)
 		}
+		// The gas limit must also cover the charges of the access list, or
+		// connecting the transaction would underflow its left over gas.
+		if baseGas := txBaseGas(msgTx); uint64(msgTx.TxContract.GasLimit) < baseGas {
+			errstr := fmt.Sprintf("CheckTransactionSanity: tx with gaslimit %d less than "+
+				"base gas %d", msgTx.TxContract.GasLimit, baseGas)
+			return ruleError(ErrBadGasLimit, errstr)
+		}
 		// Previous transaction outputs referenced by the inputs to this
 		// transaction must not be null.
 		for _, txIn := range msgTx.TxIn {
@@ -306,6 +333,118 @@ func CheckTransactionSanity(tx *asiutil.Tx) error {
 	return nil
 }
 
+// checkAccessList ensures the access list of a transaction declares every
+// account and every storage slot at most once, within the limits of the
+// protocol.  Coinbase transactions do not run contract code, so they must not
+// carry an access list.
+func checkAccessList(msgTx *protos.MsgTx) error {
+	if IsCoinBaseTx(msgTx) {
+		return ruleError(ErrBadAccessList, "CheckTransactionSanity: "+
+			"coinbase transaction carries an access list")
+	}
+	list := msgTx.TxContract.AccessList
+	if len(list) > protos.MaxAccessListAddresses {
+		str := fmt.Sprintf("CheckTransactionSanity: access list declares %d "+
+			"accounts, max %d", len(list), protos.MaxAccessListAddresses)
+		return ruleError(ErrBadAccessList, str)
+	}
+	accounts := make(map[common.Address]struct{}, len(list))
+	totalKeys := 0
+	for _, tuple := range list {
+		if _, exists := accounts[tuple.Address]; exists {
+			str := fmt.Sprintf("CheckTransactionSanity: access list "+
+				"declares account %x twice", tuple.Address)
+			return ruleError(ErrBadAccessList, str)
+		}
+		accounts[tuple.Address] = struct{}{}
+
+		totalKeys += len(tuple.StorageKeys)
+		if totalKeys > protos.MaxAccessListStorageKeys {
+			str := fmt.Sprintf("CheckTransactionSanity: access list declares "+
+				"more than %d storage slots", protos.MaxAccessListStorageKeys)
+			return ruleError(ErrBadAccessList, str)
+		}
+		keys := make(map[common.Hash]struct{}, len(tuple.StorageKeys))
+		for _, key := range tuple.StorageKeys {
+			if _, exists := keys[key]; exists {
+				str := fmt.Sprintf("CheckTransactionSanity: access list "+
+					"declares storage slot %v of account %x twice",
+					key, tuple.Address)
+				return ruleError(ErrBadAccessList, str)
+			}
+			keys[key] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// txBaseGas returns the gas a transaction pays before running any contract
+// code, for its size and for the accounts and the storage slots declared by
+// its access list.  The declarations pay upfront for the discounts of their
+// first access.
+func txBaseGas(msgTx *protos.MsgTx) uint64 {
+	gas := uint64(msgTx.SerializeSize() * common.GasPerByte)
+	if msgTx.HasAccessList() {
+		for _, tuple := range msgTx.TxContract.AccessList {
+			gas += params.TxAccessListAddressGas +
+				uint64(len(tuple.StorageKeys))*params.TxAccessListStorageKeyGas
+		}
+	}
+	return gas
+}
+
+// checkStorageWitness ensures the storage witnesses of a transaction witness
+// every contract and every storage slot at most once, within the limits of the
+// protocol.  A storage never holds an empty slot, so a witness must not carry
+// one.  Coinbase transactions do not run contract code, so they must not carry
+// storage witnesses.
+func checkStorageWitness(msgTx *protos.MsgTx) error {
+	if IsCoinBaseTx(msgTx) {
+		return ruleError(ErrBadStorageWitness, "CheckTransactionSanity: "+
+			"coinbase transaction carries storage witnesses")
+	}
+	witnesses := msgTx.TxContract.Witnesses
+	if len(witnesses) > protos.MaxStorageWitnesses {
+		str := fmt.Sprintf("CheckTransactionSanity: transaction carries %d "+
+			"storage witnesses, max %d", len(witnesses), protos.MaxStorageWitnesses)
+		return ruleError(ErrBadStorageWitness, str)
+	}
+	contracts := make(map[common.Address]struct{}, len(witnesses))
+	totalEntries := 0
+	for _, witness := range witnesses {
+		if _, exists := contracts[witness.Address]; exists {
+			str := fmt.Sprintf("CheckTransactionSanity: storage of %x "+
+				"witnessed twice", witness.Address)
+			return ruleError(ErrBadStorageWitness, str)
+		}
+		contracts[witness.Address] = struct{}{}
+
+		totalEntries += len(witness.Entries)
+		if totalEntries > protos.MaxStorageWitnessEntries {
+			str := fmt.Sprintf("CheckTransactionSanity: storage witnesses "+
+				"carry more than %d slots", protos.MaxStorageWitnessEntries)
+			return ruleError(ErrBadStorageWitness, str)
+		}
+		keys := make(map[common.Hash]struct{}, len(witness.Entries))
+		for _, entry := range witness.Entries {
+			if _, exists := keys[entry.Key]; exists {
+				str := fmt.Sprintf("CheckTransactionSanity: storage "+
+					"witness of %x carries slot %v twice",
+					witness.Address, entry.Key)
+				return ruleError(ErrBadStorageWitness, str)
+			}
+			keys[entry.Key] = struct{}{}
+			if entry.Value == (common.Hash{}) {
+				str := fmt.Sprintf("CheckTransactionSanity: storage "+
+					"witness of %x carries empty slot %v",
+					witness.Address, entry.Key)
+				return ruleError(ErrBadStorageWitness, str)
+			}
+		}
+	}
+	return nil
+}
+
 // CountSigOps returns the number of signature operations for all transaction
 // input and output scripts in the provided transaction.  This uses the
 // quicker, but imprecise, signature operation counting mechanism from
@@ -391,9 +530,12 @@ func CountP2SHSigOps(tx *asiutil.Tx, isCoinBaseTx bool, utxoView *txo.UtxoViewpo
 // are needed to pass along to checkProofOfWork.
 func checkBlockHeaderSanity(header *protos.BlockHeader, parent *blockNode) error {
 	// Ensure the block time is not too far in the future.
-	if header.Timestamp-time.Now().Unix() > int64(chaincfg.Cfg.MaxTimeOffset) {
-		str := fmt.Sprintf("block timestamp of %v is too far in the "+
-			"future, max validtime offset is %d", header.Timestamp, chaincfg.Cfg.MaxTimeOffset)
+	params := chaincfg.ActiveNetParams.Params
+	now := time.Now().Unix()
+	if ahead := header.Timestamp - now; ahead > params.MaxTimeOffset {
+		str := fmt.Sprintf("block timestamp of %v is %ds ahead of the "+
+			"local time, beyond the max time offset of %ds",
+			header.Timestamp, ahead, params.MaxTimeOffset)
 		return ruleError(ErrTimeTooNew, str)
 	}
 	if parent == nil {
@@ -405,22 +547,24 @@ func checkBlockHeaderSanity(header *protos.BlockHeader, parent *blockNode) error
 			parent.slot, header.SlotIndex, parent.round.Round, header.Round)
 		return ruleError(ErrBadSlotOrRound, str)
 	}
-	// compare two neighbor nodes time stamp.
-	delta := time.Now().Unix() - parent.timestamp
+	// The slots elapsed since the parent can not be more than the time
+	// elapsed since it allows, within the tolerances.
+	delta := now - parent.timestamp
 	if parent.round.Round == 0 {
-		delta = time.Now().Unix() - chaincfg.ActiveNetParams.ChainStartTime
+		delta = now - params.ChainStartTime
 	}
-	maxslot := (delta + int64(chaincfg.Cfg.MaxTimeOffset)*2) / common.MinBlockInterval
-	slotcount := int64(header.Round-parent.round.Round)*int64(chaincfg.ActiveNetParams.RoundSize) +
+	maxslot := (delta + params.MaxTimeOffset + params.SlotTolerance) / common.MinBlockInterval
+	slotcount := int64(header.Round-parent.round.Round)*int64(params.RoundSize) +
 		int64(header.SlotIndex)
 	if parent.round.Round > 0 {
 		slotcount -= int64(parent.slot)
 	} else {
-		slotcount -= int64(chaincfg.ActiveNetParams.RoundSize - 1)
+		slotcount -= int64(params.RoundSize - 1)
 	}
 	if maxslot < slotcount {
-		str := fmt.Sprintf("block has too new slot/round: slot:%d, round:%d, delta %d",
-			header.SlotIndex, header.Round, delta)
+		str := fmt.Sprintf("block slot %d of round %d is %d slots after "+
+			"its parent, beyond the %d slots allowed %ds after it",
+			header.SlotIndex, header.Round, slotcount, maxslot, delta)
 		return ruleError(ErrBadSlotOrRound, str)
 	}
 
@@ -446,18 +590,19 @@ func checkBlockSanity(block *asiutil.Block, parent *blockNode, flags common.Beha
 
 	// A block must not have more transactions than the max block payload or
 	// else it is certainly over the size limit.
-	if numTx > common.MaxBlockSize {
+	maxBlockSize := chaincfg.ActiveNetParams.BlockSizeLimit()
+	if numTx > maxBlockSize {
 		str := fmt.Sprintf("block contains too many transactions - "+
-			"got %d, max %d", numTx, common.MaxBlockSize)
+			"got %d, max %d", numTx, maxBlockSize)
 		return ruleError(ErrBlockTooBig, str)
 	}
 
 	// A block must not exceed the maximum allowed block payload when
 	// serialized.
 	serializedSize := msgBlock.SerializeSize()
-	if serializedSize > common.MaxBlockSize {
+	if serializedSize > maxBlockSize {
 		str := fmt.Sprintf("serialized block is too big - got %d, "+
-			"max %d", serializedSize, common.MaxBlockSize)
+			"max %d", serializedSize, maxBlockSize)
 		return ruleError(ErrBlockTooBig, str)
 	}
 
@@ -631,15 +776,14 @@ func (b *BlockChain) checkBlockHeaderContext(header *protos.BlockHeader, prevNod
 
 	// Ensure the timestamp for the block header is in the
 	// range of allowed timestamp of the last several blocks.
-	interval := header.Timestamp - round.RoundStartUnix
+	tolerance := chaincfg.ActiveNetParams.SlotTolerance
 	expected := round.Duration * int64(header.SlotIndex)
-	expected = expected / int64(chaincfg.ActiveNetParams.RoundSize)
-	if interval < expected-int64(chaincfg.Cfg.MaxTimeOffset) ||
-		interval > expected+int64(chaincfg.Cfg.MaxTimeOffset) {
-		str := "block timestamp %d - round start %d = %d is out of range [%d, %d]"
-		str = fmt.Sprintf(str, header.Timestamp, round.RoundStartUnix, interval,
-			expected-int64(chaincfg.Cfg.MaxTimeOffset),
-			expected+int64(chaincfg.Cfg.MaxTimeOffset))
+	expected = round.RoundStartUnix + expected/int64(chaincfg.ActiveNetParams.RoundSize)
+	if offset := header.Timestamp - expected; offset < -tolerance || offset > tolerance {
+		str := "block timestamp %d is %+ds off the time %d scheduled for " +
+			"slot %d of round %d, beyond the slot tolerance of %ds"
+		str = fmt.Sprintf(str, header.Timestamp, offset, expected,
+			header.SlotIndex, header.Round, tolerance)
 		return ruleError(ErrTimeStampOutOfRange, str)
 	}
 
@@ -728,9 +872,9 @@ func (b *BlockChain) checkBlockContext(block *asiutil.Block, prevNode *blockNode
 					return ruleError(ErrGasLimitOverFlow, errStr)
 				}
 			} else {
-				if txgaslimit < uint64(tx.MsgTx().SerializeSize()*common.GasPerByte) {
-					errStr := fmt.Sprintf("tx gaslimit %d is less than its size cost %d",
-						tx.MsgTx().TxContract.GasLimit, tx.MsgTx().SerializeSize()*common.GasPerByte)
+				if baseGas := txBaseGas(tx.MsgTx()); txgaslimit < baseGas {
+					errStr := fmt.Sprintf("tx gaslimit %d is less than its base cost %d",
+						tx.MsgTx().TxContract.GasLimit, baseGas)
 					return ruleError(ErrGasLimitOverFlow, errStr)
 				}
 			}
@@ -791,7 +935,7 @@ func (b *BlockChain) checkSignatures(block *asiutil.Block) error {
 		}
 	}
 
-	err := AddressVerifySignature(block.Hash()[:], &header.CoinBase, header.SigData[:])
+	err := b.engine.VerifySeal(header)
 	if err != nil {
 		log.Errorf("Verify signature failed: height=%d, round=%d, slot=%d, hash=%v",
 			header.Height, header.Round, header.SlotIndex, block.Hash())
@@ -808,10 +952,8 @@ func (b *BlockChain) checkSignaturesWeight(node *blockNode, block *asiutil.Block
 	if err != nil {
 		return err
 	}
-	if *validators[header.SlotIndex] != header.CoinBase {
-		str := fmt.Sprintf("checkSignaturesWeight miner invalid: height=%d, round=%d, slot=%d, miner=%v",
-			header.Height, header.Round, header.SlotIndex, header.CoinBase.String())
-		return ruleError(ErrValidatorMismatch, str)
+	if err := b.engine.Prepare(&header, validators); err != nil {
+		return err
 	}
 
 	selfWeight := weightMap[header.CoinBase]
@@ -1271,9 +1413,12 @@ func (b *BlockChain) GetValidatorsByNode(round uint32, preroundLastNode *blockNo
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, view *txo.UtxoViewpoint,
-	stxos *[]txo.SpentTxOut, msgvblock *protos.MsgVBlock) (
+	stxos *[]txo.SpentTxOut, msgvblock *protos.MsgVBlock, flags common.BehaviorFlags) (
 	types.Receipts, []*types.Log, error) {
 
+	span := tracing.StartSpan("blockchain.checkConnectBlock", b.traceSpan)
+	defer span.End()
+
 	// Check Sig & Weight
 	err := b.checkSignaturesWeight(node, block, view)
 	if err != nil {
@@ -1290,6 +1435,11 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 	if err != nil {
 		return nil, nil, err
 	}
+	split, err := b.calcRewardSplit(node.parent, statedb, block.Height(),
+		block.MsgBlock().Header.Timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -1317,11 +1467,39 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err = fetchInputUtxos(view, b.db, block)
+	err = fetchInputUtxos(view, b.utxoCache, block)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Transactions may only carry access lists once the deployment of
+	// access lists is active.
+	accessListState, err := b.deploymentState(node.parent, chaincfg.DeploymentAccessList)
+	if err != nil {
+		return nil, nil, err
+	}
+	if accessListState != ThresholdActive {
+		for _, tx := range block.Transactions() {
+			if tx.MsgTx().HasAccessList() {
+				str := fmt.Sprintf("transaction %v carries an access "+
+					"list before its activation", tx.Hash())
+				return nil, nil, ruleError(ErrAccessListInactive, str)
+			}
+		}
+	}
+
+	// Transactions may only carry storage witnesses while state rent is
+	// enabled.
+	if !b.chainParams.StateRentActive(node.height) {
+		for _, tx := range block.Transactions() {
+			if tx.MsgTx().HasStorageWitness() {
+				str := fmt.Sprintf("transaction %v carries storage "+
+					"witnesses while state rent is disabled", tx.Hash())
+				return nil, nil, ruleError(ErrStateRentInactive, str)
+			}
+		}
+	}
+
 	// The number of signature operations must be less than the maximum
 	// allowed per block.  Note that the preliminary sanity checks on a
 	// block also include a check similar to this one, but this check
@@ -1396,7 +1574,16 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 		// spent txos slice is updated to contain an entry for each
 		// spent txout in the order each transaction spends them.
 		statedb.Prepare(*tx.Hash(), *block.Hash(), i)
+		txSpan := tracing.StartSpan("blockchain.ConnectTransaction", span)
+		b.txTraceSpan = txSpan
 		receipt, err, gasUsed, vtx, feeLockItems := b.ConnectTransaction(block, i, view, tx, stxos, statedb, fee)
+		b.txTraceSpan = nil
+		if txSpan.Sampled() {
+			txSpan.SetAttr("tx.hash", tx.Hash().String())
+			txSpan.SetAttr("tx.gasused", gasUsed)
+		}
+		txSpan.SetError(err)
+		txSpan.End()
 		if receipt != nil {
 			receipts = append(receipts, receipt)
 			allLogs = append(allLogs, receipt.Logs...)
@@ -1424,10 +1611,13 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 	if block.MsgBlock().Header.GasUsed != totalGasUsed {
 		errStr := fmt.Sprintf("total gas used mismatch, header %d vs calc %d.",
 			block.MsgBlock().Header.GasUsed, totalGasUsed)
-		return nil, nil, ruleError(ErrGasMismatch, errStr)
+		err := ruleError(ErrGasMismatch, errStr)
+		b.dumpForensics(node, block, statedb, receipts,
+			statedb.IntermediateRoot(true), totalGasUsed, err)
+		return nil, nil, err
 	}
 
-	if err := b.checkCoinbaseTx(node.parent, block, allFees); err != nil {
+	if err := b.checkCoinbaseTx(node.parent, block, allFees, split); err != nil {
 		return nil, nil, err
 	}
 
@@ -1443,6 +1633,13 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 		runScripts = false
 	}
 
+	// Likewise, the scripts of the ancestors of the block assumed valid
+	// are not run.  All the other rules are still checked, so the unspent
+	// outputs and the state are the same as when the scripts are run.
+	if runScripts && b.isAssumedValid(node, flags) {
+		runScripts = false
+	}
+
 	// Blocks created after the BIP0016 activation time need to have the
 	// pay-to-script-hash checks enabled.
 	var scriptFlags txscript.ScriptFlags
@@ -1488,7 +1685,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 	// expensive ECDSA signature check scripts.  Doing this last helps
 	// prevent CPU exhaustion attacks.
 	if runScripts {
-		err := checkBlockScripts(block, view, scriptFlags)
+		err := checkBlockScripts(block, view, scriptFlags, b.sigCache)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1507,7 +1704,9 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *asiutil.Block, vi
 		return nil, nil, err
 	}
 	if !bytes.Equal(node.stateRoot[:], stateRoot[:]) {
-		return nil, nil, ruleError(ErrStateRootNotMatch, "state root of the block is not matched.")
+		err := ruleError(ErrStateRootNotMatch, "state root of the block is not matched.")
+		b.dumpForensics(node, block, statedb, receipts, stateRoot, totalGasUsed, err)
+		return nil, nil, err
 	}
 
 	updateFeeLockItems(block, view, totalFeeLockItems)
@@ -1555,12 +1754,39 @@ func (b *BlockChain) createCoinbaseContractOut(preround uint32, preroundLastNode
 	return protos.NewContractTxOut(0, pkscript, asiutil.AsimovAsset, input), nil
 }
 
+// calcRewardSplit returns the distribution of the reward of the block at the
+// passed height and time, child of the passed node.  The distribution set by
+// the validator committee in the state of the parent applies.  Without one,
+// the foundation receives CoreTeamShare of the reward up to the first subsidy
+// reduction or during the foundationRewardPeriod.
+func (b *BlockChain) calcRewardSplit(parent *blockNode, stateDB vm.StateDB,
+	height int32, timestamp int64) (*ainterface.RewardSplit, error) {
+
+	block := asiutil.NewBlock(&protos.MsgBlock{Header: parent.Header()})
+	split, ok, err := b.contractManager.GetRewardSplit(block, stateDB,
+		chaincfg.ActiveNetParams.FvmParam)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return split, nil
+	}
+
+	split = &ainterface.RewardSplit{}
+	if height <= b.chainParams.SubsidyReductionInterval ||
+		timestamp-b.chainParams.GenesisBlock.Header.Timestamp < foundationRewardPeriod {
+		split.Foundation = common.CoreTeamShare
+	}
+	return split, nil
+}
+
 // The total output values of the coinbase transaction must not exceed
 // the expected subsidy value plus total transaction fees gained from
-// mining the block.  It is safe to ignore overflow and out of range
-// errors here because those error conditions would have already been
-// caught by checkTransactionSanity.
-func (b *BlockChain) checkCoinbaseTx(prenode *blockNode, block *asiutil.Block, allFees map[protos.Asset]int64) error {
+// mining the block, less the burned share of the reward.  It is safe to
+// ignore overflow and out of range errors here because those error
+// conditions would have already been caught by checkTransactionSanity.
+func (b *BlockChain) checkCoinbaseTx(prenode *blockNode, block *asiutil.Block,
+	allFees map[protos.Asset]int64, split *ainterface.RewardSplit) error {
 	coinbaseIdx := len(block.Transactions()) - 1
 	coinbaseTx := block.Transactions()[coinbaseIdx].MsgTx()
 	mineFeelist := make(map[protos.Asset]int64)
@@ -1576,19 +1802,18 @@ func (b *BlockChain) checkCoinbaseTx(prenode *blockNode, block *asiutil.Block, a
 			"are not equal to numbers of mineFeelist: %v", len(allFees), len(mineFeelist))
 		return ruleError(ErrBadCoinbaseValue, str)
 	}
-	// match fees
+	// match fees, less the burned share
 	for k, v := range mineFeelist {
 		vv, ok := allFees[k]
-		if !ok || v != vv {
+		if _, burn := split.Shares(vv); !ok || v != vv-burn {
 			str := fmt.Sprintf("checkCoinbaseTx: coinbase transaction for block pays " +
 				"which is more than expected value of")
 			return ruleError(ErrBadCoinbaseValue, str)
 		}
 	}
 	// reward for core team
-	if block.Height() <= chaincfg.ActiveNetParams.Params.SubsidyReductionInterval ||
-		block.MsgBlock().Header.Timestamp-b.chainParams.GenesisBlock.Header.Timestamp < 86400*365*4 {
-		if err := checkCoreTeamReward(coinbaseTx, mineFeelist); err != nil {
+	if split.Foundation > 0 {
+		if err := checkCoreTeamReward(coinbaseTx, allFees, split); err != nil {
 			return err
 		}
 	}
@@ -1623,8 +1848,9 @@ func (b *BlockChain) checkCoinbaseTx(prenode *blockNode, block *asiutil.Block, a
 	return nil
 }
 
-// validate the reward of the core team in the coinbase tx.
-func checkCoreTeamReward(coinbaseTx *protos.MsgTx, mineFeelist map[protos.Asset]int64) error {
+// validate the reward of the core team in the coinbase tx, the foundation share
+// of the reward of every asset.
+func checkCoreTeamReward(coinbaseTx *protos.MsgTx, rewards map[protos.Asset]int64, split *ainterface.RewardSplit) error {
 	fundationAddr := common.HexToAddress(string(common.GenesisOrganization))
 	pkScript, _ := txscript.PayToAddrScript(&fundationAddr)
 	coreTeamReward := make(map[protos.Asset]int64)
@@ -1634,8 +1860,8 @@ func checkCoreTeamReward(coinbaseTx *protos.MsgTx, mineFeelist map[protos.Asset]
 		}
 	}
 
-	for k, v := range mineFeelist {
-		coreTeamValue := int64(float64(v) * common.CoreTeamPercent)
+	for k, v := range rewards {
+		coreTeamValue, _ := split.Shares(v)
 		if coreTeamValue > 0 {
 			vv, ok := coreTeamReward[k]
 			if !ok || vv < coreTeamValue {
@@ -1779,3 +2005,49 @@ func CalcGasLimit(gasUsed, gasLimit uint64, gasFloor, gasCeil uint64) uint64 {
 	}
 	return limit
 }
+
+// CheckConnectBlockTemplate fully validates that connecting the passed block
+// to the tip of the main chain does not violate any consensus rules.  Nothing
+// is written to the chain state, so it is suitable for checking block
+// proposals.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckConnectBlockTemplate(block *asiutil.Block) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// A template can only ever extend the current tip.
+	header := &block.MsgBlock().Header
+	tip := b.bestChain.Tip()
+	if !header.PrevBlock.IsEqual(&tip.hash) {
+		str := fmt.Sprintf("previous block must be the current chain tip "+
+			"%v, instead got %v", tip.hash, header.PrevBlock)
+		return ruleError(ErrPrevBlockNotBest, str)
+	}
+
+	err := checkBlockSanity(block, tip, common.BFNone)
+	if err != nil {
+		return err
+	}
+
+	round := tip.round
+	for round.Round < header.Round {
+		round, err = b.roundManager.GetNextRound(round)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.checkBlockContext(block, tip, round, common.BFNone)
+	if err != nil {
+		return err
+	}
+
+	// Leave the spent txouts nil since the state is not being written to
+	// the database.
+	newNode := newBlockNode(round, header, tip)
+	view := txo.NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	var msgvblock protos.MsgVBlock
+	_, _, err = b.checkConnectBlock(newNode, block, view, nil, &msgvblock, common.BFNone)
+	return err
+}
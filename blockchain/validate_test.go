@@ -6,6 +6,7 @@ package blockchain
 
 import (
 	"crypto/ecdsa"
+	"github.com/AsimovNetwork/asimov/ainterface"
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain/txo"
 	"github.com/AsimovNetwork/asimov/chaincfg"
@@ -15,6 +16,7 @@ import (
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/txscript"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+	"github.com/AsimovNetwork/asimov/vm/fvm/params"
 	"math"
 	"reflect"
 	"sort"
@@ -232,7 +234,7 @@ func TestIsFinalizedTransaction(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   0,
 	}
 
@@ -246,7 +248,7 @@ func TestIsFinalizedTransaction(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   123,
 	}
 
@@ -260,7 +262,7 @@ func TestIsFinalizedTransaction(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   1234567890,
 	}
 
@@ -277,7 +279,7 @@ func TestIsFinalizedTransaction(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   3234567890,
 	}
 	invalidSequenceTx.TxIn[0].Sequence = math.MaxUint32
@@ -296,7 +298,7 @@ func TestIsFinalizedTransaction(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   3234567890,
 	}
 	validSequenceTx.TxIn[0].Sequence = math.MaxUint32
@@ -360,7 +362,7 @@ func TestCheckTransactionSanity(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   123,
 	}
 
@@ -375,7 +377,7 @@ func TestCheckTransactionSanity(t *testing.T) {
 		TxOut: []*protos.TxOut {
 			protos.NewTxOut(10000000000, []byte{txscript.OP_1}, asiutil.AsimovAsset),
 		},
-		TxContract: protos.TxContract{21000},
+		TxContract: protos.TxContract{GasLimit: 21000},
 		LockTime:   0,
 	}
 	tmpTxIn := protos.NewTxIn(&protos.OutPoint{
@@ -1453,8 +1455,6 @@ func TestCheckBlockHeaderSanity(t *testing.T) {
 			"ErrBadSlotOrRound",
 		},
 	}
-	chaincfg.Cfg.MaxTimeOffset = 30
-
 	t.Logf("Running %d checkBlockHeaderSanity tests", len(tests))
 	for i, test := range tests {
 		t.Logf("=============the %d test start=============", i)
@@ -1727,8 +1727,6 @@ func TestCheckBlockSanity(t *testing.T) {
 		},
 	}
 
-	chaincfg.Cfg.MaxTimeOffset = 30
-
 	t.Logf("Running %d TestCheckBlockSanity tests", len(tests))
 	for i, test := range tests {
 		err = CheckBlockSanity(test.block, bestNode0)
@@ -2625,7 +2623,7 @@ func TestCheckConnectBlock(t *testing.T) {
 		var allLogs []*types.Log
 		var msgvblock protos.MsgVBlock
 		receipts, allLogs, err = chain.checkConnectBlock(test.node, test.block, view,
-			nil, nil)
+			nil, nil, common.BFNone)
 		if err != nil {
 			if dbErr, ok := err.(RuleError); !ok || dbErr.ErrorCode.String() != test.errCodeString {
 				if !ok {
@@ -2642,3 +2640,253 @@ func TestCheckConnectBlock(t *testing.T) {
 		}
 	}
 }
+
+// TestCheckAccessList ensures access lists declaring an account or a storage
+// slot twice are rejected.
+func TestCheckAccessList(t *testing.T) {
+	addr := common.Address{0x66, 0x01}
+	key := common.Hash{0x01}
+	tests := []struct {
+		name  string
+		list  []protos.AccessTuple
+		valid bool
+	}{
+		{"empty", nil, true},
+		{"distinct", []protos.AccessTuple{
+			{Address: addr, StorageKeys: []common.Hash{key, {0x02}}},
+			{Address: common.Address{0x63, 0x02}, StorageKeys: []common.Hash{key}},
+		}, true},
+		{"duplicate account", []protos.AccessTuple{
+			{Address: addr}, {Address: addr},
+		}, false},
+		{"duplicate storage key", []protos.AccessTuple{
+			{Address: addr, StorageKeys: []common.Hash{key, key}},
+		}, false},
+	}
+	for _, test := range tests {
+		tx := &protos.MsgTx{
+			Version: 1,
+			TxIn: []*protos.TxIn{
+				protos.NewTxIn(&protos.OutPoint{
+					Hash:  common.Hash{0x01},
+					Index: 0,
+				}, nil),
+			},
+		}
+		tx.SetAccessList(test.list)
+		err := checkAccessList(tx)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if !test.valid {
+			if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBadAccessList {
+				t.Errorf("%s: got error %v, want ErrBadAccessList", test.name, err)
+			}
+		}
+	}
+}
+
+// TestTxBaseGas ensures the accounts and the storage slots declared by an
+// access list are charged on top of the size of the transaction.
+func TestTxBaseGas(t *testing.T) {
+	tx := &protos.MsgTx{Version: 1}
+	sizeGas := func() uint64 {
+		return uint64(tx.SerializeSize() * common.GasPerByte)
+	}
+	if got := txBaseGas(tx); got != sizeGas() {
+		t.Fatalf("txBaseGas without access list = %d, want %d", got, sizeGas())
+	}
+
+	tx.SetAccessList([]protos.AccessTuple{
+		{Address: common.Address{0x66, 0x01}, StorageKeys: []common.Hash{{0x01}, {0x02}}},
+		{Address: common.Address{0x63, 0x02}},
+	})
+	want := sizeGas() + 2*params.TxAccessListAddressGas +
+		2*params.TxAccessListStorageKeyGas
+	if got := txBaseGas(tx); got != want {
+		t.Fatalf("txBaseGas with access list = %d, want %d", got, want)
+	}
+}
+
+// TestCheckTransactionSanityAccessListGas ensures an access list transaction
+// whose gas limit covers its size but not its access list charges is rejected.
+func TestCheckTransactionSanityAccessListGas(t *testing.T) {
+	tx := &protos.MsgTx{
+		Version: 1,
+		TxIn: []*protos.TxIn{
+			protos.NewTxIn(&protos.OutPoint{
+				Hash:  common.Hash{0x01},
+				Index: 0,
+			}, nil),
+		},
+		TxOut: []*protos.TxOut{
+			protos.NewTxOut(1, []byte{txscript.OP_1}, asiutil.AsimovAsset),
+		},
+	}
+	tx.SetAccessList([]protos.AccessTuple{
+		{Address: common.Address{0x63, 0x01}, StorageKeys: []common.Hash{{0x01}}},
+	})
+
+	sizeGas := uint32(tx.SerializeSize()) * NormalGas
+	tx.TxContract.GasLimit = sizeGas
+	err := CheckTransactionSanity(asiutil.NewTx(tx))
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBadGasLimit {
+		t.Fatalf("gas limit %d below base gas %d: got %v, want %v",
+			sizeGas, txBaseGas(tx), err, ErrBadGasLimit)
+	}
+
+	tx.TxContract.GasLimit = uint32(txBaseGas(tx))
+	if err := CheckTransactionSanity(asiutil.NewTx(tx)); err != nil {
+		t.Fatalf("gas limit equal to base gas: unexpected error %v", err)
+	}
+}
+
+// TestCheckStorageWitness ensures storage witnesses witnessing a contract or a
+// storage slot twice, or carrying an empty slot, are rejected.
+func TestCheckStorageWitness(t *testing.T) {
+	addr := common.Address{0x63, 0x01}
+	entry := protos.StorageEntry{Key: common.Hash{0x01}, Value: common.Hash{0x02}}
+	tests := []struct {
+		name      string
+		witnesses []protos.StorageWitness
+		valid     bool
+	}{
+		{"empty", nil, true},
+		{"distinct", []protos.StorageWitness{
+			{Address: addr, Entries: []protos.StorageEntry{entry}},
+			{Address: common.Address{0x63, 0x02}, Entries: []protos.StorageEntry{entry}},
+		}, true},
+		{"duplicate contract", []protos.StorageWitness{
+			{Address: addr}, {Address: addr},
+		}, false},
+		{"duplicate slot", []protos.StorageWitness{
+			{Address: addr, Entries: []protos.StorageEntry{entry, entry}},
+		}, false},
+		{"empty slot", []protos.StorageWitness{
+			{Address: addr, Entries: []protos.StorageEntry{{Key: common.Hash{0x01}}}},
+		}, false},
+	}
+	for _, test := range tests {
+		tx := &protos.MsgTx{
+			Version: 1,
+			TxIn: []*protos.TxIn{
+				protos.NewTxIn(&protos.OutPoint{
+					Hash:  common.Hash{0x01},
+					Index: 0,
+				}, nil),
+			},
+		}
+		tx.SetStorageWitnesses(test.witnesses)
+		err := checkStorageWitness(tx)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if !test.valid {
+			if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBadStorageWitness {
+				t.Errorf("%s: got error %v, want ErrBadStorageWitness", test.name, err)
+			}
+		}
+	}
+}
+
+// TestCheckCoreTeamReward ensures the coinbase must pay the foundation at least
+// its share of the reward of every asset.
+func TestCheckCoreTeamReward(t *testing.T) {
+	fundationAddr := common.HexToAddress(string(common.GenesisOrganization))
+	fundationScript, _ := txscript.PayToAddrScript(&fundationAddr)
+	asset := protos.NewAsset(protos.DivisibleAsset, 1, 1)
+	rewards := map[protos.Asset]int64{
+		asiutil.AsimovAsset: 1000,
+		*asset:              100,
+	}
+
+	tests := []struct {
+		name     string
+		asimov   int64
+		other    int64
+		share    int64
+		expected bool
+	}{
+		{"default share paid", 200, 20, common.CoreTeamShare, true},
+		{"higher share paid", 300, 30, common.CoreTeamShare, true},
+		{"asset share missing", 200, 0, common.CoreTeamShare, false},
+		{"voted share underpaid", 200, 20, 2500, false},
+		{"voted share paid", 250, 25, 2500, true},
+	}
+	for _, test := range tests {
+		coinbaseTx := protos.NewMsgTx(protos.TxVersion)
+		coinbaseTx.AddTxOut(protos.NewTxOut(test.asimov, fundationScript, asiutil.AsimovAsset))
+		if test.other > 0 {
+			coinbaseTx.AddTxOut(protos.NewTxOut(test.other, fundationScript, *asset))
+		}
+		split := &ainterface.RewardSplit{Foundation: test.share}
+		err := checkCoreTeamReward(coinbaseTx, rewards, split)
+		if (err == nil) != test.expected {
+			t.Errorf("%s: unexpected result %v", test.name, err)
+		}
+	}
+}
+
+// TestRewardSplitShares ensures the shares of the reward are rounded down and
+// computed without overflow.
+func TestRewardSplitShares(t *testing.T) {
+	tests := []struct {
+		reward     int64
+		split      ainterface.RewardSplit
+		foundation int64
+		burn       int64
+	}{
+		{1000, ainterface.RewardSplit{Foundation: 2000}, 200, 0},
+		{999, ainterface.RewardSplit{Foundation: 2000, Burn: 1}, 199, 0},
+		{12345, ainterface.RewardSplit{Foundation: 1234, Burn: 5678}, 1523, 7009},
+		{math.MaxInt64, ainterface.RewardSplit{Foundation: 1, Burn: common.RewardSplitBasis},
+			math.MaxInt64 / common.RewardSplitBasis, math.MaxInt64},
+	}
+	for _, test := range tests {
+		foundation, burn := test.split.Shares(test.reward)
+		if foundation != test.foundation || burn != test.burn {
+			t.Errorf("shares of %d with %+v: %d and %d, want %d and %d",
+				test.reward, test.split, foundation, burn,
+				test.foundation, test.burn)
+		}
+	}
+}
+
+// TestCalcRewardSplit ensures the foundation receives its default share of the
+// reward until the first subsidy reduction, or during the foundation reward
+// period, when the validator committee sets no distribution.
+func TestCalcRewardSplit(t *testing.T) {
+	parivateKeyList := []string{
+		"0xd0f0461b7b4d26cf370e6c73b58ef7fa26e8e30853a8cee901ed42cf0879cb6e", //privateKey0
+	}
+	_, netParam, chain, teardownFunc, err := createFakeChainByPrivateKeys(parivateKeyList, 10)
+	if err != nil || chain == nil {
+		t.Fatalf("createFakeChainByPrivateKeys error %v", err)
+	}
+	defer teardownFunc()
+
+	genesisTime := netParam.GenesisBlock.Header.Timestamp
+	lastReduced := netParam.SubsidyReductionInterval
+	tests := []struct {
+		name       string
+		height     int32
+		timestamp  int64
+		foundation int64
+	}{
+		{"before the reduction", lastReduced, genesisTime + foundationRewardPeriod, common.CoreTeamShare},
+		{"during the period", lastReduced + 1, genesisTime + foundationRewardPeriod - 1, common.CoreTeamShare},
+		{"after the period", lastReduced + 1, genesisTime + foundationRewardPeriod, 0},
+		{"after the old template period", lastReduced + 1, genesisTime + 86400*(365*4+1), 0},
+	}
+	for _, test := range tests {
+		split, err := chain.calcRewardSplit(chain.bestChain.Tip(), nil,
+			test.height, test.timestamp)
+		if err != nil {
+			t.Fatalf("%s: calcRewardSplit: %v", test.name, err)
+		}
+		if split.Foundation != test.foundation || split.Burn != 0 {
+			t.Errorf("%s: split %+v, want a foundation share of %d",
+				test.name, split, test.foundation)
+		}
+	}
+}
@@ -5,12 +5,14 @@
 package chaincfg
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/rpcs/rpc"
 	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -23,6 +25,8 @@ import (
 	"github.com/AsimovNetwork/asimov/common"
 	fnet "github.com/AsimovNetwork/asimov/common/net"
 	"github.com/AsimovNetwork/asimov/logger"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/webhook"
 )
 
 const (
@@ -35,6 +39,7 @@ const (
 	DefaultMaxPeers             = 125
 	DefaultBanDuration          = time.Hour * 24
 	DefaultBanThreshold         = 100
+	DefaultMisbehaviorWindow    = time.Hour
 	DefaultMaxRPCClients        = 10
 	DefaultMaxRPCWebsockets     = 25
 	DefaultMaxRPCConcurrentReqs = 20
@@ -46,16 +51,57 @@ const (
 	DefaultMinTxPrice            = 0.01
 	DefaultMaxOrphanTransactions = 100
 	DefaultMaxOrphanTxSize       = 100000
+	DefaultMaxOrphanPoolSize     = 5
+	DefaultReplacementBump       = 10
+	DefaultSigCacheMaxSize       = 100000
+	DefaultUtxoCacheMaxSize      = 250
 	DefaultAutoSignUpGasLimit    = 300000
 	DefaultMergeLimit            = 10
-
-	// DefaultMaxTimeOffsetSeconds is the maximum number of seconds a block
-	// time is allowed to be ahead of the current time.
-	DefaultMaxTimeOffsetSeconds = 30
+	DefaultWebhookMaxRetries     = 5
+	DefaultAlertInterval         = time.Minute * 30
+	DefaultAlertStuckSync        = time.Minute * 10
+	DefaultAlertMinDiskSpace     = 1024
+	DefaultAlertMinPeers         = 2
+	DefaultMinDiskSpace          = 256
+	DefaultCompactInterval       = time.Hour * 24 * 7
+	DefaultTracingSampleRate     = 1.0
+	DefaultSafeModeReorgDepth    = 10
+	DefaultPenaltyMode           = "none"
+	DefaultTxSelector            = "feerate"
+	DefaultPruneDepth            = 1000
+	DefaultHistoricalDepth       = 120960
+	DefaultBanFeedInterval       = time.Minute * 10
+	DefaultConsolidateMinOutputs = 50
+	DefaultConsolidateMaxInputs  = 100
+	DefaultConsolidateMaxFee     = 100000
+	DefaultConsolidateMaxMempool = 100
+
+	// MinPruneTarget is the lowest prune target, in megabytes, leaving room
+	// for the block file being written and the one before it.
+	MinPruneTarget = 1024
+
+	// MinPruneDepth is the lowest number of blocks kept below the best
+	// block when pruning.
+	MinPruneDepth = 100
+
+	// maxTimeOffsetOption is the highest value of the deprecated
+	// maxtimeoffset option on the main network, and minTimeOffsetOption
+	// the value up to which it is ignored.
+	maxTimeOffsetOption = 30
+	minTimeOffsetOption = 5
+
+	// maxHandshakeJitter is the maximum delay before sending the version
+	// message, well below the protocol negotiation timeout of peers.
+	maxHandshakeJitter = time.Second * 5
 
 	DefaultHTTPEndPoint = "127.0.0.1:8545" // Default endpoint interface for the HTTP RPC server
 	DefaultWSEndPoint   = "127.0.0.1:8546" // Default endpoint interface for the websocket RPC server
 
+	DefaultRPCMaxRequestSize = 1024 * 1024 * 2
+	DefaultRPCCacheSize      = 64
+	DefaultRPCSlowCall       = time.Second
+	DefaultRPCSlowLogSize    = 100
+
 	// DefaultBlockProductedTimeOut is the default value for the policy
 	// `BlockProductedTimeOut`. There are four steps which take the main
 	// time of a block interval:
@@ -91,7 +137,8 @@ var (
 	Cfg                *FConfig
 
 	DefaultHttpModules      = []string{"net", "web3"}
-	DefaultHTTPVirtualHosts = []string{"localhost"}
+	DefaultHTTPCors         = []string{"*"}
+	DefaultHTTPVirtualHosts = []string{"*"}
 	DefaultWSOrigins        = []string{"*"}
 	DefaultWSModules        = []string{"net", "web3"}
 )
@@ -112,11 +159,12 @@ type FConfig struct {
 	AddPeers             []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
-	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8777, testnet: 18721)"`
+	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections, optionally followed by /<policy> {public, whitelist, validator, tor} (default all interfaces port: 8777, testnet: 18721)"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	MisbehaviorWindow    time.Duration `long:"misbehaviorwindow" description:"How long the ban scores of the past connections of a host add up, so a misbehaving peer is banned after reconnecting several times"`
 	WhitelistsArr        []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause btcd to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause btcd to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
@@ -132,6 +180,8 @@ type FConfig struct {
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
 	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
+	DNSSeedsArr          []string      `long:"dnsseed" description:"Query this DNS seed for peers instead of the seeds of the network, followed by /filter when it supports filtering by services in a subdomain (eg. seed.example.com/filter)"`
+	ReadReplica          bool          `long:"readreplica" description:"Only serve query RPCs from the data directory, without connecting to peers or taking part in consensus -- Use on a copy of the data directory of a validating node to offload heavy queries"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyUser            string        `long:"proxyuser" description:"Username for proxy server"`
@@ -141,14 +191,19 @@ type FConfig struct {
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	TorControl           string        `long:"torcontrol" description:"Tor control port used to create an onion service for the incoming connections (eg. 127.0.0.1:9051)"`
+	TorPassword          string        `long:"torpassword" default-mask:"-" description:"Password of the Tor control port -- the cookie file announced by Tor is used when not set"`
 	TestNet              bool          `long:"testnet" description:"Use the test network"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Price (RBP) signaling policy."`
+	ReplacementBump      float64       `long:"replacementbump" description:"Minimum percentage by which the gas price of a replacement transaction must exceed the gas price of the transactions it replaces"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation network"`
 	DevelopNet           bool          `long:"devnet" description:"Use the develop network"`
+	DevMode              bool          `long:"dev" description:"Run a single node developer chain on the develop network: the solo consensus produces a block as soon as the mempool holds transactions, with the first developer key, which funds the other developer keys"`
 	ChainId              uint64        `long:"chainid" description:"Use distinguish different chain, the main chain occupy zero, each subchain take a positive integer"`
 	AddCheckpointsArr    []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
+	AssumeValid          string        `long:"assumevalid" description:"Hash of a block assumed valid: the scripts of its ancestors are not verified, which shortens the initial sync (0 to verify the scripts of all the blocks, defaults to the block of the network)"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the logger level for individual subsystems -- Use show to list available subsystems"`
@@ -157,34 +212,130 @@ type FConfig struct {
 	BlkProductedTimeOut  float64       `long:"blkproductedtimeout" description:"the value for the policy BlockProductedTimeOut,the value must be in range of (0, 1)"`
 	TxConnectTimeOut     float64       `long:"txconnecttimeout" description:"the value for the policy TxConnectTimeOut,the value must be in range of (0, 1)"`
 	UtxoValidateTimeOut  float64       `long:"utxovalidatetimeout" description:"the time for validating utxos,the value must be in range of (0, 1)"`
+	CanonicalTxOrder     bool          `long:"canonicaltxorder" description:"Order the transactions of the produced blocks by hash, after the transactions they spend, instead of by gas price"`
+	TxSelector           string        `long:"txselector" description:"Policy selecting the transactions of the produced blocks {feerate, ancestorfeerate}"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
 	MaxOrphanTxSize      int           `long:"maxorphantxsize" description:"Max size of an orphan transaction to allow in memory"`
+	MaxOrphanPoolSize    int           `long:"maxorphanpoolsize" description:"Max total size in megabytes of the orphan transactions to keep in memory"`
+	NoPersistMempool     bool          `long:"nopersistmempool" description:"Do not save the mempool to mempool.dat in the data directory on shutdown and load it again on start"`
+	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache shared by the mempool and the block validation, 0 to disable it"`
+	UtxoCacheMaxSize     uint64        `long:"utxocachemaxsize" description:"The maximum size in megabytes of the cache of unspent transaction outputs, whose changes are written to the database in batches (0 to write them with every block)"`
 	Consensustype        string        `long:"consensustype" description:"Consensus type which the server uses"`
 	Privatekey           string        `long:"privatekey" description:"Add the private key which is used to assign block header for generated blocks"`
+	RotateKey            string        `long:"rotatekey" description:"Private key the validator signs the blocks with from --rotateheight on, replacing --privatekey"`
+	RotateHeight         int32         `long:"rotateheight" description:"Height of the first block signed with --rotatekey"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
+	UACoarseVersion      bool          `long:"uacoarseversion" description:"Only advertise the major and minor version in the user agent, without the patch version"`
+	HandshakeMetadata    []string      `long:"handshakemeta" description:"Add a key=value metadata entry, such as region=eu or role=validator, sent to the peers in the version message"`
+	HandshakeMeta        map[string]string
+	HandshakeJitter      time.Duration `long:"handshakejitter" description:"Maximum random delay before sending the version message to a peer, so the handshake timing does not identify the node.  Valid time units are {ms, s}.  Maximum 5s"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
+	NoInvClasses         bool          `long:"noinvclasses" description:"Disable the asset issuance and contract event inventory classes"`
+	InvWatchContracts    []string      `long:"invwatchcontract" description:"Add a contract whose events are announced to the peers subscribed to the contract event inventory class"`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
 	EmptyRound           bool          `long:"emptyround" description:"Allow round contains no blocks."`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
-	MaxTimeOffset        int           `long:"maxtimeoffset" description:"The maximum number of seconds a block time is allowed to be ahead of the current time, it is allowd to take [5-30]."`
+	MaxTimeOffset        int           `long:"maxtimeoffset" description:"Deprecated, use the maxtimeoffset field of the chain parameters file -- The maximum number of seconds a block time is allowed to be ahead of the current time, it is allowd to take [5-30]."`
 	MergeLimit           int           `long:"mergeLimit" description:"It is a miner strategy that miner can merge its utxo and push into block."`
+	MinDiskSpace         uint64        `long:"mindiskspace" description:"Stop accepting new blocks when a data directory has less free space than this number of megabytes (0 to disable)"`
+	AuditLog             string        `long:"auditlog" description:"Append a record of every accepted and rejected block and transaction to this file"`
+	CompactInterval      time.Duration `long:"compactinterval" description:"Interval between two compactions of the databases, deferred while the node is not synced (0 to disable).  Valid time units are {s, m, h}"`
+	Prune                uint64        `long:"prune" description:"Delete the oldest blocks and their spend journal entries once the stored blocks take more than this number of megabytes (0 to disable, minimum 1024)"`
+	PruneDepth           int32         `long:"prunedepth" description:"Number of blocks below the best block which are never pruned, so reorganizes up to that depth can be processed (minimum 100)"`
+	HistoricalServeLimit uint64        `long:"historicalservelimit" description:"Max megabytes of historical blocks served per day to each peer, whitelisted peers and validators excepted (0 for no limit)"`
+	HistoricalDepth      int32         `long:"historicaldepth" description:"Number of blocks below the best block from which the blocks are historical and limited by historicalservelimit"`
+	LoadUtxoSet          string        `long:"loadutxoset" description:"Bootstrap the chain from a snapshot written by the dumpUtxoSet RPC, when the database does not hold a chain yet"`
+	LoadUtxoSetHash      string        `long:"loadutxosethash" description:"Hex encoded SHA-256 hash the snapshot of --loadutxoset must match, obtained from a trusted source"`
 	AddCheckpoints       []Checkpoint
+	AssumeValidHash      *common.Hash
 	Whitelists           []*net.IPNet
+	DNSSeeds             []DNSSeed
+	ListenPolicies       map[string]ListenPolicy
 
 	EwasmOptions string `long:"vm.ewasm" description:"Ewasm options"`
 	EvmOptions   string `long:"vm.evm" description:"Evm options"`
 
 	HTTPEndpoint     string   `long:"httpendpoint" description:"Http endpoint to listen for HTTP RPC connections (default port: 127.0.0.1:8545)"`
 	HTTPModules      []string `long:"httpmodule" description:"HTTP RPC modules supported by current node (default [\"net\", \"web3\"])"`
-	HTTPCors         []string `long:"httpcor" description:"HTTPCors is the Cross-Origin Resource Sharing header to send to requesting"`
-	HTTPVirtualHosts []string `long:"httpvirtualhost" description:"HTTPVirtualHosts is the list of virtual host which are allowed on incoming requests (default [\"localhost\"])"`
+	HTTPCors         []string `long:"httpcor" description:"Add an origin allowed to make Cross-Origin requests to the HTTP RPC server, * allowing any origin (default *)"`
+	HTTPVirtualHosts []string `long:"httpvirtualhost" description:"Add a virtual host which is allowed on incoming HTTP RPC requests, * allowing any host (default *)"`
 	HTTPTimeouts     rpc.HTTPTimeouts
 	WSEndpoint       string   `long:"wsendpoint" description:"Ws endpoint to listen for Websocket connections (default port: 127.0.0.1:8546)"`
 	WSOrigins        []string `long:"wsorigins" description:"Ws origins is whitelist of ws (default *)"`
 	WSModules        []string `long:"wsmodule" description:"WebSocket modules supported by current node (default [\"net\", \"web3\"])"`
+	RPCAPIKeys       []string `long:"rpcapikey" default-mask:"-" description:"Add an API key required by the HTTP and WebSocket RPC servers, of the form name:key[:rate[:method=limit,...]] where rate is the calls per second and every limit the calls per day"`
+	RPCAdminKeys     []string `long:"rpcadminkey" default-mask:"-" description:"Add an unlimited API key of the form name:key which may also query the usage of all keys"`
+
+	RPCCacheSize         int      `long:"rpccachesize" description:"Max size in MiB of the cache of RPC responses for blocks and confirmed transactions (0 to disable)"`
+	RPCMaxRequestSize    int64    `long:"rpcmaxrequestsize" description:"Max size in bytes of an HTTP RPC request body or a WebSocket message"`
+	RPCMaxConnsPerIP     int      `long:"rpcmaxconnsperip" description:"Max number of concurrent HTTP RPC requests and WebSocket connections per client address -- 0 for unlimited"`
+	RPCTrustedProxiesArr []string `long:"rpctrustedproxy" description:"Add an IP network or IP of a reverse proxy whose X-Forwarded-For header identifies the RPC clients (eg. 10.0.0.0/8 or ::1)"`
+	RPCTrustedProxies    []*net.IPNet
+	RPCSlowCall          time.Duration `long:"rpcslowcall" description:"Log the RPC calls taking longer than this duration with their parameters, and keep them for the getslowlog command -- 0 to disable"`
+	RPCSlowLogSize       int           `long:"rpcslowlogsize" description:"Number of the most recent slow RPC calls kept for the getslowlog command"`
+
+	Webhooks          []string `long:"webhook" description:"Add a URL which receives JSON event notifications by HTTP POST"`
+	WebhookSecret     string   `long:"webhooksecret" default-mask:"-" description:"Secret used to sign webhook payloads with HMAC-SHA256"`
+	WebhookEvents     []string `long:"webhookevent" description:"Event type delivered to the webhooks {block, tx, contractevent, missedslot} (default all)"`
+	WebhookWatchAddrs []string `long:"webhookwatchaddr" description:"Add an address whose received transactions trigger tx webhook events"`
+	WebhookMaxRetries int      `long:"webhookmaxretries" description:"Max number of retries of a failed webhook delivery before it is written to the dead-letter log (0 to write it on the first failure)"`
+	WebhookEventTypes []webhook.EventType
+
+	ExchangeMode bool `long:"exchangemode" description:"Track the deposits of the addresses registered with watchDepositAddress and POST their confirmations to the registered callback URLs"`
+
+	PersistLockUnspent bool `long:"persistlockunspent" description:"Keep the outputs locked with lockUnspent across restarts"`
+
+	Consolidate           bool  `long:"consolidate" description:"Consolidate the outputs of the address of --privatekey when they are fragmented and the mempool is not congested"`
+	ConsolidateMinOutputs int   `long:"consolidateminoutputs" description:"Number of outputs a consolidation must remove for it to be recommended or performed"`
+	ConsolidateMaxInputs  int   `long:"consolidatemaxinputs" description:"Max number of outputs spent by an automatic consolidation (at most 500)"`
+	ConsolidateMaxFee     int64 `long:"consolidatemaxfee" description:"Max fee in xing paid by an automatic consolidation"`
+	ConsolidateMaxMempool int   `long:"consolidatemaxmempool" description:"Max number of transactions in the mempool for an automatic consolidation to run"`
+
+	AlertSlackWebhooks []string      `long:"alertslack" description:"Add a Slack incoming webhook URL which receives operational alerts"`
+	AlertSMTPServer    string        `long:"alertsmtpserver" description:"SMTP server used to mail operational alerts (eg. smtp.example.com:587)"`
+	AlertSMTPUser      string        `long:"alertsmtpuser" description:"Username for the SMTP server"`
+	AlertSMTPPass      string        `long:"alertsmtppass" default-mask:"-" description:"Password for the SMTP server"`
+	AlertEmailFrom     string        `long:"alertemailfrom" description:"Sender address of alert mails"`
+	AlertEmailTo       []string      `long:"alertemailto" description:"Add a recipient of alert mails"`
+	AlertInterval      time.Duration `long:"alertinterval" description:"Minimum interval between two alerts of the same condition.  Valid time units are {s, m, h}"`
+	AlertStuckSync     time.Duration `long:"alertstucksync" description:"Raise an alert when the best block did not change for this duration.  Valid time units are {s, m, h}"`
+	AlertMinDiskSpace  uint64        `long:"alertmindiskspace" description:"Raise an alert when a data directory has less free space than this number of megabytes"`
+	AlertMinPeers      int           `long:"alertminpeers" description:"Raise an alert when fewer peers than this are connected"`
+
+	ReplicaListen  string `long:"replicalisten" description:"Listen for replication secondaries on this address and stream them every main chain block (eg. 0.0.0.0:8778)"`
+	ReplicaPrimary string `long:"replicaprimary" description:"Run as a hot standby of the primary node at this address, connecting the blocks it streams without executing them"`
+	ReplicaSecret  string `long:"replicasecret" default-mask:"-" description:"Secret shared by a replication primary and its secondaries to authenticate each other"`
+
+	ScriptWorkers    int `long:"scriptworkers" description:"Number of goroutines validating the input scripts of a transaction or block (default: GOMAXPROCS)"`
+	VMWorkers        int `long:"vmworkers" description:"Max number of contract executions of RPC calls running at the same time (default: 1 per CPU)"`
+	PeerWriteWorkers int `long:"peerwriteworkers" description:"Max number of peers encoding a message to send at the same time (default: 4 per CPU)"`
+	IndexWorkers     int `long:"indexworkers" description:"Number of goroutines loading blocks while the indexes catch up (default: 1 per CPU)"`
+
+	TracingEndpoint   string  `long:"tracingendpoint" description:"Export OpenTelemetry spans of block processing, mempool acceptance, transaction execution and RPC calls to this OTLP/HTTP traces URL (eg. http://127.0.0.1:4318/v1/traces)"`
+	TracingSampleRate float64 `long:"tracingsamplerate" description:"Fraction of the traces which are recorded and exported, from 0 to 1"`
+
+	BlockPush bool `long:"blockpush" description:"Push the blocks produced by this validator directly to the whitelisted peers and accept the blocks they push without inv/getdata"`
+
+	NoCompression bool `long:"nocompression" description:"Do not negotiate the compression of large block, headers and inv payloads with peers"`
+
+	QUIC bool `long:"quic" description:"Experimental: also listen for QUIC connections on the UDP ports of the listeners and connect over QUIC to the peers advertising it, transferring blocks and transactions on separate streams"`
+
+	SafeModeReorgDepth int32 `long:"safemodereorgdepth" description:"Enter safe mode, refusing to send transactions until acknowledged with the acknowledgeSafeMode RPC, when a reorganize detaches at least this number of blocks (0 to disable)"`
+
+	EquivocationPenalty string `long:"equivocationpenalty" description:"Penalty applied to a validator producing two blocks for the same slot: none, deprioritize its blocks in the fork choice, or reject its blocks"`
+	InvalidBlockPenalty string `long:"invalidblockpenalty" description:"Penalty applied to a validator producing an invalid block: none, deprioritize its blocks in the fork choice, or reject its blocks"`
+	PenaltyRounds       uint32 `long:"penaltyrounds" description:"Number of rounds following the evidence a validator penalty lasts (0 to last until cleared with the clearValidatorPenalty RPC)"`
+
+	BanFeed         string        `long:"banfeed" description:"Periodically import the signed ban list served at this URL"`
+	BanFeedKey      string        `long:"banfeedkey" description:"Hex encoded secp256k1 public key which must have signed the ban list of the ban feed"`
+	BanFeedInterval time.Duration `long:"banfeedinterval" description:"Interval between two fetches of the ban feed.  Valid time units are {s, m, h}.  Minimum 1 minute"`
+
+	ChainParams string `long:"chainparams" description:"JSON file overriding the parameters of the selected network, such as its magic bytes, default port, round size and max block size, for private networks"`
+
+	ASMap string `long:"asmap" description:"File mapping IP prefixes to autonomous system numbers, one '<prefix>/<bits> <asn>' per line, used to connect to peers of distinct hosting providers"`
 
 	AddBtc    []string `long:"addbtc" description:"Add a param to call btc server.  Format: '<ip>:<port>:<rpcuser>:<rpcpassword>'"`
 	BtcParams []*BitcoinParams
@@ -354,6 +505,7 @@ func LoadConfig() (*FConfig, []string, error) {
 		MaxPeers:             DefaultMaxPeers,
 		BanDuration:          DefaultBanDuration,
 		BanThreshold:         DefaultBanThreshold,
+		MisbehaviorWindow:    DefaultMisbehaviorWindow,
 		RPCMaxClients:        DefaultMaxRPCClients,
 		RPCMaxWebsockets:     DefaultMaxRPCWebsockets,
 		RPCMaxConcurrentReqs: DefaultMaxRPCConcurrentReqs,
@@ -368,17 +520,46 @@ func LoadConfig() (*FConfig, []string, error) {
 		UtxoValidateTimeOut:  DefaultUtxoValidateTimeOut,
 		MaxOrphanTxs:         DefaultMaxOrphanTransactions,
 		MaxOrphanTxSize:      DefaultMaxOrphanTxSize,
+		MaxOrphanPoolSize:    DefaultMaxOrphanPoolSize,
+		ReplacementBump:      DefaultReplacementBump,
+		SigCacheMaxSize:      DefaultSigCacheMaxSize,
+		UtxoCacheMaxSize:     DefaultUtxoCacheMaxSize,
 		EmptyRound:           false,
-		MaxTimeOffset:        DefaultMaxTimeOffsetSeconds,
 		MergeLimit:           DefaultMergeLimit,
+		MinDiskSpace:         DefaultMinDiskSpace,
+		CompactInterval:      DefaultCompactInterval,
+		WebhookMaxRetries:    DefaultWebhookMaxRetries,
+		AlertInterval:        DefaultAlertInterval,
+		AlertStuckSync:       DefaultAlertStuckSync,
+		AlertMinDiskSpace:    DefaultAlertMinDiskSpace,
+		AlertMinPeers:        DefaultAlertMinPeers,
+		TracingSampleRate:    DefaultTracingSampleRate,
+		SafeModeReorgDepth:   DefaultSafeModeReorgDepth,
+		EquivocationPenalty:  DefaultPenaltyMode,
+		InvalidBlockPenalty:  DefaultPenaltyMode,
+		TxSelector:           DefaultTxSelector,
+		BanFeedInterval:      DefaultBanFeedInterval,
+		PruneDepth:           DefaultPruneDepth,
+		HistoricalDepth:      DefaultHistoricalDepth,
+
+		ConsolidateMinOutputs: DefaultConsolidateMinOutputs,
+		ConsolidateMaxInputs:  DefaultConsolidateMaxInputs,
+		ConsolidateMaxFee:     DefaultConsolidateMaxFee,
+		ConsolidateMaxMempool: DefaultConsolidateMaxMempool,
 
 		HTTPEndpoint:     DefaultHTTPEndPoint,
 		HTTPModules:      DefaultHttpModules,
+		HTTPCors:         DefaultHTTPCors,
 		HTTPVirtualHosts: DefaultHTTPVirtualHosts,
 		HTTPTimeouts:     rpc.DefaultHTTPTimeouts,
 		WSEndpoint:       DefaultWSEndPoint,
 		WSOrigins:        DefaultWSOrigins,
 		WSModules:        DefaultWSModules,
+
+		RPCMaxRequestSize: DefaultRPCMaxRequestSize,
+		RPCCacheSize:      DefaultRPCCacheSize,
+		RPCSlowCall:       DefaultRPCSlowCall,
+		RPCSlowLogSize:    DefaultRPCSlowLogSize,
 	}
 
 	// Service options which are only added on Windows.
@@ -476,6 +657,20 @@ func LoadConfig() (*FConfig, []string, error) {
 		return nil, nil, err
 	}
 
+	// The developer mode runs the develop network alone with the solo
+	// consensus, producing the blocks with the first developer key unless
+	// another one is configured.  The rounds without transactions have no
+	// blocks.
+	if cfg.DevMode {
+		cfg.DevelopNet = true
+		cfg.Consensustype = "solo"
+		cfg.DisableDNSSeed = true
+		cfg.EmptyRound = true
+		if cfg.Privatekey == "" {
+			cfg.Privatekey = DevKeys[0]
+		}
+	}
+
 	// Multiple networks can't be selected simultaneously.
 	numNets := 0
 	genesisBlock := "mainnet.block"
@@ -515,6 +710,38 @@ func LoadConfig() (*FConfig, []string, error) {
 	} else if numNets == 0 {
 		cfg.EmptyRound = false
 	}
+
+	// Override the parameters of the selected network for private networks.
+	if cfg.ChainParams != "" {
+		cfg.ChainParams = cleanAndExpandPath(cfg.ChainParams)
+		params, err := loadChainParams(cfg.ChainParams, ActiveNetParams.Params)
+		if err != nil {
+			str := "%s: Unable to load the chain parameters file %s: %v"
+			err := fmt.Errorf(str, funcName, cfg.ChainParams, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		ActiveNetParams = &netParams{Params: params}
+	}
+
+	// The maxtimeoffset option used to be the max time offset of the
+	// network, which all the nodes must agree on.
+	if cfg.MaxTimeOffset != 0 {
+		if numNets == 0 && cfg.MaxTimeOffset > maxTimeOffsetOption {
+			str := "%s: The maxtimeoffset option may not be greater than %d " +
+				"-- parsed [%d]"
+			err := fmt.Errorf(str, funcName, maxTimeOffsetOption, cfg.MaxTimeOffset)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.MaxTimeOffset > minTimeOffsetOption {
+			params := *ActiveNetParams.Params
+			params.MaxTimeOffset = int64(cfg.MaxTimeOffset)
+			ActiveNetParams = &netParams{Params: &params}
+		}
+	}
 	cfg.GenesisBlockFile = filepath.Join(cfg.GenesisPath, genesisBlock)
 	cfg.GenesisParamFile = filepath.Join(cfg.GenesisPath, DefaultGenesisFilename)
 
@@ -534,15 +761,29 @@ func LoadConfig() (*FConfig, []string, error) {
 	// means each individual piece of serialized data does not have to
 	// worry about changing names per network and such.
 	cfg.DataDir = cleanAndExpandPath(cfg.DataDir)
-	cfg.DataDir = filepath.Join(cfg.DataDir, ActiveNetParams.Name())
+	if cfg.AuditLog != "" {
+		cfg.AuditLog = cleanAndExpandPath(cfg.AuditLog)
+	}
+	if cfg.ASMap != "" {
+		cfg.ASMap = cleanAndExpandPath(cfg.ASMap)
+	}
+	if cfg.LoadUtxoSet != "" {
+		cfg.LoadUtxoSet = cleanAndExpandPath(cfg.LoadUtxoSet)
+	}
+	// The developer chain is kept apart from a node of the develop network.
+	netDir := ActiveNetParams.Name()
+	if cfg.DevMode {
+		netDir += "-dev"
+	}
+	cfg.DataDir = filepath.Join(cfg.DataDir, netDir)
 
 	// Append the network type to the logger directory so it is "namespaced"
 	// per network in the same fashion as the data directory.
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
-	cfg.LogDir = filepath.Join(cfg.LogDir, ActiveNetParams.Name())
+	cfg.LogDir = filepath.Join(cfg.LogDir, netDir)
 
 	cfg.StateDir = cleanAndExpandPath(cfg.StateDir)
-	cfg.StateDir = filepath.Join(cfg.StateDir, ActiveNetParams.Name())
+	cfg.StateDir = filepath.Join(cfg.StateDir, netDir)
 
 	// Special show command to list supported subsystems and exit.
 	if cfg.DebugLevel == "show" {
@@ -611,6 +852,162 @@ func LoadConfig() (*FConfig, []string, error) {
 		}
 	}
 
+	// Parse the DNS seeds replacing the seeds of the network.
+	for _, s := range cfg.DNSSeedsArr {
+		host, filtering := s, false
+		if i := strings.LastIndex(s, "/"); i >= 0 {
+			host, filtering = s[:i], true
+			if s[i+1:] != "filter" {
+				host = ""
+			}
+		}
+		if host == "" {
+			str := "%s: The dnsseed value of '%s' is invalid"
+			err := fmt.Errorf(str, funcName, s)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.DNSSeeds = append(cfg.DNSSeeds, DNSSeed{Host: host, HasFiltering: filtering})
+	}
+
+	// Validate any given trusted reverse proxies of the RPC servers.
+	for _, addr := range cfg.RPCTrustedProxiesArr {
+		ipnet, err := rpc.ParseTrustedProxy(addr)
+		if err != nil {
+			str := "%s: The rpctrustedproxy value of '%s' is invalid"
+			err = fmt.Errorf(str, funcName, addr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.RPCTrustedProxies = append(cfg.RPCTrustedProxies, ipnet)
+	}
+	if cfg.RPCCacheSize < 0 {
+		str := "%s: The rpccachesize option may not be negative -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCCacheSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCMaxRequestSize <= 0 || cfg.RPCMaxConnsPerIP < 0 {
+		str := "%s: The rpcmaxrequestsize option must be positive and " +
+			"rpcmaxconnsperip may not be negative -- parsed [%d, %d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxRequestSize, cfg.RPCMaxConnsPerIP)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCSlowCall < 0 || cfg.RPCSlowLogSize < 0 {
+		str := "%s: The rpcslowcall and rpcslowlogsize options may not be " +
+			"negative -- parsed [%v, %d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCSlowCall, cfg.RPCSlowLogSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Replication requires a secret, and a secondary writes the blocks of
+	// its primary so it can not be a read replica.
+	if (cfg.ReplicaListen != "" || cfg.ReplicaPrimary != "") &&
+		cfg.ReplicaSecret == "" {
+
+		str := "%s: the --replicalisten and --replicaprimary options " +
+			"require --replicasecret"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ReplicaPrimary != "" && cfg.ReadReplica {
+		str := "%s: the --replicaprimary and --readreplica options can " +
+			"not be mixed"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.ScriptWorkers < 0 || cfg.VMWorkers < 0 ||
+		cfg.PeerWriteWorkers < 0 || cfg.IndexWorkers < 0 {
+
+		str := "%s: The worker pool sizes may not be negative -- parsed " +
+			"[%d, %d, %d, %d]"
+		err := fmt.Errorf(str, funcName, cfg.ScriptWorkers, cfg.VMWorkers,
+			cfg.PeerWriteWorkers, cfg.IndexWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.SafeModeReorgDepth < 0 {
+		str := "%s: The safemodereorgdepth option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.SafeModeReorgDepth)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, penalty := range []struct{ option, mode string }{
+		{"equivocationpenalty", cfg.EquivocationPenalty},
+		{"invalidblockpenalty", cfg.InvalidBlockPenalty},
+	} {
+		switch penalty.mode {
+		case "none", "deprioritize", "reject":
+		default:
+			str := "%s: The %s option must be one of none, " +
+				"deprioritize or reject -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, penalty.option, penalty.mode)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	switch cfg.TxSelector {
+	case "feerate", "ancestorfeerate":
+	default:
+		str := "%s: The txselector option must be one of feerate " +
+			"or ancestorfeerate -- parsed [%s]"
+		err := fmt.Errorf(str, funcName, cfg.TxSelector)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.Prune != 0 && cfg.Prune < MinPruneTarget {
+		str := "%s: The prune option may not be less than %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, MinPruneTarget, cfg.Prune)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.PruneDepth < MinPruneDepth {
+		str := "%s: The prunedepth option may not be less than %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, MinPruneDepth, cfg.PruneDepth)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.HistoricalDepth < 0 {
+		str := "%s: The historicaldepth option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.HistoricalDepth)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.TracingSampleRate < 0 || cfg.TracingSampleRate > 1 {
+		str := "%s: The tracingsamplerate option must be between 0 and 1 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.TracingSampleRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --addPeer and --connect do not mix.
 	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
 		str := "%s: the --addpeer and --connect options can not be " +
@@ -621,6 +1018,132 @@ func LoadConfig() (*FConfig, []string, error) {
 		return nil, nil, err
 	}
 
+	// A read replica does not follow the chain, so it can not track the
+	// deposits.
+	if cfg.ReadReplica && cfg.ExchangeMode {
+		str := "%s: the --readreplica and --exchangemode options " +
+			"can not be used together"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// A read replica does not write the databases of the node it follows.
+	if cfg.LoadUtxoSet != "" {
+		if hash, err := hex.DecodeString(cfg.LoadUtxoSetHash); err != nil || len(hash) != common.HashLength {
+			str := "%s: The loadutxoset option requires the " +
+				"loadutxosethash option to hold the hex encoded " +
+				"SHA-256 hash of the snapshot -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, cfg.LoadUtxoSetHash)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	if cfg.ReadReplica && cfg.LoadUtxoSet != "" {
+		str := "%s: the --readreplica and --loadutxoset options " +
+			"can not be used together"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.ReadReplica && cfg.Prune != 0 {
+		str := "%s: the --readreplica and --prune options " +
+			"can not be used together"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.ReadReplica && cfg.PersistLockUnspent {
+		str := "%s: the --readreplica and --persistlockunspent options " +
+			"can not be used together"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// A key rotation replaces the validator key at a height of the chain.
+	// The solo consensus has the validator key as its only validator, so
+	// it can not switch to another key.
+	if cfg.RotateKey != "" || cfg.RotateHeight != 0 {
+		var str string
+		switch {
+		case cfg.RotateKey == "":
+			str = "%s: the --rotateheight option requires --rotatekey"
+		case cfg.Privatekey == "":
+			str = "%s: the --rotatekey option requires --privatekey"
+		case cfg.RotateHeight <= 0:
+			str = "%s: the rotateheight option must be positive"
+		case common.GetConsensus(cfg.Consensustype) == common.SOLO:
+			str = "%s: the --rotatekey option is not supported by " +
+				"the solo consensus"
+		}
+		if str != "" {
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// The automatic consolidation signs with the validator key and needs
+	// room for at least the input paying the fee and another one.
+	if cfg.Consolidate {
+		var str string
+		switch {
+		case cfg.Privatekey == "":
+			str = "%s: the --consolidate option requires --privatekey"
+		case cfg.ReadReplica:
+			str = "%s: the --readreplica and --consolidate options " +
+				"can not be used together"
+		case cfg.ConsolidateMaxInputs < 2 || cfg.ConsolidateMaxInputs > 500:
+			str = "%s: the consolidatemaxinputs option must be " +
+				"between 2 and 500"
+		case cfg.ConsolidateMinOutputs < 1:
+			str = "%s: the consolidateminoutputs option must be " +
+				"positive"
+		}
+		if str != "" {
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// A read replica neither connects to peers nor accepts them.
+	if cfg.ReadReplica {
+		if len(cfg.AddPeers) > 0 || len(cfg.ConnectPeers) > 0 ||
+			len(cfg.Listeners) > 0 {
+
+			str := "%s: the --readreplica option can not be mixed " +
+				"with --addpeer, --connect or --listen"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.DisableListen = true
+		cfg.DisableDNSSeed = true
+		cfg.MaxPeers = 0
+	}
+
+	// --proxy with --torcontrol and without --listen only listens on the
+	// loopback interface, for the connections to the onion service.
+	if cfg.Proxy != "" && cfg.TorControl != "" && !cfg.DisableListen &&
+		len(cfg.ConnectPeers) == 0 && len(cfg.Listeners) == 0 {
+		cfg.Listeners = []string{
+			net.JoinHostPort("127.0.0.1", ActiveNetParams.DefaultPort),
+		}
+	}
+
 	// --proxy or --connect without --listen disables listening.
 	if (cfg.Proxy != "" || len(cfg.ConnectPeers) > 0) &&
 		len(cfg.Listeners) == 0 {
@@ -719,16 +1242,22 @@ func LoadConfig() (*FConfig, []string, error) {
 		return nil, nil, err
 	}
 
-	if numNets == 0 && cfg.MaxTimeOffset > DefaultMaxTimeOffsetSeconds {
-		str := "%s: The maxtimeoffset option may not be greater than %d " +
+	if cfg.MaxOrphanPoolSize < 0 {
+		str := "%s: The maxorphanpoolsize option may not be less than 0 " +
 			"-- parsed [%d]"
-		err := fmt.Errorf(str, funcName, DefaultMaxTimeOffsetSeconds, cfg.MaxTimeOffset)
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanPoolSize)
 		fmt.Fprintln(os.Stderr, err)
 		fmt.Fprintln(os.Stderr, usageMessage)
 		return nil, nil, err
 	}
-	if cfg.MaxTimeOffset <= 5 {
-		cfg.MaxTimeOffset = DefaultMaxTimeOffsetSeconds
+
+	if cfg.ReplacementBump < 0 {
+		str := "%s: The replacementbump option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.ReplacementBump)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
 	}
 
 	// Look for illegal characters in the user agent comments.
@@ -743,8 +1272,63 @@ func LoadConfig() (*FConfig, []string, error) {
 		}
 	}
 
-	// Add default port to all listener addresses if needed and remove
-	// duplicate addresses.
+	// Parse the handshake metadata entries.
+	if len(cfg.HandshakeMetadata) > 0 {
+		cfg.HandshakeMeta = make(map[string]string, len(cfg.HandshakeMetadata))
+	}
+	for _, entry := range cfg.HandshakeMetadata {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			str := "%s: The handshakemeta entry '%s' is not of the " +
+				"form key=value"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.HandshakeMeta[parts[0]] = parts[1]
+	}
+	if err := protos.ValidateMetadata(cfg.HandshakeMeta); err != nil {
+		str := "%s: The handshakemeta option is invalid: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.HandshakeJitter < 0 || cfg.HandshakeJitter > maxHandshakeJitter {
+		str := "%s: The handshakejitter option must be between 0 and " +
+			"%v -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, maxHandshakeJitter,
+			cfg.HandshakeJitter)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Split the policies off the listener addresses, add default port to
+	// all listener addresses if needed and remove duplicate addresses.
+	cfg.ListenPolicies = make(map[string]ListenPolicy, len(cfg.Listeners))
+	for i, listener := range cfg.Listeners {
+		addr, policy, err := parseListener(listener)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if policy.WhitelistOnly() && len(cfg.Whitelists) == 0 {
+			str := "%s: The %s policy of listener '%s' requires " +
+				"the whitelist option"
+			err := fmt.Errorf(str, funcName, policy, listener)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		addr = fnet.NormalizeAddress(addr, ActiveNetParams.DefaultPort)
+		cfg.Listeners[i] = addr
+		cfg.ListenPolicies[addr] = policy
+	}
 	cfg.Listeners = fnet.NormalizeAddresses(cfg.Listeners, ActiveNetParams.DefaultPort)
 
 	// Add default port to all added peer addresses if needed and remove
@@ -773,6 +1357,25 @@ func LoadConfig() (*FConfig, []string, error) {
 		return nil, nil, err
 	}
 
+	// Resolve the block assumed valid, the default one of the network
+	// unless one is given or the option is 0.
+	switch cfg.AssumeValid {
+	case "":
+		cfg.AssumeValidHash = ActiveNetParams.AssumeValid
+	case "0":
+	default:
+		hash, err := common.ParseHash(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: The assumevalid option must be a block hash " +
+				"or 0 -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, cfg.AssumeValid)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.AssumeValidHash = hash
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -794,6 +1397,15 @@ func LoadConfig() (*FConfig, []string, error) {
 		}
 	}
 
+	// UDP can not go through the SOCKS proxy.
+	if cfg.QUIC && cfg.Proxy != "" {
+		str := "%s: the --quic option can not be used with --proxy"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Setup onion address dial function depending on the specified options.
 	// The default is to use the same dial function selected above.  However,
 	// when an onion-specific proxy is specified, the onion address dial
@@ -820,6 +1432,142 @@ func LoadConfig() (*FConfig, []string, error) {
 		}
 	}
 
+	// An onion service requires listening for the connections it forwards
+	// and connecting to the onion services of the other peers.
+	if cfg.TorControl != "" {
+		if _, _, err := net.SplitHostPort(cfg.TorControl); err != nil {
+			str := "%s: Tor control address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.TorControl, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.DisableListen || cfg.NoOnion {
+			str := "%s: the --torcontrol option can not be used with " +
+				"--nolisten, --noonion or --connect without --listen"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Validate the webhook options.
+	for _, hook := range cfg.Webhooks {
+		u, err := url.Parse(hook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			str := "%s: The webhook URL '%s' is invalid"
+			err := fmt.Errorf(str, funcName, hook)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	for _, event := range cfg.WebhookEvents {
+		eventType, err := webhook.ParseEventType(event)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.WebhookEventTypes = append(cfg.WebhookEventTypes, eventType)
+	}
+	for _, addr := range cfg.WebhookWatchAddrs {
+		if _, err := asiutil.DecodeAddress(addr); err != nil {
+			str := "%s: The webhook watch address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, addr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	for _, addr := range cfg.InvWatchContracts {
+		if _, err := asiutil.DecodeAddress(addr); err != nil {
+			str := "%s: The inventory watch contract '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, addr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.WebhookMaxRetries < 0 {
+		str := "%s: The webhookmaxretries option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.WebhookMaxRetries)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the ban feed options.  The signing key is required so that
+	// the feed can not be used to ban arbitrary hosts.
+	if cfg.BanFeed != "" {
+		u, err := url.Parse(cfg.BanFeed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			str := "%s: The banfeed URL '%s' is invalid"
+			err := fmt.Errorf(str, funcName, cfg.BanFeed)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		key, err := hex.DecodeString(cfg.BanFeedKey)
+		if err != nil || (len(key) != 33 && len(key) != 65) {
+			str := "%s: The banfeed option requires a valid banfeedkey " +
+				"public key -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, cfg.BanFeedKey)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.BanFeedInterval < time.Minute {
+			str := "%s: The banfeedinterval option may not be less " +
+				"than 1m -- parsed [%v]"
+			err := fmt.Errorf(str, funcName, cfg.BanFeedInterval)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Mailing alerts requires a sender and at least one recipient.
+	if cfg.AlertSMTPServer != "" {
+		if _, _, err := net.SplitHostPort(cfg.AlertSMTPServer); err != nil {
+			str := "%s: SMTP server address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.AlertSMTPServer, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.AlertEmailFrom == "" || len(cfg.AlertEmailTo) == 0 {
+			str := "%s: the --alertsmtpserver option requires both " +
+				"--alertemailfrom and --alertemailto"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.AlertInterval < time.Second || cfg.AlertStuckSync < time.Second {
+		str := "%s: The alertinterval and alertstucksync options may not " +
+			"be less than 1s -- parsed [%v, %v]"
+		err := fmt.Errorf(str, funcName, cfg.AlertInterval, cfg.AlertStuckSync)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	for _, keys := range [][]string{cfg.RPCAPIKeys, cfg.RPCAdminKeys} {
+		for _, key := range keys {
+			if _, err := rpc.ParseAPIKey(key); err != nil {
+				err := fmt.Errorf("%s: %v", funcName, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		}
+	}
+
 	for _, param := range cfg.AddBtc {
 		parts := strings.Split(param, ":")
 		if len(parts) != 4 {
@@ -843,6 +1591,12 @@ func LoadConfig() (*FConfig, []string, error) {
 	if configFileError != nil {
 		logger.GetLog().Warnf("%v", configFileError)
 	}
+	if cfg.MaxTimeOffset != 0 {
+		logger.GetLog().Warnf("The maxtimeoffset option is deprecated, " +
+			"set the maxtimeoffset field of the chain parameters file " +
+			"instead -- nodes with different values may disagree on " +
+			"the validity of blocks")
+	}
 	Cfg = &cfg
 
 	return &cfg, remainingArgs, nil
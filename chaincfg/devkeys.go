@@ -0,0 +1,19 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+// DevKeys are the private keys of the developer accounts of the --dev mode.
+// They are public, so the accounts must never hold anything of value on
+// another network.  The first one produces the blocks and funds the others
+// with its block rewards.
+//
+// The key at index i is the sha256 hash of "asimov developer key i".
+var DevKeys = []string{
+	"0x0b712f0696f7ce5d0b1f7a0a2daeb3bc3f21d9be7480bde88d577c9083129c6b",
+	"0xd9604cd30edcb4ccef304628fccfbd172ff867a85fdb7f9da5251f7dfdf97ec4",
+	"0x0de7421d9e811c8e36a9ae3b767a2d5ecc28651975bf1f484fc2750cebcd72b3",
+	"0xad59e789cd56aa5af255f1aa5eb9f3f4f6a0b8d30618c3aeb635293ffce145b5",
+	"0x1d922c1725d0c51ecb37320ef38e3cbc166e43878a22144eea4c1430986a8c6b",
+}
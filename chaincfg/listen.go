@@ -0,0 +1,62 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ListenPolicy defines the policy applied to the peers accepted by a
+// listener.
+type ListenPolicy string
+
+// These constants define the supported listen policies.
+const (
+	// ListenPublic accepts any peer and advertises the listen address.
+	// This is the default policy.
+	ListenPublic ListenPolicy = "public"
+
+	// ListenWhitelist only accepts whitelisted peers.
+	ListenWhitelist ListenPolicy = "whitelist"
+
+	// ListenValidator only accepts whitelisted peers, such as the other
+	// validators of a mesh, which are accepted even when the max number of
+	// peers is reached.
+	ListenValidator ListenPolicy = "validator"
+
+	// ListenTor accepts the peers forwarded by a Tor hidden service.  They
+	// share the address of the Tor daemon, so they are neither whitelisted
+	// nor banned by address.
+	ListenTor ListenPolicy = "tor"
+)
+
+// Advertised returns whether the address of a listener with the policy is
+// advertised to peers.
+func (p ListenPolicy) Advertised() bool {
+	return p == ListenPublic
+}
+
+// WhitelistOnly returns whether a listener with the policy only accepts
+// whitelisted peers.
+func (p ListenPolicy) WhitelistOnly() bool {
+	return p == ListenWhitelist || p == ListenValidator
+}
+
+// parseListener splits a listen option of the form <address>[/<policy>] into
+// its address and policy.  The policy defaults to ListenPublic.
+func parseListener(listener string) (string, ListenPolicy, error) {
+	sep := strings.LastIndex(listener, "/")
+	if sep < 0 {
+		return listener, ListenPublic, nil
+	}
+	policy := ListenPolicy(listener[sep+1:])
+	switch policy {
+	case ListenPublic, ListenWhitelist, ListenValidator, ListenTor:
+		return listener[:sep], policy, nil
+	}
+	return "", "", fmt.Errorf("unknown listen policy '%s' of listener "+
+		"'%s'", policy, listener)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"testing"
+)
+
+// TestParseListener ensures the policies are split off the listen options.
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		listener string
+		addr     string
+		policy   ListenPolicy
+		err      bool
+	}{
+		{"127.0.0.1:8777", "127.0.0.1:8777", ListenPublic, false},
+		{":8777/whitelist", ":8777", ListenWhitelist, false},
+		{"[::1]:8777/validator", "[::1]:8777", ListenValidator, false},
+		{"127.0.0.1/tor", "127.0.0.1", ListenTor, false},
+		{"10.0.0.1:8777/public", "10.0.0.1:8777", ListenPublic, false},
+		{"10.0.0.1:8777/private", "", "", true},
+	}
+
+	for _, test := range tests {
+		addr, policy, err := parseListener(test.listener)
+		if (err != nil) != test.err {
+			t.Errorf("parseListener(%q): unexpected error %v",
+				test.listener, err)
+			continue
+		}
+		if addr != test.addr || policy != test.policy {
+			t.Errorf("parseListener(%q) = %q, %q, want %q, %q",
+				test.listener, addr, policy, test.addr, test.policy)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/vm/fvm/params"
+)
+
+// maxTimeTolerance is the highest max time offset and slot tolerance, in
+// seconds, of a chain parameters file.
+const maxTimeTolerance = 3600
+
+// paramsOverride is the content of a chain parameters file.  It overrides the
+// parameters of the selected network so private networks can be deployed
+// without recompiling the node.  The fields which are not set keep the value
+// of the selected network.
+//
+// The system contracts are part of the genesis block, which private networks
+// generate with the genesis tool and load from the genesis path.
+type paramsOverride struct {
+	Name             string   `json:"name"`
+	Net              *uint32  `json:"net"`
+	DefaultPort      string   `json:"defaultport"`
+	DNSSeeds         []string `json:"dnsseeds"`
+	RoundSize        *uint16  `json:"roundsize"`
+	CoinbaseMaturity *int32   `json:"coinbasematurity"`
+	MaxBlockSize     *int     `json:"maxblocksize"`
+	MaxTimeOffset    *int64   `json:"maxtimeoffset"`
+	SlotTolerance    *int64   `json:"slottolerance"`
+
+	// GasSchedules replace the gas schedules of the VM of the network.  The
+	// gas costs missing from a schedule keep the value of the previous one.
+	GasSchedules []json.RawMessage `json:"gasschedules"`
+
+	// StateRent enables the state rent experiment, which is not available
+	// on the main network.
+	StateRent *StateRentParams `json:"staterent"`
+}
+
+// apply overrides the passed parameters.
+func (o *paramsOverride) apply(p *Params) error {
+	if o.Name != "" {
+		if strings.ContainsAny(o.Name, `/\.`) {
+			return fmt.Errorf("invalid network name %q", o.Name)
+		}
+		p.NetName = o.Name
+	}
+	if o.Net != nil {
+		if *o.Net == 0 {
+			return errors.New("net must not be 0")
+		}
+		// The name of a network is derived from its magic bytes, which
+		// are unknown for a private network.
+		if o.Name == "" {
+			return errors.New("name is required when overriding net")
+		}
+		p.Net = common.AsimovNet(*o.Net)
+	}
+	if o.DefaultPort != "" {
+		port, err := strconv.ParseUint(o.DefaultPort, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid default port %q", o.DefaultPort)
+		}
+		p.DefaultPort = o.DefaultPort
+	}
+	if o.DNSSeeds != nil {
+		p.DNSSeeds = make([]DNSSeed, 0, len(o.DNSSeeds))
+		for _, host := range o.DNSSeeds {
+			p.DNSSeeds = append(p.DNSSeeds, DNSSeed{Host: host})
+		}
+	}
+	if o.RoundSize != nil {
+		if *o.RoundSize == 0 {
+			return errors.New("roundsize must not be 0")
+		}
+		p.RoundSize = *o.RoundSize
+	}
+	if o.CoinbaseMaturity != nil {
+		if *o.CoinbaseMaturity < 0 {
+			return errors.New("coinbasematurity must not be negative")
+		}
+		p.CoinbaseMaturity = *o.CoinbaseMaturity
+	}
+	if o.MaxBlockSize != nil {
+		if *o.MaxBlockSize <= 0 || *o.MaxBlockSize > common.MaxBlockSize {
+			return fmt.Errorf("maxblocksize must be between 1 and %d",
+				common.MaxBlockSize)
+		}
+		p.MaxBlockSize = *o.MaxBlockSize
+	}
+	if o.MaxTimeOffset != nil {
+		if *o.MaxTimeOffset <= 0 || *o.MaxTimeOffset > maxTimeTolerance {
+			return fmt.Errorf("maxtimeoffset must be between 1 and %d",
+				maxTimeTolerance)
+		}
+		p.MaxTimeOffset = *o.MaxTimeOffset
+	}
+	if o.SlotTolerance != nil {
+		if *o.SlotTolerance <= 0 || *o.SlotTolerance > maxTimeTolerance {
+			return fmt.Errorf("slottolerance must be between 1 and %d",
+				maxTimeTolerance)
+		}
+		p.SlotTolerance = *o.SlotTolerance
+	}
+	if o.GasSchedules != nil {
+		// The VM config is shared by the networks, so it is copied.
+		fvmParam := *p.FvmParam
+		fvmParam.GasSchedules = make([]params.GasSchedule, len(o.GasSchedules))
+		prev := params.ConstantinopleGasSchedule
+		for i, data := range o.GasSchedules {
+			schedule := params.GasSchedule{Table: prev.Table}
+			if err := json.Unmarshal(data, &schedule); err != nil {
+				return fmt.Errorf("invalid gas schedule %d: %v", i, err)
+			}
+			fvmParam.GasSchedules[i] = schedule
+			prev = schedule
+		}
+		if err := fvmParam.CheckGasSchedules(); err != nil {
+			return err
+		}
+		p.FvmParam = &fvmParam
+	}
+	if o.StateRent != nil {
+		if p.Net == common.MainNet {
+			return errors.New("staterent is not available on the main network")
+		}
+		if o.StateRent.Height < 0 || o.StateRent.Period < 0 {
+			return errors.New("staterent height and period must not be negative")
+		}
+		p.StateRent = *o.StateRent
+	}
+	return nil
+}
+
+// loadChainParams returns a copy of the passed parameters overridden by the
+// chain parameters file at the passed path.
+func loadChainParams(path string, base *Params) (*Params, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var override paramsOverride
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, err
+	}
+
+	params := *base
+	if err := override.apply(&params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestLoadChainParams ensures the chain parameters files override the passed
+// parameters without modifying them, and invalid overrides are rejected.
+func TestLoadChainParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chainparams")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chainparams.json")
+
+	write := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	write(`{"name": "private", "net": 305419896, "defaultport": "19777",
+		"dnsseeds": ["seed.example.com"], "roundsize": 60,
+		"maxblocksize": 1048576, "maxtimeoffset": 10, "slottolerance": 90}`)
+	params, err := loadChainParams(path, &DevelopNetParams)
+	if err != nil {
+		t.Fatalf("loadChainParams: %v", err)
+	}
+	if params.Name() != "private" || params.Net != common.AsimovNet(305419896) ||
+		params.DefaultPort != "19777" || len(params.DNSSeeds) != 1 ||
+		params.RoundSize != 60 || params.BlockSizeLimit() != 1048576 ||
+		params.MaxTimeOffset != 10 || params.SlotTolerance != 90 {
+		t.Fatalf("unexpected overridden params %+v", params)
+	}
+	if params.CoinbaseMaturity != DevelopNetParams.CoinbaseMaturity {
+		t.Fatalf("coinbase maturity %d not kept", params.CoinbaseMaturity)
+	}
+	if DevelopNetParams.Name() == "private" ||
+		DevelopNetParams.BlockSizeLimit() != common.MaxBlockSize {
+		t.Fatal("base params modified")
+	}
+
+	write(`{"gasschedules": [{"name": "repriced", "height": 1000,
+		"table": {"sload": 800, "sha3": 60}}]}`)
+	params, err = loadChainParams(path, &DevelopNetParams)
+	if err != nil {
+		t.Fatalf("loadChainParams: %v", err)
+	}
+	table := params.FvmParam.GasTable(big.NewInt(1000))
+	if table.SLoad != 800 || table.Sha3 != 60 || table.Balance != 400 ||
+		params.FvmParam.GasTable(big.NewInt(999)).SLoad == 800 {
+		t.Fatalf("unexpected gas schedules %+v", params.FvmParam.GasSchedules)
+	}
+	if len(DevelopNetParams.FvmParam.GasSchedules) != 0 {
+		t.Fatal("base VM config modified")
+	}
+
+	write(`{"staterent": {"height": 100, "period": 5000}}`)
+	params, err = loadChainParams(path, &DevelopNetParams)
+	if err != nil {
+		t.Fatalf("loadChainParams: %v", err)
+	}
+	if params.StateRentActive(99) || !params.StateRentActive(100) ||
+		DevelopNetParams.StateRentActive(100) {
+		t.Fatalf("unexpected state rent %+v", params.StateRent)
+	}
+	if _, err := loadChainParams(path, &MainNetParams); err == nil {
+		t.Error("loadChainParams enabled state rent on the main network")
+	}
+
+	invalid := []string{
+		`{"net": 305419896}`,
+		`{"name": "../private"}`,
+		`{"defaultport": "port"}`,
+		`{"roundsize": 0}`,
+		`{"maxblocksize": 4294967296}`,
+		`{"maxtimeoffset": 0}`,
+		`{"slottolerance": 86400}`,
+		`{"gasschedules": [{"name": "a", "height": 2}, {"name": "b", "height": 1}]}`,
+		`{"gasschedules": [{"name": "a", "height": 1, "table": {"quadcoeffdiv": 0}}]}`,
+		`{"staterent": {"height": -1, "period": 1}}`,
+		`{"name": `,
+	}
+	for _, data := range invalid {
+		write(data)
+		if _, err := loadChainParams(path, &DevelopNetParams); err == nil {
+			t.Errorf("loadChainParams accepted %s", data)
+		}
+	}
+}
@@ -59,6 +59,11 @@ const (
 	// purposes.
 	DeploymentTestDummy = iota
 
+	// DeploymentAccessList defines the rule change deployment ID for the
+	// access lists of transactions, which declare the accounts and storage
+	// slots the transactions access in return for a gas discount.
+	DeploymentAccessList
+
 	// NOTE: DefinedDeployments must always come last since it is used to
 	// determine how many defined deployments there currently are.
 
@@ -79,6 +84,11 @@ type Params struct {
 	// Net defines the magic bytes used to identify the network.
 	Net common.AsimovNet
 
+	// NetName overrides the name of the network, which is derived from Net
+	// when empty.  It is set for the private networks whose magic bytes
+	// are not known.
+	NetName string
+
 	// DefaultPort defines the default peer-to-peer port for the network.
 	DefaultPort string
 
@@ -86,6 +96,11 @@ type Params struct {
 	// as one method to discover peers.
 	DNSSeeds []DNSSeed
 
+	// FixedSeeds defines a list of IP addresses of long-running nodes of the
+	// network, optionally followed by a port, which are tried when no DNS
+	// seed returns any peer.
+	FixedSeeds []string
+
 	// GenesisBlock defines the first block of the chain.
 	GenesisBlock *protos.MsgBlock
 
@@ -110,6 +125,21 @@ type Params struct {
 	// RoundSize is the interval of blocks before the next round is started.
 	RoundSize uint16
 
+	// MaxTimeOffset is the number of seconds the timestamp of a block may
+	// be ahead of the local time of a node accepting it.
+	MaxTimeOffset int64
+
+	// SlotTolerance is the number of seconds the timestamp of a block may
+	// differ from the time scheduled for its slot.  The slot of a block may
+	// also be as far ahead of its parent as the time elapsed since the
+	// parent plus both tolerances allows.
+	SlotTolerance int64
+
+	// MaxBlockSize is the maximum serialized size of a block, which can
+	// only be lowered from common.MaxBlockSize.  It defaults to
+	// common.MaxBlockSize when 0.
+	MaxBlockSize int
+
 	// BtcBlocksPerRound is the expected number of blocks in bitcoin generated
 	// in asimov round.
 	BtcBlocksPerRound uint16
@@ -137,6 +167,10 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeValid is the hash of the block assumed valid by default: the
+	// scripts of its ancestors are not verified.
+	AssumeValid *common.Hash
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -156,25 +190,65 @@ type Params struct {
 
 	FvmParam *params.ChainConfig
 
+	// StateRent configures the state rent experiment, which archives the
+	// storage of the contracts left untouched for a period of blocks.  It
+	// is disabled on every network unless a test network enables it with
+	// the chain parameters file.
+	StateRent StateRentParams
+
 	Bitcoin []*BitcoinParams
 }
 
+// StateRentParams configures the state rent experiment.
+type StateRentParams struct {
+	// Height is the height state rent is enabled from.  The storage of the
+	// contracts untouched since is considered touched at this height.
+	Height int32 `json:"height"`
+
+	// Period is the number of blocks after which the storage of a contract
+	// left untouched is archived.  State rent is disabled when it is 0.
+	Period int32 `json:"period"`
+}
+
+// StateRentActive returns whether state rent applies to the block at the
+// passed height.
+func (p *Params) StateRentActive(height int32) bool {
+	return p.StateRent.Period > 0 && height >= p.StateRent.Height
+}
+
 // Name defines a human-readable identifier for the network.
 func (p *Params) Name() string {
+	if p.NetName != "" {
+		return p.NetName
+	}
 	return p.Net.String()
 }
 
+// BlockSizeLimit returns the maximum serialized size of a block.
+func (p *Params) BlockSizeLimit() int {
+	if p.MaxBlockSize > 0 {
+		return p.MaxBlockSize
+	}
+	return common.MaxBlockSize
+}
+
 // MainNetParams defines the network parameters for the main Bitcoin network.
 var MainNetParams = Params{
 	Net:         common.MainNet,
 	DefaultPort: "8777",
-	DNSSeeds:    []DNSSeed{},
+
+	// NOTE: No DNS seed nor fixed seed of the main network is known yet,
+	// so a mainnet node only finds peers through --addpeer, --connect or
+	// --dnsseed until the seeds are filled in.
+	DNSSeeds: []DNSSeed{},
 
 	// Chain parameters
 	GenesisHash:              &mainnetGenesisHash,
 	CoinbaseMaturity:         4320,
 	SubsidyReductionInterval: 25000000,
 	RoundSize:                720,
+	MaxTimeOffset:            30,
+	SlotTolerance:            30,
 	BtcBlocksPerRound:        6,
 	// TODO need adjustment
 	CollectHeight:   600000,
@@ -196,6 +270,11 @@ var MainNetParams = Params{
 			StartTime:  1199145601, // January 1, 2008 UTC
 			ExpireTime: 1230767999, // December 31, 2008 UTC
 		},
+		DeploymentAccessList: {
+			BitNumber:  1,
+			StartTime:  math.MaxInt64, // Not yet scheduled
+			ExpireTime: math.MaxInt64,
+		},
 	},
 
 	FvmParam: params.MainnetChainConfig,
@@ -206,6 +285,9 @@ var MainNetParams = Params{
 var DevelopNetParams = Params{
 	Net:         common.DevelopNet,
 	DefaultPort: "18700",
+
+	// NOTE: The fixed seeds of the network are not filled in yet, so a
+	// node has no fallback while these DNS seeds are unreachable.
 	DNSSeeds: []DNSSeed{
 		{"seed1.asimov.tech", true},
 		{"seed2.asimov.tech", false},
@@ -221,6 +303,8 @@ var DevelopNetParams = Params{
 	CoinbaseMaturity:         1, //modify from 120 to 1 for test
 	SubsidyReductionInterval: 25000000,
 	RoundSize:                120,
+	MaxTimeOffset:            30,
+	SlotTolerance:            30,
 	BtcBlocksPerRound:        1,
 	CollectHeight:            10100,
 	CollectInterval:          144,
@@ -231,6 +315,7 @@ var DevelopNetParams = Params{
 
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
+	AssumeValid: nil,
 
 	// Consensus rule change deployments.
 	//
@@ -244,6 +329,11 @@ var DevelopNetParams = Params{
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
+		DeploymentAccessList: {
+			BitNumber:  1,
+			StartTime:  0,             // Always available for vote
+			ExpireTime: math.MaxInt64, // Never expires
+		},
 	},
 
 	FvmParam: params.TestnetChainConfig,
@@ -270,9 +360,12 @@ var RegressionNetParams = Params{
 	CoinbaseMaturity:         100,
 	SubsidyReductionInterval: 150,
 	RoundSize:                30,
+	MaxTimeOffset:            30,
+	SlotTolerance:            30,
 
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
+	AssumeValid: nil,
 
 	// Consensus rule change deployments.
 	//
@@ -286,6 +379,11 @@ var RegressionNetParams = Params{
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
+		DeploymentAccessList: {
+			BitNumber:  1,
+			StartTime:  0,             // Always available for vote
+			ExpireTime: math.MaxInt64, // Never expires
+		},
 	},
 
 	FvmParam: params.TestnetChainConfig,
@@ -297,6 +395,9 @@ var RegressionNetParams = Params{
 var TestNetParams = Params{
 	Net:         common.TestNet,
 	DefaultPort: "18721",
+
+	// NOTE: The fixed seeds of the network are not filled in yet, so a
+	// node has no fallback while these DNS seeds are unreachable.
 	DNSSeeds: []DNSSeed{
 		{"seed1.asimov.network", true},
 		{"seed2.asimov.network", false},
@@ -314,6 +415,8 @@ var TestNetParams = Params{
 	SubsidyReductionInterval: 25000000,
 	// 20 minutes
 	RoundSize:         240,
+	MaxTimeOffset:     30,
+	SlotTolerance:     30,
 	BtcBlocksPerRound: 2,
 	CollectHeight:     60,
 	CollectInterval:   144,
@@ -334,6 +437,11 @@ var TestNetParams = Params{
 			StartTime:  1199145601, // January 1, 2008 UTC
 			ExpireTime: 1230767999, // December 31, 2008 UTC
 		},
+		DeploymentAccessList: {
+			BitNumber:  1,
+			StartTime:  math.MaxInt64, // Not yet scheduled
+			ExpireTime: math.MaxInt64,
+		},
 	},
 
 	FvmParam: params.TestnetChainConfig,
@@ -368,12 +476,15 @@ var SimNetParams = Params{
 	//SubsidyReductionInterval: 210000,
 	SubsidyReductionInterval: 25000000,
 	RoundSize:                15,
+	MaxTimeOffset:            30,
+	SlotTolerance:            30,
 	BtcBlocksPerRound:        1,
 	CollectHeight:            10100,
 	CollectInterval:          144,
 
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
+	AssumeValid: nil,
 
 	// Consensus rule change deployments.
 	//
@@ -387,6 +498,11 @@ var SimNetParams = Params{
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
+		DeploymentAccessList: {
+			BitNumber:  1,
+			StartTime:  0,             // Always available for vote
+			ExpireTime: math.MaxInt64, // Never expires
+		},
 	},
 
 	FvmParam: params.TestnetChainConfig,
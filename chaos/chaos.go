@@ -0,0 +1,183 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package chaos injects faults in the network and storage layers so the
+// handling of reorganizations, stalls and crashes can be tested
+// systematically.
+//
+// The faults are only injected by the binaries built with the chaos build
+// tag.  In the other builds Enabled is false and the hooks do nothing, so the
+// compiler drops them from the network and storage code.
+//
+// The faults of a test run are configured by the ASIMOV_CHAOS environment
+// variable, or by Set in process, with a comma separated list of settings,
+// for instance:
+//
+//	seed=7,drop=0.05,delay=200ms,reorder=0.1,cmds=block+inv,diskerr=0.01
+//
+// The faults are drawn from a pseudo random source seeded with the seed, so a
+// run replays the same faults for the same sequence of messages and writes.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvVar is the environment variable configuring the faults of the chaos
+// builds.
+const EnvVar = "ASIMOV_CHAOS"
+
+// ErrInjected is the error of the injected disk write failures.
+var ErrInjected = errors.New("chaos: injected write failure")
+
+// Direction is the direction of a network message.
+type Direction int
+
+// These constants define the directions of the network messages.
+const (
+	Inbound Direction = iota
+	Outbound
+)
+
+// These constants define the stores of the storage faults.
+const (
+	StoreBlocks   = "blocks"
+	StoreMetadata = "metadata"
+	StoreState    = "state"
+)
+
+// excludedCommands are the commands the message faults skip when none is
+// configured: the handshake ones.
+var excludedCommands = map[string]struct{}{
+	"version": {},
+	"verack":  {},
+}
+
+// Config defines the faults injected.
+type Config struct {
+	// Seed seeds the pseudo random source the faults are drawn from.
+	Seed int64
+
+	// Drop is the probability a message is dropped.
+	Drop float64
+
+	// Delay is the maximum delay of the messages, each one being delayed
+	// by a uniformly random duration up to it.
+	Delay time.Duration
+
+	// Reorder is the probability an inbound message is held back and
+	// handled after the next one.  Outbound messages are not reordered.
+	Reorder float64
+
+	// Commands restricts the message faults to the listed commands.  The
+	// faults apply to all the commands but the handshake when empty.
+	Commands []string
+
+	// DiskError is the probability a disk write fails.  The writes of the
+	// block files fail after writing a random part of their data, leaving
+	// a torn record behind.
+	DiskError float64
+
+	// Stores restricts the disk faults to the listed stores.  The faults
+	// apply to all the stores when empty.
+	Stores []string
+}
+
+// Fault is the fault injected for a network message.
+type Fault struct {
+	Drop    bool
+	Delay   time.Duration
+	Reorder bool
+}
+
+// ParseConfig parses the comma separated settings of a configuration.  The
+// lists of commands and stores are separated by plus signs.
+func ParseConfig(s string) (*Config, error) {
+	cfg := &Config{}
+	for _, setting := range strings.Split(s, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("chaos setting %q is not key=value", setting)
+		}
+		key, value := parts[0], parts[1]
+		var err error
+		switch key {
+		case "seed":
+			cfg.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "drop":
+			cfg.Drop, err = parseProbability(value)
+		case "delay":
+			cfg.Delay, err = time.ParseDuration(value)
+		case "reorder":
+			cfg.Reorder, err = parseProbability(value)
+		case "cmds":
+			cfg.Commands = strings.Split(value, "+")
+		case "diskerr":
+			cfg.DiskError, err = parseProbability(value)
+		case "stores":
+			cfg.Stores = strings.Split(value, "+")
+			for _, store := range cfg.Stores {
+				switch store {
+				case StoreBlocks, StoreMetadata, StoreState:
+				default:
+					err = fmt.Errorf("unknown store %q", store)
+				}
+			}
+		default:
+			err = errors.New("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chaos setting %q: %v", setting, err)
+		}
+	}
+	return cfg, nil
+}
+
+// parseProbability parses a probability between 0 and 1.
+func parseProbability(s string) (float64, error) {
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 1 {
+		return 0, errors.New("probability not between 0 and 1")
+	}
+	return p, nil
+}
+
+// appliesToCommand returns whether the message faults apply to the passed
+// command.
+func (cfg *Config) appliesToCommand(command string) bool {
+	if len(cfg.Commands) == 0 {
+		_, excluded := excludedCommands[command]
+		return !excluded
+	}
+	for _, c := range cfg.Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesToStore returns whether the disk faults apply to the passed store.
+func (cfg *Config) appliesToStore(store string) bool {
+	if len(cfg.Stores) == 0 {
+		return true
+	}
+	for _, s := range cfg.Stores {
+		if s == store {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestParseConfig ensures the settings of a configuration are parsed, and
+// the invalid ones rejected.
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("seed=7, drop=0.05,delay=200ms,reorder=0.1," +
+		"cmds=block+inv,diskerr=0.01,stores=blocks+state")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	want := &Config{
+		Seed:      7,
+		Drop:      0.05,
+		Delay:     200 * time.Millisecond,
+		Reorder:   0.1,
+		Commands:  []string{"block", "inv"},
+		DiskError: 0.01,
+		Stores:    []string{StoreBlocks, StoreState},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("ParseConfig: got %+v, want %+v", cfg, want)
+	}
+
+	for _, s := range []string{"drop", "drop=2", "delay=1", "stores=disk", "loss=0.1"} {
+		if _, err := ParseConfig(s); err == nil {
+			t.Errorf("ParseConfig(%q): no error", s)
+		}
+	}
+}
+
+// TestConfigApplies ensures the faults apply to the configured commands and
+// stores, and by default to all of them but the handshake commands.
+func TestConfigApplies(t *testing.T) {
+	cfg := &Config{}
+	if cfg.appliesToCommand("version") || !cfg.appliesToCommand("block") {
+		t.Errorf("default commands")
+	}
+	if !cfg.appliesToStore(StoreMetadata) {
+		t.Errorf("default stores")
+	}
+	cfg = &Config{Commands: []string{"inv"}, Stores: []string{StoreState}}
+	if cfg.appliesToCommand("block") || !cfg.appliesToCommand("inv") {
+		t.Errorf("configured commands")
+	}
+	if cfg.appliesToStore(StoreBlocks) || !cfg.appliesToStore(StoreState) {
+		t.Errorf("configured stores")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build !chaos
+// +build !chaos
+
+package chaos
+
+import "errors"
+
+// Enabled reports whether the faults are injected, which is the case of the
+// chaos builds only.
+const Enabled = false
+
+// Set fails, the faults are only injected by the chaos builds.
+func Set(c *Config) error {
+	return errors.New("chaos: faults are only injected by the chaos builds")
+}
+
+// Message returns no fault.
+func Message(dir Direction, command string) Fault {
+	return Fault{}
+}
+
+// DiskFault returns no error.
+func DiskFault(store string) error {
+	return nil
+}
+
+// TornWrite returns the passed data to write entirely.
+func TornWrite(store string, data []byte) ([]byte, error) {
+	return data, nil
+}
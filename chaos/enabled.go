@@ -0,0 +1,94 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build chaos
+// +build chaos
+
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// Enabled reports whether the faults are injected, which is the case of the
+// chaos builds only.
+const Enabled = true
+
+var (
+	mtx sync.Mutex
+	cfg *Config
+	rnd *rand.Rand
+)
+
+func init() {
+	s := os.Getenv(EnvVar)
+	if s == "" {
+		return
+	}
+	c, err := ParseConfig(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", EnvVar, err)
+		os.Exit(1)
+	}
+	Set(c)
+}
+
+// Set replaces the configuration of the faults, and reseeds their source.
+// A nil configuration stops the faults.
+func Set(c *Config) error {
+	mtx.Lock()
+	cfg = c
+	if c != nil {
+		rnd = rand.New(rand.NewSource(c.Seed))
+	}
+	mtx.Unlock()
+	return nil
+}
+
+// Message returns the fault to inject for a message with the passed command
+// going in the passed direction.
+func Message(dir Direction, command string) Fault {
+	mtx.Lock()
+	defer mtx.Unlock()
+	var fault Fault
+	if cfg == nil || !cfg.appliesToCommand(command) {
+		return fault
+	}
+	fault.Drop = cfg.Drop > 0 && rnd.Float64() < cfg.Drop
+	if cfg.Delay > 0 {
+		fault.Delay = time.Duration(rnd.Int63n(int64(cfg.Delay) + 1))
+	}
+	fault.Reorder = dir == Inbound && cfg.Reorder > 0 &&
+		rnd.Float64() < cfg.Reorder
+	return fault
+}
+
+// DiskFault returns the error to inject for a write to the passed store, if
+// any.
+func DiskFault(store string) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if cfg == nil || cfg.DiskError == 0 || !cfg.appliesToStore(store) ||
+		rnd.Float64() >= cfg.DiskError {
+		return nil
+	}
+	return ErrInjected
+}
+
+// TornWrite returns the part of the passed data to write to the passed store
+// along with the error to inject, if any.  A failing write only writes a
+// random part of its data.
+func TornWrite(store string, data []byte) ([]byte, error) {
+	if err := DiskFault(store); err != nil {
+		mtx.Lock()
+		n := rnd.Intn(len(data) + 1)
+		mtx.Unlock()
+		return data[:n], err
+	}
+	return data, nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build chaos
+// +build chaos
+
+package chaos
+
+import (
+	"testing"
+)
+
+// TestFaultsDeterministic ensures the same seed replays the same faults.
+func TestFaultsDeterministic(t *testing.T) {
+	draw := func() []interface{} {
+		Set(&Config{Seed: 3, Drop: 0.5, Reorder: 0.5, DiskError: 0.5})
+		var faults []interface{}
+		for i := 0; i < 20; i++ {
+			faults = append(faults, Message(Inbound, "block"), DiskFault(StoreState))
+		}
+		return faults
+	}
+	defer Set(nil)
+	first, second := draw(), draw()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("fault %d is %v then %v", i, first[i], second[i])
+		}
+	}
+	if f := Message(Outbound, "block"); f.Reorder {
+		t.Fatalf("outbound message reordered")
+	}
+	data, err := TornWrite(StoreBlocks, []byte{1, 2, 3})
+	if err == nil && len(data) != 3 {
+		t.Fatalf("write without fault torn")
+	}
+}
@@ -10,7 +10,11 @@ import (
 )
 
 const (
-	defaultFormat = "hex"
+	defaultFormat      = "hex"
+	defaultAccountPath = "m/44'/0'/0'"
+	defaultGapLimit    = 20
+	defaultRPCServer   = "http://127.0.0.1:8545"
+	defaultWalletFile  = "wallet.json"
 )
 
 // config defines the configuration options for findcheckpoint.
@@ -18,9 +22,17 @@ const (
 // See loadConfig for details on the configuration load process.
 type config struct {
 	Help       bool `short:"h" long:"help" description:"Show usage."`
-	Cmd        string `short:"c" long:"cmd" description:"Command: genKey, genMultiSigAddress"`
+	Cmd        string `short:"c" long:"cmd" description:"Command: genKey, genMultiSigAddress, recoverWallet"`
 	Format     string `short:"f" long:"format" description:"in/out format, currently, support hex, base64"`
 	Net        string `short:"n" long:"net" description:"support main,dev,test,regtest,default is main"`
+
+	// recoverWallet options, the mnemonic words being passed as arguments.
+	Seed        string `long:"seed" description:"Hex encoded BIP32 seed to recover the wallet from instead of a mnemonic"`
+	Passphrase  string `long:"passphrase" description:"Passphrase of the BIP39 mnemonic"`
+	AccountPath string `long:"accountpath" description:"Derivation path of the account to recover"`
+	GapLimit    int    `long:"gaplimit" description:"Initial number of consecutive unused addresses ending the scan, grown when the wallet leaves larger gaps"`
+	RPCServer   string `long:"rpcserver" description:"URL of the node scanned for the used addresses"`
+	Out         string `short:"o" long:"out" description:"File the recovered wallet is written to"`
 }
 
 
@@ -28,7 +40,11 @@ type config struct {
 func loadConfig() (*config, []string, error) {
 	// Default config.
 	cfg := config{
-		Format: defaultFormat,
+		Format:      defaultFormat,
+		AccountPath: defaultAccountPath,
+		GapLimit:    defaultGapLimit,
+		RPCServer:   defaultRPCServer,
+		Out:         defaultWalletFile,
 	}
 
 	// Parse command line options.
@@ -0,0 +1,122 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// hardenedKeyStart is the index of the first hardened child key.
+	hardenedKeyStart = 0x80000000
+
+	// mnemonicIterations is the number of PBKDF2 rounds deriving the seed
+	// of a BIP39 mnemonic.
+	mnemonicIterations = 2048
+)
+
+// errInvalidChild is returned when a child key can't be derived at an index,
+// in which case the next index should be used instead.
+var errInvalidChild = errors.New("the derived key is invalid")
+
+// extendedKey is a BIP32 extended private key.
+type extendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+// mnemonicToSeed returns the BIP39 seed of the passed mnemonic and
+// passphrase.  The words are not checked against a wordlist.
+func mnemonicToSeed(mnemonic, passphrase string) []byte {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase),
+		mnemonicIterations, 64, sha512.New)
+}
+
+// newMasterKey returns the BIP32 master key of the passed seed.
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed length must be between 16 and 64 bytes")
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	k := new(big.Int).SetBytes(sum[:32])
+	if k.Sign() == 0 || k.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errInvalidChild
+	}
+	return &extendedKey{key: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// child returns the private child key of k at the passed index, hardened when
+// the index is at least hardenedKeyStart.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	data := make([]byte, 0, 37)
+	if index >= hardenedKeyStart {
+		data = append(data, 0x00)
+		data = append(data, k.key...)
+	} else {
+		_, pub := crypto.PrivKeyFromBytes(crypto.S256(), k.key)
+		data = append(data, pub.SerializeCompressed()...)
+	}
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+	data = append(data, indexBytes[:]...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, errInvalidChild
+	}
+	il.Add(il, new(big.Int).SetBytes(k.key))
+	il.Mod(il, n)
+	if il.Sign() == 0 {
+		return nil, errInvalidChild
+	}
+	key := make([]byte, 32)
+	b := il.Bytes()
+	copy(key[32-len(b):], b)
+	return &extendedKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// derivePath returns the key at the passed path, such as m/44'/0'/0', from k.
+func (k *extendedKey) derivePath(path string) (*extendedKey, error) {
+	elems := strings.Split(path, "/")
+	if elems[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must start with m", path)
+	}
+	key := k
+	for _, elem := range elems[1:] {
+		offset := uint32(0)
+		if strings.HasSuffix(elem, "'") || strings.HasSuffix(elem, "h") {
+			offset = hardenedKeyStart
+			elem = elem[:len(elem)-1]
+		}
+		index, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || uint32(index) >= hardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path %q", path)
+		}
+		key, err = key.child(uint32(index) + offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestDerivePath ensures the keys are derived as in the BIP32 test vectors.
+func TestDerivePath(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := newMasterKey(seed)
+	if err != nil {
+		t.Fatalf("newMasterKey: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0h/1/2'/2/1000000000", "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+	}
+	for _, test := range tests {
+		key, err := master.derivePath(test.path)
+		if err != nil {
+			t.Fatalf("derivePath(%s): %v", test.path, err)
+		}
+		if got := hex.EncodeToString(key.key); got != test.key {
+			t.Fatalf("derivePath(%s): got key %s, want %s", test.path, got, test.key)
+		}
+	}
+
+	for _, path := range []string{"", "0/1", "m/x", "m/2147483648"} {
+		if _, err := master.derivePath(path); err == nil {
+			t.Fatalf("derivePath(%q): expected an error", path)
+		}
+	}
+}
+
+// TestMnemonicToSeed ensures the seeds of the mnemonics match the BIP39 test
+// vectors.
+func TestMnemonicToSeed(t *testing.T) {
+	mnemonic := strings.Repeat("abandon ", 11) + "about"
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e5349553" +
+		"1f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if got := hex.EncodeToString(mnemonicToSeed(mnemonic, "TREZOR")); got != want {
+		t.Fatalf("mnemonicToSeed: got %s, want %s", got, want)
+	}
+}
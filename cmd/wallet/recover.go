@@ -0,0 +1,285 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// scanBatchSize is the number of addresses whose balances are fetched
+	// in a single call, the most getAddressBalances accepts.
+	scanBatchSize = 100
+
+	// maxGapLimit caps the gap limit grown while scanning.
+	maxGapLimit = 1000
+)
+
+// recoveredAddress is an address of a recovered wallet.
+type recoveredAddress struct {
+	Path       string            `json:"path"`
+	Address    string            `json:"address"`
+	PrivateKey string            `json:"privatekey"`
+	Used       bool              `json:"used"`
+	Balances   map[string]string `json:"balances,omitempty"`
+}
+
+// recoveredWallet is the wallet file written by the recoverWallet command.
+// Balances holds the confirmed balance of each asset over all the addresses.
+type recoveredWallet struct {
+	AccountPath string              `json:"accountpath"`
+	Height      int32               `json:"height"`
+	BlockHash   string              `json:"blockhash"`
+	Addresses   []*recoveredAddress `json:"addresses"`
+	Balances    map[string]string   `json:"balances"`
+}
+
+// walletScanner finds the used addresses of an account on a node.  It uses
+// the address index of the node when it is enabled, and falls back to the
+// balances otherwise, in which case the addresses emptied since are missed.
+type walletScanner struct {
+	client    *rpc.Client
+	addrIndex bool
+}
+
+// isUsed returns whether the passed address appears in the chain.
+func (s *walletScanner) isUsed(addr *recoveredAddress) (bool, error) {
+	if s.addrIndex {
+		var page rpcjson.PageResult
+		err := s.client.Call(&page, "asimov_listTransactions", []string{addr.Address},
+			&rpcjson.PageRequest{Limit: 1})
+		if err == nil {
+			items, _ := page.Items.([]interface{})
+			return len(items) > 0, nil
+		}
+		if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != int(rpcjson.ErrRPCMisc) {
+			return false, err
+		}
+		fmt.Println("Address index disabled on the node, scanning the balances only")
+		s.addrIndex = false
+	}
+	return len(addr.Balances) > 0, nil
+}
+
+// fetchBalances fills the confirmed balances of the passed addresses and
+// returns the best block they were read at.
+func (s *walletScanner) fetchBalances(addrs []*recoveredAddress) (*rpcjson.GetAddressBalancesResult, error) {
+	params := make([]string, len(addrs))
+	for i, addr := range addrs {
+		params[i] = addr.Address
+	}
+	var result rpcjson.GetAddressBalancesResult
+	err := s.client.Call(&result, "asimov_getAddressBalances", params)
+	if err != nil {
+		return nil, err
+	}
+	for i, balances := range result.Addresses {
+		for _, asset := range balances.Assets {
+			if asset.Confirmed == "" || asset.Confirmed == "0" {
+				continue
+			}
+			if addrs[i].Balances == nil {
+				addrs[i].Balances = make(map[string]string)
+			}
+			addrs[i].Balances[asset.Asset] = asset.Confirmed
+		}
+	}
+	return &result, nil
+}
+
+// deriveAddress returns the address at the passed index of a branch.
+func deriveAddress(branch *extendedKey, branchPath string, index uint32) (*recoveredAddress, error) {
+	key, err := branch.child(index)
+	if err != nil {
+		return nil, err
+	}
+	_, pub := crypto.PrivKeyFromBytes(crypto.S256(), key.key)
+	addr, err := common.NewAddressWithId(common.PubKeyHashAddrID,
+		common.Hash160(pub.SerializeCompressed()))
+	if err != nil {
+		return nil, err
+	}
+	return &recoveredAddress{
+		Path:       fmt.Sprintf("%s/%d", branchPath, index),
+		Address:    hexutil.Encode(addr.ScriptAddress()),
+		PrivateKey: hexutil.Encode(key.key),
+	}, nil
+}
+
+// scanBranch derives the addresses of a branch until gapLimit consecutive
+// addresses are unused.  The gap limit grows to twice the longest gap found
+// between two used addresses, up to maxGapLimit, since a wallet leaving such
+// gaps likely leaves longer ones too.
+func scanBranch(s *walletScanner, branch *extendedKey, branchPath string,
+	gapLimit int) ([]*recoveredAddress, *rpcjson.GetAddressBalancesResult, error) {
+	var (
+		addrs    []*recoveredAddress
+		best     *rpcjson.GetAddressBalancesResult
+		lastUsed = -1
+		index    uint32
+	)
+	for len(addrs)-lastUsed <= gapLimit {
+		batch := make([]*recoveredAddress, 0, scanBatchSize)
+		for len(batch) < scanBatchSize {
+			addr, err := deriveAddress(branch, branchPath, index)
+			index++
+			if err == errInvalidChild {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			batch = append(batch, addr)
+		}
+		result, err := s.fetchBalances(batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		best = result
+
+		for _, addr := range batch {
+			used, err := s.isUsed(addr)
+			if err != nil {
+				return nil, nil, err
+			}
+			pos := len(addrs)
+			addrs = append(addrs, addr)
+			if !used {
+				if pos-lastUsed >= gapLimit {
+					break
+				}
+				continue
+			}
+			addr.Used = true
+			if gap := pos - lastUsed - 1; 2*gap > gapLimit {
+				gapLimit = 2 * gap
+				if gapLimit > maxGapLimit {
+					gapLimit = maxGapLimit
+				}
+			}
+			lastUsed = pos
+		}
+	}
+
+	// Keep the addresses up to the last used one, along with the gap the
+	// wallet would still watch.
+	keep := lastUsed + 1 + gapLimit
+	if keep < len(addrs) {
+		addrs = addrs[:keep]
+	}
+	return addrs, best, nil
+}
+
+// recoverWallet derives the addresses of an account from a BIP39 mnemonic or
+// a BIP32 seed, scans the chain for the used ones through the node and writes
+// the wallet file with their keys and balances.
+func recoverWallet(cfg *config, args []string) error {
+	var seed []byte
+	switch {
+	case cfg.Seed != "":
+		var err error
+		seed, err = hex.DecodeString(strings.TrimPrefix(cfg.Seed, "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid seed: %v", err)
+		}
+	case len(args) > 0:
+		seed = mnemonicToSeed(strings.Join(args, " "), cfg.Passphrase)
+	default:
+		return fmt.Errorf("a mnemonic or a seed is required")
+	}
+
+	master, err := newMasterKey(seed)
+	if err != nil {
+		return err
+	}
+	account, err := master.derivePath(cfg.AccountPath)
+	if err != nil {
+		return err
+	}
+
+	client, err := rpc.Dial(cfg.RPCServer)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	wallet := &recoveredWallet{
+		AccountPath: cfg.AccountPath,
+		Balances:    make(map[string]string),
+	}
+	scanner := &walletScanner{client: client, addrIndex: true}
+	totals := make(map[string]*big.Int)
+
+	// Scan the receiving branch, then the change branch.
+	for _, branchIndex := range []uint32{0, 1} {
+		branchPath := fmt.Sprintf("%s/%d", cfg.AccountPath, branchIndex)
+		branch, err := account.child(branchIndex)
+		if err != nil {
+			return err
+		}
+		addrs, best, err := scanBranch(scanner, branch, branchPath, cfg.GapLimit)
+		if err != nil {
+			return err
+		}
+		if best != nil && best.Height >= wallet.Height {
+			wallet.Height = best.Height
+			wallet.BlockHash = best.Hash
+		}
+		for _, addr := range addrs {
+			for asset, value := range addr.Balances {
+				amount, ok := new(big.Int).SetString(value, 10)
+				if !ok {
+					return fmt.Errorf("invalid balance %q of %s", value, addr.Address)
+				}
+				if totals[asset] == nil {
+					totals[asset] = new(big.Int)
+				}
+				totals[asset].Add(totals[asset], amount)
+			}
+		}
+		wallet.Addresses = append(wallet.Addresses, addrs...)
+	}
+	for asset, total := range totals {
+		wallet.Balances[asset] = total.String()
+	}
+
+	data, err := json.MarshalIndent(wallet, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(cfg.Out, data, 0600); err != nil {
+		return err
+	}
+
+	used := 0
+	for _, addr := range wallet.Addresses {
+		if addr.Used {
+			used++
+		}
+	}
+	assets := make([]string, 0, len(wallet.Balances))
+	for asset := range wallet.Balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	fmt.Printf("Recovered %d used addresses of %d scanned at height %d into %s\n",
+		used, len(wallet.Addresses), wallet.Height, cfg.Out)
+	for _, asset := range assets {
+		fmt.Printf("    %s: %s\n", asset, wallet.Balances[asset])
+	}
+	return nil
+}
@@ -42,6 +42,12 @@ func main() {
 		genMultiSigAddress(cfg, remainArgs, decodefunc, encodefunc)
 		os.Exit(1)
 	}
+	if cfg.Cmd == "recoverWallet" || cfg.Cmd == "-rw" {
+		if err := recoverWallet(cfg, remainArgs); err != nil {
+			fmt.Println("recover wallet err ", err)
+			os.Exit(1)
+		}
+	}
 }
 
 func genkeys(cfg *config, decodef func(string) ([]byte, error), encodef func(b []byte) string)  {
@@ -32,6 +32,14 @@ const (
 	// CoreTeamPercent is the percent of block reward
 	CoreTeamPercent = 0.2
 
+	// RewardSplitBasis is the basis of the shares of the block reward, which
+	// are expressed in basis points.
+	RewardSplitBasis = 10000
+
+	// CoreTeamShare is the share of block reward of the core team, in basis
+	// points.
+	CoreTeamShare = 2000
+
 	// The gas is used when consensus invoke some readonly function in contract.
 	ReadOnlyGas = 2300
 
@@ -64,6 +64,11 @@ const (
 	// state db.  This is primarily used for miner.
 	BFFastAdd BehaviorFlags = 1 << iota
 
+	// BFAssumeValid may be set to indicate the block is an ancestor of the
+	// block assumed valid by the chain, in a header chain the caller
+	// validated, so its scripts are not verified.
+	BFAssumeValid
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -82,13 +87,29 @@ const (
 	// SFNodeCF is a flag used to indicate a peer supports committed
 	// filters (CFs).
 	SFNodeCF
+
+	// SFNodeQUIC is a flag used to indicate a peer accepts connections
+	// over QUIC on the UDP port of its address.
+	SFNodeQUIC
+
+	// SFNodeInvClasses is a flag used to indicate a peer accepts the
+	// subscribeinv message and announces the asset issuance and contract
+	// event inventory classes.
+	SFNodeInvClasses
+
+	// SFNodeMetadata is a flag used to indicate the version message of a
+	// peer carries a metadata map.
+	SFNodeMetadata
 )
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeBloom:   "SFNodeBloom",
-	SFNodeCF:      "SFNodeCF",
+	SFNodeNetwork:    "SFNodeNetwork",
+	SFNodeBloom:      "SFNodeBloom",
+	SFNodeCF:         "SFNodeCF",
+	SFNodeQUIC:       "SFNodeQUIC",
+	SFNodeInvClasses: "SFNodeInvClasses",
+	SFNodeMetadata:   "SFNodeMetadata",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -97,6 +118,9 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeNetwork,
 	SFNodeBloom,
 	SFNodeCF,
+	SFNodeQUIC,
+	SFNodeInvClasses,
+	SFNodeMetadata,
 }
 
 // String returns the ServiceFlag in human-readable form.
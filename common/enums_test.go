@@ -18,7 +18,10 @@ func TestServiceFlagStringer(t *testing.T) {
 		{SFNodeNetwork, "SFNodeNetwork"},
 		{SFNodeBloom, "SFNodeBloom"},
 		{SFNodeCF, "SFNodeCF"},
-		{0xffffffff, "SFNodeNetwork|SFNodeBloom|SFNodeCF|0xfffffff8"},
+		{SFNodeQUIC, "SFNodeQUIC"},
+		{SFNodeInvClasses, "SFNodeInvClasses"},
+		{SFNodeMetadata, "SFNodeMetadata"},
+		{0xffffffff, "SFNodeNetwork|SFNodeBloom|SFNodeCF|SFNodeQUIC|SFNodeInvClasses|SFNodeMetadata|0xffffffc0"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -58,6 +58,19 @@ type fnetAdapter struct {
 //   Conn: a successful connection
 //   error: some detail information when connect failed.
 func (na * fnetAdapter) DialTimeout(addr net.Addr) (net.Conn, error) {
+	// Dial the peers advertising QUIC over QUIC, unless the connections
+	// go through a proxy which can not relay UDP, and fall back to TCP
+	// when the handshake fails.
+	if quicAddr, ok := addr.(*QUICAddr); ok {
+		if na.proxy == nil {
+			conn, err := DialQUIC(quicAddr.String(), quicDialTimeout)
+			if err == nil {
+				return conn, nil
+			}
+		}
+		addr = quicAddr.Addr
+	}
+
 	if strings.Contains(addr.String(), ".onion:") {
 		// noonion means the onion address dial function results in
 		// an error.
@@ -98,8 +111,10 @@ func (na * fnetAdapter) Lookup(host string) ([]net.IP, error) {
 	return net.LookupIP(host)
 }
 
+// SupportOnion returns whether onion addresses can be dialed, which requires
+// a proxy to the Tor network.
 func (na * fnetAdapter) SupportOnion() bool {
-	return !na.noOnion
+	return !na.noOnion && (na.proxy != nil || na.onionProxy != nil)
 }
 
 // NewNetAdapter create a new fnetAdapter instance.
@@ -117,12 +132,11 @@ func NewNetAdapter(proxy, user, pass string, onionProxy, onionUser, onionPass st
 	}
 	if proxy != "" {
 		// Tor isolation flag means proxy credentials will be overridden
-		// unless there is also an onion proxy configured in which case
-		// that one will be overridden.
-		tmptorIsolation := false
-		if torIsolation && onionProxy == "" &&
-			(user != "" || pass != "") {
-			tmptorIsolation = true
+		// with random ones for each connection, so every peer uses its
+		// own Tor circuit, unless there is also an onion proxy
+		// configured in which case that one will be overridden.
+		tmptorIsolation := torIsolation && onionProxy == ""
+		if tmptorIsolation && (user != "" || pass != "") {
 			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
 				"overriding specified proxy user credentials")
 		}
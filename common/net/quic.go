@@ -0,0 +1,566 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package net
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// quicALPN is the application protocol negotiated by the QUIC peer
+	// connections.
+	quicALPN = "asimov-p2p"
+
+	// quicDialTimeout is the maximum duration of the QUIC handshake,
+	// after which the address is dialed over TCP instead.  It is shorter
+	// than the TCP connect timeout since the UDP traffic may be silently
+	// dropped by a firewall.
+	quicDialTimeout = time.Second * 10
+
+	// quicAcceptTimeout is the maximum duration between the handshake of
+	// an inbound QUIC connection and the opening of its streams.
+	quicAcceptTimeout = time.Second * 10
+
+	// quicKeepAlive is the period of the keep-alive packets keeping the
+	// NAT mappings of the idle QUIC connections.
+	quicKeepAlive = time.Second * 30
+
+	// quicIdleTimeout is the duration after which a QUIC connection which
+	// did not receive anything is closed.
+	quicIdleTimeout = time.Minute * 2
+
+	// maxQUICFrameSize is the maximum size of a message frame, larger
+	// than any message of the protocol.
+	maxQUICFrameSize = 1024 * 1024 * 4
+
+	// quicBulkQueueSize is the number of messages which may be queued on
+	// the bulk stream before WriteMessage blocks.
+	quicBulkQueueSize = 16
+)
+
+// The streams of a QUIC peer connection, identified by the first byte
+// written on them.
+const (
+	quicMainStream byte = iota
+	quicBulkStream
+)
+
+var (
+	// ErrQUICFrameTooLarge is returned when a message frame larger than
+	// maxQUICFrameSize is received or sent.
+	ErrQUICFrameTooLarge = errors.New("QUIC message frame too large")
+
+	// errQUICTimeout is returned when a read or a write does not complete
+	// before the deadline of the connection.
+	errQUICTimeout = &quicTimeoutError{}
+)
+
+// quicTimeoutError is the error returned when a deadline is exceeded.  It
+// implements net.Error so it is reported as a timeout.
+type quicTimeoutError struct{}
+
+func (e *quicTimeoutError) Error() string   { return "i/o timeout" }
+func (e *quicTimeoutError) Timeout() bool   { return true }
+func (e *quicTimeoutError) Temporary() bool { return true }
+
+// MessageConn is a connection multiplexing the messages over several
+// streams, such as a QUIC connection.  The messages must be written whole
+// with WriteMessage so that they are not interleaved with the messages of
+// the other streams.
+type MessageConn interface {
+	net.Conn
+
+	// WriteMessage writes the passed serialized message.  The bulk
+	// messages, such as the blocks, are queued on their own stream so
+	// that they are sent concurrently with the other messages instead of
+	// delaying them.
+	WriteMessage(msg []byte, bulk bool) (int, error)
+}
+
+// QUICAddr wraps the address of a peer advertising the QUIC transport so
+// that the net adapter dials it over QUIC, falling back to TCP when the QUIC
+// handshake fails.
+type QUICAddr struct {
+	net.Addr
+}
+
+// quicConn is a peer connection over QUIC.  The messages are sent on a main
+// stream, except the bulk messages which are sent on a bulk stream, and are
+// framed by their length so that Read returns the messages received on both
+// streams whole.
+type quicConn struct {
+	conn quic.Connection
+	main quic.Stream
+	bulk quic.Stream
+
+	// frames receives the message frames read from both streams.
+	frames  chan []byte
+	readMtx sync.Mutex
+	pending []byte
+
+	mainMtx   sync.Mutex
+	bulkQueue chan []byte
+
+	deadlineMtx   sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	closeOnce sync.Once
+	errMtx    sync.Mutex
+	err       error
+	quit      chan struct{}
+}
+
+// Ensure quicConn implements the MessageConn interface.
+var _ MessageConn = (*quicConn)(nil)
+
+// newQUICConn returns a peer connection over the passed QUIC connection and
+// streams, and starts reading and writing them.
+func newQUICConn(conn quic.Connection, main, bulk quic.Stream) *quicConn {
+	c := &quicConn{
+		conn:      conn,
+		main:      main,
+		bulk:      bulk,
+		frames:    make(chan []byte),
+		bulkQueue: make(chan []byte, quicBulkQueueSize),
+		quit:      make(chan struct{}),
+	}
+	go c.readHandler(main)
+	go c.readHandler(bulk)
+	go c.bulkHandler()
+	return c
+}
+
+// closeWithError closes the connection, recording the passed error as the
+// reason returned by the following reads and writes.
+func (c *quicConn) closeWithError(err error) {
+	c.closeOnce.Do(func() {
+		c.errMtx.Lock()
+		c.err = err
+		c.errMtx.Unlock()
+		close(c.quit)
+		c.conn.CloseWithError(0, "")
+	})
+}
+
+// closeErr returns the reason the connection was closed.
+func (c *quicConn) closeErr() error {
+	c.errMtx.Lock()
+	defer c.errMtx.Unlock()
+	return c.err
+}
+
+// readHandler reads the message frames of the passed stream and passes them
+// to Read until the connection is closed.  It must be run as a goroutine.
+func (c *quicConn) readHandler(stream quic.Stream) {
+	var lenBuf [4]byte
+	for {
+		_, err := io.ReadFull(stream, lenBuf[:])
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+		size := binary.BigEndian.Uint32(lenBuf[:])
+		if size > maxQUICFrameSize {
+			c.closeWithError(ErrQUICFrameTooLarge)
+			return
+		}
+		if size == 0 {
+			continue
+		}
+		frame := make([]byte, size)
+		_, err = io.ReadFull(stream, frame)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+
+		select {
+		case c.frames <- frame:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// bulkHandler writes the messages queued on the bulk stream until the
+// connection is closed.  It must be run as a goroutine.
+func (c *quicConn) bulkHandler() {
+	for {
+		select {
+		case frame := <-c.bulkQueue:
+			if _, err := c.bulk.Write(frame); err != nil {
+				c.closeWithError(err)
+				return
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// deadlineTimer returns a channel receiving when the passed deadline is
+// exceeded, which is nil when there is no deadline, and a function to stop
+// the timer.
+func deadlineTimer(deadline time.Time) (<-chan time.Time, func() bool) {
+	if deadline.IsZero() {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, timer.Stop
+}
+
+// Read reads the messages received on the streams of the connection, each
+// message being read whole before the next one.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) Read(b []byte) (int, error) {
+	c.readMtx.Lock()
+	defer c.readMtx.Unlock()
+
+	if len(c.pending) == 0 {
+		c.deadlineMtx.Lock()
+		expired, stop := deadlineTimer(c.readDeadline)
+		c.deadlineMtx.Unlock()
+		defer stop()
+
+		select {
+		case c.pending = <-c.frames:
+		case <-expired:
+			return 0, errQUICTimeout
+		case <-c.quit:
+			return 0, c.closeErr()
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// frameMessage returns the passed message prefixed by its length.
+func frameMessage(msg []byte) ([]byte, error) {
+	if len(msg) > maxQUICFrameSize {
+		return nil, ErrQUICFrameTooLarge
+	}
+	frame := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[4:], msg)
+	return frame, nil
+}
+
+// Write writes the passed bytes on the main stream as one message.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) Write(b []byte) (int, error) {
+	return c.WriteMessage(b, false)
+}
+
+// WriteMessage writes the passed serialized message on the main stream, or
+// queues it on the bulk stream for the bulk messages.
+//
+// This is part of the MessageConn interface.
+func (c *quicConn) WriteMessage(msg []byte, bulk bool) (int, error) {
+	frame, err := frameMessage(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	if !bulk {
+		c.mainMtx.Lock()
+		defer c.mainMtx.Unlock()
+		if _, err := c.main.Write(frame); err != nil {
+			c.closeWithError(err)
+			return 0, err
+		}
+		return len(msg), nil
+	}
+
+	c.deadlineMtx.Lock()
+	expired, stop := deadlineTimer(c.writeDeadline)
+	c.deadlineMtx.Unlock()
+	defer stop()
+
+	select {
+	case c.bulkQueue <- frame:
+		return len(msg), nil
+	case <-expired:
+		return 0, errQUICTimeout
+	case <-c.quit:
+		return 0, c.closeErr()
+	}
+}
+
+// Close closes the connection and its streams.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) Close() error {
+	c.closeWithError(net.ErrClosed)
+	return nil
+}
+
+// LocalAddr returns the local UDP address of the connection.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote UDP address of the connection.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of the following reads.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMtx.Lock()
+	c.readDeadline = t
+	c.deadlineMtx.Unlock()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the following writes on the main
+// stream and of the queuing of the following bulk messages.
+//
+// This is part of the net.Conn interface.
+func (c *quicConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMtx.Lock()
+	c.writeDeadline = t
+	c.deadlineMtx.Unlock()
+	return c.main.SetWriteDeadline(t)
+}
+
+// quicConfig returns the QUIC configuration of the peer connections.  Each
+// side opens the main and the bulk streams of its connections only.
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout:  quicDialTimeout,
+		MaxIdleTimeout:        quicIdleTimeout,
+		KeepAlivePeriod:       quicKeepAlive,
+		MaxIncomingStreams:    2,
+		MaxIncomingUniStreams: -1,
+	}
+}
+
+// DialQUIC connects to the passed address over QUIC and opens the streams of
+// the peer connection.  The peers are not authenticated by the transport,
+// just like over TCP, so the certificate of the remote peer is not verified.
+func DialQUIC(addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{quicALPN},
+		MinVersion:         tls.VersionTLS13,
+	}
+	conn, err := quic.DialAddr(ctx, addr, tlsConf, quicConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var streams [2]quic.Stream
+	for i, kind := range []byte{quicMainStream, quicBulkStream} {
+		stream, err := conn.OpenStreamSync(ctx)
+		if err == nil {
+			_, err = stream.Write([]byte{kind})
+		}
+		if err != nil {
+			conn.CloseWithError(0, "")
+			return nil, err
+		}
+		streams[i] = stream
+	}
+	return newQUICConn(conn, streams[0], streams[1]), nil
+}
+
+// QUICListener is a net.Listener accepting the QUIC peer connections.
+type QUICListener struct {
+	udpConn  net.PacketConn
+	listener *quic.Listener
+	conns    chan net.Conn
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Ensure QUICListener implements the net.Listener interface.
+var _ net.Listener = (*QUICListener)(nil)
+
+// ListenQUIC listens for QUIC peer connections on the passed UDP network and
+// address, with a self-signed certificate generated for the listener.
+func ListenQUIC(network, addr string) (*QUICListener, error) {
+	cert, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{quicALPN},
+		MinVersion:   tls.VersionTLS13,
+	}
+
+	udpConn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := quic.Listen(udpConn, tlsConf, quicConfig())
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+
+	l := &QUICListener{
+		udpConn:  udpConn,
+		listener: listener,
+		conns:    make(chan net.Conn),
+		quit:     make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.acceptHandler()
+	return l, nil
+}
+
+// acceptHandler accepts the QUIC connections until the listener is closed,
+// opening their streams concurrently so that a slow peer does not delay the
+// others.  It must be run as a goroutine.
+func (l *QUICListener) acceptHandler() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			c, err := acceptStreams(conn)
+			if err != nil {
+				conn.CloseWithError(0, "")
+				return
+			}
+			select {
+			case l.conns <- c:
+			case <-l.quit:
+				c.Close()
+			}
+		}()
+	}
+}
+
+// acceptStreams accepts the main and the bulk streams opened by the remote
+// peer of the passed connection.
+func acceptStreams(conn quic.Connection) (*quicConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), quicAcceptTimeout)
+	defer cancel()
+
+	var streams [2]quic.Stream
+	for i := 0; i < len(streams); i++ {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stream.SetReadDeadline(time.Now().Add(quicAcceptTimeout))
+		var kind [1]byte
+		if _, err := io.ReadFull(stream, kind[:]); err != nil {
+			return nil, err
+		}
+		stream.SetReadDeadline(time.Time{})
+		if kind[0] > quicBulkStream || streams[kind[0]] != nil {
+			return nil, fmt.Errorf("unexpected QUIC stream %d", kind[0])
+		}
+		streams[kind[0]] = stream
+	}
+	return newQUICConn(conn, streams[quicMainStream],
+		streams[quicBulkStream]), nil
+}
+
+// Accept waits for and returns the next QUIC peer connection.
+//
+// This is part of the net.Listener interface.
+func (l *QUICListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.quit:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops listening and closes the UDP socket of the listener along with
+// the connections it accepted.
+//
+// This is part of the net.Listener interface.
+func (l *QUICListener) Close() error {
+	select {
+	case <-l.quit:
+		return nil
+	default:
+	}
+	close(l.quit)
+	err := l.listener.Close()
+	l.udpConn.Close()
+	l.wg.Wait()
+	return err
+}
+
+// Addr returns the UDP address of the listener.
+//
+// This is part of the net.Listener interface.
+func (l *QUICListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// selfSignedCert returns a self-signed certificate with a new key.
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"asimov"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour * 24 * 365 * 10),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template,
+		&key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
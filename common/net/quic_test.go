@@ -0,0 +1,132 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package net
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// readMessage reads a message of the passed size from the connection.
+func readMessage(t *testing.T, conn net.Conn, size int) []byte {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return msg
+}
+
+func TestQUICConn(t *testing.T) {
+	listener, err := ListenQUIC("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenQUIC: %v", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	client, err := DialQUIC(listener.Addr().String(), time.Second*10)
+	if err != nil {
+		t.Fatalf("DialQUIC: %v", err)
+	}
+	defer client.Close()
+	mc, ok := client.(MessageConn)
+	if !ok {
+		t.Fatalf("DialQUIC returned a %T, want a MessageConn", client)
+	}
+
+	// The messages written on both streams are read whole.
+	block := bytes.Repeat([]byte{0xbb}, 1024*1024)
+	tx := bytes.Repeat([]byte{0x77}, 300)
+	if n, err := mc.WriteMessage(block, true); err != nil || n != len(block) {
+		t.Fatalf("WriteMessage block = %d, %v", n, err)
+	}
+	if n, err := mc.WriteMessage(tx, false); err != nil || n != len(tx) {
+		t.Fatalf("WriteMessage tx = %d, %v", n, err)
+	}
+
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	defer server.Close()
+	for i := 0; i < 2; i++ {
+		first := readMessage(t, server, 1)
+		switch first[0] {
+		case 0xbb:
+			msg := append(first, readMessage(t, server, len(block)-1)...)
+			if !bytes.Equal(msg, block) {
+				t.Fatalf("block message interleaved with another")
+			}
+		case 0x77:
+			msg := append(first, readMessage(t, server, len(tx)-1)...)
+			if !bytes.Equal(msg, tx) {
+				t.Fatalf("tx message interleaved with another")
+			}
+		default:
+			t.Fatalf("unexpected message byte %x", first[0])
+		}
+	}
+
+	// The writes of the accepted connection go on its main stream.
+	if _, err := server.Write([]byte("pong")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if msg := readMessage(t, client, 4); string(msg) != "pong" {
+		t.Fatalf("Read = %q, want %q", msg, "pong")
+	}
+
+	// Reads time out at the deadline.
+	client.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+	_, err = client.Read(make([]byte, 1))
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("Read after deadline = %v, want a timeout", err)
+	}
+
+	// Closing a side closes the other.
+	server.Close()
+	client.SetReadDeadline(time.Now().Add(time.Second * 10))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("Read after close succeeded")
+	}
+}
+
+func TestQUICFallback(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	// Nothing listens for QUIC on the UDP port of the TCP listener, so
+	// the address is dialed over TCP.
+	nap := NewNetAdapter("", "", "", "", "", "", false, false)
+	conn, err := nap.DialTimeout(&QUICAddr{Addr: listener.Addr()})
+	if err != nil {
+		t.Fatalf("DialTimeout: %v", err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*net.TCPConn); !ok {
+		t.Fatalf("DialTimeout returned a %T, want a *net.TCPConn", conn)
+	}
+}
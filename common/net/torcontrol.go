@@ -0,0 +1,181 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package net
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// torControlTimeout is the timeout of the connection to the Tor
+	// control port and of its commands.
+	torControlTimeout = time.Second * 30
+
+	// torReplyOK is the status code of the successful replies of the Tor
+	// control port.
+	torReplyOK = 250
+)
+
+// ErrTorNoAuthMethod indicates the Tor control port does not offer an
+// authentication method supported with the configured credentials.
+var ErrTorNoAuthMethod = errors.New("no supported tor control authentication method")
+
+// TorController is an authenticated connection to the control port of a Tor
+// daemon.  The onion services it adds are removed by Tor when the connection
+// is closed.
+type TorController struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// DialTorControl connects to the Tor control port at the passed address and
+// authenticates with the password when it is not empty, with the cookie file
+// announced by Tor otherwise.
+func DialTorControl(addr, password string) (*TorController, error) {
+	conn, err := net.DialTimeout("tcp", addr, torControlTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &TorController{
+		conn: conn,
+		text: textproto.NewConn(conn),
+	}
+	if err := c.authenticate(password); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// command sends a command to the control port and returns the lines of its
+// successful reply.
+func (c *TorController) command(format string, args ...interface{}) ([]string, error) {
+	c.conn.SetDeadline(time.Now().Add(torControlTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return nil, err
+	}
+	_, message, err := c.text.ReadResponse(torReplyOK)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(message, "\n"), nil
+}
+
+// authenticate authenticates the connection with the methods offered by the
+// control port.
+func (c *TorController) authenticate(password string) error {
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	methods := make(map[string]bool)
+	var cookieFile string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		for _, field := range splitTorFields(line[len("AUTH "):]) {
+			switch {
+			case strings.HasPrefix(field, "METHODS="):
+				for _, m := range strings.Split(field[len("METHODS="):], ",") {
+					methods[m] = true
+				}
+			case strings.HasPrefix(field, "COOKIEFILE="):
+				cookieFile, err = strconv.Unquote(field[len("COOKIEFILE="):])
+				if err != nil {
+					return fmt.Errorf("invalid tor cookie file: %v", err)
+				}
+			}
+		}
+	}
+
+	switch {
+	case methods["NULL"]:
+		_, err = c.command("AUTHENTICATE")
+	case password != "" && methods["HASHEDPASSWORD"]:
+		_, err = c.command("AUTHENTICATE %s", strconv.Quote(password))
+	case methods["COOKIE"] && cookieFile != "":
+		cookie, rerr := ioutil.ReadFile(cookieFile)
+		if rerr != nil {
+			return rerr
+		}
+		_, err = c.command("AUTHENTICATE %s", hex.EncodeToString(cookie))
+	default:
+		return ErrTorNoAuthMethod
+	}
+	return err
+}
+
+// splitTorFields splits the space separated fields of a reply line, which may
+// have quoted values.
+func splitTorFields(line string) []string {
+	var fields []string
+	start, quoted := 0, false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ' ':
+			if !quoted {
+				if i > start {
+					fields = append(fields, line[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(line) {
+		fields = append(fields, line[start:])
+	}
+	return fields
+}
+
+// AddOnion adds a v3 onion service forwarding its virtual port to the target
+// address.  The service uses the passed private key, in the ED25519-V3:<key>
+// form returned by a previous call, or a new key when it is empty.  It returns
+// the onion address of the service, without the .onion suffix, along with its
+// private key.
+func (c *TorController) AddOnion(privateKey string, port uint16, target string) (string, string, error) {
+	key := "NEW:ED25519-V3"
+	if privateKey != "" {
+		key = privateKey
+	}
+	lines, err := c.command("ADD_ONION %s Port=%d,%s", key, port, target)
+	if err != nil {
+		return "", "", err
+	}
+	var serviceID string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			serviceID = line[len("ServiceID="):]
+		case strings.HasPrefix(line, "PrivateKey="):
+			privateKey = line[len("PrivateKey="):]
+		}
+	}
+	if serviceID == "" {
+		return "", "", errors.New("tor did not return the onion service id")
+	}
+	return serviceID, privateKey, nil
+}
+
+// Close closes the connection to the control port, which removes the onion
+// services added by the controller.
+func (c *TorController) Close() error {
+	return c.text.Close()
+}
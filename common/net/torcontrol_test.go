@@ -0,0 +1,119 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package net
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeTorControl serves the control port commands of a Tor daemon offering
+// cookie authentication, and returns the commands it received.
+func fakeTorControl(t *testing.T, cookieFile string) (string, <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var commands []string
+		defer func() { received <- commands }()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			commands = append(commands, line)
+			var reply string
+			switch {
+			case line == "PROTOCOLINFO 1":
+				reply = "250-PROTOCOLINFO 1\r\n" +
+					"250-AUTH METHODS=COOKIE,SAFECOOKIE COOKIEFILE=" +
+					strconv.Quote(cookieFile) + "\r\n" +
+					"250-VERSION Tor=\"0.4.5.7\"\r\n250 OK\r\n"
+			case line == "AUTHENTICATE 636f6f6b6965":
+				reply = "250 OK\r\n"
+			case strings.HasPrefix(line, "ADD_ONION NEW:ED25519-V3 "):
+				reply = "250-ServiceID=abcdef\r\n" +
+					"250-PrivateKey=ED25519-V3:secret\r\n250 OK\r\n"
+			case strings.HasPrefix(line, "ADD_ONION ED25519-V3:secret "):
+				reply = "250-ServiceID=abcdef\r\n250 OK\r\n"
+			default:
+				reply = "515 Authentication failed\r\n"
+			}
+			if _, err := conn.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestTorControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torcontrol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cookieFile := filepath.Join(dir, "control auth cookie")
+	if err := ioutil.WriteFile(cookieFile, []byte("cookie"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, received := fakeTorControl(t, cookieFile)
+	c, err := DialTorControl(addr, "")
+	if err != nil {
+		t.Fatalf("DialTorControl: %v", err)
+	}
+	serviceID, key, err := c.AddOnion("", 8777, "127.0.0.1:8777")
+	if err != nil || serviceID != "abcdef" || key != "ED25519-V3:secret" {
+		t.Fatalf("AddOnion = %q, %q, %v", serviceID, key, err)
+	}
+	serviceID, key, err = c.AddOnion(key, 8777, "127.0.0.1:8777")
+	if err != nil || serviceID != "abcdef" || key != "ED25519-V3:secret" {
+		t.Fatalf("AddOnion with key = %q, %q, %v", serviceID, key, err)
+	}
+	c.Close()
+
+	want := []string{
+		"PROTOCOLINFO 1",
+		"AUTHENTICATE 636f6f6b6965",
+		"ADD_ONION NEW:ED25519-V3 Port=8777,127.0.0.1:8777",
+		"ADD_ONION ED25519-V3:secret Port=8777,127.0.0.1:8777",
+	}
+	if commands := <-received; !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %q, want %q", commands, want)
+	}
+}
+
+func TestTorControlNoAuthMethod(t *testing.T) {
+	addr, _ := fakeTorControl(t, "")
+	if _, err := DialTorControl(addr, "password"); err != ErrTorNoAuthMethod {
+		t.Errorf("DialTorControl = %v, want %v", err, ErrTorNoAuthMethod)
+	}
+}
+
+func TestSplitTorFields(t *testing.T) {
+	fields := splitTorFields(`METHODS=COOKIE COOKIEFILE="/a b/\"c\"" X=1`)
+	want := []string{"METHODS=COOKIE", `COOKIEFILE="/a b/\"c\""`, "X=1"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("splitTorFields = %q, want %q", fields, want)
+	}
+}
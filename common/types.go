@@ -68,6 +68,21 @@ func BigToHash(b *big.Int) Hash { return BytesToHash(b.Bytes()) }
 // If b is larger than len(h), b will be cropped from the left.
 func HexToHash(s string) Hash { return BytesToHash(FromHex(s)) }
 
+// ParseHash decodes a hash in the hex form the node logs and the RPCs return
+// it, which is the order of its bytes, unlike the byte-reversed form
+// NewHashFromStr expects.  Unlike HexToHash, it rejects a malformed hash.
+func ParseHash(s string) (*Hash, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != HashLength {
+		return nil, fmt.Errorf("hash of %d bytes, want %d", len(b), HashLength)
+	}
+	h := BytesToHash(b)
+	return &h, nil
+}
+
 // Bytes gets the byte representation of the underlying hash.
 func (h Hash) Bytes() []byte { return h[:] }
 
@@ -176,3 +176,23 @@ func TestNewHashFromStr(t *testing.T) {
 		}
 	}
 }
+
+// TestParseHash ensures a hash is parsed back from the form it is printed in,
+// and malformed hashes are rejected.
+func TestParseHash(t *testing.T) {
+	want := Hash{0x01, 0x02, 0x03, 31: 0xff}
+	hash, err := ParseHash(want.String())
+	if err != nil {
+		t.Fatalf("ParseHash: %v", err)
+	}
+	if *hash != want {
+		t.Errorf("parsed hash %v, want %v", hash, want)
+	}
+
+	for _, s := range []string{"", "zz", want.String()[2:],
+		want.String() + "00", want.Hex()} {
+		if _, err := ParseHash(s); err == nil {
+			t.Errorf("ParseHash(%q) succeeded", s)
+		}
+	}
+}
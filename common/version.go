@@ -7,8 +7,23 @@ package common
 // XXX pedro: we will probably need to bump this.
 const (
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 1
+	ProtocolVersion uint32 = 4
 
 	MinRequestVersion uint32 = 1
-	MaxRequestVersion uint32 = 1
+	MaxRequestVersion uint32 = 4
+
+	// SendHeadersVersion is the protocol version which added the
+	// sendheaders message, after which new blocks may be announced with
+	// headers messages.
+	SendHeadersVersion uint32 = 2
+
+	// CompressionVersion is the protocol version which added the
+	// sendcompress message, after which the large payloads of the messages
+	// sent to peers asking for it may be compressed.
+	CompressionVersion uint32 = 3
+
+	// AddrV2Version is the protocol version which added the sendaddrv2 and
+	// addrv2 messages, after which the addresses which are not IP
+	// addresses, such as Tor v3 and I2P addresses, may be relayed.
+	AddrV2Version uint32 = 4
 )
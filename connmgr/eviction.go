@@ -0,0 +1,161 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+const (
+	// protectedGroups is the number of inbound peers protected from
+	// eviction for the diversity of their network group.
+	protectedGroups = 4
+
+	// protectedPings is the number of inbound peers with the lowest ping
+	// time protected from eviction.
+	protectedPings = 8
+
+	// protectedTxs is the number of inbound peers which most recently
+	// relayed a transaction protected from eviction.
+	protectedTxs = 4
+
+	// protectedBlocks is the number of inbound peers which most recently
+	// relayed a block protected from eviction.
+	protectedBlocks = 4
+)
+
+// EvictionCandidate describes an inbound peer which may be evicted to make
+// room for a new inbound peer.
+type EvictionCandidate struct {
+	// ID identifies the peer.
+	ID int32
+
+	// Group is the network group of the peer.
+	Group string
+
+	// Connected is the time the peer connected.
+	Connected time.Time
+
+	// PingTime is the last ping time of the peer, 0 when unknown.
+	PingTime time.Duration
+
+	// LastBlock and LastTx are the last times the peer relayed a block and
+	// a transaction, zero when it never did.
+	LastBlock time.Time
+	LastTx    time.Time
+}
+
+// protect sorts the candidates so the most valuable ones according to better
+// come first, the oldest connections first among equally valuable ones, and
+// returns the candidates left once up to n are removed from the front.  Only
+// the eligible candidates are removed, so no peer is protected for a property
+// it does not have, such as relaying blocks.
+func protect(candidates []EvictionCandidate, n int,
+	better func(a, b *EvictionCandidate) bool,
+	eligible func(c *EvictionCandidate) bool) []EvictionCandidate {
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := &candidates[i], &candidates[j]
+		if better(a, b) {
+			return true
+		}
+		if better(b, a) {
+			return false
+		}
+		return a.Connected.Before(b.Connected)
+	})
+	removed := 0
+	for removed < n && removed < len(candidates) &&
+		eligible(&candidates[removed]) {
+		removed++
+	}
+	return candidates[removed:]
+}
+
+// anyCandidate is the eligibility of the protections applying to every peer.
+func anyCandidate(*EvictionCandidate) bool {
+	return true
+}
+
+// groupHash returns the hash of a network group keyed by the passed seed.
+// Keying the hash with a secret seed prevents an attacker from predicting
+// which network groups are protected.
+func groupHash(group string, seed uint64) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], seed)
+	h.Write(buf[:])
+	h.Write([]byte(group))
+	return h.Sum64()
+}
+
+// SelectEvictionCandidate selects the inbound peer to evict in order to make
+// room for a new inbound peer, and returns false when all the candidates are
+// protected.
+//
+// The peers are protected in turn for the diversity of their network group,
+// their low ping time, the transactions and blocks they recently relayed and,
+// for half of the remaining peers, their longevity.  The youngest peer of the
+// network group with the most remaining peers is then evicted, so an attacker
+// cannot take over the inbound slots from a few network segments.  The seed
+// keys the network group hashes and should be secret and random.
+func SelectEvictionCandidate(candidates []EvictionCandidate, seed uint64) (int32, bool) {
+	remaining := make([]EvictionCandidate, len(candidates))
+	copy(remaining, candidates)
+
+	remaining = protect(remaining, protectedGroups, func(a, b *EvictionCandidate) bool {
+		return groupHash(a.Group, seed) > groupHash(b.Group, seed)
+	}, anyCandidate)
+	remaining = protect(remaining, protectedPings, func(a, b *EvictionCandidate) bool {
+		if a.PingTime == 0 || b.PingTime == 0 {
+			return b.PingTime == 0 && a.PingTime != 0
+		}
+		return a.PingTime < b.PingTime
+	}, func(c *EvictionCandidate) bool {
+		return c.PingTime != 0
+	})
+	remaining = protect(remaining, protectedTxs, func(a, b *EvictionCandidate) bool {
+		return a.LastTx.After(b.LastTx)
+	}, func(c *EvictionCandidate) bool {
+		return !c.LastTx.IsZero()
+	})
+	remaining = protect(remaining, protectedBlocks, func(a, b *EvictionCandidate) bool {
+		return a.LastBlock.After(b.LastBlock)
+	}, func(c *EvictionCandidate) bool {
+		return !c.LastBlock.IsZero()
+	})
+	remaining = protect(remaining, len(remaining)/2, func(a, b *EvictionCandidate) bool {
+		return a.Connected.Before(b.Connected)
+	}, anyCandidate)
+	if len(remaining) == 0 {
+		return 0, false
+	}
+
+	// Pick the network group with the most peers, and among the largest
+	// ones the group with the youngest peer.
+	groups := make(map[string][]*EvictionCandidate)
+	for i := range remaining {
+		c := &remaining[i]
+		groups[c.Group] = append(groups[c.Group], c)
+	}
+	var evict *EvictionCandidate
+	evictCount := 0
+	for _, peers := range groups {
+		youngest := peers[0]
+		for _, c := range peers[1:] {
+			if c.Connected.After(youngest.Connected) {
+				youngest = c
+			}
+		}
+		if len(peers) > evictCount || (len(peers) == evictCount &&
+			youngest.Connected.After(evict.Connected)) {
+			evict, evictCount = youngest, len(peers)
+		}
+	}
+	return evict.ID, true
+}
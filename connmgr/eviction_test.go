@@ -0,0 +1,62 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSelectEvictionCandidate ensures the protected peers are never evicted
+// and the youngest peer of the largest network group is evicted otherwise.
+func TestSelectEvictionCandidate(t *testing.T) {
+	now := time.Now()
+
+	// Too few peers to evict any.
+	var candidates []EvictionCandidate
+	for i := 0; i < protectedGroups+protectedPings+protectedTxs+protectedBlocks; i++ {
+		candidates = append(candidates, EvictionCandidate{
+			ID:        int32(i),
+			Group:     fmt.Sprintf("group%d", i),
+			Connected: now.Add(-time.Hour),
+			PingTime:  time.Duration(100+i) * time.Millisecond,
+			LastBlock: now.Add(-time.Duration(60+i) * time.Minute),
+			LastTx:    now.Add(-time.Duration(60+i) * time.Minute),
+		})
+	}
+	if id, ok := SelectEvictionCandidate(candidates, 1); ok {
+		t.Fatalf("evicted peer %d from protected peers", id)
+	}
+
+	// Flood from a single network group of peers which relay nothing.  The
+	// oldest flooding peers are protected for their longevity, so the
+	// youngest one is evicted.
+	for i := 0; i < 20; i++ {
+		candidates = append(candidates, EvictionCandidate{
+			ID:        int32(100 + i),
+			Group:     "attacker",
+			Connected: now.Add(-time.Duration(20-i) * time.Minute),
+		})
+	}
+	id, ok := SelectEvictionCandidate(candidates, 1)
+	if !ok || id != 119 {
+		t.Fatalf("evicted peer %d (%v), want 119", id, ok)
+	}
+
+	// Peers which recently relayed blocks or have a low ping are protected.
+	for i := range candidates {
+		if candidates[i].ID == 119 {
+			candidates[i].LastBlock = now
+		}
+		if candidates[i].ID == 118 {
+			candidates[i].PingTime = time.Millisecond
+		}
+	}
+	id, ok = SelectEvictionCandidate(candidates, 1)
+	if !ok || id != 117 {
+		t.Fatalf("evicted peer %d (%v), want 117", id, ok)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package connmgr
+
+import (
+	"fmt"
+	mrand "math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+const (
+	// These constants are used by the DNS seed code to pick a random last
+	// seen time.
+	secondsIn3Days int32 = 24 * 60 * 60 * 3
+	secondsIn4Days int32 = 24 * 60 * 60 * 4
+)
+
+// OnSeed is the signature of the callback function which is invoked with the
+// addresses of the peers found by a seed.
+type OnSeed func(addrs []*protos.NetAddress)
+
+// LookupFunc is the signature of the DNS lookup function.
+type LookupFunc func(string) ([]net.IP, error)
+
+// SeedHost returns the host queried on a DNS seed for the peers with the
+// passed services.  The seeds supporting filtering encode the required
+// services in a subdomain.
+func SeedHost(seed chaincfg.DNSSeed, reqServices common.ServiceFlag) string {
+	if !seed.HasFiltering || reqServices == common.SFNodeNetwork {
+		return seed.Host
+	}
+	return fmt.Sprintf("x%x.%s", uint64(reqServices), seed.Host)
+}
+
+// seedAddresses returns the network addresses of the passed IPs with a last
+// seen time randomly selected between 3 and 7 days ago, so the seeds are
+// tried after the addresses learnt from the peers.
+func seedAddresses(ips []net.IP, port uint16) []*protos.NetAddress {
+	randSource := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	addrs := make([]*protos.NetAddress, len(ips))
+	for i, ip := range ips {
+		addrs[i] = protos.NewNetAddressTimestamp(
+			time.Now().Add(-1*time.Second*time.Duration(secondsIn3Days+
+				randSource.Int31n(secondsIn4Days))),
+			0, ip, port)
+	}
+	return addrs
+}
+
+// fixedSeedAddresses parses the passed fixed seeds, given as IP addresses
+// optionally followed by a port.  The invalid seeds are skipped.
+func fixedSeedAddresses(seeds []string, defaultPort uint16) []*protos.NetAddress {
+	addrs := make([]*protos.NetAddress, 0, len(seeds))
+	for _, seed := range seeds {
+		host, port := seed, defaultPort
+		if h, p, err := net.SplitHostPort(seed); err == nil {
+			n, err := strconv.ParseUint(p, 10, 16)
+			if err != nil {
+				log.Warnf("Invalid port of fixed seed %s", seed)
+				continue
+			}
+			host, port = h, uint16(n)
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			log.Warnf("Invalid fixed seed %s", seed)
+			continue
+		}
+		addrs = append(addrs, seedAddresses([]net.IP{ip}, port)...)
+	}
+	return addrs
+}
+
+// SeedPeers queries the passed DNS seeds for peers with the required services
+// and passes the addresses found by each seed to seedFn.  When no seed
+// returns any address, the fixed seeds are passed instead, so a new node
+// still joins the network while its DNS seeds are unreachable.  It returns
+// once every seed answered or failed.
+func SeedPeers(dnsSeeds []chaincfg.DNSSeed, fixedSeeds []string, defaultPort string,
+	reqServices common.ServiceFlag, lookupFn LookupFunc, seedFn OnSeed) {
+
+	// The port was validated with the network parameters.
+	intPort, _ := strconv.Atoi(defaultPort)
+	port := uint16(intPort)
+
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	found := 0
+	for _, dnsseed := range dnsSeeds {
+		host := SeedHost(dnsseed, reqServices)
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			seedpeers, err := lookupFn(host)
+			if err != nil {
+				log.Infof("DNS discovery failed on seed %s: %v", host, err)
+				return
+			}
+			log.Infof("%d addresses found from DNS seed %s", len(seedpeers), host)
+			if len(seedpeers) == 0 {
+				return
+			}
+			mtx.Lock()
+			found += len(seedpeers)
+			mtx.Unlock()
+			seedFn(seedAddresses(seedpeers, port))
+		}(host)
+	}
+	wg.Wait()
+
+	if found > 0 || len(fixedSeeds) == 0 {
+		return
+	}
+	addrs := fixedSeedAddresses(fixedSeeds, port)
+	log.Infof("No address found from the DNS seeds, using %d fixed seeds",
+		len(addrs))
+	if len(addrs) > 0 {
+		seedFn(addrs)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package connmgr
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// TestSeedHost ensures the required services are only encoded in the hosts of
+// the seeds supporting filtering.
+func TestSeedHost(t *testing.T) {
+	tests := []struct {
+		seed     chaincfg.DNSSeed
+		services common.ServiceFlag
+		want     string
+	}{
+		{chaincfg.DNSSeed{Host: "seed.example.com", HasFiltering: true},
+			common.SFNodeNetwork, "seed.example.com"},
+		{chaincfg.DNSSeed{Host: "seed.example.com", HasFiltering: true},
+			common.SFNodeNetwork | common.SFNodeBloom, "x3.seed.example.com"},
+		{chaincfg.DNSSeed{Host: "seed.example.com", HasFiltering: false},
+			common.SFNodeNetwork | common.SFNodeBloom, "seed.example.com"},
+	}
+	for i, test := range tests {
+		if host := SeedHost(test.seed, test.services); host != test.want {
+			t.Errorf("#%d: SeedHost = %s, want %s", i, host, test.want)
+		}
+	}
+}
+
+// TestSeedPeers ensures the addresses of the DNS seeds are passed to the seed
+// callback, and the fixed seeds only when no DNS seed returns any address.
+func TestSeedPeers(t *testing.T) {
+	dnsSeeds := []chaincfg.DNSSeed{{Host: "a.example.com"}, {Host: "b.example.com"}}
+	fixedSeeds := []string{"10.0.0.1", "10.0.0.2:9000", "bad", "10.0.0.3:bad"}
+
+	seed := func(answers map[string][]net.IP) []string {
+		var mtx sync.Mutex
+		var got []string
+		lookup := func(host string) ([]net.IP, error) {
+			ips, ok := answers[host]
+			if !ok {
+				return nil, errors.New("no such host")
+			}
+			return ips, nil
+		}
+		SeedPeers(dnsSeeds, fixedSeeds, "8777", common.SFNodeNetwork, lookup,
+			func(addrs []*protos.NetAddress) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				for _, addr := range addrs {
+					got = append(got, net.JoinHostPort(addr.IP.String(),
+						strconv.Itoa(int(addr.Port))))
+				}
+			})
+		sort.Strings(got)
+		return got
+	}
+
+	got := seed(map[string][]net.IP{
+		"a.example.com": {net.ParseIP("192.0.2.1")},
+		"b.example.com": {net.ParseIP("192.0.2.2")},
+	})
+	want := []string{"192.0.2.1:8777", "192.0.2.2:8777"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DNS seeds: got %v, want %v", got, want)
+	}
+
+	got = seed(map[string][]net.IP{"a.example.com": {}})
+	want = []string{"10.0.0.1:8777", "10.0.0.2:9000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fixed seeds: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/ainterface"
+	"github.com/AsimovNetwork/asimov/blockchain"
+)
+
+// Engine decides who may produce the blocks and seals them.  It is defined in
+// ainterface so the block chain can use it without importing the consensus.
+type Engine = ainterface.Engine
+
+// EngineFactory creates a consensus engine.
+type EngineFactory func() (Engine, error)
+
+var (
+	enginesMtx sync.RWMutex
+	engines    = make(map[string]EngineFactory)
+)
+
+func init() {
+	roundEngine := func() (Engine, error) {
+		return blockchain.RoundEngine{}, nil
+	}
+	for _, name := range []string{"solo", "poa", "satoshiplus"} {
+		RegisterEngine(name, roundEngine)
+	}
+}
+
+// RegisterEngine registers the factory of the engine of the named consensus,
+// replacing the one registered before, if any.
+func RegisterEngine(name string, factory EngineFactory) {
+	enginesMtx.Lock()
+	engines[name] = factory
+	enginesMtx.Unlock()
+}
+
+// NewEngine creates the engine registered for the named consensus.
+func NewEngine(name string) (Engine, error) {
+	enginesMtx.RLock()
+	factory, ok := engines[name]
+	enginesMtx.RUnlock()
+	if !ok {
+		return nil, errors.New("no engine registered for consensus " + name)
+	}
+	return factory()
+}
+
+// EngineNames returns the names of the consensuses with a registered engine.
+func EngineNames() []string {
+	enginesMtx.RLock()
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	enginesMtx.RUnlock()
+	sort.Strings(names)
+	return names
+}
@@ -41,4 +41,27 @@ type Config struct {
 
 	// Account provide a private key to sign a new produced block.
 	Account *crypto.Account
+
+	// SigningAccount returns the account signing the block at the passed
+	// height, when the validator key is scheduled to change.  Account is
+	// used at all heights when it is nil.
+	SigningAccount func(height int32) *crypto.Account
+
+	// NewTxs is signaled when transactions are accepted to the mempool.
+	// When it is set, the solo consensus produces a block as soon as they
+	// arrive and skips the slots while the mempool is empty, instead of
+	// producing a block in every slot.
+	NewTxs <-chan struct{}
+
+	// PendingTxs returns the number of transactions in the mempool.  It
+	// must be set along with NewTxs.
+	PendingTxs func() int
+}
+
+// AccountAt returns the account signing the block at the passed height.
+func (c *Config) AccountAt(height int32) *crypto.Account {
+	if c.SigningAccount != nil {
+		return c.SigningAccount(height)
+	}
+	return c.Account
 }
@@ -189,7 +189,8 @@ func (s *Service) slotControl() (int64, int64, bool) {
 		return 0, 0, false
 	}
 
-	isTurn := *validators[slot] == *s.config.Account.Address
+	account := s.config.AccountAt(best.Height + 1)
+	isTurn := *validators[slot] == *account.Address
 	log.Infof("[slotControl] slot change slot=%d, round=%d, height=%d, isTurn=%v, interval=%v",
 		slot, round, best.Height+1, isTurn,
 		float64(s.context.RoundInterval)/float64(chaincfg.ActiveNetParams.RoundSize))
@@ -208,8 +209,9 @@ func (s *Service) genBlock() {
 	blockInterval := float64(s.GetRoundInterval()) / float64(chaincfg.ActiveNetParams.RoundSize) * 1000
 	log.Infof("try to gen block at round=%d, slot=%d", round, slot)
 
+	account := s.config.AccountAt(s.config.Chain.BestSnapshot().Height + 1)
 	template, err := s.config.BlockTemplateGenerator.ProduceNewBlock(
-		s.config.Account, s.config.GasFloor, s.config.GasCeil,
+		account, s.config.GasFloor, s.config.GasCeil,
 		time.Now().Unix(), uint32(round), uint16(slot), blockInterval)
 	if err != nil {
 		log.Errorf("Consensus POA Failed to gen a block: %v", err)
@@ -306,7 +306,7 @@ func createPoaConfig(privateKey string, paramstmp *chaincfg.Params) (*params.Con
 	policy := mining.Policy{
 		TxMinPrice: 0,
 	}
-	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy, txMemPool, sigMemPool, chain)
+	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy, txMemPool, sigMemPool, chain, nil)
 
 	consensusConfig := params.Config{
 		BlockTemplateGenerator: blockTemplateGenerator,
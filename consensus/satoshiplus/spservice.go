@@ -198,7 +198,8 @@ func (s *SPService) checkTurn(slot, round int64, verbose bool) bool {
 		return false
 	}
 
-	isTurn := *validators[slot] == *s.config.Account.Address
+	account := s.config.AccountAt(best.Height + 1)
+	isTurn := *validators[slot] == *account.Address
 	log.Infof("[checkTurn] slot change slot=%d, round=%d, height=%d, isTurn=%v, interval=%v",
 		slot, round, best.Height+1, isTurn, s.context.RoundInterval)
 	return isTurn
@@ -296,7 +297,7 @@ func (s *SPService) processBlock(blockTime int64, round, slot int64, interval fl
 	s.mineParam = &MineParam{Parent:s.chainTip.Hash(), Round:round, Slot:slot}
 	log.Infof("satoshiplus gen block start at round=%d, slot=%d", round, slot)
 	template, err := s.config.BlockTemplateGenerator.ProduceNewBlock(
-		s.config.Account, s.config.GasFloor, s.config.GasCeil,
+		s.config.AccountAt(s.chainTip.Height()+1), s.config.GasFloor, s.config.GasCeil,
 		blockTime, uint32(round), uint16(slot), interval)
 	if err != nil {
 		log.Errorf("satoshiplus gen block failed to make a block: %v", err)
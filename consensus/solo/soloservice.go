@@ -60,6 +60,8 @@ func (s *SoloService) Start() error {
 			select {
 			case <-s.timer.C:
 				s.genBlock()
+			case <-s.config.NewTxs:
+				s.genBlockOnDemand()
 			case <-existCh:
 				s.wg.Done()
 				return
@@ -83,6 +85,41 @@ func (s *SoloService) Halt() error {
 func (s *SoloService) genBlock() {
 	round, slot := s.slotControl()
 	s.resetTimer()
+	if s.config.NewTxs != nil && !s.needBlock(round, slot) {
+		return
+	}
+	s.produceBlock(round, slot)
+}
+
+// genBlockOnDemand produces a block in the current slot right away, unless a
+// block was already produced in it, in which case the block is produced at
+// the start of the next slot.
+func (s *SoloService) genBlockOnDemand() {
+	round, slot := s.slotControl()
+	if !s.needBlock(round, slot) {
+		return
+	}
+	s.produceBlock(round, slot)
+}
+
+// needBlock returns whether a block should be produced on demand in the passed
+// slot: the slot must follow the one of the chain tip, and the mempool must
+// hold transactions unless the block rewards of the chain are not spendable
+// yet, so the account producing the blocks always has funds.
+func (s *SoloService) needBlock(round, slot int64) bool {
+	tip := s.config.Chain.GetTip()
+	if int64(tip.Round()) > round ||
+		int64(tip.Round()) == round && int64(tip.Slot()) >= slot {
+		return false
+	}
+	if tip.Height() <= chaincfg.ActiveNetParams.CoinbaseMaturity {
+		return true
+	}
+	return s.config.PendingTxs() > 0
+}
+
+// produceBlock produces a block in the passed slot.
+func (s *SoloService) produceBlock(round, slot int64) {
 	blockInterval := float64(s.GetRoundInterval()) / float64(chaincfg.ActiveNetParams.RoundSize) * 1000
 
 	// Create a new block using the available transactions
@@ -27,6 +27,12 @@ type Driver struct {
 	// arguments to open the database.  This function must return
 	// ErrDbDoesNotExist if the database has not already been created.
 	Open func(args ...interface{}) (database.Database, error)
+
+	// OpenReadOnly is the function that will be invoked with all
+	// user-specified arguments to open the database read-only.  This
+	// function must return ErrDbDoesNotExist if the database has not
+	// already been created.
+	OpenReadOnly func(args ...interface{}) (database.Database, error)
 }
 
 // driverList holds all of the registered database backends.
@@ -86,13 +92,29 @@ func Open(dbType string, args ...interface{}) (database.Database, error) {
 	return drv.Open(args...)
 }
 
+// OpenReadOnly opens an existing database for the specified type read-only.
+// Its write transactions fail with ErrTxNotWritable.  The arguments are
+// specific to the database type driver.
+//
+// ErrDbUnknownType will be returned if the the database type is not registered.
+func OpenReadOnly(dbType string, args ...interface{}) (database.Database, error) {
+	drv, exists := drivers[dbType]
+	if !exists {
+		str := fmt.Sprintf("driver %q is not registered", dbType)
+		return nil, database.MakeError(database.ErrDbUnknownType, str, nil)
+	}
+
+	return drv.OpenReadOnly(args...)
+}
+
 
 func init() {
 	// Register the driver.
 	driver := &Driver{
-		DbType: database.FFLDB,
-		Create: ffldb.CreateDBDriver,
-		Open:   ffldb.OpenDBDriver,
+		DbType:       database.FFLDB,
+		Create:       ffldb.CreateDBDriver,
+		Open:         ffldb.OpenDBDriver,
+		OpenReadOnly: ffldb.OpenReadOnlyDBDriver,
 	}
 	if err := RegisterDriver(driver); err != nil {
 		panic(fmt.Sprintf("Failed to regiser database driver '%s': %v",
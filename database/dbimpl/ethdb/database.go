@@ -18,6 +18,7 @@ package ethdb
 
 import (
 	"fmt"
+	"github.com/AsimovNetwork/asimov/chaos"
 	"github.com/AsimovNetwork/asimov/database"
 	"strconv"
 	"strings"
@@ -63,6 +64,16 @@ var _ database.Database = (*LDBDatabase)(nil)
 
 // NewLDBDatabase returns a LevelDB wrapped object.
 func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
+	return newLDBDatabase(file, cache, handles, false)
+}
+
+// NewLDBDatabaseReadOnly returns a LevelDB wrapped object opened read-only,
+// whose writes fail.  A corrupt database is not recovered.
+func NewLDBDatabaseReadOnly(file string, cache int, handles int) (*LDBDatabase, error) {
+	return newLDBDatabase(file, cache, handles, true)
+}
+
+func newLDBDatabase(file string, cache int, handles int, readOnly bool) (*LDBDatabase, error) {
 	logger := log.New("database", file)
 
 	// Ensure we have some minimal caching and file guarantees
@@ -80,8 +91,9 @@ func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
 		BlockCacheCapacity:     cache / 2 * opt.MiB,
 		WriteBuffer:            cache / 4 * opt.MiB, // Two of these are used internally
 		Filter:                 filter.NewBloomFilter(10),
+		ReadOnly:               readOnly,
 	})
-	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
+	if _, corrupted := err.(*errors.ErrCorrupted); corrupted && !readOnly {
 		db, err = leveldb.RecoverFile(file, nil)
 	}
 	// (Re)check for errors and abort if opening of the db failed
@@ -106,6 +118,9 @@ func (db *LDBDatabase) Type() string {
 
 // Put puts the given key / value to the queue
 func (db *LDBDatabase) Put(key []byte, value []byte) error {
+	if err := chaos.DiskFault(chaos.StoreState); err != nil {
+		return err
+	}
 	return db.db.Put(key, value, nil)
 }
 
@@ -171,6 +186,33 @@ func (db *LDBDatabase) Close() error {
 	return err
 }
 
+// Compact compacts the database one key prefix at a time so it remains usable
+// in between.
+//
+// This function is part of the database.Compacter interface implementation.
+func (db *LDBDatabase) Compact(interrupt <-chan struct{}, progress func(done, total int)) error {
+	const total = 256
+	for i := 0; i < total; i++ {
+		select {
+		case <-interrupt:
+			return database.ErrInterrupted
+		default:
+		}
+
+		r := util.Range{Start: []byte{byte(i)}}
+		if i < total-1 {
+			r.Limit = []byte{byte(i + 1)}
+		}
+		if err := db.db.CompactRange(r); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+	return nil
+}
+
 func (db *LDBDatabase) LDB() *leveldb.DB {
 	return db.db
 }
@@ -394,6 +436,9 @@ func (b *ldbBatch) Delete(key []byte) error {
 }
 
 func (b *ldbBatch) Write() error {
+	if err := chaos.DiskFault(chaos.StoreState); err != nil {
+		return err
+	}
 	return b.db.Write(b.b, nil)
 }
 
@@ -211,3 +211,74 @@ func testParallelPutGet(db database.Database, t *testing.T) {
 	}
 	pending.Wait()
 }
+
+func TestLDB_Compact(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(strconv.Itoa(i))
+		if err := db.Put(key, key); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+		if i%2 == 0 {
+			if err := db.Delete(key); err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+		}
+	}
+
+	var done, total int
+	err := db.Compact(nil, func(d, t int) {
+		done, total = d, t
+	})
+	if err != nil {
+		t.Fatalf("compact failed: %v", err)
+	}
+	if done != total || total == 0 {
+		t.Errorf("progress: got %d/%d", done, total)
+	}
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if err := db.Compact(interrupt, nil); err != database.ErrInterrupted {
+		t.Errorf("interrupted compact: got %v, want %v", err, database.ErrInterrupted)
+	}
+
+	data, err := db.Get([]byte("1"))
+	if err != nil || !bytes.Equal(data, []byte("1")) {
+		t.Errorf("get after compact: got (%q, %v)", data, err)
+	}
+	if has, _ := db.Has([]byte("2")); has {
+		t.Error("deleted key present after compact")
+	}
+}
+
+func TestLDB_ReadOnly(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "ethdb_test_")
+	if err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	db, err := ethdb.NewLDBDatabase(dirname, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	db.Close()
+
+	db, err = ethdb.NewLDBDatabaseReadOnly(dirname, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open test database read-only: %v", err)
+	}
+	defer db.Close()
+	if data, err := db.Get([]byte("key")); err != nil || string(data) != "value" {
+		t.Fatalf("get returned %q, %v, expected %q", data, err, "value")
+	}
+	if err := db.Put([]byte("key"), []byte("other")); err == nil {
+		t.Fatal("put succeeded on a read-only database")
+	}
+}
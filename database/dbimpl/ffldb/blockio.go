@@ -5,6 +5,24 @@
 
 // This file contains the implementation functions for reading, writing, and
 // otherwise working with the flat files that house the actual blocks.
+//
+// The block files created by older versions, version 1, are a sequence of
+// records in the format:
+//
+//  <network><block length><serialized block><checksum>
+//
+// The files created since then, version 2, start with a header made of
+// blockFileMagic and the version, followed by records in the format:
+//
+//  <network><block length><header checksum><chunk checksums><serialized block><checksum>
+//
+// The header checksum covers the network and block length, so the records of
+// a file can be walked to detect the ones torn by a crash without reading the
+// blocks.  The chunk checksums cover every recordChunkSize bytes of the block,
+// and serve as a sparse index letting the regions of a block, such as its
+// header or a single transaction, be read and verified without reading the
+// whole block.  The records are appended to the version 1 files of existing
+// databases in the version 1 format, and the following files use version 2.
 
 package ffldb
 
@@ -12,6 +30,7 @@ import (
 	"container/list"
 	"encoding/binary"
 	"fmt"
+	"github.com/AsimovNetwork/asimov/chaos"
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/database"
 	"hash/crc32"
@@ -55,6 +74,25 @@ const (
 	//  [4:8]  File offset (4 bytes)
 	//  [8:12] Block length (4 bytes)
 	blockLocSize = 12
+
+	// blockFileMagic starts the header of the version 2 block files.  It
+	// differs from the network magics which start the version 1 files.
+	blockFileMagic uint32 = 0x32424641
+
+	// blockFileVersion is the format version of the new block files.
+	blockFileVersion uint32 = 2
+
+	// fileHeaderSize is the size of the header of the version 2 block
+	// files, made of blockFileMagic and the format version.
+	fileHeaderSize = 8
+
+	// recordHeaderSize is the size of the network, block length and header
+	// checksum starting the version 2 records.
+	recordHeaderSize = 12
+
+	// recordChunkSize is the number of bytes of a block covered by each
+	// chunk checksum of the version 2 records.
+	recordChunkSize = 4096
 )
 
 var (
@@ -79,6 +117,9 @@ type filer interface {
 type lockableFile struct {
 	sync.RWMutex
 	file filer
+
+	// version is the format version of the file.
+	version uint32
 }
 
 // writeCursor represents the current file and offset of the block file on disk
@@ -167,6 +208,11 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
+	// firstFileNum is the number of the oldest block file, the previous
+	// ones having been pruned.  It is only accessed with the database
+	// write lock held.
+	firstFileNum uint32
+
 	// These functions are set to openFile, openWriteFile, and deleteFile by
 	// default, but are exposed here to allow the whitebox tests to replace
 	// them when working with mock files.
@@ -222,6 +268,47 @@ func blockFilePath(dbPath string, fileNum uint32) string {
 	return filepath.Join(dbPath, fileName)
 }
 
+// fileVersion returns the format version of the passed block file given by its
+// header.  The version 1 files, as well as the empty ones, have no header.
+func fileVersion(file filer) uint32 {
+	var header [fileHeaderSize]byte
+	if _, err := file.ReadAt(header[:], 0); err != nil {
+		return 1
+	}
+	if byteOrder.Uint32(header[0:4]) != blockFileMagic {
+		return 1
+	}
+	return byteOrder.Uint32(header[4:8])
+}
+
+// checkFileVersion returns an error when the passed format version of a block
+// file is not supported.
+func checkFileVersion(fileNum, version uint32) error {
+	if version > blockFileVersion {
+		str := fmt.Sprintf("block file %d has unsupported format "+
+			"version %d", fileNum, version)
+		return database.MakeError(database.ErrDriverSpecific, str, nil)
+	}
+	return nil
+}
+
+// numChunks returns the number of chunk checksums of the version 2 record of a
+// block with the passed length.
+func numChunks(blockLen uint32) uint32 {
+	return (blockLen + recordChunkSize - 1) / recordChunkSize
+}
+
+// recordLen returns the full length of the record of a block with the passed
+// length in a block file of the passed format version.
+func recordLen(version, blockLen uint32) uint32 {
+	if version < blockFileVersion {
+		// 4 bytes each for block network + 4 bytes for block length +
+		// length of raw block + 4 bytes for checksum.
+		return blockLen + 12
+	}
+	return recordHeaderSize + 4*numChunks(blockLen) + blockLen + 4
+}
+
 // openWriteFile returns a file handle for the passed flat file number in
 // read/write mode.  The file will be created if needed.  It is typically used
 // for the current file that will have all new data appended.  Unlike openFile,
@@ -256,7 +343,26 @@ func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
 		return nil, database.MakeError(database.ErrDriverSpecific, err.Error(),
 			err)
 	}
-	blockFile := &lockableFile{file: file}
+	version := fileVersion(file)
+	if err := checkFileVersion(fileNum, version); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// Map the file in memory when possible, falling back to reading it
+	// with system calls otherwise.  The current write file, which is only
+	// opened here before the first write, is not mapped since it grows.
+	wc := s.writeCursor
+	wc.RLock()
+	isWriteFile := fileNum >= wc.curFileNum
+	wc.RUnlock()
+	var blockFiler filer = file
+	if !isWriteFile {
+		if mapped, ok := mmapBlockFile(file); ok {
+			blockFiler = mapped
+		}
+	}
+	blockFile := &lockableFile{file: blockFiler, version: version}
 
 	// Close the least recently used file if the file exceeds the max
 	// allowed open files.  This is not done until after the file open in
@@ -306,6 +412,59 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// pruneFiles closes and deletes the oldest block files up to, but not
+// including, the passed flat file number.
+//
+// This function MUST be called with the database write lock held.
+func (s *blockStore) pruneFiles(endFileNum uint32) error {
+	for ; s.firstFileNum < endFileNum; s.firstFileNum++ {
+		fileNum := s.firstFileNum
+
+		// Close the file when it is open, under the write lock for the
+		// file in case any readers are currently reading from it.
+		s.obfMutex.Lock()
+		if blockFile, ok := s.openBlockFiles[fileNum]; ok {
+			s.lruMutex.Lock()
+			s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+			delete(s.fileNumToLRUElem, fileNum)
+			s.lruMutex.Unlock()
+
+			blockFile.Lock()
+			_ = blockFile.file.Close()
+			blockFile.Unlock()
+			delete(s.openBlockFiles, fileNum)
+		}
+		s.obfMutex.Unlock()
+
+		if err := s.deleteFileFunc(fileNum); err != nil {
+			return err
+		}
+		log.Debugf("Pruned block file #%d", fileNum)
+	}
+	return nil
+}
+
+// closeFilesFrom closes the read-only handles of the passed flat file number
+// and the following ones.  They are reopened as needed by the next reads.
+func (s *blockStore) closeFilesFrom(fileNum uint32) {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+	for openFileNum, blockFile := range s.openBlockFiles {
+		if openFileNum < fileNum {
+			continue
+		}
+		s.lruMutex.Lock()
+		s.openBlocksLRU.Remove(s.fileNumToLRUElem[openFileNum])
+		delete(s.fileNumToLRUElem, openFileNum)
+		s.lruMutex.Unlock()
+
+		blockFile.Lock()
+		_ = blockFile.file.Close()
+		blockFile.Unlock()
+		delete(s.openBlockFiles, openFileNum)
+	}
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -376,8 +535,12 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 // locked for writes.  Also, the write cursor current file must NOT be nil.
 func (s *blockStore) writeData(data []byte) error {
 	wc := s.writeCursor
+	data, chaosErr := chaos.TornWrite(chaos.StoreBlocks, data)
 	n, err := wc.curFile.file.WriteAt(data, int64(wc.curOffset))
 	wc.curOffset += uint32(n)
+	if err == nil {
+		err = chaosErr
+	}
 	if err != nil {
 		str := fmt.Sprintf("failed to write data to file %d at "+
 			"offset %d: %v", wc.curFileNum, wc.curOffset-uint32(n), err)
@@ -387,6 +550,35 @@ func (s *blockStore) writeData(data []byte) error {
 	return nil
 }
 
+// writeFileVersion returns the format version the next record appended to the
+// current write file uses, opening the file as needed.  The records appended
+// to the version 1 files of existing databases keep that format, the new files
+// use the version 2 format.
+//
+// NOTE: This function must only be called during a write transaction so it is
+// effectively locked for writes.
+func (s *blockStore) writeFileVersion() (uint32, error) {
+	wc := s.writeCursor
+	if wc.curOffset == 0 {
+		return blockFileVersion, nil
+	}
+
+	wc.curFile.Lock()
+	defer wc.curFile.Unlock()
+	if wc.curFile.file == nil {
+		file, err := s.openWriteFileFunc(wc.curFileNum)
+		if err != nil {
+			return 0, err
+		}
+		wc.curFile.file = file
+		wc.curFile.version = fileVersion(file)
+	}
+	if err := checkFileVersion(wc.curFileNum, wc.curFile.version); err != nil {
+		return 0, err
+	}
+	return wc.curFile.version, nil
+}
+
 // writeBlock appends the specified raw block bytes to the store's write cursor
 // location and increments it accordingly.  When the block would exceed the max
 // file size for the current flat file, this function will close the current
@@ -396,13 +588,18 @@ func (s *blockStore) writeData(data []byte) error {
 // The write cursor will also be advanced the number of bytes actually written
 // in the event of failure.
 //
-// Format: <network><block length><serialized block><checksum>
+// Format: <network><block length><serialized block><checksum> in the version 1
+// files, and <network><block length><header checksum><chunk checksums>
+// <serialized block><checksum> in the version 2 files.
 func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
-	// Compute how many bytes will be written.
-	// 4 bytes each for block network + 4 bytes for block length +
-	// length of raw block + 4 bytes for checksum.
+	// Compute how many bytes will be written, including the header of the
+	// file when starting a new one.
 	blockLen := uint32(len(rawBlock))
-	fullLen := blockLen + 12
+	version, err := s.writeFileVersion()
+	if err != nil {
+		return blockLocation{}, err
+	}
+	fullLen := recordLen(version, blockLen)
 
 	// Move to the next block file if adding the new block would exceed the
 	// max allowed size for the current block file.  Also detect overflow
@@ -415,6 +612,9 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	// a time.
 	wc := s.writeCursor
 	finalOffset := wc.curOffset + fullLen
+	if wc.curOffset == 0 {
+		finalOffset += fileHeaderSize
+	}
 	if finalOffset < wc.curOffset || finalOffset > s.maxBlockFileSize {
 		// This is done under the write cursor lock since the curFileNum
 		// field is accessed elsewhere by readers.
@@ -435,6 +635,9 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		wc.curFileNum++
 		wc.curOffset = 0
 		wc.Unlock()
+
+		version = blockFileVersion
+		fullLen = recordLen(version, blockLen)
 	}
 
 	// All writes are done under the write lock for the file to ensure any
@@ -454,22 +657,33 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		wc.curFile.file = file
 	}
 
-	// Bitcoin network.
+	// Start the new files with the header identifying their format.
+	if wc.curOffset == 0 {
+		var header [fileHeaderSize]byte
+		byteOrder.PutUint32(header[0:4], blockFileMagic)
+		byteOrder.PutUint32(header[4:8], blockFileVersion)
+		if err := s.writeData(header[:]); err != nil {
+			return blockLocation{}, err
+		}
+		wc.curFile.version = blockFileVersion
+	}
+
+	// Bitcoin network and block length, followed in the version 2 format
+	// by their checksum and the checksums of the chunks of the block.
 	origOffset := wc.curOffset
 	hasher := crc32.New(castagnoli)
-	var scratch [4]byte
-	byteOrder.PutUint32(scratch[:], uint32(s.network))
-	if err := s.writeData(scratch[:]); err != nil {
-		return blockLocation{}, err
+	var prefix []byte
+	if version < blockFileVersion {
+		prefix = make([]byte, 8)
+		byteOrder.PutUint32(prefix[0:4], uint32(s.network))
+		byteOrder.PutUint32(prefix[4:8], blockLen)
+	} else {
+		prefix = s.recordPrefix(rawBlock)
 	}
-	_, _ = hasher.Write(scratch[:])
-
-	// Block length.
-	byteOrder.PutUint32(scratch[:], blockLen)
-	if err := s.writeData(scratch[:]); err != nil {
+	if err := s.writeData(prefix); err != nil {
 		return blockLocation{}, err
 	}
-	_, _ = hasher.Write(scratch[:])
+	_, _ = hasher.Write(prefix)
 
 	// Serialized block.
 	if err := s.writeData(rawBlock[:]); err != nil {
@@ -490,6 +704,39 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	return loc, nil
 }
 
+// recordPrefix returns the part of the version 2 record of the passed block
+// which precedes the serialized block.
+//
+// Format: <network><block length><header checksum><chunk checksums>
+func (s *blockStore) recordPrefix(rawBlock []byte) []byte {
+	blockLen := uint32(len(rawBlock))
+	chunks := numChunks(blockLen)
+	prefix := make([]byte, recordHeaderSize+4*chunks)
+	byteOrder.PutUint32(prefix[0:4], uint32(s.network))
+	byteOrder.PutUint32(prefix[4:8], blockLen)
+	binary.BigEndian.PutUint32(prefix[8:12],
+		crc32.Checksum(prefix[0:8], castagnoli))
+	for i := uint32(0); i < chunks; i++ {
+		end := (i + 1) * recordChunkSize
+		if end > blockLen {
+			end = blockLen
+		}
+		checksum := crc32.Checksum(rawBlock[i*recordChunkSize:end], castagnoli)
+		binary.BigEndian.PutUint32(prefix[recordHeaderSize+4*i:], checksum)
+	}
+	return prefix
+}
+
+// parseRecordHeader returns the block length of the version 2 record header
+// stored in the passed data, after checking its checksum.
+func parseRecordHeader(data []byte) (uint32, bool) {
+	serializedChecksum := binary.BigEndian.Uint32(data[8:12])
+	if serializedChecksum != crc32.Checksum(data[0:8], castagnoli) {
+		return 0, false
+	}
+	return byteOrder.Uint32(data[4:8]), true
+}
+
 // readBlock reads the specified block record and returns the serialized block.
 // It ensures the integrity of the block data by checking that the serialized
 // network matches the current network associated with the block store and
@@ -502,7 +749,9 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 // ErrCorruption if the checksum of the read data doesn't match the checksum
 // read from the file.
 //
-// Format: <network><block length><serialized block><checksum>
+// Format: <network><block length><serialized block><checksum> in the version 1
+// files, and <network><block length><header checksum><chunk checksums>
+// <serialized block><checksum> in the version 2 files.
 func (s *blockStore) readBlock(key *database.BlockKey, loc blockLocation) ([]byte, error) {
 	// Get the referenced block file handle opening the file as needed.  The
 	// function also handles closing files as needed to avoid going over the
@@ -512,6 +761,7 @@ func (s *blockStore) readBlock(key *database.BlockKey, loc blockLocation) ([]byt
 		return nil, err
 	}
 
+	version := blockFile.version
 	serializedData := make([]byte, loc.blockLen)
 	n, err := blockFile.file.ReadAt(serializedData, int64(loc.fileOffset))
 	blockFile.RUnlock()
@@ -547,8 +797,18 @@ func (s *blockStore) readBlock(key *database.BlockKey, loc blockLocation) ([]byt
 	}
 
 	// The raw block excludes the network, length of the block, and
-	// checksum.
-	return serializedData[8 : n-4], nil
+	// checksum, as well as the checksums of the header and the chunks in
+	// the version 2 format.
+	if version < blockFileVersion {
+		return serializedData[8 : n-4], nil
+	}
+	blockLen, ok := parseRecordHeader(serializedData)
+	if !ok || recordLen(version, blockLen) != uint32(n) {
+		str := fmt.Sprintf("block data for block %v has an invalid "+
+			"record header", key)
+		return nil, database.MakeError(database.ErrCorruption, str, nil)
+	}
+	return serializedData[n-4-int(blockLen) : n-4], nil
 }
 
 // readBlockRegion reads the specified amount of data at the provided offset for
@@ -558,7 +818,12 @@ func (s *blockStore) readBlock(key *database.BlockKey, loc blockLocation) ([]byt
 // closing files as necessary to stay within the maximum allowed open files
 // limit.
 //
-// Returns ErrDriverSpecific if the data fails to read for any reason.
+// In the version 2 files, only the chunks of the block spanned by the region
+// are read and their checksums verified.
+//
+// Returns ErrDriverSpecific if the data fails to read for any reason,
+// ErrBlockRegionInvalid if the region exceeds the bounds of the block and
+// ErrCorruption if the checksums of the version 2 record do not match.
 func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32) ([]byte, error) {
 	// Get the referenced block file handle opening the file as needed.  The
 	// function also handles closing files as needed to avoid going over the
@@ -567,6 +832,11 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 	if err != nil {
 		return nil, err
 	}
+	defer blockFile.RUnlock()
+
+	if blockFile.version >= blockFileVersion {
+		return s.readChunks(blockFile, loc, offset, numBytes)
+	}
 
 	// Regions are offsets into the actual block, however the serialized
 	// data for a block includes an initial 4 bytes for network + 4 bytes
@@ -574,7 +844,6 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 	readOffset := loc.fileOffset + 8 + offset
 	serializedData := make([]byte, numBytes)
 	_, err = blockFile.file.ReadAt(serializedData, int64(readOffset))
-	blockFile.RUnlock()
 	if err != nil {
 		str := fmt.Sprintf("failed to read region from block file %d, "+
 			"offset %d, len %d: %v", loc.blockFileNum, readOffset,
@@ -585,6 +854,83 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 	return serializedData, nil
 }
 
+// readChunks reads the specified region of a block stored in a version 2
+// block file by reading the record header, the checksums of the chunks spanned
+// by the region and these chunks, and verifying them.
+//
+// This function MUST be called with the block file read lock held.
+func (s *blockStore) readChunks(blockFile *lockableFile, loc blockLocation, offset, numBytes uint32) ([]byte, error) {
+	if numBytes == 0 {
+		return []byte{}, nil
+	}
+	readErr := func(readOffset, readLen uint32, err error) error {
+		str := fmt.Sprintf("failed to read region from block file %d, "+
+			"offset %d, len %d: %v", loc.blockFileNum, readOffset,
+			readLen, err)
+		return database.MakeError(database.ErrDriverSpecific, str, err)
+	}
+
+	// Read the record header along with the checksums up to the last chunk
+	// spanned by the region.
+	firstChunk := offset / recordChunkSize
+	lastChunk := (offset + numBytes - 1) / recordChunkSize
+	prefixLen := recordHeaderSize + 4*(lastChunk+1)
+	if prefixLen > loc.blockLen {
+		str := fmt.Sprintf("region offset %d, length %d exceeds the "+
+			"block record length of %d", offset, numBytes, loc.blockLen)
+		return nil, database.MakeError(database.ErrBlockRegionInvalid, str, nil)
+	}
+	prefix := make([]byte, prefixLen)
+	if _, err := blockFile.file.ReadAt(prefix, int64(loc.fileOffset)); err != nil {
+		return nil, readErr(loc.fileOffset, prefixLen, err)
+	}
+	blockLen, ok := parseRecordHeader(prefix)
+	if !ok || recordLen(blockFile.version, blockLen) != loc.blockLen {
+		str := fmt.Sprintf("block record in file %d at offset %d has "+
+			"an invalid header", loc.blockFileNum, loc.fileOffset)
+		return nil, database.MakeError(database.ErrCorruption, str, nil)
+	}
+	endOffset := offset + numBytes
+	if endOffset < offset || endOffset > blockLen {
+		str := fmt.Sprintf("region offset %d, length %d exceeds "+
+			"block length of %d", offset, numBytes, blockLen)
+		return nil, database.MakeError(database.ErrBlockRegionInvalid, str, nil)
+	}
+
+	// Read the spanned chunks and verify their checksums.
+	chunksStart := firstChunk * recordChunkSize
+	chunksEnd := (lastChunk + 1) * recordChunkSize
+	if chunksEnd > blockLen {
+		chunksEnd = blockLen
+	}
+	chunks := make([]byte, chunksEnd-chunksStart)
+	readOffset := loc.fileOffset + recordHeaderSize + 4*numChunks(blockLen) +
+		chunksStart
+	if _, err := blockFile.file.ReadAt(chunks, int64(readOffset)); err != nil {
+		return nil, readErr(readOffset, uint32(len(chunks)), err)
+	}
+	for i := firstChunk; i <= lastChunk; i++ {
+		start := (i - firstChunk) * recordChunkSize
+		end := start + recordChunkSize
+		if end > uint32(len(chunks)) {
+			end = uint32(len(chunks))
+		}
+		serializedChecksum := binary.BigEndian.Uint32(
+			prefix[recordHeaderSize+4*i:])
+		calculatedChecksum := crc32.Checksum(chunks[start:end], castagnoli)
+		if serializedChecksum != calculatedChecksum {
+			str := fmt.Sprintf("chunk %d of the block record in file "+
+				"%d at offset %d checksum does not match - got "+
+				"%x, want %x", i, loc.blockFileNum, loc.fileOffset,
+				calculatedChecksum, serializedChecksum)
+			return nil, database.MakeError(database.ErrCorruption, str, nil)
+		}
+	}
+
+	regionStart := offset - chunksStart
+	return chunks[regionStart : regionStart+numBytes : regionStart+numBytes], nil
+}
+
 // syncBlocks performs a file system sync on the flat file associated with the
 // store's current write cursor.  It is safe to call even when there is not a
 // current write file in which case it will have no effect.
@@ -639,6 +985,11 @@ func (s *blockStore) syncBlocks() error {
 // Therefore, any errors are simply logged at a warning level rather than being
 // returned since there is nothing more that could be done about it anyways.
 func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
+	// Close the read-only handles of the files which are about to be
+	// truncated or deleted, since reading the memory mapping of a
+	// truncated file crashes the process.
+	s.closeFilesFrom(oldBlockFileNum)
+
 	// Grab the write cursor mutex since it is modified throughout this
 	// function.
 	wc := s.writeCursor
@@ -690,6 +1041,7 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 			return
 		}
 		wc.curFile.file = obf
+		wc.curFile.version = fileVersion(obf)
 	}
 
 	// Truncate the to the provided rollback offset.
@@ -710,15 +1062,81 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// intactEnd walks the records of the current write file up to the passed
+// offset and returns the offset following the last record whose header is
+// intact and which ends at most at that offset.  The records of the version 1
+// files can't be walked without reading the blocks, so the passed offset is
+// returned for them.
+//
+// It is used when opening the database to detect the records torn, or the
+// data lost, by a crash in the middle of writes, which may leave a file with
+// the expected length but an invalid content.
+func (s *blockStore) intactEnd(end uint32) (uint32, error) {
+	if end < fileHeaderSize {
+		return end, nil
+	}
+
+	wc := s.writeCursor
+	wc.curFile.Lock()
+	defer wc.curFile.Unlock()
+	if wc.curFile.file == nil {
+		file, err := s.openWriteFileFunc(wc.curFileNum)
+		if err != nil {
+			return 0, err
+		}
+		wc.curFile.file = file
+		wc.curFile.version = fileVersion(file)
+	}
+	if wc.curFile.version < blockFileVersion {
+		return end, nil
+	}
+
+	offset := uint32(fileHeaderSize)
+	var header [recordHeaderSize]byte
+	for offset < end {
+		_, err := wc.curFile.file.ReadAt(header[:], int64(offset))
+		if err != nil {
+			break
+		}
+		blockLen, ok := parseRecordHeader(header[:])
+		if !ok || byteOrder.Uint32(header[0:4]) != uint32(s.network) {
+			break
+		}
+		next := offset + recordLen(wc.curFile.version, blockLen)
+		if next < offset || next > end {
+			break
+		}
+		offset = next
+	}
+	return offset, nil
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
-// find the end of the most recent file.  This position is considered the
-// current write cursor which is also stored in the metadata.  Thus, it is used
-// to detect unexpected shutdowns in the middle of writes so the block files
-// can be reconciled.
-func scanBlockFiles(dbPath string) (int, uint32) {
+// find the oldest file and the end of the most recent file.  This position is
+// considered the current write cursor which is also stored in the metadata.
+// Thus, it is used to detect unexpected shutdowns in the middle of writes so
+// the block files can be reconciled.  The files preceding the oldest one may
+// have been pruned, the following ones are contiguous.
+func scanBlockFiles(dbPath string) (int, int, uint32) {
+	firstFile := -1
+	paths, _ := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	for _, path := range paths {
+		var fileNum int
+		_, err := fmt.Sscanf(filepath.Base(path), blockFilenameTemplate, &fileNum)
+		if err != nil {
+			continue
+		}
+		if firstFile == -1 || fileNum < firstFile {
+			firstFile = fileNum
+		}
+	}
+	if firstFile == -1 {
+		firstFile = 0
+	}
+
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	for i := firstFile; ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -729,9 +1147,9 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 		fileLen = uint32(st.Size())
 	}
 
-	log.Tracef("Scan found latest block file #%d with length %d", lastFile,
-		fileLen)
-	return lastFile, fileLen
+	log.Tracef("Scan found block files #%d to #%d with length %d",
+		firstFile, lastFile, fileLen)
+	return firstFile, lastFile, fileLen
 }
 
 // newBlockStore returns a new block store with the current block file number
@@ -740,9 +1158,9 @@ func newBlockStore(basePath string, network common.AsimovNet) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
-	fileNum, fileOff := scanBlockFiles(basePath)
+	firstFileNum, fileNum, fileOff := scanBlockFiles(basePath)
 	if fileNum == -1 {
-		fileNum = 0
+		fileNum = firstFileNum
 		fileOff = 0
 	}
 
@@ -759,6 +1177,7 @@ func newBlockStore(basePath string, network common.AsimovNet) *blockStore {
 			curFileNum: uint32(fileNum),
 			curOffset:  fileOff,
 		},
+		firstFileNum: uint32(firstFileNum),
 	}
 	store.openFileFunc = store.openFile
 	store.openWriteFileFunc = store.openWriteFile
@@ -15,6 +15,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/database/dbimpl/ffldb/treap"
 )
@@ -26,6 +27,7 @@ type db struct {
 	writeLock sync.Mutex   // Limit to one write transaction at a time.
 	closeLock sync.RWMutex // Make database close block while txns active.
 	closed    bool         // Is the database closed?
+	readOnly  bool         // Was the database opened read-only?
 	store     *blockStore  // Handles read/writing blocks to flat files.
 	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
 }
@@ -184,6 +186,43 @@ func (db *db) Close() error {
 	return closeErr
 }
 
+// Compact compacts the metadata leveldb database one key prefix at a time so
+// the database remains usable in between.  The flat block files are not
+// affected since they are append only.
+//
+// This function is part of the database.Compacter interface implementation.
+func (db *db) Compact(interrupt <-chan struct{}, progress func(done, total int)) error {
+	// Hold the close lock so the database can not be closed in the middle
+	// of the compaction.
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		return database.MakeError(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+
+	const total = 256
+	for i := 0; i < total; i++ {
+		select {
+		case <-interrupt:
+			return database.ErrInterrupted
+		default:
+		}
+
+		r := util.Range{Start: []byte{byte(i)}}
+		if i < total-1 {
+			r.Limit = []byte{byte(i + 1)}
+		}
+		if err := db.cache.ldb.CompactRange(r); err != nil {
+			str := "failed to compact metadata"
+			return database.MakeError(database.ErrDriverSpecific, str, err)
+		}
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+	return nil
+}
+
 // begin is the implementation function for the Begin database method.  See its
 // documentation for more details.
 //
@@ -191,6 +230,11 @@ func (db *db) Close() error {
 // which is used by the managed transaction code while the database method
 // returns the interface.
 func (db *db) begin(writable bool) (*transaction, error) {
+	if writable && db.readOnly {
+		str := "write transaction on a database opened read-only"
+		return nil, database.MakeError(database.ErrTxNotWritable, str, nil)
+	}
+
 	// Whenever a new writable transaction is started, grab the write lock
 	// to ensure only a single write transaction can be active at the same
 	// time.  This lock will not be released until the transaction is
@@ -298,7 +342,9 @@ func initDB(ldb *leveldb.DB) error {
 
 // openDB opens the database at the provided path.  database.ErrDbDoesNotExist
 // is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network common.AsimovNet, create bool) (database.Database, error) {
+// A database opened read-only refuses the write transactions, and is never
+// repaired after an unclean shutdown.
+func openDB(dbPath string, network common.AsimovNet, create, readOnly bool) (database.Database, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -321,6 +367,7 @@ func openDB(dbPath string, network common.AsimovNet, create bool) (database.Data
 		Strict:       opt.DefaultStrict,
 		Compression:  opt.NoCompression,
 		Filter:       filter.NewBloomFilter(10),
+		ReadOnly:     readOnly,
 	}
 	ldb, err := leveldb.OpenFile(metadataDbPath, &opts)
 	if err != nil {
@@ -334,7 +381,7 @@ func openDB(dbPath string, network common.AsimovNet, create bool) (database.Data
 	// write caching.
 	store := newBlockStore(dbPath, network)
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
-	pdb := &db{store: store, cache: cache}
+	pdb := &db{readOnly: readOnly, store: store, cache: cache}
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
@@ -416,6 +463,14 @@ func reconcileDB(pdb *db, create bool) (database.Database, error) {
 	if wc.curFileNum > curFileNum || (wc.curFileNum == curFileNum &&
 		wc.curOffset > curOffset) {
 
+		if pdb.readOnly {
+			str := fmt.Sprintf("metadata claims file %d, offset %d, "+
+				"but block data is at file %d, offset %d -- open "+
+				"the database writable to repair it", curFileNum,
+				curOffset, wc.curFileNum, wc.curOffset)
+			return nil, database.MakeError(database.ErrCorruption, str, nil)
+		}
+
 		log.Info("Detected unclean shutdown - Repairing...")
 		log.Debugf("Metadata claims file %d, offset %d. Block data is "+
 			"at file %d, offset %d", curFileNum, curOffset,
@@ -424,6 +479,28 @@ func reconcileDB(pdb *db, create bool) (database.Database, error) {
 		log.Infof("Database sync complete")
 	}
 
+	// The records of the version 2 block files can be walked, so make sure
+	// the ones of the current write file are intact up to the position the
+	// metadata believes to be true.  An unclean shutdown can leave a file
+	// with the expected length but with torn records or lost data.
+	if wc.curFileNum == curFileNum {
+		end := curOffset
+		if wc.curOffset < end {
+			end = wc.curOffset
+		}
+		intact, err := pdb.store.intactEnd(end)
+		if err != nil {
+			return nil, err
+		}
+		if intact < end {
+			str := fmt.Sprintf("metadata claims file %d, offset %d, "+
+				"but the block records are only intact up to "+
+				"offset %d", curFileNum, curOffset, intact)
+			log.Warnf("***Database corruption detected***: %v", str)
+			return nil, database.MakeError(database.ErrCorruption, str, nil)
+		}
+	}
+
 	// When the write cursor position found by scanning the block files on
 	// disk is BEFORE the position the metadata believes to be true, return
 	// a corruption error.  Since sync is called after each block is written
@@ -481,7 +558,18 @@ func OpenDBDriver(args ...interface{}) (database.Database, error) {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, false)
+	return openDB(dbPath, network, false, false)
+}
+
+// OpenReadOnlyDBDriver is the callback provided during driver registration
+// that opens an existing database read-only.
+func OpenReadOnlyDBDriver(args ...interface{}) (database.Database, error) {
+	dbPath, network, err := parseArgs("OpenReadOnly", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDB(dbPath, network, false, true)
 }
 
 // createDBDriver is the callback provided during driver registration that
@@ -492,5 +580,5 @@ func CreateDBDriver(args ...interface{}) (database.Database, error) {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, true)
+	return openDB(dbPath, network, true, false)
 }
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/database/dbimpl/ffldb/treap"
+	"os"
 	"sort"
 	"sync"
 )
@@ -81,6 +82,9 @@ type transaction struct {
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
 
+	// Block files preceding pruneFileNum are deleted on commit.
+	pruneFileNum uint32
+
 	// Active iterators that need to be notified when the pending keys have
 	// been updated so the cursors can properly handle updates to the
 	// transaction state.
@@ -341,6 +345,97 @@ func (tx *transaction) HasBlocks(keys []database.BlockKey) ([]bool, error) {
 	return results, nil
 }
 
+// PruneBlocks deletes the oldest flat block files, along with the blocks they
+// hold, while the total size of the block files exceeds the target size.  The
+// file holding the block identified by the passed key, the files following it
+// and the current write file are never deleted.  It returns the keys of the
+// deleted blocks.
+//
+// The blocks are removed from the block index with the transaction, and their
+// files are deleted once it is committed.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the block to keep does not exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, keep *database.BlockKey) ([]database.BlockKey, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, database.MakeError(database.ErrTxNotWritable, str, nil)
+	}
+
+	blockRow, err := tx.fetchBlockRow(keep)
+	if err != nil {
+		return nil, err
+	}
+	keepFileNum := deserializeBlockLoc(blockRow).blockFileNum
+
+	store := tx.db.store
+	wc := store.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	totalSize := uint64(wc.curOffset)
+	wc.RUnlock()
+
+	firstFileNum := store.firstFileNum
+	if tx.pruneFileNum > firstFileNum {
+		firstFileNum = tx.pruneFileNum
+	}
+	var sizes []uint64
+	for fileNum := firstFileNum; fileNum < curFileNum; fileNum++ {
+		st, err := os.Stat(blockFilePath(store.basePath, fileNum))
+		if err != nil {
+			return nil, database.MakeError(database.ErrDriverSpecific,
+				err.Error(), err)
+		}
+		sizes = append(sizes, uint64(st.Size()))
+		totalSize += uint64(st.Size())
+	}
+
+	pruneFileNum := firstFileNum
+	for totalSize > targetSize && pruneFileNum < keepFileNum &&
+		pruneFileNum < curFileNum {
+
+		totalSize -= sizes[pruneFileNum-firstFileNum]
+		pruneFileNum++
+	}
+	if pruneFileNum == firstFileNum {
+		return nil, nil
+	}
+
+	// Remove the blocks of the pruned files from the block index.
+	var pruned []database.BlockKey
+	err = tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+		if deserializeBlockLoc(v).blockFileNum < pruneFileNum {
+			var key database.BlockKey
+			copy(key[:], k)
+			pruned = append(pruned, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pruned {
+		if err := tx.blockIdxBucket.Delete(pruned[i][:]); err != nil {
+			return nil, err
+		}
+	}
+	tx.pruneFileNum = pruneFileNum
+
+	log.Debugf("Pruning block files #%d to #%d holding %d blocks",
+		firstFileNum, pruneFileNum-1, len(pruned))
+	return pruned, nil
+}
+
 // fetchBlockRow fetches the metadata stored in the block index for the provided
 // key.  It will return ErrBlockNotFound if there is no entry.
 func (tx *transaction) fetchBlockRow(key *database.BlockKey) ([]byte, error) {
@@ -815,7 +910,20 @@ func (tx *transaction) Commit() error {
 	}
 
 	// Write pending data.  The function will rollback if any errors occur.
-	return tx.writePendingAndCommit()
+	if err := tx.writePendingAndCommit(); err != nil {
+		return err
+	}
+
+	// Delete the pruned block files once the removal of their blocks from
+	// the block index is persisted, so the index never references a
+	// deleted file after an unclean shutdown.
+	if tx.pruneFileNum > tx.db.store.firstFileNum {
+		if err := tx.db.cache.flush(); err != nil {
+			return err
+		}
+		return tx.db.store.pruneFiles(tx.pruneFileNum)
+	}
+	return nil
 }
 
 // Rollback undoes all changes that have been made to the root bucket and all of
@@ -7,6 +7,7 @@ package ffldb
 import (
 	"bytes"
 	"fmt"
+	"github.com/AsimovNetwork/asimov/chaos"
 	"github.com/AsimovNetwork/asimov/database"
 	"sync"
 	"time"
@@ -451,6 +452,10 @@ type TreapForEacher interface {
 // commitTreaps atomically commits all of the passed pending add/update/remove
 // updates to the underlying database.
 func (c *dbCache) commitTreaps(pendingKeys, pendingRemove TreapForEacher) error {
+	if err := chaos.DiskFault(chaos.StoreMetadata); err != nil {
+		return database.ConvertErr("failed to commit treaps", err)
+	}
+
 	// Perform all leveldb updates using an atomic transaction.
 	return c.updateDB(func(ldbTx *leveldb.Transaction) error {
 		var innerErr error
@@ -0,0 +1,76 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"errors"
+	"io"
+)
+
+// errMmapReadOnly is returned when writing to a memory mapped block file.
+var errMmapReadOnly = errors.New("memory mapped block file is read-only")
+
+// mmapFile is a read-only block file mapped in memory.  Reading from it copies
+// the data from the mapping, which saves the system call of each read when
+// serving many concurrent requests for blocks.  The copy ensures the returned
+// data remains valid once the file is closed by the least recently used
+// tracking.
+//
+// It implements the filer interface.
+type mmapFile struct {
+	data  []byte
+	unmap func([]byte) error
+}
+
+// ReadAt reads len(b) bytes from the mapping starting at the passed offset.
+// Like os.File, it returns io.EOF when fewer bytes are available.
+//
+// This is part of the filer implementation.
+func (f *mmapFile) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt always fails since the mapped files are read-only.
+//
+// This is part of the filer implementation.
+func (f *mmapFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, errMmapReadOnly
+}
+
+// Truncate always fails since the mapped files are read-only.
+//
+// This is part of the filer implementation.
+func (f *mmapFile) Truncate(size int64) error {
+	return errMmapReadOnly
+}
+
+// Sync does nothing since the mapped files are read-only.
+//
+// This is part of the filer implementation.
+func (f *mmapFile) Sync() error {
+	return nil
+}
+
+// Close unmaps the file.
+//
+// This is part of the filer implementation.
+func (f *mmapFile) Close() error {
+	if f.data == nil {
+		return nil
+	}
+	err := f.unmap(f.data)
+	f.data = nil
+	return err
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build windows || plan9
+// +build windows plan9
+
+package ffldb
+
+import "os"
+
+// mmapBlockFile does not map the block files on this platform, they are read
+// with system calls.
+func mmapBlockFile(file *os.File) (filer, bool) {
+	return nil, false
+}
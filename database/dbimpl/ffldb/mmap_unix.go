@@ -0,0 +1,37 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package ffldb
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mmapBlockFile maps the passed read-only block file in memory, in which case
+// it closes the file and returns the mapping.  The file is not mapped and is
+// read with system calls on the 32-bit platforms, whose address space can't
+// hold the open files, and when the mapping fails.
+func mmapBlockFile(file *os.File) (filer, bool) {
+	if unsafe.Sizeof(uintptr(0)) < 8 {
+		return nil, false
+	}
+	st, err := file.Stat()
+	if err != nil || st.Size() == 0 || st.Size() > int64(maxBlockFileSize) {
+		return nil, false
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(st.Size()),
+		syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		log.Debugf("Failed to map block file %s, reading it with "+
+			"system calls: %v", file.Name(), err)
+		return nil, false
+	}
+	_ = file.Close()
+	return &mmapFile{data: data, unmap: syscall.Munmap}, true
+}
@@ -9,13 +9,17 @@
 package ffldb
 
 import (
+	"bytes"
 	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/common"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/syndtr/goleveldb/leveldb"
@@ -710,3 +714,412 @@ func resetDatabase(tc *testContext) bool {
 //	// Test various corruption scenarios.
 //	testCorruption(tc)
 //}
+
+// TestPruneBlocks ensures the oldest block files are pruned down to the target
+// size without deleting the block to keep, and the pruned files are skipped
+// when the database is reopened.
+func TestPruneBlocks(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "ffldb-prune")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	idb, err := openDB(dbPath, common.DevelopNet, true, false)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+
+	// Store every block in its own file, the blocks taking 116 bytes with
+	// the file header, the record header and the checksums.
+	idb.(*db).store.maxBlockFileSize = 150
+	keys := make([]database.BlockKey, 6)
+	for i := range keys {
+		keys[i] = *database.NewNormalBlockKey(&common.Hash{byte(i + 1)})
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(&keys[i], make([]byte, 88))
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock #%d: %v", i, err)
+		}
+	}
+
+	// The files take 696 bytes, pruning to 250 bytes deletes the first
+	// four files but the block to keep is in the fourth one.
+	var pruned []database.BlockKey
+	err = idb.Update(func(tx database.Tx) error {
+		pruned, err = tx.PruneBlocks(250, &keys[3])
+		return err
+	})
+	if err != nil {
+		t.Fatalf("PruneBlocks: %v", err)
+	}
+	if len(pruned) != 3 {
+		t.Fatalf("PruneBlocks: pruned %d blocks, want 3", len(pruned))
+	}
+	for i := 0; i < 6; i++ {
+		_, err := os.Stat(blockFilePath(dbPath, uint32(i)))
+		if exists := err == nil; exists != (i >= 3) {
+			t.Fatalf("block file #%d exists: %v", i, exists)
+		}
+	}
+
+	// Pruning again with the same target does nothing more.
+	err = idb.Update(func(tx database.Tx) error {
+		pruned, err = tx.PruneBlocks(250, &keys[5])
+		return err
+	})
+	if err != nil || len(pruned) != 1 {
+		t.Fatalf("PruneBlocks: pruned %d blocks, err %v", len(pruned), err)
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	idb, err = openDB(dbPath, common.DevelopNet, false, false)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	defer idb.Close()
+	if first := idb.(*db).store.firstFileNum; first != 4 {
+		t.Fatalf("firstFileNum: got %d, want 4", first)
+	}
+	err = idb.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(&keys[3])
+		if dbErr, ok := err.(database.Error); !ok ||
+			dbErr.ErrorCode != database.ErrBlockNotFound {
+
+			t.Errorf("FetchBlock of a pruned block: got %v", err)
+		}
+		_, err = tx.FetchBlock(&keys[4])
+		return err
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock: %v", err)
+	}
+}
+
+// checkErrorCode returns whether the passed error is a database error with the
+// passed code.
+func checkErrorCode(err error, code database.ErrorCode) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == code
+}
+
+// TestBlockFileFormat ensures the blocks are stored in the version 2 format,
+// their regions are read and verified chunk by chunk, and the corruption of a
+// record is detected.
+func TestBlockFileFormat(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "ffldb-format")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	idb, err := openDB(dbPath, common.DevelopNet, true, false)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+
+	// The block spans three chunks.
+	block := make([]byte, 10000)
+	for i := range block {
+		block[i] = byte(i * 7)
+	}
+	key := database.NewNormalBlockKey(&common.Hash{1})
+	err = idb.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(key, block)
+	})
+	if err != nil {
+		t.Fatalf("StoreBlock: %v", err)
+	}
+
+	regions := []database.BlockRegion{
+		{Key: key, Offset: 0, Len: 80},
+		{Key: key, Offset: 4090, Len: 20},
+		{Key: key, Offset: 9990, Len: 10},
+	}
+	err = idb.View(func(tx database.Tx) error {
+		fetched, err := tx.FetchBlock(key)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(fetched, block) {
+			t.Errorf("FetchBlock: mismatched block")
+		}
+		fetchedRegions, err := tx.FetchBlockRegions(regions)
+		if err != nil {
+			return err
+		}
+		for i, r := range regions {
+			want := block[r.Offset : r.Offset+r.Len]
+			if !bytes.Equal(fetchedRegions[i], want) {
+				t.Errorf("FetchBlockRegions #%d: mismatched region", i)
+			}
+		}
+		_, err = tx.FetchBlockRegion(&database.BlockRegion{
+			Key: key, Offset: 9995, Len: 10,
+		})
+		if !checkErrorCode(err, database.ErrBlockRegionInvalid) {
+			t.Errorf("FetchBlockRegion past the block: got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	filePath := blockFilePath(dbPath, 0)
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if byteOrder.Uint32(data[0:4]) != blockFileMagic ||
+		byteOrder.Uint32(data[4:8]) != blockFileVersion {
+
+		t.Fatalf("block file header %x", data[:8])
+	}
+	if len(data) != fileHeaderSize+recordHeaderSize+3*4+len(block)+4 {
+		t.Fatalf("block file length %d", len(data))
+	}
+
+	// Corrupt the last chunk, the regions of the other chunks can still be
+	// read.
+	dataOffset := fileHeaderSize + recordHeaderSize + 3*4
+	data[dataOffset+9000] ^= 0xff
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	idb, err = openDB(dbPath, common.DevelopNet, false, false)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	err = idb.View(func(tx database.Tx) error {
+		if _, err := tx.FetchBlockRegion(&regions[0]); err != nil {
+			t.Errorf("FetchBlockRegion of an intact chunk: %v", err)
+		}
+		_, err := tx.FetchBlockRegion(&regions[2])
+		if !checkErrorCode(err, database.ErrCorruption) {
+			t.Errorf("FetchBlockRegion of a corrupted chunk: got %v", err)
+		}
+		_, err = tx.FetchBlock(key)
+		if !checkErrorCode(err, database.ErrCorruption) {
+			t.Errorf("FetchBlock of a corrupted block: got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Zero the record header as a crash losing the data of the file would,
+	// which is detected when opening the database.
+	copy(data[fileHeaderSize:], make([]byte, recordHeaderSize))
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, err = openDB(dbPath, common.DevelopNet, false, false)
+	if !checkErrorCode(err, database.ErrCorruption) {
+		t.Fatalf("openDB with a torn record: got %v", err)
+	}
+}
+
+// TestBlockFileVersion1 ensures the blocks of the version 1 files are read,
+// the new blocks are appended to them in the version 1 format and the next
+// files use the version 2 format.
+func TestBlockFileVersion1(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "ffldb-v1")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	block := make([]byte, 100)
+	for i := range block {
+		block[i] = byte(i)
+	}
+	record := make([]byte, 8, 112)
+	byteOrder.PutUint32(record[0:4], uint32(common.DevelopNet))
+	byteOrder.PutUint32(record[4:8], uint32(len(block)))
+	record = append(record, block...)
+	var checksum [4]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.Checksum(record, castagnoli))
+	record = append(record, checksum[:]...)
+	err = ioutil.WriteFile(blockFilePath(dbPath, 0), record, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	store := newBlockStore(dbPath, common.DevelopNet)
+	store.maxBlockFileSize = 300
+	defer func() {
+		if store.writeCursor.curFile.file != nil {
+			store.writeCursor.curFile.file.Close()
+		}
+		for _, blockFile := range store.openBlockFiles {
+			blockFile.file.Close()
+		}
+	}()
+
+	key := database.NewNormalBlockKey(&common.Hash{1})
+	locs := []blockLocation{{blockFileNum: 0, fileOffset: 0, blockLen: 112}}
+	for i := 0; i < 2; i++ {
+		loc, err := store.writeBlock(block)
+		if err != nil {
+			t.Fatalf("writeBlock #%d: %v", i, err)
+		}
+		locs = append(locs, loc)
+	}
+	want := []blockLocation{
+		{blockFileNum: 0, fileOffset: 0, blockLen: 112},
+		{blockFileNum: 0, fileOffset: 112, blockLen: 112},
+		{blockFileNum: 1, fileOffset: fileHeaderSize, blockLen: 120},
+	}
+	for i, loc := range locs {
+		if loc != want[i] {
+			t.Errorf("location #%d: got %+v, want %+v", i, loc, want[i])
+		}
+		fetched, err := store.readBlock(key, loc)
+		if err != nil || !bytes.Equal(fetched, block) {
+			t.Errorf("readBlock #%d: mismatched block, err %v", i, err)
+		}
+		region, err := store.readBlockRegion(loc, 10, 5)
+		if err != nil || !bytes.Equal(region, block[10:15]) {
+			t.Errorf("readBlockRegion #%d: mismatched region, err %v", i, err)
+		}
+	}
+}
+
+// TestMmapBlockFiles ensures the block files which are no longer written are
+// memory mapped, and their mapping is closed before they are rolled back.
+func TestMmapBlockFiles(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("block files are not memory mapped on " + runtime.GOOS)
+	}
+	dbPath, err := ioutil.TempDir("", "ffldb-mmap")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	idb, err := openDB(dbPath, common.DevelopNet, true, false)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	defer idb.Close()
+
+	// Store every block in its own file.
+	store := idb.(*db).store
+	store.maxBlockFileSize = 150
+	keys := make([]database.BlockKey, 3)
+	for i := range keys {
+		keys[i] = *database.NewNormalBlockKey(&common.Hash{byte(i + 1)})
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(&keys[i], bytes.Repeat([]byte{byte(i)}, 88))
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock #%d: %v", i, err)
+		}
+	}
+
+	err = idb.View(func(tx database.Tx) error {
+		for i := range keys {
+			block, err := tx.FetchBlock(&keys[i])
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(block, bytes.Repeat([]byte{byte(i)}, 88)) {
+				t.Errorf("FetchBlock #%d: mismatched block", i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock: %v", err)
+	}
+	for i := uint32(0); i < 2; i++ {
+		blockFile, ok := store.openBlockFiles[i]
+		if !ok {
+			t.Fatalf("block file #%d is not open", i)
+		}
+		if _, ok := blockFile.file.(*mmapFile); !ok {
+			t.Errorf("block file #%d is not memory mapped", i)
+		}
+	}
+	if _, ok := store.openBlockFiles[2]; ok {
+		t.Errorf("the write file is open as read-only")
+	}
+
+	// Rolling back to the second file closes its mapping.
+	store.handleRollback(1, 116)
+	if _, ok := store.openBlockFiles[1]; ok {
+		t.Errorf("block file #1 is still open after the rollback")
+	}
+	if _, ok := store.openBlockFiles[0]; !ok {
+		t.Errorf("block file #0 was closed by the rollback")
+	}
+
+	mapped := &mmapFile{data: []byte("block"), unmap: func([]byte) error { return nil }}
+	b := make([]byte, 4)
+	if n, err := mapped.ReadAt(b, 3); n != 2 || err != io.EOF || string(b[:n]) != "ck" {
+		t.Errorf("ReadAt past the end: got %d, %v", n, err)
+	}
+}
+
+// TestOpenReadOnly ensures a database opened read-only serves its data but
+// refuses the write transactions.
+func TestOpenReadOnly(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "ffldb-readonly")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	idb, err := openDB(dbPath, common.DevelopNet, true, false)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	key := *database.NewNormalBlockKey(&common.Hash{0x01})
+	err = idb.Update(func(tx database.Tx) error {
+		if err := tx.Metadata().Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		return tx.StoreBlock(&key, make([]byte, 88))
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	idb, err = openDB(dbPath, common.DevelopNet, false, true)
+	if err != nil {
+		t.Fatalf("openDB read-only: %v", err)
+	}
+	defer idb.Close()
+	err = idb.View(func(tx database.Tx) error {
+		if value := tx.Metadata().Get([]byte("key")); string(value) != "value" {
+			t.Errorf("Get: got %q, want %q", value, "value")
+		}
+		_, err := tx.FetchBlock(&key)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	err = idb.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put([]byte("key"), []byte("other"))
+	})
+	if dbErr, ok := err.(database.Error); !ok ||
+		dbErr.ErrorCode != database.ErrTxNotWritable {
+
+		t.Errorf("Update of a read-only database: got %v", err)
+	}
+}
@@ -14,6 +14,10 @@ import (
 
 var ErrUnimplement  = errors.New("method is unimplement" )
 
+// ErrInterrupted is returned by long running operations such as Compact when
+// they were interrupted before completion.
+var ErrInterrupted = errors.New("operation interrupted")
+
 // ErrorCode identifies a kind of error.
 type ErrorCode int
 
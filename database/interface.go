@@ -102,6 +102,17 @@ type Database interface {
 	NewBatch() Batch
 }
 
+// Compacter is implemented by databases which are able to compact their
+// underlying key/value store in order to discard deleted and overwritten
+// entries.
+type Compacter interface {
+	// Compact compacts the whole underlying store.  The passed progress
+	// function, when not nil, is called with the number of completed and
+	// total key ranges after every compacted range.  ErrInterrupted is
+	// returned when the interrupt channel is closed before completion.
+	Compact(interrupt <-chan struct{}, progress func(done, total int)) error
+}
+
 // BlockRegion specifies a particular region of a block identified by the
 // specified key, given an offset and length.
 type BlockRegion struct {
@@ -293,6 +304,20 @@ type Tx interface {
 	// implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
 
+	// PruneBlocks deletes the oldest blocks, a block file at a time, while
+	// the stored blocks take more than targetSize bytes.  The block
+	// identified by keep and the blocks stored after it are never deleted.
+	// It returns the keys of the deleted blocks.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the block to keep does not exist
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// Other errors are possible depending on the implementation.
+	PruneBlocks(targetSize uint64, keep *BlockKey) ([]BlockKey, error)
+
 	// Metadata returns the top-most bucket for all metadata storage.
 	Metadata() Bucket
 
@@ -0,0 +1,380 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package deposits tracks the deposits paid to the addresses an operator
+// watches, such as the deposit addresses of an exchange, and reports every
+// change of their confirmation state.  A deposit is reported when it enters
+// the mempool, at each confirmation and once it reached the number of
+// confirmations required by its address, after which it is final and no longer
+// tracked.  A deposit whose block is disconnected is reported again as
+// unconfirmed, so the reorganizations are followed until finality.
+//
+// The watched addresses and the deposits being confirmed are persisted across
+// restarts.
+package deposits
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// MaxConfirmations is the maximum number of confirmations a watched address
+// may require.
+const MaxConfirmations = 1000
+
+// Status is the confirmation state of a deposit reported by an event.
+type Status string
+
+// These constants define the reported states of a deposit.
+const (
+	// StatusPending is reported when the deposit enters the mempool.
+	StatusPending Status = "pending"
+
+	// StatusConfirmed is reported at each confirmation of the deposit
+	// until the required confirmations.
+	StatusConfirmed Status = "confirmed"
+
+	// StatusFinal is reported once the deposit reached the required
+	// confirmations.  The deposit is no longer tracked afterwards.
+	StatusFinal Status = "final"
+
+	// StatusReorged is reported when the block of the deposit is
+	// disconnected, the deposit being unconfirmed again.
+	StatusReorged Status = "reorged"
+
+	// StatusDropped is reported when an unconfirmed deposit left the
+	// mempool without being confirmed, such as when it was double spent.
+	StatusDropped Status = "dropped"
+)
+
+// Watch is a watched address.
+type Watch struct {
+	Address       string `json:"address"`
+	Confirmations int32  `json:"confirmations"`
+	URL           string `json:"url"`
+}
+
+// Output is an output paying to an address, which is a deposit when the
+// address is watched.
+type Output struct {
+	TxID    string
+	Vout    uint32
+	Address string
+	Asset   string
+	Value   int64
+}
+
+// Deposit is a tracked deposit.  Height and BlockHash are zero while the
+// deposit is unconfirmed, and Confirmations is the last reported number of
+// confirmations.
+type Deposit struct {
+	TxID          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Address       string `json:"address"`
+	Asset         string `json:"asset"`
+	Value         int64  `json:"value"`
+	BlockHash     string `json:"blockhash,omitempty"`
+	Height        int32  `json:"height"`
+	Confirmations int32  `json:"confirmations"`
+}
+
+// Event reports a change of the state of a deposit to the callback URL of its
+// address.
+type Event struct {
+	URL      string
+	Status   Status
+	Deposit  Deposit
+	Required int32
+}
+
+// state is the persisted state of a tracker.
+type state struct {
+	Watches  map[string]*Watch   `json:"watches"`
+	Deposits map[string]*Deposit `json:"deposits"`
+}
+
+// Tracker tracks the deposits of the watched addresses.
+//
+// All methods are safe for concurrent access.
+type Tracker struct {
+	mtx      sync.Mutex
+	file     string
+	watches  map[string]*Watch
+	deposits map[string]*Deposit
+}
+
+// New returns a tracker watching no address persisted to the passed file.
+func New(file string) *Tracker {
+	return &Tracker{
+		file:     file,
+		watches:  make(map[string]*Watch),
+		deposits: make(map[string]*Deposit),
+	}
+}
+
+// outpointKey returns the key of the deposit of an output.
+func outpointKey(txID string, vout uint32) string {
+	return fmt.Sprintf("%s:%d", txID, vout)
+}
+
+// Load loads the watched addresses and the tracked deposits from the file of
+// the tracker.  A missing file is not an error.
+func (t *Tracker) Load() error {
+	data, err := ioutil.ReadFile(t.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	if st.Watches == nil {
+		st.Watches = make(map[string]*Watch)
+	}
+	if st.Deposits == nil {
+		st.Deposits = make(map[string]*Deposit)
+	}
+	t.mtx.Lock()
+	t.watches, t.deposits = st.Watches, st.Deposits
+	t.mtx.Unlock()
+	return nil
+}
+
+// Save writes the watched addresses and the tracked deposits to the file of the
+// tracker.  The file is written under a temporary name and renamed once
+// complete.
+func (t *Tracker) Save() error {
+	t.mtx.Lock()
+	data, err := json.Marshal(&state{Watches: t.watches, Deposits: t.deposits})
+	t.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := t.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.file)
+}
+
+// Watch starts watching an address, or updates the required confirmations and
+// the callback URL of a watched address.
+func (t *Tracker) Watch(w Watch) error {
+	if w.Confirmations < 1 || w.Confirmations > MaxConfirmations {
+		return fmt.Errorf("confirmations must be between 1 and %d",
+			MaxConfirmations)
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback URL %q", w.URL)
+	}
+
+	t.mtx.Lock()
+	t.watches[w.Address] = &w
+	t.mtx.Unlock()
+	return nil
+}
+
+// Unwatch stops watching an address and forgets its deposits.  It returns
+// false when the address is not watched.
+func (t *Tracker) Unwatch(address string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if _, ok := t.watches[address]; !ok {
+		return false
+	}
+	delete(t.watches, address)
+	for key, d := range t.deposits {
+		if d.Address == address {
+			delete(t.deposits, key)
+		}
+	}
+	return true
+}
+
+// Watching returns whether any address is watched.
+func (t *Tracker) Watching() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return len(t.watches) > 0
+}
+
+// Watched returns whether an address is watched.
+func (t *Tracker) Watched(address string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	_, ok := t.watches[address]
+	return ok
+}
+
+// Watches returns the watched addresses sorted by address.
+func (t *Tracker) Watches() []Watch {
+	t.mtx.Lock()
+	watches := make([]Watch, 0, len(t.watches))
+	for _, w := range t.watches {
+		watches = append(watches, *w)
+	}
+	t.mtx.Unlock()
+
+	sort.Slice(watches, func(i, j int) bool {
+		return watches[i].Address < watches[j].Address
+	})
+	return watches
+}
+
+// Deposits returns the tracked deposits, the unconfirmed ones first and the
+// others from the oldest to the newest.
+func (t *Tracker) Deposits() []Deposit {
+	t.mtx.Lock()
+	deposits := make([]Deposit, 0, len(t.deposits))
+	for _, d := range t.deposits {
+		deposits = append(deposits, *d)
+	}
+	t.mtx.Unlock()
+
+	sort.Slice(deposits, func(i, j int) bool {
+		a, b := &deposits[i], &deposits[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.TxID != b.TxID {
+			return a.TxID < b.TxID
+		}
+		return a.Vout < b.Vout
+	})
+	return deposits
+}
+
+// event returns the event reporting the current state of a deposit.  The
+// tracker must be locked.
+func (t *Tracker) event(status Status, d *Deposit) Event {
+	w := t.watches[d.Address]
+	return Event{URL: w.URL, Status: status, Deposit: *d, Required: w.Confirmations}
+}
+
+// AddPending tracks the outputs of a transaction accepted to the mempool
+// paying to the watched addresses, and returns their pending events.  The
+// outputs already tracked are skipped.
+func (t *Tracker) AddPending(outs []Output) []Event {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var events []Event
+	for _, out := range outs {
+		key := outpointKey(out.TxID, out.Vout)
+		if _, ok := t.watches[out.Address]; !ok {
+			continue
+		}
+		if _, ok := t.deposits[key]; ok {
+			continue
+		}
+		d := &Deposit{
+			TxID:    out.TxID,
+			Vout:    out.Vout,
+			Address: out.Address,
+			Asset:   out.Asset,
+			Value:   out.Value,
+		}
+		t.deposits[key] = d
+		events = append(events, t.event(StatusPending, d))
+	}
+	return events
+}
+
+// ConnectBlock confirms the outputs of a connected block paying to the watched
+// addresses, and returns the events of every confirmation the tracked deposits
+// gained.  The deposits reaching the required confirmations are reported final
+// and no longer tracked.  The unconfirmed deposits for which inMempool returns
+// false are reported dropped.
+func (t *Tracker) ConnectBlock(hash string, height int32, outs []Output,
+	inMempool func(txID string) bool) []Event {
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, out := range outs {
+		if _, ok := t.watches[out.Address]; !ok {
+			continue
+		}
+		key := outpointKey(out.TxID, out.Vout)
+		d, ok := t.deposits[key]
+		if !ok {
+			d = &Deposit{
+				TxID:    out.TxID,
+				Vout:    out.Vout,
+				Address: out.Address,
+				Asset:   out.Asset,
+				Value:   out.Value,
+			}
+			t.deposits[key] = d
+		}
+		d.BlockHash, d.Height = hash, height
+	}
+
+	var events []Event
+	for _, key := range t.sortedKeys() {
+		d := t.deposits[key]
+		if d.Height == 0 {
+			if inMempool != nil && !inMempool(d.TxID) {
+				events = append(events, t.event(StatusDropped, d))
+				delete(t.deposits, key)
+			}
+			continue
+		}
+		required := t.watches[d.Address].Confirmations
+		confirmations := height - d.Height + 1
+		if confirmations > required {
+			confirmations = required
+		}
+		for d.Confirmations < confirmations {
+			d.Confirmations++
+			events = append(events, t.event(StatusConfirmed, d))
+		}
+		if d.Confirmations >= required {
+			events = append(events, t.event(StatusFinal, d))
+			delete(t.deposits, key)
+		}
+	}
+	return events
+}
+
+// DisconnectBlock returns the deposits confirmed by a disconnected block to
+// the unconfirmed state, and returns their reorged events.
+func (t *Tracker) DisconnectBlock(hash string) []Event {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var events []Event
+	for _, key := range t.sortedKeys() {
+		d := t.deposits[key]
+		if d.BlockHash != hash {
+			continue
+		}
+		d.BlockHash, d.Height, d.Confirmations = "", 0, 0
+		events = append(events, t.event(StatusReorged, d))
+	}
+	return events
+}
+
+// sortedKeys returns the keys of the tracked deposits in order, so the events
+// are returned in a deterministic order.  The tracker must be locked.
+func (t *Tracker) sortedKeys() []string {
+	keys := make([]string, 0, len(t.deposits))
+	for key := range t.deposits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
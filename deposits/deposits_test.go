@@ -0,0 +1,112 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package deposits
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// statuses returns the statuses and confirmations of the events.
+func statuses(events []Event) []string {
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s:%d", e.Status, e.Deposit.Confirmations))
+	}
+	return got
+}
+
+// TestTracker ensures the deposits are reported at 0-conf, at each
+// confirmation and at finality, and are followed across reorganizations.
+func TestTracker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deposits")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "deposits.json")
+
+	tracker := New(file)
+	if err := tracker.Load(); err != nil {
+		t.Fatalf("Load of a missing file: %v", err)
+	}
+	if err := tracker.Watch(Watch{Address: "a", Confirmations: 0, URL: "http://x"}); err == nil {
+		t.Fatal("Watch: accepted 0 confirmations")
+	}
+	if err := tracker.Watch(Watch{Address: "a", Confirmations: 3, URL: "ftp://x"}); err == nil {
+		t.Fatal("Watch: accepted an ftp URL")
+	}
+	if err := tracker.Watch(Watch{Address: "a", Confirmations: 3, URL: "http://x"}); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	deposit := Output{TxID: "t1", Vout: 0, Address: "a", Asset: "00", Value: 5}
+	other := Output{TxID: "t1", Vout: 1, Address: "b", Asset: "00", Value: 7}
+	events := tracker.AddPending([]Output{deposit, other})
+	if got := statuses(events); !reflect.DeepEqual(got, []string{"pending:0"}) {
+		t.Fatalf("AddPending: got %v", got)
+	}
+	if events[0].URL != "http://x" || events[0].Required != 3 {
+		t.Fatalf("AddPending: got event %+v", events[0])
+	}
+	if events := tracker.AddPending([]Output{deposit}); len(events) != 0 {
+		t.Fatalf("AddPending: reported a tracked deposit again")
+	}
+
+	inMempool := func(string) bool { return true }
+	events = tracker.ConnectBlock("b10", 10, []Output{deposit}, inMempool)
+	if got := statuses(events); !reflect.DeepEqual(got, []string{"confirmed:1"}) {
+		t.Fatalf("ConnectBlock: got %v", got)
+	}
+
+	// The deposit is unconfirmed again when its block is disconnected, and
+	// the tracking survives a restart.
+	events = tracker.DisconnectBlock("b10")
+	if got := statuses(events); !reflect.DeepEqual(got, []string{"reorged:0"}) {
+		t.Fatalf("DisconnectBlock: got %v", got)
+	}
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	tracker = New(file)
+	if err := tracker.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Skipping blocks reports every confirmation in between.
+	tracker.ConnectBlock("c10", 10, nil, inMempool)
+	events = tracker.ConnectBlock("c11", 11, []Output{deposit}, inMempool)
+	if got := statuses(events); !reflect.DeepEqual(got, []string{"confirmed:1"}) {
+		t.Fatalf("ConnectBlock: got %v", got)
+	}
+	events = tracker.ConnectBlock("c14", 14, nil, inMempool)
+	want := []string{"confirmed:2", "confirmed:3", "final:3"}
+	if got := statuses(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ConnectBlock: got %v, want %v", got, want)
+	}
+	if deposits := tracker.Deposits(); len(deposits) != 0 {
+		t.Fatalf("final deposit still tracked: %v", deposits)
+	}
+
+	// An unconfirmed deposit leaving the mempool is dropped.
+	tracker.AddPending([]Output{{TxID: "t2", Address: "a"}})
+	events = tracker.ConnectBlock("c15", 15, nil, func(string) bool { return false })
+	if got := statuses(events); !reflect.DeepEqual(got, []string{"dropped:0"}) {
+		t.Fatalf("ConnectBlock: got %v", got)
+	}
+
+	// Unwatching an address forgets its deposits.
+	tracker.AddPending([]Output{{TxID: "t3", Address: "a"}})
+	if !tracker.Unwatch("a") || tracker.Unwatch("a") {
+		t.Fatal("Unwatch: unexpected result")
+	}
+	if tracker.Watching() || len(tracker.Deposits()) != 0 {
+		t.Fatal("Unwatch: address or deposits still tracked")
+	}
+}
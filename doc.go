@@ -42,6 +42,12 @@ Application Options:
                             are {s, m, h}.  Minimum 1 second (24h0m0s)
       --banthreshold=       Maximum allowed ban score before disconnecting and
                             banning misbehaving peers.
+      --misbehaviorwindow=  How long the ban scores of the past connections of a
+                            host add up, so a misbehaving peer is banned after
+                            reconnecting several times (1h0m0s)
+      --dnsseed=            Query this DNS seed for peers instead of the seeds of
+                            the network, followed by /filter when it supports
+                            filtering by services in a subdomain
       --whitelist=          Add an IP network or IP that will not be banned.
                             (eg. 192.168.1.0/24 or ::1)
   -u, --rpcuser=            Username for RPC connections
@@ -71,6 +77,10 @@ Application Options:
       --noonion             Disable connecting to tor hidden services
       --torisolation        Enable Tor stream isolation by randomizing user
                             credentials for each connection.
+      --torcontrol=         Tor control port used to create an onion service
+                            for the incoming connections (eg. 127.0.0.1:9051)
+      --torpassword=        Password of the Tor control port -- the cookie file
+                            announced by Tor is used when not set
       --testnet             Use the test network
       --regtest             Use the regression test network
       --simnet              Use the simulation test network
@@ -79,6 +89,9 @@ Application Options:
                             you know what you're doing.
       --uacomment=          Comment to add to the user agent --
                             See BIP 14 for more information.
+      --handshakemeta=      Add a key=value metadata entry, such as
+                            region=eu or role=validator, sent to the peers in
+                            the version message
       --dbtype=             Database backend to use for the Block Chain (ffldb)
       --profile=            Enable HTTP profiling on given port -- NOTE port
                             must be between 1024 and 65536
@@ -93,7 +106,17 @@ Application Options:
                             (100)
       --nopeerbloomfilters  Disable bloom filtering support.
       --nocfilters          Disable committed filtering (CF) support.
+      --noinvclasses        Disable the asset issuance and contract event
+                            inventory classes.
+      --invwatchcontract=   Add a contract whose events are announced to the
+                            peers subscribed to the contract event inventory
+                            class
       --blocksonly          Do not accept transactions from remote peers.
+      --historicalservelimit= Max megabytes of historical blocks served per
+                            day to each peer, whitelisted peers and validators
+                            excepted (0 for no limit)
+      --historicaldepth=    Number of blocks below the best block from which
+                            the blocks are historical (120960)
 
 
 Help Options:
@@ -0,0 +1,335 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package feeestimator estimates the gas price a transaction must pay to be
+// confirmed within a number of blocks.
+//
+// The transactions entering the mempool are tracked along with their gas
+// price, which falls in one of a series of exponentially spaced buckets.  When
+// a block confirms a tracked transaction, the number of blocks it waited is
+// recorded for its bucket.  A transaction still unconfirmed after a number of
+// blocks counts as a failure for the targets it missed.  The statistics decay
+// with every block so the estimates follow the recent conditions.
+//
+// The estimate for a target is the average gas price of the lowest range of
+// buckets whose transactions, and those of all the buckets above, were
+// confirmed within the target often enough.
+package feeestimator
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+const (
+	// MaxTarget is the highest confirmation target, in blocks, which may
+	// be estimated.  A transaction unconfirmed after MaxTarget blocks is
+	// no longer tracked.
+	MaxTarget = 48
+
+	// minBucketPrice is the upper bound of the lowest gas price bucket,
+	// and bucketSpacing the ratio between the bounds of two consecutive
+	// buckets.
+	minBucketPrice = 0.01
+	bucketSpacing  = 1.1
+
+	// maxBucketPrice is the upper bound of the highest bucket but one.
+	// The highest bucket holds the higher gas prices.
+	maxBucketPrice = 1e4
+
+	// decay is the factor applied to the statistics with every block.  A
+	// transaction weighs half as much after about 140 blocks.
+	decay = 0.995
+
+	// sufficientTxs is the decayed number of transactions a range of
+	// buckets must hold for its success rate to be meaningful.
+	sufficientTxs = 10
+
+	// ConservativeThreshold and EconomicalThreshold are the success rates
+	// a range of buckets must reach within the target for its gas price to
+	// be an estimate.
+	ConservativeThreshold = 0.95
+	EconomicalThreshold   = 0.85
+)
+
+// ErrInsufficientData is returned when too few transactions were tracked to
+// estimate the gas price for a target.
+var ErrInsufficientData = errors.New("insufficient data to estimate the gas price")
+
+// bucketBounds are the upper bounds of the gas price buckets but the
+// highest, which holds the higher gas prices.
+var bucketBounds = func() []float64 {
+	var bounds []float64
+	for price := minBucketPrice; price < maxBucketPrice; price *= bucketSpacing {
+		bounds = append(bounds, price)
+	}
+	return bounds
+}()
+
+// numBuckets is the number of gas price buckets.
+var numBuckets = len(bucketBounds) + 1
+
+// bucket returns the bucket of a gas price.
+func bucket(gasPrice float64) int {
+	return sort.SearchFloat64s(bucketBounds, gasPrice)
+}
+
+// trackedTx is a transaction of the mempool waiting to be confirmed.
+type trackedTx struct {
+	height   int32
+	gasPrice float64
+}
+
+// stats is the persisted state of the estimator.  Bounds records the bucket
+// bounds the statistics were collected with.  Confirmed[t][b] is the decayed
+// number of transactions of bucket b confirmed within t+1 blocks, and
+// Failed[b] the number which stopped being tracked unconfirmed, having missed
+// every target.  TxCount and PriceSum are the decayed number and sum of gas
+// prices of the confirmed transactions of every bucket.
+type stats struct {
+	Bounds    []float64   `json:"bounds"`
+	TxCount   []float64   `json:"txcount"`
+	PriceSum  []float64   `json:"pricesum"`
+	Confirmed [][]float64 `json:"confirmed"`
+	Failed    []float64   `json:"failed"`
+}
+
+// newStats returns empty statistics.
+func newStats() *stats {
+	s := &stats{
+		Bounds:    bucketBounds,
+		TxCount:   make([]float64, numBuckets),
+		PriceSum:  make([]float64, numBuckets),
+		Confirmed: make([][]float64, MaxTarget),
+		Failed:    make([]float64, numBuckets),
+	}
+	for t := range s.Confirmed {
+		s.Confirmed[t] = make([]float64, numBuckets)
+	}
+	return s
+}
+
+// valid returns whether loaded statistics were collected with the current
+// buckets and targets.
+func (s *stats) valid() bool {
+	if !reflect.DeepEqual(s.Bounds, bucketBounds) || len(s.TxCount) != numBuckets ||
+		len(s.PriceSum) != numBuckets || len(s.Failed) != numBuckets ||
+		len(s.Confirmed) != MaxTarget {
+		return false
+	}
+	for _, confirmed := range s.Confirmed {
+		if len(confirmed) != numBuckets {
+			return false
+		}
+	}
+	return true
+}
+
+// Estimator estimates the gas price of the transactions from the confirmation
+// delays of the transactions of the mempool.
+//
+// All methods are safe for concurrent access.
+type Estimator struct {
+	mtx        sync.Mutex
+	file       string
+	stats      *stats
+	tracked    map[common.Hash]trackedTx
+	bestHeight int32
+}
+
+// New returns an estimator with empty statistics, persisted to the passed
+// file or not persisted when the file is empty.
+func New(file string) *Estimator {
+	return &Estimator{
+		file:    file,
+		stats:   newStats(),
+		tracked: make(map[common.Hash]trackedTx),
+	}
+}
+
+// Load loads the statistics from the file of the estimator.  A missing file,
+// or a file written with other buckets, is not an error and leaves the
+// statistics empty.
+func (e *Estimator) Load() error {
+	if e.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(e.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var s stats
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if !s.valid() {
+		return nil
+	}
+
+	e.mtx.Lock()
+	e.stats = &s
+	e.mtx.Unlock()
+	return nil
+}
+
+// Save writes the statistics to the file of the estimator.  The file is
+// written under a temporary name and renamed once complete.  It does nothing
+// when the statistics are not persisted.
+func (e *Estimator) Save() error {
+	if e.file == "" {
+		return nil
+	}
+	e.mtx.Lock()
+	data, err := json.Marshal(e.stats)
+	e.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := e.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.file)
+}
+
+// ObserveTransaction starts tracking a transaction accepted to the mempool
+// while the best height of the chain is the passed height.
+func (e *Estimator) ObserveTransaction(hash common.Hash, gasPrice float64, height int32) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if _, ok := e.tracked[hash]; ok {
+		return
+	}
+	e.tracked[hash] = trackedTx{
+		height:   height,
+		gasPrice: gasPrice,
+	}
+}
+
+// RegisterBlock records the confirmation of the tracked transactions of a
+// block connected at the passed height, and stops tracking the transactions
+// which missed every target.
+func (e *Estimator) RegisterBlock(height int32, hashes []common.Hash) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	s := e.stats
+	for b := 0; b < numBuckets; b++ {
+		s.TxCount[b] *= decay
+		s.PriceSum[b] *= decay
+		s.Failed[b] *= decay
+		for t := range s.Confirmed {
+			s.Confirmed[t][b] *= decay
+		}
+	}
+
+	for _, hash := range hashes {
+		tx, ok := e.tracked[hash]
+		if !ok {
+			continue
+		}
+		delete(e.tracked, hash)
+
+		blocks := int(height - tx.height)
+		if blocks < 1 {
+			blocks = 1
+		}
+		b := bucket(tx.gasPrice)
+		for t := blocks - 1; t < MaxTarget; t++ {
+			s.Confirmed[t][b]++
+		}
+		s.TxCount[b]++
+		s.PriceSum[b] += tx.gasPrice
+	}
+
+	for hash, tx := range e.tracked {
+		if height-tx.height >= MaxTarget {
+			s.Failed[bucket(tx.gasPrice)]++
+			delete(e.tracked, hash)
+		}
+	}
+	e.bestHeight = height
+}
+
+// estimate returns the estimate for a target and success rate.
+//
+// This function MUST be called with the estimator lock held.
+func (e *Estimator) estimate(target int, threshold float64) (float64, error) {
+	s := e.stats
+	t := target - 1
+
+	// The tracked transactions which already waited target blocks missed
+	// the target.
+	pending := make([]float64, numBuckets)
+	for _, tx := range e.tracked {
+		if int(e.bestHeight-tx.height) >= target {
+			pending[bucket(tx.gasPrice)]++
+		}
+	}
+
+	estimate := -1.0
+	var confirmed, total, priceSum, count float64
+	for b := numBuckets - 1; b >= 0; b-- {
+		confirmed += s.Confirmed[t][b]
+		total += s.TxCount[b] + s.Failed[b] + pending[b]
+		priceSum += s.PriceSum[b]
+		count += s.TxCount[b]
+		if total < sufficientTxs {
+			continue
+		}
+		if confirmed/total < threshold {
+			break
+		}
+		if count > 0 {
+			estimate = priceSum / count
+		}
+		confirmed, total, priceSum, count = 0, 0, 0, 0
+	}
+	if estimate < 0 {
+		return 0, ErrInsufficientData
+	}
+	return estimate, nil
+}
+
+// Estimate returns the gas price confirming a transaction within target
+// blocks with the passed success rate, such as ConservativeThreshold.
+func (e *Estimator) Estimate(target int, threshold float64) (float64, error) {
+	if target < 1 || target > MaxTarget {
+		return 0, errors.New("target out of range")
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.estimate(target, threshold)
+}
+
+// EstimateSmart returns the gas price confirming a transaction within target
+// blocks with the passed success rate.  When there is not enough data for the
+// target, it returns the estimate of the closest higher target which has
+// enough.  It returns the target of the estimate as well.
+func (e *Estimator) EstimateSmart(target int, threshold float64) (float64, int, error) {
+	if target < 1 || target > MaxTarget {
+		return 0, 0, errors.New("target out of range")
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for ; target <= MaxTarget; target++ {
+		if estimate, err := e.estimate(target, threshold); err == nil {
+			return estimate, target, nil
+		}
+	}
+	return 0, 0, ErrInsufficientData
+}
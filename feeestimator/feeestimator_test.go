@@ -0,0 +1,82 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package feeestimator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestEstimator ensures the estimates follow the confirmation delays of the
+// gas prices and are persisted across restarts.
+func TestEstimator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feeestimator")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "feeestimates.json")
+
+	e := New(file)
+	if err := e.Load(); err != nil {
+		t.Fatalf("Load of a missing file: %v", err)
+	}
+	if _, err := e.Estimate(1, ConservativeThreshold); err != ErrInsufficientData {
+		t.Fatalf("Estimate without data: got %v", err)
+	}
+	if _, err := e.Estimate(MaxTarget+1, ConservativeThreshold); err == nil {
+		t.Fatal("Estimate: accepted a target out of range")
+	}
+
+	// Every block, a transaction paying 1 is confirmed in the next block
+	// and one paying 0.1 is confirmed after 5 blocks.
+	var n uint32
+	newHash := func() common.Hash {
+		n++
+		return common.Hash{byte(n), byte(n >> 8)}
+	}
+	slow := make(map[int32]common.Hash)
+	for height := int32(1); height <= 100; height++ {
+		fast := newHash()
+		e.ObserveTransaction(fast, 1, height-1)
+		slow[height] = newHash()
+		e.ObserveTransaction(slow[height], 0.1, height-1)
+
+		confirmed := []common.Hash{fast}
+		if hash, ok := slow[height-4]; ok {
+			confirmed = append(confirmed, hash)
+		}
+		e.RegisterBlock(height, confirmed)
+	}
+
+	estimate, err := e.Estimate(1, ConservativeThreshold)
+	if err != nil || estimate < 0.9 || estimate > 1.1 {
+		t.Fatalf("Estimate(1): got %v, %v", estimate, err)
+	}
+	estimate, err = e.Estimate(5, ConservativeThreshold)
+	if err != nil || estimate < 0.09 || estimate > 0.11 {
+		t.Fatalf("Estimate(5): got %v, %v", estimate, err)
+	}
+	estimate, target, err := e.EstimateSmart(3, EconomicalThreshold)
+	if err != nil || target != 3 || estimate < 0.9 || estimate > 1.1 {
+		t.Fatalf("EstimateSmart(3): got %v, %v, %v", estimate, target, err)
+	}
+
+	if err := e.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	e = New(file)
+	if err := e.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	estimate, err = e.Estimate(5, ConservativeThreshold)
+	if err != nil || estimate < 0.09 || estimate > 0.11 {
+		t.Fatalf("Estimate(5) after Load: got %v, %v", estimate, err)
+	}
+}
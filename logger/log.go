@@ -64,6 +64,11 @@ var (
 	contLog  = backendLog.Logger("CONT")
 	nodeLog  = backendLog.Logger("NODE")
 	contractLog = backendLog.Logger("CNTR")
+	hookLog  = backendLog.Logger("HOOK")
+	alrtLog  = backendLog.Logger("ALRT")
+	replLog  = backendLog.Logger("REPL")
+	spvrLog  = backendLog.Logger("SPVR")
+	tracLog  = backendLog.Logger("TRAC")
 )
 
 // Initialize package-global logger variables.
@@ -93,6 +98,11 @@ var subsystemLoggers = map[string]Logger{
 	"CONT":     contLog,
 	"NODE":     nodeLog,
 	"CNTR":     contractLog,
+	"HOOK":     hookLog,
+	"ALRT":     alrtLog,
+	"REPL":     replLog,
+	"SPVR":     spvrLog,
+	"TRAC":     tracLog,
 }
 
 func GetLog() Logger {
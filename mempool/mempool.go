@@ -17,8 +17,10 @@ import (
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/blockchain/indexers"
+	"github.com/AsimovNetwork/asimov/chaincfg"
 	"github.com/AsimovNetwork/asimov/mining"
 	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/tracing"
 	"github.com/AsimovNetwork/asimov/txscript"
 )
 
@@ -75,6 +77,12 @@ type Config struct {
 	// This can be nil if the address index is not enabled.
 	AddrIndex *indexers.AddrIndex
 
+	// SigCache defines a signature cache to use when validating the
+	// scripts of the transactions, so their signatures aren't verified
+	// again when they are included in a block.
+	// This can be nil if the signature cache is disabled.
+	SigCache *txscript.SigCache
+
 	Chain *blockchain.BlockChain
 
 	FeesChan chan interface{}
@@ -100,6 +108,11 @@ type Policy struct {
 	// of big orphans.
 	MaxOrphanTxSize int
 
+	// MaxOrphanPoolSize is the maximum total size of the orphan
+	// transactions.  Orphans are evicted when adding a new one would
+	// exceed it.  It is not enforced when not positive.
+	MaxOrphanPoolSize int
+
 	// MinTxPrice defines the minimum transaction price to be
 	// considered a non-zero fee.
 	MinRelayTxPrice float64
@@ -108,6 +121,11 @@ type Policy struct {
 	// transactions using the Replace-By-Price (RBP) signaling policy into
 	// the mempool.
 	RejectReplacement bool
+
+	// ReplacementBump is the minimum percentage by which the gas price of
+	// a replacement transaction must exceed the gas price of each of the
+	// transactions it replaces.
+	ReplacementBump float64
 }
 
 // orphanTx is normal transaction that references an ancestor transaction
@@ -116,6 +134,7 @@ type Policy struct {
 type orphanTx struct {
 	tx         *asiutil.Tx
 	tag        Tag
+	size       int
 	expiration time.Time
 }
 
@@ -131,6 +150,7 @@ type TxPool struct {
 	pool          map[common.Hash]*mining.TxDesc
 	orphans       map[common.Hash]*orphanTx
 	orphansByPrev map[protos.OutPoint]map[common.Hash]*asiutil.Tx
+	orphanBytes   int // total serialized size of the orphans
 	outpoints     map[protos.OutPoint]*asiutil.Tx
 	forbiddenTxs  map[common.Hash]int64
 	forbiddenList []common.Hash
@@ -188,6 +208,7 @@ func (mp *TxPool) removeOrphan(tx *asiutil.Tx, removeRedeemers bool) {
 
 	// Remove the transaction from the orphan pool.
 	delete(mp.orphans, *txHash)
+	mp.orphanBytes -= otx.size
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -217,11 +238,12 @@ func (mp *TxPool) RemoveOrphansByTag(tag Tag) uint64 {
 	return numEvicted
 }
 
-// limitNumOrphans limits the number of orphan transactions by evicting a random
-// orphan if adding a new one would cause it to overflow the max allowed.
+// limitNumOrphans limits the number and the total size of orphan transactions
+// by evicting random orphans if adding a new one of the passed size would
+// cause it to overflow the max allowed.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) limitNumOrphans() error {
+func (mp *TxPool) limitNumOrphans(size int) error {
 	// Scan through the orphan pool and remove any expired orphans when it's
 	// time.  This is done for efficiency so the scan only happens
 	// periodically instead of on every orphan added to the pool.
@@ -248,23 +270,23 @@ func (mp *TxPool) limitNumOrphans() error {
 		}
 	}
 
-	// Nothing to do if adding another orphan will not cause the pool to
-	// exceed the limit.
-	if len(mp.orphans)+1 <= mp.cfg.Policy.MaxOrphanTxs {
-		return nil
-	}
-
-	// Remove a random entry from the map.  For most compilers, Go's
+	// Remove random entries from the map until adding another orphan will
+	// not cause the pool to exceed the limits.  For most compilers, Go's
 	// range statement iterates starting at a random item although
 	// that is not 100% guaranteed by the spec.  The iteration order
 	// is not important here because an adversary would have to be
 	// able to pull off preimage attacks on the hashing function in
 	// order to target eviction of specific entries anyways.
+	maxBytes := mp.cfg.Policy.MaxOrphanPoolSize
 	for _, otx := range mp.orphans {
+		if len(mp.orphans)+1 <= mp.cfg.Policy.MaxOrphanTxs &&
+			(maxBytes <= 0 || mp.orphanBytes+size <= maxBytes) {
+			break
+		}
+
 		// Don't remove redeemers in the case of a random eviction since
 		// it is quite possible it might be needed again shortly.
 		mp.removeOrphan(otx.tx, false)
-		break
 	}
 
 	return nil
@@ -279,16 +301,19 @@ func (mp *TxPool) addOrphan(tx *asiutil.Tx, tag Tag) {
 		return
 	}
 
-	// Limit the number orphan transactions to prevent memory exhaustion.
-	// This will periodically remove any expired orphans and evict a random
-	// orphan if space is still needed.
-	mp.limitNumOrphans()
+	// Limit the number and size of orphan transactions to prevent memory
+	// exhaustion.  This will periodically remove any expired orphans and
+	// evict random orphans if space is still needed.
+	size := tx.MsgTx().SerializeSize()
+	mp.limitNumOrphans(size)
 
 	mp.orphans[*tx.Hash()] = &orphanTx{
 		tx:         tx,
 		tag:        tag,
+		size:       size,
 		expiration: time.Now().Add(orphanTTL),
 	}
+	mp.orphanBytes += size
 	for _, txIn := range tx.MsgTx().TxIn {
 		if _, exists := mp.orphansByPrev[txIn.PreviousOutPoint]; !exists {
 			mp.orphansByPrev[txIn.PreviousOutPoint] =
@@ -297,8 +322,8 @@ func (mp *TxPool) addOrphan(tx *asiutil.Tx, tag Tag) {
 		mp.orphansByPrev[txIn.PreviousOutPoint][*tx.Hash()] = tx
 	}
 
-	log.Debugf("Stored orphan transaction %v (total: %d)", tx.Hash(),
-		len(mp.orphans))
+	log.Debugf("Stored orphan transaction %v (total: %d, %d bytes)",
+		tx.Hash(), len(mp.orphans), mp.orphanBytes)
 }
 
 // maybeAddOrphan potentially adds an orphan to the orphan pool.
@@ -311,10 +336,10 @@ func (mp *TxPool) maybeAddOrphan(tx *asiutil.Tx, tag Tag) error {
 	// it will ultimtely be rebroadcast after the parent transactions
 	// have been mined or otherwise received.
 	//
-	// Note that the number of orphan transactions in the orphan pool is
-	// also limited, so this equates to a maximum memory used of
-	// mp.cfg.Policy.MaxOrphanTxSize * mp.cfg.Policy.MaxOrphanTxs (which is ~5MB
-	// using the default values at the time this comment was written).
+	// Note that the number and the total size of the orphan transactions
+	// in the orphan pool are also limited, so this equates to a maximum
+	// memory used of the lesser of mp.cfg.Policy.MaxOrphanPoolSize and
+	// mp.cfg.Policy.MaxOrphanTxSize * mp.cfg.Policy.MaxOrphanTxs.
 	serializedLen := tx.MsgTx().SerializeSize()
 	if serializedLen > mp.cfg.Policy.MaxOrphanTxSize {
 		str := fmt.Sprintf("orphan transaction size of %d bytes is "+
@@ -596,6 +621,18 @@ func (mp *TxPool) fetchInputUtxos(tx *asiutil.Tx) (*txo.UtxoViewpoint, error) {
 	return utxoView, nil
 }
 
+// FetchInputUtxos loads utxo details about the input transactions referenced
+// by the passed transaction, from the main chain and then from the
+// transaction pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchInputUtxos(tx *asiutil.Tx) (*txo.UtxoViewpoint, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	return mp.fetchInputUtxos(tx)
+}
+
 // FetchTransaction returns the requested transaction from the transaction pool.
 // This only fetches from the main transaction pool and does not include
 // orphans.
@@ -785,7 +822,14 @@ func (mp *TxPool) validateReplacement(tx *asiutil.Tx,
 			str := fmt.Sprintf("replacement transaction %v has an "+
 				"insufficient gasPrice: needs more than %v, has %v",
 				hash, mp.pool[hash].GasPrice, gasPrice)
-			return nil, txRuleError(protos.RejectDuplicate, str)
+			return nil, txRuleError(protos.RejectInsufficientFee, str)
+		}
+		minGasPrice := mp.pool[hash].GasPrice * (1 + mp.cfg.Policy.ReplacementBump/100)
+		if !isForbidden && gasPrice < minGasPrice {
+			str := fmt.Sprintf("replacement transaction %v has an "+
+				"insufficient gasPrice bump: needs at least %v, has %v",
+				hash, minGasPrice, gasPrice)
+			return nil, txRuleError(protos.RejectInsufficientFee, str)
 		}
 		// We'll track each conflict's parents to ensure the replacement
 		// isn't spending any new unconfirmed inputs.
@@ -812,10 +856,13 @@ func (mp *TxPool) validateReplacement(tx *asiutil.Tx,
 
 // maybeAcceptTransaction is the internal function which implements the public
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// more details.  The transaction is rejected when its gas price is below
+// minGasPrice, which is the minimum relay price unless the transaction belongs
+// to a package whose gas price is checked as a whole.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *asiutil.Tx, isNew, rejectDupOrphans bool) ([]*common.Hash, *mining.TxDesc, error) {
+func (mp *TxPool) maybeAcceptTransaction(tx *asiutil.Tx, isNew, rejectDupOrphans bool,
+	minGasPrice float64) ([]*common.Hash, *mining.TxDesc, error) {
 	txHash := tx.Hash()
 
 	// Don't accept the transaction if it already exists in the pool.  This
@@ -851,12 +898,35 @@ func (mp *TxPool) maybeAcceptTransaction(tx *asiutil.Tx, isNew, rejectDupOrphans
 		return nil, nil, txRuleError(protos.RejectInvalid, str)
 	}
 
+	// Don't accept transactions carrying an access list until access lists
+	// are active, they would not be valid in the next block.
+	if tx.MsgTx().HasAccessList() {
+		active, err := mp.cfg.Chain.IsDeploymentActive(chaincfg.DeploymentAccessList)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !active {
+			str := fmt.Sprintf("transaction %v carries an access list "+
+				"before its activation", txHash)
+			return nil, nil, txRuleError(protos.RejectNonstandard, str)
+		}
+	}
+
 	// Get the current height of the main chain.  A standalone transaction
 	// will be mined into the next block at best, so its height is at least
 	// one more than the current height.
 	bestHeight := mp.cfg.BestHeight()
 	nextBlockHeight := bestHeight + 1
 
+	// Don't accept transactions carrying storage witnesses while state rent
+	// is disabled, they would not be valid in the next block.
+	if tx.MsgTx().HasStorageWitness() &&
+		mp.cfg.Chain.StateRent(nextBlockHeight) == nil {
+		str := fmt.Sprintf("transaction %v carries storage witnesses "+
+			"while state rent is disabled", txHash)
+		return nil, nil, txRuleError(protos.RejectNonstandard, str)
+	}
+
 	medianTimePast := mp.cfg.MedianTimePast()
 
 	// Don't allow non-standard transactions
@@ -974,9 +1044,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *asiutil.Tx, isNew, rejectDupOrphans
 
 	// Don't allow transactions with price too low to get into a mined block.
 	gasPrice := float64(txFee) / float64(tx.MsgTx().TxContract.GasLimit)
-	if gasPrice < mp.cfg.Policy.MinRelayTxPrice {
+	if gasPrice < minGasPrice {
 		str := fmt.Sprintf("transaction %v gas price too low: %f > %f",
-			txHash, gasPrice, mp.cfg.Policy.MinRelayTxPrice)
+			txHash, gasPrice, minGasPrice)
 		return nil, nil, txRuleError(protos.RejectLowGasPrice, str)
 	}
 
@@ -1002,7 +1072,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *asiutil.Tx, isNew, rejectDupOrphans
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	err = blockchain.ValidateTransactionScripts(tx, utxoView,
-		txscript.StandardVerifyFlags)
+		txscript.StandardVerifyFlags, mp.cfg.SigCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
@@ -1057,7 +1127,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *asiutil.Tx, isNew, rejectDupOrphans
 func (mp *TxPool) MaybeAcceptTransaction(tx *asiutil.Tx, isNew bool) ([]*common.Hash, *mining.TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, true,
+		mp.cfg.Policy.MinRelayTxPrice)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
@@ -1100,7 +1171,7 @@ func (mp *TxPool) processOrphans(acceptedTx *asiutil.Tx) []*mining.TxDesc {
 			// Potentially accept an orphan into the tx pool.
 			for _, tx := range orphans {
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, false)
+					tx, true, false, mp.cfg.Policy.MinRelayTxPrice)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1175,15 +1246,28 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *asiutil.Tx) []*mining.TxDesc {
 // the passed one being accepted.
 //
 // This function is safe for concurrent access.
-func (mp *TxPool) ProcessTransaction(tx *asiutil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*mining.TxDesc, error) {
+func (mp *TxPool) ProcessTransaction(tx *asiutil.Tx, allowOrphan, rateLimit bool,
+	tag Tag) (accepted []*mining.TxDesc, err error) {
+
 	log.Tracef("Processing transaction %v", tx.Hash())
 
+	span := tracing.StartSpan("mempool.ProcessTransaction", nil)
+	if span.Sampled() {
+		span.SetAttr("tx.hash", tx.Hash().String())
+	}
+	defer func() {
+		span.SetAttr("tx.accepted", len(accepted))
+		span.SetError(err)
+		span.End()
+	}()
+
 	// Protect concurrent access.
 	mp.mtx.Lock()
 	defer mp.mtx.Unlock()
 
 	// Potentially accept the transaction to the memory pool.
-	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, true)
+	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, true,
+		mp.cfg.Policy.MinRelayTxPrice)
 	if err != nil {
 		return nil, err
 	}
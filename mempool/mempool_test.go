@@ -778,6 +778,52 @@ func TestOrphanEviction(t *testing.T) {
 	}
 }
 
+// TestOrphanSizeEviction ensures orphans are evicted to keep the total size of
+// the orphan pool within its limit, and that the size accounting follows the
+// orphans which are removed.
+func TestOrphanSizeEviction(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 4)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// Allow the pool to hold two of the orphans only.
+	size := chainedTxns[1].MsgTx().SerializeSize()
+	harness.txPool.cfg.Policy.MaxOrphanPoolSize = size*2 + size/2
+	for _, tx := range chainedTxns[1:] {
+		_, err := harness.txPool.ProcessTransaction(tx, true, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"orphan %v", err)
+		}
+		testPoolMembership(tc, tx, true, false)
+	}
+	if n := len(harness.txPool.orphans); n != 2 {
+		t.Fatalf("got %d orphans, want 2", n)
+	}
+	if harness.txPool.orphanBytes > harness.txPool.cfg.Policy.MaxOrphanPoolSize {
+		t.Fatalf("orphans use %d bytes, more than the limit of %d",
+			harness.txPool.orphanBytes,
+			harness.txPool.cfg.Policy.MaxOrphanPoolSize)
+	}
+
+	for _, tx := range chainedTxns[1:] {
+		harness.txPool.RemoveOrphan(tx)
+	}
+	if harness.txPool.orphanBytes != 0 {
+		t.Fatalf("orphans use %d bytes once removed, want 0",
+			harness.txPool.orphanBytes)
+	}
+}
+
 // TestBasicOrphanRemoval ensure that orphan removal works as expected when an
 // orphan that doesn't exist is removed  both when there is another orphan that
 // redeems it and when there is not.
@@ -1632,6 +1678,31 @@ func TestRBP(t *testing.T) {
 			},
 			err: "spends new unconfirmed input",
 		},
+		{
+			// A transaction cannot replace another if its gasPrice
+			// does not exceed the one of the transaction by the
+			// replacement bump.
+			name: "insufficient gasPrice bump",
+			setup: func(ctx *testContext) (*asiutil.Tx, []*asiutil.Tx) {
+				ctx.harness.txPool.cfg.Policy.ReplacementBump = 10
+
+				coinbase := ctx.addCoinbaseTx(1)
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				ctx.addSignedTx(outs, 1, DefaultInputFee*2, false)
+
+				// The replacement pays 5% more.
+				tx, err := ctx.harness.CreateSignedTx(outs, 1,
+					DefaultInputFee*2+DefaultInputFee/10)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, nil
+			},
+			err: "insufficient gasPrice bump",
+		},
 		{
 			// A transaction can replace another with a higher gasPrice.
 			name: "higher gasPrice",
@@ -1729,4 +1800,84 @@ func TestRBP(t *testing.T) {
 			break
 		}
 	}
-}
\ No newline at end of file
+}
+// TestProcessTransactionPackage ensures a package of dependent transactions
+// is accepted or rejected as a whole, its gas price being checked over the
+// package so a child may pay for its parent.
+func TestProcessTransactionPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// newPackage creates a parent paying no fee and a child spending it
+	// which pays the passed fee.
+	newPackage := func(childFee common.Amount) (*asiutil.Tx, *asiutil.Tx) {
+		coinbase := ctx.addCoinbaseTx(1)
+		parent, err := harness.CreateSignedTx(
+			[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 0)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		child, err := harness.CreateSignedTx(
+			[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, childFee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return parent, child
+	}
+
+	// The parent alone is below the minimum relay gas price.
+	parent, child := newPackage(DefaultInputFee)
+	_, err = harness.txPool.ProcessTransaction(parent, false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "gas price too low") {
+		t.Fatalf("ProcessTransaction: expected low gas price, got %v", err)
+	}
+
+	// The package is below the minimum relay gas price as a whole.
+	_, err = harness.txPool.ProcessTransactionPackage(
+		[]*asiutil.Tx{parent, child})
+	if err == nil || !strings.Contains(err.Error(), "gas price too low") {
+		t.Fatalf("ProcessTransactionPackage: expected low gas price, "+
+			"got %v", err)
+	}
+	testPoolMembership(ctx, parent, false, false)
+	testPoolMembership(ctx, child, false, false)
+
+	// A child paying for both transactions is accepted along with its
+	// parent, whatever the order of the package.
+	parent, child = newPackage(2 * DefaultInputFee)
+	accepted, err := harness.txPool.ProcessTransactionPackage(
+		[]*asiutil.Tx{child, parent})
+	if err != nil {
+		t.Fatalf("ProcessTransactionPackage: %v", err)
+	}
+	if len(accepted) != 2 || accepted[0].Tx != parent ||
+		accepted[1].Tx != child {
+		t.Fatalf("ProcessTransactionPackage: unexpected accepted " +
+			"transactions")
+	}
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, child, false, true)
+
+	// A package with an invalid transaction is rejected as a whole: the
+	// second child double spends the output of the accepted parent.
+	parent2, child2 := newPackage(2 * DefaultInputFee)
+	doubleSpend, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 2, DefaultInputFee)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransactionPackage(
+		[]*asiutil.Tx{parent2, child2, doubleSpend})
+	if err == nil || !strings.Contains(err.Error(), "already spent") {
+		t.Fatalf("ProcessTransactionPackage: expected double spend, "+
+			"got %v", err)
+	}
+	testPoolMembership(ctx, parent2, false, false)
+	testPoolMembership(ctx, child2, false, false)
+	testPoolMembership(ctx, child, false, true)
+}
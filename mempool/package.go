@@ -0,0 +1,163 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/tracing"
+)
+
+// MaxPackageTxs is the maximum number of transactions of a package accepted
+// by ProcessTransactionPackage.
+const MaxPackageTxs = 25
+
+// sortPackage returns the transactions of a package ordered so every
+// transaction follows the transactions of the package it spends.  It returns
+// an error when the package is empty, too large or holds a transaction twice.
+func sortPackage(txs []*asiutil.Tx) ([]*asiutil.Tx, error) {
+	if len(txs) == 0 || len(txs) > MaxPackageTxs {
+		str := fmt.Sprintf("package of %d transactions, at least 1 and "+
+			"at most %d are allowed", len(txs), MaxPackageTxs)
+		return nil, txRuleError(protos.RejectInvalid, str)
+	}
+
+	byHash := make(map[common.Hash]*asiutil.Tx, len(txs))
+	for _, tx := range txs {
+		if _, ok := byHash[*tx.Hash()]; ok {
+			str := fmt.Sprintf("package holds transaction %v twice",
+				tx.Hash())
+			return nil, txRuleError(protos.RejectDuplicate, str)
+		}
+		byHash[*tx.Hash()] = tx
+	}
+
+	sorted := make([]*asiutil.Tx, 0, len(txs))
+	visited := make(map[common.Hash]struct{}, len(txs))
+	var visit func(tx *asiutil.Tx)
+	visit = func(tx *asiutil.Tx) {
+		if _, ok := visited[*tx.Hash()]; ok {
+			return
+		}
+		visited[*tx.Hash()] = struct{}{}
+		for _, txIn := range tx.MsgTx().TxIn {
+			if parent, ok := byHash[txIn.PreviousOutPoint.Hash]; ok {
+				visit(parent)
+			}
+		}
+		sorted = append(sorted, tx)
+	}
+	for _, tx := range txs {
+		visit(tx)
+	}
+	return sorted, nil
+}
+
+// ProcessTransactionPackage accepts a package of dependent transactions, such
+// as parents along with the children spending them, to the memory pool as a
+// whole.  Either all the transactions are accepted or none is.
+//
+// Every transaction must pass the checks of ProcessTransaction, except for
+// the minimum relay gas price which applies to the gas price of the package,
+// its total fee over its total gas limit.  A child may thus pay for a parent
+// which is below the minimum relay gas price on its own.  The inputs of the
+// package must be unspent in the main chain, the memory pool or the package,
+// and must not be spent by transactions of the memory pool, a package never
+// replacing transactions.
+//
+// It returns the transactions added to the mempool: the transactions of the
+// package, parents first, followed by the orphans accepted as a result.  The
+// transactions of the package held in the orphan pool are moved to the main
+// pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessTransactionPackage(txs []*asiutil.Tx) (accepted []*mining.TxDesc, err error) {
+	log.Tracef("Processing package of %d transactions", len(txs))
+
+	span := tracing.StartSpan("mempool.ProcessTransactionPackage", nil)
+	if span.Sampled() {
+		span.SetAttr("package.txs", len(txs))
+	}
+	defer func() {
+		span.SetAttr("tx.accepted", len(accepted))
+		span.SetError(err)
+		span.End()
+	}()
+
+	txs, err = sortPackage(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	pkg := make([]*mining.TxDesc, 0, len(txs))
+	rollback := func() {
+		for i := len(pkg) - 1; i >= 0; i-- {
+			mp.removeTransaction(pkg[i].Tx, false)
+		}
+	}
+
+	var fee, gasLimit int64
+	for _, tx := range txs {
+		for _, txIn := range tx.MsgTx().TxIn {
+			if spender, ok := mp.outpoints[txIn.PreviousOutPoint]; ok {
+				rollback()
+				str := fmt.Sprintf("output %v of package transaction "+
+					"%v already spent by transaction %v in the "+
+					"memory pool", txIn.PreviousOutPoint, tx.Hash(),
+					spender.Hash())
+				return nil, txRuleError(protos.RejectDuplicate, str)
+			}
+		}
+
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, false, 0)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if len(missingParents) > 0 {
+			rollback()
+			str := fmt.Sprintf("package transaction %v references "+
+				"outputs of unknown or fully-spent transaction %v",
+				tx.Hash(), missingParents[0])
+			return nil, txRuleError(protos.RejectDuplicate, str)
+		}
+		pkg = append(pkg, txD)
+		fee += txD.Fee
+		gasLimit += int64(tx.MsgTx().TxContract.GasLimit)
+	}
+
+	// Don't allow packages with price too low to get into a mined block.
+	gasPrice := float64(fee) / float64(gasLimit)
+	if gasPrice < mp.cfg.Policy.MinRelayTxPrice {
+		rollback()
+		str := fmt.Sprintf("package of %d transactions gas price too "+
+			"low: %f > %f", len(txs), gasPrice,
+			mp.cfg.Policy.MinRelayTxPrice)
+		return nil, txRuleError(protos.RejectLowGasPrice, str)
+	}
+
+	// Move the transactions of the package held as orphans to the main pool,
+	// and accept any orphan transactions that depend on the package.
+	for _, txD := range pkg {
+		mp.removeOrphan(txD.Tx, false)
+	}
+	accepted = pkg
+	for _, txD := range pkg {
+		accepted = append(accepted, mp.processOrphans(txD.Tx)...)
+	}
+
+	log.Debugf("Accepted package of %d transactions with gas price %v",
+		len(pkg), gasPrice)
+
+	return accepted, nil
+}
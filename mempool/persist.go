@@ -0,0 +1,100 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// persistVersion is the version of the format written by Save.  The format
+// is the version and the number of transactions, followed by the time each
+// transaction was added, as unix nanoseconds, and the serialized
+// transaction.  The integers are little endian.
+const persistVersion = 1
+
+// Save writes the transactions of the pool to w, in the order they were
+// added so every transaction follows the transactions of the pool it spends.
+// It returns the number of transactions written.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(w io.Writer) (int, error) {
+	descs := mp.TxDescs()
+	sort.SliceStable(descs, func(i, j int) bool {
+		return descs[i].Added.Before(descs[j].Added)
+	})
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[0:4], persistVersion)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(descs)))
+	if _, err := w.Write(header); err != nil {
+		return 0, err
+	}
+
+	var added [8]byte
+	for i, desc := range descs {
+		binary.LittleEndian.PutUint64(added[:], uint64(desc.Added.UnixNano()))
+		if _, err := w.Write(added[:]); err != nil {
+			return i, err
+		}
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return i, err
+		}
+	}
+	return len(descs), nil
+}
+
+// Load reads the transactions written by Save from r and processes them as
+// new transactions, so they are validated again against the current best
+// chain.  The transactions which are no longer valid, such as the ones mined
+// or double spent meanwhile, are dropped.  The accepted transactions keep
+// the time they were first added.  It returns the number of transactions
+// accepted and dropped.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader) (int, int, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, err
+	}
+	if version := binary.LittleEndian.Uint32(header[0:4]); version != persistVersion {
+		return 0, 0, fmt.Errorf("unsupported mempool file version %d", version)
+	}
+	count := binary.LittleEndian.Uint32(header[4:8])
+
+	var accepted, dropped int
+	var added [8]byte
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(r, added[:]); err != nil {
+			return accepted, dropped, err
+		}
+		var msgTx protos.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return accepted, dropped, err
+		}
+
+		tx := asiutil.NewTx(&msgTx)
+		_, err := mp.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			log.Debugf("Dropped persisted transaction %v: %v", tx.Hash(), err)
+			dropped++
+			continue
+		}
+		accepted++
+
+		mp.mtx.Lock()
+		if desc, ok := mp.pool[*tx.Hash()]; ok {
+			desc.Added = time.Unix(0, int64(binary.LittleEndian.Uint64(added[:])))
+		}
+		mp.mtx.Unlock()
+	}
+	return accepted, dropped, nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+)
+
+// TestSaveLoad ensures the transactions saved by a pool are loaded by another
+// one, which drops the transactions no longer valid against the chain.
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	coinbase := ctx.addCoinbaseTx(2)
+	parent := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(coinbase, 0)},
+		1, DefaultInputFee, false)
+	child := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(parent, 0)},
+		1, DefaultInputFee, false)
+	mined := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(coinbase, 1)},
+		1, DefaultInputFee, false)
+	added := harness.txPool.pool[*child.Hash()].Added
+
+	var buf bytes.Buffer
+	n, err := harness.txPool.Save(&buf)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("Save: wrote %d transactions, want 3", n)
+	}
+
+	// The output spent by the last transaction is spent in the chain
+	// before the pool is loaded again.
+	harness.chain.utxos.RemoveEntry(txOutToSpendableOut(coinbase, 1).outPoint)
+	harness.txPool = New(&harness.txPool.cfg)
+	accepted, dropped, err := harness.txPool.Load(&buf)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accepted != 2 || dropped != 1 {
+		t.Fatalf("Load: got %d accepted and %d dropped transactions, "+
+			"want 2 and 1", accepted, dropped)
+	}
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, child, false, true)
+	testPoolMembership(ctx, mined, false, false)
+	if got := harness.txPool.pool[*child.Hash()].Added; !got.Equal(added) {
+		t.Fatalf("Load: child added at %v, want %v", got, added)
+	}
+
+	// Files of other versions are refused.
+	_, _, err = harness.txPool.Load(bytes.NewReader([]byte{2, 0, 0, 0, 0, 0, 0, 0}))
+	if err == nil {
+		t.Fatal("Load: expected an error for an unknown version")
+	}
+}
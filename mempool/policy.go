@@ -95,11 +95,13 @@ func checkInputsStandard(tx *asiutil.Tx, utxoView *txo.UtxoViewpoint) error {
 func checkTransactionStandard(tx *asiutil.Tx, height int32,
 	medianTimePast int64, maxTxVersion uint32) error {
 
-	// The transaction must be a currently supported version.
+	// The transaction must be a currently supported version.  The flags
+	// of the version are not part of it.
 	msgTx := tx.MsgTx()
-	if msgTx.Version > maxTxVersion || msgTx.Version < 1 {
+	version := msgTx.Version &^ protos.TxFlagsMask
+	if version > maxTxVersion || version < 1 {
 		str := fmt.Sprintf("transaction version %d is not in the "+
-			"valid range of %d-%d", msgTx.Version, 1,
+			"valid range of %d-%d", version, 1,
 			maxTxVersion)
 		return txRuleError(protos.RejectNonstandard, str)
 	}
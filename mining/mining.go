@@ -7,7 +7,6 @@ package mining
 
 import (
 	"container/heap"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/blockchain/txo"
@@ -16,6 +15,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/AsimovNetwork/asimov/ainterface"
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/chaincfg"
@@ -120,8 +120,13 @@ type SigSource interface {
 // which have not been mined into a block yet.
 type TxPrioItem struct {
 	tx       *asiutil.Tx
+	fee      int64
 	gasPrice float64
 
+	// score is the priority the selector in use assigned to the
+	// transaction, if any.
+	score float64
+
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
 	// transactions in the source pool and hence must come after them in
@@ -130,9 +135,10 @@ type TxPrioItem struct {
 }
 
 // txPriorityQueue implements a priority queue of TxPrioItem elements that
-// supports an arbitrary compare function as defined by txPriorityQueueLessFunc.
+// pops the items in the order defined by its transaction selector.
 type txPriorityQueue struct {
-	items []*TxPrioItem
+	items    []*TxPrioItem
+	selector TxSelector
 }
 
 // Len returns the number of items in the priority queue.  It is part of the
@@ -142,10 +148,10 @@ func (pq *txPriorityQueue) Len() int {
 }
 
 // Less returns whether the item in the priority queue with index i should sort
-// before the item with index j by deferring to the assigned less function.  It
-// is part of the heap.Interface implementation.
+// before the item with index j by deferring to the assigned selector.  It is
+// part of the heap.Interface implementation.
 func (pq *txPriorityQueue) Less(i, j int) bool {
-	return pq.items[i].gasPrice > pq.items[j].gasPrice
+	return pq.selector.Less(pq.items[i], pq.items[j])
 }
 
 // Swap swaps the items at the passed indices in the priority queue.  It is
@@ -171,14 +177,15 @@ func (pq *txPriorityQueue) Pop() interface{} {
 }
 
 // NewTxPriorityQueue returns a new transaction priority queue that reserves the
-// passed amount of space for the elements.  The new priority queue uses either
-// the txPQByPriority or the txPQByFee compare function depending on the
-// sortByFee parameter and is already initialized for use with heap.Push/Pop.
-// The priority queue can grow larger than the reserved space, but extra copies
-// of the underlying array can be avoided by reserving a sane value.
-func NewTxPriorityQueue(reserve int) *txPriorityQueue {
+// passed amount of space for the elements.  The new priority queue orders the
+// items as defined by the passed selector, and is already initialized for use
+// with heap.Push/Pop.  The priority queue can grow larger than the reserved
+// space, but extra copies of the underlying array can be avoided by reserving
+// a sane value.
+func NewTxPriorityQueue(reserve int, selector TxSelector) *txPriorityQueue {
 	pq := &txPriorityQueue{
-		items: make([]*TxPrioItem, 0, reserve),
+		items:    make([]*TxPrioItem, 0, reserve),
+		selector: selector,
 	}
 	return pq
 }
@@ -301,24 +308,29 @@ type BlkTmplGenerator struct {
 	txSource     TxSource
 	sigSource    SigSource
 	chain        *blockchain.BlockChain
+	sigCache     *txscript.SigCache
 
 	FetchUtxoView func(tx *asiutil.Tx, dolock bool) (*txo.UtxoViewpoint, error)
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
-// policy using transactions from the provided transaction source.
+// policy using transactions from the provided transaction source.  The
+// signature cache, which may be nil, saves verifying again the signatures of
+// the transactions admitted to the mempool.
 //
 // The additional state-related fields are required in order to ensure the
 // templates are built on top of the current best chain and adhere to the
 // consensus rules.
 func NewBlkTmplGenerator(policy *Policy,
-	txSource TxSource, sigSource SigSource, chain *blockchain.BlockChain) *BlkTmplGenerator {
+	txSource TxSource, sigSource SigSource, chain *blockchain.BlockChain,
+	sigCache *txscript.SigCache) *BlkTmplGenerator {
 
 	return &BlkTmplGenerator{
 		policy:     policy,
 		txSource:   txSource,
 		sigSource:  sigSource,
 		chain:      chain,
+		sigCache:   sigCache,
 		FetchUtxoView: chain.FetchUtxoView,
 	}
 }
@@ -345,6 +357,12 @@ func NewBlkTmplGenerator(policy *Policy,
 // the priority queue is updated to prioritize by fees per kilobyte (then
 // priority).
 //
+// The TxSelector of the policy may change the order the transactions are
+// selected in, e.g. to account for the fees of the transactions spending
+// them.  When the policy sets CanonicalTxOrder, the transactions are instead
+// selected by increasing hash, each one after the transactions it spends, so
+// the same source transactions produce the same block contents.
+//
 // Given the above, a block generated by this function is of the following form:
 //
 //   -----------------------------------  --  --
@@ -361,6 +379,17 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 	round uint32, slotIndex uint16, blockInterval float64) (
 	blockTemplate *BlockTemplate, err error) {
 
+	return g.ProduceNewBlockTo(account, account.Address, gasFloor, gasCeil,
+		blockTime, round, slotIndex, blockInterval)
+}
+
+// ProduceNewBlockTo is like ProduceNewBlock, except the block reward is paid
+// to the passed address rather than to the account producing the block.
+func (g *BlkTmplGenerator) ProduceNewBlockTo(account *crypto.Account, payTo common.IAddress,
+	gasFloor, gasCeil uint64, blockTime int64,
+	round uint32, slotIndex uint16, blockInterval float64) (
+	blockTemplate *BlockTemplate, err error) {
+
 	produceBlockTimeInterval := g.policy.BlockProductedTimeOut * blockInterval
 	utxoValidateTimeInterval := g.policy.UtxoValidateTimeOut * produceBlockTimeInterval
 	produceTxTimeInterval := (g.policy.UtxoValidateTimeOut + g.policy.TxConnectTimeOut) * produceBlockTimeInterval
@@ -377,7 +406,14 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 	sort.Sort(sourceTxns)
 
 	forbiddenTxHashes := make([]*common.Hash, 0, len(sourceTxns))
-	priorityQueue := NewTxPriorityQueue(len(sourceTxns))
+	selector := g.policy.TxSelector
+	if selector == nil {
+		selector = FeeRateSelector{}
+	}
+	if g.policy.CanonicalTxOrder {
+		selector = canonicalSelector{}
+	}
+	priorityQueue := NewTxPriorityQueue(len(sourceTxns), selector)
 	txpool := make(map[common.Hash]int)
 	for _, tx := range sourceTxns {
 		txpool[*tx.Tx.Hash()] = MiningTxInit
@@ -394,7 +430,7 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 	header.SlotIndex = slotIndex
 	header.Timestamp = blockTime
 	header.CoinBase = *payToAddress
-	stateDB, feepool, contractOut, err := g.chain.Prepare(header, gasFloor, gasCeil)
+	stateDB, feepool, contractOut, split, err := g.chain.Prepare(header, gasFloor, gasCeil)
 	defer func() {
 		g.chain.ChainRUnlock()
 		if err == nil && len(forbiddenTxHashes) > 0 {
@@ -412,7 +448,7 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 	// been selected.  It is created here to detect any errors early
 	// before potentially doing a lot of work below.
 	coinbaseTx, stdTxout, err := CreateCoinbaseTx(chaincfg.ActiveNetParams.Params,
-		header.Height, payToAddress,
+		header.Height, payTo,
 		contractOut)
 	if err != nil {
 		return nil, err
@@ -420,8 +456,7 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 	coinbaseSigOpCost := int64(blockchain.CountSigOps(coinbaseTx))
 
 	// flag whether core team take reward
-	coreTeamRewardFlag := header.Height <= chaincfg.ActiveNetParams.Params.SubsidyReductionInterval ||
-		blockTime - chaincfg.ActiveNetParams.Params.GenesisBlock.Header.Timestamp < 86400*(365*4+1)
+	coreTeamRewardFlag := split.Foundation > 0
 	txoutSizePerAsset := stdTxout.SerializeSize()
 	if coreTeamRewardFlag {
 		txoutSizePerAsset *= 2
@@ -466,10 +501,13 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 
 	sort.Sort(preBlockSigs)
 	// Add self sig weight.
-	_, weightMap, err := g.chain.GetValidators(round)
+	validators, weightMap, err := g.chain.GetValidators(round)
 	if err != nil {
 		return nil, err
 	}
+	if err = g.chain.Engine().Prepare(header, validators); err != nil {
+		return nil, err
+	}
 	curWeight, ok := weightMap[*payToAddress]
 	if !ok {
 		errStr := fmt.Sprint("Unexpected slotIndex", payToAddress)
@@ -518,6 +556,10 @@ func (g *BlkTmplGenerator) ProduceNewBlock(account *crypto.Account, gasFloor, ga
 	txSigOpCosts := make([]int64, 0, len(sourceTxns))
 	txSigOpCosts = append(txSigOpCosts, coinbaseSigOpCost)
 
+	// candidates holds the transactions which may be selected, so the
+	// selector can score them once their dependencies are known.
+	candidates := make([]*TxPrioItem, 0, len(sourceTxns))
+
 	utxostart := getMilliSecond()
 mempoolLoop:
 	for _, txDesc := range sourceTxns {
@@ -588,6 +630,7 @@ mempoolLoop:
 			}
 		}
 
+		prioItem.fee = txDesc.Fee
 		prioItem.gasPrice = txDesc.GasPrice
 
 		// Merge the referenced outputs from the input transactions to
@@ -595,13 +638,18 @@ mempoolLoop:
 		// code below to avoid a second lookup.
 		mergeUtxoView(blockUtxos, utxos)
 
-		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
+		candidates = append(candidates, prioItem)
+	}
+	utxoEnd := getMilliSecond()
+
+	// Add the transactions to the priority queue to mark them ready for
+	// inclusion in the block unless they have dependencies.
+	selector.Prepare(candidates)
+	for _, prioItem := range candidates {
 		if prioItem.dependsOn == nil {
 			heap.Push(priorityQueue, prioItem)
 		}
 	}
-	utxoEnd := getMilliSecond()
 
 	blockSigOpCost := coinbaseSigOpCost
 	allFees := map[protos.Asset]int64 {
@@ -638,7 +686,7 @@ priorityQueueLoop:
 		txSize := tx.MsgTx().SerializeSize()
 		blockPlusTxSize := blockSize + txSize
 		if blockPlusTxSize < blockSize ||
-			blockPlusTxSize >= common.MaxBlockSize {
+			blockPlusTxSize >= chaincfg.ActiveNetParams.BlockSizeLimit() {
 			log.Tracef("Skipping tx %s because it would exceed "+
 				"the max block size", tx.Hash())
 			logSkippedDeps(tx, deps)
@@ -694,7 +742,7 @@ priorityQueueLoop:
 			if _, ok := allFees[asset]; !ok {
 				txSize += txoutSizePerAsset
 				blockPlusTxSize = blockSize + txSize
-				if blockPlusTxSize < blockSize || blockPlusTxSize >= common.MaxBlockSize {
+				if blockPlusTxSize < blockSize || blockPlusTxSize >= chaincfg.ActiveNetParams.BlockSizeLimit() {
 					log.Tracef("Skipping tx %s because it would exceed "+
 						"the max block size", tx.Hash())
 					logSkippedDeps(tx, deps)
@@ -704,7 +752,7 @@ priorityQueueLoop:
 		}
 
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
-			txscript.StandardVerifyFlags)
+			txscript.StandardVerifyFlags, g.sigCache)
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
@@ -780,22 +828,21 @@ priorityQueueLoop:
 
 	rebuildFunder(coinbaseTx, stdTxout, &allFees)
 
-	// reward for core team
-	if coreTeamRewardFlag {
-		fundationAddr := common.HexToAddress(string(common.GenesisOrganization))
-		pkScript, _ := txscript.PayToAddrScript(&fundationAddr)
-		txoutLen := len(coinbaseTx.MsgTx().TxOut)
-		for i := 0; i < txoutLen; i++ {
-			value := coinbaseTx.MsgTx().TxOut[i].Value
-			coreTeamValue := int64(float64(value) * common.CoreTeamPercent)
-			if coreTeamValue > 0 {
-				coinbaseTx.MsgTx().TxOut[i].Value = value - coreTeamValue
-				coinbaseTx.MsgTx().AddTxOut(&protos.TxOut{
-					Value:    coreTeamValue,
-					PkScript: pkScript,
-					Asset:    coinbaseTx.MsgTx().TxOut[i].Asset,
-				})
-			}
+	// reward for core team, and burn
+	fundationAddr := common.HexToAddress(string(common.GenesisOrganization))
+	pkScript, _ := txscript.PayToAddrScript(&fundationAddr)
+	txoutLen := len(coinbaseTx.MsgTx().TxOut)
+	for i := 0; i < txoutLen; i++ {
+		value := coinbaseTx.MsgTx().TxOut[i].Value
+		coreTeamValue, burnValue := split.Shares(value)
+		coinbaseTx.MsgTx().TxOut[i].Value = value - burnValue
+		if coreTeamValue > 0 {
+			coinbaseTx.MsgTx().TxOut[i].Value -= coreTeamValue
+			coinbaseTx.MsgTx().AddTxOut(&protos.TxOut{
+				Value:    coreTeamValue,
+				PkScript: pkScript,
+				Asset:    coinbaseTx.MsgTx().TxOut[i].Asset,
+			})
 		}
 	}
 	stateDB.Prepare(*coinbaseTx.Hash(), common.Hash{}, txidx)
@@ -838,7 +885,7 @@ priorityQueueLoop:
 	msgBlock.Header.GasUsed = totalGasUsed
 	msgBlock.Header.PoaHash = msgBlock.CalculatePoaHash()
 
-	err = commit(&msgBlock, stateDB, account)
+	err = commit(g.chain.Engine(), &msgBlock, stateDB, account)
 	if err != nil {
 		return nil, err
 	}
@@ -872,20 +919,22 @@ func rebuildFunder(tx *asiutil.Tx, stdTxout *protos.TxOut, fees *map[protos.Asse
 	}
 }
 
-// commit state and signature the given block
-func commit(block *protos.MsgBlock, stateDB *state.StateDB, account *crypto.Account) error {
+// commit state, then finalize and seal the given block with the consensus
+// engine
+func commit(engine ainterface.Engine, block *protos.MsgBlock, stateDB *state.StateDB,
+	account *crypto.Account) error {
 	stateRoot, err := stateDB.Commit(true)
 	if err != nil {
 		return err
 	}
 	block.Header.StateRoot = stateRoot
 
-	blockHash := block.BlockHash()
-	signature, err := crypto.Sign(blockHash[:], (*ecdsa.PrivateKey)(&account.PrivateKey))
-	if err != nil {
+	if err = engine.Finalize(block); err != nil {
+		return err
+	}
+	if err = engine.Seal(&block.Header, account); err != nil {
 		log.Errorf("sign block failed: %s", err)
 		return err
 	}
-	copy(block.Header.SigData[:], signature)
 	return nil
 }
\ No newline at end of file
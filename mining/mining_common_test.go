@@ -239,6 +239,8 @@ func createFakeTx(vin []*fakeIn, vout []*fakeOut, global_view *txo.UtxoViewpoint
 		txout := protos.NewTxOut(v.amount, pkScript, *v.asset)
 		txMsg.AddTxOut(txout)
 	}
+	// The gas limit must cover the base gas of the signed transaction.
+	txMsg.TxContract.GasLimit = 100000
 
 	for i, v := range vin {
 		entry := global_view.LookupEntry(protos.OutPoint{v.blockHash, v.index})
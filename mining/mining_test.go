@@ -6,6 +6,7 @@
 package mining
 
 import (
+	"bytes"
 	"container/heap"
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain"
@@ -50,7 +51,7 @@ func TestTxPriceHeap(t *testing.T) {
 
 	// Test sorting by fee per KB then priority.
 	var highest *TxPrioItem
-	priorityQueue := NewTxPriorityQueue(len(testItems))
+	priorityQueue := NewTxPriorityQueue(len(testItems), FeeRateSelector{})
 	for i := 0; i < len(testItems); i++ {
 		prioItem := testItems[i]
 		if highest == nil {
@@ -73,6 +74,29 @@ func TestTxPriceHeap(t *testing.T) {
 	}
 }
 
+// TestTxHashHeap ensures the priority queue pops the transactions by
+// increasing hash when ordering them canonically.
+func TestTxHashHeap(t *testing.T) {
+	priorityQueue := NewTxPriorityQueue(100, canonicalSelector{})
+	for i := 0; i < 100; i++ {
+		tx := protos.NewMsgTx(protos.TxVersion)
+		tx.LockTime = uint32(i)
+		heap.Push(priorityQueue, &TxPrioItem{
+			tx:       asiutil.NewTx(tx),
+			gasPrice: float64(i),
+		})
+	}
+
+	var prev *common.Hash
+	for priorityQueue.Len() > 0 {
+		hash := heap.Pop(priorityQueue).(*TxPrioItem).tx.Hash()
+		if prev != nil && bytes.Compare(prev[:], hash[:]) >= 0 {
+			t.Fatalf("hash sort: item %v not after prev %v", hash, prev)
+		}
+		prev = hash
+	}
+}
+
 func TestCreateCoinbaseTx(t *testing.T) {
 	privKey, _ := crypto.NewPrivateKey(crypto.S256())
 	pkaddr, _ := address.NewAddressPubKey(privKey.PubKey().SerializeCompressed())
@@ -125,6 +149,7 @@ func TestNewBlockTemplate(t *testing.T) {
 		fakeTxSource,
 		fakeSigSource,
 		chain,
+		nil,
 	)
 
 	defer teardownFunc()
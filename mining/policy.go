@@ -33,4 +33,15 @@ type Policy struct {
 	// UtxoValidateTimeOut limits source txs' utxo validating time.
 	// It is the maximum percent (default 0.35) of producing block interval.
 	UtxoValidateTimeOut float64
+
+	// CanonicalTxOrder orders the transactions of the produced blocks by
+	// hash, a transaction still following the transactions it spends,
+	// instead of by gas price.  The same source transactions then produce
+	// the same block contents.
+	CanonicalTxOrder bool
+
+	// TxSelector decides the order the transactions are selected in.  It
+	// defaults to the FeeRateSelector and is ignored when CanonicalTxOrder
+	// is set.
+	TxSelector TxSelector
 }
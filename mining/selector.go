@@ -0,0 +1,133 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+const (
+	// FeeRateSelectorName is the name of the FeeRateSelector.
+	FeeRateSelectorName = "feerate"
+
+	// AncestorFeeRateSelectorName is the name of the
+	// AncestorFeeRateSelector.
+	AncestorFeeRateSelectorName = "ancestorfeerate"
+)
+
+// TxSelector decides the order in which the block template generator selects
+// the transactions ready for inclusion in a block.  A transaction is ready
+// once all of the source pool transactions it spends have been selected.
+type TxSelector interface {
+	// Prepare is called with all of the candidate transactions before
+	// any of them is selected, so the selector can compute their scores.
+	Prepare(items []*TxPrioItem)
+
+	// Less returns whether item a should be selected before item b.
+	Less(a, b *TxPrioItem) bool
+}
+
+// NewTxSelector returns the transaction selector registered under the passed
+// name.
+func NewTxSelector(name string) (TxSelector, error) {
+	switch name {
+	case FeeRateSelectorName:
+		return FeeRateSelector{}, nil
+	case AncestorFeeRateSelectorName:
+		return AncestorFeeRateSelector{}, nil
+	}
+	return nil, fmt.Errorf("unknown transaction selector %q", name)
+}
+
+// FeeRateSelector selects the transactions by decreasing gas price.  It is
+// the default selector.
+type FeeRateSelector struct{}
+
+// Prepare is part of the TxSelector interface.
+func (FeeRateSelector) Prepare(items []*TxPrioItem) {}
+
+// Less is part of the TxSelector interface.
+func (FeeRateSelector) Less(a, b *TxPrioItem) bool {
+	return a.gasPrice > b.gasPrice
+}
+
+// AncestorFeeRateSelector selects the transactions by decreasing score, the
+// score of a transaction being the highest of its own gas price and of the
+// ancestor fee rates of the transactions spending it.  The ancestor fee rate
+// of a transaction is the fee it pays along with its unselected ancestors
+// divided by their gas limits.  A cheap parent is therefore selected early
+// when a child pays for it, which lets validators collect the fees of child
+// pays for parent packages.
+type AncestorFeeRateSelector struct{}
+
+// Prepare is part of the TxSelector interface.
+func (AncestorFeeRateSelector) Prepare(items []*TxPrioItem) {
+	byHash := make(map[common.Hash]*TxPrioItem, len(items))
+	for _, item := range items {
+		item.score = item.gasPrice
+		byHash[*item.tx.Hash()] = item
+	}
+
+	for _, item := range items {
+		if len(item.dependsOn) == 0 {
+			continue
+		}
+		ancestors := make(map[common.Hash]*TxPrioItem)
+		collectAncestors(item, byHash, ancestors)
+
+		fee := float64(item.fee)
+		gasLimit := float64(item.tx.MsgTx().TxContract.GasLimit)
+		for _, ancestor := range ancestors {
+			fee += float64(ancestor.fee)
+			gasLimit += float64(ancestor.tx.MsgTx().TxContract.GasLimit)
+		}
+		if gasLimit == 0 {
+			continue
+		}
+		rate := fee / gasLimit
+		for _, ancestor := range ancestors {
+			if rate > ancestor.score {
+				ancestor.score = rate
+			}
+		}
+	}
+}
+
+// Less is part of the TxSelector interface.
+func (AncestorFeeRateSelector) Less(a, b *TxPrioItem) bool {
+	return a.score > b.score
+}
+
+// collectAncestors adds the candidates the passed item transitively depends on
+// to ancestors.
+func collectAncestors(item *TxPrioItem, byHash map[common.Hash]*TxPrioItem,
+	ancestors map[common.Hash]*TxPrioItem) {
+	for hash := range item.dependsOn {
+		if _, ok := ancestors[hash]; ok {
+			continue
+		}
+		parent, ok := byHash[hash]
+		if !ok {
+			continue
+		}
+		ancestors[hash] = parent
+		collectAncestors(parent, byHash, ancestors)
+	}
+}
+
+// canonicalSelector selects the transactions by increasing hash.  It is used
+// when the policy sets CanonicalTxOrder.
+type canonicalSelector struct{}
+
+// Prepare is part of the TxSelector interface.
+func (canonicalSelector) Prepare(items []*TxPrioItem) {}
+
+// Less is part of the TxSelector interface.
+func (canonicalSelector) Less(a, b *TxPrioItem) bool {
+	return bytes.Compare(a.tx.Hash()[:], b.tx.Hash()[:]) < 0
+}
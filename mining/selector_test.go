@@ -0,0 +1,83 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"container/heap"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// newTestPrioItem returns a priority item for a transaction paying fee for
+// gasLimit and spending the outputs of the passed parents.
+func newTestPrioItem(lockTime uint32, fee int64, gasLimit uint32, parents ...*TxPrioItem) *TxPrioItem {
+	tx := protos.NewMsgTx(protos.TxVersion)
+	tx.LockTime = lockTime
+	tx.TxContract.GasLimit = gasLimit
+	item := &TxPrioItem{
+		tx:       asiutil.NewTx(tx),
+		fee:      fee,
+		gasPrice: float64(fee) / float64(gasLimit),
+	}
+	for _, parent := range parents {
+		if item.dependsOn == nil {
+			item.dependsOn = make(map[common.Hash]struct{})
+		}
+		item.dependsOn[*parent.tx.Hash()] = struct{}{}
+	}
+	return item
+}
+
+// TestTxSelectors ensures the shipped selectors order the ready transactions
+// as expected, the ancestor fee rate selector accounting for the children
+// paying for their parents.
+func TestTxSelectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector TxSelector
+		want     []int
+	}{
+		{FeeRateSelectorName, FeeRateSelector{}, []int{1, 0}},
+		{AncestorFeeRateSelectorName, AncestorFeeRateSelector{}, []int{0, 1}},
+	}
+
+	for _, test := range tests {
+		// The parent pays less than the other transaction, but its
+		// child makes the package pay more.
+		parent := newTestPrioItem(0, 100, 100)
+		other := newTestPrioItem(1, 300, 100)
+		child := newTestPrioItem(2, 1000, 100, parent)
+		ready := []*TxPrioItem{parent, other}
+
+		selector, err := NewTxSelector(test.name)
+		if err != nil {
+			t.Fatalf("%s: NewTxSelector: %v", test.name, err)
+		}
+		if selector != test.selector {
+			t.Fatalf("%s: NewTxSelector: got %T, want %T", test.name,
+				selector, test.selector)
+		}
+		selector.Prepare([]*TxPrioItem{parent, other, child})
+
+		pq := NewTxPriorityQueue(len(ready), selector)
+		for _, item := range ready {
+			heap.Push(pq, item)
+		}
+		for i, want := range test.want {
+			got := heap.Pop(pq).(*TxPrioItem)
+			if got != ready[want] {
+				t.Fatalf("%s: pop %d: got tx %v, want %v", test.name,
+					i, got.tx.Hash(), ready[want].tx.Hash())
+			}
+		}
+	}
+
+	if _, err := NewTxSelector("unknown"); err == nil {
+		t.Fatal("NewTxSelector: expected an error for an unknown name")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+	peerpkg "github.com/AsimovNetwork/asimov/peer"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// The following constants define the anti-DoS rules applied to the headers
+// received outside of the headers-first sync.  Blocks are not protected by
+// proof of work in PoA, so headers are cheap to forge and must be bounded by
+// other means.
+const (
+	// maxHeaderForkDepth is the maximum number of blocks below the best
+	// chain tip an unsolicited headers message may fork from.
+	maxHeaderForkDepth = 100
+
+	// maxPeerSideHeaders is the maximum number of side branch headers
+	// stored for a peer while their blocks are pending.
+	maxPeerSideHeaders = 256
+
+	// headerRateInterval is the interval over which the unsolicited headers
+	// received from a peer are counted.
+	headerRateInterval = time.Minute
+
+	// maxHeadersPerInterval is the maximum number of unsolicited headers
+	// processed for a peer per rate interval.
+	maxHeadersPerInterval = 2 * protos.MaxBlockHeadersPerMsg
+
+	// headerFloodBanScore is the transient ban score added to a peer
+	// exceeding the header rate limit.
+	headerFloodBanScore = 20
+
+	// badHeadersBanScore is the transient ban score added to a peer sending
+	// headers which do not connect to a recent block or to each other.
+	badHeadersBanScore = 10
+)
+
+// headerGuard holds the state of the anti-DoS rules applied to the
+// unsolicited headers of a peer.
+type headerGuard struct {
+	windowStart time.Time
+	received    int
+
+	// sideHeaders maps the hashes of the side branch headers announced by
+	// the peer whose blocks are pending to their height.
+	sideHeaders map[common.Hash]int32
+}
+
+// newHeaderGuard returns a new header guard for a peer.
+func newHeaderGuard() *headerGuard {
+	return &headerGuard{sideHeaders: make(map[common.Hash]int32)}
+}
+
+// allow counts n headers received at the passed time and returns whether
+// they are within the rate limit of the peer.
+func (g *headerGuard) allow(n int, now time.Time) bool {
+	if now.Sub(g.windowStart) >= headerRateInterval {
+		g.windowStart = now
+		g.received = 0
+	}
+	g.received += n
+	return g.received <= maxHeadersPerInterval
+}
+
+// addSideHeader stores a side branch header and returns false when the
+// storage limit of the peer is reached.
+func (g *headerGuard) addSideHeader(hash *common.Hash, height int32) bool {
+	if _, exists := g.sideHeaders[*hash]; exists {
+		return true
+	}
+	if len(g.sideHeaders) >= maxPeerSideHeaders {
+		return false
+	}
+	g.sideHeaders[*hash] = height
+	return true
+}
+
+// sideHeaderHeight returns the height of a stored side branch header.
+func (g *headerGuard) sideHeaderHeight(hash *common.Hash) (int32, bool) {
+	height, exists := g.sideHeaders[*hash]
+	return height, exists
+}
+
+// removeSideHeader removes a stored side branch header, typically once its
+// block was received.
+func (g *headerGuard) removeSideHeader(hash *common.Hash) {
+	delete(g.sideHeaders, *hash)
+}
+
+// prune removes the stored side branch headers below the passed height as
+// they fork too deep to become the best chain.
+func (g *headerGuard) prune(minHeight int32) {
+	for hash, height := range g.sideHeaders {
+		if height < minHeight {
+			delete(g.sideHeaders, hash)
+		}
+	}
+}
+
+// handleUnsolicitedHeaders handles headers which were not requested by the
+// headers-first sync, such as the announcements of new blocks.  The headers
+// must connect to a block at most maxHeaderForkDepth blocks below the best
+// chain tip and to each other, and the blocks of the unknown ones are
+// requested.  The headers are rate limited and the side branch headers stored
+// while their blocks are pending are bounded per peer.
+func (sm *SyncManager) handleUnsolicitedHeaders(peer *peerpkg.Peer,
+	state *peerSyncState, headers []*protos.BlockHeader) {
+
+	if !state.headerGuard.allow(len(headers), time.Now()) {
+		log.Warnf("Peer %s exceeded the rate of %d headers per %v -- "+
+			"ignoring %d headers", peer, maxHeadersPerInterval,
+			headerRateInterval, len(headers))
+		peer.AddBanScore(0, headerFloodBanScore, "header flood")
+		return
+	}
+
+	// The blocks are fetched by the initial sync until the chain is
+	// current.
+	if !sm.current() {
+		return
+	}
+
+	best := sm.chain.BestSnapshot()
+	minHeight := best.Height - maxHeaderForkDepth
+	state.headerGuard.prune(minHeight)
+
+	// The first header must connect to a known block near the tip.
+	// Otherwise ask the peer for the headers linking it to our chain.
+	prevHash := &headers[0].PrevBlock
+	height, known := sm.chain.IndexedBlockHeight(prevHash)
+	if !known {
+		height, known = state.headerGuard.sideHeaderHeight(prevHash)
+	}
+	if !known {
+		log.Debugf("Received %d headers from %s which do not connect "+
+			"to a known block", len(headers), peer)
+		peer.AddBanScore(0, badHeadersBanScore, "unconnecting headers")
+		locator, err := sm.chain.LatestBlockLocator()
+		if err == nil {
+			peer.PushGetHeadersMsg(locator, &zeroHash)
+		}
+		return
+	}
+	if height < minHeight {
+		log.Warnf("Received headers from %s forking at height %d, "+
+			"more than %d blocks below the tip -- ignoring", peer,
+			height, maxHeaderForkDepth)
+		peer.AddBanScore(0, badHeadersBanScore, "headers fork too deep")
+		return
+	}
+
+	extendsTip := prevHash.IsEqual(&best.Hash)
+	gdmsg := protos.NewMsgGetData()
+	for i, header := range headers {
+		if i > 0 && !header.PrevBlock.IsEqual(prevHash) {
+			log.Warnf("Received non-continuous headers from %s -- "+
+				"ignoring", peer)
+			peer.AddBanScore(0, badHeadersBanScore, "non-continuous headers")
+			break
+		}
+		hash := header.BlockHash()
+		prevHash = &hash
+		height++
+		peer.AddKnownInventory(protos.NewInvVect(protos.InvTypeBlock, &hash))
+
+		if have, err := sm.chain.HaveBlock(&hash); err != nil || have {
+			extendsTip = hash.IsEqual(&best.Hash)
+			continue
+		}
+
+		// Headers not extending the best chain are side branch headers
+		// which are stored until their block is received, so that the
+		// next headers of the branch connect.
+		if !extendsTip && !state.headerGuard.addSideHeader(&hash, height) {
+			log.Warnf("Peer %s exceeded the limit of %d side branch "+
+				"headers -- ignoring", peer, maxPeerSideHeaders)
+			peer.AddBanScore(0, badHeadersBanScore, "side branch header flood")
+			break
+		}
+
+		if _, exists := sm.requestedBlocks[hash]; exists {
+			continue
+		}
+		if len(gdmsg.InvList) >= protos.MaxInvPerMsg {
+			continue
+		}
+		sm.requestedBlocks[hash] = struct{}{}
+		sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
+		state.requestedBlocks[hash] = struct{}{}
+		gdmsg.AddInvVect(protos.NewInvVect(protos.InvTypeBlock, &hash))
+	}
+
+	peer.UpdateLastAnnouncedBlock(prevHash)
+	if len(gdmsg.InvList) > 0 {
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// announceTestLag is the number of blocks of the chain to sync the chain of
+// the sync manager of the unsolicited headers tests lacks.
+const announceTestLag = 5
+
+// misbehavedFor returns whether the ban score of the peer was increased for
+// the passed reason.
+func (tp *testPeer) misbehavedFor(reason string) bool {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+	for _, r := range tp.misbehavior {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// newAnnounceTest returns a generator of the chain to sync and a current sync
+// manager of a chain lacking its last announceTestLag blocks, along with a
+// peer announcing the height of the sync manager.  The returned function
+// releases them.
+func newAnnounceTest(t *testing.T) (*testutil.Generator, *SyncManager, *testPeer, func()) {
+	src, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	if _, err := src.Generate(syncTestBlocks); err != nil {
+		src.Close()
+		t.Fatalf("Generate: %v", err)
+	}
+	dst, err := src.Fork(syncTestBlocks - announceTestLag)
+	if err != nil {
+		src.Close()
+		t.Fatalf("Fork: %v", err)
+	}
+	teardown := func() {
+		dst.Close()
+		src.Close()
+	}
+
+	sm := newTestSyncManager(dst.Chain())
+	peer := newTestPeer(t, "10.0.0.1:8777", syncTestBlocks-announceTestLag)
+	sm.handleNewPeerMsg(peer.Peer)
+	if sm.headersFirstMode || !sm.current() {
+		teardown()
+		t.Fatal("sync manager not current")
+	}
+	return src, sm, peer, teardown
+}
+
+// TestUnsolicitedHeaders ensures the blocks of the announced headers which
+// connect to the chain are requested, and the side branch headers stored.
+func TestUnsolicitedHeaders(t *testing.T) {
+	src, sm, peer, teardown := newAnnounceTest(t)
+	defer teardown()
+
+	blocks := src.Blocks()[syncTestBlocks-announceTestLag+1:]
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks), peer: peer.Peer})
+	state := sm.peerStates[peer.Peer]
+	for _, block := range blocks {
+		if _, ok := state.requestedBlocks[*block.Hash()]; !ok {
+			t.Errorf("block %d not requested", block.Height())
+		}
+	}
+	if n := len(state.headerGuard.sideHeaders); n != 0 {
+		t.Errorf("%d side branch headers stored for the best chain", n)
+	}
+
+	// A branch forking two blocks below the tip.
+	fork, err := src.Fork(syncTestBlocks - announceTestLag - 2)
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	defer fork.Close()
+	fork.Skip(1)
+	side, err := fork.Generate(3)
+	if err != nil {
+		t.Fatalf("Generate fork: %v", err)
+	}
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(side), peer: peer.Peer})
+	for _, block := range side {
+		if _, ok := state.requestedBlocks[*block.Hash()]; !ok {
+			t.Errorf("side block %d not requested", block.Height())
+		}
+		if _, ok := state.headerGuard.sideHeaderHeight(block.Hash()); !ok {
+			t.Errorf("side branch header %d not stored", block.Height())
+		}
+	}
+	if peer.misbehaved() {
+		t.Errorf("peer announcing valid headers misbehaved: %v", peer.misbehavior)
+	}
+}
+
+// TestUnsolicitedHeadersFlood ensures a peer sending more headers than the
+// rate limit has none of their blocks requested and is banned.
+func TestUnsolicitedHeadersFlood(t *testing.T) {
+	src, sm, peer, teardown := newAnnounceTest(t)
+	defer teardown()
+
+	header := src.Blocks()[syncTestBlocks-announceTestLag+1].MsgBlock().Header
+	msg := protos.NewMsgHeaders()
+	for i := 0; i <= maxHeadersPerInterval; i++ {
+		msg.Headers = append(msg.Headers, &header)
+	}
+	sm.handleHeadersMsg(&headersMsg{headers: msg, peer: peer.Peer})
+	if n := len(sm.peerStates[peer.Peer].requestedBlocks); n != 0 {
+		t.Errorf("%d blocks requested from a header flood", n)
+	}
+	if !peer.misbehavedFor("header flood") || !peer.disconnected() {
+		t.Errorf("peer flooding headers not banned: %v", peer.misbehavior)
+	}
+}
+
+// TestUnsolicitedHeadersUnconnected ensures a peer sending headers which do
+// not connect to a known block or to each other is banned, and the blocks of
+// the headers not connected are not requested.
+func TestUnsolicitedHeadersUnconnected(t *testing.T) {
+	src, sm, peer, teardown := newAnnounceTest(t)
+	defer teardown()
+
+	blocks := src.Blocks()[syncTestBlocks-announceTestLag+1:]
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks[1:]), peer: peer.Peer})
+	if n := len(sm.peerStates[peer.Peer].requestedBlocks); n != 0 {
+		t.Errorf("%d blocks requested from unconnected headers", n)
+	}
+	if !peer.misbehavedFor("unconnecting headers") || !peer.disconnected() {
+		t.Errorf("peer sending unconnected headers not banned: %v",
+			peer.misbehavior)
+	}
+
+	peer = newTestPeer(t, "10.0.0.2:8777", syncTestBlocks-announceTestLag)
+	sm.handleNewPeerMsg(peer.Peer)
+	msg := headersOf(blocks)
+	msg.Headers[2] = msg.Headers[3]
+	sm.handleHeadersMsg(&headersMsg{headers: msg, peer: peer.Peer})
+	state := sm.peerStates[peer.Peer]
+	for i, block := range blocks {
+		if _, ok := state.requestedBlocks[*block.Hash()]; ok != (i < 2) {
+			t.Errorf("block %d requested %v", block.Height(), ok)
+		}
+	}
+	if !peer.misbehavedFor("non-continuous headers") || !peer.disconnected() {
+		t.Errorf("peer sending non-continuous headers not banned: %v",
+			peer.misbehavior)
+	}
+}
+
+// TestHeaderGuardRate ensures the headers of a peer are counted over the rate
+// interval.
+func TestHeaderGuardRate(t *testing.T) {
+	g := newHeaderGuard()
+	now := time.Now()
+	if !g.allow(maxHeadersPerInterval, now) {
+		t.Fatal("headers within the rate limit rejected")
+	}
+	if g.allow(1, now.Add(headerRateInterval-time.Second)) {
+		t.Fatal("headers above the rate limit allowed")
+	}
+	if !g.allow(maxHeadersPerInterval, now.Add(headerRateInterval)) {
+		t.Fatal("headers of the next interval rejected")
+	}
+	if g.allow(maxHeadersPerInterval+1, now.Add(2*headerRateInterval)) {
+		t.Fatal("oversized headers batch allowed")
+	}
+}
+
+// TestHeaderGuardSideHeaders ensures the side branch headers stored for a
+// peer are bounded and pruned once they fork too deep.
+func TestHeaderGuardSideHeaders(t *testing.T) {
+	g := newHeaderGuard()
+	for i := 0; i < maxPeerSideHeaders; i++ {
+		hash := common.Hash{byte(i), byte(i >> 8)}
+		if !g.addSideHeader(&hash, int32(i)) {
+			t.Fatalf("side branch header %d rejected", i)
+		}
+	}
+	first := common.Hash{}
+	if !g.addSideHeader(&first, 0) {
+		t.Error("stored side branch header rejected again")
+	}
+	extra := common.Hash{0xff, 0xff}
+	if g.addSideHeader(&extra, maxPeerSideHeaders) {
+		t.Error("side branch header above the limit stored")
+	}
+
+	g.prune(maxPeerSideHeaders / 2)
+	if n := len(g.sideHeaders); n != maxPeerSideHeaders/2 {
+		t.Errorf("%d side branch headers left after pruning, want %d",
+			n, maxPeerSideHeaders/2)
+	}
+	if _, ok := g.sideHeaderHeight(&first); ok {
+		t.Error("side branch header below the pruning height kept")
+	}
+	if !g.addSideHeader(&extra, maxPeerSideHeaders) {
+		t.Error("side branch header rejected after pruning")
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/mempool"
+	peerpkg "github.com/AsimovNetwork/asimov/peer"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+const (
+	// headersFirstMinLag is the minimum number of blocks the sync peer
+	// must be ahead of the best chain for the sync to download the headers
+	// first.  Closer sync peers announce their blocks instead.
+	headersFirstMinLag = 1000
+
+	// maxBlocksInFlightPerPeer is the maximum number of blocks requested
+	// from a peer at a time by the headers-first sync.
+	maxBlocksInFlightPerPeer = 16
+
+	// blockDownloadWindow is the number of blocks above the last connected
+	// block which are downloaded by the headers-first sync.  It bounds the
+	// memory of the blocks received ahead of their parent.
+	blockDownloadWindow = 1024
+
+	// blockRequestTimeout is the time after which a block requested by the
+	// headers-first sync is requested from another peer.
+	blockRequestTimeout = time.Minute
+)
+
+// blockRequest is a block requested by the headers-first sync.
+type blockRequest struct {
+	height int32
+	peer   *peerpkg.Peer
+	time   time.Time
+}
+
+// syncBlock is a block received by the headers-first sync which is waiting for
+// its parent to be connected.
+type syncBlock struct {
+	block *asiutil.Block
+	peer  *peerpkg.Peer
+}
+
+// headersFirstState is the state of the headers-first sync.  The headers of
+// the best chain of the sync peer are downloaded and validated first, then the
+// blocks are requested from all the sync candidates in parallel.  The blocks
+// are received in any order and kept until their parent is connected, so the
+// blocks are still connected in order.
+type headersFirstState struct {
+	// base is the height of the block the header chain builds on and
+	// hashes[i] is the hash of the header at height base+1+i.  tip and
+	// tipHash are the last header, which the next header must connect to.
+	base    int32
+	hashes  []common.Hash
+	tip     protos.BlockHeader
+	tipHash common.Hash
+
+	// headersDone is set once the sync peer sent its last headers.
+	headersDone bool
+
+	// assumeValid is the height of the block assumed valid by the chain
+	// in the header chain, or zero when the header chain does not hold
+	// it.  The blocks up to it are connected without verifying their
+	// scripts.
+	assumeValid int32
+
+	// connected is the height of the last block connected by the sync.
+	connected int32
+
+	// pending maps the hashes of the blocks requested and not yet
+	// connected to their height, and requests the hashes of the blocks
+	// being downloaded to their current request.  A block whose request
+	// timed out stays pending, so it is still accepted from the slow peer.
+	pending  map[common.Hash]int32
+	requests map[common.Hash]*blockRequest
+	inFlight map[*peerpkg.Peer]int
+	received map[int32]*syncBlock
+}
+
+// headerHash returns the hash of the header of the sync at the passed height.
+func (hf *headersFirstState) headerHash(height int32) *common.Hash {
+	return &hf.hashes[height-hf.base-1]
+}
+
+// lastHeight returns the height of the last header of the sync.
+func (hf *headersFirstState) lastHeight() int32 {
+	return hf.base + int32(len(hf.hashes))
+}
+
+// checkSyncHeader validates a header received by the headers-first sync
+// against the header it builds on.  Only the rules which need neither the
+// state nor the validators of the round are checked, the blocks are fully
+// validated once connected.
+func (sm *SyncManager) checkSyncHeader(header, prev *protos.BlockHeader, prevHash *common.Hash) error {
+	if !header.PrevBlock.IsEqual(prevHash) {
+		return fmt.Errorf("header does not connect to %v", prevHash)
+	}
+	if header.Height != prev.Height+1 {
+		return fmt.Errorf("header height %d does not follow %d",
+			header.Height, prev.Height)
+	}
+	if header.Round < prev.Round ||
+		(header.Round == prev.Round && header.SlotIndex <= prev.SlotIndex) {
+		return fmt.Errorf("header slot %d of round %d does not follow "+
+			"slot %d of round %d", header.SlotIndex, header.Round,
+			prev.SlotIndex, prev.Round)
+	}
+	maxOffset := chaincfg.ActiveNetParams.MaxTimeOffset
+	if ahead := header.Timestamp - time.Now().Unix(); ahead > maxOffset {
+		return fmt.Errorf("header timestamp %d is %ds ahead of the local "+
+			"time, beyond the max time offset of %ds", header.Timestamp,
+			ahead, maxOffset)
+	}
+	gasLimit := blockchain.CalcGasLimit(prev.GasUsed, prev.GasLimit,
+		common.GasFloor, common.GasCeil)
+	if header.GasLimit != gasLimit || header.GasUsed > header.GasLimit {
+		return fmt.Errorf("header gas used %d and limit %d, expected "+
+			"limit %d", header.GasUsed, header.GasLimit, gasLimit)
+	}
+	hash := header.BlockHash()
+	for _, checkpoint := range sm.chain.Checkpoints() {
+		if checkpoint.Height == header.Height && !checkpoint.Hash.IsEqual(&hash) {
+			return fmt.Errorf("header at height %d does not match the "+
+				"checkpoint %v", header.Height, checkpoint.Hash)
+		}
+	}
+	return nil
+}
+
+// startHeadersFirst starts the headers-first sync from the passed peer by
+// requesting the headers following the best chain.
+func (sm *SyncManager) startHeadersFirst(peer *peerpkg.Peer, locator blockchain.BlockLocator) {
+	best := sm.chain.BestSnapshot()
+	tip, err := sm.chain.FetchHeader(&best.Hash)
+	if err != nil {
+		log.Errorf("Failed to fetch the header of the best block: %v", err)
+		peer.PushGetBlocksMsg(locator, &zeroHash)
+		return
+	}
+	sm.headersFirstMode = true
+	sm.headersFirst = &headersFirstState{
+		base:      best.Height,
+		tip:       tip,
+		tipHash:   best.Hash,
+		connected: best.Height,
+		pending:   make(map[common.Hash]int32),
+		requests:  make(map[common.Hash]*blockRequest),
+		inFlight:  make(map[*peerpkg.Peer]int),
+		received:  make(map[int32]*syncBlock),
+	}
+	log.Infof("Downloading headers for blocks %d to %d from peer %s",
+		best.Height+1, peer.LastBlock(), peer.Addr())
+	peer.PushGetHeadersMsg(locator, &zeroHash)
+}
+
+// stopHeadersFirst stops the headers-first sync.  The blocks being downloaded
+// are no longer expected and the blocks received ahead of their parent are
+// dropped.
+func (sm *SyncManager) stopHeadersFirst() {
+	for hash, req := range sm.headersFirst.requests {
+		delete(sm.requestedBlocks, hash)
+		if state, exists := sm.peerStates[req.peer]; exists {
+			delete(state.requestedBlocks, hash)
+		}
+	}
+	sm.headersFirst = nil
+	sm.headersFirstMode = false
+}
+
+// handleSyncHeaders handles the headers of the sync peer during the
+// headers-first sync.  The headers are validated and appended to the header
+// chain, and the next headers are requested until the sync peer sends less
+// than a full message.  The blocks of the headers are requested as soon as
+// they are received.
+func (sm *SyncManager) handleSyncHeaders(peer *peerpkg.Peer, headers []*protos.BlockHeader) {
+	hf := sm.headersFirst
+	if len(headers) > 0 && len(hf.hashes) == 0 && !headers[0].PrevBlock.IsEqual(&hf.tipHash) {
+		// The best chain forks from the chain of the sync peer, so the
+		// header chain builds on the fork point.
+		prevHash := &headers[0].PrevBlock
+		height, err := sm.chain.BlockHeightByHash(prevHash)
+		if err != nil || !sm.chain.MainChainHasBlock(prevHash) {
+			log.Warnf("Received headers from sync peer %s which do not "+
+				"connect to the best chain -- disconnecting", peer)
+			peer.Disconnect()
+			return
+		}
+		tip, err := sm.chain.FetchHeader(prevHash)
+		if err != nil {
+			log.Errorf("Failed to fetch header %v: %v", prevHash, err)
+			return
+		}
+		hf.base, hf.tip, hf.tipHash = height, tip, *prevHash
+		hf.connected = height
+	}
+
+	for _, header := range headers {
+		if err := sm.checkSyncHeader(header, &hf.tip, &hf.tipHash); err != nil {
+			log.Warnf("Received invalid header at height %d from sync "+
+				"peer %s: %v -- disconnecting", header.Height, peer, err)
+			peer.AddBanScore(0, badHeadersBanScore, "invalid sync header")
+			peer.Disconnect()
+			return
+		}
+		hf.tip = *header
+		hf.tipHash = header.BlockHash()
+		hf.hashes = append(hf.hashes, hf.tipHash)
+		if assumed := sm.chain.AssumeValid(); assumed != nil && assumed.IsEqual(&hf.tipHash) {
+			hf.assumeValid = header.Height
+			log.Infof("Assuming the scripts of the blocks up to height "+
+				"%d are valid", header.Height)
+		}
+	}
+	sm.lastProgressTime = time.Now()
+
+	if len(headers) < protos.MaxBlockHeadersPerMsg {
+		hf.headersDone = true
+		log.Infof("Received the headers up to height %d from peer %s",
+			hf.lastHeight(), peer)
+	} else {
+		locator := blockchain.BlockLocator([]*common.Hash{&hf.tipHash})
+		if err := peer.PushGetHeadersMsg(locator, &zeroHash); err != nil {
+			log.Warnf("Failed to send getheaders message to peer %s: %v",
+				peer.Addr(), err)
+		}
+	}
+	sm.fetchSyncBlocks()
+	sm.finishHeadersFirst()
+}
+
+// syncBlockPeer returns the sync candidate with the fewest blocks in flight
+// which announced the passed height, or nil when they all have the maximum
+// number of blocks in flight.
+func (sm *SyncManager) syncBlockPeer(height int32) *peerpkg.Peer {
+	hf := sm.headersFirst
+	var best *peerpkg.Peer
+	for peer, state := range sm.peerStates {
+		if peer != sm.syncPeer && (!state.syncCandidate || peer.LastBlock() < height) {
+			continue
+		}
+		inFlight := hf.inFlight[peer]
+		if inFlight >= maxBlocksInFlightPerPeer {
+			continue
+		}
+		if best == nil || inFlight < hf.inFlight[best] {
+			best = peer
+		}
+	}
+	return best
+}
+
+// fetchSyncBlocks requests the blocks of the download window which are neither
+// received nor being downloaded, spreading the requests over the sync
+// candidates.
+func (sm *SyncManager) fetchSyncBlocks() {
+	hf := sm.headersFirst
+	last := hf.lastHeight()
+	if limit := hf.connected + blockDownloadWindow; last > limit {
+		last = limit
+	}
+
+	gdmsgs := make(map[*peerpkg.Peer]*protos.MsgGetData)
+	for height := hf.connected + 1; height <= last; height++ {
+		hash := hf.headerHash(height)
+		if _, ok := hf.received[height]; ok {
+			continue
+		}
+		if _, ok := hf.requests[*hash]; ok {
+			continue
+		}
+		if have, err := sm.chain.HaveBlock(hash); err != nil || have {
+			continue
+		}
+		peer := sm.syncBlockPeer(height)
+		if peer == nil {
+			break
+		}
+
+		hf.pending[*hash] = height
+		hf.requests[*hash] = &blockRequest{height: height, peer: peer, time: time.Now()}
+		hf.inFlight[peer]++
+		sm.requestedBlocks[*hash] = struct{}{}
+		sm.peerStates[peer].requestedBlocks[*hash] = struct{}{}
+
+		gdmsg := gdmsgs[peer]
+		if gdmsg == nil {
+			gdmsg = protos.NewMsgGetData()
+			gdmsgs[peer] = gdmsg
+		}
+		gdmsg.AddInvVect(protos.NewInvVect(protos.InvTypeBlock, hash))
+	}
+	for peer, gdmsg := range gdmsgs {
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// releaseSyncRequest forgets the current request of a block, so the block is
+// requested again from the next peer available.
+func (sm *SyncManager) releaseSyncRequest(hash *common.Hash) {
+	hf := sm.headersFirst
+	req, ok := hf.requests[*hash]
+	if !ok {
+		return
+	}
+	delete(hf.requests, *hash)
+	if hf.inFlight[req.peer]--; hf.inFlight[req.peer] <= 0 {
+		delete(hf.inFlight, req.peer)
+	}
+}
+
+// releaseSyncPeer forgets the requests of a lost peer and requests its blocks
+// from the other peers.
+func (sm *SyncManager) releaseSyncPeer(peer *peerpkg.Peer) {
+	hf := sm.headersFirst
+	for hash, req := range hf.requests {
+		if req.peer == peer {
+			hash := hash
+			sm.releaseSyncRequest(&hash)
+		}
+	}
+	delete(hf.inFlight, peer)
+	sm.fetchSyncBlocks()
+}
+
+// handleSyncBlock handles a block requested by the headers-first sync.  The
+// block is kept until its parent is connected, then the blocks following the
+// best chain are connected and more blocks are requested.
+func (sm *SyncManager) handleSyncBlock(peer *peerpkg.Peer, state *peerSyncState,
+	block *asiutil.Block, height int32) {
+
+	hf := sm.headersFirst
+	hash := block.Hash()
+	delete(state.requestedBlocks, *hash)
+	delete(sm.requestedBlocks, *hash)
+	sm.releaseSyncRequest(hash)
+	if height <= hf.connected {
+		// The block was connected meanwhile, such as a block already
+		// known whose request had timed out.
+		delete(hf.pending, *hash)
+		return
+	}
+	if _, ok := hf.received[height]; ok {
+		return
+	}
+	hf.received[height] = &syncBlock{block: block, peer: peer}
+
+	sm.connectSyncBlocks()
+	if sm.headersFirst == nil {
+		return
+	}
+	sm.fetchSyncBlocks()
+	sm.finishHeadersFirst()
+}
+
+// connectSyncBlocks connects the received blocks following the last connected
+// block.  A rejected block stops the headers-first sync when the header chain
+// is at fault, otherwise the peer which sent it is disconnected and the block
+// is requested from another peer.
+func (sm *SyncManager) connectSyncBlocks() {
+	hf := sm.headersFirst
+	for hf.connected < hf.lastHeight() {
+		height := hf.connected + 1
+		hash := hf.headerHash(height)
+		sb, ok := hf.received[height]
+		if !ok {
+			// The blocks already known, such as the blocks of a side
+			// chain, are not downloaded.
+			_, requested := hf.requests[*hash]
+			if have, err := sm.chain.HaveBlock(hash); err != nil || !have || requested {
+				break
+			}
+			hf.connected = height
+			continue
+		}
+
+		flags := common.BFNone
+		if height <= hf.assumeValid {
+			flags |= common.BFAssumeValid
+		}
+		_, isOrphan, err := sm.chain.ProcessBlock(sb.block, nil, nil, nil, flags)
+		sm.auditLog.Block(hash, height, sb.peer.Addr(), isOrphan, err)
+		if err == blockchain.ErrAcceptancePaused {
+			// The block is connected once the acceptance resumes.
+			log.Debugf("Delaying block %v: %v", hash, err)
+			break
+		}
+		delete(hf.received, height)
+		delete(hf.pending, *hash)
+		if err != nil || isOrphan {
+			sm.rejectSyncBlock(sb, err)
+			return
+		}
+
+		sm.lastProgressTime = time.Now()
+		sm.progressLogger.LogBlockHeight(sb.block)
+		hf.connected = height
+	}
+
+	// Drop the hashes of the connected blocks once they fill a download
+	// window.
+	if n := hf.connected - hf.base; n >= blockDownloadWindow {
+		hf.hashes = append([]common.Hash(nil), hf.hashes[n:]...)
+		hf.base = hf.connected
+	}
+}
+
+// rejectSyncBlock handles a block of the headers-first sync rejected by the
+// chain.  The block matches its header, so a block whose transactions do not
+// match the merkle root of the header was altered by the peer which sent it.
+// Any other rejection means the header chain of the sync peer is invalid, in
+// which case the sync restarts from another peer.
+func (sm *SyncManager) rejectSyncBlock(sb *syncBlock, err error) {
+	hash := sb.block.Hash()
+	if err == nil {
+		err = fmt.Errorf("block is an orphan")
+	}
+	if _, ok := err.(blockchain.RuleError); ok {
+		log.Infof("Rejected block %v from %s: %v", hash, sb.peer, err)
+	} else {
+		log.Errorf("Failed to process block %v: %v", hash, err)
+	}
+	code, reason := mempool.ErrToRejectErr(err)
+	sb.peer.PushRejectMsg(protos.CmdBlock, code, reason, hash, false)
+
+	if rerr, ok := err.(blockchain.RuleError); ok && rerr.ErrorCode == blockchain.ErrBadMerkleRoot {
+		sb.peer.Disconnect()
+		return
+	}
+	log.Warnf("Header chain of sync peer %s is invalid at height %d -- "+
+		"restarting the sync", sm.syncPeer, sb.block.Height())
+	sm.updateSyncPeer(true)
+}
+
+// retrySyncBlocks requests the blocks whose request timed out from other
+// peers, and connects the received blocks whose acceptance was paused.
+func (sm *SyncManager) retrySyncBlocks() {
+	hf := sm.headersFirst
+	now := time.Now()
+	for hash, req := range hf.requests {
+		if now.Sub(req.time) < blockRequestTimeout {
+			continue
+		}
+		log.Debugf("Block %v requested from %s timed out", hash, req.peer)
+		hash := hash
+		sm.releaseSyncRequest(&hash)
+	}
+	sm.connectSyncBlocks()
+	if sm.headersFirst == nil {
+		return
+	}
+	sm.fetchSyncBlocks()
+	sm.finishHeadersFirst()
+}
+
+// finishHeadersFirst switches to the normal sync once all the headers of the
+// sync peer are received and their blocks connected.  The blocks found by the
+// sync peer meanwhile are then requested as usual.
+func (sm *SyncManager) finishHeadersFirst() {
+	hf := sm.headersFirst
+	if !hf.headersDone || hf.connected < hf.lastHeight() {
+		return
+	}
+	log.Infof("Headers-first sync reached height %d -- switching to "+
+		"normal mode", hf.connected)
+	sm.stopHeadersFirst()
+	if sm.syncPeer == nil {
+		return
+	}
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Errorf("Failed to get block locator for the latest block: %v",
+			err)
+		return
+	}
+	if err := sm.syncPeer.PushGetBlocksMsg(locator, &zeroHash); err != nil {
+		log.Warnf("Failed to send getblocks message to peer %s: %v",
+			sm.syncPeer.Addr(), err)
+	}
+}
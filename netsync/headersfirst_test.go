@@ -0,0 +1,455 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	peerpkg "github.com/AsimovNetwork/asimov/peer"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// syncTestBlocks is the number of blocks of the chain synced by the tests.
+const syncTestBlocks = 20
+
+// testPeer is a peer which is never connected, so the messages queued to it
+// are dropped, along with the reasons of its misbehaviors.
+type testPeer struct {
+	*peerpkg.Peer
+
+	mtx         sync.Mutex
+	misbehavior []string
+}
+
+// newTestPeer returns a full node peer announcing the passed height.
+func newTestPeer(t *testing.T, addr string, lastBlock int32) *testPeer {
+	tp := &testPeer{}
+	p, err := peerpkg.NewOutboundPeer(&peerpkg.Config{
+		ChainParams: chaincfg.ActiveNetParams.Params,
+		Services:    common.SFNodeNetwork,
+		Listeners: peerpkg.MessageListeners{
+			OnMisbehavior: func(p *peerpkg.Peer, reason string) {
+				tp.mtx.Lock()
+				tp.misbehavior = append(tp.misbehavior, reason)
+				tp.mtx.Unlock()
+			},
+		},
+	}, addr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: %v", err)
+	}
+	p.UpdateLastBlockHeight(lastBlock)
+	tp.Peer = p
+	return tp
+}
+
+// misbehaved returns whether the ban score of the peer was increased.
+func (tp *testPeer) misbehaved() bool {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+	return len(tp.misbehavior) > 0
+}
+
+// disconnected returns whether the peer was disconnected.
+func (tp *testPeer) disconnected() bool {
+	done := make(chan struct{})
+	go func() {
+		tp.WaitForDisconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+// newTestSyncManager returns a sync manager of the passed chain whose
+// handlers are called directly by the tests.  It is neither started nor
+// subscribed to the chain notifications, which need the mempools.
+func newTestSyncManager(chain *blockchain.BlockChain) *SyncManager {
+	return &SyncManager{
+		chain:           chain,
+		chainParams:     chaincfg.ActiveNetParams.Params,
+		progressLogger:  newBlockProgressLogger("Processed", log),
+		rejectedTxns:    make(map[common.Hash]struct{}),
+		requestedTxns:   make(map[common.Hash]struct{}),
+		rejectedSigns:   make(map[common.Hash]struct{}),
+		requestedSigns:  make(map[common.Hash]struct{}),
+		requestedBlocks: make(map[common.Hash]struct{}),
+		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
+		quit:            make(chan struct{}),
+		signedHeight:    make(map[int32]interface{}),
+	}
+}
+
+// newSyncTest returns a generator of the chain to sync and a sync manager of a
+// chain holding its genesis block only.  The returned function releases them.
+func newSyncTest(t *testing.T) (*testutil.Generator, *SyncManager, func()) {
+	src, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	if _, err := src.Generate(syncTestBlocks); err != nil {
+		src.Close()
+		t.Fatalf("Generate: %v", err)
+	}
+	dst, err := src.Fork(0)
+	if err != nil {
+		src.Close()
+		t.Fatalf("Fork: %v", err)
+	}
+	return src, newTestSyncManager(dst.Chain()), func() {
+		dst.Close()
+		src.Close()
+	}
+}
+
+// headersOf returns a headers message of the passed blocks.
+func headersOf(blocks []*asiutil.Block) *protos.MsgHeaders {
+	msg := protos.NewMsgHeaders()
+	for _, block := range blocks {
+		header := block.MsgBlock().Header
+		msg.AddBlockHeader(&header)
+	}
+	return msg
+}
+
+// sendBlock delivers a copy of the passed block from the peer.
+func sendBlock(sm *SyncManager, peer *testPeer, block *asiutil.Block) {
+	sm.handleBlockMsg(&blockMsg{
+		block: asiutil.NewBlock(block.MsgBlock()),
+		peer:  peer.Peer,
+	})
+}
+
+// expireRequests makes the current requests of the passed heights time out.
+func expireRequests(hf *headersFirstState, heights ...int32) {
+	for _, req := range hf.requests {
+		for _, height := range heights {
+			if req.height == height {
+				req.time = time.Now().Add(-blockRequestTimeout)
+			}
+		}
+	}
+}
+
+// TestCheckSyncHeader ensures the headers of the headers-first sync which do
+// not follow the previous header are rejected.
+func TestCheckSyncHeader(t *testing.T) {
+	src, sm, teardown := newSyncTest(t)
+	defer teardown()
+
+	blocks := src.Blocks()
+	prev := blocks[0].MsgBlock().Header
+	prevHash := prev.BlockHash()
+	valid := blocks[1].MsgBlock().Header
+	maxOffset := chaincfg.ActiveNetParams.MaxTimeOffset
+
+	tests := []struct {
+		name   string
+		modify func(header *protos.BlockHeader)
+		valid  bool
+	}{
+		{"valid", func(header *protos.BlockHeader) {}, true},
+		{"not connected", func(header *protos.BlockHeader) {
+			header.PrevBlock = common.Hash{0x01}
+		}, false},
+		{"height skipped", func(header *protos.BlockHeader) {
+			header.Height++
+		}, false},
+		{"slot repeated", func(header *protos.BlockHeader) {
+			header.Round, header.SlotIndex = prev.Round, prev.SlotIndex
+		}, false},
+		{"timestamp ahead", func(header *protos.BlockHeader) {
+			header.Timestamp = time.Now().Unix() + maxOffset + 60
+		}, false},
+		{"gas limit", func(header *protos.BlockHeader) {
+			header.GasLimit++
+		}, false},
+		{"gas used", func(header *protos.BlockHeader) {
+			header.GasUsed = header.GasLimit + 1
+		}, false},
+	}
+	for _, test := range tests {
+		header := valid
+		test.modify(&header)
+		err := sm.checkSyncHeader(&header, &prev, &prevHash)
+		if test.valid && err != nil {
+			t.Errorf("%s: header rejected: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: header accepted", test.name)
+		}
+	}
+}
+
+// TestHeadersFirstInvalidHeaders ensures a sync peer sending an invalid header
+// chain is disconnected and none of its blocks is requested.
+func TestHeadersFirstInvalidHeaders(t *testing.T) {
+	src, sm, teardown := newSyncTest(t)
+	defer teardown()
+
+	blocks := src.Blocks()[1:]
+	peer := newTestPeer(t, "10.0.0.1:8777", headersFirstMinLag+syncTestBlocks)
+	sm.handleNewPeerMsg(peer.Peer)
+	if !sm.headersFirstMode || sm.syncPeer != peer.Peer {
+		t.Fatal("headers-first sync not started from the peer")
+	}
+
+	msg := headersOf(blocks)
+	msg.Headers[5].GasLimit++
+	sm.handleHeadersMsg(&headersMsg{headers: msg, peer: peer.Peer})
+	if !peer.disconnected() || !peer.misbehaved() {
+		t.Error("peer sending an invalid header not disconnected")
+	}
+	if n := len(sm.headersFirst.hashes); n != 5 {
+		t.Errorf("%d headers kept, want the 5 valid ones", n)
+	}
+	if n := len(sm.headersFirst.requests); n != 0 {
+		t.Errorf("%d blocks requested from an invalid header chain", n)
+	}
+
+	// Headers which connect to no block of the best chain.
+	bad := peer
+	peer = newTestPeer(t, "10.0.0.2:8777", headersFirstMinLag+syncTestBlocks)
+	sm.handleNewPeerMsg(peer.Peer)
+	sm.handleDonePeerMsg(bad.Peer)
+	if sm.syncPeer != peer.Peer {
+		t.Fatal("headers-first sync not restarted from the second peer")
+	}
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks[1:]), peer: peer.Peer})
+	if !peer.disconnected() {
+		t.Error("peer sending unconnected headers not disconnected")
+	}
+	if n := len(sm.headersFirst.hashes); n != 0 {
+		t.Errorf("%d unconnected headers kept", n)
+	}
+}
+
+// TestHeadersFirstOutOfOrder ensures the blocks of the headers-first sync are
+// requested from all the sync candidates, connected in order whatever the
+// order they arrive in, and that the sync switches back to the normal mode
+// once the blocks of all the headers are connected.
+func TestHeadersFirstOutOfOrder(t *testing.T) {
+	src, sm, teardown := newSyncTest(t)
+	defer teardown()
+
+	lastBlock := int32(headersFirstMinLag + syncTestBlocks)
+	peerA := newTestPeer(t, "10.0.0.1:8777", lastBlock)
+	peerB := newTestPeer(t, "10.0.0.2:8777", lastBlock)
+	sm.handleNewPeerMsg(peerA.Peer)
+	sm.handleNewPeerMsg(peerB.Peer)
+	if !sm.headersFirstMode || sm.syncPeer != peerA.Peer {
+		t.Fatal("headers-first sync not started from the first peer")
+	}
+
+	blocks := src.Blocks()
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks[1:]), peer: peerA.Peer})
+	hf := sm.headersFirst
+	if !hf.headersDone || hf.lastHeight() != syncTestBlocks {
+		t.Fatalf("header chain up to %d, done %v, want up to %d",
+			hf.lastHeight(), hf.headersDone, syncTestBlocks)
+	}
+	if len(hf.requests) != syncTestBlocks {
+		t.Fatalf("%d blocks requested, want %d", len(hf.requests), syncTestBlocks)
+	}
+	if hf.inFlight[peerA.Peer] != syncTestBlocks/2 || hf.inFlight[peerB.Peer] != syncTestBlocks/2 {
+		t.Errorf("blocks in flight %d and %d, want %d from each peer",
+			hf.inFlight[peerA.Peer], hf.inFlight[peerB.Peer], syncTestBlocks/2)
+	}
+
+	// The blocks are received last first, so none connects before the
+	// first one arrives.
+	chain := sm.chain
+	for height := syncTestBlocks; height >= 1; height-- {
+		hash := blocks[height].Hash()
+		peer := peerA
+		if hf.requests[*hash].peer == peerB.Peer {
+			peer = peerB
+		}
+		sendBlock(sm, peer, blocks[height])
+		if height > 1 && chain.BestSnapshot().Height != 0 {
+			t.Fatalf("block %d connected before its parent", height)
+		}
+	}
+	if best := chain.BestSnapshot(); best.Hash != *blocks[syncTestBlocks].Hash() {
+		t.Fatalf("best block %v at height %d, want the last synced block",
+			best.Hash, best.Height)
+	}
+	if len(hf.pending) != 0 || len(hf.received) != 0 || len(hf.requests) != 0 {
+		t.Errorf("%d pending, %d received and %d requested blocks left",
+			len(hf.pending), len(hf.received), len(hf.requests))
+	}
+	if peerA.misbehaved() || peerB.misbehaved() {
+		t.Error("peer sending the requested blocks misbehaved")
+	}
+
+	// The sync switches back to the normal mode from the same sync peer.
+	if sm.headersFirstMode || sm.headersFirst != nil {
+		t.Error("headers-first sync not stopped once the blocks are connected")
+	}
+	if sm.syncPeer != peerA.Peer {
+		t.Error("sync peer changed switching to the normal sync")
+	}
+	if len(sm.requestedBlocks) != 0 {
+		t.Errorf("%d blocks still expected", len(sm.requestedBlocks))
+	}
+}
+
+// TestHeadersFirstAcceptancePaused ensures the blocks of the headers-first
+// sync received while the acceptance of new blocks is paused are connected
+// once it resumes.
+func TestHeadersFirstAcceptancePaused(t *testing.T) {
+	src, sm, teardown := newSyncTest(t)
+	defer teardown()
+
+	lastBlock := int32(headersFirstMinLag + syncTestBlocks)
+	peer := newTestPeer(t, "10.0.0.1:8777", lastBlock)
+	sm.handleNewPeerMsg(peer.Peer)
+	if !sm.headersFirstMode {
+		t.Fatal("headers-first sync not started")
+	}
+	blocks := src.Blocks()
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks[1:]), peer: peer.Peer})
+
+	chain := sm.chain
+	chain.PauseAcceptance("disk full")
+	for height := 1; height <= syncTestBlocks; height++ {
+		sendBlock(sm, peer, blocks[height])
+	}
+	if height := chain.BestSnapshot().Height; height != 0 {
+		t.Fatalf("block %d connected while the acceptance is paused", height)
+	}
+
+	chain.ResumeAcceptance()
+	sm.handleAcceptanceResumed()
+	if best := chain.BestSnapshot(); best.Hash != *blocks[syncTestBlocks].Hash() {
+		t.Fatalf("best block %v at height %d, want the last synced block",
+			best.Hash, best.Height)
+	}
+	if sm.headersFirstMode {
+		t.Error("headers-first sync not stopped once the blocks are connected")
+	}
+	if peer.misbehaved() {
+		t.Error("peer sending the requested blocks misbehaved")
+	}
+}
+
+// TestHeadersFirstStalling ensures the blocks whose request timed out are
+// requested from other peers while still accepted from the slow peer, and
+// that a stalled sync peer is replaced.
+func TestHeadersFirstStalling(t *testing.T) {
+	src, sm, teardown := newSyncTest(t)
+	defer teardown()
+
+	lastBlock := int32(headersFirstMinLag + syncTestBlocks)
+	peerA := newTestPeer(t, "10.0.0.1:8777", lastBlock)
+	sm.handleNewPeerMsg(peerA.Peer)
+	blocks := src.Blocks()
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks[1:]), peer: peerA.Peer})
+	hf := sm.headersFirst
+	if hf.inFlight[peerA.Peer] != maxBlocksInFlightPerPeer {
+		t.Fatalf("%d blocks in flight from the sync peer, want %d",
+			hf.inFlight[peerA.Peer], maxBlocksInFlightPerPeer)
+	}
+
+	// The requests time out once another peer is available, so the
+	// blocks are spread over both peers.
+	peerB := newTestPeer(t, "10.0.0.2:8777", lastBlock)
+	sm.handleNewPeerMsg(peerB.Peer)
+	for height := int32(1); height <= maxBlocksInFlightPerPeer; height++ {
+		expireRequests(hf, height)
+	}
+	sm.handleStallSample()
+	if len(hf.requests) != syncTestBlocks {
+		t.Fatalf("%d blocks requested after the time out, want %d",
+			len(hf.requests), syncTestBlocks)
+	}
+	if hf.inFlight[peerB.Peer] != syncTestBlocks/2 {
+		t.Errorf("%d blocks requested from the other peer, want %d",
+			hf.inFlight[peerB.Peer], syncTestBlocks/2)
+	}
+
+	// The slow peer still delivers a block now requested from the other
+	// peer.
+	var late int32
+	for _, req := range hf.requests {
+		if req.peer == peerB.Peer && (late == 0 || req.height < late) {
+			late = req.height
+		}
+	}
+	for height := int32(1); height <= late; height++ {
+		sendBlock(sm, peerA, blocks[height])
+	}
+	if best := sm.chain.BestSnapshot(); best.Height != late {
+		t.Fatalf("best height %d, want %d", best.Height, late)
+	}
+	if peerA.misbehaved() {
+		t.Error("slow peer punished for a block requested from it")
+	}
+
+	// The sync peer stalls, so it is disconnected and the sync restarts
+	// from the other peer.
+	sm.lastProgressTime = time.Now().Add(-maxStallDuration - time.Minute)
+	sm.handleStallSample()
+	if !peerA.disconnected() {
+		t.Fatal("stalled sync peer not disconnected")
+	}
+	sm.handleDonePeerMsg(peerA.Peer)
+	if sm.syncPeer != peerB.Peer || !sm.headersFirstMode {
+		t.Fatal("headers-first sync not restarted from the other peer")
+	}
+	if sm.headersFirst == hf || sm.headersFirst.connected != late {
+		t.Errorf("restarted sync from height %d, want %d",
+			sm.headersFirst.connected, late)
+	}
+}
+
+// TestHeadersFirstKnownBlock ensures a block connected while its request timed
+// out is no longer pending once the slow peer delivers it.
+func TestHeadersFirstKnownBlock(t *testing.T) {
+	src, sm, teardown := newSyncTest(t)
+	defer teardown()
+
+	peer := newTestPeer(t, "10.0.0.1:8777", headersFirstMinLag+syncTestBlocks)
+	sm.handleNewPeerMsg(peer.Peer)
+	blocks := src.Blocks()
+	sm.handleHeadersMsg(&headersMsg{headers: headersOf(blocks[1:]), peer: peer.Peer})
+	hf := sm.headersFirst
+
+	// The first block is connected by other means while its request
+	// times out, so the sync skips it.
+	_, _, err := sm.chain.ProcessBlock(asiutil.NewBlock(blocks[1].MsgBlock()),
+		nil, nil, nil, common.BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	expireRequests(hf, 1)
+	sm.handleStallSample()
+	if hf.connected != 1 {
+		t.Fatalf("sync connected up to %d, want 1", hf.connected)
+	}
+	hash := blocks[1].Hash()
+	if _, ok := hf.requests[*hash]; ok {
+		t.Fatal("known block requested again")
+	}
+
+	sendBlock(sm, peer, blocks[1])
+	if _, ok := hf.pending[*hash]; ok {
+		t.Error("known block still pending once delivered")
+	}
+	if peer.misbehaved() || peer.disconnected() {
+		t.Error("slow peer punished for a block requested from it")
+	}
+}
@@ -7,6 +7,7 @@ package netsync
 
 import (
 	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/audit"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/chaincfg"
 	"github.com/AsimovNetwork/asimov/common"
@@ -30,6 +31,8 @@ type PeerNotifier interface {
 	TransactionConfirmed(tx *asiutil.Tx)
 
 	AnnounceNewSignature(sig *asiutil.BlockSign)
+
+	PushBlock(block *asiutil.Block)
 }
 
 // Config is a configuration struct used to initialize a new SyncManager.
@@ -44,5 +47,19 @@ type Config struct {
 	MaxPeers           int
 
 	Account *crypto.Account
+
+	// SigningAccount returns the account signing at the passed height when
+	// the validator key is scheduled to change.  Account is used at all
+	// heights when it is nil.
+	SigningAccount func(height int32) *crypto.Account
+
 	BroadcastMessage func(msg protos.Message, exclPeers ...interface{})
+
+	// BlockPush enables pushing the blocks produced by the account to the
+	// whitelisted peers and accepting the blocks they push.
+	BlockPush bool
+
+	// AuditLog records the acceptance decisions of blocks and transactions.
+	// It may be nil.
+	AuditLog *audit.Log
 }
@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/mempool"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// signNotifier is a peer notifier collecting the announced block signatures.
+type signNotifier struct {
+	PeerNotifier
+	sigs []*asiutil.BlockSign
+}
+
+func (n *signNotifier) AnnounceNewSignature(sig *asiutil.BlockSign) {
+	n.sigs = append(n.sigs, sig)
+}
+
+// TestSigningKeyRotation ensures the blocks are signed with the current key
+// below the rotation height and with the next one from it on, and that the
+// signatures verify against the address of the key signing at their height.
+func TestSigningKeyRotation(t *testing.T) {
+	const blocks, rotateHeight = 9, 5
+
+	// The block times follow the slots, which start recently enough for
+	// the blocks to be signed.
+	g, err := testutil.New(&testutil.Config{
+		Keys:           chaincfg.DevKeys[:3],
+		ChainStartTime: time.Now().Unix() - 60,
+	})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	generated, err := g.Generate(blocks)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	current, next := g.Accounts()[1], g.Accounts()[2]
+	notifier := &signNotifier{}
+	sm := newTestSyncManager(g.Chain())
+	sm.peerNotifier = notifier
+	sm.sigMemPool = mempool.NewSigPool()
+	sm.account = current
+	sm.signingAccount = func(height int32) *crypto.Account {
+		if height < rotateHeight {
+			return current
+		}
+		return next
+	}
+
+	signers := make(map[int32]*crypto.Account)
+	for _, block := range generated {
+		sm.makeSignature(block)
+		signer := sm.accountAt(block.Height())
+		if block.MsgBlock().Header.CoinBase != *signer.Address {
+			signers[block.Height()] = signer
+		}
+	}
+	if len(notifier.sigs) != len(signers) {
+		t.Fatalf("%d blocks signed, want %d", len(notifier.sigs), len(signers))
+	}
+	for _, sig := range notifier.sigs {
+		msg := sig.MsgSign
+		signer, ok := signers[msg.BlockHeight]
+		if !ok {
+			t.Fatalf("block %d signed by its producer", msg.BlockHeight)
+		}
+		if msg.Signer != *signer.Address {
+			t.Errorf("block %d signed by %v, want %v", msg.BlockHeight,
+				msg.Signer.String(), signer.Address.String())
+		}
+		err := blockchain.AddressVerifySignature(msg.BlockHash[:],
+			signer.Address, msg.Signature[:])
+		if err != nil {
+			t.Errorf("signature of block %d: %v", msg.BlockHeight, err)
+		}
+		if !sm.sigMemPool.HaveSignature(sig.Hash()) {
+			t.Errorf("signature of block %d not in the pool", msg.BlockHeight)
+		}
+	}
+	for _, acc := range []*crypto.Account{current, next} {
+		found := false
+		for _, signer := range signers {
+			found = found || signer == acc
+		}
+		if !found {
+			t.Errorf("no block signed with %v", acc.Address.String())
+		}
+	}
+}
@@ -6,9 +6,9 @@
 package netsync
 
 import (
-	"container/list"
 	"github.com/AsimovNetwork/asimov/mining"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+	"fmt"
 	"math/rand"
 	"net"
 	"sync"
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"crypto/ecdsa"
+	"github.com/AsimovNetwork/asimov/audit"
 	"github.com/AsimovNetwork/asimov/asiutil"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/chaincfg"
@@ -28,11 +29,6 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
-
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
 	maxRejectedTxns = 1000
@@ -58,6 +54,10 @@ const (
 	maxRequestedSigns = protos.MaxInvPerMsg
 
 	maxOrphanBlock = 20
+
+	// unrequestedBlockBanScore is the persistent ban score added to a peer
+	// sending a block which was not requested.
+	unrequestedBlockBanScore = 20
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -136,6 +136,11 @@ type processBlockMsg struct {
 	reply  chan processBlockResponse
 }
 
+// acceptanceResumedMsg is a message type to be sent across the message
+// channel when the chain accepts new blocks again after the acceptance was
+// paused.
+type acceptanceResumedMsg struct{}
+
 // isCurrentMsg is a message type to be sent across the message channel for
 // requesting whether or not the sync manager believes it is synced with the
 // currently connected peers.
@@ -152,11 +157,13 @@ type pauseMsg struct {
 	unpause <-chan struct{}
 }
 
-// headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
-type headerNode struct {
-	height int32
+// requestBlockMsg is a message type to be sent across the message channel
+// for requesting a block from a specific peer.
+type requestBlockMsg struct {
 	hash   *common.Hash
+	height int32
+	peerID int32
+	reply  chan error
 }
 
 // peerSyncState stores additional information that the SyncManager tracks
@@ -168,6 +175,7 @@ type peerSyncState struct {
 	requestedSigns  map[common.Hash]struct{}
 	syncCandidate   bool
 	orphanBlocks    int32
+	headerGuard     *headerGuard
 }
 
 // SyncManager is used to communicate block related messages with peers. The
@@ -200,60 +208,19 @@ type SyncManager struct {
 
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
-	headerList       *list.List
-	startHeader      *list.Element
-	nextCheckpoint   *chaincfg.Checkpoint
+	headersFirst     *headersFirstState
 
-	account      *crypto.Account
-	signedHeight map[int32]interface{}
-	tipHeight    int32
+	account        *crypto.Account
+	signingAccount func(height int32) *crypto.Account
+	signedHeight   map[int32]interface{}
+	tipHeight      int32
 	BroadcastMessage func(msg protos.Message, exclPeers ...interface{})
 
 	isCurrent int32
-}
-
-// resetHeaderState sets the headers-first mode state to values appropriate for
-// syncing from a new peer.
-func (sm *SyncManager) resetHeaderState(newestHash *common.Hash, newestHeight int32) {
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	sm.startHeader = nil
+	blockPush bool
 
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if sm.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		sm.headerList.PushBack(&node)
-	}
-}
-
-// findNextHeaderCheckpoint returns the next checkpoint after the passed height.
-// It returns nil when there is not one either because the height is already
-// later than the final checkpoint or some other reason such as disabled
-// checkpoints.
-func (sm *SyncManager) findNextHeaderCheckpoint(height int32) *chaincfg.Checkpoint {
-	checkpoints := sm.chain.Checkpoints()
-	if len(checkpoints) == 0 {
-		return nil
-	}
-
-	// There is no next checkpoint if the height is already after the final
-	// checkpoint.
-	finalCheckpoint := &checkpoints[len(checkpoints)-1]
-	if height >= finalCheckpoint.Height {
-		return nil
-	}
-
-	// Find the next checkpoint.
-	nextCheckpoint := finalCheckpoint
-	for i := len(checkpoints) - 2; i >= 0; i-- {
-		if height >= checkpoints[i].Height {
-			break
-		}
-		nextCheckpoint = &checkpoints[i]
-	}
-	return nextCheckpoint
+	// auditLog records the acceptance decisions of blocks and transactions.
+	auditLog *audit.Log
 }
 
 // startSync will choose the best peer among the available candidate peers to
@@ -330,32 +297,24 @@ func (sm *SyncManager) startSync() {
 		log.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
+		// When the best peer is far ahead, download and validate the
+		// header chain first, then the blocks from all the sync
+		// candidates in parallel.  This is possible since each header
+		// contains the hash of the previous header and a merkle root.
+		// Therefore once the headers link together properly, the hashes
+		// of the blocks in between are known, and once the full blocks
+		// are downloaded, the merkle root is computed and compared
+		// against the value in the header which proves the full block
+		// hasn't been tampered with.
 		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
-		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
+		// Closer peers use standard inv messages to learn about the
+		// blocks.  Regression test mode does not support the
+		// headers-first approach so do normal block downloads when in
+		// regression test mode.
+		if bestPeer.LastBlock()-best.Height >= headersFirstMinLag &&
 			sm.chainParams != &chaincfg.RegressionNetParams {
 
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-			sm.headersFirstMode = true
-			log.Infof("Downloading headers for blocks %d to "+
-				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
+			sm.startHeadersFirst(bestPeer, locator)
 		} else {
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
@@ -416,6 +375,7 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		requestedTxns:   make(map[common.Hash]struct{}),
 		requestedBlocks: make(map[common.Hash]struct{}),
 		requestedSigns:  make(map[common.Hash]struct{}),
+		headerGuard:     newHeaderGuard(),
 	}
 
 	// Start syncing by choosing the best candidate if needed.
@@ -438,6 +398,12 @@ func (sm *SyncManager) handleStallSample() {
 		return
 	}
 
+	// Request the blocks of the headers-first sync which timed out from
+	// other peers.
+	if sm.headersFirstMode {
+		sm.retrySyncBlocks()
+	}
+
 	// If the stall timeout has not elapsed, exit early.
 	if time.Since(sm.lastProgressTime) <= maxStallDuration {
 		return
@@ -498,6 +464,10 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 		// Update the sync peer. The server has already disconnected the
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
+	} else if sm.headersFirstMode {
+		// Request the blocks the peer was downloading from the other
+		// peers.
+		sm.releaseSyncPeer(peer)
 	}
 }
 
@@ -526,8 +496,8 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 
 // updateSyncPeer choose a new sync peer to replace the current one. If
 // dcSyncPeer is true, this method will also disconnect the current sync peer.
-// If we are in header first mode, any header state related to prefetching is
-// also reset in preparation for the next sync peer.
+// If we are in header first mode, the headers-first sync is stopped in
+// preparation for the next sync peer.
 func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 	log.Debugf("Updating sync peer, no progress for: %v",
 		time.Since(sm.lastProgressTime))
@@ -537,10 +507,10 @@ func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 		sm.syncPeer.Disconnect()
 	}
 
-	// Reset any header state before we choose our next active sync peer.
+	// Stop the headers-first sync before we choose our next active sync
+	// peer, the header chain being the one of the current sync peer.
 	if sm.headersFirstMode {
-		best := sm.chain.BestSnapshot()
-		sm.resetHeaderState(&best.Hash, best.Height)
+		sm.stopHeadersFirst()
 	}
 
 	sm.syncPeer = nil
@@ -587,6 +557,7 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	delete(state.requestedTxns, *txHash)
 	delete(sm.requestedTxns, *txHash)
 
+	sm.auditLog.Tx(txHash, peer.Addr(), err == nil && len(acceptedTxs) == 0, err)
 	if err != nil {
 		// Do not request this transaction again until a new block
 		// has been processed.
@@ -719,9 +690,20 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		return
 	}
 
-	// If we didn't ask for this block then the peer is misbehaving.
+	// If we didn't ask for this block then the peer is misbehaving, unless
+	// it is a whitelisted peer pushing its blocks.
 	blockHash := bmsg.block.Hash()
-	if _, exists = state.requestedBlocks[*blockHash]; !exists {
+	_, requested := state.requestedBlocks[*blockHash]
+	pushed := !requested && sm.blockPush && peer.IsWhitelisted()
+	if pushed {
+		// The same block may be pushed by several peers of the mesh,
+		// so the duplicates are ignored rather than rejected.
+		if have, err := sm.chain.HaveBlock(blockHash); err == nil && have {
+			log.Tracef("Ignoring duplicate pushed block %v from %s",
+				blockHash, peer)
+			return
+		}
+	} else if !requested {
 		// The regression test intentionally sends some blocks twice
 		// to test duplicate block insertion fails.  Don't disconnect
 		// the peer or ignore the block when we're in regression test
@@ -730,32 +712,24 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		if sm.chainParams != &chaincfg.RegressionNetParams {
 			log.Warnf("Got unrequested block %v from %s -- "+
 				"disconnecting", blockHash, peer.Addr())
+			peer.AddBanScore(unrequestedBlockBanScore, 0, "unrequested block")
 			peer.Disconnect()
 			return
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
-	behaviorFlags := common.BFNone
+	// When in headers-first mode, the blocks of the header chain are
+	// connected in order by the headers-first sync.  A block requested
+	// again after a timeout may be received twice, the late one is simply
+	// ignored.
 	if sm.headersFirstMode {
-		firstNodeEl := sm.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				//behaviorFlags |= common.BFFastAdd
-				if firstNode.hash.IsEqual(sm.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					sm.headerList.Remove(firstNodeEl)
-				}
-			}
+		if height, ok := sm.headersFirst.pending[*blockHash]; ok {
+			sm.handleSyncBlock(peer, state, bmsg.block, height)
+			return
+		}
+		if have, err := sm.chain.HaveBlock(blockHash); err == nil && have {
+			delete(state.requestedBlocks, *blockHash)
+			return
 		}
 	}
 
@@ -764,6 +738,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
+	state.headerGuard.removeSideHeader(blockHash)
 
 	prevBlock := &bmsg.block.MsgBlock().Header.PrevBlock
 	if !sm.chain.MainChainHasBlock(prevBlock) && !sm.chain.IsCurrent() {
@@ -777,7 +752,15 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, nil, nil, nil, behaviorFlags)
+	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, nil, nil, nil, common.BFNone)
+	sm.auditLog.Block(blockHash, bmsg.block.Height(), peer.Addr(), isOrphan, err)
+	if err == blockchain.ErrAcceptancePaused {
+		// The block is not at fault, so neither reject it nor punish
+		// the peer.  The blocks from the best block on are requested
+		// from the sync peer again once the acceptance resumes.
+		log.Debugf("Ignoring block %v from %s: %v", blockHash, peer, err)
+		return
+	}
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so logger
@@ -868,212 +851,71 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 				peer)
 		}
 	}
-
-	// Nothing more to do if we aren't in headers-first mode.
-	if !sm.headersFirstMode {
-		return
-	}
-
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
-		}
-		return
-	}
-
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := sm.nextCheckpoint.Height
-	prevHash := sm.nextCheckpoint.Hash
-	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
-	if sm.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*common.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-		if err != nil {
-			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
-			return
-		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
-		return
-	}
-
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	log.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*common.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
-	if err != nil {
-		log.Warnf("Failed to send getblocks message to peer %s: %v",
-			peer.Addr(), err)
-		return
-	}
-}
-
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
-func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
-		return
-	}
-
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to protos.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := protos.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			log.Warn("Header list node type is not a headerNode")
-			continue
-		}
-
-		iv := protos.NewInvVect(protos.InvTypeBlock, node.hash)
-		haveInv, err := sm.haveInventory(iv)
-		if err != nil {
-			log.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
-		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
-
-			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
-
-			gdmsg.AddInvVect(iv)
-			numRequested++
-		}
-		sm.startHeader = e.Next()
-		if numRequested >= protos.MaxInvPerMsg {
-			break
-		}
-	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
-	}
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
 // requested when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
-	_, exists := sm.peerStates[peer]
+	state, exists := sm.peerStates[peer]
 	if !exists {
 		log.Warnf("Received headers message from unknown peer %s", peer)
 		return
 	}
 
-	// The remote peer is misbehaving if we didn't request headers.
+	// Headers not requested by the headers-first sync are subject to the
+	// anti-DoS rules of unsolicited headers.  An empty headers message
+	// from the sync peer ends its header chain.
 	msg := hmsg.headers
-	numHeaders := len(msg.Headers)
-	if !sm.headersFirstMode {
-		log.Warnf("Got %d unrequested headers from %s -- "+
-			"disconnecting", numHeaders, peer.Addr())
-		peer.Disconnect()
+	if sm.headersFirstMode && peer == sm.syncPeer {
+		sm.handleSyncHeaders(peer, msg.Headers)
 		return
 	}
 
 	// Nothing to do for an empty headers message.
-	if numHeaders == 0 {
+	if len(msg.Headers) == 0 {
 		return
 	}
+	sm.handleUnsolicitedHeaders(peer, state, msg.Headers)
+}
 
-	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
-	var finalHash *common.Hash
-	for _, blockHeader := range msg.Headers {
-		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
-
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
-			peer.Disconnect()
-			return
-		}
-
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
-			}
-		} else {
-			log.Warnf("Received block header that does not "+
-				"properly connect to the chain from peer %s "+
-				"-- disconnecting", peer.Addr())
-			peer.Disconnect()
-			return
-		}
-
-		// Verify the header at the next checkpoint height matches.
-		if node.height == sm.nextCheckpoint.Height {
-			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				log.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
-				log.Warnf("Block header at height %d/hash "+
-					"%s from peer %s does NOT match "+
-					"expected checkpoint hash of %s -- "+
-					"disconnecting", node.height,
-					node.hash, peer.Addr(),
-					sm.nextCheckpoint.Hash)
-				peer.Disconnect()
-				return
+// handleRequestBlockMsg sends a getdata message for the requested block to the
+// requested peer and records the request, so the block is accepted when it
+// arrives.  It is invoked from the syncHandler goroutine.
+func (sm *SyncManager) handleRequestBlockMsg(msg *requestBlockMsg) error {
+	var peer *peerpkg.Peer
+	if msg.peerID == 0 && sm.syncPeer != nil {
+		peer = sm.syncPeer
+	} else {
+		for p := range sm.peerStates {
+			if msg.peerID == 0 && p.LastBlock() >= msg.height ||
+				msg.peerID != 0 && p.ID() == msg.peerID {
+				peer = p
+				break
 			}
-			break
 		}
 	}
-
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		sm.headerList.Remove(sm.headerList.Front())
-		log.Infof("Received %v block headers: Fetching blocks",
-			sm.headerList.Len())
-		sm.progressLogger.SetLastLogTime(time.Now())
-		sm.fetchHeaderBlocks()
-		return
+	if peer == nil && msg.peerID == 0 {
+		return fmt.Errorf("no peer has announced height %d", msg.height)
 	}
-
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*common.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-	if err != nil {
-		log.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", peer.Addr(), err)
-		return
+	if peer == nil {
+		return fmt.Errorf("peer %d is not connected", msg.peerID)
 	}
+	state := sm.peerStates[peer]
+	if have, err := sm.chain.HaveBlock(msg.hash); err != nil {
+		return err
+	} else if have {
+		return fmt.Errorf("block %v is already known", msg.hash)
+	}
+
+	log.Infof("Requesting block %v from peer %s", msg.hash, peer)
+	sm.requestedBlocks[*msg.hash] = struct{}{}
+	sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
+	state.requestedBlocks[*msg.hash] = struct{}{}
+	gdmsg := protos.NewMsgGetData()
+	gdmsg.AddInvVect(protos.NewInvVect(protos.InvTypeBlock, msg.hash))
+	peer.QueueMessage(gdmsg, nil)
+	return nil
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1400,6 +1242,8 @@ out:
 				log.Debugf("processBlockMsg: Process block")
 				_, isOrphan, err := sm.chain.ProcessBlock(
 					msg.block, msg.vblock, msg.Receipts, msg.Logs, msg.flags)
+				sm.auditLog.Block(msg.block.Hash(), msg.block.Height(),
+					audit.OriginLocal, isOrphan, err)
 				log.Debugf("process result %v", err)
 				if err != nil {
 					msg.reply <- processBlockResponse{
@@ -1424,6 +1268,12 @@ out:
 				// Wait until the sender unpauses the manager.
 				<-msg.unpause
 
+			case requestBlockMsg:
+				msg.reply <- sm.handleRequestBlockMsg(&msg)
+
+			case acceptanceResumedMsg:
+				sm.handleAcceptanceResumed()
+
 			default:
 				log.Warnf("Invalid message type in block "+
 					"handler: %T", msg)
@@ -1459,6 +1309,14 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
+		// Push the blocks produced by this validator to the mesh
+		// before announcing them, so the peers it was pushed to are
+		// not announced the block.
+		if sm.blockPush && sm.account != nil &&
+			block.MsgBlock().Header.CoinBase == *sm.accountAt(block.Height()).Address {
+			sm.peerNotifier.PushBlock(block)
+		}
+
 		// Generate the inventory vector and relay it.
 		iv := protos.NewInvVect(protos.InvTypeBlock, block.Hash())
 		sm.peerNotifier.RelayInventory(iv, block.MsgBlock().Header)
@@ -1553,6 +1411,45 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		}
 
 		sm.sigMemPool.DisConnectSigns(block.Signs(), block.Height())
+
+	// The chain accepts new blocks again, so request the blocks refused
+	// while the acceptance was paused.  It is handled by the block handler
+	// since the notification is not sent from it.
+	case blockchain.NTAcceptanceResumed:
+		select {
+		case sm.msgChan <- acceptanceResumedMsg{}:
+		case <-sm.quit:
+		}
+	}
+}
+
+// handleAcceptanceResumed requests the blocks refused while the acceptance of
+// new blocks was paused.  The blocks of the headers-first sync were kept and
+// are connected, while the other ones were dropped and are requested again
+// from the sync peer, starting from the best block.
+func (sm *SyncManager) handleAcceptanceResumed() {
+	if sm.headersFirstMode {
+		sm.connectSyncBlocks()
+		if sm.headersFirst == nil {
+			return
+		}
+		sm.fetchSyncBlocks()
+		sm.finishHeadersFirst()
+		return
+	}
+	if sm.syncPeer == nil {
+		sm.startSync()
+		return
+	}
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Errorf("Failed to get block locator for the latest block: %v",
+			err)
+		return
+	}
+	if err := sm.syncPeer.PushGetBlocksMsg(locator, &zeroHash); err != nil {
+		log.Warnf("Failed to send getblocks message to peer %s: %v",
+			sm.syncPeer.Addr(), err)
 	}
 }
 
@@ -1705,6 +1602,18 @@ func (sm *SyncManager) Pause() chan<- struct{} {
 	return c
 }
 
+// RequestBlock requests the block with the passed hash from the peer with the
+// passed id, bypassing the normal scheduling of the block downloads.  A peer
+// id of 0 selects the sync peer, or else the first peer which announced a
+// block at least as high as the passed height.  The block is processed as any
+// requested block once received.
+func (sm *SyncManager) RequestBlock(hash *common.Hash, height int32, peerID int32) error {
+	reply := make(chan error)
+	sm.msgChan <- requestBlockMsg{hash: hash, height: height, peerID: peerID,
+		reply: reply}
+	return <-reply
+}
+
 // New constructs a new SyncManager. Use Start to begin processing asynchronous
 // block, tx, and inv updates.
 func New(config *Config) (*SyncManager, error) {
@@ -1722,21 +1631,17 @@ func New(config *Config) (*SyncManager, error) {
 		peerStates:       make(map[*peerpkg.Peer]*peerSyncState),
 		progressLogger:   newBlockProgressLogger("Processed", log),
 		msgChan:          make(chan interface{}, config.MaxPeers*3),
-		headerList:       list.New(),
 		quit:             make(chan struct{}),
 		signedHeight:     make(map[int32]interface{}),
 		account:          config.Account,
+		signingAccount:   config.SigningAccount,
+		blockPush:        config.BlockPush,
 		BroadcastMessage: config.BroadcastMessage,
+		auditLog:         config.AuditLog,
 	}
 
 	best := sm.chain.BestSnapshot()
-	if !config.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(best.Height)
-		if sm.nextCheckpoint != nil {
-			sm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	if config.DisableCheckpoints {
 		log.Info("Checkpoints are disabled")
 	}
 	sm.tipHeight = best.Height
@@ -1754,6 +1659,14 @@ func (sm *SyncManager) ListPeerStates() []string {
 	return peers
 }
 
+// accountAt returns the validator account signing at the passed height.
+func (sm *SyncManager) accountAt(height int32) *crypto.Account {
+	if sm.signingAccount != nil {
+		return sm.signingAccount(height)
+	}
+	return sm.account
+}
+
 // makeSignature add a signature for block,
 // it only make one signature for the same height when soft fork appears.
 func (sm *SyncManager) makeSignature(block *asiutil.Block) {
@@ -1764,12 +1677,13 @@ func (sm *SyncManager) makeSignature(block *asiutil.Block) {
 		return
 	}
 	header := &block.MsgBlock().Header
+	account := sm.accountAt(header.Height)
 	// Verify the block timestamp
 	if header.Timestamp < (time.Now().Unix() - 5 * int64(time.Minute/time.Second)) {
 		return
 	}
 	// self mined block is needn't make signature
-	if header.CoinBase == *sm.account.Address {
+	if header.CoinBase == *account.Address {
 		return
 	}
 	//get the validators of current block:
@@ -1781,13 +1695,13 @@ func (sm *SyncManager) makeSignature(block *asiutil.Block) {
 		return
 	}
 
-	if _, ok := weightMap[*sm.account.Address]; !ok {
+	if _, ok := weightMap[*account.Address]; !ok {
 		return
 	}
 
 	blockHash := block.MsgBlock().BlockHash()
 
-	signature, err := crypto.Sign(blockHash[:], (*ecdsa.PrivateKey)(&sm.account.PrivateKey))
+	signature, err := crypto.Sign(blockHash[:], (*ecdsa.PrivateKey)(&account.PrivateKey))
 	if err != nil {
 		log.Errorf("Sign error:%s.", err)
 		return
@@ -1797,7 +1711,7 @@ func (sm *SyncManager) makeSignature(block *asiutil.Block) {
 	copy(sigMsg.Signature[:], signature)
 	sigMsg.BlockHeight = header.Height
 	sigMsg.BlockHash = blockHash
-	sigMsg.Signer = *sm.account.Address
+	sigMsg.Signer = *account.Address
 
 	sig := asiutil.NewBlockSign(&sigMsg)
 
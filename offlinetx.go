@@ -0,0 +1,435 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/jessevdk/go-flags"
+)
+
+const (
+	// defaultTxRPCServer is the node queried by the exporttx and sendtx
+	// commands.
+	defaultTxRPCServer = "http://127.0.0.1:8545"
+
+	// offlineTxVersion is the version of the offline transaction file.
+	offlineTxVersion = 1
+)
+
+// offlineInput is the output spent by an input of an offline transaction, as
+// read from the chain when the transaction was exported.
+type offlineInput struct {
+	TxID     string `json:"txid"`
+	Vout     uint32 `json:"vout"`
+	PkScript string `json:"pkscript"`
+	Amount   int64  `json:"amount"`
+	Asset    string `json:"asset"`
+}
+
+// offlineTx is the file carrying a transaction between the online node and
+// the offline signing machine.  It holds everything needed to sign and check
+// the transaction without access to the chain: the outputs it spends and the
+// height the signatures are verified at.
+type offlineTx struct {
+	Version   int             `json:"version"`
+	Net       string          `json:"net"`
+	Height    int32           `json:"height"`
+	BlockHash string          `json:"blockhash"`
+	Tx        string          `json:"tx"`
+	Inputs    []*offlineInput `json:"inputs"`
+	Signed    bool            `json:"signed"`
+}
+
+// readOfflineTx reads an offline transaction file and decodes its transaction.
+func readOfflineTx(path string) (*offlineTx, *protos.MsgTx, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var otx offlineTx
+	if err := json.Unmarshal(data, &otx); err != nil {
+		return nil, nil, fmt.Errorf("invalid offline transaction file: %v", err)
+	}
+	if otx.Version != offlineTxVersion {
+		return nil, nil, fmt.Errorf("unsupported offline transaction "+
+			"file version %d", otx.Version)
+	}
+	tx, err := decodeTx(otx.Tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(otx.Inputs) != len(tx.TxIn) {
+		return nil, nil, fmt.Errorf("the file describes %d inputs, the "+
+			"transaction has %d", len(otx.Inputs), len(tx.TxIn))
+	}
+	for i, txIn := range tx.TxIn {
+		in := otx.Inputs[i]
+		if in.TxID != txIn.PreviousOutPoint.Hash.UnprefixString() ||
+			in.Vout != txIn.PreviousOutPoint.Index {
+			return nil, nil, fmt.Errorf("input %d does not match the "+
+				"transaction", i)
+		}
+	}
+	return &otx, tx, nil
+}
+
+// writeOfflineTx writes an offline transaction file holding tx.
+func writeOfflineTx(path string, otx *offlineTx, tx *protos.MsgTx) error {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return err
+	}
+	otx.Tx = hex.EncodeToString(buf.Bytes())
+	data, err := json.MarshalIndent(otx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// decodeTx decodes a hex encoded transaction.
+func decodeTx(hexTx string) (*protos.MsgTx, error) {
+	serialized, err := hex.DecodeString(strings.TrimPrefix(hexTx, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	var tx protos.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	return &tx, nil
+}
+
+// printOfflineTx prints what a transaction spends and pays, so it can be
+// reviewed before it is signed or sent.
+func printOfflineTx(otx *offlineTx, tx *protos.MsgTx) {
+	fees := make(map[string]int64)
+	fmt.Printf("Transaction %s on %s at height %d\n", tx.TxHash(), otx.Net, otx.Height)
+	for _, in := range otx.Inputs {
+		fmt.Printf("  spends %s:%d  %d of asset %s\n", in.TxID, in.Vout,
+			in.Amount, in.Asset)
+		fees[in.Asset] += in.Amount
+	}
+	for _, out := range tx.TxOut {
+		asset := hex.EncodeToString(out.Asset.Bytes())
+		to := "?"
+		_, addrs, _, _ := txscript.ExtractPkScriptAddrs(out.PkScript)
+		if len(addrs) > 0 {
+			names := make([]string, len(addrs))
+			for i, addr := range addrs {
+				names[i] = addr.EncodeAddress()
+			}
+			to = strings.Join(names, ",")
+		}
+		fmt.Printf("  pays %s  %d of asset %s\n", to, out.Value, asset)
+		fees[asset] -= out.Value
+	}
+	for asset, fee := range fees {
+		if fee != 0 {
+			fmt.Printf("  leaves %d of asset %s to the validator\n", fee, asset)
+		}
+	}
+}
+
+// verifyOfflineTx checks the signature scripts of all the inputs of tx
+// against the outputs they spend.
+func verifyOfflineTx(otx *offlineTx, tx *protos.MsgTx) error {
+	for i, in := range otx.Inputs {
+		pkScript, err := hex.DecodeString(in.PkScript)
+		if err != nil {
+			return fmt.Errorf("input %d: invalid pkscript: %v", i, err)
+		}
+		assetBytes, err := hex.DecodeString(in.Asset)
+		if err != nil || len(assetBytes) != common.AssetLength {
+			return fmt.Errorf("input %d: invalid asset %q", i, in.Asset)
+		}
+		vm, err := txscript.NewEngine(pkScript, tx, i,
+			txscript.StandardVerifyFlags, in.Amount,
+			protos.AssetFromBytes(assetBytes), otx.Height, nil)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// exportTxCmd defines the options of the exporttx command.
+type exportTxCmd struct {
+	RPCServer string `long:"rpcserver" description:"URL of the node the spent outputs are read from"`
+	Out       string `short:"o" long:"out" description:"File the unsigned transaction is written to" required:"true"`
+}
+
+// Execute reads the outputs spent by the passed unsigned transaction from the
+// node and writes them along with the transaction to the offline file.
+func (cmd *exportTxCmd) Execute(args []string) error {
+	if len(args) != 1 {
+		return errors.New("the unsigned transaction is required")
+	}
+	tx, err := decodeTx(args[0])
+	if err != nil {
+		return err
+	}
+
+	client, err := rpc.Dial(cmd.RPCServer)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var net common.AsimovNet
+	if err := client.Call(&net, "asimov_getCurrentNet"); err != nil {
+		return err
+	}
+	var best rpcjson.GetBestBlockResult
+	if err := client.Call(&best, "asimov_getBestBlock"); err != nil {
+		return err
+	}
+	otx := &offlineTx{
+		Version:   offlineTxVersion,
+		Net:       net.String(),
+		Height:    best.Height + 1,
+		BlockHash: best.Hash,
+		Inputs:    make([]*offlineInput, len(tx.TxIn)),
+	}
+	for i, txIn := range tx.TxIn {
+		outpoint := txIn.PreviousOutPoint
+		var prev rpcjson.TxRawResult
+		err := client.Call(&prev, "asimov_getRawTransaction",
+			outpoint.Hash.UnprefixString(), true, false)
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+		var out *rpcjson.Vout
+		for j := range prev.Vout {
+			if prev.Vout[j].N == outpoint.Index {
+				out = &prev.Vout[j]
+			}
+		}
+		if out == nil {
+			return fmt.Errorf("input %d: output %v does not exist", i, outpoint)
+		}
+		otx.Inputs[i] = &offlineInput{
+			TxID:     outpoint.Hash.UnprefixString(),
+			Vout:     outpoint.Index,
+			PkScript: out.ScriptPubKey.Hex,
+			Amount:   out.Value,
+			Asset:    out.Asset,
+		}
+	}
+
+	if err := writeOfflineTx(cmd.Out, otx, tx); err != nil {
+		return err
+	}
+	printOfflineTx(otx, tx)
+	fmt.Printf("Unsigned transaction written to %s\n", cmd.Out)
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *exportTxCmd) Usage() string {
+	return "<unsigned-transaction-hex>"
+}
+
+// signTxCmd defines the options of the signtx command.
+type signTxCmd struct {
+	KeyFile string `long:"keyfile" description:"File holding the hex encoded private keys, one per line" required:"true"`
+	Out     string `short:"o" long:"out" description:"File the signed transaction is written to, the input file by default"`
+}
+
+// readKeys reads the private keys of a key file indexed by address.
+func readKeys(path string) (map[common.Address]*crypto.Account, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := make(map[common.Address]*crypto.Account)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if !strings.HasPrefix(key, "0x") {
+			key = "0x" + key
+		}
+		acc, err := crypto.NewAccount(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid private key", path, line)
+		}
+		keys[*acc.Address] = acc
+	}
+	return keys, scanner.Err()
+}
+
+// Execute signs the inputs of an exported transaction with the keys of the
+// key file.  It needs no access to the network.
+func (cmd *signTxCmd) Execute(args []string) error {
+	if len(args) != 1 {
+		return errors.New("the offline transaction file is required")
+	}
+	otx, tx, err := readOfflineTx(args[0])
+	if err != nil {
+		return err
+	}
+	keys, err := readKeys(cmd.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	lookupKey := func(addr common.IAddress) (*crypto.PrivateKey, bool, error) {
+		acc, ok := keys[common.Address(addr.StandardAddress())]
+		if !ok {
+			return nil, false, fmt.Errorf("no key for address %s",
+				addr.EncodeAddress())
+		}
+		return &acc.PrivateKey, true, nil
+	}
+	for i, in := range otx.Inputs {
+		pkScript, err := hex.DecodeString(in.PkScript)
+		if err != nil {
+			return fmt.Errorf("input %d: invalid pkscript: %v", i, err)
+		}
+		sigScript, err := txscript.SignTxOutput(tx, i, pkScript,
+			txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil,
+			tx.TxIn[i].SignatureScript)
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+	}
+
+	// A multisig input may still need the signatures of other keys, in
+	// which case the file is signed again with them.
+	otx.Signed = verifyOfflineTx(otx, tx) == nil
+
+	out := cmd.Out
+	if out == "" {
+		out = args[0]
+	}
+	if err := writeOfflineTx(out, otx, tx); err != nil {
+		return err
+	}
+	printOfflineTx(otx, tx)
+	if !otx.Signed {
+		fmt.Printf("Partially signed transaction written to %s\n", out)
+		return nil
+	}
+	fmt.Printf("Signed transaction written to %s\n", out)
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *signTxCmd) Usage() string {
+	return "<offline-transaction-file>"
+}
+
+// sendTxCmd defines the options of the sendtx command.
+type sendTxCmd struct {
+	RPCServer string `long:"rpcserver" description:"URL of the node the transaction is sent to"`
+}
+
+// Execute checks the signatures of a signed offline transaction and sends it
+// to the node.
+func (cmd *sendTxCmd) Execute(args []string) error {
+	if len(args) != 1 {
+		return errors.New("the offline transaction file is required")
+	}
+	otx, tx, err := readOfflineTx(args[0])
+	if err != nil {
+		return err
+	}
+	if err := verifyOfflineTx(otx, tx); err != nil {
+		return fmt.Errorf("the transaction is not fully signed: %v", err)
+	}
+
+	client, err := rpc.Dial(cmd.RPCServer)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var txID string
+	if err := client.Call(&txID, "asimov_sendRawTransaction", otx.Tx); err != nil {
+		return err
+	}
+	fmt.Printf("Transaction %s sent\n", txID)
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *sendTxCmd) Usage() string {
+	return "<offline-transaction-file>"
+}
+
+// isTxCommand returns whether the passed argument names one of the offline
+// transaction commands.
+func isTxCommand(arg string) bool {
+	switch arg {
+	case "exporttx", "signtx", "sendtx":
+		return true
+	}
+	return false
+}
+
+// txCommandMain runs the offline transaction command of the command line
+// instead of the node.  The transaction is exported on a machine with access
+// to a node, signed on an offline machine with the same binary and sent back
+// through the node:
+//
+//	asimovd exporttx -o tx.json <unsigned-transaction-hex>
+//	asimovd signtx --keyfile keys.txt tx.json
+//	asimovd sendtx tx.json
+func txCommandMain() error {
+	appName := filepath.Base(os.Args[0])
+	appName = strings.TrimSuffix(appName, filepath.Ext(appName))
+	parser := flags.NewNamedParser(appName, flags.HelpFlag|flags.PassDoubleDash)
+	parser.AddCommand("exporttx",
+		"Export an unsigned transaction with the outputs it spends",
+		"Read the outputs spent by an unsigned transaction, such as one "+
+			"built by createrawtransaction, from a node and write "+
+			"them along with the transaction to a file.",
+		&exportTxCmd{RPCServer: defaultTxRPCServer})
+	parser.AddCommand("signtx",
+		"Sign an exported transaction offline",
+		"Sign the inputs of an exported transaction with the keys of a "+
+			"key file without access to the network.",
+		&signTxCmd{})
+	parser.AddCommand("sendtx",
+		"Send a signed transaction",
+		"Check the signatures of a signed transaction and send it to a "+
+			"node.",
+		&sendTxCmd{RPCServer: defaultTxRPCServer})
+
+	if _, err := parser.Parse(); err != nil {
+		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2018-2020. The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// TxTestNode serves the RPC methods the offline transaction commands call,
+// holding a single previous transaction and recording the transactions
+// sent.
+type TxTestNode struct {
+	prev *protos.MsgTx
+	sent []string
+}
+
+func (n *TxTestNode) GetCurrentNet() (common.AsimovNet, error) {
+	return common.DevelopNet, nil
+}
+
+func (n *TxTestNode) GetBestBlock() (*rpcjson.GetBestBlockResult, error) {
+	return &rpcjson.GetBestBlockResult{Hash: common.Hash{1}.UnprefixString(), Height: 100}, nil
+}
+
+func (n *TxTestNode) GetRawTransaction(txID string, verbose bool, vinExtra bool) (*rpcjson.TxRawResult, error) {
+	if txID != n.prev.TxHash().UnprefixString() {
+		return nil, errors.New("no such transaction")
+	}
+	result := &rpcjson.TxRawResult{Txid: txID}
+	for i, out := range n.prev.TxOut {
+		result.Vout = append(result.Vout, rpcjson.Vout{
+			Value: out.Value,
+			N:     uint32(i),
+			ScriptPubKey: rpcjson.ScriptPubKeyResult{
+				Hex: hex.EncodeToString(out.PkScript),
+			},
+			Asset: hex.EncodeToString(out.Asset.Bytes()),
+		})
+	}
+	return result, nil
+}
+
+func (n *TxTestNode) SendRawTransaction(hexTx string) (string, error) {
+	tx, err := decodeTx(hexTx)
+	if err != nil {
+		return "", err
+	}
+	n.sent = append(n.sent, hexTx)
+	return tx.TxHash().UnprefixString(), nil
+}
+
+// TestOfflineTxRoundTrip ensures a transaction exported from a node, signed
+// offline and sent back is the one the node receives, fully signed, and that
+// a transaction missing signatures is not sent.
+func TestOfflineTxRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offlinetx")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	acc, err := crypto.NewAccount(chaincfg.DevKeys[0])
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(acc.Address)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	prev := protos.NewMsgTx(protos.TxVersion)
+	prev.AddTxOut(protos.NewTxOut(5000, pkScript, asiutil.AsimovAsset))
+
+	node := &TxTestNode{prev: prev}
+	server := rpc.NewServer()
+	if err := server.RegisterName("asimov", node); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	// Build the unsigned transaction spending the previous output.
+	prevHash := prev.TxHash()
+	unsigned := protos.NewMsgTx(protos.TxVersion)
+	unsigned.AddTxIn(protos.NewTxIn(protos.NewOutPoint(&prevHash, 0), nil))
+	unsigned.AddTxOut(protos.NewTxOut(4000, pkScript, asiutil.AsimovAsset))
+	var buf bytes.Buffer
+	if err := unsigned.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	txPath := filepath.Join(dir, "tx.json")
+	export := &exportTxCmd{RPCServer: httpServer.URL, Out: txPath}
+	if err := export.Execute([]string{hex.EncodeToString(buf.Bytes())}); err != nil {
+		t.Fatalf("exporttx: %v", err)
+	}
+	otx, _, err := readOfflineTx(txPath)
+	if err != nil {
+		t.Fatalf("readOfflineTx: %v", err)
+	}
+	if otx.Signed || otx.Height != 101 || otx.Net != common.DevelopNet.String() ||
+		len(otx.Inputs) != 1 || otx.Inputs[0].Amount != 5000 {
+		t.Fatalf("unexpected exported transaction %+v", otx)
+	}
+
+	// The unsigned transaction is not sent.
+	send := &sendTxCmd{RPCServer: httpServer.URL}
+	if err := send.Execute([]string{txPath}); err == nil {
+		t.Fatal("sendtx sent an unsigned transaction")
+	}
+
+	// A key file without the key of the input signs nothing.
+	keyPath := filepath.Join(dir, "keys.txt")
+	err = ioutil.WriteFile(keyPath, []byte("# keys\n"+chaincfg.DevKeys[1]+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	sign := &signTxCmd{KeyFile: keyPath}
+	if err := sign.Execute([]string{txPath}); err == nil {
+		t.Fatal("signtx signed without the key of the input")
+	}
+
+	err = ioutil.WriteFile(keyPath, []byte(chaincfg.DevKeys[0][2:]+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	signedPath := filepath.Join(dir, "signed.json")
+	sign = &signTxCmd{KeyFile: keyPath, Out: signedPath}
+	if err := sign.Execute([]string{txPath}); err != nil {
+		t.Fatalf("signtx: %v", err)
+	}
+	otx, signed, err := readOfflineTx(signedPath)
+	if err != nil {
+		t.Fatalf("readOfflineTx: %v", err)
+	}
+	if !otx.Signed {
+		t.Fatal("signed transaction not marked signed")
+	}
+	if err := verifyOfflineTx(otx, signed); err != nil {
+		t.Fatalf("verifyOfflineTx: %v", err)
+	}
+
+	if err := send.Execute([]string{signedPath}); err != nil {
+		t.Fatalf("sendtx: %v", err)
+	}
+	if len(node.sent) != 1 || node.sent[0] != otx.Tx {
+		t.Fatalf("node received %v, want the signed transaction", node.sent)
+	}
+	if signed.TxHash() == unsigned.TxHash() {
+		t.Error("sent transaction carries no signature")
+	}
+}
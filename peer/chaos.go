@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"time"
+
+	"github.com/AsimovNetwork/asimov/chaos"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// chaosMessage is an inbound message held back by the fault injection.
+type chaosMessage struct {
+	msg      protos.Message
+	buf      []byte
+	released bool
+}
+
+// readChaosMessage reads the next bitcoin message from the peer, injecting
+// the faults of the chaos builds: the messages are delayed, dropped, or held
+// back and returned after the next one.
+func (p *Peer) readChaosMessage(encoding protos.MessageEncoding) (protos.Message, []byte, error) {
+	// Release the message held back once the one after it was returned.
+	if held := p.chaosHeld; held != nil && held.released {
+		p.chaosHeld = nil
+		return held.msg, held.buf, nil
+	}
+
+	for {
+		msg, buf, err := p.readWireMessage(encoding)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fault := chaos.Message(chaos.Inbound, msg.Command())
+		time.Sleep(fault.Delay)
+		if fault.Drop {
+			log.Debugf("Chaos dropped %v from %s", msg.Command(), p)
+			continue
+		}
+		if p.chaosHeld != nil {
+			p.chaosHeld.released = true
+		} else if fault.Reorder {
+			log.Debugf("Chaos held back %v from %s", msg.Command(), p)
+			p.chaosHeld = &chaosMessage{msg: msg, buf: buf}
+			continue
+		}
+		return msg, buf, nil
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// MessageHandler is invoked when a peer receives a custom message of the
+// command it was registered for.  It runs on the input handler of the peer,
+// so it must not block for long; the handler replies, if needed, by queuing
+// custom messages to the peer.
+type MessageHandler func(p *Peer, msg *protos.MsgCustom)
+
+var (
+	handlersMtx sync.RWMutex
+	handlers    = make(map[string]MessageHandler)
+)
+
+// RegisterMessageHandler registers the handler of the custom messages of the
+// passed command on all the peers, including the ones already connected.
+// The command must be in the namespace reserved for custom messages, see
+// protos.CustomCommandPrefix, and fit in a message header.  Only one handler
+// may be registered per command.
+//
+// This function is safe for concurrent access.
+func RegisterMessageHandler(command string, handler MessageHandler) error {
+	if !protos.IsCustomCommand(command) {
+		return fmt.Errorf("command [%s] is not prefixed with %q",
+			command, protos.CustomCommandPrefix)
+	}
+	if len(command) > common.CommandSize {
+		return fmt.Errorf("command [%s] is too long [max %v]", command,
+			common.CommandSize)
+	}
+	if handler == nil {
+		return fmt.Errorf("nil handler for command [%s]", command)
+	}
+
+	handlersMtx.Lock()
+	defer handlersMtx.Unlock()
+
+	if _, ok := handlers[command]; ok {
+		return fmt.Errorf("command [%s] already has a handler", command)
+	}
+	handlers[command] = handler
+	return nil
+}
+
+// UnregisterMessageHandler removes the handler of the passed command.  The
+// custom messages of the command are ignored afterwards.
+//
+// This function is safe for concurrent access.
+func UnregisterMessageHandler(command string) {
+	handlersMtx.Lock()
+	delete(handlers, command)
+	handlersMtx.Unlock()
+}
+
+// messageHandler returns the handler registered for the passed command, or
+// nil when there is none.
+//
+// This function is safe for concurrent access.
+func messageHandler(command string) MessageHandler {
+	handlersMtx.RLock()
+	handler := handlers[command]
+	handlersMtx.RUnlock()
+	return handler
+}
@@ -85,6 +85,10 @@ func invSummary(invList []*protos.InvVect) string {
 			return fmt.Sprintf("tx %s", iv.Hash)
 		case protos.InvTypeSignature:
 			return fmt.Sprintf("signature %s", iv.Hash)
+		case protos.InvTypeAssetIssuance:
+			return fmt.Sprintf("asset issuance %s", iv.Hash)
+		case protos.InvTypeContractEvent:
+			return fmt.Sprintf("contract event %s", iv.Hash)
 		}
 
 		return fmt.Sprintf("unknown (%d) %s", uint32(iv.Type), iv.Hash)
@@ -145,6 +149,9 @@ func messageSummary(msg protos.Message) string {
 	case *protos.MsgAddr:
 		return fmt.Sprintf("%d addr", len(msg.AddrList))
 
+	case *protos.MsgAddrV2:
+		return fmt.Sprintf("%d addr", len(msg.AddrList))
+
 	case *protos.MsgPing:
 		// No summary - perhaps add nonce.
 
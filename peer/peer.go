@@ -13,11 +13,14 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/chaos"
 	"github.com/AsimovNetwork/asimov/common"
+	fnet "github.com/AsimovNetwork/asimov/common/net"
 	"github.com/AsimovNetwork/asimov/common/serialization"
 	"github.com/AsimovNetwork/asimov/connmgr"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/socks"
+	"github.com/AsimovNetwork/asimov/workers"
 	"io"
 	"math/rand"
 	"net"
@@ -73,6 +76,11 @@ const (
 
 	// writeDeadLine is the deadline for writing the message.
 	writeDeadLine = 5 * time.Second
+
+	// malformedMsgBanScore is the persistent ban score added to a peer
+	// sending an oversized or malformed message.  The peer is disconnected
+	// as well, so the score adds up with the scores of its reconnections.
+	malformedMsgBanScore = 20
 )
 
 var (
@@ -92,6 +100,19 @@ var (
 	// connection detecting and disconnect logic since they intentionally
 	// do so for testing purposes.
 	allowSelfConns bool
+
+	// errPeerQuit is the error of a message which was not written because
+	// the peer disconnected while waiting for a write worker.
+	errPeerQuit = errors.New("peer disconnected")
+
+	// writeWorkers limits the peers encoding a message to send at the same
+	// time.  It defaults to four per processor core.  The messages are
+	// written to the connections once the worker is released, so a peer
+	// which does not read can not hold it.  The received messages are not
+	// limited by a shared pool, since their handlers may wait for messages
+	// to be written.
+	writeWorkers = workers.New("peerwrite",
+		"peers encoding a message to send", workers.PerCPU(4))
 )
 
 // MessageListeners defines callback function pointers to invoke with message
@@ -110,6 +131,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *protos.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 message.
+	OnAddrV2 func(p *Peer, msg *protos.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *protos.MsgPing)
 
@@ -220,6 +244,10 @@ type MessageListeners struct {
 
 	// OnBan is invoked when ban a misbehaving peer.
 	OnBan func(p *Peer)
+
+	// OnMisbehavior is invoked when the ban score of a peer is increased,
+	// even when banning is disabled or the peer is whitelisted.
+	OnMisbehavior func(p *Peer, reason string)
 }
 
 // Config is the struct to hold configuration options useful to Peer.
@@ -273,6 +301,27 @@ type Config struct {
 	// not send inv messages for transactions.
 	DisableRelayTx bool
 
+	// Metadata specifies the operational key/value pairs, such as the
+	// region or the role of the node, sent to the remote peer in the
+	// version message.  The SFNodeMetadata service is advertised when it
+	// is not empty.
+	Metadata map[string]string
+
+	// HandshakeJitter specifies the maximum random delay before the version
+	// message is sent, so the handshake timing does not identify the node.
+	// This field can be omitted in which case the version message is sent
+	// immediately.
+	HandshakeJitter time.Duration
+
+	// DisableCompression specifies that the compression of the large
+	// payloads must not be negotiated with the peer.
+	DisableCompression bool
+
+	// IgnoreWhitelist specifies the peer must not be whitelisted by its
+	// address, such as the peers forwarded by a proxy which share the
+	// address of the proxy.
+	IgnoreWhitelist bool
+
 	// Listeners houses callback functions to be invoked on receiving peer
 	// messages.
 	Listeners MessageListeners
@@ -374,6 +423,7 @@ type StatsSnap struct {
 	TimeOffset     int64
 	Version        uint32
 	UserAgent      string
+	Metadata       map[string]string
 	Inbound        bool
 	StartingHeight int32
 	LastBlock      int32
@@ -447,10 +497,18 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	sendCompressed       bool   // peer sent a sendcompress message
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
+	invTypes             map[protos.InvType]struct{} // types of the peer's subscribeinv message
+	metadata             map[string]string           // metadata of the peer's version message
 	verAckReceived       bool
 
 	wireEncoding protos.MessageEncoding
 
+	// chaosHeld is the inbound message held back by the fault injection of
+	// the chaos builds.  It is only used by the goroutine reading messages.
+	chaosHeld *chaosMessage
+
 	knownInventory     *mruInventoryMap
 	prevGetBlocksMtx   sync.Mutex
 	prevGetBlocksBegin *common.Hash
@@ -543,6 +601,14 @@ func (p *Peer) AddKnownInventory(invVect *protos.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether the passed inventory is in the cache of
+// known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsKnownInventory(invVect *protos.InvVect) bool {
+	return p.knownInventory.Exists(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -553,6 +619,7 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 	id := p.id
 	addr := p.addr
 	userAgent := p.userAgent
+	metadata := p.metadata
 	services := p.services
 	protocolVersion := p.advertisedProtoVer
 	p.flagsMtx.Unlock()
@@ -562,6 +629,7 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		ID:             id,
 		Addr:           addr,
 		UserAgent:      userAgent,
+		Metadata:       metadata,
 		Services:       services,
 		LastSend:       p.LastSend(),
 		LastRecv:       p.LastRecv(),
@@ -818,6 +886,18 @@ func (p *Peer) StartingHeight() int32 {
 	return startingHeight
 }
 
+// Metadata returns the metadata the remote peer sent in its version message,
+// which must not be modified.  It is nil when the peer sent none.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Metadata() map[string]string {
+	p.flagsMtx.Lock()
+	metadata := p.metadata
+	p.flagsMtx.Unlock()
+
+	return metadata
+}
+
 // WantsHeaders returns if the peer wants header messages instead of
 // inventory vectors for blocks.
 //
@@ -830,6 +910,36 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// WantsAddrV2 returns if the peer wants addresses to be relayed with addrv2
+// messages instead of addr messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	sendAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return sendAddrV2
+}
+
+// WantsInv returns if the peer wants inventory vectors of the passed type to
+// be announced.  Until the peer sends a subscribeinv message, it wants all
+// the types but the asset issuance and contract event ones, which are only
+// announced to the peers which subscribed to them.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsInv(typ protos.InvType) bool {
+	p.flagsMtx.Lock()
+	defer p.flagsMtx.Unlock()
+
+	if p.invTypes == nil {
+		return typ != protos.InvTypeAssetIssuance &&
+			typ != protos.InvTypeContractEvent
+	}
+	_, ok := p.invTypes[typ]
+	return ok
+}
+
 // localVersionMsg creates a version message that can be used to send to the
 // remote peer.
 func (p *Peer) localVersionMsg() (*protos.MsgVersion, error) {
@@ -870,8 +980,12 @@ func (p *Peer) localVersionMsg() (*protos.MsgVersion, error) {
 
 	// Generate a unique nonce for this peer so self connections can be
 	// detected.  This is accomplished by adding it to a size-limited map of
-	// recently seen nonces.
-	nonce := uint64(rand.Int63())
+	// recently seen nonces.  The nonce is drawn from a cryptographically
+	// secure source so the nonces of a node can not be linked together.
+	nonce, err := serialization.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
 	sentNonces.Add(nonce)
 
 	// Version message.
@@ -888,43 +1002,59 @@ func (p *Peer) localVersionMsg() (*protos.MsgVersion, error) {
 	// Advertise if inv messages for transactions are desired.
 	msg.DisableRelayTx = p.cfg.DisableRelayTx
 
+	// Send our metadata along with the service flag which tells the
+	// remote peer to decode it.
+	if len(p.cfg.Metadata) > 0 {
+		msg.AddService(common.SFNodeMetadata)
+		msg.Metadata = p.cfg.Metadata
+	}
+
 	return msg, nil
 }
 
 // PushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.  This function is useful over manually sending the message via
-// QueueMessage since it automatically limits the addresses to the maximum
-// number allowed by the message and randomizes the chosen addresses when there
-// are too many.  It returns the addresses that were actually sent and no
-// message will be sent if there are no entries in the provided addresses slice.
+// addresses, or an addrv2 message when the peer asked for it.  This function
+// is useful over manually sending the message via QueueMessage since it
+// automatically limits the addresses to the maximum number allowed by the
+// message and randomizes the chosen addresses when there are too many.  The
+// addresses which are not IP addresses are only sent in addrv2 messages.  It
+// returns the addresses that were actually sent and no message will be sent if
+// there are no entries in the provided addresses slice.
 //
 // This function is safe for concurrent access.
 func (p *Peer) PushAddrMsg(addresses []*protos.NetAddress) ([]*protos.NetAddress, error) {
-	addressCount := len(addresses)
+	addrV2 := p.WantsAddrV2()
+	addrList := make([]*protos.NetAddress, 0, len(addresses))
+	for _, na := range addresses {
+		if addrV2 || na.Network == 0 {
+			addrList = append(addrList, na)
+		}
+	}
+	addressCount := len(addrList)
 
 	// Nothing to send.
 	if addressCount == 0 {
 		return nil, nil
 	}
 
-	msg := protos.NewMsgAddr()
-	msg.AddrList = make([]*protos.NetAddress, addressCount)
-	copy(msg.AddrList, addresses)
-
 	// Randomize the addresses sent if there are more than the maximum allowed.
 	if addressCount > protos.MaxAddrPerMsg {
 		// Shuffle the address list.
 		for i := 0; i < protos.MaxAddrPerMsg; i++ {
 			j := i + rand.Intn(addressCount-i)
-			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+			addrList[i], addrList[j] = addrList[j], addrList[i]
 		}
 
 		// Truncate it to the maximum size.
-		msg.AddrList = msg.AddrList[:protos.MaxAddrPerMsg]
+		addrList = addrList[:protos.MaxAddrPerMsg]
 	}
 
-	p.QueueMessage(msg, nil)
-	return msg.AddrList, nil
+	if addrV2 {
+		p.QueueMessage(&protos.MsgAddrV2{AddrList: addrList}, nil)
+	} else {
+		p.QueueMessage(&protos.MsgAddr{AddrList: addrList}, nil)
+	}
+	return addrList, nil
 }
 
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
@@ -1099,6 +1229,9 @@ func (p *Peer) handleRemoteVersionMsg(msg *protos.MsgVersion) error {
 	// Set the remote peer's user agent.
 	p.userAgent = msg.UserAgent
 
+	// Set the remote peer's metadata, which is never modified afterwards.
+	p.metadata = msg.Metadata
+
 	p.flagsMtx.Unlock()
 
 	return nil
@@ -1129,6 +1262,15 @@ func (p *Peer) handlePongMsg(msg *protos.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding protos.MessageEncoding) (protos.Message, []byte, error) {
+	if chaos.Enabled {
+		return p.readChaosMessage(encoding)
+	}
+	return p.readWireMessage(encoding)
+}
+
+// readWireMessage reads the next bitcoin message from the connection of the
+// peer with logging.
+func (p *Peer) readWireMessage(encoding protos.MessageEncoding) (protos.Message, []byte, error) {
 	n, msg, buf, err := protos.ReadMessageWithEncodingN(p.conn, p.ProtocolVersion(), encoding)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
@@ -1163,6 +1305,15 @@ func (p *Peer) writeMessage(msg protos.Message, enc protos.MessageEncoding) erro
 		return nil
 	}
 
+	if chaos.Enabled {
+		fault := chaos.Message(chaos.Outbound, msg.Command())
+		time.Sleep(fault.Delay)
+		if fault.Drop {
+			log.Debugf("Chaos dropped %v to %s", msg.Command(), p)
+			return nil
+		}
+	}
+
 	// Use closures to logger expensive operations so they are only run when
 	// the logging level requires it.
 	log.Debugf("%v", newLogClosure(func() string {
@@ -1186,12 +1337,35 @@ func (p *Peer) writeMessage(msg protos.Message, enc protos.MessageEncoding) erro
 		return spew.Sdump(buf.Bytes())
 	}))
 
-	// Set the deadline for writing the message.
-	p.conn.SetWriteDeadline(time.Now().Add(writeDeadLine))
+	// Compress the large payloads when the peer asked for it.
+	p.flagsMtx.Lock()
+	if p.sendCompressed {
+		enc |= protos.CompressedEncoding
+	}
+	p.flagsMtx.Unlock()
 
-	// Write the message to the peer.
-	n, err := protos.WriteMessageWithEncodingN(p.conn, msg,
+	// Encode the message while holding a write worker, and release it
+	// before writing the message so the connection can not block it.
+	if !writeWorkers.Acquire(p.quit) {
+		return errPeerQuit
+	}
+	var buf bytes.Buffer
+	_, err := protos.WriteMessageWithEncodingN(&buf, msg,
 		p.ProtocolVersion(), enc)
+	writeWorkers.Release()
+
+	// Write the message to the peer.  The connections multiplexing the
+	// messages over several streams take the messages whole, so that the
+	// blocks can be sent on their own stream.
+	var n int
+	if err == nil {
+		p.conn.SetWriteDeadline(time.Now().Add(writeDeadLine))
+		if mc, ok := p.conn.(fnet.MessageConn); ok {
+			n, err = mc.WriteMessage(buf.Bytes(), isBulkMessage(msg))
+		} else {
+			n, err = p.conn.Write(buf.Bytes())
+		}
+	}
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
@@ -1199,6 +1373,19 @@ func (p *Peer) writeMessage(msg protos.Message, enc protos.MessageEncoding) erro
 	return err
 }
 
+// isBulkMessage returns whether the passed message is a large transfer sent
+// on the bulk stream of the connections multiplexing the messages, so that it
+// does not delay the other messages.  Merkle blocks stay on the main stream
+// since the transactions matching them follow on it, and the filtered peers
+// expect them in that order.
+func isBulkMessage(msg protos.Message) bool {
+	switch msg.(type) {
+	case *protos.MsgBlock:
+		return true
+	}
+	return false
+}
+
 // isAllowedReadError returns whether or not the passed error is allowed without
 // disconnecting the peer.  In particular, regression tests need to be allowed
 // to send malformed messages without the peer being disconnected.
@@ -1473,6 +1660,12 @@ out:
 					log.Errorf(errMsg)
 				}
 
+				// Oversized and malformed messages violate the
+				// protocol, unlike a failing connection.
+				if _, ok := err.(*protos.MessageError); ok {
+					p.AddBanScore(malformedMsgBanScore, 0, "malformed message")
+				}
+
 				// Push a reject message for the malformed message and wait for
 				// the message to be sent before disconnecting.
 				//
@@ -1523,6 +1716,23 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *protos.MsgSendAddrV2:
+			// The addrv2 messages are negotiated during the version
+			// handshake, before the verack message.
+			if p.verAckReceived {
+				log.Debugf("Ignoring sendaddrv2 received after "+
+					"verack from %v", p)
+				break
+			}
+			p.flagsMtx.Lock()
+			p.sendAddrV2 = true
+			p.flagsMtx.Unlock()
+
+		case *protos.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
 		case *protos.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1647,6 +1857,37 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *protos.MsgSendCompression:
+			if !p.cfg.DisableCompression && msg.HasCodec(protos.CodecZstd) {
+				p.flagsMtx.Lock()
+				p.sendCompressed = true
+				p.flagsMtx.Unlock()
+			}
+
+		case *protos.MsgCustom:
+			handler := messageHandler(msg.Cmd)
+			if handler == nil {
+				log.Debugf("Ignoring custom message %v from %v",
+					msg.Cmd, p)
+				break
+			}
+			handler(p, msg)
+
+		case *protos.MsgSubscribeInv:
+			// The inventory classes are only announced by the nodes
+			// advertising them.
+			if p.cfg.Services&common.SFNodeInvClasses == 0 {
+				log.Debugf("Ignoring subscribeinv from %v", p)
+				break
+			}
+			invTypes := make(map[protos.InvType]struct{}, len(msg.Types))
+			for _, typ := range msg.Types {
+				invTypes[typ] = struct{}{}
+			}
+			p.flagsMtx.Lock()
+			p.invTypes = invTypes
+			p.flagsMtx.Unlock()
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1656,7 +1897,6 @@ out:
 		// A message was received so reset the idle timer.
 		idleTimer.Reset(idleTimeout)
 	}
-
 	// Ensure the idle timer is stopped to avoid leaking the resource.
 	idleTimer.Stop()
 
@@ -1978,7 +2218,7 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 
 	p.conn = conn
 	p.timeConnected = time.Now()
-	p.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	p.isWhitelisted = !p.cfg.IgnoreWhitelist && IsWhitelisted(conn.RemoteAddr())
 	if p.inbound {
 		p.addr = p.conn.RemoteAddr().String()
 
@@ -2059,6 +2299,12 @@ func (p *Peer) start() error {
 	go p.outHandler()
 	go p.pingHandler()
 
+	// Ask the peer to relay addresses with addrv2 messages, which must
+	// precede our verack message.
+	if p.ProtocolVersion() >= common.AddrV2Version {
+		p.QueueMessage(protos.NewMsgSendAddrV2(), nil)
+	}
+
 	// Send our verack message now that the IO processing machinery has started.
 	p.QueueMessage(protos.NewMsgVerAck(), nil)
 	return nil
@@ -2104,6 +2350,10 @@ func (p *Peer) readRemoteVersionMsg() error {
 
 // writeLocalVersionMsg writes our version message to the remote peer.
 func (p *Peer) writeLocalVersionMsg() error {
+	if p.cfg.HandshakeJitter > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(p.cfg.HandshakeJitter))))
+	}
+
 	localVerMsg, err := p.localVersionMsg()
 	if err != nil {
 		return err
@@ -2153,6 +2403,10 @@ func (p *Peer) BanScore() uint32 {
 // the score is above the ban threshold, the peer will be banned and
 // disconnected.
 func (p *Peer) AddBanScore(persistent, transient uint32, reason string) {
+	if persistent+transient > 0 && p.cfg.Listeners.OnMisbehavior != nil {
+		p.cfg.Listeners.OnMisbehavior(p, reason)
+	}
+
 	// No warning is logged and no score is calculated if banning is disabled.
 	if chaincfg.Cfg.DisableBanning {
 		return
@@ -2221,6 +2475,13 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		services:        cfg.Services,
 		protocolVersion: cfg.ProtocolVersion,
 	}
+
+	// Accept compressed messages unless compression is disabled, since the
+	// peer only sends them once it was asked to with a sendcompress
+	// message.
+	if !cfg.DisableCompression {
+		p.wireEncoding |= protos.CompressedEncoding
+	}
 	return &p
 }
 
@@ -2262,9 +2523,9 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-// isWhitelisted returns whether the IP address is included in the whitelisted
+// IsWhitelisted returns whether the IP address is included in the whitelisted
 // networks and IPs.
-func isWhitelisted(addr net.Addr) bool {
+func IsWhitelisted(addr net.Addr) bool {
 	if len(chaincfg.Cfg.Whitelists) == 0 {
 		return false
 	}
@@ -8,7 +8,9 @@ package peer_test
 import (
 	"io"
 	"net"
+	"reflect"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	"github.com/AsimovNetwork/asimov/peer"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/socks"
+	"github.com/AsimovNetwork/asimov/workers"
 	"errors"
 )
 
@@ -251,8 +254,8 @@ func TestPeerConnection(t *testing.T) {
 		wantLastPingNonce:  uint64(0),
 		wantLastPingMicros: int64(0),
 		wantTimeOffset:     int64(0),
-		wantBytesSent:      191,	//  header(20 byte) + payload(171 bytes)
-		wantBytesReceived:  191,
+		wantBytesSent:      211,	//  header(20 byte) + payload(171 bytes) + sendaddrv2 header(20 bytes)
+		wantBytesReceived:  211,
 	}
 	wantStats2 := peerStats{
 		wantUserAgent: protos.DefaultUserAgent + "peer:1.0(comment)/",
@@ -265,8 +268,8 @@ func TestPeerConnection(t *testing.T) {
 		wantLastPingNonce:  uint64(0),
 		wantLastPingMicros: int64(0),
 		wantTimeOffset:     int64(0),
-		wantBytesSent:      191,
-		wantBytesReceived:  191,
+		wantBytesSent:      211,
+		wantBytesReceived:  211,
 	}
 
 	tests := []struct {
@@ -357,6 +360,9 @@ func TestPeerListeners(t *testing.T) {
 			OnAddr: func(p *peer.Peer, msg *protos.MsgAddr) {
 				ok <- msg
 			},
+			OnAddrV2: func(p *peer.Peer, msg *protos.MsgAddrV2) {
+				ok <- msg
+			},
 			OnPing: func(p *peer.Peer, msg *protos.MsgPing) {
 				ok <- msg
 			},
@@ -451,6 +457,7 @@ func TestPeerListeners(t *testing.T) {
 			verack <- struct{}{}
 		},
 	}
+	peerCfg.Metadata = map[string]string{"role": "validator"}
 	outPeer, err := peer.NewOutboundPeer(peerCfg, "10.0.0.1:8333")
 	if err != nil {
 		t.Errorf("NewOutboundPeer: unexpected err %v\n", err)
@@ -467,6 +474,29 @@ func TestPeerListeners(t *testing.T) {
 		}
 	}
 
+	// The addrv2 messages were negotiated before the verack messages.
+	if !inPeer.WantsAddrV2() || !outPeer.WantsAddrV2() {
+		t.Errorf("TestPeerListeners: addrv2 not negotiated")
+	}
+
+	// Only the outbound peer sent metadata.
+	if got := inPeer.Metadata(); !reflect.DeepEqual(got, peerCfg.Metadata) {
+		t.Errorf("TestPeerListeners: got metadata %v, want %v", got,
+			peerCfg.Metadata)
+	}
+	if got := outPeer.Metadata(); got != nil {
+		t.Errorf("TestPeerListeners: got metadata %v, want none", got)
+	}
+
+	// Custom messages are passed to the handler of their command.
+	err = peer.RegisterMessageHandler("x-test", func(p *peer.Peer, msg *protos.MsgCustom) {
+		ok <- msg
+	})
+	if err != nil {
+		t.Fatalf("RegisterMessageHandler: %v", err)
+	}
+	defer peer.UnregisterMessageHandler("x-test")
+
 	tests := []struct {
 		listener string
 		msg      protos.Message
@@ -479,6 +509,10 @@ func TestPeerListeners(t *testing.T) {
 			"OnAddr",
 			protos.NewMsgAddr(),
 		},
+		{
+			"OnAddrV2",
+			protos.NewMsgAddrV2(),
+		},
 		{
 			"OnPing",
 			protos.NewMsgPing(42),
@@ -569,6 +603,10 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			protos.NewMsgSendHeaders(),
 		},
+		{
+			"x-test handler",
+			protos.NewMsgCustom("x-test", []byte("payload")),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -585,6 +623,40 @@ func TestPeerListeners(t *testing.T) {
 	outPeer.Disconnect()
 }
 
+// TestRegisterMessageHandler ensures the handlers are only registered for the
+// commands in the custom namespace, once per command.
+func TestRegisterMessageHandler(t *testing.T) {
+	handler := func(p *peer.Peer, msg *protos.MsgCustom) {}
+	tests := []struct {
+		command string
+		handler peer.MessageHandler
+	}{
+		{"oracle", handler},
+		{"x-", handler},
+		{"x-toolongname", handler},
+		{"x-oracle", nil},
+	}
+	for _, test := range tests {
+		err := peer.RegisterMessageHandler(test.command, test.handler)
+		if err == nil {
+			t.Errorf("RegisterMessageHandler(%q): no error", test.command)
+			peer.UnregisterMessageHandler(test.command)
+		}
+	}
+
+	if err := peer.RegisterMessageHandler("x-oracle", handler); err != nil {
+		t.Fatalf("RegisterMessageHandler: %v", err)
+	}
+	if err := peer.RegisterMessageHandler("x-oracle", handler); err == nil {
+		t.Error("RegisterMessageHandler: duplicate handler accepted")
+	}
+	peer.UnregisterMessageHandler("x-oracle")
+	if err := peer.RegisterMessageHandler("x-oracle", handler); err != nil {
+		t.Errorf("RegisterMessageHandler after unregister: %v", err)
+	}
+	peer.UnregisterMessageHandler("x-oracle")
+}
+
 // TestOutboundPeer tests that the outbound peer works as expected.
 func TestOutboundPeer(t *testing.T) {
 	chaincfg.Cfg = &chaincfg.FConfig{}
@@ -889,6 +961,114 @@ func TestDuplicateVersionMsg(t *testing.T) {
 	}
 }
 
+// stallWriter is the writer of a mock connection whose remote end stops
+// reading once stalled, so the writes block until the writer is released.
+type stallWriter struct {
+	io.Writer
+	stalled int32
+	release chan struct{}
+}
+
+// Write blocks until the writer is released when it is stalled, and writes to
+// the underlying writer otherwise.
+func (w *stallWriter) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&w.stalled) != 0 {
+		<-w.release
+		return 0, io.ErrClosedPipe
+	}
+	return w.Writer.Write(b)
+}
+
+// TestPeerNeverReading ensures a peer whose remote end never reads, with a
+// handler waiting for its messages to be written, does not keep the other
+// peers from handling and answering their messages.
+func TestPeerNeverReading(t *testing.T) {
+	chaincfg.Cfg = &chaincfg.FConfig{}
+
+	// A single write worker is shared by all the peers.
+	pool := workers.Lookup("peerwrite")
+	pool.SetSize(1)
+	defer pool.SetSize(0)
+
+	verack := make(chan struct{}, 4)
+	handling := make(chan struct{}, 1)
+	pong := make(chan struct{}, 1)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *protos.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			// Answer the getdata messages and wait for the answer to be
+			// written, as the server does.
+			OnGetData: func(p *peer.Peer, msg *protos.MsgGetData) {
+				handling <- struct{}{}
+				done := make(chan struct{}, 1)
+				p.QueueMessage(protos.NewMsgNotFound(), done)
+				<-done
+			},
+			OnPong: func(p *peer.Peer, msg *protos.MsgPong) {
+				pong <- struct{}{}
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+		Services:         0,
+	}
+	// The writes of the inbound peers can be stalled, as if their remote
+	// end stopped reading.
+	release := make(chan struct{})
+	defer close(release)
+	connect := func(laddr, raddr string) (*peer.Peer, *peer.Peer, *stallWriter) {
+		inConn, outConn := pipe(
+			&conn{laddr: laddr, raddr: raddr},
+			&conn{laddr: raddr, raddr: laddr},
+		)
+		writer := &stallWriter{Writer: inConn.Writer, release: release}
+		inConn.Writer = writer
+		outPeer, err := peer.NewOutboundPeer(peerCfg, inConn.laddr)
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+		}
+		outPeer.AssociateConnection(outConn)
+		inPeer := peer.NewInboundPeer(peerCfg)
+		inPeer.AssociateConnection(inConn)
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatal("verack timeout")
+			}
+		}
+		return inPeer, outPeer, writer
+	}
+
+	// The remote end of the stalled peer stops reading once connected.
+	stalledIn, stalledOut, writer := connect("10.0.0.1:9108", "10.0.0.2:9108")
+	defer stalledIn.Disconnect()
+	defer stalledOut.Disconnect()
+	atomic.StoreInt32(&writer.stalled, 1)
+
+	stalledOut.QueueMessage(protos.NewMsgGetData(), nil)
+	select {
+	case <-handling:
+	case <-time.After(time.Second):
+		t.Fatal("getdata not handled")
+	}
+
+	// Another pair of peers connects and exchanges messages while the
+	// handler of the stalled peer waits.
+	inPeer, outPeer, _ := connect("10.0.0.3:9108", "10.0.0.4:9108")
+	defer inPeer.Disconnect()
+	defer outPeer.Disconnect()
+	outPeer.QueueMessage(protos.NewMsgPing(1), nil)
+	select {
+	case <-pong:
+	case <-time.After(time.Second):
+		t.Fatal("ping not answered while a peer never reads")
+	}
+}
+
 func init() {
 	// Allow self connection when running the tests.
 	peer.TstAllowSelfConns()
@@ -0,0 +1,241 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package peerstats keeps long-term statistics about the peers of the node and
+// persists them across restarts.  The statistics are keyed by the network
+// group of the peers rather than their address, so a peer changing its port or
+// moving to a close address keeps its history, and a misbehaving network
+// segment is remembered as a whole.
+package peerstats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxGroups is the maximum number of network groups whose statistics
+	// are kept.  The least recently seen group is evicted beyond it.
+	maxGroups = 4096
+
+	// maxLatencySamples is the number of the most recent latency samples
+	// kept per group to compute the latency percentiles.
+	maxLatencySamples = 100
+
+	// invalidPenalty is the score removed per invalid message.
+	invalidPenalty = 10
+)
+
+// groupStats is the persisted statistics of a network group.
+type groupStats struct {
+	Sessions  uint32  `json:"sessions"`
+	Uptime    int64   `json:"uptime"`
+	Blocks    uint64  `json:"blocks"`
+	Invalid   uint64  `json:"invalid"`
+	Latencies []int64 `json:"latencies"`
+	LastSeen  int64   `json:"lastseen"`
+}
+
+// score returns the score of the group, the higher the better.  Every hour of
+// connection and every 10 blocks provided count for a point, and every
+// invalid message costs invalidPenalty points.
+func (g *groupStats) score() float64 {
+	return float64(g.Uptime)/3600 + float64(g.Blocks)/10 -
+		float64(g.Invalid*invalidPenalty)
+}
+
+// Stats describes the statistics of the peers of a network group.
+type Stats struct {
+	Group      string
+	Sessions   uint32
+	Uptime     time.Duration
+	Blocks     uint64
+	Invalid    uint64
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+	LastSeen   time.Time
+	Score      float64
+}
+
+// Store keeps the statistics of the peers keyed by network group.
+//
+// All methods are safe for concurrent access.
+type Store struct {
+	mtx    sync.Mutex
+	file   string
+	groups map[string]*groupStats
+}
+
+// New returns an empty store persisted to the passed file.
+func New(file string) *Store {
+	return &Store{
+		file:   file,
+		groups: make(map[string]*groupStats),
+	}
+}
+
+// Load loads the statistics from the file of the store.  A missing file is
+// not an error.
+func (s *Store) Load() error {
+	data, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[string]*groupStats)
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	s.groups = groups
+	s.mtx.Unlock()
+	return nil
+}
+
+// Save writes the statistics to the file of the store.  The file is written
+// under a temporary name and renamed once complete.
+func (s *Store) Save() error {
+	s.mtx.Lock()
+	data, err := json.Marshal(s.groups)
+	s.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// group returns the statistics of a group, creating them when needed, and
+// marks the group as seen.  The store must be locked.
+func (s *Store) group(key string) *groupStats {
+	g, ok := s.groups[key]
+	if !ok {
+		if len(s.groups) >= maxGroups {
+			s.evictOldest()
+		}
+		g = &groupStats{}
+		s.groups[key] = g
+	}
+	g.LastSeen = time.Now().Unix()
+	return g
+}
+
+// evictOldest removes the statistics of the least recently seen group.  The
+// store must be locked.
+func (s *Store) evictOldest() {
+	var oldest string
+	var oldestSeen int64
+	for key, g := range s.groups {
+		if oldest == "" || g.LastSeen < oldestSeen {
+			oldest, oldestSeen = key, g.LastSeen
+		}
+	}
+	delete(s.groups, oldest)
+}
+
+// AddSession records a connection to a peer of the group which lasted the
+// passed duration.
+func (s *Store) AddSession(key string, uptime time.Duration) {
+	s.mtx.Lock()
+	g := s.group(key)
+	g.Sessions++
+	g.Uptime += int64(uptime / time.Second)
+	s.mtx.Unlock()
+}
+
+// AddBlock records a block provided by a peer of the group.
+func (s *Store) AddBlock(key string) {
+	s.mtx.Lock()
+	s.group(key).Blocks++
+	s.mtx.Unlock()
+}
+
+// AddInvalid records an invalid message sent by a peer of the group.
+func (s *Store) AddInvalid(key string) {
+	s.mtx.Lock()
+	s.group(key).Invalid++
+	s.mtx.Unlock()
+}
+
+// AddLatency records a latency sample of a peer of the group.
+func (s *Store) AddLatency(key string, latency time.Duration) {
+	s.mtx.Lock()
+	g := s.group(key)
+	g.Latencies = append(g.Latencies, int64(latency/time.Millisecond))
+	if len(g.Latencies) > maxLatencySamples {
+		g.Latencies = g.Latencies[len(g.Latencies)-maxLatencySamples:]
+	}
+	s.mtx.Unlock()
+}
+
+// Score returns the score of the group, the higher the better.  Groups without
+// statistics score 0 and groups which sent invalid messages score below 0
+// unless they made up for them.
+func (s *Store) Score(key string) float64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	g, ok := s.groups[key]
+	if !ok {
+		return 0
+	}
+	return g.score()
+}
+
+// percentile returns the p-th percentile of the sorted latencies.
+func percentile(sorted []int64, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return time.Duration(sorted[i]) * time.Millisecond
+}
+
+// Stats returns the statistics of all the groups sorted by decreasing score.
+func (s *Store) Stats() []Stats {
+	s.mtx.Lock()
+	stats := make([]Stats, 0, len(s.groups))
+	for key, g := range s.groups {
+		latencies := make([]int64, len(g.Latencies))
+		copy(latencies, g.Latencies)
+		sort.Slice(latencies, func(i, j int) bool {
+			return latencies[i] < latencies[j]
+		})
+		stats = append(stats, Stats{
+			Group:      key,
+			Sessions:   g.Sessions,
+			Uptime:     time.Duration(g.Uptime) * time.Second,
+			Blocks:     g.Blocks,
+			Invalid:    g.Invalid,
+			LatencyP50: percentile(latencies, 50),
+			LatencyP90: percentile(latencies, 90),
+			LatencyP99: percentile(latencies, 99),
+			LastSeen:   time.Unix(g.LastSeen, 0),
+			Score:      g.score(),
+		})
+	}
+	s.mtx.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Score != stats[j].Score {
+			return stats[i].Score > stats[j].Score
+		}
+		return stats[i].Group < stats[j].Group
+	})
+	return stats
+}
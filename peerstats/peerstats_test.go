@@ -0,0 +1,95 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStore ensures the statistics are recorded, scored and persisted.
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peerstats")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "peerstats.json")
+
+	store := New(file)
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load of a missing file: %v", err)
+	}
+
+	store.AddSession("good", 2*time.Hour)
+	for i := 0; i < 20; i++ {
+		store.AddBlock("good")
+	}
+	for i := 1; i <= 150; i++ {
+		store.AddLatency("good", time.Duration(i)*time.Millisecond)
+	}
+	store.AddSession("bad", time.Hour)
+	store.AddInvalid("bad")
+
+	if score := store.Score("good"); score != 4 {
+		t.Errorf("score of good group %v, want 4", score)
+	}
+	if score := store.Score("bad"); score != -9 {
+		t.Errorf("score of bad group %v, want -9", score)
+	}
+	if score := store.Score("unknown"); score != 0 {
+		t.Errorf("score of unknown group %v, want 0", score)
+	}
+
+	stats := store.Stats()
+	if len(stats) != 2 || stats[0].Group != "good" || stats[1].Group != "bad" {
+		t.Fatalf("unexpected stats order %+v", stats)
+	}
+	good := stats[0]
+	// Only the last 100 latency samples, 51ms to 150ms, are kept.
+	if good.LatencyP50 != 100*time.Millisecond ||
+		good.LatencyP90 != 140*time.Millisecond ||
+		good.LatencyP99 != 149*time.Millisecond {
+		t.Errorf("latency percentiles %v %v %v", good.LatencyP50,
+			good.LatencyP90, good.LatencyP99)
+	}
+	if good.Sessions != 1 || good.Uptime != 2*time.Hour || good.Blocks != 20 {
+		t.Errorf("unexpected good group stats %+v", good)
+	}
+
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := New(file)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Stats(), stats) {
+		t.Errorf("loaded stats %+v, want %+v", loaded.Stats(), stats)
+	}
+}
+
+// TestStoreEviction ensures the least recently seen group is evicted when the
+// store is full.
+func TestStoreEviction(t *testing.T) {
+	store := New("")
+	for i := 0; i < maxGroups; i++ {
+		store.AddBlock(string(rune(0x1000 + i)))
+	}
+	store.groups[string(rune(0x1000))].LastSeen = 0
+
+	store.AddBlock("new")
+	if len(store.groups) != maxGroups {
+		t.Fatalf("store holds %d groups, want %d", len(store.groups),
+			maxGroups)
+	}
+	if _, ok := store.groups[string(rune(0x1000))]; ok {
+		t.Error("least recently seen group not evicted")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionThreshold is the payload size in bytes above which the payloads
+// of the compressible messages are compressed when CompressedEncoding is
+// used.  Smaller payloads do not compress well enough to be worth it.
+const CompressionThreshold = 1024
+
+var (
+	// payloadEncoder compresses the message payloads.  It is safe for
+	// concurrent use by the peers.
+	payloadEncoder *zstd.Encoder
+
+	// payloadDecoder decompresses the message payloads.  It is safe for
+	// concurrent use by the peers, and refuses to decode more than the max
+	// message payload so that a small payload can not expand to exhaust the
+	// memory.
+	payloadDecoder *zstd.Decoder
+)
+
+func init() {
+	var err error
+	payloadEncoder, err = zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.SpeedDefault))
+	if err != nil {
+		panic(fmt.Sprintf("unable to create the zstd encoder: %v", err))
+	}
+	payloadDecoder, err = zstd.NewReader(nil,
+		zstd.WithDecoderMaxMemory(MaxMessagePayload))
+	if err != nil {
+		panic(fmt.Sprintf("unable to create the zstd decoder: %v", err))
+	}
+}
+
+// compressible returns whether the payloads of the messages with the passed
+// command may be compressed.  These are the messages whose payloads are large
+// enough to benefit from compression.
+func compressible(command string) bool {
+	switch command {
+	case CmdBlock, CmdHeaders, CmdInv:
+		return true
+	}
+	return false
+}
+
+// compressPayload returns the payload of a compressed message wrapping the
+// passed message payload, which consists of the command of the message
+// followed by the zstd compressed payload.
+func compressPayload(command string, payload []byte) ([]byte, error) {
+	compressed := make([]byte, common.CommandSize, common.CommandSize+len(payload)/2)
+	copy(compressed, command)
+	return payloadEncoder.EncodeAll(payload, compressed), nil
+}
+
+// decompressPayload returns the message wrapped by the passed compressed
+// message payload along with its decompressed payload.  The decompressed
+// payload is limited to the max payload length of the wrapped message so
+// that a small payload can not expand to exhaust the memory.
+func decompressPayload(payload []byte, pver uint32) (Message, []byte, error) {
+	if len(payload) < common.CommandSize {
+		return nil, nil, messageError("ReadMessage",
+			"compressed payload is too short")
+	}
+	command := string(bytes.TrimRight(payload[:common.CommandSize], "\x00"))
+	if !compressible(command) {
+		str := fmt.Sprintf("compressed message wraps unexpected "+
+			"command [%s]", command)
+		return nil, nil, messageError("ReadMessage", str)
+	}
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, nil, messageError("ReadMessage", err.Error())
+	}
+
+	mpl := msg.MaxPayloadLength(pver)
+	if mpl > MaxMessagePayload {
+		mpl = MaxMessagePayload
+	}
+	inner, err := payloadDecoder.DecodeAll(payload[common.CommandSize:], nil)
+	if err != nil {
+		str := fmt.Sprintf("can't decompress [%s] payload: %v",
+			command, err)
+		return nil, nil, messageError("ReadMessage", str)
+	}
+	if uint32(len(inner)) > mpl {
+		str := fmt.Sprintf("decompressed payload exceeds max length "+
+			"of messages of type [%s] %d", command, mpl)
+		return nil, nil, messageError("ReadMessage", str)
+	}
+	return msg, inner, nil
+}
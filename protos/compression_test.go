@@ -0,0 +1,131 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestCompressedEncoding ensures the large payloads of compressible messages
+// are compressed with CompressedEncoding and only read back with it.
+func TestCompressedEncoding(t *testing.T) {
+	pver := common.ProtocolVersion
+	enc := BaseEncoding | CompressedEncoding
+
+	// An inv message of 100 vectors is above the threshold and compresses
+	// well since the hashes only differ in a byte.
+	msgInv := NewMsgInv()
+	for i := 0; i < 100; i++ {
+		msgInv.AddInvVect(NewInvVect(InvTypeBlock, &common.Hash{byte(i)}))
+	}
+
+	var plain, compressed bytes.Buffer
+	if _, err := WriteMessageWithEncodingN(&plain, msgInv, pver, BaseEncoding); err != nil {
+		t.Fatalf("WriteMessageWithEncodingN: %v", err)
+	}
+	n, err := WriteMessageWithEncodingN(&compressed, msgInv, pver, enc)
+	if err != nil {
+		t.Fatalf("WriteMessageWithEncodingN: %v", err)
+	}
+	if n >= plain.Len() {
+		t.Fatalf("compressed message of %d bytes not smaller than %d",
+			n, plain.Len())
+	}
+	if cmd := string(bytes.TrimRight(compressed.Bytes()[:common.CommandSize],
+		"\x00")); cmd != CmdCompressed {
+		t.Fatalf("compressed message command %q", cmd)
+	}
+
+	// The wrapped payload is a zstd frame.
+	zstdMagic := []byte{0x28, 0xb5, 0x2f, 0xfd}
+	frame := compressed.Bytes()[MessageHeaderSize+common.CommandSize:]
+	if !bytes.HasPrefix(frame, zstdMagic) {
+		t.Errorf("compressed payload %x is not a zstd frame", frame[:4])
+	}
+
+	raw := compressed.Bytes()
+	_, msg, payload, err := ReadMessageWithEncodingN(bytes.NewReader(raw), pver, enc)
+	if err != nil {
+		t.Fatalf("ReadMessageWithEncodingN: %v", err)
+	}
+	if !reflect.DeepEqual(msg, msgInv) {
+		t.Errorf("read message %v, want %v", msg, msgInv)
+	}
+	if !bytes.Equal(payload, plain.Bytes()[MessageHeaderSize:]) {
+		t.Error("read payload is not the uncompressed payload")
+	}
+
+	// Compressed messages must not be accepted without the encoding.
+	_, _, _, err = ReadMessageWithEncodingN(bytes.NewReader(raw), pver, BaseEncoding)
+	if err == nil {
+		t.Error("compressed message read without CompressedEncoding")
+	}
+
+	// Small payloads are sent as they are.
+	small := NewMsgInv()
+	small.AddInvVect(NewInvVect(InvTypeBlock, &common.Hash{}))
+	var smallBuf bytes.Buffer
+	if _, err := WriteMessageWithEncodingN(&smallBuf, small, pver, enc); err != nil {
+		t.Fatalf("WriteMessageWithEncodingN: %v", err)
+	}
+	if cmd := string(bytes.TrimRight(smallBuf.Bytes()[:common.CommandSize],
+		"\x00")); cmd != CmdInv {
+		t.Errorf("small message command %q, want %q", cmd, CmdInv)
+	}
+}
+
+// TestDecompressLimit ensures a compressed payload can not expand beyond the
+// max payload length of the wrapped message.
+func TestDecompressLimit(t *testing.T) {
+	pver := common.ProtocolVersion
+
+	// A getdata message is not compressible.
+	payload, err := compressPayload(CmdGetData, make([]byte, 100))
+	if err != nil {
+		t.Fatalf("compressPayload: %v", err)
+	}
+	if _, _, err := decompressPayload(payload, pver); err == nil {
+		t.Error("compressed getdata message accepted")
+	}
+
+	// Headers expanding beyond their max payload length.
+	mpl := (&MsgHeaders{}).MaxPayloadLength(pver)
+	payload, err = compressPayload(CmdHeaders, make([]byte, mpl+1))
+	if err != nil {
+		t.Fatalf("compressPayload: %v", err)
+	}
+	if _, _, err := decompressPayload(payload, pver); err == nil {
+		t.Error("oversized decompressed payload accepted")
+	}
+
+	// A payload expanding beyond the max message payload, which is not
+	// decoded past it.
+	payload, err = compressPayload(CmdBlock, make([]byte, 4*MaxMessagePayload))
+	if err != nil {
+		t.Fatalf("compressPayload: %v", err)
+	}
+	if _, _, err := decompressPayload(payload, pver); err == nil {
+		t.Error("payload larger than the max message payload accepted")
+	}
+
+	// A valid headers message.
+	var count [1]byte
+	payload, err = compressPayload(CmdHeaders, count[:])
+	if err != nil {
+		t.Fatalf("compressPayload: %v", err)
+	}
+	msg, inner, err := decompressPayload(payload, pver)
+	if err != nil {
+		t.Fatalf("decompressPayload: %v", err)
+	}
+	if msg.Command() != CmdHeaders || !bytes.Equal(inner, count[:]) {
+		t.Errorf("decompressed %s message with payload %x", msg.Command(),
+			inner)
+	}
+}
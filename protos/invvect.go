@@ -33,6 +33,16 @@ const (
 	InvTypeFilteredBlock        InvType = 3
 	InvTypeSignature			InvType = 4
 	InvTypeTxForbidden          InvType = 5
+
+	// InvTypeAssetIssuance announces the hash of a transaction which
+	// issued an asset.  It is only announced to the peers which subscribed
+	// to it with a subscribeinv message.
+	InvTypeAssetIssuance InvType = 6
+
+	// InvTypeContractEvent announces the digest of an event emitted by a
+	// watched contract.  It is only announced to the peers which
+	// subscribed to it with a subscribeinv message.
+	InvTypeContractEvent InvType = 7
 )
 
 // Map of service flags back to their constant names for pretty printing.
@@ -42,6 +52,8 @@ var ivStrings = map[InvType]string{
 	InvTypeBlock:                "MSG_BLOCK",
 	InvTypeFilteredBlock:        "MSG_FILTERED_BLOCK",
 	InvTypeSignature:			 "MSG_SIGNATURE",
+	InvTypeAssetIssuance:        "MSG_ASSET_ISSUANCE",
+	InvTypeContractEvent:        "MSG_CONTRACT_EVENT",
 }
 
 // String returns the InvType in human-readable form.
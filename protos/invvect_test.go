@@ -24,6 +24,8 @@ func TestInvTypeStringer(t *testing.T) {
 		{InvTypeBlock, "MSG_BLOCK"},
 		{InvTypeFilteredBlock,"MSG_FILTERED_BLOCK"},
 		{InvTypeSignature,"MSG_SIGNATURE"},
+		{InvTypeAssetIssuance, "MSG_ASSET_ISSUANCE"},
+		{InvTypeContractEvent, "MSG_CONTRACT_EVENT"},
 		{0xffffffff, "Unknown InvType (4294967295)"},
 	}
 
@@ -25,35 +25,40 @@ const MaxMessagePayload = 1024 * 1024 * 2 // 2MB
 
 // Commands used in bitcoin message headers which describe the type of message.
 const (
-	CmdVersion      = "version"
-	CmdVerAck       = "verack"
-	CmdGetAddr      = "getaddr"
-	CmdAddr         = "addr"
-	CmdGetBlocks    = "getblocks"
-	CmdInv          = "inv"
-	CmdGetData      = "getdata"
-	CmdNotFound     = "notfound"
-	CmdBlock        = "block"
-	CmdTx           = "tx"
-	CmdSig          = "sig"
-	CmdGetHeaders   = "getheaders"
-	CmdHeaders      = "headers"
-	CmdPing         = "ping"
-	CmdPong         = "pong"
-	CmdMemPool      = "mempool"
-	CmdFilterAdd    = "filteradd"
-	CmdFilterClear  = "filterclear"
-	CmdFilterLoad   = "filterload"
-	CmdMerkleBlock  = "merkleblock"
-	CmdReject       = "reject"
-	CmdSendHeaders  = "sendheaders"
-	CmdFeeFilter    = "feefilter"
-	CmdGetCFilters  = "getcfilters"
-	CmdGetCFHeaders = "getcfheaders"
-	CmdGetCFCheckpt = "getcfcheckpt"
-	CmdCFilter      = "cfilter"
-	CmdCFHeaders    = "cfheaders"
-	CmdCFCheckpt    = "cfcheckpt"
+	CmdVersion         = "version"
+	CmdVerAck          = "verack"
+	CmdGetAddr         = "getaddr"
+	CmdAddr            = "addr"
+	CmdGetBlocks       = "getblocks"
+	CmdInv             = "inv"
+	CmdGetData         = "getdata"
+	CmdNotFound        = "notfound"
+	CmdBlock           = "block"
+	CmdTx              = "tx"
+	CmdSig             = "sig"
+	CmdGetHeaders      = "getheaders"
+	CmdHeaders         = "headers"
+	CmdPing            = "ping"
+	CmdPong            = "pong"
+	CmdMemPool         = "mempool"
+	CmdFilterAdd       = "filteradd"
+	CmdFilterClear     = "filterclear"
+	CmdFilterLoad      = "filterload"
+	CmdMerkleBlock     = "merkleblock"
+	CmdReject          = "reject"
+	CmdSendHeaders     = "sendheaders"
+	CmdFeeFilter       = "feefilter"
+	CmdGetCFilters     = "getcfilters"
+	CmdGetCFHeaders    = "getcfheaders"
+	CmdGetCFCheckpt    = "getcfcheckpt"
+	CmdCFilter         = "cfilter"
+	CmdCFHeaders       = "cfheaders"
+	CmdCFCheckpt       = "cfcheckpt"
+	CmdSendCompression = "sendcompress"
+	CmdCompressed      = "compressed"
+	CmdSendAddrV2      = "sendaddrv2"
+	CmdAddrV2          = "addrv2"
+	CmdSubscribeInv    = "subscribeinv"
 )
 
 // MessageEncoding represents the protos message encoding format to be used.
@@ -63,6 +68,13 @@ const (
 	// BaseEncoding encodes all messages in the default format specified
 	// for the Bitcoin protos protocol.
 	BaseEncoding MessageEncoding = 1 << iota
+
+	// CompressedEncoding allows the payloads of the compressible messages
+	// above CompressionThreshold to be sent compressed, wrapped in
+	// compressed messages.  It must only be used to write to peers which
+	// asked for it with a sendcompress message, and to read from peers
+	// which were sent one.
+	CompressedEncoding
 )
 
 // LatestEncoding is the most recently specified encoding for the Bitcoin protos
@@ -172,7 +184,23 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdCFCheckpt:
 		msg = &MsgCFCheckpt{}
 
+	case CmdSendCompression:
+		msg = &MsgSendCompression{}
+
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
+	case CmdSubscribeInv:
+		msg = &MsgSubscribeInv{}
+
 	default:
+		if IsCustomCommand(command) {
+			msg = &MsgCustom{Cmd: command}
+			break
+		}
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
 	return msg, nil
@@ -304,6 +332,24 @@ func WriteMessageWithEncodingN(w io.Writer, msg Message, pver uint32,
 		return totalBytes, messageError("WriteMessage", str)
 	}
 
+	// Compress large payloads when the peer accepts it, keeping the
+	// original payload when it does not get smaller.
+	if encoding&CompressedEncoding != 0 && lenp > CompressionThreshold &&
+		compressible(cmd) {
+
+		compressed, err := compressPayload(cmd, payload)
+		if err != nil {
+			return totalBytes, err
+		}
+		if len(compressed) < lenp {
+			cmd = CmdCompressed
+			command = [common.CommandSize]byte{}
+			copy(command[:], cmd)
+			payload = compressed
+			lenp = len(payload)
+		}
+	}
+
 	// Create header for the message.
 	hdr := messageHeader{}
 	hdr.command = cmd
@@ -374,18 +420,29 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, enc MessageEncoding) (in
 		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
-	// Create struct of appropriate message type based on the command.
-	msg, err := makeEmptyMessage(command)
-	if err != nil {
-		discardInput(r, hdr.length)
-		return totalBytes, nil, nil, messageError("ReadMessage",
-			err.Error())
+	// Create struct of appropriate message type based on the command.  The
+	// type of compressed messages is only known once decompressed.
+	var msg Message
+	mpl := uint32(MaxMessagePayload)
+	if command == CmdCompressed {
+		if enc&CompressedEncoding == 0 {
+			discardInput(r, hdr.length)
+			return totalBytes, nil, nil, messageError("ReadMessage",
+				"unexpected compressed message")
+		}
+	} else {
+		msg, err = makeEmptyMessage(command)
+		if err != nil {
+			discardInput(r, hdr.length)
+			return totalBytes, nil, nil, messageError("ReadMessage",
+				err.Error())
+		}
+		mpl = msg.MaxPayloadLength(pver)
 	}
 
 	// Check for maximum length based on the message type as a malicious client
 	// could otherwise create a well-formed header and set the length to max
 	// numbers in order to exhaust the machine's memory.
-	mpl := msg.MaxPayloadLength(pver)
 	if hdr.length > mpl {
 		discardInput(r, hdr.length)
 		str := fmt.Sprintf("payload exceeds max length - header "+
@@ -411,6 +468,13 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, enc MessageEncoding) (in
 		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
+	if command == CmdCompressed {
+		msg, payload, err = decompressPayload(payload, pver)
+		if err != nil {
+			return totalBytes, nil, nil, err
+		}
+	}
+
 	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
 	// MsgVersion VVSDecode function requires it.
 	pr := bytes.NewBuffer(payload)
@@ -0,0 +1,216 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/serialization"
+)
+
+// MaxAddrV2Len is the maximum length of the address of an addrv2 message,
+// whichever its network.
+const MaxAddrV2Len = 512
+
+// Timestamp 8 bytes + services 8 bytes + network 1 byte + address length
+// (varInt) + max address + port 2 bytes.
+const maxNetAddressV2Payload = 19 + serialization.MaxVarIntPayload + MaxAddrV2Len
+
+// MsgAddrV2 implements the Message interface and represents an addrv2
+// message.  It is used as the addr message, to provide a list of known active
+// peers on the network, and also relays the addresses which are not IP
+// addresses, such as Tor v3 and I2P addresses.  The addresses of the networks
+// which are not known are skipped when decoding the message.
+//
+// This message was not added until protocol versions starting with
+// AddrV2Version, and must only be sent to peers which sent a sendaddrv2
+// message.
+type MsgAddrV2 struct {
+	AddrList []*NetAddress
+}
+
+// AddAddress adds a known active peer to the message.
+func (msg *MsgAddrV2) AddAddress(na *NetAddress) error {
+	if len(msg.AddrList)+1 > MaxAddrPerMsg {
+		str := fmt.Sprintf("too many addresses in message [max %v]",
+			MaxAddrPerMsg)
+		return messageError("MsgAddrV2.AddAddress", str)
+	}
+
+	msg.AddrList = append(msg.AddrList, na)
+	return nil
+}
+
+// AddAddresses adds multiple known active peers to the message.
+func (msg *MsgAddrV2) AddAddresses(netAddrs ...*NetAddress) error {
+	for _, na := range netAddrs {
+		err := msg.AddAddress(na)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VVSDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgAddrV2) VVSDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	count, err := serialization.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max addresses per message.
+	if count > MaxAddrPerMsg {
+		str := fmt.Sprintf("too many addresses for message "+
+			"[count %v, max %v]", count, MaxAddrPerMsg)
+		return messageError("MsgAddrV2.VVSDecode", str)
+	}
+
+	msg.AddrList = make([]*NetAddress, 0, count)
+	for i := uint64(0); i < count; i++ {
+		na, err := readNetAddressV2(r, pver)
+		if err != nil {
+			return err
+		}
+		if na != nil {
+			msg.AddrList = append(msg.AddrList, na)
+		}
+	}
+	return nil
+}
+
+// VVSEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgAddrV2) VVSEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	count := len(msg.AddrList)
+	if count > MaxAddrPerMsg {
+		str := fmt.Sprintf("too many addresses for message "+
+			"[count %v, max %v]", count, MaxAddrPerMsg)
+		return messageError("MsgAddrV2.VVSEncode", str)
+	}
+
+	err := serialization.WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	for _, na := range msg.AddrList {
+		err = writeNetAddressV2(w, pver, na)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgAddrV2) Command() string {
+	return CmdAddrV2
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgAddrV2) MaxPayloadLength(pver uint32) uint32 {
+	// Num addresses (varInt) + max allowed addresses.
+	return serialization.MaxVarIntPayload + (MaxAddrPerMsg * maxNetAddressV2Payload)
+}
+
+// NewMsgAddrV2 returns a new addrv2 message that conforms to the Message
+// interface.  See MsgAddrV2 for details.
+func NewMsgAddrV2() *MsgAddrV2 {
+	return &MsgAddrV2{
+		AddrList: make([]*NetAddress, 0, MaxAddrPerMsg),
+	}
+}
+
+// readNetAddressV2 reads an address of an addrv2 message from r.  It returns
+// nil without error for the addresses of the networks which are not known.
+func readNetAddressV2(r io.Reader, pver uint32) (*NetAddress, error) {
+	var timestamp uint64
+	if err := serialization.ReadUint64(r, &timestamp); err != nil {
+		return nil, err
+	}
+	var services uint64
+	if err := serialization.ReadUint64(r, &services); err != nil {
+		return nil, err
+	}
+	var network uint8
+	if err := serialization.ReadUint8(r, &network); err != nil {
+		return nil, err
+	}
+	addr, err := serialization.ReadVarBytes(r, pver, MaxAddrV2Len, "address")
+	if err != nil {
+		return nil, err
+	}
+	var port uint16
+	if err := serialization.ReadUint16(r, &port); err != nil {
+		return nil, err
+	}
+
+	addrLen, ok := networkAddrLen[NetworkID(network)]
+	if !ok {
+		return nil, nil
+	}
+	if len(addr) != addrLen {
+		str := fmt.Sprintf("address of network %d has %d bytes, "+
+			"expected %d", network, len(addr), addrLen)
+		return nil, messageError("readNetAddressV2", str)
+	}
+
+	na := &NetAddress{
+		Timestamp: time.Unix(int64(timestamp), 0),
+		Services:  common.ServiceFlag(services),
+		Port:      port,
+	}
+	switch NetworkID(network) {
+	case NetIPv4, NetIPv6:
+		na.IP = net.IP(addr).To16()
+	default:
+		na.Network = NetworkID(network)
+		na.Addr = addr
+	}
+	return na, nil
+}
+
+// writeNetAddressV2 serializes an address of an addrv2 message to w.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddress) error {
+	network := na.NetworkID()
+	var addr []byte
+	switch network {
+	case NetIPv4:
+		addr = na.IP.To4()
+	case NetIPv6:
+		// Ensure to always write 16 bytes even if the ip is nil.
+		addr = make([]byte, 16)
+		copy(addr, na.IP.To16())
+	default:
+		addr = na.Addr
+	}
+	if addrLen, ok := networkAddrLen[network]; !ok || len(addr) != addrLen {
+		str := fmt.Sprintf("address of network %d has %d bytes",
+			network, len(addr))
+		return messageError("writeNetAddressV2", str)
+	}
+
+	if err := serialization.WriteUint64(w, uint64(na.Timestamp.Unix())); err != nil {
+		return err
+	}
+	if err := serialization.WriteUint64(w, uint64(na.Services)); err != nil {
+		return err
+	}
+	if err := serialization.WriteUint8(w, uint8(network)); err != nil {
+		return err
+	}
+	if err := serialization.WriteVarBytes(w, pver, addr); err != nil {
+		return err
+	}
+	return serialization.WriteUint16(w, na.Port)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestAddrV2Wire tests the MsgAddrV2 protocol encode and decode of the
+// addresses of each network.
+func TestAddrV2Wire(t *testing.T) {
+	pver := common.ProtocolVersion
+	ts := time.Unix(0x495fab29, 0)
+
+	torKey := bytes.Repeat([]byte{0xab}, 32)
+	i2pHash := bytes.Repeat([]byte{0xcd}, 32)
+	msg := NewMsgAddrV2()
+	if cmd := msg.Command(); cmd != CmdAddrV2 {
+		t.Errorf("wrong command - got %v want %v", cmd, CmdAddrV2)
+	}
+	msg.AddAddresses(
+		&NetAddress{Timestamp: ts, Services: common.SFNodeNetwork,
+			IP: net.ParseIP("127.0.0.1"), Port: 8333},
+		&NetAddress{Timestamp: ts, IP: net.ParseIP("2001:db8::1"), Port: 8334},
+		&NetAddress{Timestamp: ts, Network: NetTorV3, Addr: torKey, Port: 9050},
+		&NetAddress{Timestamp: ts, Network: NetI2P, Addr: i2pHash, Port: 0},
+	)
+	wantNetworks := []NetworkID{NetIPv4, NetIPv6, NetTorV3, NetI2P}
+	for i, na := range msg.AddrList {
+		if na.NetworkID() != wantNetworks[i] {
+			t.Errorf("NetworkID #%d: got %d want %d", i,
+				na.NetworkID(), wantNetworks[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := msg.VVSEncode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSEncode: %v", err)
+	}
+	// The IPv4 address is encoded on 4 bytes.
+	wantIPv4 := []byte{
+		0x04,                                           // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x00, 0x00, 0x00, // Timestamp
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // SFNodeNetwork
+		0x01,                   // NetIPv4
+		0x04,                   // Address length
+		0x7f, 0x00, 0x00, 0x01, // IP 127.0.0.1
+	}
+	if !bytes.HasPrefix(buf.Bytes(), wantIPv4) {
+		t.Errorf("VVSEncode: got %x want prefix %x", buf.Bytes(), wantIPv4)
+	}
+	if uint32(buf.Len()) > msg.MaxPayloadLength(pver) {
+		t.Errorf("payload of %d bytes exceeds max payload length %d",
+			buf.Len(), msg.MaxPayloadLength(pver))
+	}
+
+	var readmsg MsgAddrV2
+	if err := readmsg.VVSDecode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSDecode: %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Errorf("VVSDecode: got %v want %v", readmsg.AddrList, msg.AddrList)
+	}
+}
+
+// TestAddrV2WireErrors tests the MsgAddrV2 protocol decode of the unknown
+// networks and of the malformed addresses.
+func TestAddrV2WireErrors(t *testing.T) {
+	pver := common.ProtocolVersion
+
+	// The address of an unknown network is skipped.
+	unknown := []byte{
+		0x01,                                           // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x00, 0x00, 0x00, // Timestamp
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Services
+		0x07,       // Unknown network
+		0x02,       // Address length
+		0x01, 0x02, // Address
+		0x8d, 0x20, // Port
+	}
+	var readmsg MsgAddrV2
+	if err := readmsg.VVSDecode(bytes.NewReader(unknown), pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSDecode: %v", err)
+	}
+	if len(readmsg.AddrList) != 0 {
+		t.Errorf("VVSDecode: unknown network decoded as %v", readmsg.AddrList)
+	}
+
+	// The address of a known network must have the length of its
+	// addresses.
+	malformed := append([]byte(nil), unknown...)
+	malformed[17] = byte(NetTorV3)
+	if err := readmsg.VVSDecode(bytes.NewReader(malformed), pver, BaseEncoding); err == nil {
+		t.Error("VVSDecode: malformed Tor v3 address accepted")
+	}
+	bad := &MsgAddrV2{AddrList: []*NetAddress{{Network: NetI2P, Addr: []byte{1}}}}
+	var buf bytes.Buffer
+	if err := bad.VVSEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("VVSEncode: malformed I2P address accepted")
+	}
+
+	// Too many addresses must be refused.
+	tooMany := NewMsgAddrV2()
+	for i := 0; i < MaxAddrPerMsg; i++ {
+		tooMany.AddAddress(&NetAddress{IP: net.ParseIP("127.0.0.1")})
+	}
+	if err := tooMany.AddAddress(&NetAddress{}); err == nil {
+		t.Error("AddAddress: too many addresses accepted")
+	}
+	tooMany.AddrList = append(tooMany.AddrList, &NetAddress{})
+	if err := tooMany.VVSEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("VVSEncode: too many addresses accepted")
+	}
+	encoded := []byte{0xfd, 0xe9, 0x03} // Varint for 1001 addresses
+	if err := readmsg.VVSDecode(bytes.NewReader(encoded), pver, BaseEncoding); err == nil {
+		t.Error("VVSDecode: too many addresses accepted")
+	}
+}
+
+// TestSendAddrV2Wire tests the MsgSendAddrV2 protocol encode and decode.
+func TestSendAddrV2Wire(t *testing.T) {
+	pver := common.ProtocolVersion
+
+	msg := NewMsgSendAddrV2()
+	if cmd := msg.Command(); cmd != CmdSendAddrV2 {
+		t.Errorf("wrong command - got %v want %v", cmd, CmdSendAddrV2)
+	}
+	if maxPayload := msg.MaxPayloadLength(pver); maxPayload != 0 {
+		t.Errorf("MaxPayloadLength: got %d want 0", maxPayload)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.VVSEncode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSEncode: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("VVSEncode: got %x want no payload", buf.Bytes())
+	}
+	var readmsg MsgSendAddrV2
+	if err := readmsg.VVSDecode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSDecode: %v", err)
+	}
+}
@@ -559,7 +559,7 @@ var blockOne = MsgBlock{
 					Data:  []byte{},
 				},
 			},
-			TxContract:TxContract{0},
+			TxContract:TxContract{GasLimit: 0},
 			LockTime: 0,
 		},
 	},
@@ -19,6 +19,11 @@ type FilterType uint8
 const (
 	// GCSFilterRegular is the regular filter type.
 	GCSFilterRegular FilterType = iota
+
+	// GCSFilterContract is the filter type which also matches the outputs
+	// of the virtual blocks and the addresses, including the contract
+	// addresses, the scripts pay to.
+	GCSFilterContract
 )
 
 const (
@@ -0,0 +1,85 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// CustomCommandPrefix is the prefix of the commands reserved for the custom
+// messages of the applications embedding a node, such as sidecar protocols.
+// The node never defines commands with this prefix.
+const CustomCommandPrefix = "x-"
+
+// MaxCustomPayload is the maximum payload size of a custom message.
+const MaxCustomPayload = 1024 * 1024
+
+// IsCustomCommand returns whether the command is in the namespace reserved for
+// custom messages.
+func IsCustomCommand(command string) bool {
+	return strings.HasPrefix(command, CustomCommandPrefix) &&
+		len(command) > len(CustomCommandPrefix)
+}
+
+// MsgCustom implements the Message interface and represents a message of a
+// command in the namespace reserved for custom messages.  Its payload is
+// opaque to the node and left to the handler registered for the command.
+type MsgCustom struct {
+	Cmd     string
+	Payload []byte
+}
+
+// VVSDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCustom) VVSDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	payload, err := ioutil.ReadAll(io.LimitReader(r, MaxCustomPayload+1))
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxCustomPayload {
+		str := fmt.Sprintf("custom payload is too large [max %v]",
+			MaxCustomPayload)
+		return messageError("MsgCustom.VVSDecode", str)
+	}
+	msg.Payload = payload
+	return nil
+}
+
+// VVSEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCustom) VVSEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if !IsCustomCommand(msg.Cmd) {
+		str := fmt.Sprintf("command [%s] is not a custom command", msg.Cmd)
+		return messageError("MsgCustom.VVSEncode", str)
+	}
+	if len(msg.Payload) > MaxCustomPayload {
+		str := fmt.Sprintf("custom payload is too large [size %v, "+
+			"max %v]", len(msg.Payload), MaxCustomPayload)
+		return messageError("MsgCustom.VVSEncode", str)
+	}
+	_, err := w.Write(msg.Payload)
+	return err
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCustom) Command() string {
+	return msg.Cmd
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCustom) MaxPayloadLength(pver uint32) uint32 {
+	return MaxCustomPayload
+}
+
+// NewMsgCustom returns a new custom message of the passed command and payload
+// that conforms to the Message interface.  See MsgCustom for details.
+func NewMsgCustom(command string, payload []byte) *MsgCustom {
+	return &MsgCustom{Cmd: command, Payload: payload}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestCustomWire tests the MsgCustom protocol encode and decode, along with
+// the custom messages read from the wire.
+func TestCustomWire(t *testing.T) {
+	pver := common.ProtocolVersion
+
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"x-oracle", true},
+		{"x-", false},
+		{"oracle", false},
+		{CmdVersion, false},
+	}
+	for _, test := range tests {
+		if got := IsCustomCommand(test.in); got != test.want {
+			t.Errorf("IsCustomCommand(%q): got %v want %v", test.in,
+				got, test.want)
+		}
+	}
+
+	msg := NewMsgCustom("x-oracle", []byte{0x01, 0x02, 0x03})
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, msg, pver); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	_, readmsg, _, err := ReadMessageN(&buf, pver)
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if !reflect.DeepEqual(readmsg, msg) {
+		t.Errorf("ReadMessage: got %v want %v", readmsg, msg)
+	}
+
+	// Commands outside the reserved namespace and oversized payloads
+	// must be refused.
+	bad := NewMsgCustom("oracle", nil)
+	if err := bad.VVSEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("VVSEncode: command outside the namespace accepted")
+	}
+	bad = NewMsgCustom("x-oracle", make([]byte, MaxCustomPayload+1))
+	if err := bad.VVSEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("VVSEncode: oversized payload accepted")
+	}
+	oversized := bytes.NewReader(make([]byte, MaxCustomPayload+1))
+	if err := bad.VVSDecode(oversized, pver, BaseEncoding); err == nil {
+		t.Error("VVSDecode: oversized payload accepted")
+	}
+}
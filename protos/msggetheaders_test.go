@@ -100,7 +100,7 @@ func TestGetHeadersWire(t *testing.T) {
 	noLocators := NewMsgGetHeaders()
 	noLocators.ProtocolVersion = pver
 	noLocatorsEncoded := []byte{
-		0x01, 0x00, 0x00, 0x00, // Protocol version
+		0x04, 0x00, 0x00, 0x00, // Protocol version
 		0x00, // Varint for number of block locator hashes
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
@@ -115,7 +115,7 @@ func TestGetHeadersWire(t *testing.T) {
 	multiLocators.AddBlockLocatorHash(hashLocator2)
 	multiLocators.AddBlockLocatorHash(hashLocator)
 	multiLocatorsEncoded := []byte{
-		0x01, 0x00, 0x00, 0x00, // ProtocolVersion
+		0x04, 0x00, 0x00, 0x00, // ProtocolVersion
 		0x02, // Varint for number of block locator hashes
 		0xe0, 0xde, 0x06, 0x44, 0x68, 0x13, 0x2c, 0x63,
 		0xd2, 0x20, 0xcc, 0x69, 0x12, 0x83, 0xcb, 0x65,
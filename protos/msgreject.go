@@ -26,6 +26,7 @@ const (
 	RejectForbidden       RejectCode = 0x13
 	RejectNonstandard     RejectCode = 0x40
 	RejectLowGasPrice     RejectCode = 0x41
+	RejectInsufficientFee RejectCode = 0x42
 	RejectCheckpoint      RejectCode = 0x43
 	RejectFeeUnsupport    RejectCode = 0x44
 )
@@ -39,6 +40,7 @@ var rejectCodeStrings = map[RejectCode]string{
 	RejectForbidden:       "REJECT_FORBIDDEN",
 	RejectNonstandard:     "REJECT_NONSTANDARD",
 	RejectLowGasPrice:     "REJECT_LOWGASPRICE",
+	RejectInsufficientFee: "REJECT_INSUFFICIENTFEE",
 	RejectCheckpoint:      "REJECT_CHECKPOINT",
 	RejectFeeUnsupport:    "REJECT_FEEUNSUPPORT",
 }
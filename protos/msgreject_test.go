@@ -26,6 +26,7 @@ func TestRejectCodeStringer(t *testing.T) {
 		{RejectDuplicate, "REJECT_DUPLICATE"},
 		{RejectNonstandard, "REJECT_NONSTANDARD"},
 		{RejectLowGasPrice, "REJECT_LOWGASPRICE"},
+		{RejectInsufficientFee, "REJECT_INSUFFICIENTFEE"},
 		{RejectCheckpoint, "REJECT_CHECKPOINT"},
 		{0xff, "Unknown RejectCode (255)"},
 	}
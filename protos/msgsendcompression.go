@@ -0,0 +1,110 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/AsimovNetwork/asimov/common/serialization"
+)
+
+// CompressionCodec identifies a compression algorithm of the message
+// payloads.
+type CompressionCodec uint8
+
+const (
+	// CodecZstd compresses the payloads with zstd (RFC 8878).
+	CodecZstd CompressionCodec = 1
+)
+
+// MaxCompressionCodecs is the maximum number of codecs a sendcompress message
+// may list.
+const MaxCompressionCodecs = 8
+
+// MsgSendCompression implements the Message interface and represents a
+// sendcompress message.  It is used to tell the peer it may compress the
+// large payloads of the messages it sends with one of the listed codecs, in
+// order of preference.
+//
+// This message was not added until protocol versions starting with
+// CompressionVersion.
+type MsgSendCompression struct {
+	Codecs []CompressionCodec
+}
+
+// VVSDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCompression) VVSDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	count, err := serialization.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxCompressionCodecs {
+		str := fmt.Sprintf("too many codecs for message "+
+			"[count %v, max %v]", count, MaxCompressionCodecs)
+		return messageError("MsgSendCompression.VVSDecode", str)
+	}
+
+	msg.Codecs = make([]CompressionCodec, count)
+	for i := range msg.Codecs {
+		var codec uint8
+		if err := serialization.ReadUint8(r, &codec); err != nil {
+			return err
+		}
+		msg.Codecs[i] = CompressionCodec(codec)
+	}
+	return nil
+}
+
+// VVSEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCompression) VVSEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	count := len(msg.Codecs)
+	if count > MaxCompressionCodecs {
+		str := fmt.Sprintf("too many codecs for message "+
+			"[count %v, max %v]", count, MaxCompressionCodecs)
+		return messageError("MsgSendCompression.VVSEncode", str)
+	}
+
+	if err := serialization.WriteVarInt(w, pver, uint64(count)); err != nil {
+		return err
+	}
+	for _, codec := range msg.Codecs {
+		if err := serialization.WriteUint8(w, uint8(codec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCompression) Command() string {
+	return CmdSendCompression
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCompression) MaxPayloadLength(pver uint32) uint32 {
+	// Num codecs (varInt) + max allowed codecs.
+	return serialization.MaxVarIntPayload + MaxCompressionCodecs
+}
+
+// HasCodec returns whether the codec is listed by the message.
+func (msg *MsgSendCompression) HasCodec(codec CompressionCodec) bool {
+	for _, c := range msg.Codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMsgSendCompression returns a new sendcompress message that conforms to
+// the Message interface.  See MsgSendCompression for details.
+func NewMsgSendCompression(codecs ...CompressionCodec) *MsgSendCompression {
+	return &MsgSendCompression{Codecs: codecs}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestSendCompressionWire tests the MsgSendCompression protocol encode and
+// decode.
+func TestSendCompressionWire(t *testing.T) {
+	pver := common.ProtocolVersion
+
+	msg := NewMsgSendCompression(CodecZstd, 7)
+	if cmd := msg.Command(); cmd != CmdSendCompression {
+		t.Errorf("wrong command - got %v want %v", cmd,
+			CmdSendCompression)
+	}
+	if !msg.HasCodec(CodecZstd) || msg.HasCodec(2) {
+		t.Errorf("HasCodec: unexpected result for codecs %v", msg.Codecs)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.VVSEncode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSEncode: %v", err)
+	}
+	want := []byte{0x02, 0x01, 0x07}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("VVSEncode: got %x want %x", buf.Bytes(), want)
+	}
+	if uint32(buf.Len()) > msg.MaxPayloadLength(pver) {
+		t.Errorf("payload of %d bytes exceeds max payload length %d",
+			buf.Len(), msg.MaxPayloadLength(pver))
+	}
+
+	var readmsg MsgSendCompression
+	if err := readmsg.VVSDecode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSDecode: %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Errorf("VVSDecode: got %v want %v", readmsg, msg)
+	}
+
+	// Too many codecs must be refused.
+	tooMany := NewMsgSendCompression(make([]CompressionCodec,
+		MaxCompressionCodecs+1)...)
+	if err := tooMany.VVSEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("VVSEncode: too many codecs accepted")
+	}
+	encoded := append([]byte{MaxCompressionCodecs + 1},
+		make([]byte, MaxCompressionCodecs+1)...)
+	if err := readmsg.VVSDecode(bytes.NewReader(encoded), pver, BaseEncoding); err == nil {
+		t.Error("VVSDecode: too many codecs accepted")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/AsimovNetwork/asimov/common/serialization"
+)
+
+// MaxSubscribeInvTypes is the maximum number of inventory types a
+// subscribeinv message may list.
+const MaxSubscribeInvTypes = 8
+
+// MsgSubscribeInv implements the Message interface and represents a
+// subscribeinv message.  It is used to tell the peer to announce only the
+// listed inventory types, such as the asset issuance and contract event
+// classes which are not announced otherwise.
+//
+// This message is only sent to the peers advertising SFNodeInvClasses.
+type MsgSubscribeInv struct {
+	Types []InvType
+}
+
+// VVSDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSubscribeInv) VVSDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	count, err := serialization.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxSubscribeInvTypes {
+		str := fmt.Sprintf("too many inventory types for message "+
+			"[count %v, max %v]", count, MaxSubscribeInvTypes)
+		return messageError("MsgSubscribeInv.VVSDecode", str)
+	}
+
+	msg.Types = make([]InvType, count)
+	for i := range msg.Types {
+		var typ uint32
+		if err := serialization.ReadUint32(r, &typ); err != nil {
+			return err
+		}
+		msg.Types[i] = InvType(typ)
+	}
+	return nil
+}
+
+// VVSEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSubscribeInv) VVSEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	count := len(msg.Types)
+	if count > MaxSubscribeInvTypes {
+		str := fmt.Sprintf("too many inventory types for message "+
+			"[count %v, max %v]", count, MaxSubscribeInvTypes)
+		return messageError("MsgSubscribeInv.VVSEncode", str)
+	}
+
+	if err := serialization.WriteVarInt(w, pver, uint64(count)); err != nil {
+		return err
+	}
+	for _, typ := range msg.Types {
+		if err := serialization.WriteUint32(w, uint32(typ)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSubscribeInv) Command() string {
+	return CmdSubscribeInv
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSubscribeInv) MaxPayloadLength(pver uint32) uint32 {
+	// Num types (varInt) + max allowed types.
+	return serialization.MaxVarIntPayload + MaxSubscribeInvTypes*4
+}
+
+// HasType returns whether the inventory type is listed by the message.
+func (msg *MsgSubscribeInv) HasType(typ InvType) bool {
+	for _, t := range msg.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMsgSubscribeInv returns a new subscribeinv message that conforms to the
+// Message interface.  See MsgSubscribeInv for details.
+func NewMsgSubscribeInv(types ...InvType) *MsgSubscribeInv {
+	return &MsgSubscribeInv{Types: types}
+}
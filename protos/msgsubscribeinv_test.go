@@ -0,0 +1,62 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// TestSubscribeInvWire tests the MsgSubscribeInv protocol encode and decode.
+func TestSubscribeInvWire(t *testing.T) {
+	pver := common.ProtocolVersion
+
+	msg := NewMsgSubscribeInv(InvTypeBlock, InvTypeAssetIssuance)
+	if cmd := msg.Command(); cmd != CmdSubscribeInv {
+		t.Errorf("wrong command - got %v want %v", cmd, CmdSubscribeInv)
+	}
+	if !msg.HasType(InvTypeAssetIssuance) || msg.HasType(InvTypeTx) {
+		t.Errorf("HasType: unexpected result for types %v", msg.Types)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.VVSEncode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSEncode: %v", err)
+	}
+	want := []byte{
+		0x02,
+		0x02, 0x00, 0x00, 0x00, // InvTypeBlock
+		0x06, 0x00, 0x00, 0x00, // InvTypeAssetIssuance
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("VVSEncode: got %x want %x", buf.Bytes(), want)
+	}
+	if uint32(buf.Len()) > msg.MaxPayloadLength(pver) {
+		t.Errorf("payload of %d bytes exceeds max payload length %d",
+			buf.Len(), msg.MaxPayloadLength(pver))
+	}
+
+	var readmsg MsgSubscribeInv
+	if err := readmsg.VVSDecode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("VVSDecode: %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Errorf("VVSDecode: got %v want %v", readmsg, msg)
+	}
+
+	// Too many types must be refused.
+	tooMany := NewMsgSubscribeInv(make([]InvType, MaxSubscribeInvTypes+1)...)
+	if err := tooMany.VVSEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("VVSEncode: too many types accepted")
+	}
+	encoded := append([]byte{MaxSubscribeInvTypes + 1},
+		make([]byte, (MaxSubscribeInvTypes+1)*4)...)
+	if err := readmsg.VVSDecode(bytes.NewReader(encoded), pver, BaseEncoding); err == nil {
+		t.Error("VVSDecode: too many types accepted")
+	}
+}
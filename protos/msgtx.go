@@ -22,6 +22,37 @@ const (
 	// TxVersion is the current latest supported transaction version.
 	TxVersion = 1
 
+	// TxFlagAccessList is a flag that if set on the version of a
+	// transaction, the transaction contract carries an access list.  The
+	// version of virtual transactions holds the index of their transaction,
+	// so a flag is used rather than a new version.
+	TxFlagAccessList uint32 = 1 << 31
+
+	// MaxAccessListAddresses is the maximum number of accounts an access
+	// list can declare.
+	MaxAccessListAddresses = 256
+
+	// MaxAccessListStorageKeys is the maximum number of storage slots an
+	// access list can declare, for all of its accounts.
+	MaxAccessListStorageKeys = 4096
+
+	// TxFlagStorageWitness is a flag that if set on the version of a
+	// transaction, the transaction contract carries storage witnesses
+	// reviving contract storage archived by state rent.
+	TxFlagStorageWitness uint32 = 1 << 30
+
+	// TxFlagsMask is the mask of the flags of the version of a transaction.
+	TxFlagsMask = TxFlagAccessList | TxFlagStorageWitness
+
+	// MaxStorageWitnesses is the maximum number of contracts whose storage
+	// a transaction can revive.
+	MaxStorageWitnesses = 16
+
+	// MaxStorageWitnessEntries is the maximum number of storage slots the
+	// storage witnesses of a transaction can carry, for all of their
+	// contracts.
+	MaxStorageWitnessEntries = 16384
+
 	// MaxTxInSequenceNum is the maximum sequence number the sequence field
 	// of a transaction input can be.
 	MaxTxInSequenceNum uint32 = 0xffffffff
@@ -400,6 +431,39 @@ func NewContractTxOut(value int64, pkScript []byte, asset Asset, data []byte) *T
 // Standard TxOut only accept addresses with id 0x66 | 0x73
 type TxContract struct {
 	GasLimit uint32
+
+	// AccessList declares the accounts and the storage slots the
+	// transaction accesses.  It is only serialized when the version of the
+	// transaction has the TxFlagAccessList flag.
+	AccessList []AccessTuple
+
+	// Witnesses carry the storage of contracts archived by state rent,
+	// which is revived before the transaction runs.  They are only
+	// serialized when the version of the transaction has the
+	// TxFlagStorageWitness flag.
+	Witnesses []StorageWitness
+}
+
+// AccessTuple declares an account along with storage slots of the account
+// accessed by a transaction.
+type AccessTuple struct {
+	Address     common.Address
+	StorageKeys []common.Hash
+}
+
+// StorageWitness carries the whole storage of a contract archived by state
+// rent.  The root of the storage trie built from the entries must be the root
+// of the archived storage.
+type StorageWitness struct {
+	Address common.Address
+	Entries []StorageEntry
+}
+
+// StorageEntry is a storage slot of a storage witness.  The key is the hash
+// of the slot, which is the key of the slot in the storage trie.
+type StorageEntry struct {
+	Key   common.Hash
+	Value common.Hash
 }
 
 // SerializeSize returns the number of bytes it would take to serialize the
@@ -409,6 +473,30 @@ func (t *TxContract) SerializeSize() int {
 	return 4
 }
 
+// accessListSerializeSize returns the number of bytes it would take to
+// serialize the access list of the transaction contract.
+func (t *TxContract) accessListSerializeSize() int {
+	n := serialization.VarIntSerializeSize(uint64(len(t.AccessList)))
+	for _, tuple := range t.AccessList {
+		n += common.AddressLength +
+			serialization.VarIntSerializeSize(uint64(len(tuple.StorageKeys))) +
+			len(tuple.StorageKeys)*common.HashLength
+	}
+	return n
+}
+
+// witnessesSerializeSize returns the number of bytes it would take to
+// serialize the storage witnesses of the transaction contract.
+func (t *TxContract) witnessesSerializeSize() int {
+	n := serialization.VarIntSerializeSize(uint64(len(t.Witnesses)))
+	for _, witness := range t.Witnesses {
+		n += common.AddressLength +
+			serialization.VarIntSerializeSize(uint64(len(witness.Entries))) +
+			len(witness.Entries)*2*common.HashLength
+	}
+	return n
+}
+
 // MsgTx implements the Message interface and represents an asimov tx message.
 // It is used to deliver transaction information in response to a getdata
 // message (MsgGetData) for a given transaction.
@@ -453,6 +541,31 @@ func (msg *MsgTx) SetTxContract(tc *TxContract) {
 	msg.TxContract = *tc
 }
 
+// HasAccessList returns whether the transaction carries an access list.
+func (msg *MsgTx) HasAccessList() bool {
+	return msg.Version&TxFlagAccessList != 0
+}
+
+// SetAccessList sets the access list of the transaction and flags its version
+// accordingly.
+func (msg *MsgTx) SetAccessList(list []AccessTuple) {
+	msg.Version |= TxFlagAccessList
+	msg.TxContract.AccessList = list
+}
+
+// HasStorageWitness returns whether the transaction carries storage
+// witnesses.
+func (msg *MsgTx) HasStorageWitness() bool {
+	return msg.Version&TxFlagStorageWitness != 0
+}
+
+// SetStorageWitnesses sets the storage witnesses of the transaction and flags
+// its version accordingly.
+func (msg *MsgTx) SetStorageWitnesses(witnesses []StorageWitness) {
+	msg.Version |= TxFlagStorageWitness
+	msg.TxContract.Witnesses = witnesses
+}
+
 // TxHash generates the Hash for the transaction.
 func (msg *MsgTx) TxHash() common.Hash {
 	// Encode the transaction and calculate double sha256 on the result.
@@ -541,6 +654,24 @@ func (msg *MsgTx) Copy() *MsgTx {
 	}
 
 	newTx.TxContract = msg.TxContract
+	if msg.TxContract.AccessList != nil {
+		newTx.TxContract.AccessList = make([]AccessTuple, len(msg.TxContract.AccessList))
+		for i, tuple := range msg.TxContract.AccessList {
+			newTx.TxContract.AccessList[i] = AccessTuple{
+				Address:     tuple.Address,
+				StorageKeys: append([]common.Hash(nil), tuple.StorageKeys...),
+			}
+		}
+	}
+	if msg.TxContract.Witnesses != nil {
+		newTx.TxContract.Witnesses = make([]StorageWitness, len(msg.TxContract.Witnesses))
+		for i, witness := range msg.TxContract.Witnesses {
+			newTx.TxContract.Witnesses[i] = StorageWitness{
+				Address: witness.Address,
+				Entries: append([]StorageEntry(nil), witness.Entries...),
+			}
+		}
+	}
 	return &newTx
 }
 
@@ -646,7 +777,7 @@ func (msg *MsgTx) VVSDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 
 	// The pointer is set now in case a script buffer is borrowed
 	// and needs to be returned to the pool on error.
-	err = readTxContract(r, &msg.TxContract)
+	err = readTxContract(r, pver, msg.Version, &msg.TxContract)
 	if err != nil {
 		returnScriptBuffers()
 		return err
@@ -791,7 +922,7 @@ func (msg *MsgTx) VVSEncode(w io.Writer, pver uint32, enc MessageEncoding) error
 		}
 	}
 
-	err = writeTxContract(w, &msg.TxContract)
+	err = writeTxContract(w, pver, msg.Version, &msg.TxContract)
 	if err != nil {
 		return err
 	}
@@ -815,6 +946,13 @@ func (msg *MsgTx) SerializeSize() int {
 		n += txOut.SerializeSize()
 	}
 
+	if msg.HasAccessList() {
+		n += msg.TxContract.accessListSerializeSize()
+	}
+	if msg.HasStorageWitness() {
+		n += msg.TxContract.witnessesSerializeSize()
+	}
+
 	return n
 }
 
@@ -1074,14 +1212,170 @@ func writeTxOut(w io.Writer, pver uint32, to *TxOut) error {
 }
 
 // readTxContract reads the next sequence of bytes from r as a transaction output
-// (TxContract).
-func readTxContract(r io.Reader, tc *TxContract) (err error) {
-	err = serialization.ReadUint32(r, &tc.GasLimit)
-	return
+// (TxContract), along with its access list and storage witnesses when the
+// passed version of the transaction is flagged accordingly.
+func readTxContract(r io.Reader, pver uint32, version uint32, tc *TxContract) error {
+	err := serialization.ReadUint32(r, &tc.GasLimit)
+	if err != nil {
+		return err
+	}
+	if version&TxFlagAccessList != 0 {
+		if err = readAccessList(r, pver, tc); err != nil {
+			return err
+		}
+	}
+	if version&TxFlagStorageWitness != 0 {
+		return readStorageWitnesses(r, pver, tc)
+	}
+	return nil
+}
+
+// readAccessList reads the access list of a transaction contract from r.
+func readAccessList(r io.Reader, pver uint32, tc *TxContract) error {
+	count, err := serialization.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxAccessListAddresses {
+		str := fmt.Sprintf("too many addresses in access list [count %d, max %d]",
+			count, MaxAccessListAddresses)
+		return messageError("readTxContract", str)
+	}
+	tc.AccessList = make([]AccessTuple, count)
+	totalKeys := uint64(0)
+	for i := range tc.AccessList {
+		tuple := &tc.AccessList[i]
+		if _, err = io.ReadFull(r, tuple.Address[:]); err != nil {
+			return err
+		}
+		count, err = serialization.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		totalKeys += count
+		if totalKeys > MaxAccessListStorageKeys {
+			str := fmt.Sprintf("too many storage keys in access list "+
+				"[count %d, max %d]", totalKeys, MaxAccessListStorageKeys)
+			return messageError("readTxContract", str)
+		}
+		tuple.StorageKeys = make([]common.Hash, count)
+		for j := range tuple.StorageKeys {
+			if _, err = io.ReadFull(r, tuple.StorageKeys[j][:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readStorageWitnesses reads the storage witnesses of a transaction contract
+// from r.
+func readStorageWitnesses(r io.Reader, pver uint32, tc *TxContract) error {
+	count, err := serialization.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxStorageWitnesses {
+		str := fmt.Sprintf("too many storage witnesses [count %d, max %d]",
+			count, MaxStorageWitnesses)
+		return messageError("readTxContract", str)
+	}
+	tc.Witnesses = make([]StorageWitness, count)
+	totalEntries := uint64(0)
+	for i := range tc.Witnesses {
+		witness := &tc.Witnesses[i]
+		if _, err = io.ReadFull(r, witness.Address[:]); err != nil {
+			return err
+		}
+		count, err = serialization.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		totalEntries += count
+		if totalEntries > MaxStorageWitnessEntries {
+			str := fmt.Sprintf("too many storage witness entries "+
+				"[count %d, max %d]", totalEntries, MaxStorageWitnessEntries)
+			return messageError("readTxContract", str)
+		}
+		witness.Entries = make([]StorageEntry, count)
+		for j := range witness.Entries {
+			entry := &witness.Entries[j]
+			if _, err = io.ReadFull(r, entry.Key[:]); err != nil {
+				return err
+			}
+			if _, err = io.ReadFull(r, entry.Value[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // writeTxContract encodes to into the asimov protocol encoding for a transaction
-// contract (TxContract) to w.
-func writeTxContract(w io.Writer, tc *TxContract) error {
-	return serialization.WriteUint32(w, tc.GasLimit)
+// contract (TxContract) to w, along with its access list and storage witnesses
+// when the passed version of the transaction is flagged accordingly.
+func writeTxContract(w io.Writer, pver uint32, version uint32, tc *TxContract) error {
+	err := serialization.WriteUint32(w, tc.GasLimit)
+	if err != nil {
+		return err
+	}
+	if version&TxFlagAccessList != 0 {
+		if err = writeAccessList(w, pver, tc); err != nil {
+			return err
+		}
+	}
+	if version&TxFlagStorageWitness != 0 {
+		return writeStorageWitnesses(w, pver, tc)
+	}
+	return nil
+}
+
+// writeAccessList writes the access list of a transaction contract to w.
+func writeAccessList(w io.Writer, pver uint32, tc *TxContract) error {
+	err := serialization.WriteVarInt(w, pver, uint64(len(tc.AccessList)))
+	if err != nil {
+		return err
+	}
+	for _, tuple := range tc.AccessList {
+		if _, err = w.Write(tuple.Address[:]); err != nil {
+			return err
+		}
+		err = serialization.WriteVarInt(w, pver, uint64(len(tuple.StorageKeys)))
+		if err != nil {
+			return err
+		}
+		for _, key := range tuple.StorageKeys {
+			if _, err = w.Write(key[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeStorageWitnesses writes the storage witnesses of a transaction
+// contract to w.
+func writeStorageWitnesses(w io.Writer, pver uint32, tc *TxContract) error {
+	err := serialization.WriteVarInt(w, pver, uint64(len(tc.Witnesses)))
+	if err != nil {
+		return err
+	}
+	for _, witness := range tc.Witnesses {
+		if _, err = w.Write(witness.Address[:]); err != nil {
+			return err
+		}
+		err = serialization.WriteVarInt(w, pver, uint64(len(witness.Entries)))
+		if err != nil {
+			return err
+		}
+		for _, entry := range witness.Entries {
+			if _, err = w.Write(entry.Key[:]); err != nil {
+				return err
+			}
+			if _, err = w.Write(entry.Value[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
@@ -827,6 +827,115 @@ var multiTxEncoded = []byte{
 	0x00, 0x00, 0x00, 0x00, // Lock time
 }
 
+// TestTxAccessList tests the serialization of the access list of a transaction.
+func TestTxAccessList(t *testing.T) {
+	list := []AccessTuple{
+		{
+			Address:     common.Address{0x66, 0x01},
+			StorageKeys: []common.Hash{{0x01}, {0x02}},
+		},
+		{Address: common.Address{0x63, 0x02}, StorageKeys: []common.Hash{}},
+	}
+	tx := multiTx.Copy()
+	tx.SetAccessList(list)
+	if !tx.HasAccessList() {
+		t.Fatal("HasAccessList: no access list after SetAccessList")
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	wantSize := len(multiTxEncoded) + 1 + (common.AddressLength + 1 +
+		2*common.HashLength) + (common.AddressLength + 1)
+	if buf.Len() != wantSize || tx.SerializeSize() != wantSize {
+		t.Fatalf("serialized %d bytes, size %d, want %d", buf.Len(),
+			tx.SerializeSize(), wantSize)
+	}
+	if tx.TxHash() == multiTx.TxHash() {
+		t.Fatal("TxHash: access list does not commit to the hash")
+	}
+
+	var decoded MsgTx
+	if err := decoded.Deserialize(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.TxContract.AccessList, list) {
+		t.Fatalf("Deserialize: wrong access list - got %v, want %v",
+			decoded.TxContract.AccessList, list)
+	}
+
+	// The access list of a transaction without the flag is not serialized.
+	tx.Version &^= TxFlagAccessList
+	buf.Reset()
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), multiTxEncoded) {
+		t.Fatalf("Serialize: access list serialized without the flag")
+	}
+
+	// Access lists beyond the limits are rejected.
+	tx.SetAccessList(make([]AccessTuple, MaxAccessListAddresses+1))
+	buf.Reset()
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	err := decoded.Deserialize(bytes.NewReader(buf.Bytes()))
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("Deserialize: got error %v, want MessageError", err)
+	}
+}
+
+// TestTxStorageWitness tests the serialization of the storage witnesses of a
+// transaction.
+func TestTxStorageWitness(t *testing.T) {
+	witnesses := []StorageWitness{
+		{
+			Address: common.Address{0x63, 0x01},
+			Entries: []StorageEntry{{Key: common.Hash{0x01}, Value: common.Hash{0x02}}},
+		},
+	}
+	tx := multiTx.Copy()
+	tx.SetAccessList([]AccessTuple{{Address: common.Address{0x63, 0x01}, StorageKeys: []common.Hash{}}})
+	tx.SetStorageWitnesses(witnesses)
+	if !tx.HasStorageWitness() {
+		t.Fatal("HasStorageWitness: no witness after SetStorageWitnesses")
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	wantSize := len(multiTxEncoded) + 1 + (common.AddressLength + 1) +
+		1 + (common.AddressLength + 1 + 2*common.HashLength)
+	if buf.Len() != wantSize || tx.SerializeSize() != wantSize {
+		t.Fatalf("serialized %d bytes, size %d, want %d", buf.Len(),
+			tx.SerializeSize(), wantSize)
+	}
+
+	var decoded MsgTx
+	if err := decoded.Deserialize(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.TxContract.Witnesses, witnesses) ||
+		len(decoded.TxContract.AccessList) != 1 {
+		t.Fatalf("Deserialize: wrong witnesses - got %v, want %v",
+			decoded.TxContract.Witnesses, witnesses)
+	}
+
+	// Witnesses beyond the limits are rejected.
+	tx.SetStorageWitnesses(make([]StorageWitness, MaxStorageWitnesses+1))
+	buf.Reset()
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	err := decoded.Deserialize(bytes.NewReader(buf.Bytes()))
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("Deserialize: got error %v, want MessageError", err)
+	}
+}
+
 // multiTxPkScriptLocs is the location information for the public key scripts
 // located in multiTx.
 var multiTxPkScriptLocs = []int{63, 127, 217}
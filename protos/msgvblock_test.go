@@ -288,7 +288,7 @@ var vblockOne = MsgVBlock{
 					Data:  []byte{},
 				},
 			},
-			TxContract:TxContract{0},
+			TxContract:TxContract{GasLimit: 0},
 			LockTime: 0,
 		},
 	},
@@ -11,6 +11,7 @@ import (
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/common/serialization"
 	"io"
+	"sort"
 	"strings"
 	"time"
 	"unsafe"
@@ -20,6 +21,18 @@ import (
 // version message (MsgVersion).
 const MaxUserAgentLen = 256
 
+const (
+	// MaxMetadataEntries is the maximum number of entries of the metadata
+	// map of a version message.
+	MaxMetadataEntries = 16
+
+	// MaxMetadataKeyLen is the maximum length of a metadata key.
+	MaxMetadataKeyLen = 32
+
+	// MaxMetadataValueLen is the maximum length of a metadata value.
+	MaxMetadataValueLen = 128
+)
+
 // DefaultUserAgent for protos in the stack
 const DefaultUserAgent = "/asimovproto:0.0.1/"
 
@@ -66,6 +79,12 @@ type MsgVersion struct {
 
 	// Don't announce transactions to peer.
 	DisableRelayTx bool
+
+	// Metadata holds operational key/value pairs of the deployment, such
+	// as the region or the role of the node.  It is only encoded when the
+	// SFNodeMetadata service is advertised, in which case the map may be
+	// omitted by peers which have no metadata.
+	Metadata map[string]string
 }
 
 // HasService returns whether the specified service is supported by the peer
@@ -137,7 +156,32 @@ func (msg *MsgVersion) VVSDecode(r io.Reader, pver uint32, enc MessageEncoding)
 	if err := serialization.ReadBool(r, &msg.DisableRelayTx); err != nil {
 		return err
 	}
-	return nil
+
+	if !msg.HasService(common.SFNodeMetadata) || buf.Len() == 0 {
+		return nil
+	}
+	count, err := serialization.ReadVarInt(buf, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxMetadataEntries {
+		str := fmt.Sprintf("too many metadata entries [count %v, max %v]",
+			count, MaxMetadataEntries)
+		return messageError("MsgVersion.VVSDecode", str)
+	}
+	msg.Metadata = make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := serialization.ReadVarString(buf, pver)
+		if err != nil {
+			return err
+		}
+		value, err := serialization.ReadVarString(buf, pver)
+		if err != nil {
+			return err
+		}
+		msg.Metadata[key] = value
+	}
+	return ValidateMetadata(msg.Metadata)
 }
 
 // VVSEncode encodes the receiver to w using the bitcoin protocol encoding.
@@ -194,6 +238,31 @@ func (msg *MsgVersion) VVSEncode(w io.Writer, pver uint32, enc MessageEncoding)
 		return err
 	}
 
+	if !msg.HasService(common.SFNodeMetadata) {
+		return nil
+	}
+	if err := ValidateMetadata(msg.Metadata); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(msg.Metadata))
+	for key := range msg.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	err = serialization.WriteVarInt(w, pver, uint64(len(keys)))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := serialization.WriteVarString(w, pver, key); err != nil {
+			return err
+		}
+		err = serialization.WriteVarString(w, pver, msg.Metadata[key])
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -210,9 +279,13 @@ func (msg *MsgVersion) MaxPayloadLength(pver uint32) uint32 {
 	// magic 4 bytes + chainId 8 bytes +
 	// remote and local net addresses + nonce 8 bytes + length of user
 	// agent (varInt) + max allowed useragent length + last block 4 bytes +
-	// relay transactions flag 1 byte.
+	// relay transactions flag 1 byte + number of metadata entries
+	// (varInt) + max allowed entries, each with the lengths of the key and
+	// value (varInt) and their max allowed lengths.
 	return 45 + (maxNetAddressPayload * 2) + serialization.MaxVarIntPayload +
-		MaxUserAgentLen
+		MaxUserAgentLen + serialization.MaxVarIntPayload +
+		MaxMetadataEntries*(2*serialization.MaxVarIntPayload+
+			MaxMetadataKeyLen+MaxMetadataValueLen)
 }
 
 // NewMsgVersion returns a new bitcoin version message that conforms to the
@@ -247,6 +320,31 @@ func validateUserAgent(userAgent string) error {
 	return nil
 }
 
+// ValidateMetadata checks the metadata map of a version message against the
+// limits of its number of entries and of the lengths of its keys and values.
+// The keys must not be empty.
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataEntries {
+		str := fmt.Sprintf("too many metadata entries [count %v, max %v]",
+			len(metadata), MaxMetadataEntries)
+		return messageError("MsgVersion", str)
+	}
+	for key, value := range metadata {
+		if len(key) == 0 || len(key) > MaxMetadataKeyLen {
+			str := fmt.Sprintf("invalid metadata key %q [len %v, "+
+				"max %v]", key, len(key), MaxMetadataKeyLen)
+			return messageError("MsgVersion", str)
+		}
+		if len(value) > MaxMetadataValueLen {
+			str := fmt.Sprintf("metadata value of %q too long "+
+				"[len %v, max %v]", key, len(value),
+				MaxMetadataValueLen)
+			return messageError("MsgVersion", str)
+		}
+	}
+	return nil
+}
+
 // AddUserAgent adds a user agent to the user agent string for the version
 // message.  The version string is not defined to any strict format, although
 // it is recommended to use the form "major.minor.revision" e.g. "2.6.41".
@@ -7,6 +7,7 @@ package protos
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/AsimovNetwork/asimov/common"
 	"net"
 	"reflect"
@@ -110,8 +111,9 @@ func TestVersion(t *testing.T) {
 	// magic 4 bytes + chainId 8 bytes +
 	// remote and local net addresses + nonce 8 bytes + length of user agent
 	// (varInt) + max allowed user agent length + last block 4 bytes +
-	// relay transactions flag 1 byte.
-	wantPayload := uint32(370)
+	// relay transactions flag 1 byte + number of metadata entries (varInt)
+	// + max allowed entries of 178 bytes.
+	wantPayload := uint32(3227)
 	maxPayload := msg.MaxPayloadLength(pver)
 	if maxPayload != wantPayload {
 		t.Errorf("MaxPayloadLength: wrong max payload length for "+
@@ -140,6 +142,22 @@ func TestVersionWire(t *testing.T) {
 	copy(verRelayTxFalseEncoded, baseProtocolVersionEncoded)
 	verRelayTxFalseEncoded[len(verRelayTxFalseEncoded)-1] = 0
 
+	// The metadata map is encoded when the service is advertised.
+	baseProtocolVersionCopy2 := *baseProtocolVersion
+	verMetadata := &baseProtocolVersionCopy2
+	verMetadata.Services |= common.SFNodeMetadata
+	verMetadata.Metadata = map[string]string{"role": "validator", "dc": "eu"}
+	verMetadataEncoded := make([]byte, len(baseProtocolVersionEncoded))
+	copy(verMetadataEncoded, baseProtocolVersionEncoded)
+	verMetadataEncoded[4] = 0x21 // SFNodeNetwork|SFNodeMetadata
+	verMetadataEncoded = append(verMetadataEncoded,
+		0x02,                     // Number of entries
+		0x02, 'd', 'c', // Key
+		0x02, 'e', 'u', // Value
+		0x04, 'r', 'o', 'l', 'e', // Key
+		0x09, 'v', 'a', 'l', 'i', 'd', 'a', 't', 'o', 'r', // Value
+	)
+
 	tests := []struct {
 		in   *MsgVersion     // Message to encode
 		out  *MsgVersion     // Expected decoded message
@@ -155,6 +173,15 @@ func TestVersionWire(t *testing.T) {
 			common.ProtocolVersion,
 			BaseEncoding,
 		},
+
+		// Metadata map.
+		{
+			verMetadata,
+			verMetadata,
+			verMetadataEncoded,
+			common.ProtocolVersion,
+			BaseEncoding,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -188,6 +215,33 @@ func TestVersionWire(t *testing.T) {
 	}
 }
 
+// TestVersionMetadataLimits ensures the metadata maps exceeding the limits are
+// refused.
+func TestVersionMetadataLimits(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxMetadataEntries; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = ""
+	}
+	tests := []map[string]string{
+		tooMany,
+		{"": "value"},
+		{strings.Repeat("k", MaxMetadataKeyLen+1): "value"},
+		{"key": strings.Repeat("v", MaxMetadataValueLen+1)},
+	}
+	for i, metadata := range tests {
+		if err := ValidateMetadata(metadata); err == nil {
+			t.Errorf("ValidateMetadata #%d: no error", i)
+		}
+		msg := *baseProtocolVersion
+		msg.Services |= common.SFNodeMetadata
+		msg.Metadata = metadata
+		var buf bytes.Buffer
+		if err := msg.VVSEncode(&buf, common.ProtocolVersion, BaseEncoding); err == nil {
+			t.Errorf("VVSEncode #%d: no error", i)
+		}
+	}
+}
+
 // TestVersionWireErrors performs negative tests against protos encode and
 // decode of MsgGetHeaders to confirm error paths work correctly.
 func TestVersionWireErrors(t *testing.T) {
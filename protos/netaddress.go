@@ -16,6 +16,35 @@ import (
 // Services 8 bytes + ip 16 bytes + port 2 bytes + timestamp 4 bytes.
 const maxNetAddressPayload = 30
 
+// NetworkID identifies the network of an address in the addrv2 messages.  The
+// identifiers are those of BIP155.
+type NetworkID uint8
+
+const (
+	// NetIPv4 identifies the IPv4 addresses of 4 bytes.
+	NetIPv4 NetworkID = 1
+
+	// NetIPv6 identifies the IPv6 addresses of 16 bytes.
+	NetIPv6 NetworkID = 2
+
+	// NetTorV3 identifies the Tor v3 hidden services, whose address is the
+	// public key of 32 bytes of the service.
+	NetTorV3 NetworkID = 4
+
+	// NetI2P identifies the I2P destinations, whose address is the SHA256
+	// hash of 32 bytes of the destination.
+	NetI2P NetworkID = 5
+)
+
+// networkAddrLen maps the networks an address may belong to the length of
+// their addresses.
+var networkAddrLen = map[NetworkID]int{
+	NetIPv4:  4,
+	NetIPv6:  16,
+	NetTorV3: 32,
+	NetI2P:   32,
+}
+
 // NetAddress defines information about a peer on the network including the time
 // it was last seen, the services it supports, its IP address, and port.
 type NetAddress struct {
@@ -33,6 +62,24 @@ type NetAddress struct {
 	// Port the peer is using.  This is encoded in big endian on the protos
 	// which differs from most everything else.
 	Port uint16
+
+	// Network identifies the network of the addresses which are not IP
+	// addresses, such as Tor v3 and I2P addresses, whose bytes are in Addr
+	// and whose IP is nil.  It is zero for the IP addresses.  Those
+	// addresses can only be relayed in addrv2 messages.
+	Network NetworkID
+	Addr    []byte
+}
+
+// NetworkID returns the network of the address.
+func (na *NetAddress) NetworkID() NetworkID {
+	if na.Network != 0 {
+		return na.Network
+	}
+	if na.IP.To4() != nil {
+		return NetIPv4
+	}
+	return NetIPv6
 }
 
 // HasService returns whether the specified service is supported by the address.
@@ -68,6 +115,20 @@ func NewNetAddressTimestamp(
 	return &na
 }
 
+// NewNetAddressNetwork returns a new NetAddress of an address which is not an
+// IP address, such as a Tor v3 or I2P address, using the provided network,
+// address, port, and supported services with defaults for the remaining
+// fields.
+func NewNetAddressNetwork(network NetworkID, addr []byte, port uint16, services common.ServiceFlag) *NetAddress {
+	return &NetAddress{
+		Timestamp: time.Now(),
+		Services:  services,
+		Port:      port,
+		Network:   network,
+		Addr:      addr,
+	}
+}
+
 // NewNetAddress returns a new NetAddress using the provided TCP address and
 // supported services with defaults for the remaining fields.
 func NewNetAddress(addr *net.TCPAddr, services common.ServiceFlag) *NetAddress {
@@ -0,0 +1,644 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package protos
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"math/rand"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// roundTripCount is the number of random instances of each message and chain
+// structure the round trip tests check.
+const roundTripCount = 50
+
+// generator builds random instances of the protos messages and chain
+// structures.  The instances stay within the limits the decoders enforce, so
+// they must survive an encode/decode round trip unchanged.  The counts are
+// kept small, except the small limits which are hit now and then.
+type generator struct {
+	*rand.Rand
+}
+
+// newGenerator returns a generator drawing from a source seeded with the
+// passed seed, so a failing instance can be built again from its seed.
+func newGenerator(seed int64) generator {
+	return generator{rand.New(rand.NewSource(seed))}
+}
+
+// count returns a random number of elements for a list limited to max.
+func (g generator) count(max int) int {
+	if max <= 64 && g.Intn(8) == 0 {
+		return max
+	}
+	if max > 8 {
+		max = 8
+	}
+	return g.Intn(max + 1)
+}
+
+// bytes returns random bytes, at most max of them.
+func (g generator) bytes(max int) []byte {
+	b := make([]byte, g.Intn(max+1))
+	g.Read(b)
+	return b
+}
+
+// str returns a random printable string, at most max bytes long.
+func (g generator) str(max int) string {
+	b := make([]byte, g.Intn(max+1))
+	for i := range b {
+		b[i] = byte(' ' + g.Intn('~'-' '+1))
+	}
+	return string(b)
+}
+
+// hash returns a random hash.
+func (g generator) hash() common.Hash {
+	var hash common.Hash
+	g.Read(hash[:])
+	return hash
+}
+
+// hashes returns a random list of hashes, at most max of them.
+func (g generator) hashes(max int) []*common.Hash {
+	hashes := make([]*common.Hash, g.count(max))
+	for i := range hashes {
+		hash := g.hash()
+		hashes[i] = &hash
+	}
+	return hashes
+}
+
+// address returns a random address.
+func (g generator) address() common.Address {
+	var addr common.Address
+	g.Read(addr[:])
+	return addr
+}
+
+// timestamp returns a random timestamp with the one second precision of the
+// protocol.
+func (g generator) timestamp() time.Time {
+	return time.Unix(g.Int63n(1<<33), 0)
+}
+
+// blockHeader returns a random block header.
+func (g generator) blockHeader() *BlockHeader {
+	header := &BlockHeader{
+		Version:    int32(g.Uint32()),
+		PrevBlock:  g.hash(),
+		MerkleRoot: g.hash(),
+		Timestamp:  g.Int63(),
+		StateRoot:  g.hash(),
+		GasLimit:   g.Uint64(),
+		GasUsed:    g.Uint64(),
+		Round:      g.Uint32(),
+		SlotIndex:  uint16(g.Uint32()),
+		Weight:     uint16(g.Uint32()),
+		PoaHash:    g.hash(),
+		Height:     int32(g.Uint32()),
+		CoinBase:   g.address(),
+	}
+	g.Read(header.SigData[:])
+	return header
+}
+
+// blockSign returns a random block signature.
+func (g generator) blockSign() *MsgBlockSign {
+	sign := &MsgBlockSign{
+		BlockHeight: int32(g.Uint32()),
+		BlockHash:   g.hash(),
+		Signer:      g.address(),
+	}
+	g.Read(sign.Signature[:])
+	return sign
+}
+
+// tx returns a random transaction, with an access list and storage witnesses
+// now and then.  The data of the outputs is large enough now and then for
+// the messages holding the transaction to be compressed.
+func (g generator) tx() *MsgTx {
+	tx := &MsgTx{
+		Version:  TxVersion,
+		TxIn:     make([]*TxIn, g.count(4)),
+		TxOut:    make([]*TxOut, g.count(4)),
+		LockTime: g.Uint32(),
+	}
+	for i := range tx.TxIn {
+		tx.TxIn[i] = &TxIn{
+			PreviousOutPoint: OutPoint{Hash: g.hash(), Index: g.Uint32()},
+			SignatureScript:  g.bytes(64),
+			Sequence:         g.Uint32(),
+		}
+	}
+	for i := range tx.TxOut {
+		tx.TxOut[i] = &TxOut{
+			Value:    int64(g.Uint64()),
+			PkScript: g.bytes(64),
+			Asset:    Asset{Property: g.Uint32(), Id: g.Uint64()},
+			Data:     g.bytes(g.Intn(2) * 1200),
+		}
+	}
+	tx.TxContract.GasLimit = g.Uint32()
+	if g.Intn(2) == 0 {
+		list := make([]AccessTuple, g.count(4))
+		for i := range list {
+			list[i].Address = g.address()
+			for j := g.count(4); j > 0; j-- {
+				list[i].StorageKeys = append(list[i].StorageKeys, g.hash())
+			}
+		}
+		tx.SetAccessList(list)
+	}
+	if g.Intn(2) == 0 {
+		witnesses := make([]StorageWitness, g.count(3))
+		for i := range witnesses {
+			witnesses[i].Address = g.address()
+			for j := g.count(4); j > 0; j-- {
+				witnesses[i].Entries = append(witnesses[i].Entries,
+					StorageEntry{Key: g.hash(), Value: g.hash()})
+			}
+		}
+		tx.SetStorageWitnesses(witnesses)
+	}
+	return tx
+}
+
+// block returns a random block.
+func (g generator) block() *MsgBlock {
+	block := &MsgBlock{
+		Header:       *g.blockHeader(),
+		ReceiptHash:  g.hash(),
+		Transactions: make([]*MsgTx, g.count(4)),
+		PreBlockSigs: make(BlockSignList, g.count(4)),
+	}
+	g.Read(block.Bloom[:])
+	for i := range block.Transactions {
+		block.Transactions[i] = g.tx()
+	}
+	for i := range block.PreBlockSigs {
+		block.PreBlockSigs[i] = g.blockSign()
+	}
+	return block
+}
+
+// vblock returns a random virtual block.
+func (g generator) vblock() *MsgVBlock {
+	vblock := &MsgVBlock{
+		Version:       g.Uint32(),
+		MerkleRoot:    g.hash(),
+		VTransactions: make([]*MsgTx, g.count(3)),
+	}
+	for i := range vblock.VTransactions {
+		vblock.VTransactions[i] = g.tx()
+	}
+	return vblock
+}
+
+// netAddress returns a random address of an addr or version message, whose
+// IP is always 16 bytes long.
+func (g generator) netAddress() *NetAddress {
+	ip := make(net.IP, net.IPv6len)
+	g.Read(ip)
+	return &NetAddress{
+		Timestamp: g.timestamp(),
+		Services:  common.ServiceFlag(g.Uint64()),
+		IP:        ip,
+		Port:      uint16(g.Uint32()),
+	}
+}
+
+// netAddressV2 returns a random address of an addrv2 message of any known
+// network.
+func (g generator) netAddressV2() *NetAddress {
+	na := g.netAddress()
+	networks := []NetworkID{NetIPv4, NetIPv6, NetTorV3, NetI2P}
+	switch network := networks[g.Intn(len(networks))]; network {
+	case NetIPv4:
+		na.IP = net.IPv4(na.IP[0], na.IP[1], na.IP[2], na.IP[3])
+	case NetIPv6:
+		// Keep the address out of the IPv4-mapped range.
+		na.IP[10] = 0
+	default:
+		na.IP = nil
+		na.Network = network
+		na.Addr = make([]byte, networkAddrLen[network])
+		g.Read(na.Addr)
+	}
+	return na
+}
+
+// invList returns a random list of inventory vectors.
+func (g generator) invList() []*InvVect {
+	list := make([]*InvVect, g.count(MaxInvPerMsg))
+	for i := range list {
+		list[i] = &InvVect{Type: InvType(g.Intn(8)), Hash: g.hash()}
+	}
+	return list
+}
+
+// version returns a random version message, with metadata when its services
+// advertise it.
+func (g generator) version() *MsgVersion {
+	msg := &MsgVersion{
+		ProtocolVersion: g.Uint32(),
+		Services:        common.ServiceFlag(g.Uint64()),
+		Timestamp:       g.Int63(),
+		Magic:           common.AsimovNet(g.Uint32()),
+		ChainId:         g.Uint64(),
+		AddrYou:         *g.netAddress(),
+		AddrMe:          *g.netAddress(),
+		Nonce:           g.Uint64(),
+		UserAgent:       g.str(MaxUserAgentLen),
+		LastBlock:       int32(g.Uint32()),
+		DisableRelayTx:  g.Intn(2) == 0,
+	}
+	if msg.HasService(common.SFNodeMetadata) {
+		msg.Metadata = make(map[string]string)
+		for i := g.count(MaxMetadataEntries); i > 0; i-- {
+			key := strconv.Itoa(i) + g.str(MaxMetadataKeyLen-2)
+			msg.Metadata[key] = g.str(MaxMetadataValueLen)
+		}
+	}
+	return msg
+}
+
+// reject returns a random reject message, which only holds a hash for the
+// block and transaction commands.
+func (g generator) reject() *MsgReject {
+	msg := &MsgReject{
+		Cmd:    []string{CmdBlock, CmdTx, g.str(12)}[g.Intn(3)],
+		Code:   RejectCode(g.Intn(256)),
+		Reason: g.str(64),
+	}
+	if msg.Cmd == CmdBlock || msg.Cmd == CmdTx {
+		msg.Hash = g.hash()
+	}
+	return msg
+}
+
+// messageGenerators maps the commands to the generators of their messages.
+// The custom commands are generated under the custom command prefix.
+var messageGenerators = map[string]func(g generator) Message{
+	CmdVersion:    func(g generator) Message { return g.version() },
+	CmdVerAck:     func(g generator) Message { return &MsgVerAck{} },
+	CmdGetAddr:    func(g generator) Message { return &MsgGetAddr{} },
+	CmdMemPool:    func(g generator) Message { return &MsgMemPool{} },
+	CmdSendAddrV2: func(g generator) Message { return &MsgSendAddrV2{} },
+	CmdAddr: func(g generator) Message {
+		msg := &MsgAddr{AddrList: make([]*NetAddress, g.count(MaxAddrPerMsg))}
+		for i := range msg.AddrList {
+			msg.AddrList[i] = g.netAddress()
+		}
+		return msg
+	},
+	CmdAddrV2: func(g generator) Message {
+		msg := &MsgAddrV2{AddrList: make([]*NetAddress, g.count(MaxAddrPerMsg))}
+		for i := range msg.AddrList {
+			msg.AddrList[i] = g.netAddressV2()
+		}
+		return msg
+	},
+	CmdGetBlocks: func(g generator) Message {
+		return &MsgGetBlocks{
+			ProtocolVersion:    g.Uint32(),
+			BlockLocatorHashes: g.hashes(MaxBlockLocatorsPerMsg),
+			HashStop:           g.hash(),
+		}
+	},
+	CmdGetHeaders: func(g generator) Message {
+		return &MsgGetHeaders{
+			ProtocolVersion:    g.Uint32(),
+			BlockLocatorHashes: g.hashes(MaxBlockLocatorsPerMsg),
+			HashStop:           g.hash(),
+		}
+	},
+	CmdInv:      func(g generator) Message { return &MsgInv{InvList: g.invList()} },
+	CmdGetData:  func(g generator) Message { return &MsgGetData{InvList: g.invList()} },
+	CmdNotFound: func(g generator) Message { return &MsgNotFound{InvList: g.invList()} },
+	CmdBlock:    func(g generator) Message { return g.block() },
+	CmdTx:       func(g generator) Message { return g.tx() },
+	CmdSig:      func(g generator) Message { return g.blockSign() },
+	CmdPing:     func(g generator) Message { return &MsgPing{Nonce: g.Uint64()} },
+	CmdPong:     func(g generator) Message { return &MsgPong{Nonce: g.Uint64()} },
+	CmdHeaders: func(g generator) Message {
+		msg := &MsgHeaders{Headers: make([]*BlockHeader, g.count(MaxBlockHeadersPerMsg))}
+		for i := range msg.Headers {
+			msg.Headers[i] = g.blockHeader()
+		}
+		return msg
+	},
+	CmdFilterAdd:   func(g generator) Message { return &MsgFilterAdd{Data: g.bytes(MaxFilterAddDataSize)} },
+	CmdFilterClear: func(g generator) Message { return &MsgFilterClear{} },
+	CmdFilterLoad: func(g generator) Message {
+		return &MsgFilterLoad{
+			Filter:    g.bytes(2048),
+			HashFuncs: uint32(g.Intn(MaxFilterLoadHashFuncs + 1)),
+			Tweak:     g.Uint32(),
+			Flags:     BloomUpdateType(g.Intn(3)),
+		}
+	},
+	CmdMerkleBlock: func(g generator) Message {
+		return &MsgMerkleBlock{
+			Header:       *g.blockHeader(),
+			Transactions: g.Uint32(),
+			Hashes:       g.hashes(maxTxPerBlock),
+			Flags:        g.bytes(64),
+		}
+	},
+	CmdReject:      func(g generator) Message { return g.reject() },
+	CmdSendHeaders: func(g generator) Message { return &MsgSendHeaders{} },
+	CmdFeeFilter:   func(g generator) Message { return &MsgFeeFilter{MinPrice: int32(g.Uint32())} },
+	CmdGetCFilters: func(g generator) Message {
+		return &MsgGetCFilters{
+			FilterType:  FilterType(g.Intn(256)),
+			StartHeight: g.Uint32(),
+			StopHash:    g.hash(),
+		}
+	},
+	CmdGetCFHeaders: func(g generator) Message {
+		return &MsgGetCFHeaders{
+			FilterType:  FilterType(g.Intn(256)),
+			StartHeight: g.Uint32(),
+			StopHash:    g.hash(),
+		}
+	},
+	CmdGetCFCheckpt: func(g generator) Message {
+		return &MsgGetCFCheckpt{FilterType: FilterType(g.Intn(256)), StopHash: g.hash()}
+	},
+	CmdCFilter: func(g generator) Message {
+		return &MsgCFilter{
+			FilterType: FilterType(g.Intn(256)),
+			BlockHash:  g.hash(),
+			Data:       g.bytes(2048),
+		}
+	},
+	CmdCFHeaders: func(g generator) Message {
+		return &MsgCFHeaders{
+			FilterType:       FilterType(g.Intn(256)),
+			StopHash:         g.hash(),
+			PrevFilterHeader: g.hash(),
+			FilterHashes:     g.hashes(MaxCFHeadersPerMsg),
+		}
+	},
+	CmdCFCheckpt: func(g generator) Message {
+		return &MsgCFCheckpt{
+			FilterType:    FilterType(g.Intn(256)),
+			StopHash:      g.hash(),
+			FilterHeaders: g.hashes(MaxCFHeadersPerMsg),
+		}
+	},
+	CmdSendCompression: func(g generator) Message {
+		msg := &MsgSendCompression{Codecs: make([]CompressionCodec, g.count(MaxCompressionCodecs))}
+		for i := range msg.Codecs {
+			msg.Codecs[i] = CompressionCodec(g.Intn(256))
+		}
+		return msg
+	},
+	CmdSubscribeInv: func(g generator) Message {
+		msg := &MsgSubscribeInv{Types: make([]InvType, g.count(MaxSubscribeInvTypes))}
+		for i := range msg.Types {
+			msg.Types[i] = InvType(g.Intn(8))
+		}
+		return msg
+	},
+	CustomCommandPrefix: func(g generator) Message {
+		return &MsgCustom{
+			Cmd:     CustomCommandPrefix + "c" + g.str(common.CommandSize-3),
+			Payload: g.bytes(2048),
+		}
+	},
+}
+
+// storageGenerators maps the chain structures stored in the database to their
+// generators.
+var storageGenerators = map[string]func(g generator) storable{
+	"BlockHeader":  func(g generator) storable { return g.blockHeader() },
+	"MsgBlockSign": func(g generator) storable { return g.blockSign() },
+	"MsgTx":        func(g generator) storable { return g.tx() },
+	"MsgBlock":     func(g generator) storable { return g.block() },
+	"MsgVBlock":    func(g generator) storable { return g.vblock() },
+}
+
+// storable is a chain structure stored in the database.
+type storable interface {
+	Serialize(io.Writer) error
+	Deserialize(io.Reader) error
+}
+
+// equivalent returns whether two values are deeply equal, except nil and empty
+// slices and maps are equivalent since the decoders are free to return
+// either, and times are compared as instants.
+func equivalent(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equivalent(a.Elem(), b.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equivalent(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, key := range a.MapKeys() {
+			value := b.MapIndex(key)
+			if !value.IsValid() || !equivalent(a.MapIndex(key), value) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Struct:
+		if t, ok := a.Interface().(time.Time); ok {
+			return t.Equal(b.Interface().(time.Time))
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !equivalent(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return a.Interface() == b.Interface()
+}
+
+// protocolCommands returns the commands declared by the Cmd constants of
+// message.go, so the messages added later are checked without being listed
+// again.
+func protocolCommands(t *testing.T) []string {
+	file, err := parser.ParseFile(token.NewFileSet(), "message.go", nil, 0)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	var commands []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, name := range spec.Names {
+			if !strings.HasPrefix(name.Name, "Cmd") || i >= len(spec.Values) {
+				continue
+			}
+			lit, ok := spec.Values[i].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				continue
+			}
+			command, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatalf("command %s: %v", name.Name, err)
+			}
+			commands = append(commands, command)
+		}
+		return true
+	})
+	return commands
+}
+
+// TestMessageGenerators ensures every command has a generator of its message,
+// the compressed messages excepted since they only wrap another message.
+func TestMessageGenerators(t *testing.T) {
+	commands := protocolCommands(t)
+	if len(commands) == 0 {
+		t.Fatalf("no command found in message.go")
+	}
+	for _, command := range commands {
+		if command == CmdCompressed {
+			continue
+		}
+		generate, ok := messageGenerators[command]
+		if !ok {
+			t.Errorf("no generator for the %q message", command)
+			continue
+		}
+		if got := generate(newGenerator(0)).Command(); got != command {
+			t.Errorf("generator of the %q message builds %q messages",
+				command, got)
+		}
+	}
+}
+
+// TestMessageRoundTrip ensures random instances of every message survive a
+// round trip through the wire encoding, with and without compression, at all
+// the protocol versions, and that their payload fits their maximum payload
+// length.
+func TestMessageRoundTrip(t *testing.T) {
+	encodings := []MessageEncoding{BaseEncoding, BaseEncoding | CompressedEncoding}
+	for command, generate := range messageGenerators {
+		generate := generate
+		roundTrip := func(seed int64) bool {
+			for pver := common.MinRequestVersion; pver <= common.ProtocolVersion; pver++ {
+				for _, enc := range encodings {
+					msg := generate(newGenerator(seed))
+
+					var payload bytes.Buffer
+					if err := msg.VVSEncode(&payload, pver, enc); err != nil {
+						t.Logf("pver %d enc %d: VVSEncode: %v", pver, enc, err)
+						return false
+					}
+					if max := msg.MaxPayloadLength(pver); uint32(payload.Len()) > max {
+						t.Logf("pver %d: payload of %d bytes, max %d",
+							pver, payload.Len(), max)
+						return false
+					}
+
+					var buf bytes.Buffer
+					if _, err := WriteMessageWithEncodingN(&buf, msg, pver, enc); err != nil {
+						t.Logf("pver %d enc %d: WriteMessage: %v", pver, enc, err)
+						return false
+					}
+					_, decoded, _, err := ReadMessageWithEncodingN(&buf, pver, enc)
+					if err != nil {
+						t.Logf("pver %d enc %d: ReadMessage: %v", pver, enc, err)
+						return false
+					}
+					if !equivalent(reflect.ValueOf(decoded), reflect.ValueOf(msg)) {
+						t.Logf("pver %d enc %d: decoded %+v, want %+v",
+							pver, enc, decoded, msg)
+						return false
+					}
+				}
+			}
+			return true
+		}
+		err := quick.Check(roundTrip, &quick.Config{MaxCount: roundTripCount})
+		if err != nil {
+			t.Errorf("%q message: %v", command, err)
+		}
+	}
+}
+
+// TestStorageRoundTrip ensures random instances of the chain structures
+// stored in the database survive a round trip through their serialization,
+// whose size matches the one they report.
+func TestStorageRoundTrip(t *testing.T) {
+	for name, generate := range storageGenerators {
+		generate := generate
+		roundTrip := func(seed int64) bool {
+			value := generate(newGenerator(seed))
+			var buf bytes.Buffer
+			if err := value.Serialize(&buf); err != nil {
+				t.Logf("Serialize: %v", err)
+				return false
+			}
+
+			size := BlockHeaderPayload
+			if sizer, ok := value.(interface{ SerializeSize() int }); ok {
+				size = sizer.SerializeSize()
+			}
+			if buf.Len() != size {
+				t.Logf("serialized %d bytes, SerializeSize %d", buf.Len(), size)
+				return false
+			}
+
+			decoded := reflect.New(reflect.TypeOf(value).Elem()).Interface().(storable)
+			if err := decoded.Deserialize(&buf); err != nil {
+				t.Logf("Deserialize: %v", err)
+				return false
+			}
+			if buf.Len() != 0 {
+				t.Logf("%d bytes left after Deserialize", buf.Len())
+				return false
+			}
+			if !equivalent(reflect.ValueOf(decoded), reflect.ValueOf(value)) {
+				t.Logf("deserialized %+v, want %+v", decoded, value)
+				return false
+			}
+			return true
+		}
+		err := quick.Check(roundTrip, &quick.Config{MaxCount: roundTripCount})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// PrimaryConfig is the configuration of a primary node.
+type PrimaryConfig struct {
+	// Secret is shared with the secondaries.
+	Secret []byte
+
+	// BestHeight returns the height of the best block.
+	BestHeight func() int32
+
+	// BlockHash returns the hash of the main chain block at a height.
+	BlockHash func(height int32) (*common.Hash, error)
+
+	// EncodeBlock returns the hash and the encoding of the main chain block
+	// at a height, as expected by the ConnectBlock function of the
+	// secondaries.
+	EncodeBlock func(height int32) (*common.Hash, []byte, error)
+}
+
+// SecondaryInfo describes a secondary connected to the primary.
+type SecondaryInfo struct {
+	Addr      string
+	Height    int32
+	Connected time.Time
+}
+
+// session is a connected secondary.
+type session struct {
+	conn   *conn
+	notify chan struct{}
+
+	mtx    sync.Mutex
+	height int32
+	since  time.Time
+}
+
+// Primary streams the main chain blocks to the connected secondaries.
+type Primary struct {
+	cfg      *PrimaryConfig
+	listener net.Listener
+
+	mtx      sync.Mutex
+	sessions map[*session]struct{}
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewPrimary returns a primary accepting the secondaries on the passed
+// listener once started.
+func NewPrimary(cfg *PrimaryConfig, listener net.Listener) *Primary {
+	return &Primary{
+		cfg:      cfg,
+		listener: listener,
+		sessions: make(map[*session]struct{}),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start begins accepting secondaries.
+func (p *Primary) Start() {
+	log.Infof("Replication primary listening on %s", p.listener.Addr())
+	p.wg.Add(1)
+	go p.acceptHandler()
+}
+
+// Stop disconnects the secondaries and waits for the handlers to exit.
+func (p *Primary) Stop() {
+	close(p.quit)
+	p.listener.Close()
+	p.mtx.Lock()
+	for s := range p.sessions {
+		s.conn.Close()
+	}
+	p.mtx.Unlock()
+	p.wg.Wait()
+}
+
+// Notify wakes up the sessions after a block was connected to the main chain.
+func (p *Primary) Notify() {
+	p.mtx.Lock()
+	for s := range p.sessions {
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+	p.mtx.Unlock()
+}
+
+// Secondaries returns the connected secondaries ordered by address.
+func (p *Primary) Secondaries() []SecondaryInfo {
+	p.mtx.Lock()
+	infos := make([]SecondaryInfo, 0, len(p.sessions))
+	for s := range p.sessions {
+		s.mtx.Lock()
+		infos = append(infos, SecondaryInfo{
+			Addr:      s.conn.RemoteAddr().String(),
+			Height:    s.height,
+			Connected: s.since,
+		})
+		s.mtx.Unlock()
+	}
+	p.mtx.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Addr < infos[j].Addr
+	})
+	return infos
+}
+
+// acceptHandler accepts the secondaries.  It must be run as a goroutine.
+func (p *Primary) acceptHandler() {
+	defer p.wg.Done()
+	for {
+		c, err := p.listener.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+				return
+			default:
+			}
+			log.Errorf("Unable to accept replication connection: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		p.wg.Add(1)
+		go p.sessionHandler(c)
+	}
+}
+
+// sessionHandler streams the blocks to a secondary.  It must be run as a
+// goroutine.
+func (p *Primary) sessionHandler(c net.Conn) {
+	defer p.wg.Done()
+	defer c.Close()
+
+	rc, err := handshake(c, p.cfg.Secret, true)
+	if err != nil {
+		log.Warnf("Rejecting replication connection from %s: %v",
+			c.RemoteAddr(), err)
+		return
+	}
+	s := &session{conn: rc, notify: make(chan struct{}, 1), since: time.Now()}
+
+	p.mtx.Lock()
+	select {
+	case <-p.quit:
+		p.mtx.Unlock()
+		return
+	default:
+	}
+	p.sessions[s] = struct{}{}
+	p.mtx.Unlock()
+	defer func() {
+		p.mtx.Lock()
+		delete(p.sessions, s)
+		p.mtx.Unlock()
+	}()
+
+	if err := p.stream(s); err != nil {
+		log.Warnf("Replication to %s stopped: %v", c.RemoteAddr(), err)
+		rc.writeMsg(msgError, []byte(err.Error()))
+	}
+}
+
+// stream sends the main chain blocks following the best block of the
+// secondary as they are connected.
+func (p *Primary) stream(s *session) error {
+	typ, payload, err := s.conn.readMsg()
+	if err != nil {
+		return err
+	}
+	if typ != msgSync {
+		return fmt.Errorf("unexpected message %d", typ)
+	}
+	height, last, _, err := decodeTip(payload)
+	if err != nil {
+		return err
+	}
+	if hash, err := p.cfg.BlockHash(height); err != nil || *hash != last {
+		return fmt.Errorf("block %v at height %d is not in the main chain "+
+			"of the primary", last, height)
+	}
+	log.Infof("Replicating to %s from height %d", s.conn.RemoteAddr(), height)
+	s.mtx.Lock()
+	s.height = height
+	s.mtx.Unlock()
+
+	for {
+		for next := height + 1; next <= p.cfg.BestHeight(); next++ {
+			// Ensure the secondary still follows the main chain,
+			// which changes when the primary reorganizes.
+			if hash, err := p.cfg.BlockHash(height); err != nil || *hash != last {
+				return fmt.Errorf("block %v at height %d was "+
+					"disconnected from the main chain", last, height)
+			}
+			hash, data, err := p.cfg.EncodeBlock(next)
+			if err != nil {
+				return err
+			}
+			if err := s.conn.writeMsg(msgBlock, encodeTip(next, hash, data)); err != nil {
+				return err
+			}
+			height, last = next, *hash
+			s.mtx.Lock()
+			s.height = height
+			s.mtx.Unlock()
+		}
+
+		select {
+		case <-s.notify:
+		case <-time.After(pingInterval):
+			if err := s.conn.writeMsg(msgPing, nil); err != nil {
+				return err
+			}
+		case <-p.quit:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+// connPair returns both ends of a loopback TCP connection.
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	b, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+// pairHandshake runs the handshake of both ends of a connection.
+func pairHandshake(t *testing.T, primarySecret, secondarySecret []byte) (*conn, *conn, error, error) {
+	a, b := connPair(t)
+	var wg sync.WaitGroup
+	var pc *conn
+	var perr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pc, perr = handshake(a, primarySecret, true)
+		if perr != nil {
+			a.Close()
+		}
+	}()
+	sc, serr := handshake(b, secondarySecret, false)
+	if serr != nil {
+		b.Close()
+	}
+	wg.Wait()
+	return pc, sc, perr, serr
+}
+
+func TestHandshake(t *testing.T) {
+	pc, sc, perr, serr := pairHandshake(t, []byte("secret"), []byte("secret"))
+	if perr != nil || serr != nil {
+		t.Fatalf("handshake failed: %v, %v", perr, serr)
+	}
+	if !bytes.Equal(pc.key, sc.key) {
+		t.Fatal("session keys differ")
+	}
+
+	go pc.writeMsg(msgBlock, []byte("payload"))
+	typ, payload, err := sc.readMsg()
+	if err != nil || typ != msgBlock || string(payload) != "payload" {
+		t.Fatalf("readMsg = %d, %q, %v", typ, payload, err)
+	}
+
+	// A message authenticated for another sequence number is rejected, so
+	// messages can not be replayed.
+	sc.recvSeq++
+	go pc.writeMsg(msgPing, nil)
+	if _, _, err := sc.readMsg(); err != ErrAuthFailed {
+		t.Fatalf("readMsg of a replayed message = %v, want %v", err,
+			ErrAuthFailed)
+	}
+
+	_, _, perr, serr = pairHandshake(t, []byte("secret"), []byte("guess"))
+	if perr != ErrAuthFailed && serr != ErrAuthFailed {
+		t.Fatalf("handshake with different secrets = %v, %v", perr, serr)
+	}
+}
+
+// testChain is a chain of blocks identified by their encoding.
+type testChain struct {
+	mtx    sync.Mutex
+	blocks []string
+}
+
+func (c *testChain) hash(height int32) *common.Hash {
+	hash := common.BytesToHash([]byte(c.blocks[height]))
+	return &hash
+}
+
+func (c *testChain) add(block string) {
+	c.mtx.Lock()
+	c.blocks = append(c.blocks, block)
+	c.mtx.Unlock()
+}
+
+func (c *testChain) height() int32 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return int32(len(c.blocks) - 1)
+}
+
+func TestReplication(t *testing.T) {
+	secret := []byte("secret")
+	primary := &testChain{blocks: []string{"genesis", "b1", "b2"}}
+	secondary := &testChain{blocks: []string{"genesis"}}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPrimary(&PrimaryConfig{
+		Secret:     secret,
+		BestHeight: primary.height,
+		BlockHash: func(height int32) (*common.Hash, error) {
+			primary.mtx.Lock()
+			defer primary.mtx.Unlock()
+			if int(height) >= len(primary.blocks) {
+				return nil, errors.New("unknown block")
+			}
+			return primary.hash(height), nil
+		},
+		EncodeBlock: func(height int32) (*common.Hash, []byte, error) {
+			primary.mtx.Lock()
+			defer primary.mtx.Unlock()
+			return primary.hash(height), []byte(primary.blocks[height]), nil
+		},
+	}, listener)
+	p.Start()
+	defer p.Stop()
+
+	s := NewSecondary(&SecondaryConfig{
+		Primary: listener.Addr().String(),
+		Secret:  secret,
+		Tip: func() (int32, *common.Hash) {
+			secondary.mtx.Lock()
+			defer secondary.mtx.Unlock()
+			height := int32(len(secondary.blocks) - 1)
+			return height, secondary.hash(height)
+		},
+		ConnectBlock: func(data []byte) (*common.Hash, error) {
+			secondary.add(string(data))
+			hash := common.BytesToHash(data)
+			return &hash, nil
+		},
+	})
+	s.Start()
+	defer s.Stop()
+
+	waitHeight := func(want int32) {
+		deadline := time.Now().Add(time.Second * 5)
+		for secondary.height() != want || s.Info().Height != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("secondary at height %d, want %d",
+					secondary.height(), want)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	waitHeight(2)
+
+	for i := 3; i <= 5; i++ {
+		primary.add(fmt.Sprintf("b%d", i))
+		p.Notify()
+	}
+	waitHeight(5)
+
+	secondaries := p.Secondaries()
+	if len(secondaries) != 1 || secondaries[0].Height != 5 {
+		t.Fatalf("unexpected secondaries %+v", secondaries)
+	}
+	if info := s.Info(); !info.Connected || info.LastError != "" {
+		t.Fatalf("unexpected primary info %+v", info)
+	}
+	for i, block := range primary.blocks {
+		if secondary.blocks[i] != block {
+			t.Fatalf("block %d is %s, want %s", i, secondary.blocks[i], block)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+const (
+	// minRetryInterval and maxRetryInterval bound the time a secondary waits
+	// before reconnecting to the primary.
+	minRetryInterval = time.Second
+	maxRetryInterval = time.Minute
+)
+
+// SecondaryConfig is the configuration of a secondary node.
+type SecondaryConfig struct {
+	// Primary is the address of the primary node.
+	Primary string
+
+	// Secret is shared with the primary.
+	Secret []byte
+
+	// Tip returns the height and hash of the best block.
+	Tip func() (int32, *common.Hash)
+
+	// ConnectBlock connects a block encoded by the EncodeBlock function of
+	// the primary and returns its hash.
+	ConnectBlock func(data []byte) (*common.Hash, error)
+
+	// Dial connects to the primary.  It defaults to net.Dial.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+// PrimaryInfo describes the state of the connection of a secondary to its
+// primary.
+type PrimaryInfo struct {
+	Addr      string
+	Connected bool
+	Height    int32
+	LastError string
+}
+
+// Secondary follows the main chain of a primary node.
+type Secondary struct {
+	cfg *SecondaryConfig
+
+	mtx     sync.Mutex
+	conn    *conn
+	height  int32
+	lastErr error
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSecondary returns a secondary following the configured primary once
+// started.
+func NewSecondary(cfg *SecondaryConfig) *Secondary {
+	if cfg.Dial == nil {
+		cfg.Dial = net.Dial
+	}
+	return &Secondary{
+		cfg:  cfg,
+		quit: make(chan struct{}),
+	}
+}
+
+// Start begins following the primary.
+func (s *Secondary) Start() {
+	log.Infof("Replicating from primary %s", s.cfg.Primary)
+	s.wg.Add(1)
+	go s.connHandler()
+}
+
+// Stop disconnects from the primary and waits for the handler to exit.
+func (s *Secondary) Stop() {
+	close(s.quit)
+	s.mtx.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+}
+
+// Info returns the state of the connection to the primary.
+func (s *Secondary) Info() PrimaryInfo {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	info := PrimaryInfo{
+		Addr:      s.cfg.Primary,
+		Connected: s.conn != nil,
+		Height:    s.height,
+	}
+	if s.lastErr != nil {
+		info.LastError = s.lastErr.Error()
+	}
+	return info
+}
+
+// connHandler keeps the secondary connected to the primary, backing off after
+// each failure.  It must be run as a goroutine.
+func (s *Secondary) connHandler() {
+	defer s.wg.Done()
+	retry := minRetryInterval
+	for {
+		err := s.follow()
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		s.mtx.Lock()
+		if s.conn != nil {
+			// The session made progress, so reconnect promptly.
+			retry = minRetryInterval
+		}
+		s.conn = nil
+		s.lastErr = err
+		s.mtx.Unlock()
+		log.Warnf("Replication from %s interrupted: %v, retrying in %v",
+			s.cfg.Primary, err, retry)
+
+		select {
+		case <-time.After(retry):
+		case <-s.quit:
+			return
+		}
+		if retry *= 2; retry > maxRetryInterval {
+			retry = maxRetryInterval
+		}
+	}
+}
+
+// follow connects to the primary and connects the blocks it streams until the
+// connection fails.
+func (s *Secondary) follow() error {
+	c, err := s.cfg.Dial("tcp", s.cfg.Primary)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	rc, err := handshake(c, s.cfg.Secret, false)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	select {
+	case <-s.quit:
+		s.mtx.Unlock()
+		return nil
+	default:
+	}
+	s.conn = rc
+	s.mtx.Unlock()
+
+	height, hash := s.cfg.Tip()
+	if err := rc.writeMsg(msgSync, encodeTip(height, hash, nil)); err != nil {
+		return err
+	}
+	s.setHeight(height)
+
+	for {
+		rc.SetReadDeadline(time.Now().Add(readTimeout))
+		typ, payload, err := rc.readMsg()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case msgBlock:
+			height, hash, data, err := decodeTip(payload)
+			if err != nil {
+				return err
+			}
+			got, err := s.cfg.ConnectBlock(data)
+			if err != nil {
+				return fmt.Errorf("unable to connect block %v at height "+
+					"%d: %v", hash, height, err)
+			}
+			if *got != hash {
+				return fmt.Errorf("block at height %d is %v, primary "+
+					"announced %v", height, got, hash)
+			}
+			log.Debugf("Replicated block %v at height %d", hash, height)
+			s.setHeight(height)
+
+		case msgPing:
+
+		case msgError:
+			return fmt.Errorf("primary: %s", payload)
+
+		default:
+			return fmt.Errorf("unexpected message %d", typ)
+		}
+	}
+}
+
+// setHeight records the height of the last replicated block.
+func (s *Secondary) setHeight(height int32) {
+	s.mtx.Lock()
+	s.height = height
+	s.mtx.Unlock()
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package replication implements a push replication channel between a primary
+// node and trusted secondary nodes.
+//
+// A secondary connects to the primary and both prove the knowledge of a shared
+// secret.  The secondary then announces its best block and the primary streams
+// every following main chain block along with its execution results and state
+// changes, so the secondary connects them without executing the transactions.
+// Every message is authenticated with a key derived from the secret and the
+// nonces of the handshake.
+package replication
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+const (
+	// protocolVersion is the version of the replication protocol.
+	protocolVersion = 1
+
+	// nonceSize is the size of the nonces exchanged during the handshake.
+	nonceSize = 32
+
+	// maxFrameSize is the maximum size of the payload of a message.
+	maxFrameSize = 1 << 28
+
+	// handshakeTimeout is the time allowed to complete the handshake.
+	handshakeTimeout = time.Second * 10
+
+	// pingInterval is the idle time after which the primary pings the
+	// secondaries so they can detect a dead connection.
+	pingInterval = time.Second * 30
+
+	// readTimeout is the time after which a secondary gives up on a silent
+	// primary.
+	readTimeout = pingInterval * 3
+)
+
+// msgType identifies the kind of a message.
+type msgType byte
+
+// These constants define the messages of the protocol.
+const (
+	// msgSync is sent by a secondary with the height and hash of its best
+	// block.
+	msgSync msgType = iota + 1
+
+	// msgBlock is sent by the primary with the height, hash and encoding of
+	// the next main chain block.
+	msgBlock
+
+	// msgPing is sent by the primary when it has been idle.
+	msgPing
+
+	// msgError is sent by the primary before closing the connection.
+	msgError
+)
+
+// Roles mixed in the handshake proofs so a proof can not be reflected.
+var (
+	rolePrimary   = []byte("asimov-replication-primary")
+	roleSecondary = []byte("asimov-replication-secondary")
+)
+
+// ErrAuthFailed is returned when the remote node does not know the secret.
+var ErrAuthFailed = errors.New("replication authentication failed")
+
+// conn is an authenticated replication connection.
+type conn struct {
+	net.Conn
+	key     []byte
+	sendSeq uint64
+	recvSeq uint64
+}
+
+// mac returns the authentication code of a message.
+func mac(key []byte, seq uint64, typ msgType, payload []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	var hdr [9]byte
+	binary.BigEndian.PutUint64(hdr[:8], seq)
+	hdr[8] = byte(typ)
+	h.Write(hdr[:])
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// proof returns the proof of the knowledge of the secret by the node of the
+// passed role.
+func proof(secret, role, ownNonce, peerNonce []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(role)
+	h.Write(ownNonce)
+	h.Write(peerNonce)
+	return h.Sum(nil)
+}
+
+// handshake authenticates both ends of a new connection and derives the key
+// of the session.
+func handshake(c net.Conn, secret []byte, primary bool) (*conn, error) {
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.SetDeadline(time.Time{})
+
+	hello := make([]byte, 1+nonceSize)
+	hello[0] = protocolVersion
+	if _, err := rand.Read(hello[1:]); err != nil {
+		return nil, err
+	}
+	if _, err := c.Write(hello); err != nil {
+		return nil, err
+	}
+	peerHello := make([]byte, 1+nonceSize)
+	if _, err := io.ReadFull(c, peerHello); err != nil {
+		return nil, err
+	}
+	if peerHello[0] != protocolVersion {
+		return nil, fmt.Errorf("unsupported replication protocol version %d",
+			peerHello[0])
+	}
+	nonce, peerNonce := hello[1:], peerHello[1:]
+
+	ownRole, peerRole := roleSecondary, rolePrimary
+	if primary {
+		ownRole, peerRole = rolePrimary, roleSecondary
+	}
+	if _, err := c.Write(proof(secret, ownRole, nonce, peerNonce)); err != nil {
+		return nil, err
+	}
+	peerProof := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(c, peerProof); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(peerProof, proof(secret, peerRole, peerNonce, nonce)) {
+		return nil, ErrAuthFailed
+	}
+
+	primaryNonce, secondaryNonce := peerNonce, nonce
+	if primary {
+		primaryNonce, secondaryNonce = nonce, peerNonce
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write(primaryNonce)
+	h.Write(secondaryNonce)
+	return &conn{Conn: c, key: h.Sum(nil)}, nil
+}
+
+// writeMsg sends an authenticated message.
+func (c *conn) writeMsg(typ msgType, payload []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(payload)))
+	hdr[4] = byte(typ)
+	buf := bytes.NewBuffer(make([]byte, 0, len(hdr)+len(payload)+sha256.Size))
+	buf.Write(hdr[:])
+	buf.Write(payload)
+	buf.Write(mac(c.key, c.sendSeq, typ, payload))
+	c.sendSeq++
+	_, err := c.Write(buf.Bytes())
+	return err
+}
+
+// readMsg receives an authenticated message.
+func (c *conn) readMsg() (msgType, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:4])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("replication message of %d bytes is too "+
+			"large", size)
+	}
+	typ := msgType(hdr[4])
+	data := make([]byte, int(size)+sha256.Size)
+	if _, err := io.ReadFull(c, data); err != nil {
+		return 0, nil, err
+	}
+	payload, sum := data[:size], data[size:]
+	if !hmac.Equal(sum, mac(c.key, c.recvSeq, typ, payload)) {
+		return 0, nil, ErrAuthFailed
+	}
+	c.recvSeq++
+	return typ, payload, nil
+}
+
+// encodeTip encodes the height and hash of a block, followed by data.
+func encodeTip(height int32, hash *common.Hash, data []byte) []byte {
+	buf := make([]byte, 4+common.HashLength+len(data))
+	binary.BigEndian.PutUint32(buf[:4], uint32(height))
+	copy(buf[4:], hash[:])
+	copy(buf[4+common.HashLength:], data)
+	return buf
+}
+
+// decodeTip decodes a payload encoded by encodeTip.
+func decodeTip(payload []byte) (int32, common.Hash, []byte, error) {
+	var hash common.Hash
+	if len(payload) < 4+common.HashLength {
+		return 0, hash, nil, errors.New("truncated replication message")
+	}
+	height := int32(binary.BigEndian.Uint32(payload[:4]))
+	copy(hash[:], payload[4:4+common.HashLength])
+	return height, hash, payload[4+common.HashLength:], nil
+}
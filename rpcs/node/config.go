@@ -119,6 +119,22 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// RPCQuotas requires the HTTP and websocket calls to carry an API key and
+	// enforces the limits of the keys.  If nil, API keys are not required.
+	RPCQuotas *rpc.Quotas `toml:"-"`
+
+	// RPCLimits restricts the request sizes and the concurrent connections
+	// of the HTTP and websocket clients, identified behind trusted proxies.
+	RPCLimits rpc.HTTPLimits `toml:"-"`
+
+	// RPCPanicHandler is told about the RPC callbacks which panicked.  It
+	// may be nil.
+	RPCPanicHandler rpc.PanicHandler `toml:"-"`
+
+	// RPCCallStats records the latency of the RPC calls and logs the slow
+	// ones.  It may be nil.
+	RPCCallStats *rpc.CallStats `toml:"-"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger logger.Logger `toml:",omitempty"`
 }
@@ -0,0 +1,255 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSlowParamString is the number of characters kept of the string
+	// parameters of the slow calls.
+	maxSlowParamString = 64
+
+	// maxSlowParams is the number of bytes kept of the encoded parameters
+	// of the slow calls.
+	maxSlowParams = 1024
+
+	// redactedParams replaces the parameters of the redacted methods.
+	redactedParams = "[redacted]"
+)
+
+// LatencyBuckets are the upper bounds of the buckets of the latency
+// histograms of the methods.  The last bucket of the histograms counts the
+// calls slower than all bounds.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// clientCtxKey is used to store the address of the client of a request within
+// the connection context.
+type clientCtxKey struct{}
+
+// MethodStats describes the calls of a method.
+type MethodStats struct {
+	Method string
+	Calls  uint64
+	Errors uint64
+	Total  time.Duration
+	Max    time.Duration
+
+	// Buckets counts the calls per latency, bucket i counting the calls
+	// which took at most LatencyBuckets[i] and not less than the previous
+	// bound.
+	Buckets []uint64
+}
+
+// SlowCall describes a call which took longer than the slow call threshold.
+type SlowCall struct {
+	Time     time.Time
+	Method   string
+	Duration time.Duration
+
+	// Params are the JSON encoded parameters of the call, with the long
+	// strings truncated.
+	Params string
+
+	// Client is the address of the client, and APIKey the name of the API
+	// key of the call.  Both are empty for in-process and IPC calls.
+	Client string
+	APIKey string
+
+	Error string
+}
+
+// CallStats records the latency of the calls of every method and keeps the
+// most recent calls slower than a threshold.
+type CallStats struct {
+	mtx       sync.Mutex
+	methods   map[string]*MethodStats
+	threshold time.Duration
+	slow      []SlowCall
+	next      int
+	redacted  map[string]struct{}
+	now       func() time.Time
+}
+
+// NewCallStats returns call stats logging the calls which take longer than
+// threshold, zero disabling the slow call log, and keeping the last size of
+// them.  The parameters of the redacted methods are never logged.
+func NewCallStats(threshold time.Duration, size int, redacted []string) *CallStats {
+	if size <= 0 {
+		threshold = 0
+	}
+	s := &CallStats{
+		methods:   make(map[string]*MethodStats),
+		threshold: threshold,
+		slow:      make([]SlowCall, 0, size),
+		redacted:  make(map[string]struct{}, len(redacted)),
+		now:       time.Now,
+	}
+	for _, method := range redacted {
+		s.redacted[method] = struct{}{}
+	}
+	return s
+}
+
+// Threshold returns the duration above which the calls are logged, zero when
+// the slow call log is disabled.
+func (s *CallStats) Threshold() time.Duration {
+	return s.threshold
+}
+
+// Methods returns the stats of the methods which were called, sorted by
+// method.
+func (s *CallStats) Methods() []MethodStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stats := make([]MethodStats, 0, len(s.methods))
+	for _, m := range s.methods {
+		m := *m
+		m.Buckets = append([]uint64(nil), m.Buckets...)
+		stats = append(stats, m)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+// SlowLog returns the logged slow calls, the most recent first.
+func (s *CallStats) SlowLog() []SlowCall {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	calls := make([]SlowCall, 0, len(s.slow))
+	for i := 1; i <= len(s.slow); i++ {
+		calls = append(calls, s.slow[(s.next-i+len(s.slow))%len(s.slow)])
+	}
+	return calls
+}
+
+// record accounts a call of the passed method with its arguments, made by the
+// passed client with the named API key.  The calls are not recorded when the
+// stats are nil.
+func (s *CallStats) record(method string, args []reflect.Value, client, apiKey string,
+	elapsed time.Duration, err error) {
+
+	if s == nil {
+		return
+	}
+
+	s.mtx.Lock()
+	m, ok := s.methods[method]
+	if !ok {
+		m = &MethodStats{
+			Method:  method,
+			Buckets: make([]uint64, len(LatencyBuckets)+1),
+		}
+		s.methods[method] = m
+	}
+	m.Calls++
+	if err != nil {
+		m.Errors++
+	}
+	m.Total += elapsed
+	if elapsed > m.Max {
+		m.Max = elapsed
+	}
+	m.Buckets[sort.Search(len(LatencyBuckets), func(i int) bool {
+		return elapsed <= LatencyBuckets[i]
+	})]++
+	s.mtx.Unlock()
+
+	if s.threshold == 0 || elapsed < s.threshold {
+		return
+	}
+
+	call := SlowCall{
+		Time:     s.now(),
+		Method:   method,
+		Duration: elapsed,
+		Params:   redactedParams,
+		Client:   client,
+		APIKey:   apiKey,
+	}
+	if _, ok := s.redacted[method]; !ok {
+		call.Params = sanitizeParams(args)
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	rpcLog.Warnf("Slow RPC call %s took %v (client %q, key %q): %s",
+		method, elapsed, call.Client, call.APIKey, call.Params)
+
+	s.mtx.Lock()
+	if len(s.slow) < cap(s.slow) {
+		s.slow = append(s.slow, call)
+	} else {
+		s.slow[s.next] = call
+	}
+	s.next = (s.next + 1) % cap(s.slow)
+	s.mtx.Unlock()
+}
+
+// sanitizeParams returns the JSON encoding of the passed arguments, with the
+// long strings truncated and the whole encoding limited to maxSlowParams
+// bytes.
+func sanitizeParams(args []reflect.Value) string {
+	params := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		params = append(params, arg.Interface())
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return "[unencodable]"
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return "[unencodable]"
+	}
+	if b, err = json.Marshal(truncateStrings(decoded)); err != nil {
+		return "[unencodable]"
+	}
+	if len(b) > maxSlowParams {
+		return string(b[:maxSlowParams]) + "..."
+	}
+	return string(b)
+}
+
+// truncateStrings truncates the long strings of a decoded JSON value.
+func truncateStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if len(v) > maxSlowParamString {
+			return v[:maxSlowParamString] + "..."
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = truncateStrings(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = truncateStrings(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type SlowService struct{}
+
+func (s *SlowService) Sleep(ms int, note string) (int, error) {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	return ms, nil
+}
+
+func (s *SlowService) Secret(key string) error {
+	time.Sleep(20 * time.Millisecond)
+	return errors.New("bad key")
+}
+
+func TestCallStats(t *testing.T) {
+	stats := NewCallStats(10*time.Millisecond, 2, []string{"test_secret"})
+	server := NewServer()
+	server.SetCallStats(stats)
+	if err := server.RegisterName("test", &SlowService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result int
+	long := strings.Repeat("x", 100)
+	for _, ms := range []int{0, 0, 20} {
+		if err := client.Call(&result, "test_sleep", ms, long); err != nil {
+			t.Fatalf("test_sleep: %v", err)
+		}
+	}
+	if err := client.Call(nil, "test_secret", "private"); err == nil {
+		t.Fatal("test_secret succeeded")
+	}
+
+	methods := stats.Methods()
+	if len(methods) != 2 || methods[0].Method != "test_secret" ||
+		methods[1].Method != "test_sleep" {
+		t.Fatalf("Methods = %v", methods)
+	}
+	secret, sleep := methods[0], methods[1]
+	if secret.Calls != 1 || secret.Errors != 1 {
+		t.Errorf("test_secret calls %d, errors %d", secret.Calls, secret.Errors)
+	}
+	if sleep.Calls != 3 || sleep.Errors != 0 || sleep.Max < 20*time.Millisecond {
+		t.Errorf("test_sleep calls %d, errors %d, max %v", sleep.Calls,
+			sleep.Errors, sleep.Max)
+	}
+	var bucketed uint64
+	for _, n := range sleep.Buckets {
+		bucketed += n
+	}
+	if sleep.Buckets[0] < 2 || bucketed != 3 {
+		t.Errorf("test_sleep buckets %v", sleep.Buckets)
+	}
+
+	// The slow calls are logged the most recent first, with the long
+	// strings truncated and the parameters of the redacted methods hidden.
+	slow := stats.SlowLog()
+	if len(slow) != 2 {
+		t.Fatalf("SlowLog has %d calls, want 2", len(slow))
+	}
+	if slow[0].Method != "test_secret" || slow[0].Params != redactedParams ||
+		slow[0].Error != "bad key" {
+		t.Errorf("SlowLog[0] = %+v", slow[0])
+	}
+	want := `[20,"` + long[:maxSlowParamString] + `..."]`
+	if slow[1].Method != "test_sleep" || slow[1].Params != want {
+		t.Errorf("SlowLog[1] = %+v, want params %s", slow[1], want)
+	}
+
+	// The oldest slow calls are dropped once the log is full.
+	if err := client.Call(&result, "test_sleep", 20, ""); err != nil {
+		t.Fatalf("test_sleep: %v", err)
+	}
+	slow = stats.SlowLog()
+	if len(slow) != 2 || slow[0].Params != `[20,""]` || slow[1].Method != "test_secret" {
+		t.Errorf("SlowLog = %+v", slow)
+	}
+}
+
+func TestSanitizeParams(t *testing.T) {
+	args := []reflect.Value{
+		reflect.ValueOf(map[string]string{"data": strings.Repeat("ab", 40)}),
+		reflect.ValueOf(strings.Repeat("y", 10)),
+	}
+	want := `[{"data":"` + strings.Repeat("ab", 32) + `..."},"yyyyyyyyyy"]`
+	if got := sanitizeParams(args); got != want {
+		t.Errorf("sanitizeParams = %s, want %s", got, want)
+	}
+
+	many := make([]string, 100)
+	for i := range many {
+		many[i] = strings.Repeat("z", 50)
+	}
+	got := sanitizeParams([]reflect.Value{reflect.ValueOf(many)})
+	if len(got) != maxSlowParams+3 || !strings.HasSuffix(got, "...") {
+		t.Errorf("sanitizeParams of long params has %d bytes", len(got))
+	}
+}
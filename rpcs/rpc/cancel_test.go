@@ -0,0 +1,61 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type BlockingService struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (s *BlockingService) Wait(ctx context.Context) error {
+	close(s.started)
+	<-ctx.Done()
+	close(s.cancelled)
+	return ctx.Err()
+}
+
+func testCancel(t *testing.T, cancel func(server *Server, client *Client)) {
+	service := &BlockingService{
+		started:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	server := NewServer()
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatal(err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	go client.Call(nil, "test_wait")
+	select {
+	case <-service.started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("call not started")
+	}
+	cancel(server, client)
+	select {
+	case <-service.cancelled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("context of the call not cancelled")
+	}
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	testCancel(t, func(server *Server, client *Client) {
+		client.Close()
+	})
+}
+
+func TestCancelOnStop(t *testing.T) {
+	testCancel(t, func(server *Server, client *Client) {
+		server.Stop()
+	})
+}
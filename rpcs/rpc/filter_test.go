@@ -0,0 +1,50 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"errors"
+	"testing"
+)
+
+type FilterService struct {
+	refused string
+}
+
+func (s *FilterService) FilterMethod(method string) error {
+	if method == s.refused {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func (s *FilterService) Echo(v string) string {
+	return v
+}
+
+func (s *FilterService) Set(v string) string {
+	return v
+}
+
+func TestMethodFilter(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", &FilterService{refused: "test_set"}); err != nil {
+		t.Fatal(err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result string
+	if err := client.Call(&result, "test_echo", "hello"); err != nil || result != "hello" {
+		t.Fatalf("call of an allowed method = %q, %v", result, err)
+	}
+	err := client.Call(&result, "test_set", "hello")
+	if err == nil || err.Error() != "refused" {
+		t.Fatalf("call of a refused method returned %v", err)
+	}
+	if err := client.Call(&result, "test_filterMethod", "test_set"); err == nil {
+		t.Fatal("the filter is callable as a method")
+	}
+}
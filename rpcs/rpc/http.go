@@ -31,6 +31,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/AsimovNetwork/asimov/tracing"
 	"github.com/rs/cors"
 )
 
@@ -248,20 +249,37 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet && r.ContentLength == 0 && r.URL.RawQuery == "" {
 		return
 	}
-	if code, err := validateRequest(r); err != nil {
+	ip := srv.limits.clientIP(r)
+	if !srv.conns.acquire(ip) {
+		http.Error(w, errTooManyConns.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer srv.conns.release(ip)
+
+	maxSize := srv.limits.maxRequestSize()
+	if code, err := validateRequest(r, maxSize); err != nil {
 		http.Error(w, err.Error(), code)
 		return
 	}
 	// All checks passed, create a codec that reads direct from the request body
 	// untilEOF and writes the response to w and order the server to process a
 	// single request.
-	ctx := r.Context()
+	ctx, err := srv.quotas.authenticate(r.Context(), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	ctx = context.WithValue(ctx, clientCtxKey{}, ip)
 	ctx = context.WithValue(ctx, "remote", r.RemoteAddr)
 	ctx = context.WithValue(ctx, "scheme", r.Proto)
 	ctx = context.WithValue(ctx, "local", r.Host)
+	if parent := tracing.RemoteParent(r.Header.Get("traceparent")); parent != nil {
+		ctx = tracing.ContextWithSpan(ctx, parent)
+	}
 
-	body := io.LimitReader(r.Body, maxRequestContentLength)
+	body := io.LimitReader(r.Body, maxSize)
 	codec := NewJSONCodec(&httpReadWriteNopCloser{body, w})
+	codec.(*jsonCodec).stream = w
 	defer codec.Close()
 
 	w.Header().Set("content-type", contentType)
@@ -270,12 +288,12 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // validateRequest returns a non-zero response code and error message if the
 // request is invalid.
-func validateRequest(r *http.Request) (int, error) {
+func validateRequest(r *http.Request, maxSize int64) (int, error) {
 	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
 		return http.StatusMethodNotAllowed, errors.New("method not allowed")
 	}
-	if r.ContentLength > maxRequestContentLength {
-		err := fmt.Errorf("content length too large (%d>%d)", r.ContentLength, maxRequestContentLength)
+	if r.ContentLength > maxSize {
+		err := fmt.Errorf("content length too large (%d>%d)", r.ContentLength, maxSize)
 		return http.StatusRequestEntityTooLarge, err
 	}
 	mt, _, err := mime.ParseMediaType(r.Header.Get("content-type"))
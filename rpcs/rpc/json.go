@@ -80,6 +80,7 @@ type jsonCodec struct {
 	decode func(v interface{}) error // decoder to allow multiple transports
 	encMu  sync.Mutex                // guards the encoder
 	encode func(v interface{}) error // encoder to allow multiple transports
+	stream io.Writer                 // writer of streamed results, if supported
 	rw     io.ReadWriteCloser        // connection
 }
 
@@ -335,6 +336,9 @@ func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]
 
 // CreateResponse will create a JSON-RPC success response with the given id and reply as result.
 func (c *jsonCodec) CreateResponse(id interface{}, reply interface{}) interface{} {
+	if result, ok := reply.(StreamedResult); ok {
+		reply = &streamedResult{result}
+	}
 	return &jsonSuccessResponse{Version: jsonrpcVersion, Id: id, Result: reply}
 }
 
@@ -361,6 +365,11 @@ func (c *jsonCodec) Write(res interface{}) error {
 	c.encMu.Lock()
 	defer c.encMu.Unlock()
 
+	if c.stream != nil {
+		if streamed, err := writeStreamed(c.stream, res); streamed {
+			return err
+		}
+	}
 	return c.encode(res)
 }
 
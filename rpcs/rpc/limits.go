@@ -0,0 +1,142 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ForwardedForHeader is the header a reverse proxy adds with the address of
+// the client it forwards a request for.
+const ForwardedForHeader = "X-Forwarded-For"
+
+// errTooManyConns is returned when a client exceeds its concurrent connections.
+var errTooManyConns = errors.New("too many concurrent connections")
+
+// HTTPLimits configures how the HTTP and websocket servers treat their clients
+// when they are exposed to the public, possibly behind a load balancer.
+type HTTPLimits struct {
+	// MaxRequestSize is the maximum size in bytes of a request body or a
+	// websocket message.  Zero selects the default of 2 MiB.
+	MaxRequestSize int64
+
+	// MaxConnsPerIP is the maximum number of requests and websocket
+	// connections served concurrently per client address, zero meaning
+	// unlimited.
+	MaxConnsPerIP int
+
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-For header identifies the client of a request.
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxy parses an IP address or a CIDR network of a trusted
+// reverse proxy.
+func ParseTrustedProxy(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid proxy address %q", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// maxRequestSize returns the effective maximum request size.
+func (l *HTTPLimits) maxRequestSize() int64 {
+	if l.MaxRequestSize <= 0 {
+		return maxRequestContentLength
+	}
+	return l.MaxRequestSize
+}
+
+// trusted returns whether the passed address belongs to a trusted proxy.
+func (l *HTTPLimits) trusted(ip net.IP) bool {
+	for _, ipNet := range l.TrustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client of the passed request.  When the
+// request comes from a trusted proxy, the X-Forwarded-For header is walked
+// from the nearest hop and the first address which is not a trusted proxy is
+// the client.
+func (l *HTTPLimits) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header[ForwardedForHeader], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !l.trusted(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// connLimiter counts the concurrent requests and connections per client.
+type connLimiter struct {
+	mtx   sync.Mutex
+	max   int
+	conns map[string]int
+}
+
+// newConnLimiter returns a limiter of max concurrent connections per client.
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{max: max, conns: make(map[string]int)}
+}
+
+// acquire accounts a new connection of the client and returns false when the
+// client already has the maximum number of connections.
+func (c *connLimiter) acquire(ip string) bool {
+	if c.max <= 0 {
+		return true
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.conns[ip] >= c.max {
+		return false
+	}
+	c.conns[ip]++
+	return true
+}
+
+// release accounts a closed connection of the client.
+func (c *connLimiter) release(ip string) {
+	if c.max <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.conns[ip]--; c.conns[ip] <= 0 {
+		delete(c.conns, ip)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var proxies []*net.IPNet
+	for _, s := range []string{"10.0.0.0/8", "::1"} {
+		ipNet, err := ParseTrustedProxy(s)
+		if err != nil {
+			t.Fatalf("ParseTrustedProxy(%q): %v", s, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	if _, err := ParseTrustedProxy("proxy"); err == nil {
+		t.Fatal("ParseTrustedProxy accepted an invalid address")
+	}
+	limits := HTTPLimits{TrustedProxies: proxies}
+
+	tests := []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"1.2.3.4:1000", nil, "1.2.3.4"},
+		// The header of an untrusted client is ignored.
+		{"1.2.3.4:1000", []string{"5.6.7.8"}, "1.2.3.4"},
+		{"10.0.0.1:1000", nil, "10.0.0.1"},
+		{"10.0.0.1:1000", []string{"5.6.7.8"}, "5.6.7.8"},
+		// Only the hops added by trusted proxies are skipped.
+		{"10.0.0.1:1000", []string{"6.6.6.6, 5.6.7.8, 10.0.0.2"}, "5.6.7.8"},
+		{"[::1]:1000", []string{"6.6.6.6", "5.6.7.8"}, "5.6.7.8"},
+		{"10.0.0.1:1000", []string{"garbage"}, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remote, Header: make(http.Header)}
+		for _, value := range test.forwarded {
+			r.Header.Add(ForwardedForHeader, value)
+		}
+		if got := limits.clientIP(r); got != test.want {
+			t.Errorf("clientIP(%s, %v) = %s, want %s", test.remote,
+				test.forwarded, got, test.want)
+		}
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	c := newConnLimiter(2)
+	if !c.acquire("a") || !c.acquire("a") {
+		t.Fatal("connections under the limit rejected")
+	}
+	if c.acquire("a") {
+		t.Fatal("connection over the limit accepted")
+	}
+	if !c.acquire("b") {
+		t.Fatal("connection of another client rejected")
+	}
+	c.release("a")
+	if !c.acquire("a") {
+		t.Fatal("connection after release rejected")
+	}
+
+	unlimited := newConnLimiter(0)
+	for i := 0; i < 10; i++ {
+		if !unlimited.acquire("a") {
+			t.Fatal("unlimited limiter rejected a connection")
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"testing"
+)
+
+type PanicService struct{}
+
+func (s *PanicService) Boom() (string, error) {
+	panic("boom")
+}
+
+func (s *PanicService) Echo(v string) string {
+	return v
+}
+
+func TestCallbackPanic(t *testing.T) {
+	server := NewServer()
+	var method string
+	var value interface{}
+	server.SetPanicHandler(func(m string, v interface{}, stack []byte) {
+		method, value = m, v
+	})
+	if err := server.RegisterName("test", &PanicService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result string
+	if err := client.Call(&result, "test_boom"); err == nil {
+		t.Fatal("call of a panicking method succeeded")
+	}
+	if method != "test_boom" || value != "boom" {
+		t.Fatalf("panic handler called with %q, %v", method, value)
+	}
+
+	// The server keeps serving after the panic.
+	if err := client.Call(&result, "test_echo", "hello"); err != nil || result != "hello" {
+		t.Fatalf("call after a panic = %q, %v", result, err)
+	}
+}
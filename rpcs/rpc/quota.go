@@ -0,0 +1,337 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// APIKeyHeader is the HTTP header carrying the API key of a request.
+	APIKeyHeader = "X-Api-Key"
+
+	// apiKeyParam is the URL query parameter carrying the API key of a
+	// request, for clients such as browsers which cannot set headers on
+	// websocket connections.
+	apiKeyParam = "apikey"
+
+	// AllMethods is the method name of a quota applied to the sum of the
+	// calls of all methods.
+	AllMethods = "*"
+)
+
+var (
+	// ErrAPIKeyRequired is returned when API keys are configured and a
+	// request does not carry one.
+	ErrAPIKeyRequired = errors.New("api key required")
+
+	// ErrUnknownAPIKey is returned when a request carries an API key which
+	// is not configured.
+	ErrUnknownAPIKey = errors.New("unknown api key")
+)
+
+// quotaError is returned when a call exceeds the limits of its API key.
+type quotaError struct{ message string }
+
+func (e *quotaError) ErrorCode() int { return -32005 }
+
+func (e *quotaError) Error() string { return e.message }
+
+// apiKeyCtxKey is used to store the API key of a request within the
+// connection context.
+type apiKeyCtxKey struct{}
+
+// APIKey describes the limits applied to the calls made with an API key.
+type APIKey struct {
+	// Name identifies the key in the usage reports, so the key itself is
+	// never exposed.
+	Name string
+
+	// Key is the secret sent by the clients.
+	Key string
+
+	// Rate is the number of calls per second allowed on average, zero
+	// meaning unlimited.  Burst calls may be made at once.
+	Rate  float64
+	Burst int
+
+	// Quotas maps method names to the number of calls allowed per UTC
+	// day.  The AllMethods entry limits the sum of all calls.
+	Quotas map[string]uint64
+
+	// Admin keys are not limited and may call any method.
+	Admin bool
+}
+
+// ParseAPIKey parses an API key of the form name:key[:rate[:method=limit,...]]
+// where rate is the number of calls per second and every limit the number of
+// calls allowed per day.
+func ParseAPIKey(s string) (*APIKey, error) {
+	fields := strings.SplitN(s, ":", 4)
+	if len(fields) < 2 || fields[0] == "" || fields[1] == "" {
+		return nil, fmt.Errorf("api key %q is not of the form "+
+			"name:key[:rate[:method=limit,...]]", s)
+	}
+	key := &APIKey{
+		Name:   fields[0],
+		Key:    fields[1],
+		Quotas: make(map[string]uint64),
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		rate, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate %q of api key %s",
+				fields[2], key.Name)
+		}
+		key.Rate = rate
+		key.Burst = int(rate)
+		if key.Burst < 1 {
+			key.Burst = 1
+		}
+	}
+	if len(fields) > 3 && fields[3] != "" {
+		for _, quota := range strings.Split(fields[3], ",") {
+			parts := strings.SplitN(quota, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("invalid quota %q of api key %s",
+					quota, key.Name)
+			}
+			limit, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quota %q of api key %s",
+					quota, key.Name)
+			}
+			key.Quotas[parts[0]] = limit
+		}
+	}
+	return key, nil
+}
+
+// MethodUsage is the number of calls of a method made with an API key.
+type MethodUsage struct {
+	Today uint64
+	Total uint64
+	Quota uint64
+}
+
+// KeyUsage is the usage of an API key.
+type KeyUsage struct {
+	Name     string
+	Admin    bool
+	Calls    uint64
+	Rejected uint64
+	Methods  map[string]MethodUsage
+}
+
+// keyState tracks the rate limit and the usage of an API key.
+type keyState struct {
+	key      *APIKey
+	tokens   float64
+	last     time.Time
+	day      int64
+	today    map[string]uint64
+	total    map[string]uint64
+	calls    uint64
+	rejected uint64
+}
+
+// Quotas authenticates the API keys of RPC requests and enforces their rate
+// limits and method quotas.
+type Quotas struct {
+	mtx    sync.Mutex
+	keys   map[string]*keyState
+	public map[string]struct{}
+	now    func() time.Time
+}
+
+// NewQuotas returns the quotas of the passed API keys.  Regular keys may only
+// call the public methods, any other method requires an admin key.
+func NewQuotas(keys []*APIKey, publicMethods []string) (*Quotas, error) {
+	q := &Quotas{
+		keys:   make(map[string]*keyState, len(keys)),
+		public: make(map[string]struct{}, len(publicMethods)),
+		now:    time.Now,
+	}
+	names := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := q.keys[key.Key]; ok {
+			return nil, fmt.Errorf("api key %s is configured twice", key.Name)
+		}
+		if _, ok := names[key.Name]; ok {
+			return nil, fmt.Errorf("api key name %s is used twice", key.Name)
+		}
+		names[key.Name] = struct{}{}
+		q.keys[key.Key] = &keyState{
+			key:    key,
+			tokens: float64(key.Burst),
+			today:  make(map[string]uint64),
+			total:  make(map[string]uint64),
+		}
+	}
+	for _, method := range publicMethods {
+		q.public[method] = struct{}{}
+	}
+	return q, nil
+}
+
+// Known returns whether the passed API key is configured.
+func (q *Quotas) Known(key string) bool {
+	q.mtx.Lock()
+	_, ok := q.keys[key]
+	q.mtx.Unlock()
+	return ok
+}
+
+// Name returns the name of the passed API key, or an empty string when the
+// key is not configured.
+func (q *Quotas) Name(key string) string {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if state, ok := q.keys[key]; ok {
+		return state.key.Name
+	}
+	return ""
+}
+
+// Allow accounts a call of the method made with the passed API key and
+// returns an error when the call exceeds the limits of the key.
+func (q *Quotas) Allow(key, method string) Error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	ks, ok := q.keys[key]
+	if !ok {
+		return &quotaError{ErrUnknownAPIKey.Error()}
+	}
+	now := q.now()
+	if day := now.UTC().Unix() / 86400; day != ks.day {
+		ks.day = day
+		ks.today = make(map[string]uint64)
+	}
+
+	if !ks.key.Admin {
+		if _, ok := q.public[method]; !ok {
+			ks.rejected++
+			return &quotaError{fmt.Sprintf("method %s requires an admin api key", method)}
+		}
+		if ks.key.Rate > 0 {
+			ks.tokens += now.Sub(ks.last).Seconds() * ks.key.Rate
+			if ks.tokens > float64(ks.key.Burst) {
+				ks.tokens = float64(ks.key.Burst)
+			}
+			ks.last = now
+			if ks.tokens < 1 {
+				ks.rejected++
+				return &quotaError{fmt.Sprintf("rate limit of %v calls per second exceeded", ks.key.Rate)}
+			}
+		}
+		if limit, ok := ks.key.Quotas[method]; ok && ks.today[method] >= limit {
+			ks.rejected++
+			return &quotaError{fmt.Sprintf("daily quota of %d calls of %s exceeded", limit, method)}
+		}
+		if limit, ok := ks.key.Quotas[AllMethods]; ok && ks.today[AllMethods] >= limit {
+			ks.rejected++
+			return &quotaError{fmt.Sprintf("daily quota of %d calls exceeded", limit)}
+		}
+		if ks.key.Rate > 0 {
+			ks.tokens--
+		}
+	}
+
+	ks.calls++
+	ks.today[method]++
+	ks.today[AllMethods]++
+	ks.total[method]++
+	return nil
+}
+
+// Usage returns the usage of all API keys ordered by name.
+func (q *Quotas) Usage() []KeyUsage {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	day := q.now().UTC().Unix() / 86400
+	usage := make([]KeyUsage, 0, len(q.keys))
+	for _, ks := range q.keys {
+		u := KeyUsage{
+			Name:     ks.key.Name,
+			Admin:    ks.key.Admin,
+			Calls:    ks.calls,
+			Rejected: ks.rejected,
+			Methods:  make(map[string]MethodUsage),
+		}
+		for method, total := range ks.total {
+			m := MethodUsage{Total: total, Quota: ks.key.Quotas[method]}
+			if ks.day == day {
+				m.Today = ks.today[method]
+			}
+			u.Methods[method] = m
+		}
+		if limit, ok := ks.key.Quotas[AllMethods]; ok {
+			m := MethodUsage{Total: ks.calls, Quota: limit}
+			if ks.day == day {
+				m.Today = ks.today[AllMethods]
+			}
+			u.Methods[AllMethods] = m
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Name < usage[j].Name
+	})
+	return usage
+}
+
+// apiKeyFromRequest returns the API key carried by the passed HTTP request.
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get(apiKeyParam)
+}
+
+// authenticate checks the API key of the passed HTTP request when quotas are
+// enabled and returns the context of its calls.
+func (q *Quotas) authenticate(ctx context.Context, r *http.Request) (context.Context, error) {
+	if q == nil {
+		return ctx, nil
+	}
+	key := apiKeyFromRequest(r)
+	if key == "" {
+		return ctx, ErrAPIKeyRequired
+	}
+	if !q.Known(key) {
+		return ctx, ErrUnknownAPIKey
+	}
+	return context.WithValue(ctx, apiKeyCtxKey{}, key), nil
+}
+
+// allow accounts the call of the passed method against the API key stored in
+// the context.  All calls are allowed when quotas are disabled.
+func (q *Quotas) allow(ctx context.Context, method string) Error {
+	if q == nil {
+		return nil
+	}
+	key, _ := ctx.Value(apiKeyCtxKey{}).(string)
+	return q.Allow(key, method)
+}
+
+// keyName returns the name of the API key stored in the context, or an empty
+// string when quotas are disabled.
+func (q *Quotas) keyName(ctx context.Context) string {
+	if q == nil {
+		return ""
+	}
+	key, _ := ctx.Value(apiKeyCtxKey{}).(string)
+	return q.Name(key)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	key, err := ParseAPIKey("alice:secret:2.5:asimov_call=10,*=100")
+	if err != nil {
+		t.Fatalf("ParseAPIKey: %v", err)
+	}
+	if key.Name != "alice" || key.Key != "secret" || key.Rate != 2.5 ||
+		key.Burst != 2 {
+		t.Fatalf("unexpected key %+v", key)
+	}
+	if key.Quotas["asimov_call"] != 10 || key.Quotas[AllMethods] != 100 {
+		t.Fatalf("unexpected quotas %v", key.Quotas)
+	}
+
+	for _, s := range []string{"alice", ":secret", "alice:secret:fast",
+		"alice:secret:1:asimov_call", "alice:secret:1:asimov_call=-1"} {
+		if _, err := ParseAPIKey(s); err == nil {
+			t.Errorf("ParseAPIKey(%q) succeeded", s)
+		}
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	alice, _ := ParseAPIKey("alice:a:1:asimov_call=2")
+	ops, _ := ParseAPIKey("ops:o")
+	ops.Admin = true
+	q, err := NewQuotas([]*APIKey{alice, ops},
+		[]string{"asimov_call", "asimov_getBlockCount"})
+	if err != nil {
+		t.Fatalf("NewQuotas: %v", err)
+	}
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	if err := q.Allow("nobody", "asimov_call"); err == nil {
+		t.Fatal("unknown key allowed")
+	}
+	if err := q.Allow("a", "asimov_getRPCUsage"); err == nil {
+		t.Fatal("admin method allowed to a regular key")
+	}
+	if err := q.Allow("o", "asimov_getRPCUsage"); err != nil {
+		t.Fatalf("admin method rejected: %v", err)
+	}
+
+	// The burst of a single call is spent by the first call.
+	if err := q.Allow("a", "asimov_call"); err != nil {
+		t.Fatalf("first call rejected: %v", err)
+	}
+	if err := q.Allow("a", "asimov_call"); err == nil {
+		t.Fatal("rate limit not enforced")
+	}
+	now = now.Add(time.Second)
+	if err := q.Allow("a", "asimov_call"); err != nil {
+		t.Fatalf("call after refill rejected: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := q.Allow("a", "asimov_call"); err == nil {
+		t.Fatal("daily quota not enforced")
+	}
+	if err := q.Allow("a", "asimov_getBlockCount"); err != nil {
+		t.Fatalf("call of another method rejected: %v", err)
+	}
+
+	// The quota is reset on the next day.
+	now = now.Add(24 * time.Hour)
+	if err := q.Allow("a", "asimov_call"); err != nil {
+		t.Fatalf("call on the next day rejected: %v", err)
+	}
+
+	usage := q.Usage()
+	if len(usage) != 2 || usage[0].Name != "alice" || usage[1].Name != "ops" {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	u := usage[0]
+	if u.Calls != 4 || u.Rejected != 3 {
+		t.Fatalf("unexpected counters %+v", u)
+	}
+	if m := u.Methods["asimov_call"]; m.Today != 1 || m.Total != 3 || m.Quota != 2 {
+		t.Fatalf("unexpected method usage %+v", m)
+	}
+}
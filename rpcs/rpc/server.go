@@ -24,8 +24,10 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
     mapset "github.com/deckarep/golang-set"
+	"github.com/AsimovNetwork/asimov/tracing"
 )
 
 const MetadataApi = "rpc"
@@ -47,7 +49,9 @@ func NewServer() *Server {
 		services: make(serviceRegistry),
 		codecs:   mapset.NewSet(),
 		run:      1,
+		conns:    newConnLimiter(0),
 	}
+	server.ctx, server.shutdown = context.WithCancel(context.Background())
 
 	// register a default service which will provide meta information about the RPC service such as the services and
 	// methods it offers.
@@ -57,6 +61,33 @@ func NewServer() *Server {
 	return server
 }
 
+// SetQuotas requires the calls served over HTTP and websocket to carry one of
+// the API keys of the passed quotas and enforces their limits.  It must be
+// called before the server starts serving requests.
+func (s *Server) SetQuotas(q *Quotas) {
+	s.quotas = q
+}
+
+// SetLimits applies the passed limits to the clients served over HTTP and
+// websocket.  It must be called before the server starts serving requests.
+func (s *Server) SetLimits(l HTTPLimits) {
+	s.limits = l
+	s.conns = newConnLimiter(l.MaxConnsPerIP)
+}
+
+// SetPanicHandler sets the function told about the panics of the callbacks,
+// which are answered with an error instead of crashing the node.  It must be
+// called before the server starts serving requests.
+func (s *Server) SetPanicHandler(h PanicHandler) {
+	s.panicHandler = h
+}
+
+// SetCallStats records the latency of the calls in the passed stats.  It must
+// be called before the server starts serving requests.
+func (s *Server) SetCallStats(stats *CallStats) {
+	s.callStats = stats
+}
+
 // RPCService gives meta information about the server.
 // e.g. gives information about the loaded modules.
 type RPCService struct {
@@ -139,9 +170,17 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 		s.codecsMu.Unlock()
 	}()
 
-	//	ctx, cancel := context.WithCancel(context.Background())
+	// The callbacks are cancelled when the client goes away, which ends
+	// ctx, or when the server stops.
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	go func(cctx context.Context) {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-cctx.Done():
+		}
+	}(ctx)
 
 	// if the codec supports notification include a notifier that callbacks can use
 	// to send notification to clients. It is tied to the codec/connection. If the
@@ -166,7 +205,10 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 				rpcLog.Debugf("read error %v\n", err)
 				codec.Write(codec.CreateErrorResponse(nil, err))
 			}
-			// Error or end of stream, wait for requests and tear down
+			// Error or end of stream, the client can not read the
+			// responses anymore so cancel the pending requests and
+			// tear down
+			cancel()
 			pend.Wait()
 			return nil
 		}
@@ -230,6 +272,7 @@ func (s *Server) ServeSingleRequest(ctx context.Context, codec ServerCodec, opti
 func (s *Server) Stop() {
 	if atomic.CompareAndSwapInt32(&s.run, 1, 0) {
 		rpcLog.Debug("RPC Server shutdown initiatied")
+		s.shutdown()
 		s.codecsMu.Lock()
 		defer s.codecsMu.Unlock()
 		s.codecs.Each(func(c interface{}) bool {
@@ -254,7 +297,7 @@ func (s *Server) createSubscription(ctx context.Context, c ServerCodec, req *ser
 }
 
 // handle executes a request and returns the response from the callback.
-func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverRequest) (interface{}, func()) {
+func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverRequest) (response interface{}, callback func()) {
 	if req.err != nil {
 		return codec.CreateErrorResponse(&req.id, req.err), nil
 	}
@@ -276,6 +319,16 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateErrorResponse(&req.id, &invalidParamsError{"Expected subscription id as first argument"}), nil
 	}
 
+	method := req.svcname + serviceMethodSeparator + formatName(req.callb.method.Name)
+	if err := s.quotas.allow(ctx, method); err != nil {
+		return codec.CreateErrorResponse(&req.id, err), nil
+	}
+	if req.callb.filter != nil {
+		if err := req.callb.filter.FilterMethod(method); err != nil {
+			return codec.CreateErrorResponse(&req.id, &callbackError{err.Error()}), nil
+		}
+	}
+
 	if req.callb.isSubscribe {
 		subid, err := s.createSubscription(ctx, codec, req)
 		if err != nil {
@@ -299,6 +352,10 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateErrorResponse(&req.id, rpcErr), nil
 	}
 
+	ctx, span := tracing.StartSpanFromContext(ctx, method)
+	span.SetKind(tracing.KindServer)
+	defer span.End()
+
 	arguments := []reflect.Value{req.callb.rcvr}
 	if req.callb.hasCtx {
 		arguments = append(arguments, reflect.ValueOf(ctx))
@@ -308,13 +365,41 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	}
 
 	// execute RPC method and return result
+	defer func() {
+		if value := recover(); value != nil {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			if s.panicHandler != nil {
+				s.panicHandler(method, value, buf)
+			} else {
+				rpcLog.Errorf("RPC method %s panicked: %v\n%s", method,
+					value, buf)
+			}
+			span.SetError(fmt.Errorf("panic: %v", value))
+			response = codec.CreateErrorResponse(&req.id,
+				&callbackError{fmt.Sprintf("internal error in %s", method)})
+			callback = nil
+		}
+	}()
+	start := time.Now()
 	reply := req.callb.method.Func.Call(arguments)
+	if s.callStats != nil {
+		var err error
+		if req.callb.errPos >= 0 && !reply[req.callb.errPos].IsNil() {
+			err = reply[req.callb.errPos].Interface().(error)
+		}
+		client, _ := ctx.Value(clientCtxKey{}).(string)
+		s.callStats.record(method, req.args, client, s.quotas.keyName(ctx),
+			time.Since(start), err)
+	}
 	if len(reply) == 0 {
 		return codec.CreateResponse(req.id, nil), nil
 	}
 	if req.callb.errPos >= 0 { // test if method returned an error
 		if !reply[req.callb.errPos].IsNil() {
 			e := reply[req.callb.errPos].Interface().(error)
+			span.SetError(e)
 			res := codec.CreateErrorResponse(&req.id, &callbackError{e.Error()})
 			return res, nil
 		}
@@ -0,0 +1,76 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// StreamedResult is implemented by the results of methods which are too large
+// to be marshaled at once.  Over HTTP, the response is written as the result
+// encodes itself, with the chunked transfer encoding, so neither the server
+// nor the client have to hold the whole document in memory.  The other
+// transports, and batches, marshal the result into a buffer first.
+//
+// An error returned once the result started to be written cannot be reported
+// to the client, so the response is truncated and the client fails to decode
+// it.
+type StreamedResult interface {
+	WriteJSON(w io.Writer) error
+}
+
+// streamedResult marshals a streamed result for the transports which do not
+// stream their responses.
+type streamedResult struct {
+	StreamedResult
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r *streamedResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeStreamed writes a success response whose result is streamed to the
+// passed writer.  It returns false when the response has no streamed result,
+// and must be encoded as usual.
+func writeStreamed(w io.Writer, res interface{}) (bool, error) {
+	resp, ok := res.(*jsonSuccessResponse)
+	if !ok {
+		return false, nil
+	}
+	result, ok := resp.Result.(*streamedResult)
+	if !ok {
+		return false, nil
+	}
+
+	// The envelope matches the encoding of jsonSuccessResponse, with a
+	// trailing newline as written by a json.Encoder.
+	if _, err := io.WriteString(w, `{"jsonrpc":"`+resp.Version+`"`); err != nil {
+		return true, err
+	}
+	if resp.Id != nil {
+		id, err := json.Marshal(resp.Id)
+		if err != nil {
+			return true, err
+		}
+		if _, err := io.WriteString(w, `,"id":`+string(id)); err != nil {
+			return true, err
+		}
+	}
+	if _, err := io.WriteString(w, `,"result":`); err != nil {
+		return true, err
+	}
+	if err := result.WriteJSON(w); err != nil {
+		return true, err
+	}
+	_, err := io.WriteString(w, "}\n")
+	return true, err
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countResult streams the array of the integers below n.
+type countResult int
+
+func (n countResult) WriteJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; i < int(n); i++ {
+		sep := ","
+		if i == 0 {
+			sep = ""
+		}
+		if _, err := fmt.Fprintf(w, "%s%d", sep, i); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+type StreamService struct{}
+
+func (s *StreamService) Count(n int) (interface{}, error) {
+	return countResult(n), nil
+}
+
+func TestStreamedResult(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", &StreamService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	// Large results are sent with the chunked transfer encoding.
+	const n = 100000
+	body := `{"jsonrpc":"2.0","id":7,"method":"test_count","params":[100000]}`
+	resp, err := http.Post(httpServer.URL, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	defer resp.Body.Close()
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("response not chunked: %v", resp.TransferEncoding)
+	}
+	var msg struct {
+		Version string `json:"jsonrpc"`
+		Id      int    `json:"id"`
+		Result  []int  `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if msg.Version != jsonrpcVersion || msg.Id != 7 || len(msg.Result) != n ||
+		msg.Result[n-1] != n-1 {
+		t.Fatalf("unexpected response %s %d %d", msg.Version, msg.Id, len(msg.Result))
+	}
+
+	// The transports which do not stream marshal the result.
+	client := DialInProc(server)
+	defer client.Close()
+	var result []int
+	if err := client.Call(&result, "test_count", 3); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if len(result) != 3 || result[2] != 2 {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
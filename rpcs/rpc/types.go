@@ -17,6 +17,7 @@
 package rpc
 
 import (
+	"context"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/common/hexutil"
 	"math"
@@ -35,6 +36,15 @@ type API struct {
 	Public    bool        // indication if the methods must be considered safe for public use
 }
 
+// MethodFilter is implemented by the services which refuse the calls of some
+// of their methods depending on their state.  FilterMethod is not exposed as
+// a method of the service.
+type MethodFilter interface {
+	// FilterMethod returns an error when the method, named as it is
+	// called, may not be called.
+	FilterMethod(method string) error
+}
+
 // callback is a method callback which was registered in the server
 type callback struct {
 	rcvr        reflect.Value  // receiver of method
@@ -43,6 +53,7 @@ type callback struct {
 	hasCtx      bool           // method's first argument is a context (not included in argTypes)
 	errPos      int            // err return idx, of -1 when method cannot return error
 	isSubscribe bool           // indication if the callback is a subscription
+	filter      MethodFilter   // filter of the receiver, nil when it has none
 }
 
 // service represents a registered object
@@ -74,8 +85,32 @@ type Server struct {
 	run      int32
 	codecsMu sync.Mutex
 	codecs   mapset.Set
+
+	// quotas limits the calls per API key, nil when API keys are disabled.
+	quotas *Quotas
+
+	// limits and conns restrict the clients served over HTTP and websocket.
+	limits HTTPLimits
+	conns  *connLimiter
+
+	// panicHandler is told about the panics of the callbacks.  It may be
+	// nil.
+	panicHandler PanicHandler
+
+	// callStats records the latency of the calls.  It may be nil.
+	callStats *CallStats
+
+	// ctx is the parent of the contexts of the served requests.  It is
+	// cancelled when the server stops so the callbacks still running
+	// abort their work.
+	ctx      context.Context
+	shutdown context.CancelFunc
 }
 
+// PanicHandler is called with the method, panic value and stack of a callback
+// which panicked.
+type PanicHandler func(method string, value interface{}, stack []byte)
+
 // rpcRequest represents a raw incoming RPC request
 type rpcRequest struct {
 	service  string
@@ -106,8 +106,9 @@ func formatName(name string) string {
 
 // suitableCallbacks iterates over the methods of the given type. It will determine if a method satisfies the criteria
 // for a RPC callback or a subscription callback and adds it to the collection of callbacks or subscriptions. See server
-// documentation for a summary of these criteria.
+// documentation for a summary of these criteria. The FilterMethod method of a MethodFilter receiver is not a callback.
 func suitableCallbacks(rcvr reflect.Value, typ reflect.Type) (callbacks, subscriptions) {
+	filter, _ := rcvr.Interface().(MethodFilter)
 	callbacks := make(callbacks)
 	subscriptions := make(subscriptions)
 
@@ -119,8 +120,12 @@ METHODS:
 		if method.PkgPath != "" { // method must be exported
 			continue
 		}
+		if filter != nil && method.Name == "FilterMethod" {
+			continue
+		}
 
 		var h callback
+		h.filter = filter
 		h.isSubscribe = isPubSub(mtype)
 		h.rcvr = rcvr
 		h.method = method
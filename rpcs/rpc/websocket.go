@@ -55,11 +55,26 @@ var websocketJSONCodec = websocket.Codec{
 // allowedOrigins should be a comma-separated list of allowed origin URLs.
 // To allow connections with any origin, pass "*".
 func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
+	validateOrigin := wsHandshakeValidator(allowedOrigins)
 	return websocket.Server{
-		Handshake: wsHandshakeValidator(allowedOrigins),
+		Handshake: func(cfg *websocket.Config, req *http.Request) error {
+			if err := validateOrigin(cfg, req); err != nil {
+				return err
+			}
+			_, err := srv.quotas.authenticate(req.Context(), req)
+			return err
+		},
 		Handler: func(conn *websocket.Conn) {
+			ip := srv.limits.clientIP(conn.Request())
+			if !srv.conns.acquire(ip) {
+				rpcLog.Debugf("Rejecting websocket connection from %s: %v", ip, errTooManyConns)
+				conn.Close()
+				return
+			}
+			defer srv.conns.release(ip)
+
 			// Create a custom encode/decode pair to enforce payload size and number encoding
-			conn.MaxPayloadBytes = maxRequestContentLength
+			conn.MaxPayloadBytes = int(srv.limits.maxRequestSize())
 
 			encoder := func(v interface{}) error {
 				return websocketJSONCodec.Send(conn, v)
@@ -67,7 +82,11 @@ func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 			decoder := func(v interface{}) error {
 				return websocketJSONCodec.Receive(conn, v)
 			}
-			srv.ServeCodec(NewCodec(conn, encoder, decoder), OptionMethodInvocation|OptionSubscriptions)
+			ctx, _ := srv.quotas.authenticate(context.Background(), conn.Request())
+			ctx = context.WithValue(ctx, clientCtxKey{}, ip)
+			codec := NewCodec(conn, encoder, decoder)
+			defer codec.Close()
+			srv.serveRequest(ctx, codec, false, OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
 }
@@ -8,7 +8,10 @@
 // a chain server.
 package rpcjson
 
-import "math/big"
+import (
+	"encoding/json"
+	"math/big"
+)
 
 
 // AddNodeSubCmd defines the type used in the addnode JSON-RPC command for the
@@ -45,6 +48,37 @@ type TransactionOutput struct {
 	ContractType string `json:"contracttype,omitempty"` //create call
 }
 
+// SweepOptions are the optional parameters of the sweepAddresses command.
+// Destinations maps the hex encoded assets to the addresses they are swept
+// to instead of the default destination.  GasPrice defaults to the minimum
+// relay price of the node, and MaxTxSize to the maximum standard transaction
+// size.
+type SweepOptions struct {
+	Destinations map[string]string `json:"destinations"`
+	GasPrice     *float64          `json:"gasprice"`
+	MaxTxSize    *int              `json:"maxtxsize"`
+}
+
+// AccessTuple declares an account along with storage slots of the account in
+// the access list of a transaction.
+type AccessTuple struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storagekeys"`
+}
+
+// StorageWitness carries the archived storage of a contract in the storage
+// witnesses of a transaction.  The keys are the hashes of the storage slots.
+type StorageWitness struct {
+	Address string         `json:"address"`
+	Entries []StorageEntry `json:"entries"`
+}
+
+// StorageEntry is a storage slot of a storage witness.
+type StorageEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 type TestCallData struct {
 	Name      string  `json:"name"`
 	Data      string  `json:"data"`
@@ -54,3 +88,123 @@ type TestCallData struct {
 	AmountB   big.Int `json:"amountb"`
 	VoteValue string  `json:"voteValue"`
 }
+
+// BanListEntry describes a banned host in the ban lists exchanged by the
+// exportBanList and importBanList commands and the remote ban feed.  The ban
+// expires at BannedUntil, in unix seconds.
+type BanListEntry struct {
+	Address     string `json:"address"`
+	BannedUntil int64  `json:"banneduntil"`
+	Reason      string `json:"reason"`
+}
+
+// SystemContractHash is the expected code hash of a system contract at a
+// height, checked by the verifySystemContracts command.  Name is the name or
+// the address of the system contract.
+type SystemContractHash struct {
+	Name     string `json:"name"`
+	Height   int32  `json:"height"`
+	CodeHash string `json:"codehash"`
+}
+
+// DeployContract describes the contract created by the deployContract command.
+// The template is given by its key, the transaction id in which it was
+// submitted, or by its category and name.  Args are the constructor arguments,
+// encoded by the node according to the ABI of the template.  The outputs are
+// appended to the creation output, typically to return the change.
+type DeployContract struct {
+	Inputs       []TransactionInput  `json:"inputs"`
+	Outputs      []TransactionOutput `json:"outputs"`
+	TemplateKey  string              `json:"templatekey"`
+	Category     uint16              `json:"category"`
+	TemplateName string              `json:"templatename"`
+	Args         []interface{}       `json:"args"`
+	Amount       int64               `json:"amount"`
+	Asset        string              `json:"asset"`
+	GasLimit     *int32              `json:"gaslimit"`
+}
+
+// ReadOnlyCall describes a read-only contract call of the multicall command.
+// The result of the call is decoded when Name and Abi are set.
+type ReadOnlyCall struct {
+	Caller   string `json:"caller"`
+	Contract string `json:"contract"`
+	Data     string `json:"data"`
+	Name     string `json:"name"`
+	Abi      string `json:"abi"`
+}
+
+// PageRequest selects a page of the items of a list command.  Cursor is the
+// NextCursor of the previous page, or empty for the first page.  Limit is the
+// maximum number of items of the page, zero selecting the default.
+type PageRequest struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+// LogFilter is the filter of the getLogs command, compatible with the filter
+// of eth_getLogs.  FromBlock and ToBlock are hex encoded heights or one of
+// earliest, latest and pending, and default to latest.  BlockHash selects a
+// single block instead of a range.  Each position of Topics matches one of
+// its topics, an empty position matching any topic.
+type LogFilter struct {
+	BlockHash *string      `json:"blockHash"`
+	FromBlock *string      `json:"fromBlock"`
+	ToBlock   *string      `json:"toBlock"`
+	Address   StringList   `json:"address"`
+	Topics    []StringList `json:"topics"`
+}
+
+// StringList is a list of strings which may also be encoded as a single
+// string, or as null for an empty list.
+type StringList []string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*l = nil
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// AccountingCommodity is the commodity an asset is booked as by the
+// exportAccounting command.
+type AccountingCommodity struct {
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"`
+}
+
+// AccountingMapping maps the postings of the exportAccounting command to the
+// accounts of a ledger.  Counterparties maps addresses to accounts and
+// Commodities maps hex encoded assets to commodities.  The unset accounts
+// and commodities keep their defaults.
+type AccountingMapping struct {
+	Wallet         string                         `json:"wallet"`
+	Income         string                         `json:"income"`
+	Expenses       string                         `json:"expenses"`
+	Fees           string                         `json:"fees"`
+	Counterparties map[string]string              `json:"counterparties"`
+	Commodities    map[string]AccountingCommodity `json:"commodities"`
+}
+
+// TemplateRequest is the optional request object of the getBlockTemplate
+// command.  Mode is either "template", the default, or "proposal".  In
+// template mode, a LongPollID returned by a previous call makes the command
+// wait until the template it describes is stale.  In proposal mode, Data
+// holds the hex encoded block to validate.
+type TemplateRequest struct {
+	Mode       string `json:"mode,omitempty"`
+	LongPollID string `json:"longpollid,omitempty"`
+	Data       string `json:"data,omitempty"`
+}
@@ -9,11 +9,71 @@ package rpcjson
 import (
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+	"github.com/AsimovNetwork/asimov/vm/fvm/params"
 )
 
 type CreateRawTransactionResult struct {
-	Hex          string            `json:"hex"`
-	ContractAddr map[uint64]string `json:"contractaddr"`
+	Hex          string              `json:"hex"`
+	ContractAddr map[uint64]string   `json:"contractaddr"`
+	Simulation   *TxSimulationResult `json:"simulation,omitempty"`
+}
+
+// TxSimulationResult models the predicted size, gas usage and fee of an
+// unsigned transaction returned by the createrawtransaction command when the
+// simulation is requested.
+type TxSimulationResult struct {
+	Size       int      `json:"size"`
+	GasLimit   uint32   `json:"gaslimit"`
+	GasUsed    uint64   `json:"gasused"`
+	Fee        int64    `json:"fee"`
+	GasPrice   float64  `json:"gasprice"`
+	FeePerByte float64  `json:"feeperbyte"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// DeployContractResult models the data returned by the deployContract command.
+type DeployContractResult struct {
+	TxID         string `json:"txid"`
+	Hex          string `json:"hex"`
+	ContractAddr string `json:"contractaddr"`
+}
+
+// DecodedValue models a value returned by a contract and decoded by the
+// decodeReturn command.
+type DecodedValue struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// MulticallResult models the result of a call of the multicall command.
+type MulticallResult struct {
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// MulticallReply models the data returned by the multicall command.  Height
+// and Hash identify the best block whose state the calls observed.
+type MulticallReply struct {
+	Height  int32             `json:"height"`
+	Hash    string            `json:"hash"`
+	Results []MulticallResult `json:"results"`
+}
+
+// GasScheduleResult models a gas schedule of the VM returned by the
+// getgasschedule command.
+type GasScheduleResult struct {
+	Name   string          `json:"name"`
+	Height uint64          `json:"height"`
+	Table  params.GasTable `json:"table"`
+}
+
+// GetGasScheduleResult models the data returned by the getgasschedule
+// command.  Next is the schedule activated after Height, if any.
+type GetGasScheduleResult struct {
+	Height int32              `json:"height"`
+	Active GasScheduleResult  `json:"active"`
+	Next   *GasScheduleResult `json:"next,omitempty"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -27,6 +87,23 @@ type GetRawMempoolVerboseResult struct {
 	Depends []string `json:"depends"`
 }
 
+// GetBlockTemplateResult models the data returned from the getBlockTemplate
+// command in template mode.  LongPollID identifies the chain tip and the
+// mempool state the template was built from.
+type GetBlockTemplateResult struct {
+	Data         string `json:"data"`
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previousblockhash"`
+	Height       int32  `json:"height"`
+	Round        uint32 `json:"round"`
+	SlotIndex    uint16 `json:"slotindex"`
+	CurTime      int64  `json:"curtime"`
+	GasLimit     uint64 `json:"gaslimit"`
+	GasUsed      uint64 `json:"gasused"`
+	Transactions int    `json:"transactions"`
+	LongPollID   string `json:"longpollid"`
+}
+
 // GetBlockTemplateResultAux models the coinbaseaux field of the
 // getblocktemplate command.
 type GetBlockTemplateResultAux struct {
@@ -177,12 +254,17 @@ type DecodeScriptResult struct {
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
-	Chain         string `json:"chain"`
-	Blocks        int32  `json:"blocks"`
-	BestBlockHash string `json:"bestblockhash"`
-	MedianTime    int64  `json:"mediantime"`
-	Round         int32  `json:"round"`
-	Slot          int16  `json:"slot"`
+	Chain          string `json:"chain"`
+	Blocks         int32  `json:"blocks"`
+	BestBlockHash  string `json:"bestblockhash"`
+	MedianTime     int64  `json:"mediantime"`
+	Round          int32  `json:"round"`
+	Slot           int16  `json:"slot"`
+	Paused         bool   `json:"paused"`
+	PauseReason    string `json:"pausereason,omitempty"`
+	ReadReplica    bool   `json:"readreplica,omitempty"`
+	SafeMode       bool   `json:"safemode"`
+	SafeModeReason string `json:"safemodereason,omitempty"`
 }
 
 type GetConsensusMiningInfoResult struct {
@@ -205,6 +287,18 @@ type GetSignUpStatusResult struct {
 	Balance     int64             `json:"balance"`
 }
 
+// GetKeyRotationResult models the data returned by the getKeyRotation command.
+// SignUp tells how to sign up the next key with the consensus contract.
+type GetKeyRotationResult struct {
+	Address     string                        `json:"address"`
+	NextAddress string                        `json:"nextAddress"`
+	Height      int32                         `json:"height"`
+	Active      bool                          `json:"active"`
+	Registered  bool                          `json:"registered"`
+	Contract    *GetConsensusMiningInfoResult `json:"contract"`
+	SignUp      *GetSignUpStatusResult        `json:"signUp"`
+}
+
 type GetMergeUtxoResult struct {
 	Asset string					`json:"asset"`
 	Value int64						`json:"value"`
@@ -218,6 +312,284 @@ type GetNetTotalsResult struct {
 	TimeMillis     int64  `json:"timemillis"`
 }
 
+// StateChildResult models a child of a state commitment.
+type StateChildResult struct {
+	Byte  byte   `json:"byte"`
+	Hash  string `json:"hash"`
+	Count int    `json:"count"`
+}
+
+// StateEntryResult models a chain state entry of a state commitment.
+type StateEntryResult struct {
+	Key       string `json:"key"`
+	Name      string `json:"name,omitempty"`
+	ValueHash string `json:"valuehash"`
+}
+
+// GetStateCommitmentResult models the data returned from the
+// getstatecommitment command.
+type GetStateCommitmentResult struct {
+	Kind      string             `json:"kind"`
+	BlockHash string             `json:"blockhash"`
+	Height    int32              `json:"height"`
+	Prefix    string             `json:"prefix"`
+	Hash      string             `json:"hash"`
+	Count     int                `json:"count"`
+	Children  []StateChildResult `json:"children,omitempty"`
+	Entries   []StateEntryResult `json:"entries,omitempty"`
+}
+
+// StateDiffResult models a chain state entry which differs between two nodes.
+// An empty hash means the entry does not exist on the node.
+type StateDiffResult struct {
+	Key    string `json:"key"`
+	Name   string `json:"name,omitempty"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// CompareStateResult models the data returned from the comparestate command.
+type CompareStateResult struct {
+	Kind        string            `json:"kind"`
+	BlockHash   string            `json:"blockhash"`
+	Height      int32             `json:"height"`
+	Match       bool              `json:"match"`
+	LocalCount  int               `json:"localcount"`
+	RemoteCount int               `json:"remotecount"`
+	Diffs       []StateDiffResult `json:"diffs,omitempty"`
+	Truncated   bool              `json:"truncated,omitempty"`
+}
+
+// ForensicDumpSummaryResult models an entry of the data returned from the
+// listforensicdumps command.
+type ForensicDumpSummaryResult struct {
+	BlockHash string `json:"blockhash"`
+	Height    int32  `json:"height"`
+	Time      int64  `json:"time"`
+	Reason    string `json:"reason"`
+}
+
+// GetCompactionInfoResult models the data returned from the
+// getcompactioninfo command.
+type GetCompactionInfoResult struct {
+	Running       bool    `json:"running"`
+	Database      string  `json:"database,omitempty"`
+	Progress      float64 `json:"progress"`
+	LastStart     int64   `json:"laststart"`
+	LastDuration  int64   `json:"lastduration"`
+	LastError     string  `json:"lasterror,omitempty"`
+	NextScheduled int64   `json:"nextscheduled"`
+}
+
+// GetRPCCacheInfoResult models the data returned from the getrpccacheinfo
+// command.
+type GetRPCCacheInfoResult struct {
+	Enabled bool   `json:"enabled"`
+	Entries int    `json:"entries"`
+	Size    int    `json:"size"`
+	MaxSize int    `json:"maxsize"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// SubsystemPanicsResult models a subsystem in the data returned from the
+// getsupervisorinfo command.
+type SubsystemPanicsResult struct {
+	Subsystem string `json:"subsystem"`
+	Panics    uint64 `json:"panics"`
+	Restarts  uint64 `json:"restarts"`
+	LastPanic int64  `json:"lastpanic"`
+	LastError string `json:"lasterror"`
+}
+
+// WorkerPoolResult models a worker pool in the data returned from the
+// getworkerpools and setworkerpoolsize commands.
+type WorkerPoolResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Size        int    `json:"size"`
+	DefaultSize int    `json:"defaultsize"`
+	Active      int    `json:"active"`
+}
+
+// ValidatorArrivalResult models the arrival delays of the blocks of a
+// validator in the data returned from the getblockarrivalstats command.  The
+// delays are in milliseconds.
+type ValidatorArrivalResult struct {
+	Validator   string `json:"validator"`
+	Blocks      int    `json:"blocks"`
+	LastHeight  int32  `json:"lastheight"`
+	MinDelay    int64  `json:"mindelay"`
+	MaxDelay    int64  `json:"maxdelay"`
+	MeanDelay   int64  `json:"meandelay"`
+	MedianDelay int64  `json:"mediandelay"`
+}
+
+// EstimateSmartFeeResult models the data returned from the estimateSmartFee
+// command.  GasPrice is unset and Errors explains why when no estimate is
+// available.  Blocks is the target of the estimate.
+type EstimateSmartFeeResult struct {
+	GasPrice *float64 `json:"gasprice,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Blocks   int32    `json:"blocks"`
+}
+
+// GetBlockArrivalStatsResult models the data returned from the
+// getblockarrivalstats command.
+type GetBlockArrivalStatsResult struct {
+	StartHeight int32                    `json:"startheight"`
+	EndHeight   int32                    `json:"endheight"`
+	Blocks      int                      `json:"blocks"`
+	Validators  []ValidatorArrivalResult `json:"validators"`
+}
+
+// ValidatorRoundResult models the performance of a validator in the data
+// returned from the getroundreport command.  Fullness is the mean ratio of the
+// gas used to the gas limit of its blocks, MeanDelay the mean arrival delay,
+// in milliseconds, of the Arrivals blocks whose arrival was recorded, and Fees
+// the asim fees collected by its blocks.
+type ValidatorRoundResult struct {
+	Validator string  `json:"validator"`
+	Expected  int     `json:"expected"`
+	Produced  int     `json:"produced"`
+	Missed    int     `json:"missed"`
+	Fullness  float64 `json:"fullness"`
+	Arrivals  int     `json:"arrivals"`
+	MeanDelay int64   `json:"meandelay"`
+	Fees      int64   `json:"fees"`
+}
+
+// GetRoundReportResult models the data returned from the getroundreport
+// command.
+type GetRoundReportResult struct {
+	Round       uint32                 `json:"round"`
+	StartHeight int32                  `json:"startheight"`
+	EndHeight   int32                  `json:"endheight"`
+	Blocks      int                    `json:"blocks"`
+	Validators  []ValidatorRoundResult `json:"validators"`
+}
+
+// ValidatorPenaltyResult models a penalty in the data returned from the
+// getvalidatorpenalties command.  Expires is the last round the penalty
+// applies to, or zero when it lasts until cleared.
+type ValidatorPenaltyResult struct {
+	Validator string   `json:"validator"`
+	Kind      string   `json:"kind"`
+	Mode      string   `json:"mode"`
+	Round     uint32   `json:"round"`
+	Expires   uint32   `json:"expires"`
+	Active    bool     `json:"active"`
+	Blocks    []string `json:"blocks"`
+	Reason    string   `json:"reason"`
+	Time      int64    `json:"time"`
+}
+
+// StateExportManifest models the manifest written along with a state dump by
+// the exportstate command.
+type StateExportManifest struct {
+	Version      int    `json:"version"`
+	Height       int32  `json:"height"`
+	BlockHash    string `json:"blockhash"`
+	StateRoot    string `json:"stateroot"`
+	Holdings     int    `json:"holdings"`
+	Accounts     int    `json:"accounts"`
+	StorageSlots int    `json:"storageslots"`
+	Size         int64  `json:"size"`
+	DumpHash     string `json:"dumphash"`
+}
+
+// ExportStateResult models the data returned from the exportstate command.
+type ExportStateResult struct {
+	StateExportManifest
+	DumpFile     string `json:"dumpfile"`
+	ManifestFile string `json:"manifestfile"`
+	ManifestHash string `json:"manifesthash"`
+}
+
+// DumpUtxoSetResult models the data returned from the dumputxoset command.
+type DumpUtxoSetResult struct {
+	Height    int32  `json:"height"`
+	BlockHash string `json:"blockhash"`
+	StateRoot string `json:"stateroot"`
+	Records   int    `json:"records"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	File      string `json:"file"`
+}
+
+// ReplicaSecondaryResult models a secondary in the data returned from the
+// getreplicationinfo command.
+type ReplicaSecondaryResult struct {
+	Addr      string `json:"addr"`
+	Height    int32  `json:"height"`
+	Connected int64  `json:"connected"`
+}
+
+// ReplicaPrimaryResult models the primary in the data returned from the
+// getreplicationinfo command.
+type ReplicaPrimaryResult struct {
+	Addr      string `json:"addr"`
+	Connected bool   `json:"connected"`
+	Height    int32  `json:"height"`
+	LastError string `json:"lasterror,omitempty"`
+}
+
+// GetReplicationInfoResult models the data returned from the
+// getreplicationinfo command.
+type GetReplicationInfoResult struct {
+	Listen      string                   `json:"listen,omitempty"`
+	Secondaries []ReplicaSecondaryResult `json:"secondaries"`
+	Primary     *ReplicaPrimaryResult    `json:"primary,omitempty"`
+}
+
+// RPCMethodUsageResult models the usage of a method in the data returned from
+// the getrpcusage command.
+type RPCMethodUsageResult struct {
+	Method string `json:"method"`
+	Today  uint64 `json:"today"`
+	Total  uint64 `json:"total"`
+	Quota  uint64 `json:"quota,omitempty"`
+}
+
+// RPCKeyUsageResult models the data returned from the getrpcusage command.
+type RPCKeyUsageResult struct {
+	Name     string                 `json:"name"`
+	Admin    bool                   `json:"admin"`
+	Calls    uint64                 `json:"calls"`
+	Rejected uint64                 `json:"rejected"`
+	Methods  []RPCMethodUsageResult `json:"methods"`
+}
+
+// RPCLatencyBucketResult models a bucket of the latency histogram of a method
+// in the data returned from the getrpcmetrics command.  The bucket of the
+// calls slower than all bounds has no bound.
+type RPCLatencyBucketResult struct {
+	MaxMs float64 `json:"maxms,omitempty"`
+	Calls uint64  `json:"calls"`
+}
+
+// RPCMethodMetricsResult models the data returned from the getrpcmetrics
+// command.
+type RPCMethodMetricsResult struct {
+	Method  string                   `json:"method"`
+	Calls   uint64                   `json:"calls"`
+	Errors  uint64                   `json:"errors"`
+	AvgMs   float64                  `json:"avgms"`
+	MaxMs   float64                  `json:"maxms"`
+	Buckets []RPCLatencyBucketResult `json:"buckets"`
+}
+
+// SlowCallResult models the data returned from the getslowlog command.
+type SlowCallResult struct {
+	Time       int64   `json:"time"`
+	Method     string  `json:"method"`
+	DurationMs float64 `json:"durationms"`
+	Params     string  `json:"params"`
+	Client     string  `json:"client,omitempty"`
+	APIKey     string  `json:"apikey,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
 // PrevOut represents previous output for an input Vin.
 type PrevOut struct {
 	Addresses []string `json:"addresses,omitempty"`
@@ -296,11 +668,24 @@ type SearchRawTransactionsResult struct {
 
 // TxRawDecodeResult models the data from the decoderawtransaction command.
 type TxRawDecodeResult struct {
-	Txid     string `json:"txid"`
-	Version  uint32 `json:"version"`
-	Locktime uint32 `json:"locktime"`
-	Vin      []Vin  `json:"vin"`
-	Vout     []Vout `json:"vout"`
+	Txid       string           `json:"txid"`
+	Version    uint32           `json:"version"`
+	Locktime   uint32           `json:"locktime"`
+	Vin        []Vin            `json:"vin"`
+	Vout       []Vout           `json:"vout"`
+	AccessList []AccessTuple    `json:"accesslist,omitempty"`
+	Witnesses  []StorageWitness `json:"witnesses,omitempty"`
+}
+
+// StorageRentResult models the data returned by the getstoragewitness
+// command.  Witness holds the archived storage of the contract, when it is
+// archived.
+type StorageRentResult struct {
+	Address  string          `json:"address"`
+	Touched  uint64          `json:"touched"`
+	Archived bool            `json:"archived"`
+	Root     string          `json:"root,omitempty"`
+	Witness  *StorageWitness `json:"witness,omitempty"`
 }
 
 type CallLogResult struct {
@@ -342,6 +727,18 @@ type ContractTemplateDetail struct {
 	Source       string `json:"source"`
 }
 
+// ContractTemplateMetadata models the metadata of a template returned by the
+// getContractTemplateMetadata command.
+type ContractTemplateMetadata struct {
+	Category     uint16 `json:"category"`
+	TemplateName string `json:"template_name"`
+	Key          string `json:"key"`
+	ByteCodeSize int    `json:"byte_code_size"`
+	ByteCodeHash string `json:"byte_code_hash"`
+	AbiSize      int    `json:"abi_size"`
+	SourceSize   int    `json:"source_size"`
+}
+
 type LockEntryResult struct {
 	Id     string	`json:"id"`
 	Amount int64	`json:"amount"`
@@ -362,6 +759,16 @@ type ListUnspentResult struct {
 	ListLockEntry []*LockEntryResult `json:"locks"`
 }
 
+// PageResult models a page of the items of a list command.  NextCursor
+// selects the next page and is empty on the last page.  TotalEstimate is the
+// number of items of all the pages when the query was made, and is omitted
+// when it is not known.
+type PageResult struct {
+	Items         interface{} `json:"items"`
+	NextCursor    string      `json:"nextcursor,omitempty"`
+	TotalEstimate int64       `json:"totalestimate,omitempty"`
+}
+
 type UnspentPageResult struct {
 	ListUnspent []*ListUnspentResult  `json:"utxos"`
 	Count       int32                 `json:"count"`
@@ -381,3 +788,241 @@ type GetBalancesResult struct {
 	Address string             `json:"address"`
 	Assets  []GetBalanceResult `json:"assets"`
 }
+
+// AssetBalanceResult models the balance of an asset of an address returned by
+// the getaddressbalances command.  Confirmed is the balance at the best block,
+// Locked the part of it locked by contracts, and the unconfirmed amounts are
+// received and spent by the transactions of the mempool.  The amounts of an
+// indivisible asset are numbers of units.
+type AssetBalanceResult struct {
+	Asset               string `json:"asset"`
+	Confirmed           string `json:"confirmed"`
+	UnconfirmedIncoming string `json:"unconfirmedincoming"`
+	UnconfirmedOutgoing string `json:"unconfirmedoutgoing"`
+	Locked              string `json:"locked"`
+}
+
+// AddressBalancesResult models the balances of an address returned by the
+// getaddressbalances command.
+type AddressBalancesResult struct {
+	Address string               `json:"address"`
+	Assets  []AssetBalanceResult `json:"assets"`
+}
+
+// GetAddressBalancesResult models the data returned by the
+// getaddressbalances command.  Height and Hash identify the best block the
+// confirmed balances are computed at.
+type GetAddressBalancesResult struct {
+	Height    int32                   `json:"height"`
+	Hash      string                  `json:"hash"`
+	Addresses []AddressBalancesResult `json:"addresses"`
+}
+
+// SweepTransactionResult models an unsigned sweep transaction returned by the
+// sweepAddresses command.  Inputs lists the outputs the transaction spends in
+// the order of its inputs, for the signer.  Size is the estimated size of the
+// signed transaction the gas limit and the fee are computed for.
+type SweepTransactionResult struct {
+	Hex      string             `json:"hex"`
+	Inputs   []TransactionInput `json:"inputs"`
+	Size     int                `json:"size"`
+	GasLimit uint32             `json:"gaslimit"`
+	Fee      int64              `json:"fee"`
+}
+
+// SweepAssetResult models the amount of an asset swept by the sweepAddresses
+// command, before the fees.  The amount of an indivisible asset is the number
+// of its units.
+type SweepAssetResult struct {
+	Asset       string `json:"asset"`
+	Destination string `json:"destination"`
+	Outputs     int    `json:"outputs"`
+	Amount      string `json:"amount"`
+}
+
+// SweepAddressesResult models the data returned by the sweepAddresses
+// command.  Skipped is the number of outputs of the addresses which are not
+// swept because they are not spendable yet, are already spent by the mempool
+// or are not pay-to-pubkey-hash outputs.
+type SweepAddressesResult struct {
+	Transactions []SweepTransactionResult `json:"transactions"`
+	Assets       []SweepAssetResult       `json:"assets"`
+	Fee          int64                    `json:"fee"`
+	Skipped      int                      `json:"skipped"`
+}
+
+// UtxoFragmentationResult models the fragmentation of the outputs of an
+// address returned by the getUtxoFragmentation command.  DustOutputs counts
+// the asim outputs worth less than three times the fee of spending them.
+// SpendFee is the fee of the inputs spending all the outputs and
+// ConsolidatedSpendFee the same once the outputs are consolidated into one
+// output per asset by ConsolidationTxs transactions paying ConsolidationFee.
+type UtxoFragmentationResult struct {
+	Address              string `json:"address"`
+	Outputs              int    `json:"outputs"`
+	Assets               int    `json:"assets"`
+	DustOutputs          int    `json:"dustoutputs"`
+	Skipped              int    `json:"skipped"`
+	SpendFee             int64  `json:"spendfee"`
+	ConsolidatedSpendFee int64  `json:"consolidatedspendfee"`
+	ConsolidationFee     int64  `json:"consolidationfee"`
+	ConsolidationTxs     int    `json:"consolidationtxs"`
+	Recommended          bool   `json:"recommended"`
+}
+
+// LockedUnspentResult models a locked output returned by the listLockUnspent
+// command.
+type LockedUnspentResult struct {
+	Txid string `json:"txid"`
+	Vout uint32 `json:"vout"`
+}
+
+// DepositWatchResult models a watched deposit address returned by the
+// listDepositAddresses command.
+type DepositWatchResult struct {
+	Address       string `json:"address"`
+	Confirmations int32  `json:"confirmations"`
+	URL           string `json:"url"`
+}
+
+// DepositResult models a deposit being confirmed returned by the
+// listDepositAddresses command.  Height and BlockHash are empty while the
+// deposit is unconfirmed.
+type DepositResult struct {
+	TxID          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Address       string `json:"address"`
+	Asset         string `json:"asset"`
+	Value         int64  `json:"value"`
+	BlockHash     string `json:"blockhash,omitempty"`
+	Height        int32  `json:"height,omitempty"`
+	Confirmations int32  `json:"confirmations"`
+}
+
+// ListDepositAddressesResult models the data returned by the
+// listDepositAddresses command.
+type ListDepositAddressesResult struct {
+	Watches  []DepositWatchResult `json:"watches"`
+	Deposits []DepositResult      `json:"deposits"`
+}
+
+// AssetAmountResult models an amount of an asset.
+type AssetAmountResult struct {
+	Value int64  `json:"value"`
+	Asset string `json:"asset"`
+}
+
+// ListTransactionsResult models a transaction of the listTransactions command
+// seen from the listed addresses.  Status is pending, confirmed or virtual
+// and Direction is receive, send or self.  Amounts is the net change of the
+// balance of the listed addresses by asset, without the fee they paid.
+// Counterparties are the other addresses paid by the listed addresses, or
+// paying them, and Contracts are the contracts called or created.
+type ListTransactionsResult struct {
+	Txid           string              `json:"txid"`
+	Status         string              `json:"status"`
+	BlockHash      string              `json:"blockhash,omitempty"`
+	Height         int32               `json:"height,omitempty"`
+	Confirmations  int64               `json:"confirmations"`
+	Time           int64               `json:"time,omitempty"`
+	Direction      string              `json:"direction"`
+	Addresses      []string            `json:"addresses"`
+	Counterparties []string            `json:"counterparties"`
+	Amounts        []AssetAmountResult `json:"amounts"`
+	Fee            []FeeResult         `json:"fee,omitempty"`
+	Contracts      []string            `json:"contracts,omitempty"`
+	Coinbase       bool                `json:"coinbase,omitempty"`
+}
+
+// PeerStatsResult models the long-term statistics of the peers of a network
+// group returned by the getPeerStats command.
+type PeerStatsResult struct {
+	Group      string  `json:"group"`
+	Sessions   uint32  `json:"sessions"`
+	Uptime     int64   `json:"uptime"`
+	Blocks     uint64  `json:"blocks"`
+	Invalid    uint64  `json:"invalid"`
+	LatencyP50 int64   `json:"latencyp50"`
+	LatencyP90 int64   `json:"latencyp90"`
+	LatencyP99 int64   `json:"latencyp99"`
+	LastSeen   int64   `json:"lastseen"`
+	Score      float64 `json:"score"`
+}
+
+// GetPeerInfoResult models the data returned from the getPeerInfo command.
+type GetPeerInfoResult struct {
+	ID             int32   `json:"id"`
+	Addr           string  `json:"addr"`
+	Services       string  `json:"services"`
+	RelayTxes      bool    `json:"relaytxes"`
+	LastSend       int64   `json:"lastsend"`
+	LastRecv       int64   `json:"lastrecv"`
+	BytesSent      uint64  `json:"bytessent"`
+	BytesRecv      uint64  `json:"bytesrecv"`
+	ConnTime       int64   `json:"conntime"`
+	TimeOffset     int64   `json:"timeoffset"`
+	PingTime       float64 `json:"pingtime"`
+	Version        uint32  `json:"version"`
+	SubVer         string  `json:"subver"`
+	Inbound        bool    `json:"inbound"`
+	StartingHeight int32   `json:"startingheight"`
+	CurrentHeight  int32   `json:"currentheight,omitempty"`
+	BanScore       int32   `json:"banscore"`
+	FeeFilter      int32   `json:"feefilter"`
+	ASN            uint32  `json:"asn,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SystemContractVersion models a version of a system contract returned by the
+// getSystemContracts command.
+type SystemContractVersion struct {
+	Height    int32 `json:"height"`
+	Active    bool  `json:"active"`
+	Scheduled bool  `json:"scheduled"`
+}
+
+// SystemContractResult models the data of a system contract returned by the
+// getSystemContracts command.
+type SystemContractResult struct {
+	Name     string                  `json:"name"`
+	Address  string                  `json:"address"`
+	CodeHash string                  `json:"codehash"`
+	CodeSize int                     `json:"codesize"`
+	Versions []SystemContractVersion `json:"versions"`
+}
+
+// ScheduledUpgradeResult models a scheduled system contract upgrade returned
+// by the getScheduledUpgrades command.
+type ScheduledUpgradeResult struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Height  int32  `json:"height"`
+	Blocks  int32  `json:"blocks"`
+}
+
+// VerifySystemContractResult models the verification of the code of a system
+// contract returned by the verifySystemContracts command.
+type VerifySystemContractResult struct {
+	Name     string `json:"name"`
+	Height   int32  `json:"height"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Match    bool   `json:"match"`
+}
+
+// DiffSystemContractResult models the comparison of a local system contract
+// template with the code on chain returned by the diffSystemContract command.
+// FirstDiff is the offset of the first differing byte, or -1 when the codes
+// match.  Contained is set when the code on chain is part of the local code,
+// such as the runtime code of a creation code.
+type DiffSystemContractResult struct {
+	Name        string `json:"name"`
+	OnChainHash string `json:"onchainhash"`
+	LocalHash   string `json:"localhash"`
+	OnChainSize int    `json:"onchainsize"`
+	LocalSize   int    `json:"localsize"`
+	Match       bool   `json:"match"`
+	Contained   bool   `json:"contained"`
+	FirstDiff   int    `json:"firstdiff"`
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Copyright (c) 2014-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// NOTE: This file is intended to house the notifications sent to the
+// websocket clients of a chain server.
+
+package rpcjson
+
+// These constants define the events of the websocket notifications.
+const (
+	// BlockConnectedNtfnEvent is the event of a block connected to the
+	// main chain.
+	BlockConnectedNtfnEvent = "blockconnected"
+
+	// BlockDisconnectedNtfnEvent is the event of a block disconnected from
+	// the main chain.
+	BlockDisconnectedNtfnEvent = "blockdisconnected"
+
+	// RecvTxNtfnEvent is the event of a transaction paying a watched
+	// address.
+	RecvTxNtfnEvent = "recvtx"
+
+	// RedeemingTxNtfnEvent is the event of a transaction spending a
+	// watched outpoint.
+	RedeemingTxNtfnEvent = "redeemingtx"
+)
+
+// OutPoint describes a transaction outpoint watched by the notifyspent
+// subscription.
+type OutPoint struct {
+	Hash  string `json:"hash"`
+	Index uint32 `json:"index"`
+}
+
+// BlockNtfn models the notifications of the notifyblocks subscription.
+type BlockNtfn struct {
+	Event   string `json:"event"`
+	Hash    string `json:"hash"`
+	Height  int32  `json:"height"`
+	Time    int64  `json:"time"`
+	TxCount int    `json:"txcount"`
+}
+
+// TxAcceptedNtfn models the notifications of the notifynewtransactions
+// subscription.  Hex is only set for verbose subscriptions.
+type TxAcceptedNtfn struct {
+	TxID string `json:"txid"`
+	Size int    `json:"size"`
+	Hex  string `json:"hex,omitempty"`
+}
+
+// BlockDetails describes the block which includes a transaction of a
+// notification.  Index is the position of the transaction in the block.
+type BlockDetails struct {
+	Hash   string `json:"hash"`
+	Height int32  `json:"height"`
+	Index  int    `json:"index"`
+	Time   int64  `json:"time"`
+}
+
+// RelevantTxNtfn models the notifications of the notifyreceived and
+// notifyspent subscriptions.  Block is nil for the transactions accepted to
+// the mempool.
+type RelevantTxNtfn struct {
+	Event string        `json:"event"`
+	TxID  string        `json:"txid"`
+	Hex   string        `json:"hex"`
+	Block *BlockDetails `json:"block,omitempty"`
+}
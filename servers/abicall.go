@@ -0,0 +1,127 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/vm/fvm/abi"
+)
+
+// resolveABI parses the passed ABI definition.  Instead of a JSON definition,
+// the key of a template may be passed to use the ABI of the template.
+func (s *PublicRpcAPI) resolveABI(abiStr string) (*abi.ABI, error) {
+	if !strings.HasPrefix(strings.TrimSpace(abiStr), "[") {
+		template, ok := getTemplateInfoByKey(abiStr, s)
+		if !ok {
+			return nil, internalRPCError("error:template not found", "")
+		}
+		abiStr = template.Abi
+	}
+	definition, err := abi.JSON(strings.NewReader(abiStr))
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid abi: " + err.Error(),
+		}
+	}
+	return &definition, nil
+}
+
+// abiMethodArguments returns the inputs or the outputs of a method of the
+// definition, the constructor when the name is empty.
+func abiMethodArguments(definition *abi.ABI, name string, outputs bool) (abi.Arguments, error) {
+	if name == "" {
+		if outputs {
+			return nil, nil
+		}
+		return definition.Constructor.Inputs, nil
+	}
+	method, ok := definition.Methods[name]
+	if !ok {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Method not found: " + name,
+		}
+	}
+	if outputs {
+		return method.Outputs, nil
+	}
+	return method.Inputs, nil
+}
+
+// EncodeCall encodes a call to a method of a contract, the constructor when the
+// method is empty, from arguments given as JSON values.  The abi is a JSON ABI
+// definition or the key of the template defining it.  Integers are given as
+// decimal or hexadecimal strings, addresses and bytes as hexadecimal strings
+// and arrays as JSON arrays.  It returns the hex-encoded call data.
+func (s *PublicRpcAPI) EncodeCall(abiStr string, method string, args []interface{}) (interface{}, error) {
+	definition, err := s.resolveABI(abiStr)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := abiMethodArguments(definition, method, false)
+	if err != nil {
+		return nil, err
+	}
+	values, err := abi.ParseArguments(inputs, args)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	data, err := definition.Pack(method, values...)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return hexutil.Encode(data), nil
+}
+
+// DecodeReturn decodes the hex-encoded data returned by a method of a contract
+// according to the ABI, a JSON ABI definition or the key of the template
+// defining it.  The values are formatted the way EncodeCall accepts them.
+func (s *PublicRpcAPI) DecodeReturn(abiStr string, method string, data string) (interface{}, error) {
+	definition, err := s.resolveABI(abiStr)
+	if err != nil {
+		return nil, err
+	}
+	if method == "" {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Constructors return no value",
+		}
+	}
+	outputs, err := abiMethodArguments(definition, method, true)
+	if err != nil {
+		return nil, err
+	}
+	dataBytes, err := hexutil.Decode(data)
+	if err != nil {
+		return nil, rpcDecodeHexError(data)
+	}
+	values, err := outputs.UnpackValues(dataBytes)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Failed to decode the returned data: " + err.Error(),
+		}
+	}
+	formatted := abi.FormatValues(outputs, values)
+	result := make([]rpcjson.DecodedValue, len(formatted))
+	for i, output := range outputs.NonIndexed() {
+		result[i] = rpcjson.DecodedValue{
+			Name:  output.Name,
+			Type:  output.Type.String(),
+			Value: formatted[i],
+		}
+	}
+	return result, nil
+}
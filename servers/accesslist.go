@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// decodeAccessList decodes the access list of a transaction given to an RPC.
+func decodeAccessList(list []rpcjson.AccessTuple) ([]protos.AccessTuple, error) {
+	decoded := make([]protos.AccessTuple, len(list))
+	for i, tuple := range list {
+		addr, err := hexutil.Decode(tuple.Address)
+		if err != nil || len(addr) != common.AddressLength {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid access list address: " + tuple.Address,
+			}
+		}
+		decoded[i].Address = common.BytesToAddress(addr)
+		decoded[i].StorageKeys = make([]common.Hash, len(tuple.StorageKeys))
+		for j, key := range tuple.StorageKeys {
+			keyBytes, err := hexutil.Decode(key)
+			if err != nil || len(keyBytes) != common.HashLength {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCInvalidParameter,
+					Message: "Invalid access list storage key: " + key,
+				}
+			}
+			decoded[i].StorageKeys[j] = common.BytesToHash(keyBytes)
+		}
+	}
+	return decoded, nil
+}
+
+// encodeAccessList encodes the access list of a transaction for an RPC reply.
+func encodeAccessList(list []protos.AccessTuple) []rpcjson.AccessTuple {
+	encoded := make([]rpcjson.AccessTuple, len(list))
+	for i, tuple := range list {
+		encoded[i].Address = hexutil.Encode(tuple.Address[:])
+		encoded[i].StorageKeys = make([]string, len(tuple.StorageKeys))
+		for j, key := range tuple.StorageKeys {
+			encoded[i].StorageKeys[j] = hexutil.Encode(key[:])
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/accounting"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// accountingMapping returns the accounting mapping of the passed parameter,
+// with the defaults of the unset accounts and commodities.
+func accountingMapping(param *rpcjson.AccountingMapping) *accounting.Mapping {
+	if param == nil {
+		return accounting.DefaultMapping()
+	}
+	m := &accounting.Mapping{
+		Wallet:         param.Wallet,
+		Income:         param.Income,
+		Expenses:       param.Expenses,
+		Fees:           param.Fees,
+		Counterparties: param.Counterparties,
+		Commodities:    make(map[string]accounting.Commodity, len(param.Commodities)),
+	}
+	for asset, commodity := range param.Commodities {
+		m.Commodities[asset] = accounting.Commodity{
+			Name:     commodity.Name,
+			Decimals: commodity.Decimals,
+		}
+	}
+	return m.WithDefaults()
+}
+
+// accountingTransaction returns the accounting record of a confirmed
+// transaction of the history.
+func accountingTransaction(result *rpcjson.ListTransactionsResult) accounting.Transaction {
+	tx := accounting.Transaction{
+		Txid:           result.Txid,
+		Time:           time.Unix(result.Time, 0),
+		Direction:      result.Direction,
+		Counterparties: result.Counterparties,
+	}
+	for _, amount := range result.Amounts {
+		tx.Amounts = append(tx.Amounts, accounting.Amount{
+			Value: amount.Value,
+			Asset: amount.Asset,
+		})
+	}
+	for _, fee := range result.Fee {
+		tx.Fees = append(tx.Fees, accounting.Amount{
+			Value: fee.Value,
+			Asset: fee.Asset,
+		})
+	}
+	return tx
+}
+
+// ExportAccounting exports the history of the passed addresses, or of the
+// watched deposit addresses when none is passed, as double-entry accounting
+// records in the beancount or csv format.  The mapping sets the accounts and
+// the commodities of the assets.  The records are returned in pages of the
+// history, as the listTransactions command, whose items are the text of the
+// records of the page.  The first page opens the accounts, or starts with the
+// csv header.  The unconfirmed transactions are not exported.
+func (s *PublicRpcAPI) ExportAccounting(ctx context.Context, format string, addresses []string,
+	mapping *rpcjson.AccountingMapping, page *rpcjson.PageRequest) (interface{}, error) {
+
+	if format != "beancount" && format != "csv" {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Unknown export format " + format + ", expected beancount or csv",
+		}
+	}
+
+	items, pageResult, err := s.transactionHistory(ctx, addresses, page,
+		"exportaccounting")
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]accounting.Transaction, 0, len(items))
+	for _, item := range items {
+		if item.Status != "pending" {
+			txs = append(txs, accountingTransaction(item))
+		}
+	}
+
+	first := page == nil || page.Cursor == ""
+	m := accountingMapping(mapping)
+	var buf bytes.Buffer
+	if format == "csv" {
+		err = accounting.WriteCSV(&buf, txs, m, first)
+	} else {
+		var opened *time.Time
+		if first {
+			genesis, err := s.cfg.Chain.FetchHeader(s.cfg.ChainParams.GenesisHash)
+			if err != nil {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCBlockHeaderNotFound,
+					Message: "Failed to obtain genesis block header",
+				}
+			}
+			t := time.Unix(genesis.Timestamp, 0)
+			opened = &t
+		}
+		err = accounting.WriteBeancount(&buf, txs, m, opened)
+	}
+	if err != nil {
+		context := "Failed to export accounting records"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	pageResult.Items = buf.String()
+	return pageResult, nil
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/alert"
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/database"
+)
+
+const (
+	// alertCheckInterval is the interval between two checks of the
+	// monitored operational conditions.
+	alertCheckInterval = time.Minute
+
+	// alertStartupGrace is the duration after startup during which the
+	// peer count is not checked, giving the node time to connect.
+	alertStartupGrace = time.Minute * 5
+)
+
+// alertSlot is the slot of a connected block forwarded to the alert monitor.
+type alertSlot struct {
+	roundSlot
+
+	// dropped is the number of slots dropped before this one, so the
+	// monitor knows the blocks it did not see.
+	dropped uint32
+}
+
+// newAlertManager returns an alert manager sending to the channels
+// configured by the passed configuration, or nil when none is configured.
+func newAlertManager(cfg *chaincfg.FConfig) *alert.Manager {
+	var channels []alert.Channel
+	for _, url := range cfg.AlertSlackWebhooks {
+		channels = append(channels, alert.NewSlackChannel(url))
+	}
+	if cfg.AlertSMTPServer != "" {
+		channels = append(channels, &alert.SMTPChannel{
+			Server: cfg.AlertSMTPServer,
+			User:   cfg.AlertSMTPUser,
+			Pass:   cfg.AlertSMTPPass,
+			From:   cfg.AlertEmailFrom,
+			To:     cfg.AlertEmailTo,
+		})
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	node, _ := os.Hostname()
+	return alert.New(&alert.Config{
+		Node:        node,
+		Channels:    channels,
+		MinInterval: cfg.AlertInterval,
+	})
+}
+
+// handleAlertNotification forwards the round and slot of the connected blocks
+// to the alert monitor which checks for missed slots of the local validator.
+// The chain notification callback never blocks on the monitor: the slots are
+// dropped and counted when it falls behind.
+func (s *NodeServer) handleAlertNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) == 0 {
+		return
+	}
+	block, ok := data[0].(*asiutil.Block)
+	if !ok {
+		return
+	}
+	header := &block.MsgBlock().Header
+	slot := alertSlot{
+		roundSlot: roundSlot{header.Round, header.SlotIndex},
+		dropped:   atomic.LoadUint32(&s.alertSlotsDropped),
+	}
+	select {
+	case s.alertSlots <- slot:
+	default:
+		atomic.AddUint32(&s.alertSlotsDropped, 1)
+	}
+}
+
+// checkMissedSlots raises an alert for every slot of the local validator
+// between the previous and the current block which produced no block.
+func (s *NodeServer) checkMissedSlots(prev, cur roundSlot) {
+	for _, rs := range missedSlots(prev, cur, chaincfg.ActiveNetParams.RoundSize) {
+		validators, _, err := s.chain.GetValidators(rs.round)
+		if err != nil || int(rs.slot) >= len(validators) {
+			continue
+		}
+		if *validators[rs.slot] == *s.alertValidator {
+			s.alerts.Raise(alert.CondMissedSlot, alert.SevCritical,
+				"validator %v missed slot %d of round %d",
+				s.alertValidator, rs.slot, rs.round)
+		}
+	}
+}
+
+// checkDiskSpace raises an alert when a data directory runs out of space.
+func (s *NodeServer) checkDiskSpace() {
+	minFree := chaincfg.Cfg.AlertMinDiskSpace * 1024 * 1024
+	for _, dir := range []string{chaincfg.Cfg.DataDir, chaincfg.Cfg.StateDir} {
+		free, _, err := asiutil.DiskSpace(dir)
+		if err != nil {
+			srvrLog.Debugf("Unable to query disk space of %s: %v", dir, err)
+			continue
+		}
+		if free < minFree {
+			s.alerts.Raise(alert.CondDiskSpace, alert.SevCritical,
+				"only %d MB free in %s", free/1024/1024, dir)
+			return
+		}
+	}
+	s.alerts.Resolve(alert.CondDiskSpace, "disk space recovered")
+}
+
+// checkDatabase raises an alert when the block database can not be read.
+func (s *NodeServer) checkDatabase() {
+	best := s.chain.BestSnapshot()
+	err := s.db.View(func(dbTx database.Tx) error {
+		_, err := dbTx.FetchBlockHeader(database.NewNormalBlockKey(&best.Hash))
+		return err
+	})
+	if err != nil {
+		s.alerts.Raise(alert.CondDatabase, alert.SevCritical,
+			"unable to read best block %v: %v", best.Hash, err)
+		return
+	}
+	s.alerts.Resolve(alert.CondDatabase, "database reads succeed again")
+}
+
+// checkSafeMode raises an alert while the chain is in safe mode.
+func (s *NodeServer) checkSafeMode() {
+	if safeMode, reason := s.chain.SafeMode(); safeMode {
+		s.alerts.Raise(alert.CondSafeMode, alert.SevCritical,
+			"chain in safe mode: %s", reason)
+		return
+	}
+	s.alerts.Resolve(alert.CondSafeMode, "safe mode acknowledged")
+}
+
+// alertMonitor periodically checks the operational conditions and raises the
+// corresponding alerts.  It must be run with goSupervised.
+func (s *NodeServer) alertMonitor() {
+	ticker := time.NewTicker(alertCheckInterval)
+	defer ticker.Stop()
+
+	var prevSlot *roundSlot
+	var dropped uint32
+	lastHeight := s.chain.BestSnapshot().Height
+	lastChange := time.Now()
+out:
+	for {
+		select {
+		case cur := <-s.alertSlots:
+			// The slots of the dropped blocks would be taken as
+			// missed, so the check is skipped across them.
+			if cur.dropped != dropped {
+				srvrLog.Warnf("Skipped the missed slot check of %d "+
+					"blocks connected faster than they were "+
+					"checked", cur.dropped-dropped)
+				dropped = cur.dropped
+			} else if prevSlot != nil && s.alertValidator != nil &&
+				s.chain.IsCurrent() {
+
+				s.checkMissedSlots(*prevSlot, cur.roundSlot)
+			}
+			prevSlot = &cur.roundSlot
+
+		case <-ticker.C:
+			best := s.chain.BestSnapshot()
+			if best.Height != lastHeight {
+				lastHeight = best.Height
+				lastChange = time.Now()
+				s.alerts.Resolve(alert.CondStuckSync,
+					"best block advanced to height %d", best.Height)
+			} else if stuck := time.Since(lastChange); stuck > chaincfg.Cfg.AlertStuckSync {
+				s.alerts.Raise(alert.CondStuckSync, alert.SevWarning,
+					"best block %v at height %d unchanged for %v",
+					best.Hash, best.Height, stuck.Round(time.Second))
+			}
+
+			// Query the peer count without blocking shutdown since the
+			// peer handler may already be gone.
+			replyChan := make(chan int32, 1)
+			select {
+			case s.query <- getConnCountMsg{reply: replyChan}:
+			case <-s.quit:
+				break out
+			}
+			peers := <-replyChan
+			uptime := time.Since(time.Unix(s.startupTime, 0))
+			if uptime > alertStartupGrace && int(peers) < chaincfg.Cfg.AlertMinPeers {
+				s.alerts.Raise(alert.CondPeerCount, alert.SevWarning,
+					"only %d peers connected", peers)
+			} else if int(peers) >= chaincfg.Cfg.AlertMinPeers {
+				s.alerts.Resolve(alert.CondPeerCount,
+					"%d peers connected", peers)
+			}
+
+			s.checkDiskSpace()
+			s.checkDatabase()
+			s.checkSafeMode()
+
+		case <-s.quit:
+			break out
+		}
+	}
+}
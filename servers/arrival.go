@@ -0,0 +1,69 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"time"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// defaultArrivalStatsBlocks is the number of blocks summarized by
+	// getblockarrivalstats when no count is passed.
+	defaultArrivalStatsBlocks = 1000
+
+	// maxArrivalStatsBlocks is the maximum number of blocks summarized by
+	// getblockarrivalstats.
+	maxArrivalStatsBlocks = 100000
+)
+
+// GetBlockArrivalStats summarizes, per validator, the delays between the
+// timestamps of the last count main chain blocks and their arrival at the
+// node.  Large positive delays point to slow propagation or a validator clock
+// running behind, negative delays to a validator clock running ahead.
+func (s *PublicRpcAPI) GetBlockArrivalStats(count *int32) (interface{}, error) {
+	blocks := int32(defaultArrivalStatsBlocks)
+	if count != nil {
+		blocks = *count
+	}
+	if blocks <= 0 || blocks > maxArrivalStatsBlocks {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Count must be between 1 and 100000",
+		}
+	}
+
+	endHeight := s.cfg.Chain.BestSnapshot().Height
+	startHeight := endHeight - blocks + 1
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	arrivals, err := s.cfg.Chain.BlockArrivals(startHeight, endHeight)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to load block arrivals")
+	}
+
+	summaries := blockchain.SummarizeArrivals(arrivals)
+	result := &rpcjson.GetBlockArrivalStatsResult{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		Blocks:      len(arrivals),
+		Validators:  make([]rpcjson.ValidatorArrivalResult, 0, len(summaries)),
+	}
+	for _, summary := range summaries {
+		result.Validators = append(result.Validators, rpcjson.ValidatorArrivalResult{
+			Validator:   summary.Validator.String(),
+			Blocks:      summary.Blocks,
+			LastHeight:  summary.LastHeight,
+			MinDelay:    int64(summary.Min / time.Millisecond),
+			MaxDelay:    int64(summary.Max / time.Millisecond),
+			MeanDelay:   int64(summary.Mean / time.Millisecond),
+			MedianDelay: int64(summary.Median / time.Millisecond),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/addrmgr"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// netGroup returns the key of the group the outbound peers are diversified
+// across.  It is the AS of the address when it is known from the AS map, and
+// the network group of the address otherwise.
+func (s *NodeServer) netGroup(na *protos.NetAddress) string {
+	if asn := s.asMap.Lookup(na.IP); asn != 0 {
+		return fmt.Sprintf("as%d", asn)
+	}
+	return addrmgr.GroupKey(na)
+}
+
+// ASN returns the AS of the peer according to the AS map, or 0 when it is
+// unknown.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) ASN() uint32 {
+	sp := (*serverPeer)(p)
+	na := sp.NA()
+	if na == nil {
+		return 0
+	}
+	return sp.server.asMap.Lookup(na.IP)
+}
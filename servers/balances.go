@@ -0,0 +1,237 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+const (
+	// maxBalanceAddresses is the maximum number of addresses of a
+	// getaddressbalances request.
+	maxBalanceAddresses = 100
+
+	// maxBalanceAttempts is the number of times the balances are fetched
+	// again when the best block changes meanwhile.
+	maxBalanceAttempts = 3
+)
+
+// assetBalance accumulates the balance of an asset of an address.
+type assetBalance struct {
+	confirmed int64
+	incoming  int64
+	outgoing  int64
+	locked    int64
+}
+
+// pendingOutput is an output of the mempool paying a requested address.
+type pendingOutput struct {
+	address string
+	asset   protos.Asset
+	units   int64
+}
+
+// balanceUnits returns the amount an output adds to a balance.  The amount of
+// an output of an indivisible asset is the id of the unit, so the units are
+// counted instead.
+func balanceUnits(asset *protos.Asset, amount int64) int64 {
+	if asset.IsIndivisible() {
+		return 1
+	}
+	return amount
+}
+
+// lockedUnits returns the amount of an output locked by contracts.  The votes
+// locking an output lock the same coins, so the output is only locked for the
+// largest amount.
+func lockedUnits(entry *txo.UtxoEntry) int64 {
+	if entry.LockItem() == nil {
+		return 0
+	}
+	locked := int64(0)
+	for _, lockEntry := range entry.LockItem().EntriesList() {
+		if lockEntry.Amount > locked {
+			locked = lockEntry.Amount
+		}
+	}
+	if locked > entry.Amount() {
+		locked = entry.Amount()
+	}
+	if locked > 0 && entry.Asset().IsIndivisible() {
+		return 1
+	}
+	return locked
+}
+
+// GetAddressBalances returns the balances of every asset of the passed
+// addresses: the confirmed balance at the best block, the part of it locked
+// by contracts, and the amounts received and spent by the transactions of the
+// mempool.  The confirmed balances of all the addresses are read at the same
+// best block, which is returned along.
+func (s *PublicRpcAPI) GetAddressBalances(ctx context.Context, addresses []string) (interface{}, error) {
+	if len(addresses) > maxBalanceAddresses {
+		return nil, &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Too many addresses: %d, at most %d",
+				len(addresses), maxBalanceAddresses),
+		}
+	}
+	keys := make([]string, len(addresses))
+	for i, address := range addresses {
+		addr, err := hexutil.Decode(address)
+		if err != nil || len(addr) != common.AddressLength {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address: " + address,
+			}
+		}
+		keys[i] = string(addr)
+	}
+
+	for attempt := 0; attempt < maxBalanceAttempts; attempt++ {
+		if ctx.Err() != nil {
+			return nil, rpcCancelledError(ctx)
+		}
+		best := s.cfg.Chain.BestSnapshot()
+		views := make(map[string]*txo.UtxoViewpoint, len(keys))
+		for _, key := range keys {
+			if _, ok := views[key]; ok {
+				continue
+			}
+			view := txo.NewUtxoViewpoint()
+			_, err := s.cfg.Chain.FetchUtxoViewByAddress(view, []byte(key))
+			if err != nil {
+				return nil, internalRPCError(err.Error(), "Failed to fetch balance")
+			}
+			views[key] = view
+		}
+		descs := s.cfg.TxMemPool.TxDescs()
+
+		// The balances are fetched again when a block connected while the
+		// views were fetched, since they would not match.
+		if s.cfg.Chain.BestSnapshot().Hash != best.Hash {
+			continue
+		}
+
+		balances := addressBalances(views, descs)
+		result := &rpcjson.GetAddressBalancesResult{
+			Height:    best.Height,
+			Hash:      best.Hash.String(),
+			Addresses: make([]rpcjson.AddressBalancesResult, len(addresses)),
+		}
+		for i, address := range addresses {
+			result.Addresses[i] = rpcjson.AddressBalancesResult{
+				Address: address,
+				Assets:  assetBalanceResults(balances[keys[i]]),
+			}
+		}
+		return result, nil
+	}
+	return nil, internalRPCError("the best block kept changing",
+		"Failed to fetch balance")
+}
+
+// addressBalances computes the balances of the addresses from their confirmed
+// outputs and the transactions of the mempool.  The transactions of a block
+// the mempool was not yet updated with are recognized by their outputs being
+// confirmed already, and are skipped.
+func addressBalances(views map[string]*txo.UtxoViewpoint,
+	descs []*mining.TxDesc) map[string]map[protos.Asset]*assetBalance {
+
+	balances := make(map[string]map[protos.Asset]*assetBalance, len(views))
+	balance := func(address string, asset protos.Asset) *assetBalance {
+		assets := balances[address]
+		if assets == nil {
+			assets = make(map[protos.Asset]*assetBalance)
+			balances[address] = assets
+		}
+		b := assets[asset]
+		if b == nil {
+			b = new(assetBalance)
+			assets[asset] = b
+		}
+		return b
+	}
+
+	confirmed := make(map[protos.OutPoint]pendingOutput)
+	for address, view := range views {
+		balances[address] = make(map[protos.Asset]*assetBalance)
+		for out, entry := range view.Entries() {
+			if entry == nil || entry.IsSpent() {
+				continue
+			}
+			asset := *entry.Asset()
+			units := balanceUnits(&asset, entry.Amount())
+			b := balance(address, asset)
+			b.confirmed += units
+			b.locked += lockedUnits(entry)
+			confirmed[out] = pendingOutput{address: address, asset: asset, units: units}
+		}
+	}
+
+	pending := make(map[protos.OutPoint]pendingOutput)
+	for _, desc := range descs {
+		for i, txOut := range desc.Tx.MsgTx().TxOut {
+			_, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript)
+			if err != nil || len(addrs) == 0 {
+				continue
+			}
+			address := string(addrs[0].ScriptAddress())
+			if _, ok := views[address]; !ok {
+				continue
+			}
+			out := protos.OutPoint{Hash: *desc.Tx.Hash(), Index: uint32(i)}
+			if _, ok := confirmed[out]; ok {
+				continue
+			}
+			units := balanceUnits(&txOut.Asset, txOut.Value)
+			pending[out] = pendingOutput{address: address, asset: txOut.Asset, units: units}
+			balance(address, txOut.Asset).incoming += units
+		}
+	}
+	for _, desc := range descs {
+		for _, txIn := range desc.Tx.MsgTx().TxIn {
+			spent, ok := confirmed[txIn.PreviousOutPoint]
+			if !ok {
+				spent, ok = pending[txIn.PreviousOutPoint]
+			}
+			if ok {
+				balance(spent.address, spent.asset).outgoing += spent.units
+			}
+		}
+	}
+	return balances
+}
+
+// assetBalanceResults converts the balances of an address to their rpc model,
+// sorted by asset.
+func assetBalanceResults(assets map[protos.Asset]*assetBalance) []rpcjson.AssetBalanceResult {
+	results := make([]rpcjson.AssetBalanceResult, 0, len(assets))
+	for asset, b := range assets {
+		results = append(results, rpcjson.AssetBalanceResult{
+			Asset:               hex.EncodeToString(asset.Bytes()),
+			Confirmed:           strconv.FormatInt(b.confirmed, 10),
+			UnconfirmedIncoming: strconv.FormatInt(b.incoming, 10),
+			UnconfirmedOutgoing: strconv.FormatInt(b.outgoing, 10),
+			Locked:              strconv.FormatInt(b.locked, 10),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Asset < results[j].Asset
+	})
+	return results
+}
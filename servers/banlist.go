@@ -0,0 +1,449 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// banFeedTimeout is the timeout of a request fetching the ban feed.
+	banFeedTimeout = time.Second * 30
+
+	// maxBanFeedSize is the maximum size of the ban feed document.
+	maxBanFeedSize = 4 * 1024 * 1024
+
+	// maxMisbehavingHosts is the number of misbehaving hosts above which
+	// the hosts whose misbehavior window elapsed are forgotten.
+	maxMisbehavingHosts = 1000
+)
+
+// banEntry describes the ban of a host.
+type banEntry struct {
+	until  time.Time
+	reason string
+}
+
+// hostMisbehavior is the sum of the ban scores of the past connections of a
+// host within the misbehavior window.
+type hostMisbehavior struct {
+	score uint32
+	last  time.Time
+}
+
+// getBanListMsg requests the banned hosts from the peer handler.
+type getBanListMsg struct {
+	reply chan map[string]banEntry
+}
+
+// addBansMsg bans the passed hosts from the peer handler.
+type addBansMsg struct {
+	bans  map[string]banEntry
+	reply chan int
+}
+
+// removeBansMsg lifts the bans of the passed hosts, or of all the hosts when
+// none is passed, from the peer handler.
+type removeBansMsg struct {
+	hosts []string
+	reply chan int
+}
+
+// banFeed is the document served by a ban feed.  Feed holds the raw JSON
+// object of the banFeedContent whose Keccak256 hash is signed by the feed key,
+// so the signature does not depend on how the object would be encoded again.
+type banFeed struct {
+	Feed      json.RawMessage `json:"feed"`
+	Signature string          `json:"signature"`
+}
+
+// banFeedContent is the signed content of a ban feed.  The sequence of the
+// feed increases with every list published, so an older list is not imported
+// once a newer one was, and the list is not imported after its expiry, in
+// unix seconds, so an old list can not be served again after a restart.
+type banFeedContent struct {
+	Sequence uint64                 `json:"sequence"`
+	Expires  int64                  `json:"expires"`
+	Bans     []rpcjson.BanListEntry `json:"bans"`
+}
+
+// handleGetBanList returns the hosts whose ban did not expire yet.  It is
+// invoked from the peerHandler goroutine.
+func (s *NodeServer) handleGetBanList(state *peerState) map[string]banEntry {
+	now := time.Now()
+	bans := make(map[string]banEntry, len(state.banned))
+	for host, ban := range state.banned {
+		if ban.until.After(now) {
+			bans[host] = ban
+		}
+	}
+	return bans
+}
+
+// handleAddBans bans the passed hosts and disconnects their connected peers.
+// A ban which expires before the current ban of a host is ignored.  It returns
+// the number of bans which were added or extended and is invoked from the
+// peerHandler goroutine.
+func (s *NodeServer) handleAddBans(state *peerState, bans map[string]banEntry) int {
+	now := time.Now()
+	added := 0
+	for host, ban := range bans {
+		if !ban.until.After(now) {
+			continue
+		}
+		if cur, ok := state.banned[host]; ok && !ban.until.After(cur.until) {
+			continue
+		}
+		srvrLog.Infof("Banned host %s until %v: %s", host,
+			ban.until.Format(time.RFC3339), ban.reason)
+		state.banned[host] = ban
+		added++
+	}
+
+	state.forAllPeers(func(sp *serverPeer) {
+		host, _, err := net.SplitHostPort(sp.Addr())
+		if err != nil {
+			return
+		}
+		if _, ok := bans[host]; ok && state.banned[host].until.After(now) {
+			srvrLog.Infof("Disconnecting banned peer %s", sp)
+			sp.Disconnect()
+		}
+	})
+	return added
+}
+
+// handleRemoveBans lifts the bans of the passed hosts, or of all the hosts when
+// none is passed, and forgets their misbehavior.  It returns the number of
+// bans which were lifted and is invoked from the peerHandler goroutine.
+func (s *NodeServer) handleRemoveBans(state *peerState, hosts []string) int {
+	if hosts == nil {
+		removed := len(state.banned)
+		state.banned = make(map[string]banEntry)
+		state.misbehavior = make(map[string]*hostMisbehavior)
+		srvrLog.Infof("Cleared %d bans", removed)
+		return removed
+	}
+	removed := 0
+	for _, host := range hosts {
+		delete(state.misbehavior, host)
+		if _, ok := state.banned[host]; ok {
+			srvrLog.Infof("Lifted the ban of host %s", host)
+			delete(state.banned, host)
+			removed++
+		}
+	}
+	return removed
+}
+
+// handleMisbehavior adds the ban score of a disconnected peer to the score of
+// its host, and bans the host once the scores of its connections within the
+// misbehavior window exceed the ban threshold.  Otherwise a peer disconnected
+// for misbehaving could reconnect and start over forever.  It is invoked from
+// the peerHandler goroutine.
+func (s *NodeServer) handleMisbehavior(state *peerState, sp *serverPeer) {
+	score := sp.BanScore()
+	if score == 0 || chaincfg.Cfg.DisableBanning || sp.listenPolicy == chaincfg.ListenTor {
+		return
+	}
+	host, _, err := net.SplitHostPort(sp.Addr())
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if ban, ok := state.banned[host]; ok && ban.until.After(now) {
+		delete(state.misbehavior, host)
+		return
+	}
+
+	window := chaincfg.Cfg.MisbehaviorWindow
+	if len(state.misbehavior) >= maxMisbehavingHosts {
+		for h, m := range state.misbehavior {
+			if now.Sub(m.last) > window {
+				delete(state.misbehavior, h)
+			}
+		}
+	}
+	m, ok := state.misbehavior[host]
+	if !ok || now.Sub(m.last) > window {
+		m = &hostMisbehavior{}
+		state.misbehavior[host] = m
+	}
+	m.score += score
+	m.last = now
+	if m.score <= chaincfg.Cfg.BanThreshold {
+		return
+	}
+
+	srvrLog.Infof("Banned host %s for %v: ban score %d within %v", host,
+		chaincfg.Cfg.BanDuration, m.score, window)
+	delete(state.misbehavior, host)
+	state.banned[host] = banEntry{
+		until:  now.Add(chaincfg.Cfg.BanDuration),
+		reason: "repeated misbehavior",
+	}
+}
+
+// BanList returns the hosts whose ban did not expire yet.
+//
+// This function is safe for concurrent access.
+func (s *NodeServer) BanList() map[string]banEntry {
+	replyChan := make(chan map[string]banEntry, 1)
+	select {
+	case s.query <- getBanListMsg{reply: replyChan}:
+	case <-s.quit:
+		return nil
+	}
+	return <-replyChan
+}
+
+// AddBans bans the passed hosts, disconnecting their connected peers, and
+// returns the number of bans which were added or extended.
+//
+// This function is safe for concurrent access.
+func (s *NodeServer) AddBans(bans map[string]banEntry) int {
+	replyChan := make(chan int, 1)
+	select {
+	case s.query <- addBansMsg{bans: bans, reply: replyChan}:
+	case <-s.quit:
+		return 0
+	}
+	return <-replyChan
+}
+
+// RemoveBans lifts the bans of the passed hosts, or of all the hosts when none
+// is passed, and returns the number of bans which were lifted.
+//
+// This function is safe for concurrent access.
+func (s *NodeServer) RemoveBans(hosts []string) int {
+	replyChan := make(chan int, 1)
+	select {
+	case s.query <- removeBansMsg{hosts: hosts, reply: replyChan}:
+	case <-s.quit:
+		return 0
+	}
+	return <-replyChan
+}
+
+// parseBanList converts a ban list to the bans of the peer handler.  The
+// addresses must be IP addresses, which are normalized so that they match the
+// hosts of the peers.
+func parseBanList(entries []rpcjson.BanListEntry) (map[string]banEntry, error) {
+	bans := make(map[string]banEntry, len(entries))
+	for _, entry := range entries {
+		ip := net.ParseIP(entry.Address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ban list address %q",
+				entry.Address)
+		}
+		bans[ip.String()] = banEntry{
+			until:  time.Unix(entry.BannedUntil, 0),
+			reason: entry.Reason,
+		}
+	}
+	return bans, nil
+}
+
+// banListEntries converts the bans of the peer handler to a ban list sorted by
+// address.
+func banListEntries(bans map[string]banEntry) []rpcjson.BanListEntry {
+	entries := make([]rpcjson.BanListEntry, 0, len(bans))
+	for host, ban := range bans {
+		entries = append(entries, rpcjson.BanListEntry{
+			Address:     host,
+			BannedUntil: ban.until.Unix(),
+			Reason:      ban.reason,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Address < entries[j].Address
+	})
+	return entries
+}
+
+// fetchBanFeed fetches the ban feed at the passed URL and returns its bans
+// along with its sequence, once its signature by the passed public key is
+// verified.  A feed older than the passed sequence of the last feed imported,
+// or expired, is rejected.
+func fetchBanFeed(client *http.Client, url string, pubKey []byte,
+	lastSequence uint64) (map[string]banEntry, uint64, error) {
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBanFeedSize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) > maxBanFeedSize {
+		return nil, 0, fmt.Errorf("feed exceeds %d bytes", maxBanFeedSize)
+	}
+
+	var feed banFeed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, 0, err
+	}
+	sig, err := hex.DecodeString(feed.Signature)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid signature: %v", err)
+	}
+	// Drop the recovery id of recoverable signatures.
+	if len(sig) == 65 {
+		sig = sig[:64]
+	}
+	if !crypto.VerifySignature(pubKey, crypto.Keccak256(feed.Feed), sig) {
+		return nil, 0, errors.New("signature verification failed")
+	}
+
+	var content banFeedContent
+	if err := json.Unmarshal(feed.Feed, &content); err != nil {
+		return nil, 0, err
+	}
+	if content.Sequence < lastSequence {
+		return nil, 0, fmt.Errorf("feed sequence %d is older than the "+
+			"imported sequence %d", content.Sequence, lastSequence)
+	}
+	if expires := time.Unix(content.Expires, 0); !expires.After(time.Now()) {
+		return nil, 0, fmt.Errorf("feed sequence %d expired at %v",
+			content.Sequence, expires.Format(time.RFC3339))
+	}
+	bans, err := parseBanList(content.Bans)
+	if err != nil {
+		return nil, 0, err
+	}
+	for host, ban := range bans {
+		ban.reason = "ban feed: " + ban.reason
+		bans[host] = ban
+	}
+	return bans, content.Sequence, nil
+}
+
+// banFeedHandler periodically imports the bans of the configured ban feed.  It
+// must be run with goSupervised.
+func (s *NodeServer) banFeedHandler() {
+	// The key was validated when loading the configuration.
+	pubKey, _ := hex.DecodeString(chaincfg.Cfg.BanFeedKey)
+	client := &http.Client{Timeout: banFeedTimeout}
+	ticker := time.NewTicker(chaincfg.Cfg.BanFeedInterval)
+	defer ticker.Stop()
+
+	var sequence uint64
+out:
+	for {
+		bans, seq, err := fetchBanFeed(client, chaincfg.Cfg.BanFeed,
+			pubKey, sequence)
+		if err != nil {
+			srvrLog.Warnf("Unable to import ban feed %s: %v",
+				chaincfg.Cfg.BanFeed, err)
+		} else {
+			sequence = seq
+			if added := s.AddBans(bans); added > 0 {
+				srvrLog.Infof("Imported %d bans from ban feed %s",
+					added, chaincfg.Cfg.BanFeed)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			break out
+		}
+	}
+}
+
+// ExportBanList returns the banned hosts along with the expiry and the reason
+// of their ban, in the format accepted by importBanList.
+func (s *PublicRpcAPI) ExportBanList() (interface{}, error) {
+	return banListEntries(s.cfg.ConnMgr.BanList()), nil
+}
+
+// ImportBanList bans the hosts of the passed ban list, typically exported from
+// another node, and returns the number of bans which were added or extended.
+// Expired bans and bans expiring before the current ban of a host are ignored.
+func (s *PublicRpcAPI) ImportBanList(bans []rpcjson.BanListEntry) (interface{}, error) {
+	parsed, err := parseBanList(bans)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return s.cfg.ConnMgr.AddBans(parsed), nil
+}
+
+// ListBanned returns the banned hosts along with the expiry and the reason of
+// their ban.
+func (s *PublicRpcAPI) ListBanned() (interface{}, error) {
+	return banListEntries(s.cfg.ConnMgr.BanList()), nil
+}
+
+// SetBan bans or lifts the ban of an IP address depending on the passed
+// command, "add" or "remove".  A ban lasts the configured ban duration unless
+// a ban time is passed in seconds, or as a unix time when absolute is set.
+func (s *PublicRpcAPI) SetBan(address string, command string, banTime *int64, absolute *bool) (interface{}, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid IP address: " + address,
+		}
+	}
+	host := ip.String()
+
+	switch command {
+	case "add":
+		until := time.Now().Add(chaincfg.Cfg.BanDuration)
+		if banTime != nil && *banTime > 0 {
+			if absolute != nil && *absolute {
+				until = time.Unix(*banTime, 0)
+			} else {
+				until = time.Now().Add(time.Duration(*banTime) * time.Second)
+			}
+		}
+		bans := map[string]banEntry{host: {until: until, reason: "manually added"}}
+		if s.cfg.ConnMgr.AddBans(bans) == 0 {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "Host " + host + " is already banned until a later time",
+			}
+		}
+	case "remove":
+		if s.cfg.ConnMgr.RemoveBans([]string{host}) == 0 {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "Host " + host + " is not banned",
+			}
+		}
+	default:
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid command, expected add or remove: " + command,
+		}
+	}
+	return nil, nil
+}
+
+// ClearBanned lifts all the bans and returns the number of bans lifted.
+func (s *PublicRpcAPI) ClearBanned() (interface{}, error) {
+	return s.cfg.ConnMgr.RemoveBans(nil), nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// signBanFeed returns a ban feed document of the passed content signed by the
+// passed key.
+func signBanFeed(t *testing.T, content *banFeedContent, key *ecdsa.PrivateKey) []byte {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	sig, err := crypto.Sign(crypto.Keccak256(raw), key)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	data, err := json.Marshal(&banFeed{
+		Feed:      raw,
+		Signature: hex.EncodeToString(sig),
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return data
+}
+
+// modifyBanFeed returns the passed ban feed document once modified by the
+// passed function.
+func modifyBanFeed(t *testing.T, data []byte, modify func(feed *banFeed)) []byte {
+	var feed banFeed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	modify(&feed)
+	data, err := json.Marshal(&feed)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return data
+}
+
+// TestFetchBanFeed ensures only the ban feeds signed by the feed key, neither
+// expired nor older than the last feed imported, are imported.
+func TestFetchBanFeed(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pubKey := crypto.CompressPubkey(&key.PublicKey)
+
+	now := time.Now().Unix()
+	feed := func(sequence uint64, expires int64) *banFeedContent {
+		return &banFeedContent{
+			Sequence: sequence,
+			Expires:  expires,
+			Bans: []rpcjson.BanListEntry{{
+				Address:     "10.0.0.1",
+				BannedUntil: now + 3600,
+				Reason:      "spam",
+			}},
+		}
+	}
+	altered, err := json.Marshal(feed(4, now+600))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var served []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(served)
+	}))
+	defer server.Close()
+	client := &http.Client{Timeout: banFeedTimeout}
+
+	tests := []struct {
+		name     string
+		document []byte
+		last     uint64
+		valid    bool
+	}{
+		{"first feed", signBanFeed(t, feed(1, now+600), key), 0, true},
+		{"newer feed", signBanFeed(t, feed(3, now+600), key), 2, true},
+		{"same feed", signBanFeed(t, feed(2, now+600), key), 2, true},
+		{"replayed feed", signBanFeed(t, feed(1, now+600), key), 2, false},
+		{"expired feed", signBanFeed(t, feed(3, now-1), key), 2, false},
+		{"wrong key", signBanFeed(t, feed(3, now+600), otherKey), 2, false},
+		{"bad signature", modifyBanFeed(t, signBanFeed(t, feed(3, now+600), key),
+			func(doc *banFeed) {
+				sig, _ := hex.DecodeString(doc.Signature)
+				sig[10] ^= 0xff
+				doc.Signature = hex.EncodeToString(sig)
+			}), 2, false},
+		{"altered feed", modifyBanFeed(t, signBanFeed(t, feed(3, now+600), key),
+			func(doc *banFeed) { doc.Feed = altered }), 2, false},
+	}
+	for _, test := range tests {
+		served = test.document
+		bans, sequence, err := fetchBanFeed(client, server.URL, pubKey, test.last)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: feed imported", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: feed rejected: %v", test.name, err)
+			continue
+		}
+		var doc banFeed
+		var content banFeedContent
+		json.Unmarshal(served, &doc)
+		json.Unmarshal(doc.Feed, &content)
+		if sequence != content.Sequence {
+			t.Errorf("%s: sequence %d, want %d", test.name, sequence,
+				content.Sequence)
+		}
+		if ban, ok := bans["10.0.0.1"]; !ok || ban.until.Unix() != now+3600 {
+			t.Errorf("%s: bans %v not imported", test.name, bans)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// compactCheckInterval is the interval between two checks whether a scheduled
+// compaction is due and the node is idle.
+const compactCheckInterval = time.Minute
+
+// errCompactionRunning is returned when a compaction is requested while
+// another one is still running.
+var errCompactionRunning = errors.New("compaction already running")
+
+// namedCompacter is a database which supports compaction along with the name
+// it is reported with.
+type namedCompacter struct {
+	name string
+	db   database.Compacter
+}
+
+// dbCompactor compacts the leveldb stores of the node, either on schedule
+// when the node is idle or on request, and tracks the progress.
+type dbCompactor struct {
+	dbs      []namedCompacter
+	interval time.Duration
+	trigger  chan struct{}
+
+	mtx       sync.Mutex
+	running   bool
+	current   string
+	progress  float64
+	lastStart time.Time
+	lastDur   time.Duration
+	lastErr   error
+	nextRun   time.Time
+}
+
+// newDBCompactor returns a new compactor.  Scheduled compactions run every
+// interval, or never when the interval is zero.
+func newDBCompactor(interval time.Duration) *dbCompactor {
+	c := &dbCompactor{
+		interval: interval,
+		trigger:  make(chan struct{}, 1),
+	}
+	if interval > 0 {
+		c.nextRun = time.Now().Add(interval)
+	}
+	return c
+}
+
+// add registers the passed database under the given name when it supports
+// compaction.
+func (c *dbCompactor) add(name string, db interface{}) {
+	if compacter, ok := db.(database.Compacter); ok {
+		c.dbs = append(c.dbs, namedCompacter{name, compacter})
+	}
+}
+
+// Trigger requests an immediate compaction.  It returns errCompactionRunning
+// when a compaction is already running or pending.
+//
+// This function is safe for concurrent access.
+func (c *dbCompactor) Trigger() error {
+	c.mtx.Lock()
+	running := c.running
+	c.mtx.Unlock()
+	if running {
+		return errCompactionRunning
+	}
+	select {
+	case c.trigger <- struct{}{}:
+		return nil
+	default:
+		return errCompactionRunning
+	}
+}
+
+// Info returns the state of the current and the last compaction.
+//
+// This function is safe for concurrent access.
+func (c *dbCompactor) Info() *rpcjson.GetCompactionInfoResult {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	info := &rpcjson.GetCompactionInfoResult{
+		Running:      c.running,
+		Database:     c.current,
+		Progress:     c.progress,
+		LastDuration: int64(c.lastDur / time.Second),
+	}
+	if !c.lastStart.IsZero() {
+		info.LastStart = c.lastStart.Unix()
+	}
+	if c.lastErr != nil {
+		info.LastError = c.lastErr.Error()
+	}
+	if !c.nextRun.IsZero() {
+		info.NextScheduled = c.nextRun.Unix()
+	}
+	return info
+}
+
+// compact compacts all databases one after the other.  Progress is logged in
+// steps of ten percent.
+func (c *dbCompactor) compact(interrupt <-chan struct{}) {
+	start := time.Now()
+	c.mtx.Lock()
+	c.running = true
+	c.lastStart = start
+	c.mtx.Unlock()
+
+	var err error
+	for _, db := range c.dbs {
+		name := db.name
+		srvrLog.Infof("Compacting %s database", name)
+		c.mtx.Lock()
+		c.current, c.progress = name, 0
+		c.mtx.Unlock()
+
+		var logged int
+		err = db.db.Compact(interrupt, func(done, total int) {
+			percent := done * 100 / total
+			c.mtx.Lock()
+			c.progress = float64(done) * 100 / float64(total)
+			c.mtx.Unlock()
+			if percent/10 > logged/10 {
+				logged = percent
+				srvrLog.Infof("Compacting %s database: %d%% done", name, percent)
+			}
+		})
+		if err != nil {
+			srvrLog.Warnf("Unable to compact %s database: %v", name, err)
+			break
+		}
+	}
+
+	c.mtx.Lock()
+	c.running = false
+	c.current, c.progress = "", 0
+	c.lastDur = time.Since(start)
+	c.lastErr = err
+	if c.interval > 0 {
+		c.nextRun = time.Now().Add(c.interval)
+	}
+	c.mtx.Unlock()
+	if err == nil {
+		srvrLog.Infof("Compacted databases in %v", c.lastDur.Round(time.Second))
+	}
+}
+
+// compactionHandler runs the scheduled and requested database compactions.
+// A scheduled compaction is deferred until the chain is current so it does
+// not slow down the initial block download.  It must be run with
+// goSupervised.
+func (s *NodeServer) compactionHandler() {
+	ticker := time.NewTicker(compactCheckInterval)
+	defer ticker.Stop()
+
+	c := s.compactor
+out:
+	for {
+		select {
+		case <-c.trigger:
+			c.compact(s.quit)
+
+		case <-ticker.C:
+			c.mtx.Lock()
+			due := !c.nextRun.IsZero() && time.Now().After(c.nextRun)
+			c.mtx.Unlock()
+			if due && s.chain.IsCurrent() {
+				c.compact(s.quit)
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/audit"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+const (
+	// consolidateInterval is the interval between two checks of the
+	// fragmentation of the outputs of the node account.
+	consolidateInterval = time.Minute * 10
+
+	// dustFeeRatio is the ratio of the value of an asim output to the fee
+	// of spending it under which the output is dust.
+	dustFeeRatio = 3
+)
+
+// inputFee returns the fee of spending a pay-to-pubkey-hash output at the
+// passed gas price.
+func inputFee(gasPrice float64) int64 {
+	size := protos.NewTxIn(&protos.OutPoint{}, nil).SerializeSize() + sweepSigScriptSize
+	return int64(math.Ceil(float64(size*common.GasPerByte) * gasPrice))
+}
+
+// fragmentation is the analysis of the spendable outputs of an address.
+// spendFee is the fee of the inputs spending all the outputs, and
+// consolidatedSpendFee the fee of the inputs spending them once consolidated
+// into one output per asset.
+type fragmentation struct {
+	outputs              int
+	assets               int
+	dust                 int
+	spendFee             int64
+	consolidatedSpendFee int64
+}
+
+// excess returns the number of outputs a consolidation removes.
+func (f *fragmentation) excess() int {
+	return f.outputs - f.assets
+}
+
+// analyzeFragmentation analyzes the spendable outputs of an address.
+func analyzeFragmentation(inputs []*sweepInput, gasPrice float64) *fragmentation {
+	fee := inputFee(gasPrice)
+	assets := make(map[protos.Asset]struct{})
+	f := &fragmentation{outputs: len(inputs)}
+	for _, in := range inputs {
+		assets[in.asset] = struct{}{}
+		if in.asset == asiutil.AsimovAsset && in.amount < fee*dustFeeRatio {
+			f.dust++
+		}
+	}
+	f.assets = len(assets)
+	f.spendFee = int64(f.outputs) * fee
+	f.consolidatedSpendFee = int64(f.assets) * fee
+	return f
+}
+
+// consolidationTx builds the transaction consolidating at most maxInputs of
+// the passed outputs into one output per asset paid to the destination.  The
+// largest asim output pays the fee, and the smallest asim outputs are
+// consolidated first, being the most expensive to spend relative to their
+// value.
+func consolidationTx(inputs []*sweepInput, destination []byte, gasPrice float64,
+	maxInputs int) (*sweepTx, error) {
+
+	var asims, others []*sweepInput
+	for _, in := range inputs {
+		if in.asset == asiutil.AsimovAsset {
+			asims = append(asims, in)
+		} else {
+			others = append(others, in)
+		}
+	}
+	if len(asims) == 0 {
+		return nil, fmt.Errorf("no asim output to pay the fee")
+	}
+	sort.SliceStable(asims, func(i, j int) bool {
+		return asims[i].amount < asims[j].amount
+	})
+
+	payer := asims[len(asims)-1]
+	rest := append(asims[:len(asims)-1:len(asims)-1], others...)
+	if len(rest) > maxInputs-1 {
+		rest = rest[:maxInputs-1]
+	}
+
+	builder := &sweepBuilder{
+		destination: destination,
+		gasPrice:    gasPrice,
+		maxTxSize:   maxSweepTxSize,
+	}
+	tx := newSweepTx()
+	builder.add(tx, payer)
+	builder.fill(tx, rest)
+	if err := builder.pay(tx); err != nil {
+		return nil, fmt.Errorf("consolidation %v", err)
+	}
+	return tx, nil
+}
+
+// consolidationMonitor periodically consolidates the outputs of the node
+// account while the fees are low.  It must be run with goSupervised.
+func (s *NodeServer) consolidationMonitor() {
+	ticker := time.NewTicker(consolidateInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.maybeConsolidate()
+		case <-s.quit:
+			break out
+		}
+	}
+}
+
+// maybeConsolidate consolidates the outputs of the node account when they
+// are fragmented beyond the configured number of outputs.  The fees are
+// considered low while the node is current and its mempool holds no more
+// transactions than configured, the consolidation then paying the minimum
+// gas price.  A consolidation spends at most the configured number of outputs
+// and is skipped when its fee exceeds the configured maximum.
+func (s *NodeServer) maybeConsolidate() {
+	if !s.syncManager.IsCurrent() {
+		return
+	}
+	if count := s.txMemPool.Count(); count > chaincfg.Cfg.ConsolidateMaxMempool {
+		srvrLog.Debugf("Delaying consolidation, %d transactions in the "+
+			"mempool", count)
+		return
+	}
+
+	account := s.consolidateAccount
+	gasPrice := chaincfg.Cfg.MinTxPrice
+	inputs, _, err := sweepOutputs(context.Background(), s.chain, s.txMemPool, s.utxoLocks,
+		[][]byte{account.Address.ScriptAddress()})
+	if err != nil {
+		srvrLog.Errorf("Unable to fetch the outputs to consolidate: %v", err)
+		return
+	}
+	frag := analyzeFragmentation(inputs, gasPrice)
+	if frag.excess() < chaincfg.Cfg.ConsolidateMinOutputs {
+		return
+	}
+
+	destination, err := txscript.PayToAddrScript(account.Address)
+	if err != nil {
+		srvrLog.Errorf("Unable to build the consolidation script: %v", err)
+		return
+	}
+	tx, err := consolidationTx(inputs, destination, gasPrice,
+		chaincfg.Cfg.ConsolidateMaxInputs)
+	if err != nil {
+		srvrLog.Warnf("Unable to consolidate %d outputs of %s: %v",
+			frag.outputs, account.Address, err)
+		return
+	}
+	if tx.fee > chaincfg.Cfg.ConsolidateMaxFee {
+		srvrLog.Infof("Skipping consolidation of %d outputs of %s, its "+
+			"fee of %d exceeds the maximum of %d", len(tx.inputs),
+			account.Address, tx.fee, chaincfg.Cfg.ConsolidateMaxFee)
+		return
+	}
+	if err := signConsolidation(tx, account); err != nil {
+		srvrLog.Errorf("Unable to sign consolidation: %v", err)
+		return
+	}
+
+	utx := asiutil.NewTx(tx.mtx)
+	acceptedTxs, err := s.txMemPool.ProcessTransaction(utx, false, false, 0)
+	s.auditLog.Tx(utx.Hash(), audit.OriginLocal, false, err)
+	if err != nil {
+		srvrLog.Warnf("Consolidation %v rejected: %v", utx.Hash(), err)
+		return
+	}
+	srvrLog.Infof("Consolidating %d outputs of %s in %v for a fee of %d",
+		len(tx.inputs), account.Address, utx.Hash(), tx.fee)
+	s.AnnounceNewTransactions(acceptedTxs)
+	for _, txD := range acceptedTxs {
+		if txD.Tx.Hash().IsEqual(utx.Hash()) {
+			iv := protos.NewInvVect(protos.InvTypeTx, utx.Hash())
+			s.AddRebroadcastInventory(iv, txD)
+		}
+	}
+}
+
+// signConsolidation signs the inputs of a consolidation with the key of the
+// account.
+func signConsolidation(tx *sweepTx, account *crypto.Account) error {
+	getKey := txscript.KeyClosure(func(common.IAddress) (*crypto.PrivateKey, bool, error) {
+		return &account.PrivateKey, true, nil
+	})
+	for i, in := range tx.inputs {
+		sigScript, err := txscript.SignTxOutput(tx.mtx, i, in.pkScript,
+			txscript.SigHashAll, getKey, nil, nil)
+		if err != nil {
+			return err
+		}
+		tx.mtx.TxIn[i].SignatureScript = sigScript
+	}
+	return nil
+}
+
+// GetUtxoFragmentation analyzes the fragmentation of the outputs of the passed
+// addresses.  For every address, it returns the number of spendable outputs
+// and of dust outputs, the fees of spending the outputs before and after a
+// consolidation into one output per asset, and the fee of that consolidation
+// at the minimum gas price.  A consolidation is recommended when it removes at
+// least --consolidateminoutputs outputs.
+func (s *PublicRpcAPI) GetUtxoFragmentation(ctx context.Context, addresses []string) (interface{}, error) {
+	if len(addresses) == 0 || len(addresses) > maxSweepAddresses {
+		return nil, &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid number of addresses: %d, at "+
+				"least 1 and at most %d", len(addresses), maxSweepAddresses),
+		}
+	}
+
+	gasPrice := chaincfg.Cfg.MinTxPrice
+	results := make([]rpcjson.UtxoFragmentationResult, 0, len(addresses))
+	for _, address := range addresses {
+		destination, err := sweepDestination(address)
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address: " + address,
+			}
+		}
+		addr, _ := asiutil.DecodeAddress(address)
+		inputs, skipped, err := sweepOutputs(ctx, s.cfg.Chain, s.cfg.TxMemPool, s.cfg.UtxoLocks,
+			[][]byte{addr.ScriptAddress()})
+		if err != nil {
+			return nil, err
+		}
+
+		frag := analyzeFragmentation(inputs, gasPrice)
+		result := rpcjson.UtxoFragmentationResult{
+			Address:              address,
+			Outputs:              frag.outputs,
+			Assets:               frag.assets,
+			DustOutputs:          frag.dust,
+			Skipped:              skipped,
+			SpendFee:             frag.spendFee,
+			ConsolidatedSpendFee: frag.consolidatedSpendFee,
+		}
+		if frag.excess() > 0 {
+			var asims, others []*sweepInput
+			for _, in := range inputs {
+				if in.asset == asiutil.AsimovAsset {
+					asims = append(asims, in)
+				} else {
+					others = append(others, in)
+				}
+			}
+			builder := &sweepBuilder{
+				destination: destination,
+				gasPrice:    gasPrice,
+				maxTxSize:   maxSweepTxSize,
+			}
+			if txs, err := builder.build(asims, others); err == nil {
+				for _, tx := range txs {
+					result.ConsolidationFee += tx.fee
+				}
+				result.ConsolidationTxs = len(txs)
+				result.Recommended = frag.excess() >= chaincfg.Cfg.ConsolidateMinOutputs
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
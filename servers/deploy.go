@@ -0,0 +1,137 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/vm/fvm/abi"
+)
+
+// deployTemplate returns the template of the contract to deploy.
+func (s *PublicRpcAPI) deployTemplate(deploy *rpcjson.DeployContract) (rpcjson.ContractTemplateDetail, error) {
+	key := deploy.TemplateKey
+	if key == "" {
+		block, stateDB := createTempBlockState(s.cfg)
+		content, ok, _ := s.cfg.ContractMgr.GetTemplate(block,
+			common.SystemContractReadOnlyGas, stateDB,
+			chaincfg.ActiveNetParams.FvmParam, deploy.Category, deploy.TemplateName)
+		if !ok {
+			return rpcjson.ContractTemplateDetail{}, internalRPCError("error:template not found", "")
+		}
+		key = content.Key
+	}
+	detail, ok := getTemplateInfoByKey(key, s)
+	if !ok {
+		return rpcjson.ContractTemplateDetail{}, internalRPCError("error:template not found", "")
+	}
+	return detail, nil
+}
+
+// DeployContract creates a contract from a template.  The constructor
+// arguments are encoded according to the ABI of the template, then the
+// creation transaction is built, signed with the passed private key and
+// broadcast.  The inputs must all be spendable by the private key.  It returns
+// the id of the transaction along with the address of the created contract.
+func (s *PublicRpcAPI) DeployContract(deploy rpcjson.DeployContract, privkey string) (interface{}, error) {
+	if len(deploy.Inputs) == 0 {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "No input to fund the creation",
+		}
+	}
+
+	privKeyBytes, err := hexutil.Decode(privkey)
+	if err != nil {
+		context := "Failed to decode private key"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	privKey, _ := crypto.PrivKeyFromBytes(crypto.S256(), privKeyBytes)
+
+	template, err := s.deployTemplate(&deploy)
+	if err != nil {
+		return nil, err
+	}
+	definition, err := abi.JSON(strings.NewReader(template.Abi))
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to parse template abi")
+	}
+	args, err := abi.ParseArguments(definition.Constructor.Inputs, deploy.Args)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	constructor, err := definition.Pack("", args...)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	// The creation output comes first, it is the one the contract address
+	// is derived for.
+	data := blockchain.EncodeCreateContractData(template.Category, template.TemplateName, constructor)
+	outputs := append([]rpcjson.TransactionOutput{{
+		Amount:       strconv.FormatInt(deploy.Amount, 10),
+		Assets:       deploy.Asset,
+		Data:         hex.EncodeToString(data),
+		ContractType: txscript.CreateTy.String(),
+	}}, deploy.Outputs...)
+	created, err := s.CreateRawTransaction(deploy.Inputs, outputs, nil, deploy.GasLimit, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	rawTx := created.(*rpcjson.CreateRawTransactionResult)
+
+	serializedTx, _ := hex.DecodeString(rawTx.Hex)
+	var mtx protos.MsgTx
+	if err := mtx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to deserialize the creation")
+	}
+	getKey := txscript.KeyClosure(func(common.IAddress) (*crypto.PrivateKey, bool, error) {
+		return privKey, true, nil
+	})
+	for i, input := range deploy.Inputs {
+		pkScript, err := hex.DecodeString(input.ScriptPubKey)
+		if err != nil {
+			return nil, rpcDecodeHexError(input.ScriptPubKey)
+		}
+		sigScript, err := txscript.SignTxOutput(&mtx, i, pkScript,
+			txscript.SigHashAll, getKey, nil, nil)
+		if err != nil {
+			context := "Failed to sign the creation"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		mtx.TxIn[i].SignatureScript = sigScript
+	}
+
+	mtxHex, err := messageToHex(&mtx)
+	if err != nil {
+		return nil, err
+	}
+	txID, err := s.SendRawTransaction(mtxHex)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcjson.DeployContractResult{
+		TxID:         txID.(string),
+		Hex:          mtxHex,
+		ContractAddr: rawTx.ContractAddr[0],
+	}, nil
+}
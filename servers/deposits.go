@@ -0,0 +1,244 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"encoding/hex"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/deposits"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/webhook"
+)
+
+const (
+	// depositsFilename is the name of the file holding the watched deposit
+	// addresses and the deposits being confirmed in the data directory.
+	depositsFilename = "deposits.json"
+
+	// depositDeadLetterFilename is the name of the file in the data
+	// directory which records the undeliverable deposit callbacks.
+	depositDeadLetterFilename = "deposit_deadletter.log"
+
+	// depositWorkers is the number of concurrent deliveries of the deposit
+	// callbacks, so an unreachable callback URL does not delay the others.
+	depositWorkers = 4
+)
+
+// webhookDepositEvent is the payload of a deposit callback.
+type webhookDepositEvent struct {
+	Status        deposits.Status `json:"status"`
+	TxID          string          `json:"txid"`
+	Vout          uint32          `json:"vout"`
+	Address       string          `json:"address"`
+	Asset         string          `json:"asset"`
+	Value         int64           `json:"value"`
+	BlockHash     string          `json:"blockhash,omitempty"`
+	Height        int32           `json:"height,omitempty"`
+	Confirmations int32           `json:"confirmations"`
+	Required      int32           `json:"required"`
+}
+
+// depositOutputs returns the outputs of the transactions paying to the watched
+// addresses.
+func (s *NodeServer) depositOutputs(txs []*asiutil.Tx) []deposits.Output {
+	var outs []deposits.Output
+	for _, tx := range txs {
+		for i, txOut := range tx.MsgTx().TxOut {
+			_, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript)
+			if err != nil || len(addrs) == 0 {
+				continue
+			}
+			address := addrs[0].EncodeAddress()
+			if !s.deposits.Watched(address) {
+				continue
+			}
+			outs = append(outs, deposits.Output{
+				TxID:    tx.Hash().String(),
+				Vout:    uint32(i),
+				Address: address,
+				Asset:   hex.EncodeToString(txOut.Asset.Bytes()),
+				Value:   txOut.Value,
+			})
+		}
+	}
+	return outs
+}
+
+// notifyDeposits sends the deposit events to their callback URLs, and saves
+// the tracked deposits so a restart does not report them again.
+func (s *NodeServer) notifyDeposits(events []deposits.Event) {
+	if len(events) == 0 {
+		return
+	}
+	for _, e := range events {
+		d := &e.Deposit
+		err := s.depositHooks.NotifyURL(e.URL, webhook.EventDeposit, &webhookDepositEvent{
+			Status:        e.Status,
+			TxID:          d.TxID,
+			Vout:          d.Vout,
+			Address:       d.Address,
+			Asset:         d.Asset,
+			Value:         d.Value,
+			BlockHash:     d.BlockHash,
+			Height:        d.Height,
+			Confirmations: d.Confirmations,
+			Required:      e.Required,
+		})
+		if err != nil {
+			srvrLog.Warnf("Unable to queue the %s callback of deposit "+
+				"%s:%d: %v", e.Status, d.TxID, d.Vout, err)
+		}
+	}
+	if err := s.deposits.Save(); err != nil {
+		srvrLog.Errorf("Unable to save deposits: %v", err)
+	}
+}
+
+// notifyPendingDeposits reports the deposits of the transactions accepted to
+// the mempool.
+func (s *NodeServer) notifyPendingDeposits(txns []*mining.TxDesc) {
+	if s.deposits == nil || !s.deposits.Watching() {
+		return
+	}
+	txs := make([]*asiutil.Tx, 0, len(txns))
+	for _, txD := range txns {
+		txs = append(txs, txD.Tx)
+	}
+	s.notifyDeposits(s.deposits.AddPending(s.depositOutputs(txs)))
+}
+
+// handleDepositNotification follows the deposits of the watched addresses
+// across the connected and disconnected blocks.  The outputs of the virtual
+// block, which carry the transfers of the contracts, are deposits as well.
+func (s *NodeServer) handleDepositNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected &&
+		notification.Type != blockchain.NTBlockDisconnected {
+		return
+	}
+	if !s.deposits.Watching() {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) < 2 {
+		return
+	}
+	block, ok := data[0].(*asiutil.Block)
+	if !ok {
+		return
+	}
+
+	if notification.Type == blockchain.NTBlockDisconnected {
+		s.notifyDeposits(s.deposits.DisconnectBlock(block.Hash().String()))
+		return
+	}
+
+	txs := block.Transactions()
+	if vblock, ok := data[1].(*asiutil.VBlock); ok && vblock != nil {
+		txs = append(txs[:len(txs):len(txs)], vblock.Transactions()...)
+	}
+	inMempool := func(txID string) bool {
+		hash := common.HexToHash(txID)
+		return s.txMemPool.HaveTransaction(&hash)
+	}
+	s.notifyDeposits(s.deposits.ConnectBlock(block.Hash().String(),
+		block.Height(), s.depositOutputs(txs), inMempool))
+}
+
+// errExchangeModeDisabled is returned by the deposit calls when the exchange
+// mode is not enabled.
+var errExchangeModeDisabled = &rpcjson.RPCError{
+	Code:    rpcjson.ErrRPCMisc,
+	Message: "Exchange mode is not enabled, see --exchangemode",
+}
+
+// WatchDepositAddress starts watching the deposits of an address, or updates
+// a watched address.  The callback URL receives a deposit event when a deposit
+// enters the mempool, at each confirmation until the required confirmations,
+// once final, and when a reorganization unconfirms or drops it.
+func (s *PublicRpcAPI) WatchDepositAddress(address string, confirmations int32, url string) (interface{}, error) {
+	if s.cfg.Deposits == nil {
+		return nil, errExchangeModeDisabled
+	}
+	addr, err := asiutil.DecodeAddress(address)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address: " + address,
+		}
+	}
+	err = s.cfg.Deposits.Watch(deposits.Watch{
+		Address:       addr.EncodeAddress(),
+		Confirmations: confirmations,
+		URL:           url,
+	})
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	if err := s.cfg.Deposits.Save(); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to save deposits")
+	}
+	return nil, nil
+}
+
+// UnwatchDepositAddress stops watching the deposits of an address.  The
+// deposits of the address being confirmed are no longer reported.
+func (s *PublicRpcAPI) UnwatchDepositAddress(address string) (interface{}, error) {
+	if s.cfg.Deposits == nil {
+		return nil, errExchangeModeDisabled
+	}
+	addr, err := asiutil.DecodeAddress(address)
+	if err != nil || !s.cfg.Deposits.Unwatch(addr.EncodeAddress()) {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Address is not watched: " + address,
+		}
+	}
+	if err := s.cfg.Deposits.Save(); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to save deposits")
+	}
+	return nil, nil
+}
+
+// ListDepositAddresses returns the watched deposit addresses and their
+// deposits not final yet.
+func (s *PublicRpcAPI) ListDepositAddresses() (interface{}, error) {
+	if s.cfg.Deposits == nil {
+		return nil, errExchangeModeDisabled
+	}
+	watches := s.cfg.Deposits.Watches()
+	list := s.cfg.Deposits.Deposits()
+	result := &rpcjson.ListDepositAddressesResult{
+		Watches:  make([]rpcjson.DepositWatchResult, 0, len(watches)),
+		Deposits: make([]rpcjson.DepositResult, 0, len(list)),
+	}
+	for _, w := range watches {
+		result.Watches = append(result.Watches, rpcjson.DepositWatchResult{
+			Address:       w.Address,
+			Confirmations: w.Confirmations,
+			URL:           w.URL,
+		})
+	}
+	for _, d := range list {
+		result.Deposits = append(result.Deposits, rpcjson.DepositResult{
+			TxID:          d.TxID,
+			Vout:          d.Vout,
+			Address:       d.Address,
+			Asset:         d.Asset,
+			Value:         d.Value,
+			BlockHash:     d.BlockHash,
+			Height:        d.Height,
+			Confirmations: d.Confirmations,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/audit"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// devFundInterval is the interval between two checks of the funding of the
+// developer accounts in the developer mode.
+const devFundInterval = time.Second * 5
+
+// devKeysFilename is the name of the file holding the private keys of the
+// developer accounts in the data directory of the developer mode.
+const devKeysFilename = "devkeys"
+
+// notifyDevTxs wakes up the solo consensus of the developer mode so it
+// produces a block including the passed transactions.
+func (s *NodeServer) notifyDevTxs(txns []*mining.TxDesc) {
+	if s.devTxs == nil || len(txns) == 0 {
+		return
+	}
+	select {
+	case s.devTxs <- struct{}{}:
+	default:
+	}
+}
+
+// devAccounts returns the developer accounts, the first one producing the
+// blocks.
+func devAccounts() ([]*crypto.Account, error) {
+	accounts := make([]*crypto.Account, len(chaincfg.DevKeys))
+	for i, key := range chaincfg.DevKeys {
+		acc, err := crypto.NewAccount(key)
+		if err != nil {
+			return nil, err
+		}
+		accounts[i] = acc
+	}
+	return accounts, nil
+}
+
+// writeDevKeys writes the address and the private key of the passed
+// developer accounts to the passed file, one account per line, readable by
+// the user only.
+func writeDevKeys(file string, accounts []*crypto.Account) error {
+	var buf bytes.Buffer
+	for i, acc := range accounts {
+		fmt.Fprintf(&buf, "%s %s\n", acc.Address.String(), chaincfg.DevKeys[i])
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0600)
+}
+
+// devFundMonitor funds the developer accounts from the block rewards of the
+// account producing the blocks in the developer mode, and returns once they
+// are all funded.  It must be run with goSupervised.
+func (s *NodeServer) devFundMonitor() {
+	accounts, err := devAccounts()
+	if err != nil {
+		srvrLog.Errorf("Unable to load the developer accounts: %v", err)
+		return
+	}
+	for i, acc := range accounts {
+		srvrLog.Infof("Developer account %d: address %v", i,
+			acc.Address.String())
+	}
+	keysFile := filepath.Join(chaincfg.Cfg.DataDir, devKeysFilename)
+	if err := writeDevKeys(keysFile, accounts); err != nil {
+		srvrLog.Errorf("Unable to write the developer keys: %v", err)
+	} else {
+		srvrLog.Infof("The private keys of the developer accounts are "+
+			"in %s", keysFile)
+	}
+
+	ticker := time.NewTicker(devFundInterval)
+	defer ticker.Stop()
+
+	var pending *common.Hash
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+		if pending != nil && s.txMemPool.HaveTransaction(pending) {
+			continue
+		}
+		var funded bool
+		pending, funded = s.fundDevAccounts(accounts)
+		if funded {
+			srvrLog.Infof("Developer accounts funded")
+			return
+		}
+	}
+}
+
+// fundDevAccounts pays half of the largest asim output of the account
+// producing the blocks to the developer accounts without outputs.  It returns
+// the hash of the funding transaction, if any, and whether all the accounts
+// are funded.
+func (s *NodeServer) fundDevAccounts(accounts []*crypto.Account) (*common.Hash, bool) {
+	ctx := context.Background()
+	var unfunded []*crypto.Account
+	for _, acc := range accounts {
+		if *acc.Address == *s.devAccount.Address {
+			continue
+		}
+		inputs, skipped, err := sweepOutputs(ctx, s.chain, s.txMemPool,
+			s.utxoLocks, [][]byte{acc.Address.ScriptAddress()})
+		if err != nil {
+			srvrLog.Errorf("Unable to fetch the outputs of %v: %v",
+				acc.Address.String(), err)
+			return nil, false
+		}
+		if len(inputs)+skipped == 0 {
+			unfunded = append(unfunded, acc)
+		}
+	}
+	if len(unfunded) == 0 {
+		return nil, true
+	}
+
+	inputs, _, err := sweepOutputs(ctx, s.chain, s.txMemPool, s.utxoLocks,
+		[][]byte{s.devAccount.Address.ScriptAddress()})
+	if err != nil {
+		srvrLog.Errorf("Unable to fetch the outputs of %v: %v",
+			s.devAccount.Address.String(), err)
+		return nil, false
+	}
+	var largest *sweepInput
+	for _, in := range inputs {
+		if in.asset == asiutil.AsimovAsset &&
+			(largest == nil || in.amount > largest.amount) {
+			largest = in
+		}
+	}
+	// Wait for the block rewards to mature.
+	if largest == nil {
+		return nil, false
+	}
+
+	change, err := txscript.PayToAddrScript(s.devAccount.Address)
+	if err != nil {
+		srvrLog.Errorf("Unable to build the developer funding script: %v", err)
+		return nil, false
+	}
+	builder := &sweepBuilder{
+		destination: change,
+		gasPrice:    chaincfg.Cfg.MinTxPrice,
+		maxTxSize:   maxSweepTxSize,
+	}
+	tx := newSweepTx()
+	builder.add(tx, largest)
+	share := largest.amount / 2 / int64(len(unfunded))
+	for _, acc := range unfunded {
+		pkScript, err := txscript.PayToAddrScript(acc.Address)
+		if err != nil {
+			srvrLog.Errorf("Unable to build the developer funding script: %v", err)
+			return nil, false
+		}
+		tx.mtx.AddTxOut(protos.NewTxOut(share, pkScript, asiutil.AsimovAsset))
+		tx.mtx.TxOut[tx.outs[asiutil.AsimovAsset]].Value -= share
+	}
+	if err := builder.pay(tx); err != nil {
+		srvrLog.Debugf("Delaying the developer funding, it %v", err)
+		return nil, false
+	}
+	if err := signConsolidation(tx, s.devAccount); err != nil {
+		srvrLog.Errorf("Unable to sign the developer funding: %v", err)
+		return nil, false
+	}
+
+	utx := asiutil.NewTx(tx.mtx)
+	acceptedTxs, err := s.txMemPool.ProcessTransaction(utx, false, false, 0)
+	s.auditLog.Tx(utx.Hash(), audit.OriginLocal, false, err)
+	if err != nil {
+		srvrLog.Warnf("Developer funding %v rejected: %v", utx.Hash(), err)
+		return nil, false
+	}
+	srvrLog.Infof("Funding %d developer accounts with %d each in %v",
+		len(unfunded), share, utx.Hash())
+	s.AnnounceNewTransactions(acceptedTxs)
+	return utx.Hash(), false
+}
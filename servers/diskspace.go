@@ -0,0 +1,59 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+)
+
+// diskCheckInterval is the interval between two checks of the free space of
+// the data directories.
+const diskCheckInterval = time.Second * 30
+
+// lowDiskSpace returns a description of the first data directory which has
+// less than minFree megabytes of free space, or an empty string when all of
+// them have enough space.  Directories whose free space can not be queried are
+// skipped.
+func lowDiskSpace(minFree uint64) string {
+	for _, dir := range []string{chaincfg.Cfg.DataDir, chaincfg.Cfg.StateDir} {
+		free, _, err := asiutil.DiskSpace(dir)
+		if err != nil {
+			srvrLog.Debugf("Unable to query disk space of %s: %v", dir, err)
+			continue
+		}
+		if free < minFree*1024*1024 {
+			return fmt.Sprintf("only %d MB free in %s, %d MB required",
+				free/1024/1024, dir, minFree)
+		}
+	}
+	return ""
+}
+
+// diskSpaceMonitor periodically checks the free space of the data directories
+// and pauses the acceptance of new blocks when it falls below the configured
+// threshold.  Acceptance is only resumed through the resumeBlockAcceptance
+// RPC so an operator is aware of the condition.  It must be run with
+// goSupervised.
+func (s *NodeServer) diskSpaceMonitor() {
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		if reason := lowDiskSpace(chaincfg.Cfg.MinDiskSpace); reason != "" {
+			s.chain.PauseAcceptance(reason)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			break out
+		}
+	}
+}
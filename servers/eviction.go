@@ -0,0 +1,56 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/connmgr"
+)
+
+// evictionCandidate describes the peer for the inbound eviction.
+func (sp *serverPeer) evictionCandidate() connmgr.EvictionCandidate {
+	c := connmgr.EvictionCandidate{
+		ID:        sp.ID(),
+		Connected: sp.TimeConnected(),
+		PingTime:  time.Duration(sp.LastPingMicros()) * time.Microsecond,
+	}
+	if na := sp.NA(); na != nil {
+		c.Group = sp.server.netGroup(na)
+	}
+	if t := atomic.LoadInt64(&sp.lastBlockTime); t != 0 {
+		c.LastBlock = time.Unix(0, t)
+	}
+	if t := atomic.LoadInt64(&sp.lastTxTime); t != 0 {
+		c.LastTx = time.Unix(0, t)
+	}
+	return c
+}
+
+// evictInboundPeer disconnects the least valuable inbound peer to make room
+// for a new inbound peer.  Whitelisted peers and the peers of the validator
+// listeners are never evicted.  It returns whether a peer was evicted and is
+// invoked from the peerHandler goroutine.
+func (s *NodeServer) evictInboundPeer(state *peerState) bool {
+	candidates := make([]connmgr.EvictionCandidate, 0, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		if sp.IsWhitelisted() || sp.listenPolicy == chaincfg.ListenValidator {
+			continue
+		}
+		candidates = append(candidates, sp.evictionCandidate())
+	}
+	id, ok := connmgr.SelectEvictionCandidate(candidates, s.evictionSeed)
+	if !ok {
+		return false
+	}
+
+	sp := state.inboundPeers[id]
+	srvrLog.Infof("Evicting inbound peer %s to make room for a new peer", sp)
+	delete(state.inboundPeers, id)
+	sp.Disconnect()
+	return true
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/feeestimator"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// feeEstimatesFilename is the name of the file holding the statistics of the
+// fee estimator in the data directory.
+const feeEstimatesFilename = "feeestimates.json"
+
+// observeFees tracks the confirmation of the transactions accepted to the
+// mempool for the fee estimates.
+func (s *NodeServer) observeFees(txns []*mining.TxDesc) {
+	for _, txD := range txns {
+		s.feeEstimator.ObserveTransaction(*txD.Tx.Hash(), txD.GasPrice, txD.Height)
+	}
+}
+
+// handleFeeEstimatorNotification records the transactions confirmed by the
+// connected blocks.  The blocks connected before the node first caught up
+// with the chain are ignored, the estimator having seen none of their
+// transactions and their decay wiping the statistics.  The notifications are
+// sent by the block handler of the sync manager, so it can not be queried
+// through its message channel here.
+func (s *NodeServer) handleFeeEstimatorNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected || !s.syncManager.GetCurrent() {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) < 1 {
+		return
+	}
+	block, ok := data[0].(*asiutil.Block)
+	if !ok {
+		return
+	}
+
+	hashes := make([]common.Hash, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		hashes = append(hashes, *tx.Hash())
+	}
+	s.feeEstimator.RegisterBlock(block.Height(), hashes)
+}
+
+// checkConfTarget returns an error unless the confirmation target may be
+// estimated.
+func checkConfTarget(target int32) error {
+	if target < 1 || target > feeestimator.MaxTarget {
+		return &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid confirmation target: %d, "+
+				"must be between 1 and %d", target, feeestimator.MaxTarget),
+		}
+	}
+	return nil
+}
+
+// EstimateFee returns the gas price a transaction should pay to be confirmed
+// within numBlocks blocks, never below the minimum gas price of the node.
+func (s *PublicRpcAPI) EstimateFee(numBlocks int32) (interface{}, error) {
+	if err := checkConfTarget(numBlocks); err != nil {
+		return nil, err
+	}
+	gasPrice, err := s.cfg.FeeEstimator.Estimate(int(numBlocks),
+		feeestimator.ConservativeThreshold)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return math.Max(gasPrice, chaincfg.Cfg.MinTxPrice), nil
+}
+
+// EstimateSmartFee returns the gas price a transaction should pay to be
+// confirmed within confTarget blocks, never below the minimum gas price of
+// the node.  When too few transactions were observed for the target, the
+// estimate of the closest higher target is returned along with that target.
+// The CONSERVATIVE mode, the default, requires a 95% success rate of the
+// observed transactions within the target, and the ECONOMICAL mode 85%.
+func (s *PublicRpcAPI) EstimateSmartFee(confTarget int32, estimateMode *string) (interface{}, error) {
+	if err := checkConfTarget(confTarget); err != nil {
+		return nil, err
+	}
+	threshold := feeestimator.ConservativeThreshold
+	if estimateMode != nil {
+		switch strings.ToUpper(*estimateMode) {
+		case "CONSERVATIVE":
+		case "ECONOMICAL":
+			threshold = feeestimator.EconomicalThreshold
+		default:
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "Invalid estimate mode: " + *estimateMode,
+			}
+		}
+	}
+
+	gasPrice, target, err := s.cfg.FeeEstimator.EstimateSmart(int(confTarget), threshold)
+	if err != nil {
+		return &rpcjson.EstimateSmartFeeResult{
+			Errors: []string{err.Error()},
+			Blocks: confTarget,
+		}, nil
+	}
+	gasPrice = math.Max(gasPrice, chaincfg.Cfg.MinTxPrice)
+	return &rpcjson.EstimateSmartFeeResult{
+		GasPrice: &gasPrice,
+		Blocks:   int32(target),
+	}, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/feeestimator"
+	"github.com/AsimovNetwork/asimov/netsync"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// TestFeeEstimatorNotification ensures the fee estimator handles the blocks
+// connected with the sync manager busy, which is the case when they are
+// connected by its own block handler.
+func TestFeeEstimatorNotification(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+
+	// The message channel of the sync manager is never serviced.
+	s := &NodeServer{
+		syncManager: &netsync.SyncManager{},
+		feeEstimator: feeestimator.New(
+			filepath.Join(t.TempDir(), feeEstimatesFilename)),
+	}
+	g.Chain().Subscribe(s.handleFeeEstimatorNotification)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Generate(2)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("connecting a block blocked on the sync manager")
+	}
+}
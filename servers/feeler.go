@@ -0,0 +1,87 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"time"
+
+	"github.com/AsimovNetwork/asimov/addrmgr"
+	"github.com/AsimovNetwork/asimov/peer"
+)
+
+const (
+	// feelerInterval is the interval between two feeler connections.
+	feelerInterval = time.Minute * 2
+
+	// feelerTimeout is the time after which a feeler connection is closed
+	// even when the version negotiation did not complete.
+	feelerTimeout = time.Second * 30
+)
+
+// connectFeeler makes a short-lived feeler connection to an address of the
+// new table of the address manager.  The address is moved to the tried table
+// once the version negotiation completes and the connection is then closed,
+// so the address manager learns which addresses are reachable without using
+// an outbound connection slot.
+func (s *NodeServer) connectFeeler() {
+	ka := s.addrManager.GetNewAddress()
+	if ka == nil {
+		return
+	}
+	na := ka.NetAddress()
+
+	// Do not test the addresses of the network segments already connected
+	// to, which would not be connected to anyway.
+	if s.OutboundGroupCount(s.netGroup(na)) != 0 {
+		return
+	}
+
+	s.addrManager.Attempt(na)
+	addr, err := s.addrManager.AddrStringToNetAddr(addrmgr.NetAddressKey(na))
+	if err != nil {
+		return
+	}
+	conn, err := s.nap.DialTimeout(addr)
+	if err != nil {
+		srvrLog.Debugf("Feeler connection to %s failed: %v", addr, err)
+		return
+	}
+
+	sp := newServerPeer(s, false)
+	sp.feeler = true
+	p, err := peer.NewOutboundPeer(newPeerConfig(sp), addr.String())
+	if err != nil {
+		srvrLog.Debugf("Cannot create feeler peer %s: %v", addr, err)
+		conn.Close()
+		return
+	}
+	sp.Peer = p
+	sp.AssociateConnection(conn)
+	srvrLog.Debugf("Feeler connection to %s", sp)
+
+	timer := time.AfterFunc(feelerTimeout, sp.Disconnect)
+	go func() {
+		sp.WaitForDisconnect()
+		timer.Stop()
+		close(sp.quit)
+	}()
+}
+
+// feelerHandler periodically makes feeler connections.  It must be run with
+// goSupervised.
+func (s *NodeServer) feelerHandler() {
+	ticker := time.NewTicker(feelerInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.connectFeeler()
+		case <-s.quit:
+			break out
+		}
+	}
+}
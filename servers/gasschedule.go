@@ -0,0 +1,51 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/vm/fvm/params"
+)
+
+// gasScheduleResult converts a gas schedule of the VM to its rpc model.
+func gasScheduleResult(schedule params.GasSchedule) rpcjson.GasScheduleResult {
+	return rpcjson.GasScheduleResult{
+		Name:   schedule.Name,
+		Height: schedule.Height,
+		Table:  schedule.Table,
+	}
+}
+
+// GetGasSchedule returns the gas schedule of the VM active at the passed
+// block height, along with the next scheduled one.  The height defaults to
+// the height of the next block.
+func (s *PublicRpcAPI) GetGasSchedule(height *int32) (interface{}, error) {
+	h := s.cfg.Chain.BestSnapshot().Height + 1
+	if height != nil {
+		if *height < 0 {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid height: %d", *height),
+			}
+		}
+		h = *height
+	}
+
+	num := big.NewInt(int64(h))
+	fvmParam := chaincfg.ActiveNetParams.FvmParam
+	result := &rpcjson.GetGasScheduleResult{
+		Height: h,
+		Active: gasScheduleResult(fvmParam.GasSchedule(num)),
+	}
+	if next, ok := fvmParam.NextGasSchedule(num); ok {
+		nextResult := gasScheduleResult(next)
+		result.Next = &nextResult
+	}
+	return result, nil
+}
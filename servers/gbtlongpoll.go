@@ -0,0 +1,150 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/mining"
+)
+
+const (
+	// gbtLongPollTimeout is the longest a getBlockTemplate long poll waits
+	// for its template to go stale before a fresh template is returned
+	// anyway.
+	gbtLongPollTimeout = time.Minute
+
+	// gbtTxUpdateDelay is how long a long poll waits after the mempool
+	// changed before it returns, so that bursts of transactions do not
+	// cause a template to be rebuilt for each of them.
+	gbtTxUpdateDelay = 5 * time.Second
+)
+
+// gbtLongPoll tracks the changes of the chain tip and the mempool which make
+// the block templates handed out by getBlockTemplate stale, and wakes up the
+// long poll requests waiting on them.
+type gbtLongPoll struct {
+	mtx   sync.Mutex
+	txSeq uint64
+	stale chan struct{}
+}
+
+// newGbtLongPoll returns a long poll tracker without waiters.
+func newGbtLongPoll() *gbtLongPoll {
+	return &gbtLongPoll{
+		stale: make(chan struct{}),
+	}
+}
+
+// update records a change that makes the outstanding templates stale and
+// wakes up their waiters.
+func (lp *gbtLongPoll) update(txs bool) {
+	lp.mtx.Lock()
+	if txs {
+		lp.txSeq++
+	}
+	close(lp.stale)
+	lp.stale = make(chan struct{})
+	lp.mtx.Unlock()
+}
+
+// notifyNewTransactions records the transactions accepted to the mempool.
+func (lp *gbtLongPoll) notifyNewTransactions(txns []*mining.TxDesc) {
+	if len(txns) == 0 {
+		return
+	}
+	lp.update(true)
+}
+
+// state returns the long poll identifier of the templates built on top of the
+// passed tip along with a channel closed as soon as they go stale.
+func (lp *gbtLongPoll) state(tip *common.Hash) (string, <-chan struct{}) {
+	lp.mtx.Lock()
+	defer lp.mtx.Unlock()
+	return fmt.Sprintf("%s-%d", tip, lp.txSeq), lp.stale
+}
+
+// decodeLongPollID splits a long poll identifier into the chain tip and the
+// mempool sequence number it carries.
+func decodeLongPollID(id string) (*common.Hash, uint64, error) {
+	fields := strings.Split(id, "-")
+	if len(fields) != 2 {
+		return nil, 0, fmt.Errorf("malformed long poll id %q", id)
+	}
+	hashBytes, err := hex.DecodeString(fields[0])
+	if err != nil || len(hashBytes) != common.HashLength {
+		return nil, 0, fmt.Errorf("malformed long poll id %q", id)
+	}
+	hash := common.BytesToHash(hashBytes)
+	txSeq, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &hash, txSeq, nil
+}
+
+// wait blocks until the template identified by id is stale, the long poll
+// times out or ctx is done.  It returns immediately when the template is
+// already stale.
+func (lp *gbtLongPoll) wait(ctx context.Context, chain *blockchain.BlockChain, id string) error {
+	tip, txSeq, err := decodeLongPollID(id)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(gbtLongPollTimeout)
+	defer timeout.Stop()
+	for {
+		best := chain.BestSnapshot().Hash
+		if !best.IsEqual(tip) {
+			return nil
+		}
+		lp.mtx.Lock()
+		txsChanged := lp.txSeq != txSeq
+		stale := lp.stale
+		lp.mtx.Unlock()
+
+		// Give the mempool a moment to settle after it changed, unless a
+		// new block arrives in the meantime.
+		if txsChanged {
+			select {
+			case <-time.After(gbtTxUpdateDelay):
+				return nil
+			case <-stale:
+				continue
+			case <-timeout.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-stale:
+		case <-timeout.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handleGbtLongPollNotification wakes up the getBlockTemplate long polls when
+// the chain tip changes.
+func (s *NodeServer) handleGbtLongPollNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected &&
+		notification.Type != blockchain.NTBlockDisconnected {
+		return
+	}
+	s.gbtLongPoll.update(false)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// maxGenerateBlocks is the maximum number of blocks generate and
+	// generateToAddress produce in one call.
+	maxGenerateBlocks = 1000
+
+	// maxGenerateRetries is the number of times a block is produced again
+	// when the consensus of the node took its slot meanwhile.
+	maxGenerateRetries = 3
+)
+
+// errSlotTaken is returned by generateBlock when the tip changed while the
+// block was produced, so the block lost its slot.
+var errSlotTaken = errors.New("slot taken")
+
+// Generate produces the passed number of blocks on demand with the validator
+// key of the node, which receives the block rewards, and returns their
+// hashes.  It is only available on the test networks.
+func (s *PublicRpcAPI) Generate(ctx context.Context, numBlocks uint32) (interface{}, error) {
+	return s.generate(ctx, numBlocks, nil)
+}
+
+// GenerateToAddress is like Generate, except the block rewards are paid to
+// the passed address.
+func (s *PublicRpcAPI) GenerateToAddress(ctx context.Context, numBlocks uint32, address string) (interface{}, error) {
+	addr, err := asiutil.DecodeAddress(address)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	payTo, ok := addr.(*common.Address)
+	if !ok {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key",
+		}
+	}
+	return s.generate(ctx, numBlocks, payTo)
+}
+
+// generate produces the passed number of blocks, paying their rewards to the
+// passed address or, when nil, to the validator producing them.
+func (s *PublicRpcAPI) generate(ctx context.Context, numBlocks uint32, payTo *common.Address) (interface{}, error) {
+	switch s.cfg.ChainParams.Net {
+	case common.DevelopNet, common.RegTestNet, common.TestNet, common.SimNet:
+	default:
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "No support for generate on the current network",
+		}
+	}
+	if s.cfg.Account == nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "No validator key configured to generate blocks",
+		}
+	}
+	if numBlocks == 0 || numBlocks > maxGenerateBlocks {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "The number of blocks must be between 1 and 1000",
+		}
+	}
+
+	hashes := make([]string, 0, numBlocks)
+	for len(hashes) < int(numBlocks) {
+		var hash *common.Hash
+		var err error
+		for retry := 0; ; retry++ {
+			hash, err = s.generateBlock(ctx, payTo)
+			if err != errSlotTaken || retry == maxGenerateRetries {
+				break
+			}
+		}
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil, rpcCancelledError(ctx)
+		}
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "Failed to generate block")
+		}
+		hashes = append(hashes, hash.String())
+	}
+	return hashes, nil
+}
+
+// generateBlock produces a block in the next slot of the validator of the
+// node, waiting for the slot to be close enough to be accepted, and processes
+// it.
+func (s *PublicRpcAPI) generateBlock(ctx context.Context, payTo *common.Address) (*common.Hash, error) {
+	chain := s.cfg.Chain
+	best := chain.BestSnapshot()
+	account := s.cfg.Account
+	if s.cfg.KeyRotation != nil {
+		account = s.cfg.KeyRotation.accountAt(best.Height + 1)
+	}
+	if payTo == nil {
+		payTo = account.Address
+	}
+
+	// Look for the next slot of the validator, within the two rounds
+	// after the tip.
+	roundSize := int64(chaincfg.ActiveNetParams.RoundSize)
+	round, slot := int64(best.Round), int64(best.SlotIndex)
+	if round == 0 {
+		round, slot = 1, -1
+	}
+	var validators []*common.Address
+	found := false
+	for i := int64(0); i < 2*roundSize && !found; i++ {
+		slot++
+		if slot == roundSize {
+			round, slot = round+1, 0
+			validators = nil
+		}
+		if validators == nil {
+			var err error
+			validators, _, err = chain.GetValidators(uint32(round))
+			if err != nil {
+				return nil, err
+			}
+		}
+		found = *validators[slot] == *account.Address
+	}
+	if !found {
+		return nil, errors.New("the validator of the node has no slot in " +
+			"the next rounds")
+	}
+
+	// Blocks may not be ahead of the time by more than the max time
+	// offset.
+	blockTime, err := chain.SlotTime(uint32(round), uint16(slot))
+	if err != nil {
+		return nil, err
+	}
+	wait := time.Until(time.Unix(blockTime-chaincfg.ActiveNetParams.MaxTimeOffset, 0))
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	template, err := s.cfg.BlockTemplateGenerator.ProduceNewBlockTo(account, payTo,
+		common.GasFloor, common.GasCeil, blockTime, uint32(round), uint16(slot),
+		float64(common.DefaultBlockInterval*1000))
+	if err != nil {
+		return nil, err
+	}
+	isOrphan, err := s.cfg.SyncMgr.ProcessBlock(template, common.BFFastAdd)
+	if err == nil && isOrphan {
+		err = errors.New("block is an orphan")
+	}
+	if err != nil {
+		if chain.BestSnapshot().Hash != best.Hash {
+			return nil, errSlotTaken
+		}
+		return nil, err
+	}
+	rpcsLog.Infof("Generated block %v at height %d", template.Block.Hash(),
+		template.Block.Height())
+	return template.Block.Hash(), nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"encoding/binary"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+)
+
+// contractEventDigest returns the hash announcing the event of the passed
+// index emitted by a transaction.  It commits to the transaction and the
+// index of the event in the block, which identify the event.
+func contractEventDigest(txHash common.Hash, index uint) common.Hash {
+	var buf [common.HashLength + 4]byte
+	copy(buf[:], txHash[:])
+	binary.LittleEndian.PutUint32(buf[common.HashLength:], uint32(index))
+	return common.DoubleHashH(buf[:])
+}
+
+// handleInvClassNotification announces the asset issuances and the events of
+// the watched contracts of the connected blocks to the peers subscribed to
+// their inventory classes.
+func (s *NodeServer) handleInvClassNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected {
+		return
+	}
+	// Avoid announcing historical inventory during the initial block
+	// download.
+	if !s.chain.IsCurrent() {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) < 2 {
+		return
+	}
+	block, ok := data[0].(*asiutil.Block)
+	if !ok {
+		return
+	}
+
+	// The assets are issued by the transactions of the virtual block.
+	if vblock, ok := data[1].(*asiutil.VBlock); ok && vblock != nil {
+		for _, tx := range vblock.Transactions() {
+			for _, txIn := range tx.MsgTx().TxIn {
+				if !asiutil.IsMintOrCreateInput(txIn) {
+					continue
+				}
+				iv := protos.NewInvVect(protos.InvTypeAssetIssuance, tx.Hash())
+				s.RelayInventory(iv, nil)
+				break
+			}
+		}
+	}
+
+	if len(s.invWatchContracts) == 0 {
+		return
+	}
+	receipts := rawdb.ReadReceipts(s.chain.EthDB(), *block.Hash(), uint64(block.Height()))
+	for _, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			addr := l.Address
+			if _, ok := s.invWatchContracts[addr.EncodeAddress()]; !ok {
+				continue
+			}
+			digest := contractEventDigest(l.TxHash, l.Index)
+			iv := protos.NewInvVect(protos.InvTypeContractEvent, &digest)
+			s.RelayInventory(iv, nil)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"sync/atomic"
+
+	"github.com/AsimovNetwork/asimov/audit"
+	"github.com/AsimovNetwork/asimov/crypto"
+)
+
+// keyRotation schedules the switch of the validator key.  The blocks and
+// block signatures below the activation height are signed with the current
+// key and the ones from it on with the next key, which has to be signed up
+// with the consensus contract beforehand to be a validator by then.
+type keyRotation struct {
+	current  *crypto.Account
+	next     *crypto.Account
+	height   int32
+	auditLog *audit.Log
+
+	// switched is set once the next key signed for the first time.  It
+	// must be accessed atomically.
+	switched int32
+}
+
+// newKeyRotation returns a key rotation from the current to the next key at
+// the passed activation height.
+func newKeyRotation(current, next *crypto.Account, height int32,
+	auditLog *audit.Log) *keyRotation {
+
+	return &keyRotation{
+		current:  current,
+		next:     next,
+		height:   height,
+		auditLog: auditLog,
+	}
+}
+
+// accountAt returns the account signing at the passed height.  The switch to
+// the next key is logged and audited the first time it signs.
+//
+// This function is safe for concurrent access.
+func (r *keyRotation) accountAt(height int32) *crypto.Account {
+	if height < r.height {
+		return r.current
+	}
+	if atomic.CompareAndSwapInt32(&r.switched, 0, 1) {
+		srvrLog.Infof("Validator key rotated from %v to %v at height %d",
+			r.current.Address.String(), r.next.Address.String(), height)
+		r.auditLog.Record(audit.ObjKey, r.next.Address, height,
+			audit.OriginLocal, audit.Rotated, nil)
+	}
+	return r.next
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/audit"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/crypto"
+)
+
+// TestKeyRotation ensures the key rotation switches to the next key at its
+// activation height, and audits the switch once.
+func TestKeyRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyrotation")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	auditLog, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	current, err := crypto.NewAccount(chaincfg.DevKeys[0])
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	next, err := crypto.NewAccount(chaincfg.DevKeys[1])
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	r := newKeyRotation(current, next, 10, auditLog)
+	for _, test := range []struct {
+		height int32
+		want   *crypto.Account
+	}{
+		{1, current},
+		{9, current},
+		{10, next},
+		{11, next},
+		{9, current},
+		{12, next},
+	} {
+		if got := r.accountAt(test.height); got != test.want {
+			t.Errorf("accountAt(%d): got %v, want %v", test.height,
+				got.Address.String(), test.want.Address.String())
+		}
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	var records []audit.Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit record: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 1 {
+		t.Fatalf("%d audit records, want 1", len(records))
+	}
+	record := records[0]
+	if record.Object != audit.ObjKey || record.Decision != audit.Rotated ||
+		record.Height != 10 || record.Hash != next.Address.String() {
+		t.Errorf("unexpected audit record %+v", record)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"net"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+)
+
+// policyListener is a listener which tags the connections it accepts with the
+// policy of the listen address.
+type policyListener struct {
+	net.Listener
+	policy chaincfg.ListenPolicy
+}
+
+// policyConn is a connection accepted by a policyListener.
+type policyConn struct {
+	net.Conn
+	policy chaincfg.ListenPolicy
+}
+
+// Accept waits for and returns the next connection tagged with the policy of
+// the listener.
+//
+// This is part of the net.Listener interface.
+func (l *policyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &policyConn{Conn: conn, policy: l.policy}, nil
+}
+
+// newPolicyListener returns a listener applying the configured policy of the
+// passed listen address.
+func newPolicyListener(listener net.Listener, addr string) *policyListener {
+	policy, ok := chaincfg.Cfg.ListenPolicies[addr]
+	if !ok {
+		policy = chaincfg.ListenPublic
+	}
+	return &policyListener{Listener: listener, policy: policy}
+}
+
+// connListenPolicy returns the policy of the listener which accepted the
+// passed connection.
+func connListenPolicy(conn net.Conn) chaincfg.ListenPolicy {
+	if pc, ok := conn.(*policyConn); ok {
+		return pc.policy
+	}
+	return chaincfg.ListenPublic
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// lockUnspentFilename is the name of the file holding the locked outputs in
+// the data directory when they persist across restarts.
+const lockUnspentFilename = "lockunspent.json"
+
+// handleUtxoLockNotification releases the locks of the outputs spent by the
+// connected blocks, including their virtual blocks.
+func (s *NodeServer) handleUtxoLockNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) < 2 {
+		return
+	}
+	block, ok := data[0].(*asiutil.Block)
+	if !ok {
+		return
+	}
+
+	txs := block.Transactions()
+	if vblock, ok := data[1].(*asiutil.VBlock); ok && vblock != nil {
+		txs = append(txs[:len(txs):len(txs)], vblock.Transactions()...)
+	}
+	var spent []protos.OutPoint
+	for _, tx := range txs {
+		for _, txIn := range tx.MsgTx().TxIn {
+			spent = append(spent, txIn.PreviousOutPoint)
+		}
+	}
+	if !s.utxoLocks.Spent(spent) {
+		return
+	}
+	if err := s.utxoLocks.Save(); err != nil {
+		srvrLog.Errorf("Unable to save locked outputs: %v", err)
+	}
+}
+
+// unspentOutput returns an error unless the output is unspent in the main
+// chain or is created by a transaction of the mempool.
+func (s *PublicRpcAPI) unspentOutput(out protos.OutPoint) error {
+	if tx, _, err := s.cfg.TxMemPool.FetchTransaction(&out.Hash); err == nil {
+		if int(out.Index) < len(tx.MsgTx().TxOut) {
+			return nil
+		}
+	} else {
+		entry, err := s.cfg.Chain.FetchUtxoEntry(out)
+		if err != nil {
+			return internalRPCError(err.Error(), "Failed to fetch output")
+		}
+		if entry != nil && !entry.IsSpent() {
+			return nil
+		}
+	}
+	return &rpcjson.RPCError{
+		Code:    rpcjson.ErrRPCInvalidParameter,
+		Message: fmt.Sprintf("Output %v is unknown or spent", out),
+	}
+}
+
+// LockUnspent locks or unlocks the passed outputs, so the external transaction
+// builders sharing the node do not spend them in several transactions.  The
+// locked outputs are not selected by sweepAddresses nor by the consolidations,
+// and are released once a connected block spends them.  Unlocking an empty
+// list releases all the locks.  Either all the outputs are locked or unlocked,
+// or none is.  The locks persist across restarts with --persistlockunspent.
+func (s *PublicRpcAPI) LockUnspent(unlock bool, transactions []rpcjson.TransactionInput) (interface{}, error) {
+	locks := s.cfg.UtxoLocks
+	if unlock && len(transactions) == 0 {
+		locks.UnlockAll()
+	} else {
+		outs := make([]protos.OutPoint, 0, len(transactions))
+		for _, input := range transactions {
+			hash, err := decodeHashStr(input.Txid)
+			if err != nil {
+				return nil, err
+			}
+			outs = append(outs, protos.OutPoint{Hash: *hash, Index: input.Vout})
+		}
+
+		if unlock {
+			if err := locks.Unlock(outs); err != nil {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCInvalidParameter,
+					Message: err.Error(),
+				}
+			}
+		} else {
+			for _, out := range outs {
+				if err := s.unspentOutput(out); err != nil {
+					return nil, err
+				}
+			}
+			if err := locks.Lock(outs); err != nil {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCInvalidParameter,
+					Message: err.Error(),
+				}
+			}
+		}
+	}
+
+	if err := locks.Save(); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to save locked outputs")
+	}
+	return true, nil
+}
+
+// ListLockUnspent returns the outputs locked with lockUnspent.
+func (s *PublicRpcAPI) ListLockUnspent() (interface{}, error) {
+	outs := s.cfg.UtxoLocks.List()
+	results := make([]rpcjson.LockedUnspentResult, 0, len(outs))
+	for _, out := range outs {
+		results = append(results, rpcjson.LockedUnspentResult{
+			Txid: out.Hash.String(),
+			Vout: out.Index,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
+)
+
+const (
+	// getLogsMaxResults is the number of logs above which getLogs asks its
+	// client to query a narrower block range.
+	getLogsMaxResults = 10000
+
+	// getLogsMaxRange is the maximum number of blocks whose receipts are
+	// all read by a getLogs query without a contract or a topic.
+	getLogsMaxRange = 10000
+)
+
+// parseLogBlockHeight returns the height of a block of a log filter, which
+// defaults to the best height.
+func parseLogBlockHeight(s *string, best int32) (int32, error) {
+	if s == nil {
+		return best, nil
+	}
+	switch *s {
+	case "latest", "pending":
+		return best, nil
+	case "earliest":
+		return 0, nil
+	}
+	height, err := hexutil.DecodeUint64(*s)
+	if err != nil || height > uint64(best) {
+		return 0, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid block number: " + *s,
+		}
+	}
+	return int32(height), nil
+}
+
+// parseLogTopic decodes a topic of a log filter.
+func parseLogTopic(s string) (common.Hash, error) {
+	topic, err := hexutil.Decode(s)
+	if err != nil || len(topic) != common.HashLength {
+		return common.Hash{}, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid topic: " + s,
+		}
+	}
+	return common.BytesToHash(topic), nil
+}
+
+// matchLog returns whether a log is emitted by one of the passed contracts,
+// when there are any, and has one of the passed topics at each position.  As
+// with eth_getLogs, a log with fewer topics than the filter does not match.
+func matchLog(l *types.Log, addrs []common.Address, topics [][]common.Hash) bool {
+	if len(addrs) > 0 {
+		found := false
+		for _, addr := range addrs {
+			if l.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, position := range topics {
+		if len(position) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range position {
+			if l.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLogCursor returns the height and the number of matching logs of that
+// block of the previous pages of a getLogs query.
+func parseLogCursor(page *rpcjson.PageRequest) (int32, int, error) {
+	position, err := decodeCursor(page, "logs")
+	if err != nil || position == "" {
+		return 0, 0, err
+	}
+	var height int32
+	var skip int
+	_, err = fmt.Sscanf(position, "%d:%d", &height, &skip)
+	if err != nil || height < 0 || skip < 0 {
+		return 0, 0, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid cursor: " + page.Cursor,
+		}
+	}
+	return height, skip, nil
+}
+
+// GetLogs returns the logs of the contracts of the main chain matching the
+// passed filter, in the format of eth_getLogs.  The blocks which may hold
+// matching logs are found with the contract log index when the filter has a
+// contract or a topic.  Without a page, a query returning too many logs fails
+// with the block range to query instead, so clients page through the logs by
+// block range.  When a page is requested, the logs are returned in pages
+// which may split the logs of a block.
+func (s *PublicRpcAPI) GetLogs(filter rpcjson.LogFilter, page *rpcjson.PageRequest) (interface{}, error) {
+	limit := getLogsMaxResults
+	var skip int
+	if page != nil {
+		var err error
+		if limit, err = pageLimit(page); err != nil {
+			return nil, err
+		}
+		var height int32
+		if height, skip, err = parseLogCursor(page); err != nil {
+			return nil, err
+		}
+		if page.Cursor != "" && filter.BlockHash == nil {
+			filter.FromBlock = new(string)
+			*filter.FromBlock = hexutil.EncodeUint64(uint64(height))
+		}
+	}
+
+	addrs := make([]common.Address, 0, len(filter.Address))
+	for _, address := range filter.Address {
+		addr, err := asiutil.DecodeAddress(address)
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + address,
+			}
+		}
+		addrs = append(addrs, common.Address(addr.StandardAddress()))
+	}
+	indexed := len(addrs) > 0
+	topics := make([][]common.Hash, len(filter.Topics))
+	for i, position := range filter.Topics {
+		for _, s := range position {
+			topic, err := parseLogTopic(s)
+			if err != nil {
+				return nil, err
+			}
+			topics[i] = append(topics[i], topic)
+		}
+		indexed = indexed || len(topics[i]) > 0
+	}
+
+	var start, end int32
+	if filter.BlockHash != nil {
+		if filter.FromBlock != nil || filter.ToBlock != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "blockHash may not be used with fromBlock or toBlock",
+			}
+		}
+		hash, err := decodeHashStr(*filter.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		start, err = s.cfg.Chain.BlockHeightByHash(hash)
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCBlockNotFound,
+				Message: "Block not found in the main chain",
+			}
+		}
+		end = start
+	} else {
+		best := s.cfg.Chain.BestSnapshot().Height
+		var err error
+		if start, err = parseLogBlockHeight(filter.FromBlock, best); err != nil {
+			return nil, err
+		}
+		if end, err = parseLogBlockHeight(filter.ToBlock, best); err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "fromBlock is above toBlock",
+			}
+		}
+	}
+
+	var heights []int32
+	if indexed {
+		var err error
+		heights, err = s.cfg.LogIndex.BlocksWithLogs(addrs, topics, start, end)
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "Failed to search the log index")
+		}
+	} else {
+		if end-start >= getLogsMaxRange {
+			return nil, &rpcjson.RPCError{
+				Code: rpcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Queries without an address or a "+
+					"topic span at most %d blocks", getLogsMaxRange),
+			}
+		}
+		for height := start; height <= end; height++ {
+			heights = append(heights, height)
+		}
+	}
+
+	logs := make([]*types.Log, 0)
+	for _, height := range heights {
+		hash, err := s.cfg.Chain.BlockHashByHeight(height)
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "Failed to obtain block hash")
+		}
+		count := len(logs)
+		matched := 0
+		receipts := rawdb.ReadReceipts(s.cfg.Chain.EthDB(), *hash, uint64(height))
+		for _, receipt := range receipts {
+			if receipt == nil {
+				continue
+			}
+			for _, l := range receipt.Logs {
+				if !matchLog(l, addrs, topics) {
+					continue
+				}
+				matched++
+				if height == start && matched <= skip {
+					continue
+				}
+				if page != nil && len(logs) == limit {
+					return rpcjson.PageResult{
+						Items: logs,
+						NextCursor: encodeCursor("logs",
+							fmt.Sprintf("%d:%d", height, matched-1)),
+					}, nil
+				}
+				logs = append(logs, l)
+			}
+		}
+
+		// The logs of a block are never split across pages.
+		if page == nil && len(logs) > getLogsMaxResults && count > 0 {
+			return nil, &rpcjson.RPCError{
+				Code: rpcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Query returned more than %d logs, "+
+					"retry with the range [0x%x, 0x%x]", getLogsMaxResults,
+					start, height-1),
+			}
+		}
+	}
+	if page != nil {
+		return rpcjson.PageResult{Items: logs}, nil
+	}
+	return logs, nil
+}
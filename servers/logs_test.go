@@ -0,0 +1,37 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// TestGetLogsBlockHash ensures the logs of a block are queried with its hash
+// in the form the RPCs return it.
+func TestGetLogsBlockHash(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	blocks, err := g.Generate(1)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	s := &PublicRpcAPI{cfg: &rpcserverConfig{Chain: g.Chain()}}
+	hash := blocks[0].Hash().String()
+	if _, err := s.GetLogs(rpcjson.LogFilter{BlockHash: &hash}, nil); err != nil {
+		t.Errorf("GetLogs: %v", err)
+	}
+
+	hash = hash[2:]
+	if _, err := s.GetLogs(rpcjson.LogFilter{BlockHash: &hash}, nil); err == nil {
+		t.Error("GetLogs with a malformed block hash succeeded")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/AsimovNetwork/asimov/mempool"
+)
+
+// mempoolFilename is the name of the file holding the transactions of the
+// mempool across restarts in the data directory.
+const mempoolFilename = "mempool.dat"
+
+// loadMempool adds the transactions of the passed file to the mempool, once
+// validated again against the best chain.  A missing file is not an error.
+// The file is removed once loaded, so the transactions aren't loaded again
+// after an unclean shutdown.
+func loadMempool(pool *mempool.TxPool, file string) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	accepted, dropped, err := pool.Load(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return err
+	}
+	srvrLog.Infof("Loaded %d mempool transactions, %d dropped as no "+
+		"longer valid", accepted, dropped)
+	return os.Remove(file)
+}
+
+// saveMempool writes the transactions of the mempool to the passed file.  The
+// file is written under a temporary name and renamed once complete.
+func saveMempool(pool *mempool.TxPool, file string) error {
+	tmp := file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	n, err := pool.Save(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	srvrLog.Infof("Saved %d mempool transactions", n)
+	return os.Rename(tmp, file)
+}
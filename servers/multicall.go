@@ -0,0 +1,95 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/vm/fvm"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+)
+
+// maxMulticallSize is the maximum number of calls of a multicall.
+const maxMulticallSize = 256
+
+// Multicall runs many read-only contract calls against the state of the same
+// best block, and returns the result of every call.  Every call runs on its
+// own copy of the state, so the calls cannot observe each other.  A failed
+// call does not fail the others, its error is returned along with its result.
+// The result of a call is decoded when the name of the function and the ABI
+// are given, otherwise it is returned hex-encoded.
+func (s *PublicRpcAPI) Multicall(ctx context.Context, calls []rpcjson.ReadOnlyCall) (interface{}, error) {
+	if len(calls) > maxMulticallSize {
+		return nil, &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Too many calls: %d, at most %d",
+				len(calls), maxMulticallSize),
+		}
+	}
+	if !vmWorkers.Acquire(ctx.Done()) {
+		return nil, rpcCancelledError(ctx)
+	}
+	defer vmWorkers.Release()
+
+	block, stateDB := createTempBlockState(s.cfg)
+	if stateDB == nil {
+		return nil, internalRPCError("failed to load the state", "")
+	}
+
+	results := make([]rpcjson.MulticallResult, len(calls))
+	for i := range calls {
+		if ctx.Err() != nil {
+			return nil, rpcCancelledError(ctx)
+		}
+		result, err := s.readOnlyCall(&calls[i], block, stateDB.Copy())
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Result = result
+	}
+	// The calls run in a block on top of the best block, whose state they
+	// observe.
+	return &rpcjson.MulticallReply{
+		Height:  block.Height() - 1,
+		Hash:    block.MsgBlock().Header.PrevBlock.String(),
+		Results: results,
+	}, nil
+}
+
+// readOnlyCall runs a call of a multicall.
+func (s *PublicRpcAPI) readOnlyCall(call *rpcjson.ReadOnlyCall, block *asiutil.Block,
+	stateDB *state.StateDB) (interface{}, error) {
+
+	callerAddr, err := hexutil.Decode(call.Caller)
+	if err != nil {
+		return nil, fmt.Errorf("invalid caller: %v", err)
+	}
+	contractAddr, err := hexutil.Decode(call.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("invalid contract: %v", err)
+	}
+	input, err := hexutil.Decode(call.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+
+	ret, _, err := fvm.CallReadOnlyFunction(common.BytesToAddress(callerAddr), block,
+		s.cfg.Chain, stateDB, chaincfg.ActiveNetParams.FvmParam,
+		common.SystemContractReadOnlyGas, common.BytesToAddress(contractAddr), input)
+	if err != nil {
+		return nil, err
+	}
+	if call.Name == "" || call.Abi == "" {
+		return hexutil.Encode(ret), nil
+	}
+	return fvm.UnPackReadOnlyResult(call.Abi, call.Name, ret)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// defaultPageLimit is the number of items of a page when the client
+	// does not set a limit.
+	defaultPageLimit = 100
+
+	// maxPageLimit is the maximum number of items of a page.
+	maxPageLimit = 1000
+)
+
+// pageLimit returns the number of items of the requested page.
+func pageLimit(page *rpcjson.PageRequest) (int, error) {
+	if page.Limit == 0 {
+		return defaultPageLimit, nil
+	}
+	if page.Limit < 0 || page.Limit > maxPageLimit {
+		return 0, &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("The page limit must be between 1 and %d",
+				maxPageLimit),
+		}
+	}
+	return page.Limit, nil
+}
+
+// encodeCursor returns the opaque cursor of a position in the items of the
+// named list command.
+func encodeCursor(method, position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(method + ":" + position))
+}
+
+// decodeCursor returns the position of the cursor of the requested page in
+// the items of the named list command, which is empty for the first page.
+func decodeCursor(page *rpcjson.PageRequest, method string) (string, error) {
+	if page.Cursor == "" {
+		return "", nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	prefix := method + ":"
+	if err != nil || !strings.HasPrefix(string(decoded), prefix) ||
+		len(decoded) == len(prefix) {
+
+		return "", &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid cursor: " + page.Cursor,
+		}
+	}
+	return string(decoded[len(prefix):]), nil
+}
+
+// keysetPage returns the range [from, to) of the page of up to limit items
+// following the position of a cursor, in a list of n items sorted by key.
+// after reports whether the key of an item follows the position, which is
+// empty for the first page.  A cursor remains valid when items are added to
+// or removed from the list.
+func keysetPage(n int, position string, limit int, after func(i int) bool) (int, int) {
+	from := 0
+	if position != "" {
+		from = sort.Search(n, after)
+	}
+	to := from + limit
+	if to > n {
+		to = n
+	}
+	return from, to
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"time"
+
+	"github.com/AsimovNetwork/asimov/addrmgr"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/peer"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// peerStatsFilename is the name of the file holding the statistics of
+	// the peers in the data directory.
+	peerStatsFilename = "peerstats.json"
+
+	// peerStatsSaveInterval is the interval between two saves of the
+	// statistics of the peers.
+	peerStatsSaveInterval = time.Minute * 10
+
+	// goodPeerTries is the number of tries of picking a new outbound
+	// address during which only the network groups with a positive score
+	// are accepted.
+	goodPeerTries = 10
+
+	// badPeerTries is the number of tries of picking a new outbound
+	// address during which the network groups with a negative score are
+	// skipped.
+	badPeerTries = 30
+)
+
+// statsGroup returns the key of the statistics of the peer, or an empty string
+// when they are not recorded.  The peers of a Tor listener all share the
+// network group of the Tor daemon, so they are not recorded.
+func (sp *serverPeer) statsGroup() string {
+	na := sp.NA()
+	if na == nil || sp.listenPolicy == chaincfg.ListenTor {
+		return ""
+	}
+	return addrmgr.GroupKey(na)
+}
+
+// OnPong is invoked when a peer receives a pong message.  It records the
+// latency of the peer.
+func (sp *serverPeer) OnPong(_ *peer.Peer, _ *protos.MsgPong) {
+	group := sp.statsGroup()
+	if ping := sp.LastPingMicros(); group != "" && ping > 0 {
+		sp.server.peerStats.AddLatency(group, time.Duration(ping)*time.Microsecond)
+	}
+}
+
+// OnMisbehavior is invoked when the ban score of a peer is increased.  It
+// records the invalid message of the peer.
+func (sp *serverPeer) OnMisbehavior(_ *peer.Peer, _ string) {
+	if group := sp.statsGroup(); group != "" {
+		sp.server.peerStats.AddInvalid(group)
+	}
+}
+
+// acceptsOutboundGroup returns whether a new outbound connection may be made
+// to the network group after the passed number of tries.  The historically
+// good groups are preferred in the first tries and the bad ones are avoided
+// until many tries failed.
+func (s *NodeServer) acceptsOutboundGroup(key string, tries int) bool {
+	score := s.peerStats.Score(key)
+	switch {
+	case tries < goodPeerTries:
+		return score > 0
+	case tries < badPeerTries:
+		return score >= 0
+	}
+	return true
+}
+
+// peerStatsHandler periodically saves the statistics of the peers, and once
+// more on shutdown.  It must be run with goSupervised.
+func (s *NodeServer) peerStatsHandler() {
+	ticker := time.NewTicker(peerStatsSaveInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			break out
+		}
+		if err := s.peerStats.Save(); err != nil {
+			srvrLog.Errorf("Unable to save peer statistics: %v", err)
+		}
+	}
+	if err := s.peerStats.Save(); err != nil {
+		srvrLog.Errorf("Unable to save peer statistics: %v", err)
+	}
+}
+
+// GetPeerStats returns the long-term statistics of the peers by network group,
+// from the best to the worst score.
+func (s *PublicRpcAPI) GetPeerStats() (interface{}, error) {
+	stats := s.cfg.PeerStats.Stats()
+	results := make([]rpcjson.PeerStatsResult, 0, len(stats))
+	for _, st := range stats {
+		results = append(results, rpcjson.PeerStatsResult{
+			Group:      st.Group,
+			Sessions:   st.Sessions,
+			Uptime:     int64(st.Uptime / time.Second),
+			Blocks:     st.Blocks,
+			Invalid:    st.Invalid,
+			LatencyP50: int64(st.LatencyP50 / time.Millisecond),
+			LatencyP90: int64(st.LatencyP90 / time.Millisecond),
+			LatencyP99: int64(st.LatencyP99 / time.Millisecond),
+			LastSeen:   st.LastSeen.Unix(),
+			Score:      st.Score,
+		})
+	}
+	return results, nil
+}
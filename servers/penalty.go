@@ -0,0 +1,63 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// GetValidatorPenalties returns the penalties applied to the validators whose
+// equivocations or invalid blocks were seen, and whether they still apply to
+// the blocks of the current round.
+func (s *PublicRpcAPI) GetValidatorPenalties() (interface{}, error) {
+	round := s.cfg.Chain.BestSnapshot().Round
+	penalties := s.cfg.Chain.ValidatorPenalties()
+	result := make([]rpcjson.ValidatorPenaltyResult, 0, len(penalties))
+	for _, p := range penalties {
+		blocks := make([]string, 0, len(p.Blocks))
+		for _, hash := range p.Blocks {
+			blocks = append(blocks, hash.String())
+		}
+		result = append(result, rpcjson.ValidatorPenaltyResult{
+			Validator: p.Validator.String(),
+			Kind:      string(p.Kind),
+			Mode:      string(p.Mode),
+			Round:     p.Round,
+			Expires:   p.Expires,
+			Active:    p.Expires == 0 || round <= p.Expires,
+			Blocks:    blocks,
+			Reason:    p.Reason,
+			Time:      p.Time,
+		})
+	}
+	return result, nil
+}
+
+// ClearValidatorPenalty lifts the penalty applied to a validator, once an
+// operator established it was not malicious.
+func (s *PublicRpcAPI) ClearValidatorPenalty(validator string) (interface{}, error) {
+	addr, err := asiutil.DecodeAddress(validator)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	cleared, err := s.cfg.Chain.ClearValidatorPenalty(common.Address(addr.StandardAddress()))
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to clear the validator penalty")
+	}
+	if !cleared {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Validator is not penalized: " + validator,
+		}
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
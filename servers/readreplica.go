@@ -0,0 +1,67 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// errReadReplica is returned by the calls which would change a node running
+// as a read replica, or need its peers or consensus.
+var errReadReplica = &rpcjson.RPCError{
+	Code:    rpcjson.ErrRPCMisc,
+	Message: "Not available on a read replica",
+}
+
+// rpcReplicaMethods are the methods which may be called on a read replica.
+// They are the public methods but sendRawTransaction, along with the admin
+// methods which only read the chain or the state of the node.
+var rpcReplicaMethods = func() map[string]struct{} {
+	methods := make(map[string]struct{})
+	for _, method := range rpcPublicMethods {
+		if method != "asimov_sendRawTransaction" {
+			methods[method] = struct{}{}
+		}
+	}
+	for _, method := range []string{
+		"asimov_diffSystemContract",
+		"asimov_exportAccounting",
+		"asimov_getBlockArrivalStats",
+		"asimov_getCompactionInfo",
+		"asimov_getConsensusMiningInfo",
+		"asimov_getKeyRotation",
+		"asimov_getMergeUtxoStatus",
+		"asimov_getRPCCacheInfo",
+		"asimov_getRPCMetrics",
+		"asimov_getRPCUsage",
+		"asimov_getRoundReport",
+		"asimov_getSignUpStatus",
+		"asimov_getSlowLog",
+		"asimov_getStateCommitment",
+		"asimov_getSupervisorInfo",
+		"asimov_getUtxoFragmentation",
+		"asimov_getValidatorPenalties",
+		"asimov_getWorkerPools",
+		"asimov_listDepositAddresses",
+		"asimov_listLockUnspent",
+		"asimov_upTime",
+		"asimov_verifySystemContracts",
+	} {
+		methods[method] = struct{}{}
+	}
+	return methods
+}()
+
+// FilterMethod rejects, on a read replica, the methods which are not listed in
+// rpcReplicaMethods.  It implements rpc.MethodFilter.
+func (s *PublicRpcAPI) FilterMethod(method string) error {
+	if !s.cfg.ReadReplica {
+		return nil
+	}
+	if _, ok := rpcReplicaMethods[method]; !ok {
+		return errReadReplica
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+)
+
+// TestRPCReplicaMethods ensures a read replica rejects every RPC method which
+// is not listed in rpcReplicaMethods, mutating methods among them, and that
+// the listed methods exist.
+func TestRPCReplicaMethods(t *testing.T) {
+	replica := &PublicRpcAPI{cfg: &rpcserverConfig{ReadReplica: true}}
+	node := &PublicRpcAPI{cfg: &rpcserverConfig{}}
+
+	methods := make(map[string]struct{})
+	typ := reflect.TypeOf(&PublicRpcAPI{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		name := []rune(typ.Method(i).Name)
+		name[0] = unicode.ToLower(name[0])
+		method := "asimov_" + string(name)
+		methods[method] = struct{}{}
+
+		_, listed := rpcReplicaMethods[method]
+		err := replica.FilterMethod(method)
+		if listed && err != nil {
+			t.Errorf("replica method %s rejected: %v", method, err)
+		}
+		if !listed && err != errReadReplica {
+			t.Errorf("method %s allowed on a replica", method)
+		}
+		if err := node.FilterMethod(method); err != nil {
+			t.Errorf("method %s rejected on a node: %v", method, err)
+		}
+	}
+
+	for method := range rpcReplicaMethods {
+		if !strings.HasPrefix(method, "asimov_") {
+			continue
+		}
+		if _, ok := methods[method]; !ok {
+			t.Errorf("replica method %s does not exist", method)
+		}
+	}
+	for _, method := range []string{
+		"asimov_sendRawTransaction", "asimov_deployContract",
+		"asimov_generate", "asimov_getBlockTemplate", "asimov_signBlock",
+		"asimov_invalidateBlock", "asimov_reconsiderBlock", "asimov_setBan",
+		"asimov_addNode", "asimov_lockUnspent", "asimov_compactDatabase",
+	} {
+		if _, ok := rpcReplicaMethods[method]; ok {
+			t.Errorf("mutating method %s allowed on a replica", method)
+		}
+	}
+}
+
+// TestReadReplicaServer ensures the RPC server of a read replica refuses the
+// calls of the methods it rejects.
+func TestReadReplicaServer(t *testing.T) {
+	server := rpc.NewServer()
+	api := &PublicRpcAPI{cfg: &rpcserverConfig{
+		ReadReplica: true,
+		StartupTime: time.Now().Unix(),
+	}}
+	if err := server.RegisterName("asimov", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var upTime int64
+	if err := client.Call(&upTime, "asimov_upTime"); err != nil {
+		t.Fatalf("upTime: %v", err)
+	}
+	var result interface{}
+	err := client.Call(&result, "asimov_sendRawTransaction", "00")
+	if err == nil || err.Error() != errReadReplica.Error() {
+		t.Fatalf("sendRawTransaction on a replica returned %v", err)
+	}
+	if err := client.Call(&result, "asimov_filterMethod", "asimov_upTime"); err == nil {
+		t.Fatal("the filter is callable as a method")
+	}
+}
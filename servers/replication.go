@@ -0,0 +1,89 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"net"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/replication"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// newReplication sets up the replication primary and secondary of the node
+// according to the configuration.
+//
+// The primary streams the blocks with their virtual blocks, receipts and
+// state changes.  The spend journal of a block is not streamed as the
+// secondary rebuilds it while connecting the block to its utxo set.
+func (s *NodeServer) newReplication(cfg *chaincfg.FConfig) error {
+	if cfg.ReplicaListen != "" {
+		listener, err := net.Listen("tcp", cfg.ReplicaListen)
+		if err != nil {
+			return err
+		}
+		s.replPrimary = replication.NewPrimary(&replication.PrimaryConfig{
+			Secret: []byte(cfg.ReplicaSecret),
+			BestHeight: func() int32 {
+				return s.chain.BestSnapshot().Height
+			},
+			BlockHash:   s.chain.BlockHashByHeight,
+			EncodeBlock: s.chain.EncodeReplicaBlock,
+		}, listener)
+		s.chain.Subscribe(s.supervised("replication", s.handleReplicationNotification))
+	}
+
+	if cfg.ReplicaPrimary != "" {
+		s.replSecondary = replication.NewSecondary(&replication.SecondaryConfig{
+			Primary: cfg.ReplicaPrimary,
+			Secret:  []byte(cfg.ReplicaSecret),
+			Tip: func() (int32, *common.Hash) {
+				best := s.chain.BestSnapshot()
+				return best.Height, &best.Hash
+			},
+			ConnectBlock: s.chain.ConnectReplicaBlock,
+		})
+	}
+	return nil
+}
+
+// handleReplicationNotification wakes up the replication sessions when a block
+// is connected to the main chain.
+func (s *NodeServer) handleReplicationNotification(notification *blockchain.Notification) {
+	if notification.Type == blockchain.NTBlockConnected {
+		s.replPrimary.Notify()
+	}
+}
+
+// GetReplicationInfo returns the state of the replication to the secondaries
+// and from the primary of the node.
+func (s *PublicRpcAPI) GetReplicationInfo() (interface{}, error) {
+	result := &rpcjson.GetReplicationInfoResult{
+		Secondaries: []rpcjson.ReplicaSecondaryResult{},
+	}
+	if primary := s.cfg.ReplicaPrimary; primary != nil {
+		result.Listen = chaincfg.Cfg.ReplicaListen
+		for _, info := range primary.Secondaries() {
+			result.Secondaries = append(result.Secondaries,
+				rpcjson.ReplicaSecondaryResult{
+					Addr:      info.Addr,
+					Height:    info.Height,
+					Connected: info.Connected.Unix(),
+				})
+		}
+	}
+	if secondary := s.cfg.ReplicaSecondary; secondary != nil {
+		info := secondary.Info()
+		result.Primary = &rpcjson.ReplicaPrimaryResult{
+			Addr:      info.Addr,
+			Connected: info.Connected,
+			Height:    info.Height,
+			LastError: info.LastError,
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// GetRoundReport reports, for a completed round of the main chain, the blocks
+// each validator was expected to produce, produced and missed, the mean
+// fullness of its blocks, their mean arrival delay at the node and the asim
+// fees they collected, for the incentive programs of the validators.
+func (s *PublicRpcAPI) GetRoundReport(round uint32) (interface{}, error) {
+	if best := s.cfg.Chain.BestSnapshot(); round >= best.Round {
+		return nil, &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Round %d is not completed, the best "+
+				"block is in round %d", round, best.Round),
+		}
+	}
+	report, err := s.cfg.Chain.RoundReport(round)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to report the round")
+	}
+
+	result := &rpcjson.GetRoundReportResult{
+		Round:       report.Round,
+		StartHeight: report.StartHeight,
+		EndHeight:   report.EndHeight,
+		Blocks:      report.Blocks,
+		Validators:  make([]rpcjson.ValidatorRoundResult, 0, len(report.Validators)),
+	}
+	for _, v := range report.Validators {
+		result.Validators = append(result.Validators, rpcjson.ValidatorRoundResult{
+			Validator: v.Validator.String(),
+			Expected:  v.Expected,
+			Produced:  v.Produced,
+			Missed:    v.Missed,
+			Fullness:  v.Fullness,
+			Arrivals:  v.Arrivals,
+			MeanDelay: int64(v.MeanDelay / time.Millisecond),
+			Fees:      v.Fees,
+		})
+	}
+	return result, nil
+}
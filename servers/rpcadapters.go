@@ -208,9 +208,41 @@ func (cm *rpcConnManager) AddRebroadcastInventory(iv *protos.InvVect, data inter
 }
 
 // RelayTransactions generates and relays inventory vectors for all of the
-// passed transactions to all connected peers.
+// passed transactions to all connected peers, reports the deposits they
+// pay, tracks their confirmation for the fee estimates and wakes up the
+// getBlockTemplate long polls.
 func (cm *rpcConnManager) RelayTransactions(txns []*mining.TxDesc) {
 	cm.server.relayTransactions(txns)
+	cm.server.notifyPendingDeposits(txns)
+	cm.server.observeFees(txns)
+	cm.server.gbtLongPoll.notifyNewTransactions(txns)
+	cm.server.notifyDevTxs(txns)
+}
+
+// BanList returns the banned hosts along with their ban.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) BanList() map[string]banEntry {
+	return cm.server.BanList()
+}
+
+// AddBans bans the passed hosts and returns the number of bans which were
+// added or extended.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) AddBans(bans map[string]banEntry) int {
+	return cm.server.AddBans(bans)
+}
+
+// RemoveBans lifts the bans of the passed hosts, or of all the hosts when none
+// is passed, and returns the number of bans which were lifted.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) RemoveBans(hosts []string) int {
+	return cm.server.RemoveBans(hosts)
 }
 
 // rpcSyncMgr provides a block manager for use with the RPC NodeServer and
@@ -263,3 +295,21 @@ func (b *rpcSyncMgr) LocateHeaders(locators []*common.Hash, hashStop *common.Has
 func (b *rpcSyncMgr) ListPeerStates() []string {
 	return b.syncMgr.ListPeerStates()
 }
+
+// RequestBlock requests the block with the passed hash and height from the
+// peer with the passed id.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) RequestBlock(hash *common.Hash, height int32, peerID int32) error {
+	return b.syncMgr.RequestBlock(hash, height, peerID)
+}
+
+// ProcessBlock processes the block of the passed template like the blocks
+// produced by the consensus, and returns whether it is an orphan.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) ProcessBlock(template *mining.BlockTemplate, flags common.BehaviorFlags) (bool, error) {
+	return b.syncMgr.ProcessBlock(template, flags)
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// rpcCacheEntry is a cached RPC response.
+type rpcCacheEntry struct {
+	key   string
+	value interface{}
+	size  int
+
+	// block is the hash of the block the response depends on and height
+	// its height, used to invalidate the response when the block is
+	// disconnected and to refresh the fields depending on the best chain.
+	block  common.Hash
+	height int32
+}
+
+// rpcCache is a memory bounded LRU cache of the responses to RPC calls whose
+// inputs identify immutable data, such as blocks by hash and confirmed
+// transactions.  The responses depending on a block are dropped when the
+// block is disconnected from the main chain.  Fields changing with the best
+// chain, such as the number of confirmations, are refreshed on every hit.
+//
+// All methods may be called on a nil cache, which caches nothing.
+type rpcCache struct {
+	mtx      sync.Mutex
+	maxBytes int
+	size     int
+	lru      *list.List
+	entries  map[string]*list.Element
+	byBlock  map[common.Hash]map[string]struct{}
+
+	// generation is incremented by every invalidation so responses computed
+	// across an invalidation are not cached.
+	generation uint64
+
+	hits   uint64
+	misses uint64
+}
+
+// newRPCCache returns a cache holding at most maxBytes of responses, or nil
+// when maxBytes is zero.
+func newRPCCache(maxBytes int) *rpcCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &rpcCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		byBlock:  make(map[common.Hash]map[string]struct{}),
+	}
+}
+
+// rpcCacheKey returns the cache key of a call of the method with the passed
+// arguments.
+func rpcCacheKey(method string, args ...interface{}) string {
+	return fmt.Sprint(method, args)
+}
+
+// get returns the cached response of the passed key.
+func (c *rpcCache) get(key string) (*rpcCacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*rpcCacheEntry), true
+}
+
+// snapshot returns the current generation of the cache, which must be passed
+// to add along with a response computed afterwards.
+func (c *rpcCache) snapshot() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.generation
+}
+
+// add caches the response to the passed key, unless the cache was invalidated
+// since the passed generation.
+func (c *rpcCache) add(generation uint64, key string, value interface{},
+	block common.Hash, height int32) {
+
+	if c == nil {
+		return
+	}
+	size := len(key)
+	if s, ok := value.(string); ok {
+		size += len(s)
+	} else {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		size += len(data)
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	entry := &rpcCacheEntry{
+		key:    key,
+		value:  value,
+		size:   size,
+		block:  block,
+		height: height,
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	keys, ok := c.byBlock[block]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.byBlock[block] = keys
+	}
+	keys[key] = struct{}{}
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops a cached response.  It must be called with the lock held.
+func (c *rpcCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*rpcCacheEntry)
+	delete(c.entries, entry.key)
+	if keys, ok := c.byBlock[entry.block]; ok {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.byBlock, entry.block)
+		}
+	}
+	c.size -= entry.size
+}
+
+// invalidateBlock drops the cached responses depending on the passed block.
+func (c *rpcCache) invalidateBlock(hash common.Hash) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.generation++
+	for key := range c.byBlock[hash] {
+		c.remove(c.entries[key])
+	}
+}
+
+// info returns the usage of the cache.
+func (c *rpcCache) info() *rpcjson.GetRPCCacheInfoResult {
+	if c == nil {
+		return &rpcjson.GetRPCCacheInfoResult{}
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return &rpcjson.GetRPCCacheInfoResult{
+		Enabled: true,
+		Entries: len(c.entries),
+		Size:    c.size,
+		MaxSize: c.maxBytes,
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// handleRPCCacheNotification drops the cached responses of the blocks
+// disconnected from the main chain.
+func (s *NodeServer) handleRPCCacheNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockDisconnected {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) == 0 {
+		return
+	}
+	if block, ok := data[0].(*asiutil.Block); ok {
+		s.rpcCache.invalidateBlock(*block.Hash())
+	}
+}
+
+// refreshCachedResponse returns a copy of a cached response with the fields
+// depending on the best chain brought up to date.
+func (s *PublicRpcAPI) refreshCachedResponse(entry *rpcCacheEntry) (interface{}, error) {
+	best := s.cfg.Chain.BestSnapshot()
+	confirmations := int64(1 + best.Height - entry.height)
+	nextHash := func() (string, error) {
+		if entry.height >= best.Height {
+			return "", nil
+		}
+		nextHash, err := s.cfg.Chain.BlockHashByHeight(entry.height + 1)
+		if err != nil {
+			context := "Failed to obtain next block"
+			return "", internalRPCError(err.Error(), context)
+		}
+		return nextHash.UnprefixString(), nil
+	}
+
+	switch v := entry.value.(type) {
+	case rpcjson.GetBlockVerboseResult:
+		next, err := nextHash()
+		if err != nil {
+			return nil, err
+		}
+		v.Confirmations = confirmations
+		v.NextHash = next
+		return v, nil
+
+	case rpcjson.GetBlockHeaderVerboseResult:
+		next, err := nextHash()
+		if err != nil {
+			return nil, err
+		}
+		v.Confirmations = confirmations
+		v.NextHash = next
+		return v, nil
+
+	case rpcjson.TxRawResult:
+		v.Confirmations = confirmations
+		return v, nil
+
+	case rpcjson.TxResult:
+		v.Confirmations = confirmations
+		return v, nil
+	}
+	return entry.value, nil
+}
+
+// GetRPCCacheInfo returns the usage of the RPC response cache.
+func (s *PublicRpcAPI) GetRPCCacheInfo() (interface{}, error) {
+	return s.cfg.RPCCache.info(), nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/testutil"
+)
+
+// TestRPCCacheReorg ensures a reorganization evicts the cached responses of
+// the disconnected blocks, and refreshes the fields depending on the best
+// chain of the responses kept.
+func TestRPCCacheReorg(t *testing.T) {
+	g, err := testutil.New(&testutil.Config{})
+	if err != nil {
+		t.Fatalf("testutil.New: %v", err)
+	}
+	defer g.Close()
+	blocks, err := g.Generate(4)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	cache := newRPCCache(1 << 20)
+	server := &NodeServer{rpcCache: cache}
+	g.Chain().Subscribe(server.handleRPCCacheNotification)
+	s := &PublicRpcAPI{cfg: &rpcserverConfig{Chain: g.Chain(), RPCCache: cache}}
+	for _, block := range blocks {
+		if _, err := s.GetBlockHeader(block.Hash().String(), true); err != nil {
+			t.Fatalf("GetBlockHeader: %v", err)
+		}
+		if _, err := s.GetBlockHeader(block.Hash().String(), false); err != nil {
+			t.Fatalf("GetBlockHeader: %v", err)
+		}
+	}
+	if entries := cache.info().Entries; entries != 8 {
+		t.Fatalf("%d cached responses, want 8", entries)
+	}
+
+	// Replace the blocks 3 and 4 by a longer fork.
+	fork, err := g.Fork(2)
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	defer fork.Close()
+	fork.Skip(1)
+	forkBlocks, err := fork.Generate(3)
+	if err != nil {
+		t.Fatalf("Generate fork: %v", err)
+	}
+	if err := g.Process(forkBlocks...); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if *g.Tip().Hash() != *fork.Tip().Hash() {
+		t.Fatalf("tip %v, want the fork tip %v", g.Tip().Hash(), fork.Tip().Hash())
+	}
+
+	if entries := cache.info().Entries; entries != 4 {
+		t.Fatalf("%d cached responses after the reorganization, want 4", entries)
+	}
+	for i, block := range blocks {
+		hash := block.Hash().UnprefixString()
+		for _, verbose := range []bool{true, false} {
+			_, ok := cache.get(rpcCacheKey("getblockheader", hash, verbose))
+			if disconnected := i >= 2; ok == disconnected {
+				t.Errorf("block %d: response cached %v, disconnected %v",
+					i+1, ok, disconnected)
+			}
+		}
+	}
+
+	reply, err := s.GetBlockHeader(blocks[1].Hash().String(), true)
+	if err != nil {
+		t.Fatalf("GetBlockHeader: %v", err)
+	}
+	header := reply.(rpcjson.GetBlockHeaderVerboseResult)
+	if header.Confirmations != 4 || header.NextHash != forkBlocks[0].Hash().UnprefixString() {
+		t.Errorf("cached header not refreshed: confirmations %d, next %s, "+
+			"want 4 and %s", header.Confirmations, header.NextHash,
+			forkBlocks[0].Hash().UnprefixString())
+	}
+}
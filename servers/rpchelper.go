@@ -7,10 +7,14 @@ package servers
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/ainterface"
+	"github.com/AsimovNetwork/asimov/replication"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
 	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/supervisor"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/vm"
 	"github.com/AsimovNetwork/asimov/vm/fvm/params"
 	"math/rand"
@@ -18,17 +22,23 @@ import (
 	"time"
 
 	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/audit"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/blockchain/indexers"
 	"github.com/AsimovNetwork/asimov/chaincfg"
 	"github.com/AsimovNetwork/asimov/common"
 	fnet "github.com/AsimovNetwork/asimov/common/net"
+	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/deposits"
+	"github.com/AsimovNetwork/asimov/feeestimator"
 	"github.com/AsimovNetwork/asimov/mempool"
 	"github.com/AsimovNetwork/asimov/mining"
 	"github.com/AsimovNetwork/asimov/peer"
+	"github.com/AsimovNetwork/asimov/peerstats"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/utxolock"
 )
 
 const (
@@ -36,6 +46,23 @@ const (
 	maxProtocolVersion = 1
 )
 
+// errSafeMode is returned by the methods sending transactions while the chain
+// is in safe mode.
+var errSafeMode = &rpcjson.RPCError{
+	Code:    rpcjson.ErrRPCMisc,
+	Message: "Safe mode: the chain is unstable, call acknowledgeSafeMode once it was checked",
+}
+
+// rpcCancelledError is a convenience function for returning the error of a
+// call whose context was cancelled because the client went away or the node
+// is shutting down.
+func rpcCancelledError(ctx context.Context) *rpcjson.RPCError {
+	return &rpcjson.RPCError{
+		Code:    rpcjson.ErrRPCMisc,
+		Message: "Request cancelled: " + ctx.Err().Error(),
+	}
+}
+
 // internalRPCError is a convenience function to convert an internal error to
 // an RPC error with the appropriate code set.  It also logs the error to the
 // RPC NodeServer subsystem since internal errors really should not occur.  The
@@ -58,6 +85,16 @@ func rpcDecodeHexError(gotHex string) *rpcjson.RPCError {
 			gotHex))
 }
 
+// decodeHashStr decodes a block or transaction hash in the hex form returned
+// by the RPCs.  Unlike common.HexToHash, it rejects a malformed hash.
+func decodeHashStr(hashStr string) (*common.Hash, error) {
+	hash, err := common.ParseHash(hashStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hashStr)
+	}
+	return hash, nil
+}
+
 // rpcNoTxInfoError is a convenience function for returning a nicely formatted
 // RPC error which indicates there is no information available for the provided
 // transaction hash.
@@ -67,6 +104,20 @@ func rpcNoTxInfoError(txHash *common.Hash) *rpcjson.RPCError {
 			txHash))
 }
 
+// rpcPrunedTxError is a convenience function for returning a nicely formatted
+// RPC error which indicates the block of a transaction was pruned.
+func rpcPrunedTxError(txHash *common.Hash) *rpcjson.RPCError {
+	return rpcjson.NewRPCError(rpcjson.ErrRPCNoTxInfo,
+		fmt.Sprintf("The block of transaction %v was pruned", txHash))
+}
+
+// isBlockNotFoundErr returns whether the passed error is a database error
+// about a block which is not stored, such as a pruned block.
+func isBlockNotFoundErr(err error) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == database.ErrBlockNotFound
+}
+
 // messageToHex serializes a message to the protos protocol encoding using the
 // latest protocol version and returns a hex-encoded string of the result.
 func messageToHex(msg protos.Message) (string, error) {
@@ -361,6 +412,9 @@ func fetchInputTxos(rpcCfg rpcserverConfig, tx *protos.MsgTx) (map[protos.OutPoi
 			return err
 		})
 
+		if isBlockNotFoundErr(err) {
+			return nil, rpcPrunedTxError(&origin.Hash)
+		}
 		if err != nil {
 			return nil, internalRPCError(err.Error(), origin.Hash.String())
 		}
@@ -556,6 +610,10 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int32
+
+	// ASN returns the AS of the peer according to the AS map, or 0 when it
+	// is unknown.
+	ASN() uint32
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -617,6 +675,18 @@ type rpcserverConnManager interface {
 	// RelayTransactions generates and relays inventory vectors for all of
 	// the passed transactions to all connected peers.
 	RelayTransactions(txns []*mining.TxDesc)
+
+	// BanList returns the banned hosts along with their ban.
+	BanList() map[string]banEntry
+
+	// AddBans bans the passed hosts, disconnecting them when connected, and
+	// returns the number of bans which were added or extended.
+	AddBans(bans map[string]banEntry) int
+
+	// RemoveBans lifts the bans of the passed hosts, or of all the hosts
+	// when none is passed, and returns the number of bans which were
+	// lifted.
+	RemoveBans(hosts []string) int
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC NodeServer.
@@ -643,6 +713,16 @@ type rpcserverSyncManager interface {
 
 	// ListPeerStates returns peer addresses formatted string
 	ListPeerStates() []string
+
+	// RequestBlock requests the block with the passed hash and height from
+	// the peer with the passed id, bypassing the normal block download
+	// scheduling.  A peer id of 0 selects a peer which announced the height.
+	RequestBlock(hash *common.Hash, height int32, peerID int32) error
+
+	// ProcessBlock processes the block of the passed template like the
+	// blocks produced by the consensus, and returns whether it is an
+	// orphan.
+	ProcessBlock(template *mining.BlockTemplate, flags common.BehaviorFlags) (bool, error)
 }
 
 // rpcserverContractManager represents a contract manager for use with the RPC NodeServer.
@@ -654,6 +734,10 @@ type rpcserverContractManager interface {
 	// Get contract information at a given block height
 	GetActiveContractByHeight(height int32, contractAddr common.ContractCode) *chaincfg.ContractInfo
 
+	// GetContractVersions returns all the versions of a system contract
+	// ordered by activation height, including the scheduled ones.
+	GetContractVersions(contractAddr common.ContractCode) []chaincfg.ContractInfo
+
 	// Get issuing contract address of a given asset
 	GetContractAddressByAsset(
 		gas uint64,
@@ -735,10 +819,74 @@ type rpcserverConfig struct {
 	// of to provide additional data when queried.
 	TxIndex   *indexers.TxIndex
 	AddrIndex *indexers.AddrIndex
+	LogIndex  *indexers.LogIndex
 	CfIndex   *indexers.CfIndex
 
 	Nap fnet.NetAdapter
 
+	// Compactor compacts the databases on request.
+	Compactor *dbCompactor
+
+	// AuditLog records the acceptance decisions of the transactions
+	// submitted through RPC.  It may be nil.
+	AuditLog *audit.Log
+
+	// Account is the validator account of the node.  It is nil when no
+	// private key is configured.
+	Account *crypto.Account
+
+	// KeyRotation schedules the switch of the validator key.  It is nil
+	// when no rotation is configured.
+	KeyRotation *keyRotation
+
+	// Quotas enforces the limits of the RPC API keys.  It is nil when API
+	// keys are disabled.
+	Quotas *rpc.Quotas
+
+	// CallStats records the latency of the RPC calls and logs the slow
+	// ones.
+	CallStats *rpc.CallStats
+
+	// RPCCache caches the responses of the calls for immutable data.  It
+	// may be nil.
+	RPCCache *rpcCache
+
+	// TemplateCache caches the templates of the template warehouse.
+	TemplateCache *templateCache
+
+	// ReplicaPrimary and ReplicaSecondary report the state of the
+	// replication.  They may be nil.
+	ReplicaPrimary   *replication.Primary
+	ReplicaSecondary *replication.Secondary
+
+	// Supervisor recovers the panics of the subsystems.
+	Supervisor *supervisor.Supervisor
+
+	// PeerStats keeps the long-term statistics of the peers.
+	PeerStats *peerstats.Store
+
+	// Deposits tracks the deposits of the watched addresses.  It is nil
+	// unless the exchange mode is enabled.
+	Deposits *deposits.Tracker
+
+	// UtxoLocks holds the outputs locked with lockunspent.
+	UtxoLocks *utxolock.Set
+
+	// FeeEstimator estimates the gas prices of the transactions.
+	FeeEstimator *feeestimator.Estimator
+
+	// WsNotifications dispatches the block and transaction notifications
+	// to the websocket subscriptions.
+	WsNotifications *wsNotificationManager
+
+	// GbtLongPoll tracks the staleness of the templates returned by
+	// getBlockTemplate for its long poll requests.
+	GbtLongPoll *gbtLongPoll
+
+	// ReadReplica is set when the node only serves queries from its data
+	// directory, in which case the calls changing the node are refused.
+	ReadReplica bool
+
 	//consensus server
 	ConsensusServer ainterface.Consensus
 
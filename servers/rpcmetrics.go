@@ -0,0 +1,80 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"time"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// rpcRedactedMethods are the methods whose parameters carry private keys, so
+// they are never written to the slow call log.
+var rpcRedactedMethods = []string{
+	"asimov_deployContract",
+	"asimov_getBlockTemplate",
+	"asimov_signBlock",
+}
+
+// durationMs returns the passed duration in milliseconds.
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// GetRPCMetrics returns the number of calls, errors and the latency histogram
+// of every method called since the node started.  When API keys are enabled,
+// it can only be called with an admin key.
+func (s *PublicRpcAPI) GetRPCMetrics() (interface{}, error) {
+	stats := s.cfg.CallStats.Methods()
+	result := make([]rpcjson.RPCMethodMetricsResult, 0, len(stats))
+	for _, m := range stats {
+		r := rpcjson.RPCMethodMetricsResult{
+			Method:  m.Method,
+			Calls:   m.Calls,
+			Errors:  m.Errors,
+			MaxMs:   durationMs(m.Max),
+			Buckets: make([]rpcjson.RPCLatencyBucketResult, 0, len(m.Buckets)),
+		}
+		if m.Calls > 0 {
+			r.AvgMs = durationMs(m.Total / time.Duration(m.Calls))
+		}
+		for i, calls := range m.Buckets {
+			bucket := rpcjson.RPCLatencyBucketResult{Calls: calls}
+			if i < len(rpc.LatencyBuckets) {
+				bucket.MaxMs = durationMs(rpc.LatencyBuckets[i])
+			}
+			r.Buckets = append(r.Buckets, bucket)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// GetSlowLog returns the most recent calls which took longer than the
+// rpcslowcall option, the most recent first, with their sanitized parameters.
+// When API keys are enabled, it can only be called with an admin key.
+func (s *PublicRpcAPI) GetSlowLog() (interface{}, error) {
+	if s.cfg.CallStats.Threshold() == 0 {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "The slow call log is disabled",
+		}
+	}
+	calls := s.cfg.CallStats.SlowLog()
+	result := make([]rpcjson.SlowCallResult, 0, len(calls))
+	for _, call := range calls {
+		result = append(result, rpcjson.SlowCallResult{
+			Time:       call.Time.Unix(),
+			Method:     call.Method,
+			DurationMs: durationMs(call.Duration),
+			Params:     call.Params,
+			Client:     call.Client,
+			APIKey:     call.APIKey,
+			Error:      call.Error,
+		})
+	}
+	return result, nil
+}
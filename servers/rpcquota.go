@@ -0,0 +1,138 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"sort"
+
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// rpcPublicMethods are the methods which may be called with a regular API key
+// when API keys are enabled.  They query the chain or submit transactions,
+// any other method requires an admin key.
+var rpcPublicMethods = []string{
+	"web3_clientVersion",
+	"web3_sha3",
+	"asimov_calculateContractAddress",
+	"asimov_call",
+	"asimov_callReadOnlyFunction",
+	"asimov_createRawTransaction",
+	"asimov_decodeRawTransaction",
+	"asimov_decodeReturn",
+	"asimov_decodeScript",
+	"asimov_encodeCall",
+	"asimov_estimateFee",
+	"asimov_estimateGas",
+	"asimov_estimateSmartFee",
+	"asimov_getAddressBalances",
+	"asimov_getAssetInfoList",
+	"asimov_getBalance",
+	"asimov_getBalances",
+	"asimov_getBestBlock",
+	"asimov_getBlock",
+	"asimov_getBlockChainInfo",
+	"asimov_getBlockHash",
+	"asimov_getBlockHeader",
+	"asimov_getBlockHeight",
+	"asimov_getBlockListByHeight",
+	"asimov_getContractAddressesByAssets",
+	"asimov_getContractExecuteError",
+	"asimov_getContractTemplate",
+	"asimov_getContractTemplateInfoByKey",
+	"asimov_getContractTemplateInfoByName",
+	"asimov_getContractTemplateList",
+	"asimov_getContractTemplateMetadata",
+	"asimov_getContractTemplateName",
+	"asimov_getCurrentNet",
+	"asimov_getFeeList",
+	"asimov_getGasSchedule",
+	"asimov_getGenesisContract",
+	"asimov_getGenesisContractByHeight",
+	"asimov_getLogs",
+	"asimov_getMempoolTransactions",
+	"asimov_getRawTransaction",
+	"asimov_getRoundInfo",
+	"asimov_getScheduledUpgrades",
+	"asimov_getStorageWitness",
+	"asimov_getSystemContracts",
+	"asimov_getTransactionReceipt",
+	"asimov_getTransactionsByAddresses",
+	"asimov_getUtxoByAddress",
+	"asimov_getUtxoInPage",
+	"asimov_getVirtualTransactions",
+	"asimov_listContractTemplates",
+	"asimov_listTransactions",
+	"asimov_multicall",
+	"asimov_notifyBlocks",
+	"asimov_notifyNewTransactions",
+	"asimov_notifyReceived",
+	"asimov_notifySpent",
+	"asimov_searchRawTransactions",
+	"asimov_sendRawTransaction",
+	"asimov_validateAddress",
+}
+
+// newRPCQuotas returns the quotas of the configured API keys, or nil when no
+// key is configured.
+func newRPCQuotas(apiKeys, adminKeys []string) (*rpc.Quotas, error) {
+	if len(apiKeys) == 0 && len(adminKeys) == 0 {
+		return nil, nil
+	}
+	keys := make([]*rpc.APIKey, 0, len(apiKeys)+len(adminKeys))
+	for _, s := range apiKeys {
+		key, err := rpc.ParseAPIKey(s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	for _, s := range adminKeys {
+		key, err := rpc.ParseAPIKey(s)
+		if err != nil {
+			return nil, err
+		}
+		key.Admin = true
+		keys = append(keys, key)
+	}
+	return rpc.NewQuotas(keys, rpcPublicMethods)
+}
+
+// GetRPCUsage returns the number of calls made with every API key, per method,
+// along with the configured daily quotas.  When API keys are enabled, it can
+// only be called with an admin key.
+func (s *PublicRpcAPI) GetRPCUsage() (interface{}, error) {
+	if s.cfg.Quotas == nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "API keys are not enabled",
+		}
+	}
+	usage := s.cfg.Quotas.Usage()
+	result := make([]rpcjson.RPCKeyUsageResult, 0, len(usage))
+	for _, u := range usage {
+		r := rpcjson.RPCKeyUsageResult{
+			Name:     u.Name,
+			Admin:    u.Admin,
+			Calls:    u.Calls,
+			Rejected: u.Rejected,
+			Methods:  make([]rpcjson.RPCMethodUsageResult, 0, len(u.Methods)),
+		}
+		for method, m := range u.Methods {
+			r.Methods = append(r.Methods, rpcjson.RPCMethodUsageResult{
+				Method: method,
+				Today:  m.Today,
+				Total:  m.Total,
+				Quota:  m.Quota,
+			})
+		}
+		sort.Slice(r.Methods, func(i, j int) bool {
+			return r.Methods[i].Method < r.Methods[j].Method
+		})
+		result = append(result, r)
+	}
+	return result, nil
+}
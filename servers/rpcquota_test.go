@@ -0,0 +1,55 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// TestRPCPublicMethods ensures a regular API key is rejected on every RPC
+// method which is not public, and that the public methods exist.
+func TestRPCPublicMethods(t *testing.T) {
+	quotas, err := newRPCQuotas([]string{"alice:a"}, []string{"ops:o"})
+	if err != nil {
+		t.Fatalf("newRPCQuotas: %v", err)
+	}
+
+	public := make(map[string]struct{}, len(rpcPublicMethods))
+	for _, method := range rpcPublicMethods {
+		public[method] = struct{}{}
+	}
+	methods := make(map[string]struct{})
+	typ := reflect.TypeOf(&PublicRpcAPI{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		name := []rune(typ.Method(i).Name)
+		name[0] = unicode.ToLower(name[0])
+		method := "asimov_" + string(name)
+		methods[method] = struct{}{}
+
+		_, isPublic := public[method]
+		err := quotas.Allow("a", method)
+		if isPublic && err != nil {
+			t.Errorf("public method %s rejected: %v", method, err)
+		}
+		if !isPublic && err == nil {
+			t.Errorf("method %s allowed to a regular key", method)
+		}
+		if err := quotas.Allow("o", method); err != nil {
+			t.Errorf("method %s rejected for an admin key: %v", method, err)
+		}
+	}
+
+	for _, method := range rpcPublicMethods {
+		if !strings.HasPrefix(method, "asimov_") {
+			continue
+		}
+		if _, ok := methods[method]; !ok {
+			t.Errorf("public method %s does not exist", method)
+		}
+	}
+}
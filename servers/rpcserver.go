@@ -6,11 +6,13 @@ package servers
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/ainterface"
 	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/audit"
 	"github.com/AsimovNetwork/asimov/blockchain"
 	"github.com/AsimovNetwork/asimov/blockchain/txo"
 	"github.com/AsimovNetwork/asimov/cache"
@@ -21,6 +23,7 @@ import (
 	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/database"
 	"github.com/AsimovNetwork/asimov/mempool"
+	"github.com/AsimovNetwork/asimov/mining"
 	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/rpcs/node"
 	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
@@ -34,6 +37,7 @@ import (
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/vm"
 	"math"
 	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -67,10 +71,40 @@ func (s *PublicRpcAPI) GetBlockChainInfo() (interface{}, error) {
 		Round:         int32(chainSnapshot.Round),
 		Slot:          int16(chainSnapshot.SlotIndex),
 	}
+	chainInfo.Paused, chainInfo.PauseReason = chain.AcceptancePaused()
+	chainInfo.SafeMode, chainInfo.SafeModeReason = chain.SafeMode()
+	chainInfo.ReadReplica = s.cfg.ReadReplica
 
 	return chainInfo, nil
 }
 
+// ResumeBlockAcceptance resumes the acceptance of new blocks after it was
+// paused because a data directory ran out of space.  It fails when the free
+// space is still below the configured threshold.
+func (s *PublicRpcAPI) ResumeBlockAcceptance() (interface{}, error) {
+	if reason := lowDiskSpace(chaincfg.Cfg.MinDiskSpace); reason != "" {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "Not enough disk space: " + reason,
+		}
+	}
+	s.cfg.Chain.ResumeAcceptance()
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
+// AcknowledgeSafeMode leaves the safe mode the chain entered after a deep
+// reorganize or an invalid chain, once an operator checked the chain.
+func (s *PublicRpcAPI) AcknowledgeSafeMode() (interface{}, error) {
+	if err := s.cfg.Chain.AcknowledgeSafeMode(); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to leave safe mode")
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
 func (s *PublicRpcAPI) GetBlockHash(blockHeight int32) (string, error) {
 	hash, err := s.cfg.Chain.BlockHashByHeight(blockHeight)
 	if err != nil {
@@ -123,8 +157,14 @@ func (s *PublicRpcAPI) GetBestBlock() (*rpcjson.GetBestBlockResult, error) {
 }
 
 func (s *PublicRpcAPI) GetBlock(blockHash string, verbose bool, verboseTx bool) (interface{}, error) {
-	// Load the raw block bytes from the database.
 	hash := common.HexToHash(blockHash)
+	key := rpcCacheKey("getblock", hash.UnprefixString(), verbose, verboseTx)
+	if entry, ok := s.cfg.RPCCache.get(key); ok {
+		return s.refreshCachedResponse(entry)
+	}
+	generation := s.cfg.RPCCache.snapshot()
+
+	// Load the raw block bytes from the database.
 	var blkBytes []byte
 	err := s.cfg.DB.View(func(dbTx database.Tx) error {
 		var err error
@@ -141,7 +181,9 @@ func (s *PublicRpcAPI) GetBlock(blockHash string, verbose bool, verboseTx bool)
 	// When the verbose flag isn't set, simply return the serialized block
 	// as a hex-encoded string.
 	if !verbose {
-		return hex.EncodeToString(blkBytes), nil
+		blkHex := hex.EncodeToString(blkBytes)
+		s.cfg.RPCCache.add(generation, key, blkHex, hash, 0)
+		return blkHex, nil
 	}
 
 	// The verbose flag is set, so generate the JSON object and return it.
@@ -198,7 +240,7 @@ func (s *PublicRpcAPI) GetBlock(blockHash string, verbose bool, verboseTx bool)
 		}
 
 		blockReply.Tx = txNames
-	} else {
+	} else if len(blkBytes) < streamBlockSize {
 		txns := blk.Transactions()
 		rawTxns := make([]rpcjson.TxResult, len(txns))
 		for i, tx := range txns {
@@ -226,12 +268,31 @@ func (s *PublicRpcAPI) GetBlock(blockHash string, verbose bool, verboseTx bool)
 		blockReply.PreSigList = sigResults
 	}
 
+	// The transactions of large blocks are streamed to the client as
+	// their results are created, and the response is not cached.
+	if verboseTx && len(blkBytes) >= streamBlockSize {
+		return &blockStream{
+			cfg:        s.cfg,
+			reply:      &blockReply,
+			block:      blk,
+			height:     blockHeight,
+			bestHeight: best.Height,
+		}, nil
+	}
+
+	s.cfg.RPCCache.add(generation, key, blockReply, hash, blockHeight)
 	return blockReply, nil
 }
 
 func (s *PublicRpcAPI) GetBlockHeader(blockHash string, verbose bool) (interface{}, error) {
-	// Fetch the header from chain.
 	hash := common.HexToHash(blockHash)
+	key := rpcCacheKey("getblockheader", hash.UnprefixString(), verbose)
+	if entry, ok := s.cfg.RPCCache.get(key); ok {
+		return s.refreshCachedResponse(entry)
+	}
+	generation := s.cfg.RPCCache.snapshot()
+
+	// Fetch the header from chain.
 	blockHeader, err := s.cfg.Chain.FetchHeader(&hash)
 	if err != nil {
 		return nil, &rpcjson.RPCError{
@@ -249,7 +310,9 @@ func (s *PublicRpcAPI) GetBlockHeader(blockHash string, verbose bool) (interface
 			context := "Failed to serialize block header"
 			return nil, internalRPCError(err.Error(), context)
 		}
-		return hex.EncodeToString(headerBuf.Bytes()), nil
+		headerHex := hex.EncodeToString(headerBuf.Bytes())
+		s.cfg.RPCCache.add(generation, key, headerHex, hash, 0)
+		return headerHex, nil
 	}
 
 	// The verbose flag is set, so generate the JSON object and return it.
@@ -286,6 +349,7 @@ func (s *PublicRpcAPI) GetBlockHeader(blockHash string, verbose bool) (interface
 		GasLimit:     int64(blockHeader.GasLimit),
 		GasUsed:      int64(blockHeader.GasUsed),
 	}
+	s.cfg.RPCCache.add(generation, key, blockHeaderReply, hash, blockHeight)
 	return blockHeaderReply, nil
 }
 
@@ -359,11 +423,14 @@ func (s *PublicRpcAPI) GetBalances(addresses []string) (interface{}, error) {
 	return result, nil
 }
 
-func (s *PublicRpcAPI) GetBlockListByHeight(offset int32, count int32) (interface{}, error) {
+func (s *PublicRpcAPI) GetBlockListByHeight(ctx context.Context, offset int32, count int32) (interface{}, error) {
 	resultBlocks := make([]rpcjson.GetBlockVerboseResult, 0)
 
 	best := s.cfg.Chain.BestSnapshot()
 	for i := int32(0); i < count; i++ {
+		if ctx.Err() != nil {
+			return nil, rpcCancelledError(ctx)
+		}
 		hash, err := s.cfg.Chain.BlockHashByHeight(offset + i)
 		if err != nil {
 			break
@@ -501,7 +568,7 @@ func (s *PublicRpcAPI) makeupUTXO(out protos.OutPoint, e *txo.UtxoEntry, addr *c
 
 // Get list of UTXO of a given asset for all address in the array.
 // If asset is not specified, all assets will be fetched.
-func (s *PublicRpcAPI) GetUtxoByAddress(addresses []string, asset string) (interface{}, error) {
+func (s *PublicRpcAPI) GetUtxoByAddress(ctx context.Context, addresses []string, asset string) (interface{}, error) {
 	var a protos.Asset
 	if asset != "" {
 		aa, err := hex.DecodeString(asset)
@@ -514,6 +581,9 @@ func (s *PublicRpcAPI) GetUtxoByAddress(addresses []string, asset string) (inter
 	utxos := make([]*rpcjson.ListUnspentResult, 0)
 	totalCount := uint32(100)
 	for _, addr := range addresses {
+		if ctx.Err() != nil {
+			return nil, rpcCancelledError(ctx)
+		}
 		byte, err := hexutil.Decode(addr)
 		if err != nil {
 			return nil, internalRPCError(err.Error(), "Failed to decode address")
@@ -666,7 +736,11 @@ func (s *PublicRpcAPI) GetNetTotals() (interface{}, error) {
 }
 
 
-func (s *PublicRpcAPI) CreateRawTransaction(inputs []rpcjson.TransactionInput, outputs []rpcjson.TransactionOutput, lockTime *int64, gasLimit *int32) (interface{}, error) {
+// CreateRawTransaction returns a new unsigned transaction spending the inputs
+// to the outputs.  When simulate is set, the result also holds the size, gas
+// usage and fee predicted by a dry run of the transaction against the best
+// chain and the mempool, so fee mistakes can be detected before signing.
+func (s *PublicRpcAPI) CreateRawTransaction(inputs []rpcjson.TransactionInput, outputs []rpcjson.TransactionOutput, lockTime *int64, gasLimit *int32, accessList *[]rpcjson.AccessTuple, witnesses *[]rpcjson.StorageWitness, simulate *bool) (interface{}, error) {
 
 	// Validate the locktime, if given.
 	if lockTime != nil &&
@@ -840,6 +914,24 @@ func (s *PublicRpcAPI) CreateRawTransaction(inputs []rpcjson.TransactionInput, o
 		mtx.LockTime = uint32(*lockTime)
 	}
 
+	// Set the access list, if given.
+	if accessList != nil {
+		list, err := decodeAccessList(*accessList)
+		if err != nil {
+			return nil, err
+		}
+		mtx.SetAccessList(list)
+	}
+
+	// Set the storage witnesses, if given.
+	if witnesses != nil {
+		decoded, err := decodeStorageWitnesses(*witnesses)
+		if err != nil {
+			return nil, err
+		}
+		mtx.SetStorageWitnesses(decoded)
+	}
+
 	// Return the serialized and hex-encoded transaction.  Note that this
 	// is intentionally not directly returning because the first return
 	// value is a string and it would result in returning an empty string to
@@ -849,10 +941,17 @@ func (s *PublicRpcAPI) CreateRawTransaction(inputs []rpcjson.TransactionInput, o
 		return nil, err
 	}
 
-	return &rpcjson.CreateRawTransactionResult{
+	result := &rpcjson.CreateRawTransactionResult{
 		Hex:          mtxHex,
 		ContractAddr: contractAddress,
-	}, nil
+	}
+	if simulate != nil && *simulate {
+		result.Simulation, err = s.simulateTransaction(mtx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
 func (s *PublicRpcAPI) DecodeRawTransaction(hexTx string) (interface{}, error) {
@@ -881,6 +980,12 @@ func (s *PublicRpcAPI) DecodeRawTransaction(hexTx string) (interface{}, error) {
 		Vin:      createVinList(&mtx),
 		Vout:     createVoutList(&mtx, nil),
 	}
+	if mtx.HasAccessList() {
+		txReply.AccessList = encodeAccessList(mtx.TxContract.AccessList)
+	}
+	if mtx.HasStorageWitness() {
+		txReply.Witnesses = encodeStorageWitnesses(mtx.TxContract.Witnesses)
+	}
 	return txReply, nil
 }
 
@@ -888,7 +993,7 @@ func (s *PublicRpcAPI) DecodeRawTransaction(hexTx string) (interface{}, error) {
 // Note the calculation is part of logic implemented in the `CreateRawTransaction` function.
 // As a result, `CreateRawTransaction` is directly called instead of composing the similar code again.
 func (s *PublicRpcAPI) CalculateContractAddress(inputs []rpcjson.TransactionInput, outputs []rpcjson.TransactionOutput) (interface{}, error) {
-	result, err := s.CreateRawTransaction(inputs, outputs, nil, nil)
+	result, err := s.CreateRawTransaction(inputs, outputs, nil, nil, nil, nil, nil)
 	if err != nil {
 		return result, err
 	} else {
@@ -1116,7 +1221,11 @@ func (s *PublicRpcAPI) CallReadOnlyFunction(callerAddress string, contractAddres
 // The function provides a way to call a contract function in a state preserving manner.
 // A contract function can be called and returns the execution result without affecting the block state.
 // In order to prevent the execution to end in OUT OF GAS, the gas set to call the contract function is 1000000000.
-func (s *PublicRpcAPI) Call(callerAddress string, contractAddress string, data string, name string, abiStr string, amount int64, asset string) (interface{}, error) {
+func (s *PublicRpcAPI) Call(ctx context.Context, callerAddress string, contractAddress string, data string, name string, abiStr string, amount int64, asset string) (interface{}, error) {
+	if !vmWorkers.Acquire(ctx.Done()) {
+		return nil, rpcCancelledError(ctx)
+	}
+	defer vmWorkers.Release()
 
 	res := &rpcjson.CallResult{}
 	input := common.Hex2Bytes(data)
@@ -1217,7 +1326,11 @@ func (s *PublicRpcAPI) Call(callerAddress string, contractAddress string, data s
 // (submit template, deploy contract instance, call a contract) in a state preserving manner.
 // The operations will be executed in order and without affecting the block state.
 // In order to prevent the execution to end in OUT OF GAS, the gas set to call the contract function is 1000000000.
-func (s *PublicRpcAPI) Test(callerAddress string, byteCode string, argStr string, callDatas []rpcjson.TestCallData, abiStr string) (interface{}, error) {
+func (s *PublicRpcAPI) Test(ctx context.Context, callerAddress string, byteCode string, argStr string, callDatas []rpcjson.TestCallData, abiStr string) (interface{}, error) {
+	if !vmWorkers.Acquire(ctx.Done()) {
+		return nil, rpcCancelledError(ctx)
+	}
+	defer vmWorkers.Release()
 
 	res := &rpcjson.TestResult{}
 
@@ -1373,14 +1486,19 @@ func createTempBlockState(cfg   *rpcserverConfig) (*asiutil.Block, *state.StateD
 	if err != nil {
 		return nil, nil
 	}
+	stateDB.SetStateRent(cfg.Chain.StateRent(header.Height))
 	return block, stateDB
 }
 
 // This function is provided only for INTERNAL USE.
 // By running this function, the caller can estimate gas cost of a specific contract call.
 // Note the estimated gas cost is augmented by 120% in order to prevent OUT OF GAS error in real execution.
-func (s *PublicRpcAPI) EstimateGas(caller string, contractAddress string, amount int64, asset string, data string,
+func (s *PublicRpcAPI) EstimateGas(ctx context.Context, caller string, contractAddress string, amount int64, asset string, data string,
 	callType string, voteValue int64) (interface{}, error) {
+	if !vmWorkers.Acquire(ctx.Done()) {
+		return nil, rpcCancelledError(ctx)
+	}
+	defer vmWorkers.Release()
 
 	chain := s.cfg.Chain
 
@@ -1573,6 +1691,13 @@ func (s *PublicRpcAPI) GetRawTransaction(txId string, verbose bool, vinExtra boo
 	// Convert the provided transaction hash hex to a Hash.
 	txHash := common.HexToHash(txId)
 
+	// Confirmed transactions are cached until their block is disconnected.
+	key := rpcCacheKey("getrawtransaction", txHash.UnprefixString(), verbose, vinExtra)
+	if entry, ok := s.cfg.RPCCache.get(key); ok {
+		return s.refreshCachedResponse(entry)
+	}
+	generation := s.cfg.RPCCache.snapshot()
+
 	// Try to fetch the transaction from the memory pool and if that fails,
 	// try the block database.
 	var mtx *protos.MsgTx
@@ -1597,11 +1722,7 @@ func (s *PublicRpcAPI) GetRawTransaction(txId string, verbose bool, vinExtra boo
 			return nil, internalRPCError(err.Error(), context)
 		}
 		if blockRegion == nil {
-			return nil, &rpcjson.RPCError{
-				Code: rpcjson.ErrRPCNoTxInfo,
-				Message: fmt.Sprintf("Failed to fetch blockRegion by txHash: %v, "+
-					"the blockRegion is nil", &txHash),
-			}
+			return nil, rpcNoTxInfoError(&txHash)
 		}
 
 		// Normal transaction
@@ -1612,22 +1733,28 @@ func (s *PublicRpcAPI) GetRawTransaction(txId string, verbose bool, vinExtra boo
 			txBytes, err = dbTx.FetchBlockRegion(blockRegion)
 			return err
 		})
+		if isBlockNotFoundErr(err) {
+			return nil, rpcPrunedTxError(&txHash)
+		}
 		if err != nil {
 			context := "Failed to fetch txBytes by blockRegion"
 			return nil, internalRPCError(err.Error(), context)
 		}
 		//// The verbose flag is set, so generate the JSON object and return it.
 
+		blkHash = &common.Hash{}
+		copy(blkHash[:], blockRegion.Key[:common.HashLength])
+
 		// When the verbose flag isn't set, simply return the serialized
 		// transaction as a hex-encoded string.  This is done here to
 		// avoid deserializing it only to reserialize it again later.
 		if !verbose {
-			return hex.EncodeToString(txBytes), nil
+			txHex := hex.EncodeToString(txBytes)
+			s.cfg.RPCCache.add(generation, key, txHex, *blkHash, 0)
+			return txHex, nil
 		}
 
 		// Grab the block height.
-		blkHash = &common.Hash{}
-		copy(blkHash[:], blockRegion.Key[:common.HashLength])
 		blkHeight, err = s.cfg.Chain.BlockHeightByHash(blkHash)
 		if err != nil {
 			context := "Failed to retrieve block height"
@@ -1685,6 +1812,9 @@ func (s *PublicRpcAPI) GetRawTransaction(txId string, verbose bool, vinExtra boo
 		if err != nil {
 			return nil, err
 		}
+		if blkHash != nil {
+			s.cfg.RPCCache.add(generation, key, *rawTxn, *blkHash, blkHeight)
+		}
 		return *rawTxn, nil
 	} else {
 		rawTxn, err := createTxResult(*s.cfg, mtx, txHash.UnprefixString(),
@@ -1692,6 +1822,9 @@ func (s *PublicRpcAPI) GetRawTransaction(txId string, verbose bool, vinExtra boo
 		if err != nil {
 			return nil, err
 		}
+		if blkHash != nil {
+			s.cfg.RPCCache.add(generation, key, *rawTxn, *blkHash, blkHeight)
+		}
 		return *rawTxn, nil
 	}
 }
@@ -1794,6 +1927,9 @@ func (s *PublicRpcAPI) GetTransactionReceipt(txId string) (interface{}, error) {
 }
 
 func (s *PublicRpcAPI) SendRawTransaction(hexTx string) (interface{}, error) {
+	if safeMode, _ := s.cfg.Chain.SafeMode(); safeMode {
+		return nil, errSafeMode
+	}
 	// Deserialize and send off to tx relay
 	hexStr := hexTx
 	if len(hexStr)%2 != 0 {
@@ -1813,9 +1949,12 @@ func (s *PublicRpcAPI) SendRawTransaction(hexTx string) (interface{}, error) {
 		}
 	}
 
-	// Use 0 for the tag to represent local node.
+	// Use 0 for the tag to represent local node.  Transactions spending
+	// outputs of transactions not received yet are held in the orphan pool
+	// until their parents arrive, instead of being rejected.
 	tx := asiutil.NewTx(&msgTx)
-	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(tx, false, false, 0)
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(tx, true, false, 0)
+	s.cfg.AuditLog.Tx(tx.Hash(), audit.OriginRPC, false, err)
 	if err != nil {
 		// When the error is a rule error, it means the transaction was
 		// simply rejected as opposed to something actually going wrong,
@@ -1833,6 +1972,14 @@ func (s *PublicRpcAPI) SendRawTransaction(hexTx string) (interface{}, error) {
 		return nil, internalRPCError(err.Error(), "Failed to ProcessTransaction")
 	}
 
+	// The orphan is processed again, and relayed when accepted, once its
+	// missing parents are received in a transaction or a block.
+	if len(acceptedTxs) == 0 && s.cfg.TxMemPool.IsOrphanInPool(tx.Hash()) {
+		rpcsLog.Debugf("Holding orphan transaction %v until its parents "+
+			"are received", tx.Hash())
+		return tx.Hash().String(), nil
+	}
+
 	// When the transaction was accepted it should be the first item in the
 	// returned array of accepted transactions.  The only way this will not
 	// be true is if the API for ProcessTransaction changes and this code is
@@ -1873,7 +2020,11 @@ func (s *PublicRpcAPI) SendRawTransaction(hexTx string) (interface{}, error) {
 // 	VinExtra    *int  `jsonrpcdefault:"0"`
 // 	Reverse     *bool `jsonrpcdefault:"false"`
 // 	FilterAddrs *[]string
-func (s *PublicRpcAPI) SearchRawTransactions(address string, verbose bool, skip int, count int, vinExtra bool, reverse bool, filterAddress []string) (interface{}, error) {
+// 	Page        *PageRequest
+//
+// When a page is requested, its cursor and limit replace skip and count, and
+// the result holds an estimate of the number of transactions of the address.
+func (s *PublicRpcAPI) SearchRawTransactions(ctx context.Context, address string, verbose bool, skip int, count int, vinExtra bool, reverse bool, filterAddress []string, page *rpcjson.PageRequest) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
 	addrIndex := s.cfg.AddrIndex
 	if addrIndex == nil {
@@ -1926,6 +2077,27 @@ func (s *PublicRpcAPI) SearchRawTransactions(address string, verbose bool, skip
 		}
 	}
 
+	// The cursor of a page is the number of entries of the previous pages.
+	if page != nil {
+		if numRequested, err = pageLimit(page); err != nil {
+			return nil, err
+		}
+		position, err := decodeCursor(page, "searchrawtransactions")
+		if err != nil {
+			return nil, err
+		}
+		numToSkip = 0
+		if position != "" {
+			numToSkip, err = strconv.Atoi(position)
+			if err != nil || numToSkip < 0 {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCInvalidParameter,
+					Message: "Invalid cursor: " + page.Cursor,
+				}
+			}
+		}
+	}
+
 	// Add transactions from mempool first if client asked for reverse
 	// order.  Otherwise, they will be added last (as needed depending on
 	// the requested counts).
@@ -2006,7 +2178,8 @@ func (s *PublicRpcAPI) SearchRawTransactions(address string, verbose bool, skip
 	}
 
 	// Address has never been used if neither source yielded any results.
-	if len(addressTxns) == 0 {
+	// The last page of a used address may be empty.
+	if len(addressTxns) == 0 && (page == nil || page.Cursor == "") {
 		return nil, &rpcjson.RPCError{
 			Code:    rpcjson.ErrRPCNoTxInfo,
 			Message: "No information available about address",
@@ -2034,6 +2207,10 @@ func (s *PublicRpcAPI) SearchRawTransactions(address string, verbose bool, skip
 
 	// When not in verbose mode, simply return a list of serialized txns.
 	if !verbose {
+		if page != nil {
+			return s.searchRawTransactionsPage(addr, hexTxns, numToSkip,
+				len(hexTxns))
+		}
 		return hexTxns, nil
 	}
 
@@ -2050,6 +2227,9 @@ func (s *PublicRpcAPI) SearchRawTransactions(address string, verbose bool, skip
 	best := s.cfg.Chain.BestSnapshot()
 	srtList := make([]rpcjson.SearchRawTransactionsResult, len(addressTxns))
 	for i := range addressTxns {
+		if ctx.Err() != nil {
+			return nil, rpcCancelledError(ctx)
+		}
 		// The deserialized transaction is needed, so deserialize the
 		// retrieved transaction if it's in serialized form (which will
 		// be the case when it was lookup up from the database).
@@ -2123,10 +2303,34 @@ func (s *PublicRpcAPI) SearchRawTransactions(address string, verbose bool, skip
 		}
 	}
 
+	if page != nil {
+		return s.searchRawTransactionsPage(addr, srtList, numToSkip,
+			len(srtList))
+	}
 	return srtList, nil
 }
 
-func (s *PublicRpcAPI) GetTransactionsByAddresses(addresses []string, numToSkip uint32, numRequested uint32) (interface{}, error) {
+// searchRawTransactionsPage returns a page of the transactions of an address
+// following the passed number of transactions of the previous pages.  The
+// number of transactions of the address is estimated from the address index
+// and the mempool, which may change between pages.
+func (s *PublicRpcAPI) searchRawTransactionsPage(addr common.IAddress,
+	items interface{}, numSkipped, numItems int) (interface{}, error) {
+
+	total, err := s.cfg.AddrIndex.NumTxnsForAddress(addr)
+	if err != nil {
+		context := "Failed to load address index entries"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	estimate := int64(total) + int64(len(s.cfg.AddrIndex.UnconfirmedTxnsForAddress(addr)))
+	result := rpcjson.PageResult{Items: items, TotalEstimate: estimate}
+	if next := numSkipped + numItems; numItems > 0 && int64(next) < estimate {
+		result.NextCursor = encodeCursor("searchrawtransactions", strconv.Itoa(next))
+	}
+	return result, nil
+}
+
+func (s *PublicRpcAPI) GetTransactionsByAddresses(ctx context.Context, addresses []string, numToSkip uint32, numRequested uint32) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
 	addrIndex := s.cfg.AddrIndex
 	res := make(map[string][]rpcjson.TxResult)
@@ -2139,6 +2343,9 @@ func (s *PublicRpcAPI) GetTransactionsByAddresses(addresses []string, numToSkip
 
 	// Attempt to decode the supplied address.
 	for _, address := range addresses {
+		if ctx.Err() != nil {
+			return nil, rpcCancelledError(ctx)
+		}
 
 		addr, err := asiutil.DecodeAddress(address)
 		if err != nil {
@@ -2209,6 +2416,9 @@ func (s *PublicRpcAPI) GetTransactionsByAddresses(addresses []string, numToSkip
 		srtList := make([]rpcjson.TxResult, len(addressTxns))
 
 		for i := range addressTxns {
+			if ctx.Err() != nil {
+				return nil, rpcCancelledError(ctx)
+			}
 
 			rtx := &addressTxns[i]
 
@@ -2267,7 +2477,10 @@ func (s *PublicRpcAPI) GetTransactionsByAddresses(addresses []string, numToSkip
 	return res, nil
 }
 
-func (s *PublicRpcAPI) GetMempoolTransactions(txIds []string) (interface{}, error) {
+// GetMempoolTransactions returns the passed transactions of the mempool, or
+// all of them when none is passed.  When a page is requested, the transactions
+// are returned in pages ordered by hash.
+func (s *PublicRpcAPI) GetMempoolTransactions(txIds []string, page *rpcjson.PageRequest) (interface{}, error) {
 	if len(txIds) != 0 {
 		result := make(map[string]*protos.MsgTx, 0)
 
@@ -2283,6 +2496,9 @@ func (s *PublicRpcAPI) GetMempoolTransactions(txIds []string) (interface{}, erro
 	}
 
 	descs := s.cfg.TxMemPool.TxDescs()
+	if page != nil {
+		return s.mempoolPage(descs, page)
+	}
 	result := make([]interface{}, len(descs))
 	for i := range descs {
 		result[i] = descs[i].Tx.MsgTx()
@@ -2290,6 +2506,40 @@ func (s *PublicRpcAPI) GetMempoolTransactions(txIds []string) (interface{}, erro
 	return result, nil
 }
 
+// mempoolPage returns a page of the passed mempool transactions ordered by
+// hash.  The cursor is the hash of the last transaction of the previous page.
+func (s *PublicRpcAPI) mempoolPage(descs mining.TxDescList, page *rpcjson.PageRequest) (interface{}, error) {
+	limit, err := pageLimit(page)
+	if err != nil {
+		return nil, err
+	}
+	position, err := decodeCursor(page, "mempool")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].Tx.Hash().String() < descs[j].Tx.Hash().String()
+	})
+	hashes := make([]string, len(descs))
+	for i, desc := range descs {
+		hashes[i] = desc.Tx.Hash().String()
+	}
+	from, to := keysetPage(len(descs), position, limit, func(i int) bool {
+		return hashes[i] > position
+	})
+
+	items := make([]*protos.MsgTx, 0, to-from)
+	for _, desc := range descs[from:to] {
+		items = append(items, desc.Tx.MsgTx())
+	}
+	result := rpcjson.PageResult{Items: items, TotalEstimate: int64(len(descs))}
+	if to < len(descs) {
+		result.NextCursor = encodeCursor("mempool", hashes[to-1])
+	}
+	return result, nil
+}
+
 func (s *PublicRpcAPI) AddNode(_addr string, _subCmd rpcjson.AddNodeSubCmd) (interface{}, error) {
 	addr := fnet.NormalizeAddress(_addr, s.cfg.ChainParams.DefaultPort)
 	var err error
@@ -2318,6 +2568,64 @@ func (s *PublicRpcAPI) AddNode(_addr string, _subCmd rpcjson.AddNodeSubCmd) (int
 	return nil, nil
 }
 
+// ListForensicDumps returns a summary of the forensic dumps of the blocks whose
+// computed state did not match their header.
+func (s *PublicRpcAPI) ListForensicDumps() (interface{}, error) {
+	dumps, err := s.cfg.Chain.ForensicDumps()
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to read forensic dumps")
+	}
+	result := make([]rpcjson.ForensicDumpSummaryResult, 0, len(dumps))
+	for _, dump := range dumps {
+		result = append(result, rpcjson.ForensicDumpSummaryResult{
+			BlockHash: dump.BlockHash,
+			Height:    dump.Height,
+			Time:      dump.Time,
+			Reason:    dump.Reason,
+		})
+	}
+	return result, nil
+}
+
+// GetForensicDump returns the forensic dump of the block with the given hash,
+// including the block, the pre-state of the accessed accounts, the receipts,
+// the execution trace of the transactions and both the expected and the
+// computed state root.
+func (s *PublicRpcAPI) GetForensicDump(blockHash string) (interface{}, error) {
+	hash, err := decodeHashStr(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	dump, err := s.cfg.Chain.ForensicDump(hash)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCBlockNotFound,
+			Message: "No forensic dump of block " + blockHash,
+		}
+	}
+	return dump, nil
+}
+
+// CompactDatabase starts the compaction of the block and state databases in
+// the background.  The progress is reported by GetCompactionInfo.
+func (s *PublicRpcAPI) CompactDatabase() (interface{}, error) {
+	if err := s.cfg.Compactor.Trigger(); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
+// GetCompactionInfo returns the progress of the running database compaction
+// along with the result of the last one.
+func (s *PublicRpcAPI) GetCompactionInfo() (interface{}, error) {
+	return s.cfg.Compactor.Info(), nil
+}
+
 // Get the list of assets which can be used as transaction fees on Asimov blockchain
 // By default, only Asim can be used as transaction fee.
 // The validator committee can choose to add new asset to the list as needed.
@@ -2376,11 +2684,16 @@ func (s *PublicRpcAPI) GetContractExecuteError(txid string)(interface{},error){
 	return data,nil
 }
 
-func getTemplateInfoByKey(key string, s *PublicRpcAPI) (interface{}, bool) {
+func getTemplateInfoByKey(key string, s *PublicRpcAPI) (rpcjson.ContractTemplateDetail, bool) {
+	detail, ok, generation := s.cfg.TemplateCache.detail(key)
+	if ok {
+		return detail, true
+	}
+
 	keyHash := common.HexToHash(key)
 	category, templateName, byteCode, abi, source, err := s.cfg.Chain.FetchTemplate(nil, &keyHash)
 	if err != nil {
-		return nil, false
+		return rpcjson.ContractTemplateDetail{}, false
 	}
 
 	result := rpcjson.ContractTemplateDetail{
@@ -2390,6 +2703,7 @@ func getTemplateInfoByKey(key string, s *PublicRpcAPI) (interface{}, bool) {
 		Abi:          string(abi),
 		Source:       string(source),
 	}
+	s.cfg.TemplateCache.addDetail(generation, key, result)
 
 	return result, true
 }
@@ -2473,6 +2787,181 @@ func (s *PublicRpcAPI) CurrentPeers() []string {
 	return s.cfg.SyncMgr.ListPeerStates()
 }
 
+// GetPeerInfo returns data about the connected peers, including the AS of
+// their address when an AS map is loaded.  When a page is requested, the
+// peers are returned in pages ordered by id.
+func (s *PublicRpcAPI) GetPeerInfo(page *rpcjson.PageRequest) (interface{}, error) {
+	peers := s.cfg.ConnMgr.ConnectedPeers()
+	infos := make([]*rpcjson.GetPeerInfoResult, 0, len(peers))
+	for _, p := range peers {
+		statsSnap := p.ToPeer().StatsSnapshot()
+		info := &rpcjson.GetPeerInfoResult{
+			ID:             statsSnap.ID,
+			Addr:           statsSnap.Addr,
+			Services:       fmt.Sprintf("%08d", uint64(statsSnap.Services)),
+			RelayTxes:      !p.IsTxRelayDisabled(),
+			LastSend:       statsSnap.LastSend.Unix(),
+			LastRecv:       statsSnap.LastRecv.Unix(),
+			BytesSent:      statsSnap.BytesSent,
+			BytesRecv:      statsSnap.BytesRecv,
+			ConnTime:       statsSnap.ConnTime.Unix(),
+			TimeOffset:     statsSnap.TimeOffset,
+			PingTime:       float64(statsSnap.LastPingMicros),
+			Version:        statsSnap.Version,
+			SubVer:         statsSnap.UserAgent,
+			Metadata:       statsSnap.Metadata,
+			Inbound:        statsSnap.Inbound,
+			StartingHeight: statsSnap.StartingHeight,
+			CurrentHeight:  statsSnap.LastBlock,
+			BanScore:       int32(p.BanScore()),
+			FeeFilter:      p.FeeFilter(),
+			ASN:            p.ASN(),
+		}
+		infos = append(infos, info)
+	}
+	if page == nil {
+		return infos, nil
+	}
+
+	// Peers are paged in the order of their ids, which are never reused.
+	limit, err := pageLimit(page)
+	if err != nil {
+		return nil, err
+	}
+	position, err := decodeCursor(page, "peers")
+	if err != nil {
+		return nil, err
+	}
+	var lastID int64
+	if position != "" {
+		lastID, err = strconv.ParseInt(position, 10, 32)
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "Invalid cursor: " + page.Cursor,
+			}
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	from, to := keysetPage(len(infos), position, limit, func(i int) bool {
+		return int64(infos[i].ID) > lastID
+	})
+	result := rpcjson.PageResult{Items: infos[from:to], TotalEstimate: int64(len(infos))}
+	if to < len(infos) {
+		result.NextCursor = encodeCursor("peers", strconv.Itoa(int(infos[to-1].ID)))
+	}
+	return result, nil
+}
+
+// SubmitHeader validates a serialized block header against its parent without
+// its block.  When it is valid and its block is unknown, the block is
+// requested from a peer which announced its height.
+func (s *PublicRpcAPI) SubmitHeader(hexHeader string) (interface{}, error) {
+	serialized, err := hex.DecodeString(hexHeader)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexHeader)
+	}
+	var header protos.BlockHeader
+	if err := header.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCDeserialization,
+			Message: "Block header decode failed: " + err.Error(),
+		}
+	}
+	if err := s.cfg.Chain.CheckBlockHeader(&header); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "Rejected block header: " + err.Error(),
+		}
+	}
+
+	hash := header.BlockHash()
+	if have, err := s.cfg.Chain.HaveBlock(&hash); err == nil && !have {
+		err = s.cfg.SyncMgr.RequestBlock(&hash, header.Height, 0)
+		if err != nil {
+			rpcsLog.Infof("Unable to request submitted block %v: %v",
+				hash, err)
+		}
+	}
+	return nil, nil
+}
+
+// PreciousBlock makes the chain ending with the passed block the best chain
+// when it has the same weight as the current best chain, settling a tie
+// between competing blocks.
+func (s *PublicRpcAPI) PreciousBlock(blockHash string) (interface{}, error) {
+	hash, err := decodeHashStr(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cfg.Chain.PreciousBlock(hash); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// InvalidateBlock marks the passed block and its descendants as invalid, as if
+// they had failed validation, reorganizing the best chain away from them.
+func (s *PublicRpcAPI) InvalidateBlock(blockHash string) (interface{}, error) {
+	hash, err := decodeHashStr(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cfg.Chain.InvalidateBlock(hash); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// ReconsiderBlock clears the invalid status of the passed block, of its
+// descendants and of its ancestors, reversing invalidateblock, and
+// reorganizes the best chain to the valid chain of the most weight.
+func (s *PublicRpcAPI) ReconsiderBlock(blockHash string) (interface{}, error) {
+	hash, err := decodeHashStr(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cfg.Chain.ReconsiderBlock(hash); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// GetBlockFromPeer requests a block from a specific peer, bypassing the normal
+// scheduling of the block downloads, to recover a block the node never
+// received.  The block is processed once the peer sends it, which is not
+// waited for.
+func (s *PublicRpcAPI) GetBlockFromPeer(blockHash string, peerID int32) (interface{}, error) {
+	hash, err := decodeHashStr(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if peerID == 0 {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid peer id 0",
+		}
+	}
+	if err := s.cfg.SyncMgr.RequestBlock(hash, 0, peerID); err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
 // Get detail mining information of consensus
 func (s *PublicRpcAPI) GetConsensusMiningInfo() (interface{}, error) {
 	chain := s.cfg.Chain
@@ -2629,6 +3118,38 @@ func (s *PublicRpcAPI) GetSignUpStatus(address string) (interface{}, error) {
 	return signUpInfo, nil
 }
 
+// GetKeyRotation returns the status of the scheduled validator key rotation
+// along with the consensus contract information and the outputs needed to
+// sign up the next key, which must be done before the activation height.
+func (s *PublicRpcAPI) GetKeyRotation() (interface{}, error) {
+	rotation := s.cfg.KeyRotation
+	if rotation == nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "No validator key rotation is configured",
+		}
+	}
+
+	contract, err := s.GetConsensusMiningInfo()
+	if err != nil {
+		return nil, err
+	}
+	signUp, err := s.GetSignUpStatus(rotation.next.Address.String())
+	if err != nil {
+		return nil, err
+	}
+	best := s.cfg.Chain.BestSnapshot()
+	return &rpcjson.GetKeyRotationResult{
+		Address:     rotation.current.Address.String(),
+		NextAddress: rotation.next.Address.String(),
+		Height:      rotation.height,
+		Active:      best.Height+1 >= rotation.height,
+		Registered:  !signUp.(*rpcjson.GetSignUpStatusResult).AutoSignUp,
+		Contract:    contract.(*rpcjson.GetConsensusMiningInfoResult),
+		SignUp:      signUp.(*rpcjson.GetSignUpStatusResult),
+	}, nil
+}
+
 // Get block information in detail of a given round in Satoshi+ consensus
 func (s *PublicRpcAPI) GetRoundInfo(round uint32) (interface{}, error) {
 	validators, _, err := s.cfg.Chain.GetValidators(round)
@@ -2643,12 +3164,54 @@ func (s *PublicRpcAPI) GetRoundInfo(round uint32) (interface{}, error) {
 	return res, nil
 }
 
-func (s *PublicRpcAPI) GetBlockTemplate(privkey string, round uint32, slotIndex uint16) (interface{}, error) {
+// GetBlockTemplate builds a block for the passed round and slot signed off by
+// privkey and returns it hex encoded.  When a request is passed, it behaves
+// like the getblocktemplate command of the external block producers instead:
+// in template mode the template is returned along with its long poll id, and
+// a long poll id in the request makes the call wait until that template is
+// stale.  In proposal mode the block in the request is validated against the
+// current tip without being processed, and the reason it is rejected, if any,
+// is returned.
+func (s *PublicRpcAPI) GetBlockTemplate(ctx context.Context, privkey string, round uint32,
+	slotIndex uint16, request *rpcjson.TemplateRequest) (interface{}, error) {
+	mode := "template"
+	if request != nil && request.Mode != "" {
+		mode = request.Mode
+	}
+	switch mode {
+	case "template":
+	case "proposal":
+		return s.handleBlockProposal(request)
+	default:
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Invalid mode",
+		}
+	}
+
 	acc, err := crypto.NewAccount(privkey)
 	if err != nil {
 		return nil,  internalRPCError(err.Error(), "privkey decode error")
 	}
 
+	if request != nil && request.LongPollID != "" {
+		err = s.cfg.GbtLongPoll.wait(ctx, s.cfg.Chain, request.LongPollID)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil, err
+		}
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	// Take the long poll id before building the template so that changes
+	// racing with the build make it stale rather than being missed.
+	best := s.cfg.Chain.BestSnapshot()
+	longPollID, _ := s.cfg.GbtLongPoll.state(&best.Hash)
+
 	// 5 seconds
 	blockInteval := 5.0 * 100000
 	template, err := s.cfg.BlockTemplateGenerator.ProduceNewBlock(acc,
@@ -2657,9 +3220,62 @@ func (s *PublicRpcAPI) GetBlockTemplate(privkey string, round uint32, slotIndex
 	if err != nil {
 		return nil, internalRPCError(err.Error(), "failed to get block template")
 	}
-	w := bytes.NewBuffer(make([]byte, 0, template.Block.MsgBlock().SerializeSize()))
-	template.Block.MsgBlock().Serialize(w)
-	return hexutil.Encode(w.Bytes()), nil
+	msgBlock := template.Block.MsgBlock()
+	w := bytes.NewBuffer(make([]byte, 0, msgBlock.SerializeSize()))
+	msgBlock.Serialize(w)
+	if request == nil {
+		return hexutil.Encode(w.Bytes()), nil
+	}
+
+	header := &msgBlock.Header
+	return &rpcjson.GetBlockTemplateResult{
+		Data:         hex.EncodeToString(w.Bytes()),
+		Hash:         template.Block.Hash().String(),
+		PreviousHash: header.PrevBlock.String(),
+		Height:       header.Height,
+		Round:        header.Round,
+		SlotIndex:    header.SlotIndex,
+		CurTime:      header.Timestamp,
+		GasLimit:     header.GasLimit,
+		GasUsed:      header.GasUsed,
+		Transactions: len(msgBlock.Transactions),
+		LongPollID:   longPollID,
+	}, nil
+}
+
+// handleBlockProposal validates the block of a getBlockTemplate proposal
+// request.  It returns nil when the block can be connected to the tip of the
+// main chain, or the reason it is rejected otherwise.
+func (s *PublicRpcAPI) handleBlockProposal(request *rpcjson.TemplateRequest) (interface{}, error) {
+	if request == nil || request.Data == "" {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Data must contain the hex-encoded block to propose",
+		}
+	}
+	dataBytes, err := hex.DecodeString(strings.TrimPrefix(request.Data, "0x"))
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCDeserialization,
+			Message: "Data must be hexadecimal string (not " + request.Data + ")",
+		}
+	}
+	block, err := asiutil.NewBlockFromBytes(dataBytes)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCDeserialization,
+			Message: "Block decode failed: " + err.Error(),
+		}
+	}
+
+	if err := s.cfg.Chain.CheckConnectBlockTemplate(block); err != nil {
+		if _, ok := err.(blockchain.RuleError); !ok {
+			return nil, internalRPCError(err.Error(), "failed to process block proposal")
+		}
+		rpcsLog.Infof("Rejected block proposal %v: %v", block.Hash(), err)
+		return "rejected: " + err.Error(), nil
+	}
+	return nil, nil
 }
 
 func (s *PublicRpcAPI) SignBlock(blockHash string, privkey string) (interface{}, error) {
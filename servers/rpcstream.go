@@ -0,0 +1,70 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// streamBlockSize is the size of the serialized blocks whose verbose results
+// with transactions are streamed rather than buffered and cached.  The
+// results of the transactions of a block full of contract calls are several
+// times larger than the block.
+const streamBlockSize = 512 * 1024
+
+// blockStream is the verbose result of a block with the results of its
+// transactions, which are created and written one at a time.
+type blockStream struct {
+	cfg        *rpcserverConfig
+	reply      *rpcjson.GetBlockVerboseResult
+	block      *asiutil.Block
+	height     int32
+	bestHeight int32
+}
+
+// WriteJSON writes the result with the same fields as a buffered
+// GetBlockVerboseResult, the transactions coming last.
+//
+// This is part of the rpc.StreamedResult interface implementation.
+func (b *blockStream) WriteJSON(w io.Writer) error {
+	header, err := json.Marshal(b.reply)
+	if err != nil {
+		return err
+	}
+
+	// Reopen the object of the block to append its transactions.
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"rawtx":[`); err != nil {
+		return err
+	}
+	hash := b.block.Hash().UnprefixString()
+	for i, tx := range b.block.Transactions() {
+		rawTxn, err := createTxResult(*b.cfg, tx.MsgTx(), tx.Hash().String(),
+			nil, hash, b.height, b.bestHeight, false)
+		if err != nil {
+			return err
+		}
+		serialized, err := json.Marshal(rawTxn)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(serialized); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]}")
+	return err
+}
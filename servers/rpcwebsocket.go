@@ -0,0 +1,326 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// wsQueueSize is the number of notifications queued for a websocket
+// subscription.  A subscription whose client does not keep up is dropped
+// once its queue is full, so a slow client never delays the chain.
+const wsQueueSize = 1024
+
+// wsSubscriptionKind is the kind of notifications a subscription asked for.
+type wsSubscriptionKind int
+
+// These constants define the kinds of websocket subscriptions.
+const (
+	wsNotifyBlocks wsSubscriptionKind = iota
+	wsNotifyNewTransactions
+	wsNotifyReceived
+	wsNotifySpent
+)
+
+// wsSubscriptionNames are the names of the kinds of subscriptions, for
+// logging.
+var wsSubscriptionNames = map[wsSubscriptionKind]string{
+	wsNotifyBlocks:          "notifyblocks",
+	wsNotifyNewTransactions: "notifynewtransactions",
+	wsNotifyReceived:        "notifyreceived",
+	wsNotifySpent:           "notifyspent",
+}
+
+// wsSubscription is a websocket subscription along with its filter.  The
+// outpoints of a notifyreceived subscription are the outputs paying its
+// addresses, so their client is notified when they are spent as well.  The
+// filter is protected by the lock of the notification manager.
+type wsSubscription struct {
+	kind      wsSubscriptionKind
+	verbose   bool
+	addrs     map[string]struct{}
+	outpoints map[protos.OutPoint]struct{}
+	queue     chan interface{}
+}
+
+// wsNotificationManager dispatches the block and transaction notifications to
+// the websocket subscriptions whose filter they match.
+type wsNotificationManager struct {
+	mtx           sync.Mutex
+	subscriptions map[*wsSubscription]struct{}
+}
+
+// newWsNotificationManager returns a notification manager without
+// subscriptions.
+func newWsNotificationManager() *wsNotificationManager {
+	return &wsNotificationManager{
+		subscriptions: make(map[*wsSubscription]struct{}),
+	}
+}
+
+// subscribe creates a subscription on the connection of the passed context
+// and sends it the notifications matching the filter of sub until the client
+// unsubscribes or disconnects.
+func (m *wsNotificationManager) subscribe(ctx context.Context, sub *wsSubscription) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+	sub.queue = make(chan interface{}, wsQueueSize)
+
+	m.mtx.Lock()
+	m.subscriptions[sub] = struct{}{}
+	m.mtx.Unlock()
+	rpcsLog.Debugf("New %s subscription %s", wsSubscriptionNames[sub.kind], rpcSub.ID)
+
+	go func() {
+		defer m.remove(sub)
+		for {
+			select {
+			case ntfn, ok := <-sub.queue:
+				if !ok {
+					return
+				}
+				if err := notifier.Notify(rpcSub.ID, ntfn); err != nil {
+					return
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// remove drops a subscription.
+func (m *wsNotificationManager) remove(sub *wsSubscription) {
+	m.mtx.Lock()
+	delete(m.subscriptions, sub)
+	m.mtx.Unlock()
+}
+
+// send queues a notification for a subscription, and drops the subscription
+// when its queue is full.
+//
+// This function MUST be called with the manager lock held.
+func (m *wsNotificationManager) send(sub *wsSubscription, ntfn interface{}) {
+	select {
+	case sub.queue <- ntfn:
+	default:
+		rpcsLog.Warnf("Dropping a %s subscription whose client does not "+
+			"keep up with the notifications", wsSubscriptionNames[sub.kind])
+		delete(m.subscriptions, sub)
+		close(sub.queue)
+	}
+}
+
+// notifyBlock notifies the notifyblocks subscriptions of a connected or
+// disconnected block, and the notifyreceived and notifyspent subscriptions of
+// the transactions of a connected block matching their filter.
+func (m *wsNotificationManager) notifyBlock(block *asiutil.Block, connected bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if len(m.subscriptions) == 0 {
+		return
+	}
+
+	header := &block.MsgBlock().Header
+	ntfn := &rpcjson.BlockNtfn{
+		Event:   rpcjson.BlockDisconnectedNtfnEvent,
+		Hash:    block.Hash().String(),
+		Height:  block.Height(),
+		Time:    header.Timestamp,
+		TxCount: len(block.Transactions()),
+	}
+	if connected {
+		ntfn.Event = rpcjson.BlockConnectedNtfnEvent
+	}
+	for sub := range m.subscriptions {
+		if sub.kind == wsNotifyBlocks {
+			m.send(sub, ntfn)
+		}
+	}
+	if !connected {
+		return
+	}
+	for i, tx := range block.Transactions() {
+		m.notifyRelevantTx(tx, &rpcjson.BlockDetails{
+			Hash:   ntfn.Hash,
+			Height: ntfn.Height,
+			Index:  i,
+			Time:   ntfn.Time,
+		})
+	}
+}
+
+// notifyNewTransactions notifies the subscriptions of the transactions
+// accepted to the mempool.
+func (m *wsNotificationManager) notifyNewTransactions(txns []*mining.TxDesc) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if len(m.subscriptions) == 0 {
+		return
+	}
+
+	for _, txD := range txns {
+		ntfn := &rpcjson.TxAcceptedNtfn{
+			TxID: txD.Tx.Hash().String(),
+			Size: txD.Tx.MsgTx().SerializeSize(),
+		}
+		var verbose *rpcjson.TxAcceptedNtfn
+		for sub := range m.subscriptions {
+			if sub.kind != wsNotifyNewTransactions {
+				continue
+			}
+			if !sub.verbose {
+				m.send(sub, ntfn)
+				continue
+			}
+			if verbose == nil {
+				hex, err := messageToHex(txD.Tx.MsgTx())
+				if err != nil {
+					continue
+				}
+				verbose = &rpcjson.TxAcceptedNtfn{TxID: ntfn.TxID, Size: ntfn.Size, Hex: hex}
+			}
+			m.send(sub, verbose)
+		}
+		m.notifyRelevantTx(txD.Tx, nil)
+	}
+}
+
+// notifyRelevantTx notifies the notifyreceived subscriptions of a transaction
+// paying their addresses, and the notifyreceived and notifyspent subscriptions
+// of a transaction spending their outpoints.  The block is nil for the
+// transactions of the mempool.
+//
+// This function MUST be called with the manager lock held.
+func (m *wsNotificationManager) notifyRelevantTx(tx *asiutil.Tx, block *rpcjson.BlockDetails) {
+	var hex string
+	ntfn := func(event string) *rpcjson.RelevantTxNtfn {
+		if hex == "" {
+			hex, _ = messageToHex(tx.MsgTx())
+		}
+		return &rpcjson.RelevantTxNtfn{
+			Event: event,
+			TxID:  tx.Hash().String(),
+			Hex:   hex,
+			Block: block,
+		}
+	}
+
+	for sub := range m.subscriptions {
+		if sub.kind != wsNotifyReceived && sub.kind != wsNotifySpent {
+			continue
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			if _, ok := sub.outpoints[txIn.PreviousOutPoint]; ok {
+				m.send(sub, ntfn(rpcjson.RedeemingTxNtfnEvent))
+				break
+			}
+		}
+		if sub.kind != wsNotifyReceived {
+			continue
+		}
+		received := false
+		for i, txOut := range tx.MsgTx().TxOut {
+			_, addrs, _, _ := txscript.ExtractPkScriptAddrs(txOut.PkScript)
+			for _, addr := range addrs {
+				if _, ok := sub.addrs[addr.EncodeAddress()]; ok {
+					sub.outpoints[*protos.NewOutPoint(tx.Hash(), uint32(i))] = struct{}{}
+					received = true
+				}
+			}
+		}
+		if received {
+			m.send(sub, ntfn(rpcjson.RecvTxNtfnEvent))
+		}
+	}
+}
+
+// handleWsNotification forwards the connected and disconnected blocks to the
+// websocket subscriptions.
+func (s *NodeServer) handleWsNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected &&
+		notification.Type != blockchain.NTBlockDisconnected {
+		return
+	}
+	data, ok := notification.Data.([]interface{})
+	if !ok || len(data) == 0 {
+		return
+	}
+	block, ok := data[0].(*asiutil.Block)
+	if !ok {
+		return
+	}
+	s.wsNotifications.notifyBlock(block, notification.Type == blockchain.NTBlockConnected)
+}
+
+// NotifyBlocks subscribes a websocket client to the blocks connected to and
+// disconnected from the main chain.
+func (s *PublicRpcAPI) NotifyBlocks(ctx context.Context) (*rpc.Subscription, error) {
+	return s.cfg.WsNotifications.subscribe(ctx, &wsSubscription{kind: wsNotifyBlocks})
+}
+
+// NotifyNewTransactions subscribes a websocket client to the transactions
+// accepted to the mempool, along with their serialized bytes when verbose.
+func (s *PublicRpcAPI) NotifyNewTransactions(ctx context.Context, verbose *bool) (*rpc.Subscription, error) {
+	sub := &wsSubscription{kind: wsNotifyNewTransactions}
+	if verbose != nil {
+		sub.verbose = *verbose
+	}
+	return s.cfg.WsNotifications.subscribe(ctx, sub)
+}
+
+// NotifyReceived subscribes a websocket client to the transactions of the
+// mempool and of the connected blocks paying the passed addresses, and to the
+// transactions spending the outputs it was notified of.
+func (s *PublicRpcAPI) NotifyReceived(ctx context.Context, addresses []string) (*rpc.Subscription, error) {
+	sub := &wsSubscription{
+		kind:      wsNotifyReceived,
+		addrs:     make(map[string]struct{}, len(addresses)),
+		outpoints: make(map[protos.OutPoint]struct{}),
+	}
+	for _, address := range addresses {
+		addr, err := asiutil.DecodeAddress(address)
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + address,
+			}
+		}
+		sub.addrs[addr.EncodeAddress()] = struct{}{}
+	}
+	return s.cfg.WsNotifications.subscribe(ctx, sub)
+}
+
+// NotifySpent subscribes a websocket client to the transactions of the
+// mempool and of the connected blocks spending the passed outpoints.
+func (s *PublicRpcAPI) NotifySpent(ctx context.Context, outpoints []rpcjson.OutPoint) (*rpc.Subscription, error) {
+	sub := &wsSubscription{
+		kind:      wsNotifySpent,
+		outpoints: make(map[protos.OutPoint]struct{}, len(outpoints)),
+	}
+	for _, outpoint := range outpoints {
+		hash, err := decodeHashStr(outpoint.Hash)
+		if err != nil {
+			return nil, err
+		}
+		sub.outpoints[*protos.NewOutPoint(hash, outpoint.Index)] = struct{}{}
+	}
+	return s.cfg.WsNotifications.subscribe(ctx, sub)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// TestWsNotifications ensures the websocket subscriptions are notified of
+// the blocks and of the transactions matching their filter.
+func TestWsNotifications(t *testing.T) {
+	m := newWsNotificationManager()
+	server := rpc.NewServer()
+	defer server.Stop()
+	api := &PublicRpcAPI{cfg: &rpcserverConfig{WsNotifications: m}}
+	if err := server.RegisterName("asimov", api); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+	ctx := context.Background()
+
+	addr, err := common.NewAddressWithId(common.PubKeyHashAddrID,
+		[]byte{0x01, 0x02, 0x03, 0x04})
+	if err != nil {
+		t.Fatalf("NewAddressWithId: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+
+	// The first transaction pays the address and spends an outpoint, the
+	// second one spends the output paying the address.
+	spent := protos.NewOutPoint(&common.Hash{0x01, 0x02, 31: 0xff}, 1)
+	payTx := protos.NewMsgTx(protos.TxVersion)
+	payTx.AddTxIn(protos.NewTxIn(spent, nil))
+	payTx.AddTxOut(protos.NewTxOut(1000, pkScript, protos.Asset{}))
+	pay := asiutil.NewTx(payTx)
+	redeemTx := protos.NewMsgTx(protos.TxVersion)
+	redeemTx.AddTxIn(protos.NewTxIn(protos.NewOutPoint(pay.Hash(), 0), nil))
+	redeem := asiutil.NewTx(redeemTx)
+
+	blocks := make(chan *rpcjson.BlockNtfn, 4)
+	blocksSub, err := client.Subscribe(ctx, "asimov", blocks, "notifyBlocks")
+	if err != nil {
+		t.Fatalf("notifyBlocks: %v", err)
+	}
+	defer blocksSub.Unsubscribe()
+	received := make(chan *rpcjson.RelevantTxNtfn, 4)
+	receivedSub, err := client.Subscribe(ctx, "asimov", received,
+		"notifyReceived", []string{addr.EncodeAddress()})
+	if err != nil {
+		t.Fatalf("notifyReceived: %v", err)
+	}
+	defer receivedSub.Unsubscribe()
+	spends := make(chan *rpcjson.RelevantTxNtfn, 4)
+	spendsSub, err := client.Subscribe(ctx, "asimov", spends, "notifySpent",
+		[]rpcjson.OutPoint{{Hash: spent.Hash.String(), Index: spent.Index}})
+	if err != nil {
+		t.Fatalf("notifySpent: %v", err)
+	}
+	defer spendsSub.Unsubscribe()
+
+	_, err = client.Subscribe(ctx, "asimov", spends, "notifySpent",
+		[]rpcjson.OutPoint{{Hash: spent.Hash.String()[2:]}})
+	if err == nil {
+		t.Error("notifySpent with a malformed hash succeeded")
+	}
+
+	block := asiutil.NewBlock(&protos.MsgBlock{
+		Header:       protos.BlockHeader{Timestamp: 1234},
+		Transactions: []*protos.MsgTx{payTx},
+	})
+	block.SetHeight(10)
+	m.notifyBlock(block, true)
+	m.notifyBlock(asiutil.NewBlock(&protos.MsgBlock{
+		Transactions: []*protos.MsgTx{redeemTx},
+	}), true)
+	m.notifyBlock(block, false)
+
+	for i, want := range []string{rpcjson.BlockConnectedNtfnEvent,
+		rpcjson.BlockConnectedNtfnEvent, rpcjson.BlockDisconnectedNtfnEvent} {
+		select {
+		case ntfn := <-blocks:
+			if ntfn.Event != want {
+				t.Errorf("block notification %d event %s, want %s",
+					i, ntfn.Event, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("block notification %d not received", i)
+		}
+	}
+
+	type relevantTx struct {
+		event string
+		tx    *asiutil.Tx
+	}
+	for _, test := range []struct {
+		name  string
+		ntfns chan *rpcjson.RelevantTxNtfn
+		want  []relevantTx
+	}{{
+		name:  "notifyReceived",
+		ntfns: received,
+		want: []relevantTx{
+			{rpcjson.RecvTxNtfnEvent, pay},
+			{rpcjson.RedeemingTxNtfnEvent, redeem},
+		},
+	}, {
+		name:  "notifySpent",
+		ntfns: spends,
+		want: []relevantTx{
+			{rpcjson.RedeemingTxNtfnEvent, pay},
+		},
+	}} {
+		for i, want := range test.want {
+			select {
+			case ntfn := <-test.ntfns:
+				if ntfn.Event != want.event || ntfn.TxID != want.tx.Hash().String() {
+					t.Errorf("%s notification %d: %s of %s, want %s of %s",
+						test.name, i, ntfn.Event, ntfn.TxID,
+						want.event, want.tx.Hash())
+				}
+				if ntfn.Block == nil {
+					t.Errorf("%s notification %d without its block",
+						test.name, i)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s notification %d not received", test.name, i)
+			}
+		}
+		select {
+		case ntfn := <-test.ntfns:
+			t.Errorf("unexpected %s notification %+v", test.name, ntfn)
+		default:
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+const (
+	// historicalServeWindow is the period over which the historical blocks
+	// served to a peer are limited.
+	historicalServeWindow = time.Hour * 24
+
+	// maxHistoricalServeHosts is the number of hosts tracked before the
+	// ones whose window expired are removed.
+	maxHistoricalServeHosts = 1000
+)
+
+// errHistoricalServeLimit is returned when a historical block is not served
+// since the peer reached its limit.
+var errHistoricalServeLimit = errors.New("historical serving limit reached")
+
+// historicalServed is the number of bytes of historical blocks served to a
+// host since the start of its window.
+type historicalServed struct {
+	start  time.Time
+	bytes  uint64
+	logged bool
+}
+
+// historicalServeLimiter limits the bytes of historical blocks, those deeper
+// than the historicaldepth option below the best block, served per day to each
+// peer.  The peers are tracked by host so they can't reset their limit by
+// reconnecting, except the peers forwarded by Tor which share an address.  It
+// keeps archive nodes from being drained by scrapers while serving the recent
+// blocks to everyone and the whole chain to the peers syncing at a reasonable
+// pace.
+type historicalServeLimiter struct {
+	mtx    sync.Mutex
+	limit  uint64
+	depth  int32
+	served map[string]*historicalServed
+	now    func() time.Time
+}
+
+// newHistoricalServeLimiter returns a limiter serving limit bytes of the blocks
+// deeper than depth per day to each peer.  It returns nil when limit is zero.
+func newHistoricalServeLimiter(limit uint64, depth int32) *historicalServeLimiter {
+	if limit == 0 {
+		return nil
+	}
+	return &historicalServeLimiter{
+		limit:  limit,
+		depth:  depth,
+		served: make(map[string]*historicalServed),
+		now:    time.Now,
+	}
+}
+
+// allow returns whether a block of the passed size at the passed height may be
+// served to the peer with the passed key while the best block is at the best
+// height, and accounts for it when it is historical.  A historical block is
+// served as long as the peer is below its limit, so the last one served in a
+// window may exceed it.
+func (l *historicalServeLimiter) allow(key string, height, bestHeight int32, size int) bool {
+	if l == nil || height >= bestHeight-l.depth {
+		return true
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := l.now()
+	if len(l.served) >= maxHistoricalServeHosts {
+		for k, served := range l.served {
+			if now.Sub(served.start) >= historicalServeWindow {
+				delete(l.served, k)
+			}
+		}
+	}
+	served, ok := l.served[key]
+	if !ok || now.Sub(served.start) >= historicalServeWindow {
+		served = &historicalServed{start: now}
+		l.served[key] = served
+	}
+	if served.bytes >= l.limit {
+		if !served.logged {
+			peerLog.Infof("Peer %s reached the limit of %d bytes of "+
+				"historical blocks served per day", key, l.limit)
+			served.logged = true
+		}
+		return false
+	}
+	served.bytes += uint64(size)
+	return true
+}
+
+// historicalServeKey returns the key the historical blocks served to the
+// passed peer are accounted by.
+func historicalServeKey(sp *serverPeer) string {
+	if sp.listenPolicy != chaincfg.ListenTor {
+		if host, _, err := net.SplitHostPort(sp.Addr()); err == nil {
+			return host
+		}
+	}
+	return fmt.Sprintf("peer %d", sp.ID())
+}
+
+// allowHistoricalBlock returns whether the block with the passed hash and
+// serialized size may be served to the peer.  The whitelisted peers and the
+// validators are not limited.
+func (s *NodeServer) allowHistoricalBlock(sp *serverPeer, hash *common.Hash, size int) bool {
+	if s.historicalLimiter == nil || sp.IsWhitelisted() ||
+		sp.listenPolicy == chaincfg.ListenValidator {
+
+		return true
+	}
+	height, err := s.chain.BlockHeightByHash(hash)
+	if err != nil {
+		// Blocks outside of the main chain are recent.
+		return true
+	}
+	best := s.chain.BestSnapshot()
+	return s.historicalLimiter.allow(historicalServeKey(sp), height,
+		best.Height, size)
+}
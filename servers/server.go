@@ -12,16 +12,23 @@ import (
 	"errors"
 	"fmt"
 	"github.com/AsimovNetwork/asimov/ainterface"
+	"github.com/AsimovNetwork/asimov/alert"
+	"github.com/AsimovNetwork/asimov/audit"
 	"github.com/AsimovNetwork/asimov/blockchain/syscontract"
 	"github.com/AsimovNetwork/asimov/blockchain/txo"
 	"github.com/AsimovNetwork/asimov/consensus/satoshiplus/minersync"
 	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/logger"
+	"github.com/AsimovNetwork/asimov/replication"
 	"github.com/AsimovNetwork/asimov/rpcs/node"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
 	"github.com/AsimovNetwork/asimov/rpcs/util"
+	"github.com/AsimovNetwork/asimov/supervisor"
+	"github.com/AsimovNetwork/asimov/tracing"
 	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -37,21 +44,29 @@ import (
 	"github.com/AsimovNetwork/asimov/chaincfg"
 	"github.com/AsimovNetwork/asimov/common"
 	fnet "github.com/AsimovNetwork/asimov/common/net"
+	"github.com/AsimovNetwork/asimov/common/serialization"
 	"github.com/AsimovNetwork/asimov/connmgr"
 	"github.com/AsimovNetwork/asimov/consensus"
 	"github.com/AsimovNetwork/asimov/consensus/params"
 	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/deposits"
+	"github.com/AsimovNetwork/asimov/feeestimator"
 	"github.com/AsimovNetwork/asimov/mempool"
 	"github.com/AsimovNetwork/asimov/mining"
 	"github.com/AsimovNetwork/asimov/netsync"
 	"github.com/AsimovNetwork/asimov/peer"
+	"github.com/AsimovNetwork/asimov/peerstats"
 	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/utxolock"
+	"github.com/AsimovNetwork/asimov/webhook"
 )
 
 const (
 	// defaultServices describes the default services that are supported by
 	// the NodeServer.
-	defaultServices = common.SFNodeNetwork | common.SFNodeBloom | common.SFNodeCF
+	defaultServices = common.SFNodeNetwork | common.SFNodeBloom | common.SFNodeCF |
+		common.SFNodeInvClasses
 
 	// defaultRequiredServices describes the default services that are
 	// required to be supported by outbound peers.
@@ -60,6 +75,23 @@ const (
 	// defaultTargetOutbound is the default number of outbound peers to target.
 	defaultTargetOutbound = 8
 
+	// webhookDeadLetterFilename is the name of the file in the data
+	// directory which records the undeliverable webhook events.
+	webhookDeadLetterFilename = "webhook_deadletter.log"
+
+	// forensicDirname is the name of the directory in the data directory
+	// which houses the forensic dumps of blocks diverging from the
+	// computed state.
+	forensicDirname = "forensics"
+
+	// stateExportDirname is the name of the directory in the data directory
+	// which houses the state exports.
+	stateExportDirname = "stateexports"
+
+	// utxoSnapshotDirname is the name of the directory in the data
+	// directory which houses the snapshots written by dumpUtxoSet.
+	utxoSnapshotDirname = "utxosnapshots"
+
 	// connectionRetryInterval is the base amount of time to wait in between
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
@@ -74,6 +106,10 @@ var (
 	// userAgentVersion is the user agent version and is used to help
 	// identify ourselves to other asimov peers.
 	userAgentVersion = fmt.Sprintf("%d.%d.%d", chaincfg.AppMajor, chaincfg.AppMinor, chaincfg.AppPatch)
+
+	// coarseUserAgentVersion is the user agent version advertised when the
+	// fine-grained version is suppressed.
+	coarseUserAgentVersion = fmt.Sprintf("%d.%d", chaincfg.AppMajor, chaincfg.AppMinor)
 )
 
 // broadcastMsg provides the ability to house a bitcoin message to be broadcast
@@ -116,7 +152,8 @@ type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
+	banned          map[string]banEntry
+	misbehavior     map[string]*hostMisbehavior
 	outboundGroups  map[string]int
 }
 
@@ -165,8 +202,13 @@ type NodeServer struct {
 	shutdownSched int32
 	startupTime   int64
 
+	// evictionSeed keys the network group hashes of the inbound eviction so
+	// the protected groups cannot be predicted.
+	evictionSeed uint64
+
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
+	nap                  fnet.NetAdapter
 	connManager          *connmgr.ConnManager
 	roundManger          ainterface.IRoundManager
 	syncManager          *netsync.SyncManager
@@ -196,9 +238,18 @@ type NodeServer struct {
 	// do not need to be protected for concurrent access.
 	txIndex       *indexers.TxIndex
 	addrIndex     *indexers.AddrIndex
+	logIndex      *indexers.LogIndex
 	cfIndex       *indexers.CfIndex
 	templateIndex blockchain.Indexer
 
+	// indexManager backfills the indexes far behind the main chain in the
+	// background.
+	indexManager *indexers.Manager
+
+	// historicalLimiter limits the historical blocks served per day to
+	// each peer.  It is nil when the historicalservelimit option is zero.
+	historicalLimiter *historicalServeLimiter
+
 	// cfCheckptCaches stores a cached slice of filter headers for cfcheckpt
 	// messages for each filter type.
 	cfCheckptCaches    map[protos.FilterType][]cfHeaderKV
@@ -212,19 +263,124 @@ type NodeServer struct {
 	// agentWhitelist is a list of whitelisted user agent substrings, no
 	// whitelisting will be applied if the list is empty or nil.
 	agentWhitelist []string
+
+	// webhooks delivers chain events to the configured webhooks.  It is
+	// nil when no webhook is configured.
+	webhooks      *webhook.Dispatcher
+	webhookWatch  map[string]struct{}
+	webhookBlocks chan webhookBlock
+
+	// webhookBlocksDropped counts the connected blocks not forwarded to
+	// the webhook handler since webhookBlocks was full.  It must be
+	// accessed atomically.
+	webhookBlocksDropped uint32
+
+	// invWatchContracts holds the contracts whose events are announced to
+	// the peers subscribed to the contract event inventory class.
+	invWatchContracts map[string]struct{}
+
+	// deposits tracks the deposits of the watched addresses and
+	// depositHooks delivers their callbacks.  They are nil unless the
+	// exchange mode is enabled.
+	deposits     *deposits.Tracker
+	depositHooks *webhook.Dispatcher
+
+	// consolidateAccount is the account whose outputs are consolidated
+	// automatically.  It is nil unless the consolidation is enabled.
+	consolidateAccount *crypto.Account
+
+	// utxoLocks holds the outputs locked with lockunspent.
+	utxoLocks *utxolock.Set
+
+	// feeEstimator estimates the gas prices from the confirmation delays
+	// of the mempool transactions.
+	feeEstimator *feeestimator.Estimator
+
+	// alerts sends operational alerts to the configured channels.  It is
+	// nil when no alert channel is configured.
+	alerts         *alert.Manager
+	alertSlots     chan alertSlot
+	alertValidator *common.Address
+
+	// alertSlotsDropped counts the slots not forwarded to the alert
+	// monitor since alertSlots was full.  It must be accessed atomically.
+	alertSlotsDropped uint32
+
+	// compactor compacts the block and state databases on schedule or on
+	// request.
+	compactor *dbCompactor
+
+	// auditLog records the acceptance decisions of blocks and transactions.
+	// It is nil when auditing is disabled.
+	auditLog *audit.Log
+
+	// keyRotation schedules the switch of the validator key, nil when no
+	// rotation is configured.
+	keyRotation *keyRotation
+
+	// devAccount produces the blocks and funds the developer accounts in
+	// the developer mode, and devTxs wakes up the solo consensus when
+	// transactions are accepted to the mempool.  Both are nil otherwise.
+	devAccount *crypto.Account
+	devTxs     chan struct{}
+
+	// rpcCache caches the RPC responses for immutable data.  It is nil when
+	// caching is disabled.
+	rpcCache *rpcCache
+
+	// templateCache caches the templates of the template warehouse for
+	// the RPC server.
+	templateCache *templateCache
+
+	// wsNotifications dispatches the block and transaction notifications
+	// to the websocket subscriptions of the RPC server.
+	wsNotifications *wsNotificationManager
+
+	// gbtLongPoll wakes up the getBlockTemplate long polls when their
+	// templates go stale.
+	gbtLongPoll *gbtLongPoll
+
+	// replPrimary streams the main chain blocks to the replication
+	// secondaries and replSecondary follows the replication primary.  They
+	// are nil unless configured.
+	replPrimary   *replication.Primary
+	replSecondary *replication.Secondary
+
+	// supervisor recovers the panics of the subsystems which are not part
+	// of consensus.
+	supervisor *supervisor.Supervisor
+
+	// tracer exports the spans of block processing, mempool acceptance and
+	// RPC calls.  It is nil when tracing is disabled.
+	tracer *tracing.Tracer
+
+	// peerStats keeps the long-term statistics of the peers by network
+	// group, which are used to prefer the good peers on reconnect.
+	peerStats *peerstats.Store
+
+	// asMap maps the IP addresses of the peers to their AS.  It is nil
+	// unless an AS map is configured.
+	asMap *addrmgr.ASMap
 }
 
 // serverPeer extends the peer to maintain state shared by the NodeServer and
 // the blockmanager.
 type serverPeer struct {
-	// The following variables must only be used atomically
-	priceFilter int32
+	// The following variables must only be used atomically.
+	// lastBlockTime and lastTxTime are the last times in nanoseconds the
+	// peer relayed a block and a transaction.  Putting the int64s first
+	// makes them 64-bit aligned for 32-bit systems.
+	lastBlockTime int64
+	lastTxTime    int64
+	priceFilter   int32
 
 	*peer.Peer
 
 	connReq        *connmgr.ConnReq
 	server         *NodeServer
 	persistent     bool
+	feeler         bool
+	listenPolicy   chaincfg.ListenPolicy
 	continueHash   *common.Hash
 	relayMtx       sync.Mutex
 	disableRelayTx bool
@@ -375,7 +531,28 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *protos.MsgVersion) *protos.Ms
 // OnVerAck is invoked when a peer receives a verack bitcoin message and is used
 // to kick start communication with them.
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *protos.MsgVerAck) {
+	// A feeler connection only tests the address, which is known to be
+	// good once the version negotiation completed.
+	if sp.feeler {
+		srvrLog.Debugf("Feeler connection to %s succeeded", sp)
+		sp.server.addrManager.Good(sp.NA())
+		sp.Disconnect()
+		return
+	}
+
 	sp.server.AddPeer(sp)
+
+	// Ask the peer to announce new blocks with headers rather than
+	// inventory vectors when it supports it.
+	if sp.ProtocolVersion() >= common.SendHeadersVersion {
+		sp.QueueMessage(protos.NewMsgSendHeaders(), nil)
+	}
+
+	// Ask the peer to compress the large payloads it sends.
+	if !chaincfg.Cfg.NoCompression &&
+		sp.ProtocolVersion() >= common.CompressionVersion {
+		sp.QueueMessage(protos.NewMsgSendCompression(protos.CodecZstd), nil)
+	}
 }
 
 // OnMemPool is invoked when a peer receives a mempool bitcoin message.
@@ -451,6 +628,7 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *protos.MsgTx) {
 	// being disconnected) and wasting memory.
 	sp.server.syncManager.QueueTx(tx, sp.Peer, sp.txProcessed)
 	<-sp.txProcessed
+	atomic.StoreInt64(&sp.lastTxTime, time.Now().UnixNano())
 }
 
 func (sp *serverPeer) OnSig(_ *peer.Peer, msg *protos.MsgBlockSign) {
@@ -492,6 +670,11 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *protos.MsgBlock, buf []byte) {
 	// the bitcoin block has been fully processed.
 	sp.server.syncManager.QueueBlock(block, sp.Peer, sp.blockProcessed)
 	<-sp.blockProcessed
+	atomic.StoreInt64(&sp.lastBlockTime, time.Now().UnixNano())
+
+	if group := sp.statsGroup(); group != "" {
+		sp.server.peerStats.AddBlock(group)
+	}
 }
 
 // OnInv is invoked when a peer receives an inv bitcoin message and is
@@ -578,6 +761,9 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *protos.MsgGetData) {
 				c <- struct{}{}
 			}
 			// skip
+		case protos.InvTypeAssetIssuance, protos.InvTypeContractEvent:
+			// The inventory classes are announcements only.
+			err = errors.New("inventory class is not served")
 		default:
 			peerLog.Warnf("Unknown type in inventory request %d",
 				iv.Type)
@@ -680,6 +866,23 @@ func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *protos.MsgGetHeaders) {
 	sp.QueueMessage(&protos.MsgHeaders{Headers: blockHeaders}, nil)
 }
 
+// servesFilterType returns whether the committed filters of the passed type are
+// served to the peers.
+func (sp *serverPeer) servesFilterType(filterType protos.FilterType) bool {
+	if sp.server.cfIndex == nil {
+		return false
+	}
+	switch filterType {
+	case protos.GCSFilterRegular, protos.GCSFilterContract:
+		return true
+
+	default:
+		peerLog.Debugf("Filter request for unknown filter: %v",
+			filterType)
+		return false
+	}
+}
+
 // OnGetCFilters is invoked when a peer receives a getcfilters bitcoin message.
 func (sp *serverPeer) OnGetCFilters(_ *peer.Peer, msg *protos.MsgGetCFilters) {
 	// Ignore getcfilters requests if not in sync.
@@ -689,13 +892,7 @@ func (sp *serverPeer) OnGetCFilters(_ *peer.Peer, msg *protos.MsgGetCFilters) {
 
 	// We'll also ensure that the remote party is requesting a set of
 	// filters that we actually currently maintain.
-	switch msg.FilterType {
-	case protos.GCSFilterRegular:
-		break
-
-	default:
-		peerLog.Debug("Filter request for unknown filter: %v",
-			msg.FilterType)
+	if !sp.servesFilterType(msg.FilterType) {
 		return
 	}
 
@@ -745,13 +942,7 @@ func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *protos.MsgGetCFHeaders)
 
 	// We'll also ensure that the remote party is requesting a set of
 	// headers for filters that we actually currently maintain.
-	switch msg.FilterType {
-	case protos.GCSFilterRegular:
-		break
-
-	default:
-		peerLog.Debug("Filter request for unknown headers for "+
-			"filter: %v", msg.FilterType)
+	if !sp.servesFilterType(msg.FilterType) {
 		return
 	}
 
@@ -851,13 +1042,7 @@ func (sp *serverPeer) OnGetCFCheckpt(_ *peer.Peer, msg *protos.MsgGetCFCheckpt)
 
 	// We'll also ensure that the remote party is requesting a set of
 	// checkpoints for filters that we actually currently maintain.
-	switch msg.FilterType {
-	case protos.GCSFilterRegular:
-		break
-
-	default:
-		peerLog.Debug("Filter request for unknown checkpoints for "+
-			"filter: %v", msg.FilterType)
+	if !sp.servesFilterType(msg.FilterType) {
 		return
 	}
 
@@ -1135,6 +1320,19 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *protos.MsgGetAddr) {
 // OnAddr is invoked when a peer receives an addr bitcoin message and is
 // used to notify the NodeServer about advertised addresses.
 func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *protos.MsgAddr) {
+	sp.handleAddresses(msg.Command(), msg.AddrList)
+}
+
+// OnAddrV2 is invoked when a peer receives an addrv2 message and is used to
+// notify the NodeServer about advertised addresses, which may be Tor v3 and
+// I2P addresses.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *protos.MsgAddrV2) {
+	sp.handleAddresses(msg.Command(), msg.AddrList)
+}
+
+// handleAddresses adds the addresses advertised by the peer with the passed
+// command to the address manager.
+func (sp *serverPeer) handleAddresses(command string, addrList []*protos.NetAddress) {
 	// Ignore addresses when running on the simulation test network.  This
 	// helps prevent the network from becoming another public test network
 	// since it will not be able to learn about other peers that have not
@@ -1144,14 +1342,14 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *protos.MsgAddr) {
 	}
 
 	// A message that has no addresses is invalid.
-	if len(msg.AddrList) == 0 {
+	if len(addrList) == 0 {
 		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
-			msg.Command(), sp.Peer)
+			command, sp.Peer)
 		sp.Disconnect()
 		return
 	}
 
-	for _, na := range msg.AddrList {
+	for _, na := range addrList {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
 			return
@@ -1174,7 +1372,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *protos.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrList, sp.NA())
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
@@ -1246,6 +1444,16 @@ func (s *NodeServer) AnnounceNewTransactions(txns []*mining.TxDesc) {
 	// Generate and relay inventory vectors for all newly accepted
 	// transactions.
 	s.relayTransactions(txns)
+
+	s.notifyPendingDeposits(txns)
+
+	s.observeFees(txns)
+
+	s.wsNotifications.notifyNewTransactions(txns)
+
+	s.gbtLongPoll.notifyNewTransactions(txns)
+
+	s.notifyDevTxs(txns)
 }
 
 // Transaction has one confirmation on the main chain. Now we can mark it as no
@@ -1355,6 +1563,9 @@ func (s *NodeServer) pushBlockMsg(sp *serverPeer, hash *common.Hash, doneChan ch
 		blockBytes, err = dbTx.FetchBlock(database.NewNormalBlockKey(hash))
 		return err
 	})
+	if err == nil && !s.allowHistoricalBlock(sp, hash, len(blockBytes)) {
+		err = errHistoricalServeLimit
+	}
 	if err != nil {
 		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
 			hash, err)
@@ -1426,6 +1637,11 @@ func (s *NodeServer) pushMerkleBlockMsg(sp *serverPeer, hash *common.Hash,
 
 	// Fetch the raw block bytes from the database.
 	blk, err := sp.server.chain.BlockByHash(hash)
+	if err == nil && !s.allowHistoricalBlock(sp, hash,
+		blk.MsgBlock().SerializeSize()) {
+
+		err = errHistoricalServeLimit
+	}
 	if err != nil {
 		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
 			hash, err)
@@ -1518,17 +1734,18 @@ func (s *NodeServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		return false
 	}
 
-	// Disconnect banned peers.
+	// Disconnect banned peers.  The peers of a Tor listener share the
+	// address of the Tor daemon so they are not banned by address.
 	host, _, err := net.SplitHostPort(sp.Addr())
 	if err != nil {
 		srvrLog.Debugf("can't split hostport %v", err)
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd))
+	if ban, ok := state.banned[host]; ok && sp.listenPolicy != chaincfg.ListenTor {
+		if time.Now().Before(ban.until) {
+			srvrLog.Debugf("Peer %s is banned for another %v (%s) - "+
+				"disconnecting", host, time.Until(ban.until), ban.reason)
 			sp.Disconnect()
 			return false
 		}
@@ -1539,8 +1756,13 @@ func (s *NodeServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if state.Count() >= chaincfg.Cfg.MaxPeers {
+	// Limit max number of total peers.  The peers of a validator listener
+	// are always accepted so the validator mesh is not crowded out, and
+	// the least valuable inbound peer is evicted to make room for a new
+	// inbound peer when possible.
+	if state.Count() >= chaincfg.Cfg.MaxPeers &&
+		sp.listenPolicy != chaincfg.ListenValidator &&
+		(!sp.Inbound() || !s.evictInboundPeer(state)) {
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
 			chaincfg.Cfg.MaxPeers, sp)
 		sp.Disconnect()
@@ -1554,7 +1776,7 @@ func (s *NodeServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.netGroup(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1607,6 +1829,8 @@ func (s *NodeServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 // handleDonePeerMsg deals with peers that have signalled they are done.  It is
 // invoked from the peerHandler goroutine.
 func (s *NodeServer) handleDonePeerMsg(state *peerState, sp *serverPeer) {
+	s.handleMisbehavior(state, sp)
+
 	var list map[int32]*serverPeer
 	if sp.persistent {
 		list = state.persistentPeers
@@ -1629,7 +1853,7 @@ func (s *NodeServer) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.netGroup(sp.NA())]--
 		}
 		delete(list, sp.ID())
 		srvrLog.Debugf("Removed peer %s", sp)
@@ -1640,6 +1864,10 @@ func (s *NodeServer) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 // handleBanPeerMsg deals with banning peers.  It is invoked from the
 // peerHandler goroutine.
 func (s *NodeServer) handleBanPeerMsg(state *peerState, sp *serverPeer) {
+	if sp.listenPolicy == chaincfg.ListenTor {
+		srvrLog.Infof("Not banning Tor peer %s by address", sp)
+		return
+	}
 	host, _, err := net.SplitHostPort(sp.Addr())
 	if err != nil {
 		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
@@ -1648,7 +1876,10 @@ func (s *NodeServer) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 	direction := fnet.DirectionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		chaincfg.Cfg.BanDuration)
-	state.banned[host] = time.Now().Add(chaincfg.Cfg.BanDuration)
+	state.banned[host] = banEntry{
+		until:  time.Now().Add(chaincfg.Cfg.BanDuration),
+		reason: "ban score exceeded",
+	}
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
@@ -1659,10 +1890,21 @@ func (s *NodeServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 			return
 		}
 
+		// Don't announce the inventory classes the peer didn't
+		// subscribe to.
+		if !sp.WantsInv(msg.invVect.Type) {
+			return
+		}
+
 		// If the inventory is a block and the peer prefers headers,
 		// generate and send a headers message instead of an inventory
 		// message.
 		if msg.invVect.Type == protos.InvTypeBlock && sp.WantsHeaders() {
+			// Don't announce the block to a peer which is already
+			// known to have it.
+			if sp.IsKnownInventory(msg.invVect) {
+				return
+			}
 			blockHeader, ok := msg.data.(protos.BlockHeader)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
@@ -1675,6 +1917,7 @@ func (s *NodeServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					" header: %v", err)
 				return
 			}
+			sp.AddKnownInventory(msg.invVect)
 			sp.QueueMessage(msgHeaders, nil)
 			return
 		}
@@ -1743,6 +1986,11 @@ type getPeersMsg struct {
 	reply chan []*serverPeer
 }
 
+// pushBlockMsg pushes a block to the whitelisted peers.
+type pushBlockMsg struct {
+	block *asiutil.Block
+}
+
 type getOutboundGroup struct {
 	key   string
 	reply chan int
@@ -1781,6 +2029,26 @@ func (s *NodeServer) handleQuery(state *peerState, querymsg interface{}) {
 		})
 		msg.reply <- nconnected
 
+	case pushBlockMsg:
+		iv := protos.NewInvVect(protos.InvTypeBlock, msg.block.Hash())
+		state.forAllPeers(func(sp *serverPeer) {
+			if !sp.Connected() || !sp.IsWhitelisted() ||
+				sp.IsKnownInventory(iv) {
+				return
+			}
+			sp.AddKnownInventory(iv)
+			sp.QueueMessage(msg.block.MsgBlock(), nil)
+		})
+
+	case getBanListMsg:
+		msg.reply <- s.handleGetBanList(state)
+
+	case addBansMsg:
+		msg.reply <- s.handleAddBans(state, msg.bans)
+
+	case removeBansMsg:
+		msg.reply <- s.handleRemoveBans(state, msg.hosts)
+
 	case getPeersMsg:
 		peers := make([]*serverPeer, 0, state.Count())
 		state.forAllPeers(func(sp *serverPeer) {
@@ -1825,7 +2093,7 @@ func (s *NodeServer) handleQuery(state *peerState, querymsg interface{}) {
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.netGroup(sp.NA())]--
 		})
 
 		if found {
@@ -1861,7 +2129,7 @@ func (s *NodeServer) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.netGroup(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -1869,7 +2137,7 @@ func (s *NodeServer) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.netGroup(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -1906,6 +2174,10 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
+	uaVersion := userAgentVersion
+	if chaincfg.Cfg.UACoarseVersion {
+		uaVersion = coarseUserAgentVersion
+	}
 	return &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:      sp.OnVersion,
@@ -1928,20 +2200,27 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnFilterLoad:   sp.OnFilterLoad,
 			OnGetAddr:      sp.OnGetAddr,
 			OnAddr:         sp.OnAddr,
+			OnAddrV2:       sp.OnAddrV2,
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
 			OnBan:          sp.OnBan,
+			OnPong:         sp.OnPong,
+			OnMisbehavior:  sp.OnMisbehavior,
 		},
-		NewestBlock:       sp.newestBlock,
-		HostToNetAddress:  sp.server.addrManager.HostToNetAddress,
-		Proxy:             chaincfg.Cfg.Proxy,
-		UserAgentName:     userAgentName,
-		UserAgentVersion:  userAgentVersion,
-		UserAgentComments: chaincfg.Cfg.UserAgentComments,
-		ChainParams:       sp.server.chainParams,
-		Services:          sp.server.services,
-		DisableRelayTx:    chaincfg.Cfg.BlocksOnly,
-		ProtocolVersion:   peer.MaxProtocolVersion,
+		NewestBlock:        sp.newestBlock,
+		HostToNetAddress:   sp.server.addrManager.HostToNetAddress,
+		Proxy:              chaincfg.Cfg.Proxy,
+		UserAgentName:      userAgentName,
+		UserAgentVersion:   uaVersion,
+		UserAgentComments:  chaincfg.Cfg.UserAgentComments,
+		ChainParams:        sp.server.chainParams,
+		Services:           sp.server.services,
+		DisableRelayTx:     chaincfg.Cfg.BlocksOnly,
+		Metadata:           chaincfg.Cfg.HandshakeMeta,
+		ProtocolVersion:    peer.MaxProtocolVersion,
+		HandshakeJitter:    chaincfg.Cfg.HandshakeJitter,
+		IgnoreWhitelist:    sp.listenPolicy == chaincfg.ListenTor,
+		DisableCompression: chaincfg.Cfg.NoCompression,
 	}
 }
 
@@ -1950,7 +2229,16 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *NodeServer) inboundPeerConnected(conn net.Conn) {
+	policy := connListenPolicy(conn)
+	if policy.WhitelistOnly() && !peer.IsWhitelisted(conn.RemoteAddr()) {
+		srvrLog.Debugf("Rejecting connection from %s to %s listener %s: "+
+			"not whitelisted", conn.RemoteAddr(), policy, conn.LocalAddr())
+		conn.Close()
+		return
+	}
+
 	sp := newServerPeer(s, false)
+	sp.listenPolicy = policy
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
@@ -1990,6 +2278,10 @@ func (s *NodeServer) peerDoneHandler(sp *serverPeer) {
 	if sp.VerAckReceived() {
 		s.syncManager.DonePeer(sp.Peer)
 
+		if group := sp.statsGroup(); group != "" {
+			s.peerStats.AddSession(group, time.Since(sp.TimeConnected()))
+		}
+
 		// Evict any remaining orphans that were sent by the peer.
 		numEvicted := s.txMemPool.RemoveOrphansByTag(mempool.Tag(sp.ID()))
 		if numEvicted > 0 {
@@ -2019,13 +2311,27 @@ func (s *NodeServer) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
+		banned:          make(map[string]banEntry),
+		misbehavior:     make(map[string]*hostMisbehavior),
 		outboundGroups:  make(map[string]int),
 	}
 
 	if !chaincfg.Cfg.DisableDNSSeed {
-		// Add peers discovered through DNS to the address manager.
-		s.addrManager.SeedFromDNS(chaincfg.ActiveNetParams.Params, defaultRequiredServices)
+		// Add peers discovered through DNS, or the fixed seeds when no
+		// DNS seed answers, to the address manager.
+		params := chaincfg.ActiveNetParams.Params
+		dnsSeeds := params.DNSSeeds
+		if len(chaincfg.Cfg.DNSSeeds) > 0 {
+			dnsSeeds = chaincfg.Cfg.DNSSeeds
+		}
+		go connmgr.SeedPeers(dnsSeeds, params.FixedSeeds, params.DefaultPort,
+			defaultRequiredServices, s.nap.Lookup,
+			func(addrs []*protos.NetAddress) {
+				// Bitcoind uses a lookup of the dns seeder here.  The
+				// addresses vary a lot between lookups, so all of them
+				// are added as coming from the first one.
+				s.addrManager.AddAddresses(addrs, addrs[0])
+			})
 	}
 	go s.connManager.Start()
 
@@ -2109,6 +2415,14 @@ func (s *NodeServer) RelayInventory(invVect *protos.InvVect, data interface{}) {
 	s.relayInv <- relayMsg{invVect: invVect, data: data}
 }
 
+// PushBlock sends a block produced by this node directly to the whitelisted
+// peers which do not know it yet, without announcing it first.  The block is
+// pushed before the next inventory is relayed, so the pushed peers are not
+// announced the block.
+func (s *NodeServer) PushBlock(block *asiutil.Block) {
+	s.query <- pushBlockMsg{block: block}
+}
+
 // BroadcastMessage sends msg to all peers currently connected to the NodeServer
 // except those in the passed peers to exclude.
 func (s *NodeServer) BroadcastMessage(msg protos.Message, exclPeers ...*serverPeer) {
@@ -2168,7 +2482,8 @@ func (s *NodeServer) UpdatePeerHeights(latestBlkHash *common.Hash, latestHeight
 
 // rebroadcastHandler keeps track of user submitted inventories that we have
 // sent out but have not yet made it into a block. We periodically rebroadcast
-// them in case our peers restarted or otherwise lost track of them.
+// them in case our peers restarted or otherwise lost track of them.  It must
+// be run with goSupervised.
 func (s *NodeServer) rebroadcastHandler() {
 	// Wait 5 min before first tx rebroadcast.
 	timer := time.NewTimer(5 * time.Minute)
@@ -2221,7 +2536,6 @@ cleanup:
 			break cleanup
 		}
 	}
-	s.wg.Done()
 }
 
 // Start begins accepting connections from peers.
@@ -2236,6 +2550,21 @@ func (s *NodeServer) Start() {
 	// Server startup time. Used for the uptime command for uptime calculation.
 	s.startupTime = time.Now().Unix()
 
+	if s.tracer != nil {
+		s.tracer.Start()
+	}
+
+	// A read replica only serves queries from its read-only databases, so
+	// it starts none of the subsystems writing to them or to the network.
+	if chaincfg.Cfg.ReadReplica {
+		if !chaincfg.Cfg.DisableRPC {
+			util.StartNode(s.stack)
+		}
+		srvrLog.Infof("Running as a read replica, peers and consensus " +
+			"are disabled")
+		return
+	}
+
 	// Make sure round manager start firstly
 	s.roundManger.Start()
 
@@ -2251,16 +2580,72 @@ func (s *NodeServer) Start() {
 		go s.upnpUpdateThread()
 	}
 
-	if !chaincfg.Cfg.DisableRPC {
+	if chaincfg.Cfg.TorControl != "" {
 		s.wg.Add(1)
+		go s.torControlThread()
+	}
+
+	if s.webhooks != nil {
+		s.webhooks.Start()
+		s.goSupervised("webhooks", s.webhookHandler)
+	}
+
+	if s.depositHooks != nil {
+		s.depositHooks.Start()
+	}
+
+	if s.alerts != nil {
+		s.goSupervised("alerts", s.alertMonitor)
+	}
 
+	if s.consolidateAccount != nil {
+		s.goSupervised("consolidation", s.consolidationMonitor)
+	}
+
+	if s.devAccount != nil {
+		s.goSupervised("devfunding", s.devFundMonitor)
+	}
+
+	if chaincfg.Cfg.MinDiskSpace > 0 {
+		s.goSupervised("diskspace", s.diskSpaceMonitor)
+	}
+
+	s.goSupervised("compaction", s.compactionHandler)
+	s.goSupervised("peerstats", s.peerStatsHandler)
+
+	if chaincfg.Cfg.BanFeed != "" {
+		s.goSupervised("banfeed", s.banFeedHandler)
+	}
+
+	// Feeler connections test the discovered addresses, which are not
+	// connected to on the test networks or when connecting only to the
+	// specified peers.
+	if !chaincfg.Cfg.SimNet && !chaincfg.Cfg.TestNet &&
+		!chaincfg.Cfg.DevelopNet && len(chaincfg.Cfg.ConnectPeers) == 0 {
+		s.goSupervised("feeler", s.feelerHandler)
+	}
+
+	if !chaincfg.Cfg.DisableRPC {
 		// Start the rebroadcastHandler, which ensures user tx received by
 		// the RPC server are rebroadcast until being included in a block.
-		go s.rebroadcastHandler()
+		s.goSupervised("rebroadcast", s.rebroadcastHandler)
 
 		util.StartNode(s.stack)
 	}
 
+	if s.replPrimary != nil {
+		s.replPrimary.Start()
+	}
+
+	// A secondary follows the blocks of its primary, which takes part in
+	// consensus in its place.
+	if s.replSecondary != nil {
+		s.replSecondary.Start()
+		srvrLog.Infof("Running as a replication secondary, consensus " +
+			"is disabled")
+		return
+	}
+
 	// Start the consensus server.
 	if err := s.consensus.Start(); err != nil {
 		panic(err)
@@ -2294,6 +2679,48 @@ func (s *NodeServer) Stop() {
 	s.roundManger.Halt()
 
 	s.txMemPool.Halt()
+	if !chaincfg.Cfg.NoPersistMempool && !chaincfg.Cfg.ReadReplica {
+		err := saveMempool(s.txMemPool, filepath.Join(chaincfg.Cfg.DataDir, mempoolFilename))
+		if err != nil {
+			srvrLog.Errorf("Unable to save the mempool: %v", err)
+		}
+	}
+
+	if s.indexManager != nil {
+		s.indexManager.Stop()
+	}
+
+	if s.webhooks != nil {
+		s.webhooks.Stop()
+	}
+
+	if s.depositHooks != nil {
+		s.depositHooks.Stop()
+	}
+
+	// The state of a read replica is left as found in its data directory.
+	if !chaincfg.Cfg.ReadReplica {
+		if s.depositHooks != nil {
+			if err := s.deposits.Save(); err != nil {
+				srvrLog.Errorf("Unable to save deposits: %v", err)
+			}
+		}
+
+		if err := s.utxoLocks.Save(); err != nil {
+			srvrLog.Errorf("Unable to save locked outputs: %v", err)
+		}
+
+		if err := s.feeEstimator.Save(); err != nil {
+			srvrLog.Errorf("Unable to save fee estimates: %v", err)
+		}
+	}
+
+	if s.replPrimary != nil {
+		s.replPrimary.Stop()
+	}
+	if s.replSecondary != nil {
+		s.replSecondary.Stop()
+	}
 
 	// Signal the remaining goroutines to quit.
 	close(s.quit)
@@ -2303,6 +2730,19 @@ func (s *NodeServer) Stop() {
 // WaitForShutdown blocks until the main listener and peer handlers are stopped.
 func (s *NodeServer) WaitForShutdown() {
 	s.wg.Wait()
+
+	// No block is connected anymore, write the utxo changes still cached
+	// so they don't have to be replayed on the next start.
+	if err := s.chain.FlushUtxoCache(); err != nil {
+		srvrLog.Errorf("Unable to flush the utxo cache: %v", err)
+	}
+	if s.tracer != nil {
+		tracing.SetTracer(nil)
+		s.tracer.Stop()
+	}
+	if err := s.auditLog.Close(); err != nil {
+		srvrLog.Errorf("Unable to close audit log: %v", err)
+	}
 	srvrLog.Infof("Server shutdown complete")
 }
 
@@ -2413,8 +2853,18 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	if chaincfg.Cfg.NoCFilters {
 		services &^= common.SFNodeCF
 	}
+	if chaincfg.Cfg.NoInvClasses {
+		services &^= common.SFNodeInvClasses
+	}
+	if chaincfg.Cfg.Prune != 0 || chaincfg.Cfg.LoadUtxoSet != "" {
+		services &^= common.SFNodeNetwork
+	}
+	if chaincfg.Cfg.QUIC && !chaincfg.Cfg.DisableListen {
+		services |= common.SFNodeQUIC
+	}
 
 	cfg := chaincfg.Cfg
+	setWorkerPoolSizes(cfg)
 
 	genesisBlock, err := asiutil.LoadBlockFromFile(cfg.GenesisBlockFile)
 	if err != nil {
@@ -2430,7 +2880,7 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	chaincfg.ActiveNetParams.GenesisBlock = genesisBlock
 
 	nap := fnet.NewNetAdapter(cfg.Proxy, cfg.ProxyUser, cfg.ProxyPass,
-		cfg.OnionProxy, cfg.OnionProxyUser, cfg.ProxyPass, cfg.TorIsolation, cfg.NoOnion)
+		cfg.OnionProxy, cfg.OnionProxyUser, cfg.OnionProxyPass, cfg.TorIsolation, cfg.NoOnion)
 
 	amgr := addrmgr.New(chaincfg.Cfg.DataDir, nap)
 
@@ -2457,6 +2907,7 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	s := NodeServer{
 		chainParams:          chainParams,
 		addrManager:          amgr,
+		nap:                  nap,
 		newPeers:             make(chan *serverPeer, chaincfg.Cfg.MaxPeers),
 		donePeers:            make(chan *serverPeer, chaincfg.Cfg.MaxPeers),
 		banPeers:             make(chan *serverPeer, chaincfg.Cfg.MaxPeers),
@@ -2474,6 +2925,15 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 		agentBlacklist:       agentBlacklist,
 		agentWhitelist:       agentWhitelist,
 		startupTime:          time.Now().Unix(),
+		historicalLimiter: newHistoricalServeLimiter(
+			chaincfg.Cfg.HistoricalServeLimit*1024*1024,
+			chaincfg.Cfg.HistoricalDepth),
+	}
+	s.supervisor = s.newSupervisor()
+
+	s.evictionSeed, err = serialization.RandomUint64()
+	if err != nil {
+		return nil, err
 	}
 
 	// Create the transaction and address indexes.
@@ -2484,6 +2944,8 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	indexes = append(indexes, s.templateIndex)
 	s.addrIndex = indexers.NewAddrIndex(db)
 	indexes = append(indexes, s.addrIndex)
+	s.logIndex = indexers.NewLogIndex(db, stateDB)
+	indexes = append(indexes, s.logIndex)
 	// Create cf index if needed
 	if !chaincfg.Cfg.NoCFilters {
 		s.cfIndex = indexers.NewCfIndex(db)
@@ -2493,7 +2955,11 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
-		indexManager = indexers.NewManager(db, indexes)
+		s.indexManager = indexers.NewManager(db, indexes)
+		indexManager = &supervisedIndexManager{
+			IndexManager: s.indexManager,
+			supervisor:   s.supervisor,
+		}
 	}
 
 	// Create a contract manager.
@@ -2528,31 +2994,168 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	// create fees chan
 	feesChan := make(chan interface{})
 
+	// The signature cache is shared by the mempool, the block template
+	// generator and the chain, so the signatures verified when the
+	// transactions are admitted aren't verified again in blocks.
+	sigCache := txscript.NewSigCache(cfg.SigCacheMaxSize)
+
+	if cfg.LoadUtxoSet != "" {
+		if err := loadUtxoSet(db, stateDB, s.chainParams, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	engine, err := consensus.NewEngine(cfg.Consensustype)
+	if err != nil {
+		return nil, err
+	}
 	s.chain, err = blockchain.New(&blockchain.Config{
 		DB:              s.db,
 		Interrupt:       interrupt,
 		ChainParams:     s.chainParams,
 		Checkpoints:     checkpoints,
+		AssumeValid:     cfg.AssumeValidHash,
 		TimeSource:      s.timeSource,
 		IndexManager:    indexManager,
+		SigCache:        sigCache,
 		StateDB:         stateDB,
 		TemplateIndex:   s.templateIndex,
 		BtcClient:       btcClient,
 		RoundManager:    roundManger,
+		Engine:          engine,
 		ContractManager: contractManager,
 		FeesChan:        feesChan,
+		ForensicDir:     filepath.Join(cfg.DataDir, forensicDirname),
+
+		SafeModeReorgDepth: cfg.SafeModeReorgDepth,
+		UtxoCacheMaxSize:   cfg.UtxoCacheMaxSize * 1024 * 1024,
+		PruneTarget:        cfg.Prune * 1024 * 1024,
+		PruneDepth:         cfg.PruneDepth,
+		ReadOnly:           cfg.ReadReplica,
+		PenaltyRules: blockchain.PenaltyRules{
+			Equivocation: blockchain.PenaltyMode(cfg.EquivocationPenalty),
+			InvalidBlock: blockchain.PenaltyMode(cfg.InvalidBlockPenalty),
+			Rounds:       cfg.PenaltyRounds,
+		},
 	}, chaincfg.Cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	s.rpcCache = newRPCCache(cfg.RPCCacheSize * 1024 * 1024)
+	if s.rpcCache != nil {
+		s.chain.Subscribe(s.supervised("rpccache", s.handleRPCCacheNotification))
+	}
+
+	s.templateCache = newTemplateCache()
+	s.chain.Subscribe(s.supervised("templatecache", s.handleTemplateCacheNotification))
+
+	if err := s.newReplication(cfg); err != nil {
+		return nil, err
+	}
+
+	s.compactor = newDBCompactor(cfg.CompactInterval)
+	s.compactor.add("block", db)
+	s.compactor.add("state", stateDB)
+
+	if len(cfg.Webhooks) > 0 {
+		s.webhooks = webhook.New(&webhook.Config{
+			URLs:           cfg.Webhooks,
+			Secret:         cfg.WebhookSecret,
+			Events:         cfg.WebhookEventTypes,
+			MaxRetries:     cfg.WebhookMaxRetries,
+			DeadLetterFile: filepath.Join(cfg.DataDir, webhookDeadLetterFilename),
+		})
+		s.webhookWatch = make(map[string]struct{})
+		for _, addr := range cfg.WebhookWatchAddrs {
+			watchAddr, err := asiutil.DecodeAddress(addr)
+			if err != nil {
+				return nil, err
+			}
+			s.webhookWatch[watchAddr.EncodeAddress()] = struct{}{}
+		}
+		s.webhookBlocks = make(chan webhookBlock, chaincfg.Cfg.MaxPeers)
+		s.chain.Subscribe(s.supervised("webhooks", s.handleWebhookNotification))
+	}
+
+	if cfg.ExchangeMode {
+		s.deposits = deposits.New(filepath.Join(cfg.DataDir, depositsFilename))
+		if err := s.deposits.Load(); err != nil {
+			return nil, err
+		}
+		s.depositHooks = webhook.New(&webhook.Config{
+			Secret:         cfg.WebhookSecret,
+			MaxRetries:     cfg.WebhookMaxRetries,
+			Workers:        depositWorkers,
+			DeadLetterFile: filepath.Join(cfg.DataDir, depositDeadLetterFilename),
+		})
+		s.chain.Subscribe(s.supervised("deposits", s.handleDepositNotification))
+	}
+
+	if services&common.SFNodeInvClasses == common.SFNodeInvClasses {
+		s.invWatchContracts = make(map[string]struct{})
+		for _, addr := range cfg.InvWatchContracts {
+			contract, err := asiutil.DecodeAddress(addr)
+			if err != nil {
+				return nil, err
+			}
+			s.invWatchContracts[contract.EncodeAddress()] = struct{}{}
+		}
+		s.chain.Subscribe(s.supervised("invclasses", s.handleInvClassNotification))
+	}
+
+	lockFile := ""
+	if cfg.PersistLockUnspent {
+		lockFile = filepath.Join(cfg.DataDir, lockUnspentFilename)
+	}
+	s.utxoLocks = utxolock.New(lockFile)
+	if err := s.utxoLocks.Load(); err != nil {
+		return nil, err
+	}
+	s.chain.Subscribe(s.supervised("utxolocks", s.handleUtxoLockNotification))
+
+	s.feeEstimator = feeestimator.New(filepath.Join(cfg.DataDir, feeEstimatesFilename))
+	if err := s.feeEstimator.Load(); err != nil {
+		srvrLog.Warnf("Unable to load fee estimates, starting afresh: %v", err)
+	}
+	s.chain.Subscribe(s.supervised("feeestimator", s.handleFeeEstimatorNotification))
+
+	s.wsNotifications = newWsNotificationManager()
+	s.chain.Subscribe(s.supervised("wsnotifications", s.handleWsNotification))
+
+	s.gbtLongPoll = newGbtLongPoll()
+	s.chain.Subscribe(s.supervised("gbtlongpoll", s.handleGbtLongPollNotification))
+
+	if cfg.Consolidate {
+		if acc == nil {
+			return nil, errors.New("consolidation requires a valid --privatekey")
+		}
+		s.consolidateAccount = acc
+	}
+
+	s.tracer = newTracer(cfg)
+	if s.tracer != nil {
+		tracing.SetTracer(s.tracer)
+	}
+
+	s.alerts = newAlertManager(cfg)
+	if s.alerts != nil {
+		if acc != nil {
+			s.alertValidator = acc.Address
+		}
+		s.alertSlots = make(chan alertSlot, chaincfg.Cfg.MaxPeers)
+		s.chain.Subscribe(s.supervised("alerts", s.handleAlertNotification))
+	}
+
 	txC := mempool.Config{
 		Policy: mempool.Policy{
 			MaxOrphanTxs:      chaincfg.Cfg.MaxOrphanTxs,
 			MaxOrphanTxSize:   chaincfg.Cfg.MaxOrphanTxSize,
+			MaxOrphanPoolSize: chaincfg.Cfg.MaxOrphanPoolSize * 1024 * 1024,
 			MinRelayTxPrice:   chaincfg.Cfg.MinTxPrice,
 			MaxTxVersion:      2,
 			RejectReplacement: cfg.RejectReplacement,
+			ReplacementBump:   cfg.ReplacementBump,
 		},
 		FetchUtxoView:  s.chain.FetchUtxoView,
 		Chain:          s.chain,
@@ -2562,12 +3165,51 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 			return s.chain.CalcSequenceLock(tx, view, true)
 		},
 		AddrIndex:              s.addrIndex,
+		SigCache:               sigCache,
 		FeesChan:               feesChan,
 		CheckTransactionInputs: blockchain.CheckTransactionInputs,
 	}
 	s.txMemPool = mempool.New(&txC)
+	if !cfg.NoPersistMempool {
+		err := loadMempool(s.txMemPool, filepath.Join(cfg.DataDir, mempoolFilename))
+		if err != nil {
+			srvrLog.Errorf("Unable to load the mempool: %v", err)
+		}
+	}
 	s.sigMemPool = mempool.NewSigPool()
 
+	if cfg.ASMap != "" {
+		s.asMap, err = addrmgr.LoadASMap(cfg.ASMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.peerStats = peerstats.New(filepath.Join(cfg.DataDir, peerStatsFilename))
+	if err := s.peerStats.Load(); err != nil {
+		srvrLog.Errorf("Unable to load peer statistics: %v", err)
+	}
+
+	if cfg.AuditLog != "" {
+		s.auditLog, err = audit.Open(cfg.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Schedule the switch to the rotated validator key.
+	var signingAccount func(height int32) *crypto.Account
+	if cfg.RotateKey != "" {
+		next, err := crypto.NewAccount(cfg.RotateKey)
+		if err != nil {
+			return nil, err
+		}
+		s.keyRotation = newKeyRotation(acc, next, cfg.RotateHeight, s.auditLog)
+		signingAccount = s.keyRotation.accountAt
+		srvrLog.Infof("Validator key rotates to %v at height %d",
+			next.Address.String(), cfg.RotateHeight)
+	}
+
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
 		Chain:              s.chain,
@@ -2577,9 +3219,12 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 		DisableCheckpoints: chaincfg.Cfg.DisableCheckpoints,
 		MaxPeers:           chaincfg.Cfg.MaxPeers,
 		Account:            acc,
+		SigningAccount:     signingAccount,
 		BroadcastMessage: func(msg protos.Message, exclPeers ...interface{}) {
 			s.BroadcastMessage(msg)
 		},
+		AuditLog:  s.auditLog,
+		BlockPush: chaincfg.Cfg.BlockPush,
 	})
 	if err != nil {
 		return nil, err
@@ -2587,15 +3232,25 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 
 	// Create the mining policy and block template generator based on the
 	// configuration options.
+	txSelector, err := mining.NewTxSelector(cfg.TxSelector)
+	if err != nil {
+		return nil, err
+	}
 	policy := mining.Policy{
 		TxMinPrice: chaincfg.Cfg.MinTxPrice,
 		BlockProductedTimeOut: cfg.BlkProductedTimeOut,
 		TxConnectTimeOut: cfg.TxConnectTimeOut,
 		UtxoValidateTimeOut: cfg.UtxoValidateTimeOut,
+		CanonicalTxOrder: cfg.CanonicalTxOrder,
+		TxSelector: txSelector,
 	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
-		s.txMemPool, s.sigMemPool, s.chain)
+		s.txMemPool, s.sigMemPool, s.chain, sigCache)
 
+	if cfg.DevMode {
+		s.devAccount = acc
+		s.devTxs = make(chan struct{}, 1)
+	}
 	consensusConfig := params.Config{
 		BlockTemplateGenerator: blockTemplateGenerator,
 		ProcessBlock:           s.syncManager.ProcessBlock,
@@ -2606,6 +3261,9 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 		GasCeil:      common.GasCeil,
 		RoundManager: roundManger,
 		Account:      acc,
+		SigningAccount: signingAccount,
+		NewTxs:         s.devTxs,
+		PendingTxs:     s.txMemPool.Count,
 	}
 
 	s.consensus, err = consensus.NewConsensusService(chaincfg.Cfg.Consensustype, &consensusConfig)
@@ -2633,10 +3291,16 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 				// because addrmanager rejects those on addition.
 				// Just check that we don't already have an address
 				// in the same group so that we are not connecting
-				// to the same network segment at the expense of
-				// others.
+				// to the same network segment, or the same AS when
+				// an AS map is loaded, at the expense of others.
+				if s.OutboundGroupCount(s.netGroup(addr.NetAddress())) != 0 {
+					continue
+				}
+
+				// Prefer the network segments which behaved well
+				// in the past.
 				key := addrmgr.GroupKey(addr.NetAddress())
-				if s.OutboundGroupCount(key) != 0 {
+				if !s.acceptsOutboundGroup(key, tries) {
 					continue
 				}
 
@@ -2652,11 +3316,27 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 					continue
 				}
 
+				// The I2P addresses are relayed but there is no I2P
+				// transport to connect to them.
+				if addrmgr.IsI2P(addr.NetAddress()) {
+					continue
+				}
+
 				// Mark an attempt for the valid address.
 				s.addrManager.Attempt(addr.NetAddress())
 
 				addrString := addrmgr.NetAddressKey(addr.NetAddress())
-				return amgr.AddrStringToNetAddr(addrString)
+				netAddr, err := amgr.AddrStringToNetAddr(addrString)
+				if err != nil {
+					return nil, err
+				}
+
+				// Connect over QUIC to the peers advertising it.
+				if chaincfg.Cfg.QUIC && !addrmgr.IsOnionCatTor(addr.NetAddress()) &&
+					addr.NetAddress().HasService(common.SFNodeQUIC) {
+					return &fnet.QUICAddr{Addr: netAddr}, nil
+				}
+				return netAddr, nil
 			}
 
 			return nil, errors.New("no valid connect address")
@@ -2701,6 +3381,13 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 	}
 
 	if !chaincfg.Cfg.DisableRPC {
+		quotas, err := newRPCQuotas(cfg.RPCAPIKeys, cfg.RPCAdminKeys)
+		if err != nil {
+			return nil, err
+		}
+		callStats := rpc.NewCallStats(cfg.RPCSlowCall, cfg.RPCSlowLogSize,
+			rpcRedactedMethods)
+
 		// Setup listeners for the configured RPC listen addresses and
 		// TLS settings.
 		serverConfig := &rpcserverConfig{
@@ -2716,10 +3403,29 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 			TxMemPool:       s.txMemPool,
 			TxIndex:         s.txIndex,
 			AddrIndex:       s.addrIndex,
+			LogIndex:        s.logIndex,
 			CfIndex:         s.cfIndex,
 			Nap:             nap,
 			ConsensusServer: s.consensus,
 			ContractMgr:     contractManager,
+			Compactor:       s.compactor,
+			AuditLog:        s.auditLog,
+			Account:         acc,
+			KeyRotation:     s.keyRotation,
+			Quotas:          quotas,
+			CallStats:       callStats,
+			RPCCache:        s.rpcCache,
+			TemplateCache:   s.templateCache,
+			ReplicaPrimary:   s.replPrimary,
+			ReplicaSecondary: s.replSecondary,
+			Supervisor:       s.supervisor,
+			PeerStats:        s.peerStats,
+			Deposits:         s.deposits,
+			UtxoLocks:        s.utxoLocks,
+			FeeEstimator:     s.feeEstimator,
+			WsNotifications:  s.wsNotifications,
+			GbtLongPoll:      s.gbtLongPoll,
+			ReadReplica:     cfg.ReadReplica,
 
 			BlockTemplateGenerator: blockTemplateGenerator,
 		}
@@ -2734,11 +3440,19 @@ func NewServer(db database.Transactor, stateDB database.Database, agentBlacklist
 			WSModules:    append(cfg.WSModules, "eth", "shh", "asimov"),
 		}
 		nodeCfg.IPCPath = "asimov.ipc"
-		nodeCfg.HTTPCors = []string{"*"}
-		nodeCfg.HTTPVirtualHosts = []string{"*"}
+		nodeCfg.HTTPCors = cfg.HTTPCors
+		nodeCfg.HTTPVirtualHosts = cfg.HTTPVirtualHosts
 		// cfg.WSOrigins = []string{"*"}
 		nodeCfg.Logger = logger.GetLogger("RPCS")
 		nodeCfg.NoUSB = true
+		nodeCfg.RPCQuotas = quotas
+		nodeCfg.RPCPanicHandler = s.rpcPanicHandler
+		nodeCfg.RPCCallStats = callStats
+		nodeCfg.RPCLimits = rpc.HTTPLimits{
+			MaxRequestSize: cfg.RPCMaxRequestSize,
+			MaxConnsPerIP:  cfg.RPCMaxConnsPerIP,
+			TrustedProxies: cfg.RPCTrustedProxies,
+		}
 
 		s.stack, err = node.New(&nodeCfg)
 		if err != nil {
@@ -2779,7 +3493,24 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services com
 			srvrLog.Warnf("Can't listen on %s: %v", addr, err)
 			continue
 		}
-		listeners = append(listeners, listener)
+		listeners = append(listeners, newPolicyListener(listener, addr.String()))
+	}
+
+	// Listen for QUIC connections on the UDP ports of the listeners.  They
+	// are not advertised as addresses, but with the QUIC service flag of
+	// the TCP addresses.
+	var quicListeners []net.Listener
+	if chaincfg.Cfg.QUIC {
+		for _, addr := range netAddrs {
+			network := strings.Replace(addr.Network(), "tcp", "udp", 1)
+			listener, err := fnet.ListenQUIC(network, addr.String())
+			if err != nil {
+				srvrLog.Warnf("Can't listen for QUIC on %s: %v", addr, err)
+				continue
+			}
+			quicListeners = append(quicListeners,
+				newPolicyListener(listener, addr.String()))
+		}
 	}
 
 	var nat fnet.NAT
@@ -2829,6 +3560,9 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services com
 
 		// Add bound addresses to address manager to be advertised to peers.
 		for _, listener := range listeners {
+			if !listener.(*policyListener).policy.Advertised() {
+				continue
+			}
 			addr := listener.Addr().String()
 			err := addLocalAddress(amgr, addr, services)
 			if err != nil {
@@ -2837,7 +3571,7 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services com
 		}
 	}
 
-	return listeners, nat, nil
+	return append(listeners, quicListeners...), nat, nil
 }
 
 // addLocalAddress adds an address that this node is listening on to the
@@ -0,0 +1,289 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/rpcs/rpc"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+const (
+	// compareStateAttempts is the number of times a state comparison is
+	// started over because the best block of one of the nodes changed.
+	compareStateAttempts = 5
+
+	// compareStateRetryDelay is the time to wait before starting a state
+	// comparison over, giving both nodes time to connect the same block.
+	compareStateRetryDelay = time.Second * 2
+
+	// compareStateMaxDiffs is the maximum number of diverging entries
+	// reported by a state comparison.
+	compareStateMaxDiffs = 100
+)
+
+// stateFetcher returns the state commitment of a node for the given key
+// prefix at the given block, or at the best block when blockHash is empty.
+type stateFetcher func(prefix []byte, blockHash string) (*rpcjson.GetStateCommitmentResult, error)
+
+// stateCommitmentResult converts a state commitment into its RPC form.
+func stateCommitmentResult(c *blockchain.StateCommitment) *rpcjson.GetStateCommitmentResult {
+	result := &rpcjson.GetStateCommitmentResult{
+		Kind:      string(c.Kind),
+		BlockHash: c.BlockHash.UnprefixString(),
+		Height:    c.Height,
+		Prefix:    hex.EncodeToString(c.Prefix),
+		Hash:      c.Hash.UnprefixString(),
+		Count:     c.Count,
+	}
+	for _, child := range c.Children {
+		result.Children = append(result.Children, rpcjson.StateChildResult{
+			Byte:  child.Byte,
+			Hash:  child.Hash.UnprefixString(),
+			Count: child.Count,
+		})
+	}
+	for _, entry := range c.Entries {
+		result.Entries = append(result.Entries, rpcjson.StateEntryResult{
+			Key:       hex.EncodeToString(entry.Key),
+			Name:      entry.Name,
+			ValueHash: entry.ValueHash.UnprefixString(),
+		})
+	}
+	return result
+}
+
+// diffStateEntries adds the entries which differ between the passed lists to
+// the comparison result.  When keyLen is not negative, only the entries whose
+// hex encoded key has exactly keyLen characters are considered.
+func diffStateEntries(local, remote []rpcjson.StateEntryResult, keyLen int,
+	result *rpcjson.CompareStateResult) {
+
+	type pair struct {
+		name          string
+		local, remote string
+	}
+	entries := make(map[string]*pair)
+	for _, e := range local {
+		if keyLen < 0 || len(e.Key) == keyLen {
+			entries[e.Key] = &pair{name: e.Name, local: e.ValueHash}
+		}
+	}
+	for _, e := range remote {
+		if keyLen >= 0 && len(e.Key) != keyLen {
+			continue
+		}
+		if p, ok := entries[e.Key]; ok {
+			p.remote = e.ValueHash
+			continue
+		}
+		entries[e.Key] = &pair{name: e.Name, remote: e.ValueHash}
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key, p := range entries {
+		if p.local != p.remote {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(result.Diffs) >= compareStateMaxDiffs {
+			result.Truncated = true
+			return
+		}
+		p := entries[key]
+		result.Diffs = append(result.Diffs, rpcjson.StateDiffResult{
+			Key:    key,
+			Name:   p.name,
+			Local:  p.local,
+			Remote: p.remote,
+		})
+	}
+}
+
+// diffState descends the state hash trees of both nodes below the passed
+// commitments and adds the diverging entries to the comparison result.
+func diffState(l, r *rpcjson.GetStateCommitmentResult, local, remote stateFetcher,
+	result *rpcjson.CompareStateResult) error {
+
+	if l.Hash == r.Hash {
+		return nil
+	}
+	if len(result.Diffs) >= compareStateMaxDiffs {
+		result.Truncated = true
+		return nil
+	}
+
+	// Both commitments list all their entries, so compare them directly.
+	if l.Count <= blockchain.StateLeafSize && r.Count <= blockchain.StateLeafSize {
+		diffStateEntries(l.Entries, r.Entries, -1, result)
+		return nil
+	}
+
+	// Compare the entries matching the prefix exactly since they are not
+	// covered by any child, then descend into the differing children.
+	diffStateEntries(l.Entries, r.Entries, len(l.Prefix), result)
+
+	children := make(map[byte][2]string)
+	for _, child := range l.Children {
+		children[child.Byte] = [2]string{child.Hash, ""}
+	}
+	for _, child := range r.Children {
+		hashes := children[child.Byte]
+		hashes[1] = child.Hash
+		children[child.Byte] = hashes
+	}
+	diffBytes := make([]int, 0, len(children))
+	for b, hashes := range children {
+		if hashes[0] != hashes[1] {
+			diffBytes = append(diffBytes, int(b))
+		}
+	}
+	sort.Ints(diffBytes)
+
+	prefix, err := hex.DecodeString(l.Prefix)
+	if err != nil {
+		return err
+	}
+	for _, b := range diffBytes {
+		childPrefix := append(common.CopyBytes(prefix), byte(b))
+		lc, err := local(childPrefix, l.BlockHash)
+		if err != nil {
+			return err
+		}
+		rc, err := remote(childPrefix, l.BlockHash)
+		if err != nil {
+			return err
+		}
+		if err := diffState(lc, rc, local, remote, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareState compares the state of two nodes and locates the diverging
+// entries.  The comparison is started over when the best block of one of the
+// nodes changes in the meantime, until the passed context is done.
+func compareState(ctx context.Context, local, remote stateFetcher) (*rpcjson.CompareStateResult, error) {
+	var lastErr error
+	for attempt := 0; attempt < compareStateAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(compareStateRetryDelay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		l, err := local(nil, "")
+		if err != nil {
+			return nil, err
+		}
+		r, err := remote(nil, l.BlockHash)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		result := &rpcjson.CompareStateResult{
+			Kind:        l.Kind,
+			BlockHash:   l.BlockHash,
+			Height:      l.Height,
+			Match:       l.Hash == r.Hash,
+			LocalCount:  l.Count,
+			RemoteCount: r.Count,
+		}
+		if err = diffState(l, r, local, remote, result); err != nil {
+			lastErr = err
+			continue
+		}
+		return result, nil
+	}
+	return nil, lastErr
+}
+
+// GetStateCommitment returns the commitment to the entries of the given kind
+// of chain state {utxo, account} whose keys start with the hex encoded prefix.
+// When a block hash is passed, it fails unless the block is the best block.
+func (s *PublicRpcAPI) GetStateCommitment(ctx context.Context, kind string, prefix string, blockHash *string) (interface{}, error) {
+	prefixBytes, err := hex.DecodeString(prefix)
+	if err != nil {
+		return nil, rpcDecodeHexError(prefix)
+	}
+	var hash *common.Hash
+	if blockHash != nil && *blockHash != "" {
+		hash, err = decodeHashStr(*blockHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := s.cfg.Chain.StateCommitment(blockchain.StateKind(kind), prefixBytes,
+		hash, ctx.Done())
+	if err == blockchain.ErrInterruptRequested {
+		return nil, rpcCancelledError(ctx)
+	}
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return stateCommitmentResult(c), nil
+}
+
+// CompareState compares the given kind of chain state {utxo, account} with the
+// trusted node serving RPC at the passed URL and reports the entries which
+// diverge.  Only the parts of the state hash tree which differ are exchanged.
+// The comparison stops when the client goes away.
+func (s *PublicRpcAPI) CompareState(ctx context.Context, url string, kind string) (interface{}, error) {
+	client, err := rpc.DialHTTP(url)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to connect to "+url)
+	}
+	defer client.Close()
+
+	local := func(prefix []byte, blockHash string) (*rpcjson.GetStateCommitmentResult, error) {
+		var hash *common.Hash
+		if blockHash != "" {
+			var err error
+			hash, err = common.ParseHash(blockHash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		c, err := s.cfg.Chain.StateCommitment(blockchain.StateKind(kind), prefix,
+			hash, ctx.Done())
+		if err != nil {
+			return nil, err
+		}
+		return stateCommitmentResult(c), nil
+	}
+	remote := func(prefix []byte, blockHash string) (*rpcjson.GetStateCommitmentResult, error) {
+		var result rpcjson.GetStateCommitmentResult
+		err := client.CallContext(ctx, &result, "asimov_getStateCommitment", kind,
+			hex.EncodeToString(prefix), blockHash)
+		return &result, err
+	}
+
+	result, err := compareState(ctx, local, remote)
+	if ctx.Err() != nil {
+		return nil, rpcCancelledError(ctx)
+	}
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "Failed to compare state: " + err.Error(),
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// writeStateExport writes the state dump at the passed height and its manifest
+// to the state export directory.  The files are written under temporary names
+// and renamed once complete, so a file with the final name is never partial.
+// The export is abandoned when the passed interrupt channel is closed.
+func (s *PublicRpcAPI) writeStateExport(height int32, interrupt <-chan struct{}) (*rpcjson.ExportStateResult, error) {
+	dir := filepath.Join(chaincfg.Cfg.DataDir, stateExportDirname)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(dir, "state-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	export, err := s.cfg.Chain.ExportState(height, tmp, interrupt)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := rpcjson.StateExportManifest{
+		Version:      blockchain.StateExportVersion,
+		Height:       export.Height,
+		BlockHash:    export.Hash.String(),
+		StateRoot:    export.StateRoot.String(),
+		Holdings:     export.Holdings,
+		Accounts:     export.Accounts,
+		StorageSlots: export.StorageSlots,
+		Size:         export.Size,
+		DumpHash:     hex.EncodeToString(export.DumpHash[:]),
+	}
+	manifestData, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	manifestData = append(manifestData, '\n')
+	manifestHash := sha256.Sum256(manifestData)
+
+	name := fmt.Sprintf("state-%d-%s", export.Height, export.Hash.UnprefixString())
+	dumpFile := filepath.Join(dir, name+".txt")
+	manifestFile := filepath.Join(dir, name+".manifest.json")
+	if err := os.Rename(tmp.Name(), dumpFile); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(manifestFile+".tmp", manifestData, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(manifestFile+".tmp", manifestFile); err != nil {
+		return nil, err
+	}
+
+	return &rpcjson.ExportStateResult{
+		StateExportManifest: manifest,
+		DumpFile:            dumpFile,
+		ManifestFile:        manifestFile,
+		ManifestHash:        hex.EncodeToString(manifestHash[:]),
+	}, nil
+}
+
+// ExportState writes a canonical dump of the unspent asset holdings, accounts
+// and contract storage after the main chain block at the passed height, along
+// with a manifest holding the SHA-256 hash of the dump, to the stateexports
+// directory of the data directory.  It returns the manifest and its hash.
+func (s *PublicRpcAPI) ExportState(ctx context.Context, height int32) (interface{}, error) {
+	result, err := s.writeStateExport(height, ctx.Done())
+	if err == blockchain.ErrInterruptRequested {
+		return nil, rpcCancelledError(ctx)
+	}
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to export state")
+	}
+	rpcsLog.Infof("Exported state at height %d to %s, hash %s", height,
+		result.DumpFile, result.DumpHash)
+	return result, nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// decodeStorageWitnesses decodes the storage witnesses of a transaction given
+// to an RPC.
+func decodeStorageWitnesses(witnesses []rpcjson.StorageWitness) ([]protos.StorageWitness, error) {
+	decoded := make([]protos.StorageWitness, len(witnesses))
+	for i, witness := range witnesses {
+		addr, err := hexutil.Decode(witness.Address)
+		if err != nil || len(addr) != common.AddressLength {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid storage witness address: " + witness.Address,
+			}
+		}
+		decoded[i].Address = common.BytesToAddress(addr)
+		decoded[i].Entries = make([]protos.StorageEntry, len(witness.Entries))
+		for j, entry := range witness.Entries {
+			key, err := hexutil.Decode(entry.Key)
+			if err != nil || len(key) != common.HashLength {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCInvalidParameter,
+					Message: "Invalid storage witness key: " + entry.Key,
+				}
+			}
+			value, err := hexutil.Decode(entry.Value)
+			if err != nil || len(value) > common.HashLength {
+				return nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCInvalidParameter,
+					Message: "Invalid storage witness value: " + entry.Value,
+				}
+			}
+			decoded[i].Entries[j] = protos.StorageEntry{
+				Key:   common.BytesToHash(key),
+				Value: common.BytesToHash(value),
+			}
+		}
+	}
+	return decoded, nil
+}
+
+// encodeStorageEntries encodes the entries of a storage witness for an RPC
+// reply.
+func encodeStorageEntries(entries []protos.StorageEntry) []rpcjson.StorageEntry {
+	encoded := make([]rpcjson.StorageEntry, len(entries))
+	for i, entry := range entries {
+		encoded[i].Key = hexutil.Encode(entry.Key[:])
+		encoded[i].Value = hexutil.Encode(entry.Value[:])
+	}
+	return encoded
+}
+
+// encodeStorageWitnesses encodes the storage witnesses of a transaction for an
+// RPC reply.
+func encodeStorageWitnesses(witnesses []protos.StorageWitness) []rpcjson.StorageWitness {
+	encoded := make([]rpcjson.StorageWitness, len(witnesses))
+	for i, witness := range witnesses {
+		encoded[i].Address = hexutil.Encode(witness.Address[:])
+		encoded[i].Entries = encodeStorageEntries(witness.Entries)
+	}
+	return encoded
+}
+
+// GetStorageWitness returns the state rent record of a contract.  When the
+// storage of the contract is archived, the witness reviving the storage is
+// returned along, to be passed to createRawTransaction.
+func (s *PublicRpcAPI) GetStorageWitness(address string) (interface{}, error) {
+	addr, err := hexutil.Decode(address)
+	if err != nil || len(addr) != common.AddressLength {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address: " + address,
+		}
+	}
+	contract := common.BytesToAddress(addr)
+
+	_, stateDB := createTempBlockState(s.cfg)
+	if stateDB == nil {
+		return nil, internalRPCError("failed to load the state", "")
+	}
+	record, ok := stateDB.GetStorageRent(contract)
+	if !ok {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+			Message: "No such account: " + address,
+		}
+	}
+
+	result := &rpcjson.StorageRentResult{
+		Address: address,
+		Touched: record.Touched,
+	}
+	if record.Archived == (common.Hash{}) {
+		return result, nil
+	}
+	entries, err := stateDB.ArchivedStorage(contract)
+	if err != nil {
+		return nil, internalRPCError("failed to load the archived storage: "+
+			err.Error(), "")
+	}
+	result.Archived = true
+	result.Root = hexutil.Encode(record.Archived[:])
+	result.Witness = &rpcjson.StorageWitness{
+		Address: address,
+		Entries: encodeStorageEntries(entries),
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"github.com/AsimovNetwork/asimov/alert"
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/supervisor"
+)
+
+// newSupervisor returns the supervisor of the subsystems of the server, which
+// raises an alert on every panic.
+func (s *NodeServer) newSupervisor() *supervisor.Supervisor {
+	return supervisor.New(&supervisor.Config{
+		OnPanic: func(err *supervisor.PanicError) {
+			if s.alerts != nil {
+				s.alerts.Raise(alert.CondPanic, alert.SevCritical, "%v",
+					err.Error())
+			}
+		},
+	})
+}
+
+// goSupervised runs a handler of the server, restarting it when it panics
+// until the server quits.  The handler must return once the server quits
+// and must not call s.wg.Done.
+func (s *NodeServer) goSupervised(name string, handler func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervisor.Run(name, handler, s.quit)
+	}()
+}
+
+// supervised returns a notification callback which recovers the panics of the
+// passed callback.  The notifications are sent while the chain processes the
+// blocks, so a panicking sink must not bring the validation down.
+func (s *NodeServer) supervised(name string, callback blockchain.NotificationCallback) blockchain.NotificationCallback {
+	return func(notification *blockchain.Notification) {
+		s.supervisor.Protect(name, func() {
+			callback(notification)
+		})
+	}
+}
+
+// rpcPanicHandler reports the panics of the RPC callbacks to the supervisor.
+func (s *NodeServer) rpcPanicHandler(method string, value interface{}, stack []byte) {
+	s.supervisor.Report("rpc "+method, value, stack)
+}
+
+// supervisedIndexManager recovers the panics of the indexers.  The indexers
+// update their indexes in the same database transaction as the connected
+// block, so a panic can not be skipped: it is returned as an error which
+// aborts the connection of the block until the indexer is fixed, instead of
+// crashing the node.
+type supervisedIndexManager struct {
+	blockchain.IndexManager
+	supervisor *supervisor.Supervisor
+}
+
+// ConnectBlock calls ConnectBlock of the index manager.
+func (m *supervisedIndexManager) ConnectBlock(dbTx database.Tx, block *asiutil.Block,
+	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
+
+	var err error
+	if perr := m.supervisor.Protect("indexers", func() {
+		err = m.IndexManager.ConnectBlock(dbTx, block, stxos, vblock)
+	}); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// DisconnectBlock calls DisconnectBlock of the index manager.
+func (m *supervisedIndexManager) DisconnectBlock(dbTx database.Tx, block *asiutil.Block,
+	stxos []txo.SpentTxOut, vblock *asiutil.VBlock) error {
+
+	var err error
+	if perr := m.supervisor.Protect("indexers", func() {
+		err = m.IndexManager.DisconnectBlock(dbTx, block, stxos, vblock)
+	}); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// GetSupervisorInfo returns the number of panics and restarts of the
+// subsystems which panicked since the node started.
+func (s *PublicRpcAPI) GetSupervisorInfo() (interface{}, error) {
+	stats := s.cfg.Supervisor.Stats()
+	result := make([]rpcjson.SubsystemPanicsResult, 0, len(stats))
+	for _, st := range stats {
+		result = append(result, rpcjson.SubsystemPanicsResult{
+			Subsystem: st.Subsystem,
+			Panics:    st.Panics,
+			Restarts:  st.Restarts,
+			LastPanic: st.LastPanic.Unix(),
+			LastError: st.LastError,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,434 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/txo"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/mempool"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/utxolock"
+)
+
+const (
+	// maxSweepAddresses is the maximum number of addresses of a
+	// sweepaddresses request.
+	maxSweepAddresses = 100
+
+	// maxSweepTxSize is the default maximum size of a sweep transaction,
+	// the maximum size of a standard transaction.
+	maxSweepTxSize = 100000
+
+	// minSweepTxSize is the minimum maximum size of a sweep transaction,
+	// which leaves room for a few inputs.
+	minSweepTxSize = 1000
+
+	// sweepSigScriptSize is the size of the signature script of a
+	// pay-to-pubkey-hash input: a push of a DER signature along with its
+	// hash type and a push of an uncompressed public key.
+	sweepSigScriptSize = 1 + 73 + 1 + 65
+)
+
+// sweepInput is an output of the swept addresses.
+type sweepInput struct {
+	outPoint protos.OutPoint
+	pkScript []byte
+	asset    protos.Asset
+	amount   int64
+}
+
+// sweepTx is a sweep transaction being built.  outs maps the assets to the
+// index of their output, the last one for the indivisible assets.
+type sweepTx struct {
+	mtx    *protos.MsgTx
+	inputs []*sweepInput
+	outs   map[protos.Asset]int
+	fee    int64
+}
+
+// signedSize returns the estimated size of the transaction once signed.
+func (tx *sweepTx) signedSize() int {
+	return tx.mtx.SerializeSize() + len(tx.mtx.TxIn)*sweepSigScriptSize
+}
+
+// sweepBuilder splits the outputs of the swept addresses into transactions
+// paying them to their destinations.
+type sweepBuilder struct {
+	destinations map[protos.Asset][]byte
+	destination  []byte
+	gasPrice     float64
+	maxTxSize    int
+}
+
+// add adds an input to the transaction, and its amount to the output of its
+// asset.  The output of an indivisible asset can only carry a single unit, so
+// every input of an indivisible asset gets its own output.  It returns a
+// function undoing the addition.
+func (b *sweepBuilder) add(tx *sweepTx, in *sweepInput) func() {
+	nIn, nOut := len(tx.mtx.TxIn), len(tx.mtx.TxOut)
+	tx.mtx.AddTxIn(protos.NewTxIn(&in.outPoint, nil))
+	tx.inputs = append(tx.inputs, in)
+
+	idx, ok := tx.outs[in.asset]
+	if ok && !in.asset.IsIndivisible() {
+		tx.mtx.TxOut[idx].Value += in.amount
+		return func() {
+			tx.mtx.TxIn, tx.inputs = tx.mtx.TxIn[:nIn], tx.inputs[:nIn]
+			tx.mtx.TxOut[idx].Value -= in.amount
+		}
+	}
+
+	pkScript, custom := b.destinations[in.asset]
+	if !custom {
+		pkScript = b.destination
+	}
+	tx.mtx.AddTxOut(protos.NewTxOut(in.amount, pkScript, in.asset))
+	tx.outs[in.asset] = nOut
+	return func() {
+		tx.mtx.TxIn, tx.inputs = tx.mtx.TxIn[:nIn], tx.inputs[:nIn]
+		tx.mtx.TxOut = tx.mtx.TxOut[:nOut]
+		if ok {
+			tx.outs[in.asset] = idx
+		} else {
+			delete(tx.outs, in.asset)
+		}
+	}
+}
+
+// fill adds the inputs to the transaction until it is full, and returns the
+// inputs left.
+func (b *sweepBuilder) fill(tx *sweepTx, inputs []*sweepInput) []*sweepInput {
+	for len(inputs) > 0 {
+		undo := b.add(tx, inputs[0])
+		if tx.signedSize() > b.maxTxSize {
+			undo()
+			break
+		}
+		inputs = inputs[1:]
+	}
+	return inputs
+}
+
+// build splits the inputs into sweep transactions.  The fee of a transaction
+// is paid by its asim output, so every transaction spends the largest asim
+// output left first, then the outputs of the other assets, and the other asim
+// outputs once the other assets are all swept.  The gas limit of a transaction
+// covers its estimated signed size, and its fee is the gas limit at the gas
+// price of the builder.
+func (b *sweepBuilder) build(asims, others []*sweepInput) ([]*sweepTx, error) {
+	sort.SliceStable(asims, func(i, j int) bool {
+		return asims[i].amount > asims[j].amount
+	})
+
+	var txs []*sweepTx
+	for len(asims) > 0 || len(others) > 0 {
+		if len(asims) == 0 {
+			return nil, fmt.Errorf("no asim output left to pay the fee of "+
+				"the transaction sweeping the %d outputs left", len(others))
+		}
+		tx := newSweepTx()
+		b.add(tx, asims[0])
+		asims = asims[1:]
+		others = b.fill(tx, others)
+		if len(others) == 0 {
+			asims = b.fill(tx, asims)
+		}
+
+		if err := b.pay(tx); err != nil {
+			return nil, fmt.Errorf("transaction %d %v", len(txs), err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// newSweepTx returns an empty sweep transaction.
+func newSweepTx() *sweepTx {
+	return &sweepTx{
+		mtx:  protos.NewMsgTx(protos.TxVersion),
+		outs: make(map[protos.Asset]int),
+	}
+}
+
+// pay sets the gas limit of the transaction to cover its estimated signed
+// size, and deducts its fee at the gas price of the builder from its asim
+// output.
+func (b *sweepBuilder) pay(tx *sweepTx) error {
+	gasLimit := tx.signedSize() * common.GasPerByte
+	fee := int64(math.Ceil(float64(gasLimit) * b.gasPrice))
+	out := tx.mtx.TxOut[tx.outs[asiutil.AsimovAsset]]
+	if out.Value <= fee {
+		return fmt.Errorf("sweeps %d asim, which does not pay its fee "+
+			"of %d", out.Value, fee)
+	}
+	out.Value -= fee
+	tx.fee = fee
+	tx.mtx.TxContract = protos.TxContract{GasLimit: uint32(gasLimit)}
+	return nil
+}
+
+// sweepOutputs returns the outputs of the addresses which may be swept,
+// sorted so the outputs of an asset are swept together, along with the number
+// of outputs which may not.  An output may not be swept when it is an
+// immature coinbase output, is already spent by the mempool, is locked with
+// lockunspent, or is not a pay-to-pubkey-hash output whose signature size can
+// be estimated.
+func sweepOutputs(ctx context.Context, chain *blockchain.BlockChain, txPool *mempool.TxPool,
+	locks *utxolock.Set, keys [][]byte) ([]*sweepInput, int, error) {
+
+	nextHeight := chain.BestSnapshot().Height + 1
+	maturity := int32(chaincfg.ActiveNetParams.CoinbaseMaturity)
+
+	var inputs []*sweepInput
+	skipped := 0
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[string(key)]; ok {
+			continue
+		}
+		seen[string(key)] = struct{}{}
+		if ctx.Err() != nil {
+			return nil, 0, rpcCancelledError(ctx)
+		}
+		view := txo.NewUtxoViewpoint()
+		if _, err := chain.FetchUtxoViewByAddress(view, key); err != nil {
+			return nil, 0, internalRPCError(err.Error(), "Failed to fetch outputs")
+		}
+		for out, entry := range view.Entries() {
+			if entry == nil || entry.IsSpent() {
+				continue
+			}
+			if (entry.IsCoinBase() && nextHeight-entry.BlockHeight() < maturity) ||
+				txscript.GetScriptClass(entry.PkScript()) != txscript.PubKeyHashTy ||
+				locks.IsLocked(out) {
+				skipped++
+				continue
+			}
+			inputs = append(inputs, &sweepInput{
+				outPoint: out,
+				pkScript: entry.PkScript(),
+				asset:    *entry.Asset(),
+				amount:   entry.Amount(),
+			})
+		}
+	}
+
+	outPoints := make([]protos.OutPoint, len(inputs))
+	for i, in := range inputs {
+		outPoints[i] = in.outPoint
+	}
+	spent := make(map[protos.OutPoint]struct{})
+	for _, out := range txPool.HasSpentInTxPool(&outPoints) {
+		spent[out] = struct{}{}
+	}
+	unspent := inputs[:0]
+	for _, in := range inputs {
+		if _, ok := spent[in.outPoint]; ok {
+			skipped++
+			continue
+		}
+		unspent = append(unspent, in)
+	}
+
+	sort.Slice(unspent, func(i, j int) bool {
+		a, b := unspent[i], unspent[j]
+		if c := bytes.Compare(a.asset.Bytes(), b.asset.Bytes()); c != 0 {
+			return c < 0
+		}
+		if c := bytes.Compare(a.outPoint.Hash[:], b.outPoint.Hash[:]); c != 0 {
+			return c < 0
+		}
+		return a.outPoint.Index < b.outPoint.Index
+	})
+	return unspent, skipped, nil
+}
+
+// sweepDestination returns the script paying to a destination address.
+func sweepDestination(address string) ([]byte, error) {
+	addr, err := asiutil.DecodeAddress(address)
+	if err == nil {
+		if _, ok := addr.(*common.Address); ok {
+			return txscript.PayToAddrScript(addr)
+		}
+	}
+	return nil, &rpcjson.RPCError{
+		Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+		Message: "Invalid destination address: " + address,
+	}
+}
+
+// SweepAddresses builds the unsigned transactions consolidating all the
+// outputs of the passed addresses, such as cold storage addresses, into one
+// output per asset paid to the destination address, or to the destination of
+// the asset given in the options.  The outputs are split across several
+// transactions when they do not fit the maximum transaction size.  The fee of
+// every transaction is estimated from its signed size and deducted from its
+// asim output.  The transactions only spend confirmed outputs, so they may be
+// signed and broadcast in any order.
+func (s *PublicRpcAPI) SweepAddresses(ctx context.Context, addresses []string, destination string,
+	options *rpcjson.SweepOptions) (interface{}, error) {
+
+	if len(addresses) == 0 || len(addresses) > maxSweepAddresses {
+		return nil, &rpcjson.RPCError{
+			Code: rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid number of addresses: %d, at "+
+				"least 1 and at most %d", len(addresses), maxSweepAddresses),
+		}
+	}
+	keys := make([][]byte, len(addresses))
+	for i, address := range addresses {
+		addr, err := asiutil.DecodeAddress(address)
+		if err != nil {
+			return nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address: " + address,
+			}
+		}
+		keys[i] = addr.ScriptAddress()
+	}
+
+	builder := &sweepBuilder{
+		destinations: make(map[protos.Asset][]byte),
+		gasPrice:     chaincfg.Cfg.MinTxPrice,
+		maxTxSize:    maxSweepTxSize,
+	}
+	var err error
+	if builder.destination, err = sweepDestination(destination); err != nil {
+		return nil, err
+	}
+	destAddrs := make(map[protos.Asset]string)
+	if options != nil {
+		for assetHex, address := range options.Destinations {
+			assetBytes, err := hex.DecodeString(assetHex)
+			if err != nil || len(assetBytes) != common.AssetLength {
+				return nil, rpcDecodeHexError(assetHex)
+			}
+			asset := *protos.AssetFromBytes(assetBytes)
+			if builder.destinations[asset], err = sweepDestination(address); err != nil {
+				return nil, err
+			}
+			destAddrs[asset] = address
+		}
+		if options.GasPrice != nil {
+			if *options.GasPrice < chaincfg.Cfg.MinTxPrice {
+				return nil, &rpcjson.RPCError{
+					Code: rpcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Gas price %f is below the "+
+						"minimum relay price %f", *options.GasPrice,
+						chaincfg.Cfg.MinTxPrice),
+				}
+			}
+			builder.gasPrice = *options.GasPrice
+		}
+		if options.MaxTxSize != nil {
+			if *options.MaxTxSize < minSweepTxSize || *options.MaxTxSize > maxSweepTxSize {
+				return nil, &rpcjson.RPCError{
+					Code: rpcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Max transaction size must be "+
+						"between %d and %d", minSweepTxSize, maxSweepTxSize),
+				}
+			}
+			builder.maxTxSize = *options.MaxTxSize
+		}
+	}
+
+	inputs, skipped, err := sweepOutputs(ctx, s.cfg.Chain, s.cfg.TxMemPool, s.cfg.UtxoLocks, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "No output to sweep",
+		}
+	}
+
+	type assetSum struct {
+		outputs int
+		amount  int64
+	}
+	sums := make(map[protos.Asset]*assetSum)
+	var asims, others []*sweepInput
+	for _, in := range inputs {
+		sum := sums[in.asset]
+		if sum == nil {
+			sum = new(assetSum)
+			sums[in.asset] = sum
+		}
+		sum.outputs++
+		sum.amount += balanceUnits(&in.asset, in.amount)
+		if in.asset == asiutil.AsimovAsset {
+			asims = append(asims, in)
+		} else {
+			others = append(others, in)
+		}
+	}
+
+	txs, err := builder.build(asims, others)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	result := &rpcjson.SweepAddressesResult{
+		Transactions: make([]rpcjson.SweepTransactionResult, 0, len(txs)),
+		Assets:       make([]rpcjson.SweepAssetResult, 0, len(sums)),
+		Skipped:      skipped,
+	}
+	for _, tx := range txs {
+		mtxHex, err := messageToHex(tx.mtx)
+		if err != nil {
+			return nil, err
+		}
+		txInputs := make([]rpcjson.TransactionInput, 0, len(tx.inputs))
+		for _, in := range tx.inputs {
+			txInputs = append(txInputs, rpcjson.TransactionInput{
+				Txid:         in.outPoint.Hash.String(),
+				Vout:         in.outPoint.Index,
+				Assets:       hex.EncodeToString(in.asset.Bytes()),
+				ScriptPubKey: hex.EncodeToString(in.pkScript),
+			})
+		}
+		result.Transactions = append(result.Transactions, rpcjson.SweepTransactionResult{
+			Hex:      mtxHex,
+			Inputs:   txInputs,
+			Size:     tx.signedSize(),
+			GasLimit: tx.mtx.TxContract.GasLimit,
+			Fee:      tx.fee,
+		})
+		result.Fee += tx.fee
+	}
+	for asset, sum := range sums {
+		dest, ok := destAddrs[asset]
+		if !ok {
+			dest = destination
+		}
+		result.Assets = append(result.Assets, rpcjson.SweepAssetResult{
+			Asset:       hex.EncodeToString(asset.Bytes()),
+			Destination: dest,
+			Outputs:     sum.outputs,
+			Amount:      strconv.FormatInt(sum.amount, 10),
+		})
+	}
+	sort.Slice(result.Assets, func(i, j int) bool {
+		return result.Assets[i].Asset < result.Assets[j].Asset
+	})
+	return result, nil
+}
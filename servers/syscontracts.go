@@ -0,0 +1,192 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/state"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/vm"
+)
+
+// systemContracts returns the system contracts sorted by name.
+func systemContracts() []common.ContractCode {
+	contracts := make([]common.ContractCode, 0, len(common.ContractCodeStrings))
+	for contract := range common.ContractCodeStrings {
+		contracts = append(contracts, contract)
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		return contracts[i].String() < contracts[j].String()
+	})
+	return contracts
+}
+
+// parseSystemContract returns the system contract with the passed name or
+// address.
+func parseSystemContract(name string) (common.ContractCode, error) {
+	for contract, contractName := range common.ContractCodeStrings {
+		if strings.EqualFold(name, contractName) ||
+			strings.EqualFold(name, string(contract)) {
+			return contract, nil
+		}
+	}
+	return "", &rpcjson.RPCError{
+		Code:    rpcjson.ErrRPCInvalidParameter,
+		Message: fmt.Sprintf("Unknown system contract %q", name),
+	}
+}
+
+// stateAtHeight returns the state of the main chain at the passed height.
+func (s *PublicRpcAPI) stateAtHeight(height int32) (*state.StateDB, error) {
+	node, err := s.cfg.Chain.GetNodeByHeight(height)
+	if err != nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Block at height %d not found", height),
+		}
+	}
+	stateDB, err := state.New(node.StateRoot(), s.cfg.Chain.GetStateCache())
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Unable to open state")
+	}
+	return stateDB, nil
+}
+
+// GetSystemContracts returns the system contracts along with the hash of their
+// code on chain and their versions, including the scheduled ones.
+func (s *PublicRpcAPI) GetSystemContracts() (interface{}, error) {
+	height := s.cfg.Chain.BestSnapshot().Height
+	stateDB, err := s.stateAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []rpcjson.SystemContractResult
+	for _, contract := range systemContracts() {
+		addr := vm.ConvertSystemContractAddress(contract)
+		result := rpcjson.SystemContractResult{
+			Name:     contract.String(),
+			Address:  string(contract),
+			CodeHash: stateDB.GetCodeHash(addr).Hex(),
+			CodeSize: stateDB.GetCodeSize(addr),
+			Versions: []rpcjson.SystemContractVersion{},
+		}
+		active := s.cfg.ContractMgr.GetActiveContractByHeight(height, contract)
+		for _, version := range s.cfg.ContractMgr.GetContractVersions(contract) {
+			result.Versions = append(result.Versions, rpcjson.SystemContractVersion{
+				Height:    version.BlockHeight,
+				Active:    active != nil && version.BlockHeight == active.BlockHeight,
+				Scheduled: version.BlockHeight > height,
+			})
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// GetScheduledUpgrades returns the system contract versions which activate
+// above the current height, from the closest one.
+func (s *PublicRpcAPI) GetScheduledUpgrades() (interface{}, error) {
+	height := s.cfg.Chain.BestSnapshot().Height
+	results := []rpcjson.ScheduledUpgradeResult{}
+	for _, contract := range systemContracts() {
+		for _, version := range s.cfg.ContractMgr.GetContractVersions(contract) {
+			if version.BlockHeight <= height {
+				continue
+			}
+			results = append(results, rpcjson.ScheduledUpgradeResult{
+				Name:    contract.String(),
+				Address: string(contract),
+				Height:  version.BlockHeight,
+				Blocks:  version.BlockHeight - height,
+			})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Height < results[j].Height
+	})
+	return results, nil
+}
+
+// VerifySystemContracts checks the code of the system contracts on the main
+// chain against the passed expected code hashes at their heights.
+func (s *PublicRpcAPI) VerifySystemContracts(expected []rpcjson.SystemContractHash) (interface{}, error) {
+	results := make([]rpcjson.VerifySystemContractResult, 0, len(expected))
+	for _, exp := range expected {
+		contract, err := parseSystemContract(exp.Name)
+		if err != nil {
+			return nil, err
+		}
+		stateDB, err := s.stateAtHeight(exp.Height)
+		if err != nil {
+			return nil, err
+		}
+
+		actual := stateDB.GetCodeHash(vm.ConvertSystemContractAddress(contract)).Hex()
+		want := strings.ToLower(exp.CodeHash)
+		if !strings.HasPrefix(want, "0x") {
+			want = "0x" + want
+		}
+		results = append(results, rpcjson.VerifySystemContractResult{
+			Name:     contract.String(),
+			Height:   exp.Height,
+			Expected: want,
+			Actual:   actual,
+			Match:    actual == want,
+		})
+	}
+	return results, nil
+}
+
+// DiffSystemContract compares a local template of a system contract with its
+// code on chain.  The local template is the passed hex encoded code, or the
+// code of the active version in the genesis data when empty.  A local creation
+// code matches when it contains the runtime code on chain.
+func (s *PublicRpcAPI) DiffSystemContract(name string, code string) (interface{}, error) {
+	contract, err := parseSystemContract(name)
+	if err != nil {
+		return nil, err
+	}
+	height := s.cfg.Chain.BestSnapshot().Height
+	if code == "" {
+		active := s.cfg.ContractMgr.GetActiveContractByHeight(height, contract)
+		if active == nil {
+			return nil, internalRPCError("No active version of "+
+				contract.String(), "")
+		}
+		code = active.Code
+	}
+	local := common.FromHex(code)
+
+	stateDB, err := s.stateAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	onChain := stateDB.GetCode(vm.ConvertSystemContractAddress(contract))
+
+	firstDiff := -1
+	for i := 0; i < len(local) || i < len(onChain); i++ {
+		if i >= len(local) || i >= len(onChain) || local[i] != onChain[i] {
+			firstDiff = i
+			break
+		}
+	}
+	return rpcjson.DiffSystemContractResult{
+		Name:        contract.String(),
+		OnChainHash: crypto.Keccak256Hash(onChain).Hex(),
+		LocalHash:   crypto.Keccak256Hash(local).Hex(),
+		OnChainSize: len(onChain),
+		LocalSize:   len(local),
+		Match:       firstDiff == -1,
+		Contained:   len(onChain) > 0 && bytes.Contains(local, onChain),
+		FirstDiff:   firstDiff,
+	}, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"math"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/ainterface"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// maxCachedTemplates is the maximum number of template details cached.
+const maxCachedTemplates = 1024
+
+// templateListKey identifies a list of templates of the template warehouse.
+type templateListKey struct {
+	category uint16
+	approved bool
+}
+
+// templateCache caches the templates of the template warehouse.  The lists
+// of templates depend on the state of the best chain, so they are dropped
+// whenever a block is connected or disconnected.  The details of a template
+// are stored along with the transaction which submitted it, so they are only
+// dropped when a block is disconnected.
+type templateCache struct {
+	mtx     sync.Mutex
+	lists   map[templateListKey][]ainterface.TemplateWarehouseContent
+	details map[string]rpcjson.ContractTemplateDetail
+
+	// generation is incremented by every invalidation so data fetched
+	// across an invalidation is not cached.
+	generation uint64
+}
+
+// newTemplateCache returns an empty template cache.
+func newTemplateCache() *templateCache {
+	return &templateCache{
+		lists:   make(map[templateListKey][]ainterface.TemplateWarehouseContent),
+		details: make(map[string]rpcjson.ContractTemplateDetail),
+	}
+}
+
+// list returns the cached list of templates of the passed key along with the
+// current generation of the cache.
+func (c *templateCache) list(key templateListKey) ([]ainterface.TemplateWarehouseContent, bool, uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	list, ok := c.lists[key]
+	return list, ok, c.generation
+}
+
+// addList caches a list of templates fetched at the passed generation.
+func (c *templateCache) addList(generation uint64, key templateListKey,
+	list []ainterface.TemplateWarehouseContent) {
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if generation == c.generation {
+		c.lists[key] = list
+	}
+}
+
+// detail returns the cached details of the template of the passed key along
+// with the current generation of the cache.
+func (c *templateCache) detail(key string) (rpcjson.ContractTemplateDetail, bool, uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	detail, ok := c.details[key]
+	return detail, ok, c.generation
+}
+
+// addDetail caches the details of a template fetched at the passed generation.
+// An arbitrary template is evicted when the cache is full.
+func (c *templateCache) addDetail(generation uint64, key string,
+	detail rpcjson.ContractTemplateDetail) {
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if len(c.details) >= maxCachedTemplates {
+		for k := range c.details {
+			delete(c.details, k)
+			break
+		}
+	}
+	c.details[key] = detail
+}
+
+// invalidate drops the cached lists of templates, and the cached details of
+// the templates too when the passed block was disconnected.
+func (c *templateCache) invalidate(disconnected bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.generation++
+	c.lists = make(map[templateListKey][]ainterface.TemplateWarehouseContent)
+	if disconnected {
+		c.details = make(map[string]rpcjson.ContractTemplateDetail)
+	}
+}
+
+// handleTemplateCacheNotification invalidates the template cache on the
+// changes of the best chain.
+func (s *NodeServer) handleTemplateCacheNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		s.templateCache.invalidate(false)
+	case blockchain.NTBlockDisconnected:
+		s.templateCache.invalidate(true)
+	}
+}
+
+// ListContractTemplates returns all the templates of a category, approved or
+// submitted, from the latest one.  Unlike getContractTemplateList, the list is
+// not paged and is cached until the best chain changes.
+func (s *PublicRpcAPI) ListContractTemplates(category uint16, approved bool) (interface{}, error) {
+	key := templateListKey{category: category, approved: approved}
+	list, ok, generation := s.cfg.TemplateCache.list(key)
+	if ok {
+		return list, nil
+	}
+
+	getCountFunc := common.ContractTemplateWarehouse_GetSubmittedTemplatesCountFunction()
+	getTempFunc := common.ContractTemplateWarehouse_GetSubmittedTemplateFunction()
+	if approved {
+		getCountFunc = common.ContractTemplateWarehouse_GetApprovedTemplatesCountFunction()
+		getTempFunc = common.ContractTemplateWarehouse_GetApprovedTemplateFunction()
+	}
+	block, stateDB := createTempBlockState(s.cfg)
+	_, list, err, _ := s.cfg.ContractMgr.GetTemplates(block,
+		common.SystemContractReadOnlyGas, stateDB, chaincfg.ActiveNetParams.FvmParam,
+		getCountFunc, getTempFunc, category, 0, math.MaxInt32)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to list templates")
+	}
+	if list == nil {
+		list = []ainterface.TemplateWarehouseContent{}
+	}
+	s.cfg.TemplateCache.addList(generation, key, list)
+	return list, nil
+}
+
+// GetContractTemplateMetadata returns the metadata of the template of the
+// passed key, the transaction id in which the template was submitted, without
+// its bytecode, ABI and source.
+func (s *PublicRpcAPI) GetContractTemplateMetadata(key string) (interface{}, error) {
+	detail, ok := getTemplateInfoByKey(key, s)
+	if !ok {
+		return nil, internalRPCError("error:template not found", "")
+	}
+	byteCode := common.FromHex(detail.ByteCode)
+	return rpcjson.ContractTemplateMetadata{
+		Category:     detail.Category,
+		TemplateName: detail.TemplateName,
+		Key:          key,
+		ByteCodeSize: len(byteCode),
+		ByteCodeHash: crypto.Keccak256Hash(byteCode).Hex(),
+		AbiSize:      len(detail.Abi),
+		SourceSize:   len(detail.Source),
+	}, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AsimovNetwork/asimov/addrmgr"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	fnet "github.com/AsimovNetwork/asimov/common/net"
+)
+
+// onionKeyFilename is the name of the file of the data directory keeping the
+// private key of the onion service, so its address does not change on
+// restarts.
+const onionKeyFilename = "onion_v3_private_key"
+
+// onionTarget returns the address the onion service forwards the connections
+// to, which is the first listen address, on the loopback interface when it
+// listens on all interfaces.
+func onionTarget() (string, error) {
+	host, port, err := net.SplitHostPort(chaincfg.Cfg.Listeners[0])
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// torControlThread creates the onion service of the node through the Tor
+// control port and advertises its address to the peers.  The connection to
+// the control port is kept until the node shuts down, at which point Tor
+// removes the service.  It must be run as a goroutine.
+func (s *NodeServer) torControlThread() {
+	defer s.wg.Done()
+
+	cfg := chaincfg.Cfg
+	port, err := strconv.ParseUint(chaincfg.ActiveNetParams.DefaultPort, 10, 16)
+	if err != nil {
+		srvrLog.Errorf("Can not parse default port %s for active chain: %v",
+			chaincfg.ActiveNetParams.DefaultPort, err)
+		return
+	}
+	target, err := onionTarget()
+	if err != nil {
+		srvrLog.Warnf("Can't create an onion service: %v", err)
+		return
+	}
+
+	c, err := fnet.DialTorControl(cfg.TorControl, cfg.TorPassword)
+	if err != nil {
+		srvrLog.Warnf("Can't connect to the Tor control port %s: %v",
+			cfg.TorControl, err)
+		return
+	}
+	defer c.Close()
+
+	keyFile := filepath.Join(cfg.DataDir, onionKeyFilename)
+	var key string
+	if b, err := ioutil.ReadFile(keyFile); err == nil {
+		key = strings.TrimSpace(string(b))
+	}
+	serviceID, newKey, err := c.AddOnion(key, uint16(port), target)
+	if err != nil {
+		srvrLog.Warnf("Can't create an onion service: %v", err)
+		return
+	}
+	if newKey != key {
+		if err := ioutil.WriteFile(keyFile, []byte(newKey+"\n"), 0600); err != nil {
+			srvrLog.Warnf("Unable to save the onion service key: %v", err)
+		}
+	}
+
+	na, err := s.addrManager.HostToNetAddress(serviceID+".onion", uint16(port),
+		s.services)
+	if err != nil {
+		srvrLog.Warnf("Tor returned an invalid onion service %s: %v",
+			serviceID, err)
+		return
+	}
+	if err := s.addrManager.AddLocalAddress(na, addrmgr.ManualPrio); err != nil {
+		srvrLog.Warnf("Unable to advertise the onion service: %v", err)
+	}
+	srvrLog.Infof("Accepting connections through the onion service %s "+
+		"forwarded to %s", addrmgr.NetAddressKey(na), target)
+
+	<-s.quit
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"os"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/tracing"
+)
+
+// newTracer returns the tracer exporting the spans of the node to the
+// configured OTLP endpoint, or nil when tracing is disabled.
+func newTracer(cfg *chaincfg.FConfig) *tracing.Tracer {
+	if cfg.TracingEndpoint == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	return tracing.New(&tracing.Config{
+		Endpoint: cfg.TracingEndpoint,
+		Resource: []tracing.Attribute{
+			{Key: "host.name", Value: host},
+			{Key: "asimov.network", Value: chaincfg.ActiveNetParams.Name()},
+		},
+		SampleRate: cfg.TracingSampleRate,
+	})
+}
@@ -0,0 +1,436 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// historyTx is a transaction of the history of a set of addresses, either
+// unconfirmed or located by its region in a block.
+type historyTx struct {
+	tx      *asiutil.Tx
+	region  database.BlockRegion
+	blkHash common.Hash
+	height  int32
+	virtual bool
+}
+
+// addressSet is a set of encoded addresses.
+type addressSet map[string]struct{}
+
+// containsAny returns whether one of the passed addresses is in the set.
+func (set addressSet) containsAny(addrs []string) bool {
+	for _, addr := range addrs {
+		if _, ok := set[addr]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addAll adds the passed addresses to the set.
+func (set addressSet) addAll(addrs []string) {
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
+	}
+}
+
+// sorted returns the addresses of the set in ascending order.
+func (set addressSet) sorted() []string {
+	addrs := make([]string, 0, len(set))
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// createdContractAddress returns the encoded address of the contract created
+// by a transaction whose first input spends an output of the passed caller.
+func createdContractAddress(mtx *protos.MsgTx, caller string) (string, bool) {
+	addr, err := asiutil.DecodeAddress(caller)
+	if err != nil {
+		return "", false
+	}
+	callerAddr := addr.StandardAddress()
+	contractAddr, err := crypto.CreateContractAddress(callerAddr[:], []byte{},
+		asiutil.GenInputHash(mtx))
+	if err != nil {
+		return "", false
+	}
+	return contractAddr.EncodeAddress(), true
+}
+
+// createHistoryResult attributes a transaction to the passed wallet addresses.
+// The inputs spending outputs of the wallet are sent by the wallet, which then
+// pays the fee, and the outputs paying the wallet are received.  The other
+// addresses of the inputs of a received transaction, or of the outputs of a
+// sent transaction, are its counterparties.
+func createHistoryResult(rpcCfg rpcserverConfig, mtx *protos.MsgTx,
+	wallet addressSet, virtual bool) (*rpcjson.ListTransactionsResult, error) {
+
+	vins, originTxOuts, err := createVinListPrevOut(rpcCfg, mtx, true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &rpcjson.ListTransactionsResult{Txid: mtx.TxHash().String()}
+	balance := make(map[string]int64)
+	involved := make(addressSet)
+	payers := make(addressSet)
+	payees := make(addressSet)
+	contracts := make(addressSet)
+	funded := false
+	for _, vin := range vins {
+		if vin.Coinbase != "" {
+			result.Coinbase = true
+			continue
+		}
+		if vin.PrevOut == nil {
+			continue
+		}
+		if wallet.containsAny(vin.PrevOut.Addresses) {
+			balance[vin.PrevOut.Asset] -= vin.PrevOut.Value
+			involved.addAll(vin.PrevOut.Addresses)
+			funded = true
+		} else {
+			payers.addAll(vin.PrevOut.Addresses)
+		}
+	}
+
+	for _, vout := range createVoutList(mtx, nil) {
+		addrs := vout.ScriptPubKey.Addresses
+		switch vout.ScriptPubKey.Type {
+		case txscript.CallTy.String(), txscript.TemplateTy.String(),
+			txscript.VoteTy.String():
+			contracts.addAll(addrs)
+			continue
+		case txscript.CreateTy.String():
+			if len(vins) > 0 && vins[0].PrevOut != nil &&
+				len(vins[0].PrevOut.Addresses) > 0 {
+
+				caller := vins[0].PrevOut.Addresses[0]
+				if contract, ok := createdContractAddress(mtx, caller); ok {
+					contracts[contract] = struct{}{}
+				}
+			}
+			continue
+		}
+		if wallet.containsAny(addrs) {
+			balance[vout.Asset] += vout.Value
+			involved.addAll(addrs)
+		} else {
+			payees.addAll(addrs)
+		}
+	}
+
+	// The fee paid by the wallet is reported apart from its amounts.
+	if funded && !virtual {
+		result.Fee, err = calculateTransactionFee(mtx, originTxOuts)
+		if err != nil {
+			return nil, err
+		}
+		for _, fee := range result.Fee {
+			balance[fee.Asset] += fee.Value
+		}
+	}
+
+	switch {
+	case !funded:
+		result.Direction = "receive"
+		result.Counterparties = payers.sorted()
+	case len(payees) == 0 && len(contracts) == 0:
+		result.Direction = "self"
+		result.Counterparties = []string{}
+	default:
+		result.Direction = "send"
+		result.Counterparties = payees.sorted()
+	}
+
+	result.Amounts = make([]rpcjson.AssetAmountResult, 0, len(balance))
+	for asset, value := range balance {
+		if value != 0 {
+			result.Amounts = append(result.Amounts, rpcjson.AssetAmountResult{
+				Value: value,
+				Asset: asset,
+			})
+		}
+	}
+	sort.Slice(result.Amounts, func(i, j int) bool {
+		return result.Amounts[i].Asset < result.Amounts[j].Asset
+	})
+	for addr := range involved {
+		if _, ok := wallet[addr]; !ok {
+			delete(involved, addr)
+		}
+	}
+	result.Addresses = involved.sorted()
+	if len(contracts) > 0 {
+		result.Contracts = contracts.sorted()
+	}
+	return result, nil
+}
+
+// ListTransactions returns the history of the passed addresses, or of the
+// watched deposit addresses when none is passed, from the newest transaction.
+// Each transaction is attributed with its direction, counterparties, amounts
+// by asset, fee and contracts, as seen from the addresses, for accounting
+// exports.  The unconfirmed transactions come first.  The history is returned
+// in pages whose cursor is the number of transactions of the previous pages.
+func (s *PublicRpcAPI) ListTransactions(ctx context.Context, addresses []string, page *rpcjson.PageRequest) (interface{}, error) {
+	items, pageResult, err := s.transactionHistory(ctx, addresses, page,
+		"listtransactions")
+	if err != nil {
+		return nil, err
+	}
+	pageResult.Items = items
+	return pageResult, nil
+}
+
+// transactionHistory returns the requested page of the history of the passed
+// addresses, for the listTransactions command and the commands built on it,
+// and the page result without its items.
+func (s *PublicRpcAPI) transactionHistory(ctx context.Context, addresses []string,
+	page *rpcjson.PageRequest, method string) ([]*rpcjson.ListTransactionsResult, *rpcjson.PageResult, error) {
+
+	addrIndex := s.cfg.AddrIndex
+	if addrIndex == nil {
+		return nil, nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCMisc,
+			Message: "Address index must be enabled (--addrindex)",
+		}
+	}
+	if len(addresses) == 0 && s.cfg.Deposits != nil {
+		for _, w := range s.cfg.Deposits.Watches() {
+			addresses = append(addresses, w.Address)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "No address passed and no deposit address watched",
+		}
+	}
+
+	wallet := make(addressSet, len(addresses))
+	addrs := make([]common.IAddress, 0, len(addresses))
+	for _, address := range addresses {
+		addr, err := asiutil.DecodeAddress(address)
+		if err != nil {
+			return nil, nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + address,
+			}
+		}
+		if _, ok := wallet[addr.EncodeAddress()]; !ok {
+			wallet[addr.EncodeAddress()] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+	}
+
+	if page == nil {
+		page = &rpcjson.PageRequest{}
+	}
+	limit, err := pageLimit(page)
+	if err != nil {
+		return nil, nil, err
+	}
+	position, err := decodeCursor(page, method)
+	if err != nil {
+		return nil, nil, err
+	}
+	var offset int
+	if position != "" {
+		offset, err = strconv.Atoi(position)
+		if err != nil || offset < 0 {
+			return nil, nil, &rpcjson.RPCError{
+				Code:    rpcjson.ErrRPCInvalidParameter,
+				Message: "Invalid cursor: " + page.Cursor,
+			}
+		}
+	}
+
+	// The unconfirmed transactions are ordered by hash so the pages are
+	// stable.
+	seen := make(map[common.Hash]struct{})
+	var pending []historyTx
+	for _, addr := range addrs {
+		for _, tx := range addrIndex.UnconfirmedTxnsForAddress(addr) {
+			if _, ok := seen[*tx.Hash()]; !ok {
+				seen[*tx.Hash()] = struct{}{}
+				pending = append(pending, historyTx{tx: tx})
+			}
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].tx.Hash().String() < pending[j].tx.Hash().String()
+	})
+
+	// The newest offset+limit transactions of each address are enough to
+	// merge the requested page of the history of all of them.
+	numRequested := uint32(offset + limit)
+	truncated := false
+	var confirmed []historyTx
+	err = s.cfg.DB.View(func(dbTx database.Tx) error {
+		found := make(map[database.BlockKey]map[uint32]struct{})
+		for _, addr := range addrs {
+			regions, _, err := addrIndex.TxRegionsForAddress(dbTx, addr,
+				0, numRequested, true)
+			if err != nil {
+				return err
+			}
+			truncated = truncated || uint32(len(regions)) == numRequested
+			for _, region := range regions {
+				offsets, ok := found[*region.Key]
+				if !ok {
+					offsets = make(map[uint32]struct{})
+					found[*region.Key] = offsets
+				}
+				if _, ok := offsets[region.Offset]; ok {
+					continue
+				}
+				offsets[region.Offset] = struct{}{}
+				h := historyTx{
+					region:  region,
+					virtual: region.Key[common.HashLength] == byte(database.BlockVirtual),
+				}
+				copy(h.blkHash[:], region.Key[:common.HashLength])
+				confirmed = append(confirmed, h)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		context := "Failed to load address index entries"
+		return nil, nil, internalRPCError(err.Error(), context)
+	}
+
+	heights := make(map[common.Hash]int32)
+	for i := range confirmed {
+		h := &confirmed[i]
+		height, ok := heights[h.blkHash]
+		if !ok {
+			height, err = s.cfg.Chain.BlockHeightByHash(&h.blkHash)
+			if err != nil {
+				context := "Failed to obtain block height"
+				return nil, nil, internalRPCError(err.Error(), context)
+			}
+			heights[h.blkHash] = height
+		}
+		h.height = height
+	}
+	sort.Slice(confirmed, func(i, j int) bool {
+		a, b := &confirmed[i], &confirmed[j]
+		if a.height != b.height {
+			return a.height > b.height
+		}
+		if a.virtual != b.virtual {
+			return a.virtual
+		}
+		return a.region.Offset > b.region.Offset
+	})
+
+	history := append(pending, confirmed...)
+	from, to := offset, offset+limit
+	if from > len(history) {
+		from = len(history)
+	}
+	if to > len(history) {
+		to = len(history)
+	}
+	history = history[from:to]
+
+	// Load the raw transactions of the page.
+	var regions []database.BlockRegion
+	for _, h := range history {
+		if h.tx == nil {
+			regions = append(regions, h.region)
+		}
+	}
+	var serializedTxns [][]byte
+	err = s.cfg.DB.View(func(dbTx database.Tx) error {
+		var err error
+		serializedTxns, err = dbTx.FetchBlockRegions(regions)
+		return err
+	})
+	if err != nil {
+		context := "Failed to load transactions"
+		return nil, nil, internalRPCError(err.Error(), context)
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	items := make([]*rpcjson.ListTransactionsResult, 0, len(history))
+	for _, h := range history {
+		if ctx.Err() != nil {
+			return nil, nil, rpcCancelledError(ctx)
+		}
+		var mtx *protos.MsgTx
+		if h.tx != nil {
+			mtx = h.tx.MsgTx()
+		} else {
+			mtx = new(protos.MsgTx)
+			err := mtx.Deserialize(bytes.NewReader(serializedTxns[0]))
+			if err != nil {
+				context := "Failed to deserialize transaction"
+				return nil, nil, internalRPCError(err.Error(), context)
+			}
+			serializedTxns = serializedTxns[1:]
+		}
+
+		result, err := createHistoryResult(*s.cfg, mtx, wallet, h.virtual)
+		if err != nil {
+			return nil, nil, err
+		}
+		if h.tx != nil {
+			result.Status = "pending"
+		} else {
+			header, err := s.cfg.Chain.FetchHeader(&h.blkHash)
+			if err != nil {
+				return nil, nil, &rpcjson.RPCError{
+					Code:    rpcjson.ErrRPCBlockHeaderNotFound,
+					Message: "Failed to obtain block header",
+				}
+			}
+			result.Status = "confirmed"
+			if h.virtual {
+				result.Status = "virtual"
+			}
+			result.BlockHash = h.blkHash.UnprefixString()
+			result.Height = h.height
+			result.Confirmations = int64(1 + best.Height - h.height)
+			result.Time = header.Timestamp
+		}
+		items = append(items, result)
+	}
+
+	estimate := int64(len(pending))
+	for _, addr := range addrs {
+		numTxns, err := addrIndex.NumTxnsForAddress(addr)
+		if err != nil {
+			context := "Failed to load address index entries"
+			return nil, nil, internalRPCError(err.Error(), context)
+		}
+		estimate += int64(numTxns)
+	}
+	pageResult := &rpcjson.PageResult{TotalEstimate: estimate}
+	if next := from + len(items); len(items) > 0 &&
+		(next < len(pending)+len(confirmed) || truncated) {
+
+		pageResult.NextCursor = encodeCursor(method, strconv.Itoa(next))
+	}
+	return items, pageResult, nil
+}
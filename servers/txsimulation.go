@@ -0,0 +1,85 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// estimatedSigScriptSize is the size of the signature script of an input
+// spending a pay-to-pubkey-hash output: the pushes of a signature of up to
+// 72 bytes with its hash type, and of a compressed public key.
+const estimatedSigScriptSize = 1 + 73 + 1 + 33
+
+// simulateTransaction predicts the size, gas usage and fee of the passed
+// unsigned transaction by running it on top of the best chain and the
+// mempool.  The conditions suggesting a fee mistake are reported as
+// warnings rather than errors, since the transaction may still be
+// intended.
+func (s *PublicRpcAPI) simulateTransaction(mtx *protos.MsgTx) (*rpcjson.TxSimulationResult, error) {
+	result := &rpcjson.TxSimulationResult{
+		Size:     mtx.SerializeSize() + len(mtx.TxIn)*estimatedSigScriptSize,
+		GasLimit: mtx.TxContract.GasLimit,
+	}
+
+	tx := asiutil.NewTx(mtx)
+	view, err := s.cfg.TxMemPool.FetchInputUtxos(tx)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to fetch the inputs")
+	}
+	height := s.cfg.Chain.BestSnapshot().Height + 1
+	fee, _, err := blockchain.CheckTransactionInputs(tx, height, view, s.cfg.Chain)
+	if err != nil {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("unable to compute the fee: %v", err))
+		return result, nil
+	}
+	result.Fee = fee
+	result.FeePerByte = float64(fee) / float64(result.Size)
+	if mtx.TxContract.GasLimit > 0 {
+		result.GasPrice = float64(fee) / float64(mtx.TxContract.GasLimit)
+	}
+
+	block, stateDB := createTempBlockState(s.cfg)
+	block.MsgBlock().AddTransaction(mtx)
+	_, err, gasUsed, _, _ := s.cfg.Chain.ConnectTransaction(block, 0, view,
+		tx, nil, stateDB, fee)
+	if err != nil {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("dry run failed: %v", err))
+	}
+	result.GasUsed = gasUsed
+
+	var outputs int64
+	for _, txOut := range mtx.TxOut {
+		if txOut.Asset.Equal(&asiutil.AsimovAsset) {
+			outputs += txOut.Value
+		}
+	}
+	switch {
+	case fee <= 0:
+		result.Warnings = append(result.Warnings, "the transaction pays no fee")
+	case result.GasPrice < chaincfg.Cfg.MinTxPrice:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("the gas "+
+			"price %v is below the minimum relay price %v",
+			result.GasPrice, chaincfg.Cfg.MinTxPrice))
+	case fee > outputs:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("the fee %d "+
+			"exceeds the value of the outputs %d, a change output may "+
+			"be missing", fee, outputs))
+	}
+	if gasUsed > uint64(mtx.TxContract.GasLimit) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("the gas "+
+			"usage %d exceeds the gas limit %d", gasUsed,
+			mtx.TxContract.GasLimit))
+	}
+	return result, nil
+}
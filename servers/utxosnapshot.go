@@ -0,0 +1,98 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+)
+
+// loadUtxoSet bootstraps the chain from the snapshot of the --loadutxoset
+// option, unless the database already holds a chain.
+func loadUtxoSet(db database.Transactor, stateDB database.Database,
+	params *chaincfg.Params, cfg *chaincfg.FConfig) error {
+
+	hash, err := hex.DecodeString(cfg.LoadUtxoSetHash)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(cfg.LoadUtxoSet)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	srvrLog.Infof("Loading the snapshot %s", cfg.LoadUtxoSet)
+	header, err := blockchain.LoadSnapshot(db, stateDB, params, f, common.BytesToHash(hash))
+	if err == blockchain.ErrSnapshotChainExists {
+		srvrLog.Infof("Not loading the snapshot, %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to load the snapshot %s: %v", cfg.LoadUtxoSet, err)
+	}
+	srvrLog.Infof("Loaded the snapshot of block %v at height %d", header.Hash,
+		header.Height)
+	return nil
+}
+
+// DumpUtxoSet writes a snapshot of the utxo set, contract state and chain
+// metadata at the best block to the utxosnapshots directory of the data
+// directory.  A new node started with the --loadutxoset option bootstraps
+// from the snapshot, given its hash.  The snapshot is written under a
+// temporary name and renamed once complete.
+func (s *PublicRpcAPI) DumpUtxoSet(ctx context.Context) (interface{}, error) {
+	dir := filepath.Join(chaincfg.Cfg.DataDir, utxoSnapshotDirname)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to dump the utxo set")
+	}
+	tmp, err := ioutil.TempFile(dir, "utxoset-*.tmp")
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to dump the utxo set")
+	}
+	defer os.Remove(tmp.Name())
+
+	info, err := s.cfg.Chain.DumpSnapshot(tmp, ctx.Done())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == blockchain.ErrInterruptRequested {
+		return nil, rpcCancelledError(ctx)
+	}
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to dump the utxo set")
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("utxoset-%d-%s.dat", info.Header.Height,
+		info.Header.Hash.UnprefixString()))
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to dump the utxo set")
+	}
+	rpcsLog.Infof("Dumped the utxo set at height %d to %s, hash %x",
+		info.Header.Height, file, info.Hash[:])
+
+	return &rpcjson.DumpUtxoSetResult{
+		Height:    info.Header.Height,
+		BlockHash: info.Header.Hash.String(),
+		StateRoot: info.Header.StateRoot.String(),
+		Records:   info.Records,
+		Size:      info.Size,
+		Hash:      hex.EncodeToString(info.Hash[:]),
+		File:      file,
+	}, nil
+}
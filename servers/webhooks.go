@@ -0,0 +1,245 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"encoding/hex"
+	"sync/atomic"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/rpcs/rawdb"
+	"github.com/AsimovNetwork/asimov/txscript"
+	"github.com/AsimovNetwork/asimov/webhook"
+)
+
+// webhookBlockEvent is the payload of a block webhook event.
+type webhookBlockEvent struct {
+	Hash      string `json:"hash"`
+	Height    int32  `json:"height"`
+	Round     uint32 `json:"round"`
+	Slot      uint16 `json:"slot"`
+	Time      int64  `json:"time"`
+	TxCount   int    `json:"txcount"`
+	Validator string `json:"validator"`
+}
+
+// webhookTxEvent is the payload of a watched address transaction event.
+type webhookTxEvent struct {
+	TxID      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	Address   string `json:"address"`
+	Value     int64  `json:"value"`
+	Asset     string `json:"asset"`
+	BlockHash string `json:"blockhash"`
+	Height    int32  `json:"height"`
+}
+
+// webhookLogEvent is the payload of a contract event log event.
+type webhookLogEvent struct {
+	Address   string   `json:"address"`
+	Topics    []string `json:"topics"`
+	Data      string   `json:"data"`
+	TxHash    string   `json:"txhash"`
+	LogIndex  uint     `json:"logindex"`
+	BlockHash string   `json:"blockhash"`
+	Height    int32    `json:"height"`
+}
+
+// webhookMissedSlotEvent is the payload of a missed slot event.
+type webhookMissedSlotEvent struct {
+	Round     uint32 `json:"round"`
+	Slot      uint16 `json:"slot"`
+	Validator string `json:"validator"`
+}
+
+// roundSlot identifies a slot of a consensus round.
+type roundSlot struct {
+	round uint32
+	slot  uint16
+}
+
+// missedSlots returns the slots between the slot of the previous block and the
+// slot of the new block which did not produce a block.  Gaps spanning more
+// than one full round are truncated to the slots of the last two rounds.
+func missedSlots(prev, cur roundSlot, roundSize uint16) []roundSlot {
+	var missed []roundSlot
+	if cur.round < prev.round || (cur.round == prev.round && cur.slot <= prev.slot) {
+		return nil
+	}
+	if cur.round == prev.round {
+		for slot := prev.slot + 1; slot < cur.slot; slot++ {
+			missed = append(missed, roundSlot{cur.round, slot})
+		}
+		return missed
+	}
+	if cur.round == prev.round+1 {
+		for slot := prev.slot + 1; slot < roundSize; slot++ {
+			missed = append(missed, roundSlot{prev.round, slot})
+		}
+	}
+	for slot := uint16(0); slot < cur.slot; slot++ {
+		missed = append(missed, roundSlot{cur.round, slot})
+	}
+	return missed
+}
+
+// webhookBlock is a connected block forwarded to the webhook handler.
+type webhookBlock struct {
+	*asiutil.Block
+
+	// dropped is the number of blocks dropped before this one, so the
+	// handler knows the blocks it did not see.
+	dropped uint32
+}
+
+// handleWebhookNotification forwards the connected blocks to the webhook
+// handler so the chain notification callback never blocks on event delivery.
+// The blocks are dropped, without their events, when the handler falls
+// behind.
+func (s *NodeServer) handleWebhookNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		data, ok := notification.Data.([]interface{})
+		if !ok || len(data) == 0 {
+			return
+		}
+		block, ok := data[0].(*asiutil.Block)
+		if !ok {
+			return
+		}
+		wb := webhookBlock{
+			Block:   block,
+			dropped: atomic.LoadUint32(&s.webhookBlocksDropped),
+		}
+		select {
+		case s.webhookBlocks <- wb:
+		default:
+			atomic.AddUint32(&s.webhookBlocksDropped, 1)
+			srvrLog.Warnf("Dropping the webhook events of block %v "+
+				"(height %d): %d blocks already waiting",
+				block.Hash(), block.Height(), cap(s.webhookBlocks))
+		}
+	}
+}
+
+// webhookHandler turns the connected blocks into webhook events.  It must be
+// run with goSupervised.
+func (s *NodeServer) webhookHandler() {
+	var prev *roundSlot
+	var dropped uint32
+out:
+	for {
+		select {
+		case wb := <-s.webhookBlocks:
+			// The slots of the dropped blocks would be taken as
+			// missed, so the missed slots are not looked for
+			// across them.
+			if wb.dropped != dropped {
+				dropped = wb.dropped
+				prev = nil
+			}
+
+			// Avoid flooding the webhooks with historical events
+			// during the initial block download.
+			if !s.chain.IsCurrent() {
+				prev = nil
+				continue
+			}
+			block := wb.Block
+			header := &block.MsgBlock().Header
+			cur := roundSlot{header.Round, header.SlotIndex}
+			if prev != nil && s.webhooks.Enabled(webhook.EventMissedSlot) {
+				s.notifyMissedSlots(missedSlots(*prev, cur,
+					chaincfg.ActiveNetParams.RoundSize))
+			}
+			prev = &cur
+			s.notifyBlockEvents(block)
+
+		case <-s.quit:
+			break out
+		}
+	}
+}
+
+// notifyMissedSlots sends a missed slot event for every passed slot.
+func (s *NodeServer) notifyMissedSlots(slots []roundSlot) {
+	for _, rs := range slots {
+		validators, _, err := s.chain.GetValidators(rs.round)
+		if err != nil || int(rs.slot) >= len(validators) {
+			srvrLog.Debugf("Unable to find the validator of round %d "+
+				"slot %d: %v", rs.round, rs.slot, err)
+			continue
+		}
+		s.webhooks.Notify(webhook.EventMissedSlot, &webhookMissedSlotEvent{
+			Round:     rs.round,
+			Slot:      rs.slot,
+			Validator: validators[rs.slot].String(),
+		})
+	}
+}
+
+// notifyBlockEvents sends the block, watched transaction and contract event
+// notifications of a connected block.
+func (s *NodeServer) notifyBlockEvents(block *asiutil.Block) {
+	header := &block.MsgBlock().Header
+	blockHash := block.Hash().String()
+	height := block.Height()
+
+	s.webhooks.Notify(webhook.EventBlock, &webhookBlockEvent{
+		Hash:      blockHash,
+		Height:    height,
+		Round:     header.Round,
+		Slot:      header.SlotIndex,
+		Time:      header.Timestamp,
+		TxCount:   len(block.Transactions()),
+		Validator: header.CoinBase.String(),
+	})
+
+	if len(s.webhookWatch) > 0 && s.webhooks.Enabled(webhook.EventWatchedTx) {
+		for _, tx := range block.Transactions() {
+			for i, txOut := range tx.MsgTx().TxOut {
+				_, addrs, _, _ := txscript.ExtractPkScriptAddrs(txOut.PkScript)
+				for _, addr := range addrs {
+					encoded := addr.EncodeAddress()
+					if _, ok := s.webhookWatch[encoded]; !ok {
+						continue
+					}
+					s.webhooks.Notify(webhook.EventWatchedTx, &webhookTxEvent{
+						TxID:      tx.Hash().String(),
+						Vout:      i,
+						Address:   encoded,
+						Value:     txOut.Value,
+						Asset:     hex.EncodeToString(txOut.Asset.Bytes()),
+						BlockHash: blockHash,
+						Height:    height,
+					})
+				}
+			}
+		}
+	}
+
+	if s.webhooks.Enabled(webhook.EventContractLog) {
+		receipts := rawdb.ReadReceipts(s.chain.EthDB(), *block.Hash(), uint64(height))
+		for _, receipt := range receipts {
+			for _, l := range receipt.Logs {
+				topics := make([]string, 0, len(l.Topics))
+				for _, topic := range l.Topics {
+					topics = append(topics, topic.String())
+				}
+				s.webhooks.Notify(webhook.EventContractLog, &webhookLogEvent{
+					Address:   l.Address.String(),
+					Topics:    topics,
+					Data:      hex.EncodeToString(l.Data),
+					TxHash:    l.TxHash.String(),
+					LogIndex:  l.Index,
+					BlockHash: blockHash,
+					Height:    height,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package servers
+
+import (
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/rpcs/rpcjson"
+	"github.com/AsimovNetwork/asimov/workers"
+)
+
+// vmWorkers limits the contract executions of the RPC calls running at the
+// same time, so heavy calls can not starve the validation of blocks.  It
+// defaults to one per processor core.
+var vmWorkers = workers.New("vm", "contract executions of RPC calls",
+	workers.PerCPU(1))
+
+// setWorkerPoolSizes applies the configured sizes of the worker pools.  The
+// pools whose size is not configured keep their default size.
+func setWorkerPoolSizes(cfg *chaincfg.FConfig) {
+	sizes := map[string]int{
+		"script":    cfg.ScriptWorkers,
+		"vm":        cfg.VMWorkers,
+		"peerwrite": cfg.PeerWriteWorkers,
+		"index":     cfg.IndexWorkers,
+	}
+	for name, size := range sizes {
+		if pool := workers.Lookup(name); pool != nil && size > 0 {
+			pool.SetSize(size)
+		}
+	}
+}
+
+// workerPoolResult converts a worker pool into its RPC form.
+func workerPoolResult(pool *workers.Pool) rpcjson.WorkerPoolResult {
+	return rpcjson.WorkerPoolResult{
+		Name:        pool.Name(),
+		Description: pool.Description(),
+		Size:        pool.Size(),
+		DefaultSize: pool.DefaultSize(),
+		Active:      pool.Active(),
+	}
+}
+
+// GetWorkerPools returns the size and use of the worker pools.
+func (s *PublicRpcAPI) GetWorkerPools() (interface{}, error) {
+	pools := workers.All()
+	result := make([]rpcjson.WorkerPoolResult, 0, len(pools))
+	for _, pool := range pools {
+		result = append(result, workerPoolResult(pool))
+	}
+	return result, nil
+}
+
+// SetWorkerPoolSize changes the size of the named worker pool, or restores its
+// default size when the size is 0.  The tasks already running are not
+// interrupted.  When API keys are enabled, it can only be called with an admin
+// key.
+func (s *PublicRpcAPI) SetWorkerPoolSize(name string, size int) (interface{}, error) {
+	pool := workers.Lookup(name)
+	if pool == nil {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Unknown worker pool " + name,
+		}
+	}
+	if size < 0 {
+		return nil, &rpcjson.RPCError{
+			Code:    rpcjson.ErrRPCInvalidParameter,
+			Message: "Worker pool size may not be negative",
+		}
+	}
+	pool.SetSize(size)
+	rpcsLog.Infof("Set size of worker pool %s to %d", name, pool.Size())
+	return workerPoolResult(pool), nil
+}
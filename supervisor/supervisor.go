@@ -0,0 +1,183 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package supervisor isolates the panics of the subsystems which are not part
+// of consensus, such as the RPC handlers, the indexers and the notification
+// sinks, from the rest of the node.
+//
+// A panic is recovered and logged with its stack, counted, and reported to an
+// optional callback, typically raising an alert.  Long running subsystems are
+// restarted with an exponential backoff, while calls protected with Protect
+// return the panic as an error.
+package supervisor
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinBackoff is the default delay before the first restart of a
+	// subsystem.
+	DefaultMinBackoff = time.Second
+
+	// DefaultMaxBackoff is the default maximum delay between two restarts
+	// of a subsystem.  A subsystem running longer than this without
+	// panicking is restarted again with the minimum delay.
+	DefaultMaxBackoff = time.Minute
+
+	// maxStackSize is the maximum size of the recorded stacks.
+	maxStackSize = 64 << 10
+)
+
+// PanicError is the error returned by Protect when the protected call
+// panicked.
+type PanicError struct {
+	Subsystem string
+	Value     interface{}
+	Stack     []byte
+}
+
+// Error returns the panic value.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Subsystem, e.Value)
+}
+
+// Config is the configuration of a supervisor.
+type Config struct {
+	// MinBackoff and MaxBackoff bound the delay before a subsystem is
+	// restarted.  They default to DefaultMinBackoff and DefaultMaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnPanic is called after a panic was recovered.  It may be nil.
+	OnPanic func(err *PanicError)
+}
+
+// Stats describes the panics of a subsystem.
+type Stats struct {
+	Subsystem string
+	Panics    uint64
+	Restarts  uint64
+	LastPanic time.Time
+	LastError string
+}
+
+// Supervisor recovers the panics of the subsystems.
+type Supervisor struct {
+	cfg Config
+
+	mtx   sync.Mutex
+	stats map[string]*Stats
+}
+
+// New returns a supervisor with the passed configuration.
+func New(cfg *Config) *Supervisor {
+	s := &Supervisor{
+		cfg:   *cfg,
+		stats: make(map[string]*Stats),
+	}
+	if s.cfg.MinBackoff <= 0 {
+		s.cfg.MinBackoff = DefaultMinBackoff
+	}
+	if s.cfg.MaxBackoff < s.cfg.MinBackoff {
+		s.cfg.MaxBackoff = DefaultMaxBackoff
+		if s.cfg.MaxBackoff < s.cfg.MinBackoff {
+			s.cfg.MaxBackoff = s.cfg.MinBackoff
+		}
+	}
+	return s
+}
+
+// Report records a panic recovered by the caller and returns it as an error.
+func (s *Supervisor) Report(subsystem string, value interface{}, stack []byte) *PanicError {
+	err := &PanicError{Subsystem: subsystem, Value: value, Stack: stack}
+	log.Errorf("Recovered from %v\n%s", err.Error(), stack)
+
+	s.mtx.Lock()
+	stats := s.subsystem(subsystem)
+	stats.Panics++
+	stats.LastPanic = time.Now()
+	stats.LastError = fmt.Sprint(value)
+	s.mtx.Unlock()
+
+	if s.cfg.OnPanic != nil {
+		s.cfg.OnPanic(err)
+	}
+	return err
+}
+
+// subsystem returns the stats of a subsystem.  It must be called with the lock
+// held.
+func (s *Supervisor) subsystem(name string) *Stats {
+	stats, ok := s.stats[name]
+	if !ok {
+		stats = &Stats{Subsystem: name}
+		s.stats[name] = stats
+	}
+	return stats
+}
+
+// Protect calls fn and returns a *PanicError when it panics.
+func (s *Supervisor) Protect(subsystem string, fn func()) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = s.Report(subsystem, value, Stack())
+		}
+	}()
+	fn()
+	return nil
+}
+
+// Run calls fn until it returns without panicking, waiting longer after each
+// consecutive panic.  It returns without restarting fn once quit is closed.
+func (s *Supervisor) Run(subsystem string, fn func(), quit <-chan struct{}) {
+	backoff := s.cfg.MinBackoff
+	for {
+		start := time.Now()
+		if s.Protect(subsystem, fn) == nil {
+			return
+		}
+		if time.Since(start) > s.cfg.MaxBackoff {
+			backoff = s.cfg.MinBackoff
+		}
+
+		log.Warnf("Restarting %s in %v", subsystem, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-quit:
+			return
+		}
+		if backoff *= 2; backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+
+		s.mtx.Lock()
+		s.subsystem(subsystem).Restarts++
+		s.mtx.Unlock()
+	}
+}
+
+// Stats returns the stats of the subsystems which panicked, ordered by name.
+func (s *Supervisor) Stats() []Stats {
+	s.mtx.Lock()
+	stats := make([]Stats, 0, len(s.stats))
+	for _, st := range s.stats {
+		stats = append(stats, *st)
+	}
+	s.mtx.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Subsystem < stats[j].Subsystem
+	})
+	return stats
+}
+
+// Stack returns the stack of the calling goroutine.
+func Stack() []byte {
+	buf := make([]byte, maxStackSize)
+	return buf[:runtime.Stack(buf, false)]
+}
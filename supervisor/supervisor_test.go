@@ -0,0 +1,64 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProtect(t *testing.T) {
+	var reported *PanicError
+	s := New(&Config{OnPanic: func(err *PanicError) { reported = err }})
+
+	if err := s.Protect("ok", func() {}); err != nil {
+		t.Fatalf("Protect of a call not panicking = %v", err)
+	}
+	err := s.Protect("sink", func() { panic("boom") })
+	perr, ok := err.(*PanicError)
+	if !ok || perr.Subsystem != "sink" || perr.Value != "boom" || len(perr.Stack) == 0 {
+		t.Fatalf("Protect of a panicking call = %#v", err)
+	}
+	if reported != perr {
+		t.Fatal("OnPanic not called with the panic")
+	}
+
+	stats := s.Stats()
+	if len(stats) != 1 || stats[0].Subsystem != "sink" || stats[0].Panics != 1 ||
+		stats[0].LastError != "boom" {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := New(&Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond * 4})
+
+	// The subsystem is restarted until it returns normally.
+	runs := 0
+	s.Run("worker", func() {
+		if runs++; runs < 4 {
+			panic(runs)
+		}
+	}, nil)
+	if runs != 4 {
+		t.Fatalf("worker ran %d times, want 4", runs)
+	}
+	stats := s.Stats()
+	if len(stats) != 1 || stats[0].Panics != 3 || stats[0].Restarts != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// No restart happens once quit is closed.
+	quit := make(chan struct{})
+	close(quit)
+	runs = 0
+	s.Run("stopped", func() {
+		runs++
+		panic("boom")
+	}, quit)
+	if runs != 1 {
+		t.Fatalf("stopped worker ran %d times, want 1", runs)
+	}
+}
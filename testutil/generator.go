@@ -0,0 +1,372 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package testutil generates valid block chains for the tests.
+//
+// A Generator runs a block chain of the develop network in a temporary
+// directory and produces its blocks with the block template generator, the
+// validators taking the slots in turn like in the solo consensus.  The block
+// times are derived from the slots rather than the clock, and the
+// transactions are signed deterministically, so two generators with the same
+// configuration produce the same blocks, which is what the fork and
+// reorganization scenarios rely on.
+//
+// The package imports the block chain and the mining packages, so it may be
+// used by their external test packages and by the tests of the packages
+// built on them, like the mempool and the netsync ones.
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/blockchain/syscontract"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/consensus/solo"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/database"
+	"github.com/AsimovNetwork/asimov/database/dbdriver"
+	"github.com/AsimovNetwork/asimov/database/dbimpl/ethdb"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+const (
+	// dbType is the type of the block database of the generated chains.
+	dbType = "ffldb"
+
+	// blockInterval is the interval, in milliseconds, the block template
+	// generator is given to produce a block.  It is far longer than the
+	// slots so the time outs of the generator never drop transactions,
+	// which would make the blocks depend on the speed of the machine.
+	blockInterval = 10 * 60 * 1000
+)
+
+// MixFunc queues the transactions of the block at the passed height before
+// the generator produces it.
+type MixFunc func(g *Generator, height int32) error
+
+// Config is the configuration of a generator.
+type Config struct {
+	// Keys are the hex encoded private keys of the validators, which
+	// produce the blocks in turn, one slot each.  It defaults to the first
+	// developer key.
+	Keys []string
+
+	// ChainStartTime is the time of the genesis slot.  It defaults to the
+	// time of the genesis block.
+	ChainStartTime int64
+
+	// GenesisFile is the file of the develop network genesis block.  It
+	// defaults to the one of the repository.
+	GenesisFile string
+
+	// GasPrice is the price the generated transactions pay for their gas.
+	// It defaults to the default minimum transaction price.
+	GasPrice float64
+
+	// Mix, when set, queues the transactions of each generated block.
+	Mix MixFunc
+}
+
+// Generator produces a valid block chain.  It is not safe for concurrent
+// access.
+type Generator struct {
+	cfg      Config
+	dir      string
+	db       database.Database
+	stateDB  *ethdb.LDBDatabase
+	chain    *blockchain.BlockChain
+	tmpl     *mining.BlkTmplGenerator
+	accounts []*crypto.Account
+
+	// scripts maps the pay-to-address scripts of the validators to their
+	// index.
+	scripts map[string]int
+
+	// blocks is the main chain, from the genesis block on.
+	blocks []*asiutil.Block
+
+	// skip is the number of slots to leave empty before the next block.
+	skip int
+
+	coins   []*Coin
+	pending *txSource
+}
+
+// New returns a generator of a block chain made of the genesis block of the
+// develop network only.  It sets the active network parameters to the ones
+// of the generated chain, and the configuration to one allowing empty rounds
+// when none is set.  The generator must be closed once done.
+func New(cfg *Config) (*Generator, error) {
+	g := &Generator{
+		cfg:     *cfg,
+		scripts: make(map[string]int),
+		pending: newTxSource(),
+	}
+	if len(g.cfg.Keys) == 0 {
+		g.cfg.Keys = chaincfg.DevKeys[:1]
+	}
+	if g.cfg.GenesisFile == "" {
+		_, file, _, ok := runtime.Caller(0)
+		if !ok {
+			return nil, errors.New("unable to locate the genesis block")
+		}
+		g.cfg.GenesisFile = filepath.Join(filepath.Dir(file), "..",
+			"genesisbin", "devnet.block")
+	}
+	if g.cfg.GasPrice == 0 {
+		g.cfg.GasPrice = chaincfg.DefaultMinTxPrice
+	}
+
+	addrs := make([]*common.Address, len(g.cfg.Keys))
+	for i, key := range g.cfg.Keys {
+		acc, err := crypto.NewAccount(key)
+		if err != nil {
+			return nil, fmt.Errorf("validator key %d: %v", i, err)
+		}
+		pkScript, err := txscript.PayToAddrScript(acc.Address)
+		if err != nil {
+			return nil, err
+		}
+		g.accounts = append(g.accounts, acc)
+		g.scripts[string(pkScript)] = i
+		addrs[i] = acc.Address
+	}
+
+	genesis, err := asiutil.LoadBlockFromFile(g.cfg.GenesisFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the genesis block: %v", err)
+	}
+	params := chaincfg.DevelopNetParams
+	if hash := genesis.Header.BlockHash(); hash != *params.GenesisHash {
+		return nil, fmt.Errorf("genesis block %v is not the one of the "+
+			"develop network", hash)
+	}
+	params.GenesisBlock = genesis
+	params.ChainStartTime = g.cfg.ChainStartTime
+	if params.ChainStartTime == 0 {
+		params.ChainStartTime = genesis.Header.Timestamp
+	}
+	chaincfg.ActiveNetParams.Params = &params
+	if chaincfg.Cfg == nil {
+		chaincfg.Cfg = &chaincfg.FConfig{EmptyRound: true}
+	}
+
+	g.dir, err = ioutil.TempDir("", "testutil")
+	if err != nil {
+		return nil, err
+	}
+	g.db, err = dbdriver.Create(dbType,
+		filepath.Join(g.dir, "blocks_"+dbType), params.Net)
+	if err != nil {
+		g.Close()
+		return nil, err
+	}
+	g.stateDB, err = ethdb.NewLDBDatabase(filepath.Join(g.dir, "state"), 16, 16)
+	if err != nil {
+		g.Close()
+		return nil, err
+	}
+	g.chain, err = blockchain.New(&blockchain.Config{
+		DB:              g.db,
+		ChainParams:     &params,
+		TimeSource:      blockchain.NewMedianTime(),
+		StateDB:         g.stateDB,
+		RoundManager:    solo.NewRoundManager(addrs),
+		ContractManager: syscontract.NewContractManager(),
+	}, nil)
+	if err != nil {
+		g.Close()
+		return nil, err
+	}
+
+	policy := mining.Policy{
+		BlockProductedTimeOut: chaincfg.DefaultBlockProductedTimeOut,
+		TxConnectTimeOut:      chaincfg.DefaultTxConnectTimeOut,
+		UtxoValidateTimeOut:   chaincfg.DefaultUtxoValidateTimeOut,
+	}
+	g.tmpl = mining.NewBlkTmplGenerator(&policy, g.pending, noSigSource{},
+		g.chain, nil)
+
+	if err := g.sync(); err != nil {
+		g.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// Close closes the databases of the generator and removes its directory.
+func (g *Generator) Close() {
+	if g.db != nil {
+		g.db.Close()
+	}
+	if g.stateDB != nil {
+		g.stateDB.Close()
+	}
+	os.RemoveAll(g.dir)
+}
+
+// Chain returns the block chain of the generator.
+func (g *Generator) Chain() *blockchain.BlockChain {
+	return g.chain
+}
+
+// DB returns the block database of the generator.
+func (g *Generator) DB() database.Database {
+	return g.db
+}
+
+// Accounts returns the accounts of the validators.
+func (g *Generator) Accounts() []*crypto.Account {
+	return g.accounts
+}
+
+// Blocks returns the main chain, from the genesis block on, so the block at
+// a height is the one at the same index.
+func (g *Generator) Blocks() []*asiutil.Block {
+	return g.blocks
+}
+
+// Tip returns the last block of the main chain.
+func (g *Generator) Tip() *asiutil.Block {
+	return g.blocks[len(g.blocks)-1]
+}
+
+// Skip leaves the next passed number of slots empty.
+func (g *Generator) Skip(slots int) {
+	g.skip += slots
+}
+
+// nextSlot returns the round and the slot of the next block.
+func (g *Generator) nextSlot() (uint32, uint16) {
+	best := g.chain.BestSnapshot()
+	roundSize := int64(chaincfg.ActiveNetParams.RoundSize)
+	round, slot := int64(best.Round), int64(best.SlotIndex)
+	if round == 0 {
+		round, slot = 1, -1
+	}
+	slot += 1 + int64(g.skip)
+	return uint32(round + slot/roundSize), uint16(slot % roundSize)
+}
+
+// NextBlock produces the block of the next slot, including the transactions
+// queued, and connects it to the main chain.
+func (g *Generator) NextBlock() (*asiutil.Block, error) {
+	height := g.Tip().Height() + 1
+	if g.cfg.Mix != nil {
+		if err := g.cfg.Mix(g, height); err != nil {
+			return nil, err
+		}
+	}
+
+	round, slot := g.nextSlot()
+	account := g.accounts[int(slot)%len(g.accounts)]
+	blockTime, err := g.chain.SlotTime(round, slot)
+	if err != nil {
+		return nil, err
+	}
+	template, err := g.tmpl.ProduceNewBlock(account, common.GasFloor,
+		common.GasCeil, blockTime, round, slot, blockInterval)
+	if err != nil {
+		return nil, fmt.Errorf("unable to produce block %d: %v", height, err)
+	}
+	isMain, _, err := g.chain.ProcessBlock(template.Block, template.VBlock,
+		template.Receipts, template.Logs, common.BFFastAdd)
+	if err != nil {
+		return nil, fmt.Errorf("block %d rejected: %v", height, err)
+	}
+	if !isMain {
+		return nil, fmt.Errorf("block %d is not in the main chain", height)
+	}
+	g.skip = 0
+	if err := g.sync(); err != nil {
+		return nil, err
+	}
+	return template.Block, nil
+}
+
+// Generate produces the passed number of blocks.
+func (g *Generator) Generate(n int) ([]*asiutil.Block, error) {
+	blocks := make([]*asiutil.Block, 0, n)
+	for i := 0; i < n; i++ {
+		block, err := g.NextBlock()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// Process processes the passed blocks, in order, like blocks received from
+// the network, and follows the main chain when they reorganize it.  It fails
+// on the first block rejected or orphaned.
+func (g *Generator) Process(blocks ...*asiutil.Block) error {
+	for _, block := range blocks {
+		_, isOrphan, err := g.chain.ProcessBlock(
+			asiutil.NewBlock(block.MsgBlock()), nil, nil, nil, common.BFNone)
+		if err != nil {
+			return fmt.Errorf("block %v rejected: %v", block.Hash(), err)
+		}
+		if isOrphan {
+			return fmt.Errorf("block %v is an orphan", block.Hash())
+		}
+	}
+	return g.sync()
+}
+
+// Fork returns a new generator with the same configuration whose chain is
+// the main chain of this one up to the passed height.  The blocks it
+// produces from there on fork the chain of this one when they differ, which
+// takes skipping a slot or other transactions since the generation is
+// deterministic.
+func (g *Generator) Fork(height int32) (*Generator, error) {
+	if height < 0 || int(height) >= len(g.blocks) {
+		return nil, fmt.Errorf("no block at height %d to fork from", height)
+	}
+	fork, err := New(&g.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := fork.Process(g.blocks[1 : height+1]...); err != nil {
+		fork.Close()
+		return nil, err
+	}
+	return fork, nil
+}
+
+// sync follows the main chain of the block chain.  The coins of the
+// validators are replayed from the genesis block when it reorganized.
+func (g *Generator) sync() error {
+	n := len(g.blocks)
+	for n > 0 && !g.chain.MainChainHasBlock(g.blocks[n-1].Hash()) {
+		n--
+	}
+	if n < len(g.blocks) {
+		g.blocks = g.blocks[:n]
+		g.coins = nil
+		for _, block := range g.blocks {
+			g.apply(block)
+		}
+	}
+
+	best := g.chain.BestSnapshot()
+	for height := int32(len(g.blocks)); height <= best.Height; height++ {
+		block, err := g.chain.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		g.blocks = append(g.blocks, block)
+		g.apply(block)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/chaincfg"
+)
+
+// TestGeneratorDeterministic ensures two generators with the same
+// configuration produce the same blocks, the validators taking the slots in
+// turn and the payments of the mix being mined.
+func TestGeneratorDeterministic(t *testing.T) {
+	cfg := &Config{
+		Keys: chaincfg.DevKeys[:3],
+		Mix:  PaymentMix(2, 100000),
+	}
+	var hashes [2][]string
+	for i := range hashes {
+		g, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		blocks, err := g.Generate(6)
+		if err != nil {
+			g.Close()
+			t.Fatalf("Generate: %v", err)
+		}
+		for j, block := range blocks {
+			header := &block.MsgBlock().Header
+			want := g.Accounts()[int(header.SlotIndex)%3].Address
+			if header.CoinBase != *want {
+				t.Errorf("block %d produced by %v, want %v", j+1,
+					header.CoinBase.String(), want.String())
+			}
+			hashes[i] = append(hashes[i], block.Hash().String())
+		}
+		if n := len(g.Tip().Transactions()); n != 3 {
+			t.Errorf("tip has %d transactions, want 3", n)
+		}
+		g.Close()
+	}
+	for i := range hashes[0] {
+		if hashes[0][i] != hashes[1][i] {
+			t.Fatalf("block %d is %s then %s", i+1, hashes[0][i], hashes[1][i])
+		}
+	}
+}
+
+// TestGeneratorDeploy ensures a contract creation is mined.
+func TestGeneratorDeploy(t *testing.T) {
+	g, err := New(&Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(2); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	tx, _, err := g.Deploy(0, 0, "missing", nil, 1000000)
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	block, err := g.NextBlock()
+	if err != nil {
+		t.Fatalf("NextBlock: %v", err)
+	}
+	for _, mined := range block.Transactions() {
+		if *mined.Hash() == *tx.Hash() {
+			return
+		}
+	}
+	t.Fatalf("creation %v not mined", tx.Hash())
+}
+
+// TestGeneratorReorg ensures the blocks of a longer fork reorganize the
+// chain of a generator.
+func TestGeneratorReorg(t *testing.T) {
+	g, err := New(&Config{Mix: PaymentMix(1, 100000)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(4); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	fork, err := g.Fork(2)
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	defer fork.Close()
+	fork.Skip(1)
+	blocks, err := fork.Generate(3)
+	if err != nil {
+		t.Fatalf("Generate fork: %v", err)
+	}
+	if *blocks[0].Hash() == *g.Blocks()[3].Hash() {
+		t.Fatalf("fork block 3 is the block of the chain")
+	}
+
+	if err := g.Process(blocks...); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if *g.Tip().Hash() != *fork.Tip().Hash() {
+		t.Fatalf("tip %v, want the fork tip %v", g.Tip().Hash(), fork.Tip().Hash())
+	}
+	if len(g.Blocks()) != 6 {
+		t.Fatalf("chain has %d blocks, want 6", len(g.Blocks()))
+	}
+	if _, err := g.NextBlock(); err != nil {
+		t.Fatalf("NextBlock after reorganization: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AsimovNetwork/asimov/asiutil"
+	"github.com/AsimovNetwork/asimov/blockchain"
+	"github.com/AsimovNetwork/asimov/chaincfg"
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/mining"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/txscript"
+)
+
+// sigSizeSlack is the number of bytes a signature of an input may grow by
+// when the transaction is signed again once its fee is known.
+const sigSizeSlack = 3
+
+// Coin is an output of the main chain paying a validator.
+type Coin struct {
+	OutPoint  protos.OutPoint
+	Validator int
+	Asset     protos.Asset
+	Amount    int64
+	Height    int32
+	Coinbase  bool
+}
+
+// txSource is the source of the transactions of the block template
+// generator.  It returns the queued transactions in the order they were
+// queued.
+type txSource struct {
+	descs  mining.TxDescList
+	spends map[protos.OutPoint]struct{}
+}
+
+func newTxSource() *txSource {
+	return &txSource{spends: make(map[protos.OutPoint]struct{})}
+}
+
+// TxDescs returns the queued transactions.
+func (s *txSource) TxDescs() mining.TxDescList {
+	descs := make(mining.TxDescList, len(s.descs))
+	copy(descs, s.descs)
+	return descs
+}
+
+// UpdateForbiddenTxs drops the passed transactions, which may not be mined.
+func (s *txSource) UpdateForbiddenTxs(txHashes []*common.Hash, height int64) {
+	for _, hash := range txHashes {
+		s.remove(hash)
+	}
+}
+
+// push queues the passed transaction.
+func (s *txSource) push(desc *mining.TxDesc) {
+	s.descs = append(s.descs, desc)
+	for _, txIn := range desc.Tx.MsgTx().TxIn {
+		s.spends[txIn.PreviousOutPoint] = struct{}{}
+	}
+}
+
+// remove drops the queued transaction with the passed hash, if any.
+func (s *txSource) remove(hash *common.Hash) {
+	for i, desc := range s.descs {
+		if *desc.Tx.Hash() != *hash {
+			continue
+		}
+		for _, txIn := range desc.Tx.MsgTx().TxIn {
+			delete(s.spends, txIn.PreviousOutPoint)
+		}
+		s.descs = append(s.descs[:i], s.descs[i+1:]...)
+		return
+	}
+}
+
+// noSigSource is a signature source without signatures.
+type noSigSource struct{}
+
+// MiningDescs returns no signature.
+func (noSigSource) MiningDescs(height int32) []*asiutil.BlockSign {
+	return nil
+}
+
+// apply updates the coins of the validators and the queued transactions with
+// the passed block of the main chain.
+func (g *Generator) apply(block *asiutil.Block) {
+	for _, tx := range block.Transactions() {
+		g.pending.remove(tx.Hash())
+		for _, txIn := range tx.MsgTx().TxIn {
+			for i, coin := range g.coins {
+				if coin.OutPoint == txIn.PreviousOutPoint {
+					g.coins = append(g.coins[:i], g.coins[i+1:]...)
+					break
+				}
+			}
+		}
+		coinbase := blockchain.IsCoinBase(tx)
+		for i, txOut := range tx.MsgTx().TxOut {
+			validator, ok := g.scripts[string(txOut.PkScript)]
+			if !ok || txOut.Value <= 0 {
+				continue
+			}
+			g.coins = append(g.coins, &Coin{
+				OutPoint:  *protos.NewOutPoint(tx.Hash(), uint32(i)),
+				Validator: validator,
+				Asset:     txOut.Asset,
+				Amount:    txOut.Value,
+				Height:    block.Height(),
+				Coinbase:  coinbase,
+			})
+		}
+	}
+}
+
+// Coins returns the asim coins of the passed validator which may be spent in
+// the next block and are not spent by a queued transaction, oldest first.
+func (g *Generator) Coins(validator int) []*Coin {
+	next := g.Tip().Height() + 1
+	maturity := int32(chaincfg.ActiveNetParams.CoinbaseMaturity)
+	var coins []*Coin
+	for _, coin := range g.coins {
+		if coin.Validator != validator || coin.Asset != asiutil.AsimovAsset ||
+			coin.Coinbase && next-coin.Height < maturity {
+			continue
+		}
+		if _, ok := g.pending.spends[coin.OutPoint]; ok {
+			continue
+		}
+		coins = append(coins, coin)
+	}
+	return coins
+}
+
+// Spend queues a transaction of the passed validator paying the passed
+// outputs.  It spends the oldest coins of the validator covering the asim
+// outputs and the fee of the transaction, which is the price of the gas of
+// its size plus the passed gas limit, and pays the change back.
+func (g *Generator) Spend(validator int, outs []*protos.TxOut, gasLimit uint32) (*asiutil.Tx, error) {
+	if validator < 0 || validator >= len(g.accounts) {
+		return nil, fmt.Errorf("no validator %d", validator)
+	}
+	account := g.accounts[validator]
+	pkScript, err := txscript.PayToAddrScript(account.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var need int64
+	for _, out := range outs {
+		if out.Asset == asiutil.AsimovAsset {
+			need += out.Value
+		}
+	}
+	mtx := protos.NewMsgTx(protos.TxVersion)
+	for _, out := range outs {
+		mtx.AddTxOut(out)
+	}
+	change := protos.NewTxOut(0, pkScript, asiutil.AsimovAsset)
+	mtx.AddTxOut(change)
+
+	var total int64
+	for _, coin := range g.Coins(validator) {
+		mtx.AddTxIn(protos.NewTxIn(&coin.OutPoint, nil))
+		total += coin.Amount
+		if err := sign(mtx, pkScript, account); err != nil {
+			return nil, err
+		}
+		size := mtx.SerializeSize() + len(mtx.TxIn)*sigSizeSlack
+		gas := uint32(size*common.GasPerByte) + gasLimit
+		fee := int64(math.Ceil(float64(gas) * g.cfg.GasPrice))
+		if total < need+fee {
+			continue
+		}
+
+		change.Value = total - need - fee
+		if change.Value == 0 {
+			mtx.TxOut = mtx.TxOut[:len(mtx.TxOut)-1]
+		}
+		mtx.TxContract.GasLimit = gas
+		if err := sign(mtx, pkScript, account); err != nil {
+			return nil, err
+		}
+		tx := asiutil.NewTx(mtx)
+		g.pending.push(&mining.TxDesc{
+			Tx:       tx,
+			Added:    time.Unix(g.Tip().MsgBlock().Header.Timestamp, 0),
+			Height:   g.Tip().Height(),
+			Fee:      fee,
+			FeeList:  &map[protos.Asset]int64{asiutil.AsimovAsset: fee},
+			GasPrice: float64(fee) / float64(gas),
+		})
+		return tx, nil
+	}
+	return nil, fmt.Errorf("validator %d has %d spendable, short of the %d "+
+		"to spend", validator, total, need)
+}
+
+// sign signs all the inputs of the passed transaction, which spend outputs
+// of the passed account.
+func sign(mtx *protos.MsgTx, pkScript []byte, account *crypto.Account) error {
+	getKey := txscript.KeyClosure(func(common.IAddress) (*crypto.PrivateKey, bool, error) {
+		return &account.PrivateKey, true, nil
+	})
+	for i := range mtx.TxIn {
+		sigScript, err := txscript.SignTxOutput(mtx, i, pkScript,
+			txscript.SigHashAll, getKey, nil, nil)
+		if err != nil {
+			return err
+		}
+		mtx.TxIn[i].SignatureScript = sigScript
+	}
+	return nil
+}
+
+// Pay queues a transaction of the passed validator paying the passed amount
+// of asim to the passed address.
+func (g *Generator) Pay(validator int, to common.IAddress, amount int64) (*asiutil.Tx, error) {
+	pkScript, err := txscript.PayToAddrScript(to)
+	if err != nil {
+		return nil, err
+	}
+	return g.Spend(validator, []*protos.TxOut{
+		protos.NewTxOut(amount, pkScript, asiutil.AsimovAsset),
+	}, 0)
+}
+
+// Deploy queues a transaction of the passed validator creating a contract
+// from the passed template, and returns it along with the address of the
+// contract.  The passed gas limit is the one of the creation.
+func (g *Generator) Deploy(validator int, category uint16, templateName string,
+	constructor []byte, gasLimit uint32) (*asiutil.Tx, common.Address, error) {
+
+	pkScript, err := txscript.PayToContractScript(txscript.CreateTy.String(), nil)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	out := protos.NewTxOut(0, pkScript, asiutil.AsimovAsset)
+	out.Data = blockchain.EncodeCreateContractData(category, templateName, constructor)
+	tx, err := g.Spend(validator, []*protos.TxOut{out}, gasLimit)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	caller := g.accounts[validator].Address.StandardAddress()
+	addr, err := crypto.CreateContractAddress(caller[:], []byte{},
+		asiutil.GenInputHash(tx.MsgTx()))
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	return tx, addr, nil
+}
+
+// PaymentMix returns a mix in which each validator with a spendable coin
+// pays the passed amount to the next validator, in turn, up to the passed
+// number of payments per block.
+func PaymentMix(payments int, amount int64) MixFunc {
+	return func(g *Generator, height int32) error {
+		n := len(g.accounts)
+		paid := 0
+		for i := 0; i < n && paid < payments; i++ {
+			from := (int(height) + i) % n
+			if len(g.Coins(from)) == 0 {
+				continue
+			}
+			to := g.accounts[(from+1)%n].Address
+			if _, err := g.Pay(from, to, amount); err != nil {
+				return err
+			}
+			paid++
+		}
+		return nil
+	}
+}
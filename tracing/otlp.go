@@ -0,0 +1,132 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// These constants define the status codes of the OTLP spans.
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+// otlpValue is the JSON form of an OTLP AnyValue.  64 bit integers are
+// encoded as strings as required by the OTLP JSON encoding.
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+// otlpTraces is the JSON form of an OTLP ExportTraceServiceRequest.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlpAttributes converts attributes into their OTLP form.
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kv := otlpKeyValue{Key: attr.Key}
+		switch v := attr.Value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			kv.Value.IntValue = &s
+		case float64:
+			kv.Value.DoubleValue = &v
+		default:
+			continue
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+// encodeSpans returns the OTLP/HTTP JSON request exporting the passed ended
+// spans.
+func encodeSpans(serviceName string, resource []Attribute, spans []*Span) ([]byte, error) {
+	resAttrs := append([]Attribute{{Key: "service.name", Value: serviceName}},
+		resource...)
+	scope := otlpScopeSpans{
+		Scope: otlpScope{Name: "github.com/AsimovNetwork/asimov/tracing"},
+		Spans: make([]otlpSpan, 0, len(spans)),
+	}
+	for _, span := range spans {
+		span.mtx.Lock()
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.traceID[:]),
+			SpanID:            hex.EncodeToString(span.spanID[:]),
+			Name:              span.name,
+			Kind:              int(span.kind),
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.attrs),
+			Status:            otlpStatus{Code: otlpStatusUnset},
+		}
+		if span.failed {
+			s.Status = otlpStatus{Code: otlpStatusError, Message: span.err}
+		}
+		span.mtx.Unlock()
+		if span.parentID != (SpanID{}) {
+			s.ParentSpanID = hex.EncodeToString(span.parentID[:])
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+	return json.Marshal(&otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: otlpAttributes(resAttrs)},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, which is the tree of spans of an operation.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// Kind describes the relationship of a span to the remote side of the
+// operation, as defined by OpenTelemetry.
+type Kind int
+
+// These constants define the span kinds used by the node.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attribute is a key value pair describing a span.  The value is a string,
+// bool, int64 or float64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a timed operation of a trace.  The methods of a nil span do
+// nothing, so the instrumented code does not have to check whether tracing
+// is enabled.
+type Span struct {
+	tracer   *Tracer
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	sampled  bool
+
+	name  string
+	kind  Kind
+	start time.Time
+
+	mtx    sync.Mutex
+	end    time.Time
+	attrs  []Attribute
+	err    string
+	failed bool
+	ended  bool
+}
+
+// TraceID returns the identifier of the trace of the span.
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.traceID
+}
+
+// SpanID returns the identifier of the span.
+func (s *Span) SpanID() SpanID {
+	if s == nil {
+		return SpanID{}
+	}
+	return s.spanID
+}
+
+// Sampled returns whether the span is recorded and exported.
+func (s *Span) Sampled() bool {
+	return s != nil && s.sampled
+}
+
+// SetKind sets the kind of the span.  Spans are internal by default.
+func (s *Span) SetKind(kind Kind) {
+	if !s.Sampled() {
+		return
+	}
+	s.mtx.Lock()
+	s.kind = kind
+	s.mtx.Unlock()
+}
+
+// SetAttr adds an attribute to the span.  Integers are recorded as int64 and
+// values other than strings, bools and numbers as their string form.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if !s.Sampled() {
+		return
+	}
+	switch v := value.(type) {
+	case string, bool, int64, float64:
+	case int:
+		value = int64(v)
+	case int32:
+		value = int64(v)
+	case uint32:
+		value = int64(v)
+	case uint64:
+		value = int64(v)
+	case float32:
+		value = float64(v)
+	case fmt.Stringer:
+		value = v.String()
+	default:
+		value = fmt.Sprint(v)
+	}
+	s.mtx.Lock()
+	s.attrs = append(s.attrs, Attribute{Key: key, Value: value})
+	s.mtx.Unlock()
+}
+
+// SetError marks the span as failed with the passed error.  A nil error is
+// ignored.
+func (s *Span) SetError(err error) {
+	if err == nil || !s.Sampled() {
+		return
+	}
+	s.mtx.Lock()
+	s.failed = true
+	s.err = err.Error()
+	s.mtx.Unlock()
+}
+
+// End completes the span and queues it for export.  Only the first call has
+// an effect.
+func (s *Span) End() {
+	if !s.Sampled() {
+		return
+	}
+	s.mtx.Lock()
+	if s.ended {
+		s.mtx.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mtx.Unlock()
+	s.tracer.enqueue(s)
+}
+
+// TraceParent returns the W3C traceparent header value propagating the span
+// to a remote service.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" +
+		hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// RemoteParent returns a span standing for the caller described by the passed
+// W3C traceparent header value, to be used as the parent of the spans serving
+// the call.  The returned span is never exported.  Nil is returned when the
+// value is malformed.
+func RemoteParent(traceParent string) *Span {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return nil
+	}
+	var span Span
+	if n, err := hex.Decode(span.traceID[:], []byte(parts[1])); err != nil ||
+		n != len(span.traceID) || len(parts[1]) != 2*len(span.traceID) {
+		return nil
+	}
+	if n, err := hex.Decode(span.spanID[:], []byte(parts[2])); err != nil ||
+		n != len(span.spanID) || len(parts[2]) != 2*len(span.spanID) {
+		return nil
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return nil
+	}
+	if span.traceID == (TraceID{}) || span.spanID == (SpanID{}) {
+		return nil
+	}
+	span.sampled = flags[0]&1 == 1
+	span.ended = true
+	return &span
+}
+
+// spanKey is the key of the current span in a context.
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of the passed context holding the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span held by the passed context, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpanFromContext starts a span which is a child of the span held by the
+// passed context and returns a copy of the context holding the new span.
+func StartSpanFromContext(ctx context.Context, name string) (context.Context, *Span) {
+	span := StartSpan(name, SpanFromContext(ctx))
+	return ContextWithSpan(ctx, span), span
+}
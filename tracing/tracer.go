@@ -0,0 +1,250 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultServiceName is the service name of the exported spans when
+	// none is configured.
+	defaultServiceName = "asimovd"
+
+	// defaultBatchSize is the default maximum number of spans exported in
+	// a single request.
+	defaultBatchSize = 512
+
+	// defaultQueueSize is the default number of ended spans waiting for
+	// export.  Spans ended while the queue is full are dropped.
+	defaultQueueSize = 4096
+
+	// defaultFlushInterval is the default maximum time an ended span waits
+	// for export.
+	defaultFlushInterval = time.Second * 5
+
+	// exportTimeout is the timeout of an export request.
+	exportTimeout = time.Second * 10
+)
+
+// Config is a descriptor containing the tracer configuration.
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint of the
+	// collector, such as http://127.0.0.1:4318/v1/traces.
+	Endpoint string
+
+	// ServiceName is the service.name resource attribute of the spans.
+	ServiceName string
+
+	// Resource holds additional string resource attributes of the spans,
+	// such as the network of the node.
+	Resource []Attribute
+
+	// SampleRate is the fraction of the traces which are recorded, from 0
+	// to 1.  The children of a span follow the decision of their parent.
+	SampleRate float64
+
+	// BatchSize is the maximum number of spans exported in one request.
+	BatchSize int
+
+	// QueueSize is the number of ended spans waiting for export.
+	QueueSize int
+
+	// FlushInterval is the maximum time an ended span waits for export.
+	FlushInterval time.Duration
+
+	// Client is the HTTP client used to export the spans.  It defaults to
+	// a client with a timeout of 10 seconds.
+	Client *http.Client
+}
+
+// Tracer creates spans and exports them in batches to an OpenTelemetry
+// collector using the OTLP/HTTP JSON encoding.
+type Tracer struct {
+	cfg     Config
+	queue   chan *Span
+	dropped uint64
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New returns a new tracer.  Start must be called to export the spans.
+func New(cfg *Config) *Tracer {
+	c := *cfg
+	if c.ServiceName == "" {
+		c.ServiceName = defaultServiceName
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = defaultFlushInterval
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: exportTimeout}
+	}
+	return &Tracer{
+		cfg:   c,
+		queue: make(chan *Span, c.QueueSize),
+		quit:  make(chan struct{}),
+	}
+}
+
+// Start begins exporting the ended spans.
+func (t *Tracer) Start() {
+	t.wg.Add(1)
+	go t.exportHandler()
+}
+
+// Stop exports the spans waiting in the queue and stops the exports.
+func (t *Tracer) Stop() {
+	close(t.quit)
+	t.wg.Wait()
+}
+
+// Dropped returns the number of spans which were dropped because the export
+// queue was full.
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// StartSpan starts a span with the passed name.  The span is a child of the
+// passed parent, or the root of a new trace when the parent is nil.
+func (t *Tracer) StartSpan(name string, parent *Span) *Span {
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   KindInternal,
+		start:  time.Now(),
+	}
+	if parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = parent.sampled
+	} else {
+		rand.Read(span.traceID[:])
+		span.sampled = t.sample()
+	}
+	rand.Read(span.spanID[:])
+	return span
+}
+
+// sample returns whether a new trace is recorded.
+func (t *Tracer) sample() bool {
+	switch {
+	case t.cfg.SampleRate >= 1:
+		return true
+	case t.cfg.SampleRate <= 0:
+		return false
+	}
+	return mrand.Float64() < t.cfg.SampleRate
+}
+
+// enqueue queues an ended span for export, dropping it when the queue is
+// full rather than slowing down the traced operation.
+func (t *Tracer) enqueue(span *Span) {
+	select {
+	case t.queue <- span:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// exportHandler exports the ended spans in batches, at the latest after the
+// flush interval.  It must be run as a goroutine.
+func (t *Tracer) exportHandler() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			log.Warnf("Unable to export %d spans to %s: %v", len(batch),
+				t.cfg.Endpoint, err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.cfg.BatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-t.quit:
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+				if len(batch) >= t.cfg.BatchSize {
+					flush()
+				}
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// export sends a batch of spans to the collector.
+func (t *Tracer) export(spans []*Span) error {
+	body, err := encodeSpans(t.cfg.ServiceName, t.cfg.Resource, spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// tracer holds the tracer used by StartSpan, nil when tracing is disabled.
+var tracer atomic.Value
+
+// SetTracer sets the tracer used by StartSpan.  A nil tracer disables
+// tracing.
+func SetTracer(t *Tracer) {
+	tracer.Store(t)
+}
+
+// StartSpan starts a span with the tracer set by SetTracer.  It returns nil
+// when tracing is disabled.
+func StartSpan(name string, parent *Span) *Span {
+	t, _ := tracer.Load().(*Tracer)
+	if t == nil {
+		return nil
+	}
+	return t.StartSpan(name, parent)
+}
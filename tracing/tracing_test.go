@@ -0,0 +1,110 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	received := make(chan otlpTraces, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var traces otlpTraces
+		if err := json.NewDecoder(r.Body).Decode(&traces); err != nil {
+			t.Errorf("invalid export request: %v", err)
+		}
+		received <- traces
+	}))
+	defer collector.Close()
+
+	tracer := New(&Config{Endpoint: collector.URL, SampleRate: 1})
+	tracer.Start()
+
+	root := tracer.StartSpan("block", nil)
+	root.SetAttr("height", int32(12))
+	child := tracer.StartSpan("tx", root)
+	child.SetError(errors.New("bad tx"))
+	child.End()
+	root.End()
+	root.End()
+	tracer.Stop()
+
+	traces := <-received
+	if len(traces.ResourceSpans) != 1 || len(traces.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected export %+v", traces)
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	tx, block := spans[0], spans[1]
+	if tx.Name != "tx" || block.Name != "block" {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	if tx.TraceID != block.TraceID || tx.ParentSpanID != block.SpanID || block.ParentSpanID != "" {
+		t.Fatalf("tx span %+v is not a child of block span %+v", tx, block)
+	}
+	if tx.Status.Code != otlpStatusError || tx.Status.Message != "bad tx" {
+		t.Fatalf("unexpected tx span status %+v", tx.Status)
+	}
+	if len(block.Attributes) != 1 || block.Attributes[0].Key != "height" ||
+		block.Attributes[0].Value.IntValue == nil || *block.Attributes[0].Value.IntValue != "12" {
+		t.Fatalf("unexpected block span attributes %+v", block.Attributes)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tracer := New(&Config{SampleRate: 0})
+	root := tracer.StartSpan("root", nil)
+	if root.Sampled() {
+		t.Fatal("span sampled with a sample rate of 0")
+	}
+	if child := tracer.StartSpan("child", root); child.Sampled() || child.TraceID() != root.TraceID() {
+		t.Fatal("child span does not follow the sampling of its parent")
+	}
+	root.End()
+	if len(tracer.queue) != 0 {
+		t.Fatal("span not sampled was queued")
+	}
+
+	// The spans of a disabled tracer are nil and safe to use.
+	SetTracer(nil)
+	ctx, span := StartSpanFromContext(context.Background(), "disabled")
+	span.SetAttr("key", "value")
+	span.SetError(errors.New("error"))
+	span.End()
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Fatal("span started with tracing disabled")
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	tracer := New(&Config{SampleRate: 1})
+	span := tracer.StartSpan("call", nil)
+	parent := RemoteParent(span.TraceParent())
+	if parent == nil || parent.TraceID() != span.TraceID() ||
+		parent.SpanID() != span.SpanID() || !parent.Sampled() {
+		t.Fatalf("traceparent %q not parsed back", span.TraceParent())
+	}
+
+	tests := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	}
+	for _, test := range tests {
+		if RemoteParent(test) != nil {
+			t.Errorf("malformed traceparent %q accepted", test)
+		}
+	}
+}
@@ -83,6 +83,7 @@ type Engine struct {
 	inputAmount     int64
 	asset           *protos.Asset
 	height          int32
+	sigCache        *SigCache
 }
 
 // hasFlag returns whether the script engine instance has the passed flag set.
@@ -634,9 +635,11 @@ func (vm *Engine) SetAltStack(data [][]byte) {
 
 // NewEngine returns a new script engine for the provided public key script,
 // transaction, and input index.  The flags modify the behavior of the script
-// engine according to the description provided by each flag.
+// engine according to the description provided by each flag.  The signatures
+// found in the signature cache are not verified again, and the verified ones
+// are added to it.  The cache may be nil.
 func NewEngine(scriptPubKey []byte, tx *protos.MsgTx, txIdx int, flags ScriptFlags,
-	inputAmount int64, assets *protos.Asset, height int32) (*Engine, error) {
+	inputAmount int64, assets *protos.Asset, height int32, sigCache *SigCache) (*Engine, error) {
 
 	// The provided transaction input index must refer to a valid input.
 	if txIdx < 0 || txIdx >= len(tx.TxIn) {
@@ -664,7 +667,8 @@ func NewEngine(scriptPubKey []byte, tx *protos.MsgTx, txIdx int, flags ScriptFla
 	// Thus, allowing the clean stack flag without the P2SH flag would make
 	// it possible to have a situation where P2SH would not be a soft fork
 	// when it should be.
-	vm := Engine{flags: flags, inputAmount: inputAmount, height: height}
+	vm := Engine{flags: flags, inputAmount: inputAmount, height: height,
+		sigCache: sigCache}
 
 	// The signature script must only contain data pushes when the
 	// associated flag is set.
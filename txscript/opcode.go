@@ -1049,6 +1049,13 @@ func opcodeCheckSig(op *parsedOpcode, vm *Engine) error {
 
 	hash = calcSignatureHash(subScript, hashType, &vm.tx, vm.txIdx)
 
+	// Skip the verification of the signatures already verified, such as
+	// the ones of the transactions admitted to the mempool.
+	if vm.sigCache != nil && vm.sigCache.Exists(hash, pkBytes, sigBytes) {
+		vm.dstack.PushBool(true)
+		return nil
+	}
+
 	pubKey, err := crypto.ParsePubKey(pkBytes, crypto.S256())
 	if err != nil {
 		vm.dstack.PushBool(false)
@@ -1064,6 +1071,9 @@ func opcodeCheckSig(op *parsedOpcode, vm *Engine) error {
 	}
 
 	valid := signature.Verify(hash, pubKey)
+	if valid && vm.sigCache != nil {
+		vm.sigCache.Add(hash, pkBytes, sigBytes)
+	}
 
 	if !valid && vm.hasFlag(ScriptVerifyNullFail) && len(sigBytes) > 0 {
 		str := "signature not empty on failed checksig"
@@ -1227,7 +1237,15 @@ func checkMultiSig(op *parsedOpcode, vm *Engine, numSignatures, numPubKeys int,
 
 		// Generate the signature hash based on the signature hash type.
 		var sHash = calcSignatureHash(script, hashType, &vm.tx, vm.txIdx)
-		valid := parsedSig.Verify(sHash, parsedPubKey)
+		var valid bool
+		if vm.sigCache != nil && vm.sigCache.Exists(sHash, pubKey, signature) {
+			valid = true
+		} else {
+			valid = parsedSig.Verify(sHash, parsedPubKey)
+			if valid && vm.sigCache != nil {
+				vm.sigCache.Add(sHash, pubKey, signature)
+			}
+		}
 		if valid {
 			// PubKey verified, move on to the next signature.
 			signatureIdx++
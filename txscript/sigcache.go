@@ -0,0 +1,96 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// sigCacheKey identifies a valid signature of a signature hash by a public
+// key.  It is the sha256 of the signature hash, the length of the public key,
+// the public key and the signature, so the cache doesn't hold the variable
+// length keys and signatures.
+type sigCacheKey [sha256.Size]byte
+
+// newSigCacheKey returns the key of the passed signature hash, public key and
+// signature.
+func newSigCacheKey(sigHash, pubKey, sig []byte) sigCacheKey {
+	h := sha256.New()
+	h.Write(sigHash)
+	h.Write([]byte{byte(len(pubKey))})
+	h.Write(pubKey)
+	h.Write(sig)
+	var key sigCacheKey
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// SigCache is a bounded cache of the valid signatures, evicting the least
+// recently used one when it is full.  Sharing it between the validation of
+// the transactions admitted to the mempool and the validation of blocks saves
+// verifying the same signatures again when the blocks including these
+// transactions arrive.
+//
+// It is safe for concurrent access.
+type SigCache struct {
+	mtx        sync.Mutex
+	entries    map[sigCacheKey]*list.Element
+	lru        *list.List // Contains sigCacheKey values.
+	maxEntries uint
+}
+
+// NewSigCache returns a signature cache holding at most maxEntries
+// signatures.  Zero disables the cache.
+func NewSigCache(maxEntries uint) *SigCache {
+	return &SigCache{
+		entries:    make(map[sigCacheKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// Exists returns whether the passed signature of the signature hash by the
+// public key was verified and is in the cache, and marks it as the most
+// recently used when it is.
+func (s *SigCache) Exists(sigHash, pubKey, sig []byte) bool {
+	key := newSigCacheKey(sigHash, pubKey, sig)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	elem, ok := s.entries[key]
+	if ok {
+		s.lru.MoveToFront(elem)
+	}
+	return ok
+}
+
+// Add adds the passed signature of the signature hash by the public key to the
+// cache, evicting the least recently used signature when the cache is full.
+// The signature must have been verified.
+func (s *SigCache) Add(sigHash, pubKey, sig []byte) {
+	if s.maxEntries == 0 {
+		return
+	}
+	key := newSigCacheKey(sigHash, pubKey, sig)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(elem)
+		return
+	}
+	if uint(s.lru.Len()) >= s.maxEntries {
+		oldest := s.lru.Back()
+		delete(s.entries, s.lru.Remove(oldest).(sigCacheKey))
+	}
+	s.entries[key] = s.lru.PushFront(key)
+}
+
+// Len returns the number of signatures in the cache.
+func (s *SigCache) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.lru.Len()
+}
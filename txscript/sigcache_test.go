@@ -0,0 +1,50 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"testing"
+)
+
+// TestSigCache ensures the signature cache finds the added signatures and
+// evicts the least recently used ones when full.
+func TestSigCache(t *testing.T) {
+	sigHash := []byte{1, 2, 3}
+	pubKeys := [][]byte{{2, 0xaa}, {2, 0xbb}, {2, 0xcc}}
+	sig := []byte{0x30, 0x01}
+
+	cache := NewSigCache(2)
+	cache.Add(sigHash, pubKeys[0], sig)
+	cache.Add(sigHash, pubKeys[1], sig)
+	if !cache.Exists(sigHash, pubKeys[0], sig) {
+		t.Fatalf("added signature not found")
+	}
+	if cache.Exists(sigHash, pubKeys[0], []byte{0x30, 0x02}) ||
+		cache.Exists([]byte{1, 2, 4}, pubKeys[0], sig) {
+
+		t.Fatalf("signature found with another signature hash or signature")
+	}
+
+	// The second signature is the least recently used since the first one
+	// was looked up, so it is evicted.
+	cache.Add(sigHash, pubKeys[2], sig)
+	if cache.Len() != 2 {
+		t.Fatalf("cache has %d signatures, want 2", cache.Len())
+	}
+	if cache.Exists(sigHash, pubKeys[1], sig) {
+		t.Errorf("least recently used signature not evicted")
+	}
+	if !cache.Exists(sigHash, pubKeys[0], sig) ||
+		!cache.Exists(sigHash, pubKeys[2], sig) {
+
+		t.Errorf("recently used signatures evicted")
+	}
+
+	disabled := NewSigCache(0)
+	disabled.Add(sigHash, pubKeys[0], sig)
+	if disabled.Exists(sigHash, pubKeys[0], sig) {
+		t.Errorf("signature found in a disabled cache")
+	}
+}
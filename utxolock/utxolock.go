@@ -0,0 +1,188 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package utxolock keeps the outputs reserved with the lockunspent RPC, so the
+// external transaction builders sharing a node do not allocate the same output
+// to several transactions across their construction sessions.  A lock is
+// released explicitly, or once a connected block spends its output.
+//
+// The locks may be persisted across restarts.
+package utxolock
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// lockEntry is the persisted form of a locked output.
+type lockEntry struct {
+	TxID string `json:"txid"`
+	Vout uint32 `json:"vout"`
+}
+
+// Set is a set of locked outputs.
+//
+// All methods are safe for concurrent access.
+type Set struct {
+	mtx    sync.Mutex
+	file   string
+	locked map[protos.OutPoint]struct{}
+}
+
+// New returns an empty set persisted to the passed file, or not persisted when
+// the file is empty.
+func New(file string) *Set {
+	return &Set{
+		file:   file,
+		locked: make(map[protos.OutPoint]struct{}),
+	}
+}
+
+// Load loads the locked outputs from the file of the set.  A missing file is
+// not an error.
+func (s *Set) Load() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []lockEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	locked := make(map[protos.OutPoint]struct{}, len(entries))
+	for _, e := range entries {
+		hash, err := hex.DecodeString(e.TxID)
+		if err != nil || len(hash) != common.HashLength {
+			return fmt.Errorf("invalid locked output txid %q", e.TxID)
+		}
+		locked[protos.OutPoint{Hash: common.BytesToHash(hash), Index: e.Vout}] = struct{}{}
+	}
+	s.mtx.Lock()
+	s.locked = locked
+	s.mtx.Unlock()
+	return nil
+}
+
+// Save writes the locked outputs to the file of the set.  The file is written
+// under a temporary name and renamed once complete.  It does nothing when the
+// set is not persisted.
+func (s *Set) Save() error {
+	if s.file == "" {
+		return nil
+	}
+	outs := s.List()
+	entries := make([]lockEntry, 0, len(outs))
+	for _, out := range outs {
+		entries = append(entries, lockEntry{TxID: out.Hash.String(), Vout: out.Index})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Lock locks the passed outputs.  No output is locked when one of them is
+// already locked.
+func (s *Set) Lock(outs []protos.OutPoint) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, out := range outs {
+		if _, ok := s.locked[out]; ok {
+			return fmt.Errorf("output %v is already locked", out)
+		}
+	}
+	for _, out := range outs {
+		s.locked[out] = struct{}{}
+	}
+	return nil
+}
+
+// Unlock unlocks the passed outputs.  No output is unlocked when one of them
+// is not locked.
+func (s *Set) Unlock(outs []protos.OutPoint) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, out := range outs {
+		if _, ok := s.locked[out]; !ok {
+			return fmt.Errorf("output %v is not locked", out)
+		}
+	}
+	for _, out := range outs {
+		delete(s.locked, out)
+	}
+	return nil
+}
+
+// UnlockAll unlocks all the outputs.
+func (s *Set) UnlockAll() {
+	s.mtx.Lock()
+	s.locked = make(map[protos.OutPoint]struct{})
+	s.mtx.Unlock()
+}
+
+// Spent releases the locks of the passed outputs spent by a connected block.
+// It returns whether a lock was released.
+func (s *Set) Spent(outs []protos.OutPoint) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	released := false
+	for _, out := range outs {
+		if _, ok := s.locked[out]; ok {
+			delete(s.locked, out)
+			released = true
+		}
+	}
+	return released
+}
+
+// IsLocked returns whether an output is locked.
+func (s *Set) IsLocked(out protos.OutPoint) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, ok := s.locked[out]
+	return ok
+}
+
+// List returns the locked outputs sorted by outpoint.
+func (s *Set) List() []protos.OutPoint {
+	s.mtx.Lock()
+	outs := make([]protos.OutPoint, 0, len(s.locked))
+	for out := range s.locked {
+		outs = append(outs, out)
+	}
+	s.mtx.Unlock()
+
+	sort.Slice(outs, func(i, j int) bool {
+		if c := bytes.Compare(outs[i].Hash[:], outs[j].Hash[:]); c != 0 {
+			return c < 0
+		}
+		return outs[i].Index < outs[j].Index
+	})
+	return outs
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package utxolock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// TestSet ensures the outputs are locked and unlocked atomically, released
+// when spent and persisted across restarts.
+func TestSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utxolock")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "lockunspent.json")
+
+	a := protos.OutPoint{Hash: common.Hash{1}, Index: 0}
+	b := protos.OutPoint{Hash: common.Hash{1}, Index: 1}
+	c := protos.OutPoint{Hash: common.Hash{2}, Index: 0}
+
+	set := New(file)
+	if err := set.Load(); err != nil {
+		t.Fatalf("Load of a missing file: %v", err)
+	}
+	if err := set.Lock([]protos.OutPoint{b, a}); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := set.Lock([]protos.OutPoint{c, a}); err == nil {
+		t.Fatal("Lock: locked an output twice")
+	}
+	if set.IsLocked(c) {
+		t.Fatal("Lock: locked an output of a failed call")
+	}
+	if err := set.Unlock([]protos.OutPoint{a, c}); err == nil {
+		t.Fatal("Unlock: unlocked an output which is not locked")
+	}
+	if !set.IsLocked(a) {
+		t.Fatal("Unlock: unlocked an output of a failed call")
+	}
+
+	if err := set.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	set = New(file)
+	if err := set.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := set.List(); !reflect.DeepEqual(got, []protos.OutPoint{a, b}) {
+		t.Fatalf("List: got %v", got)
+	}
+
+	if !set.Spent([]protos.OutPoint{c, b}) || set.Spent([]protos.OutPoint{c}) {
+		t.Fatal("Spent: unexpected result")
+	}
+	if err := set.Unlock([]protos.OutPoint{a}); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got := set.List(); len(got) != 0 {
+		t.Fatalf("List: got %v", got)
+	}
+
+	// A set which is not persisted ignores Load and Save.
+	set = New("")
+	set.Lock([]protos.OutPoint{a})
+	if err := set.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	set.UnlockAll()
+	if set.IsLocked(a) {
+		t.Fatal("UnlockAll: output still locked")
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package abi
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/common/hexutil"
+)
+
+// ParseArguments converts the values decoded from JSON to the Go types of the
+// arguments, so they can be packed.  Integers are given as decimal or 0x
+// prefixed hexadecimal strings, or as JSON numbers when they are exactly
+// representable, addresses and bytes as 0x prefixed hexadecimal strings, and
+// arrays and slices as JSON arrays.  Tuples are not supported.
+func ParseArguments(arguments Arguments, values []interface{}) ([]interface{}, error) {
+	if len(values) != len(arguments) {
+		return nil, fmt.Errorf("abi: got %d values, want %d", len(values), len(arguments))
+	}
+	parsed := make([]interface{}, len(values))
+	for i, arg := range arguments {
+		v, err := parseValue(arg.Type, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("abi: argument %d (%s): %v", i, arg.Name, err)
+		}
+		parsed[i] = v.Interface()
+	}
+	return parsed, nil
+}
+
+// parseValue converts a value decoded from JSON to the Go type of t.
+func parseValue(t Type, v interface{}) (reflect.Value, error) {
+	switch t.T {
+	case IntTy, UintTy:
+		n, err := parseInteger(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if t.T == UintTy && n.Sign() < 0 {
+			return reflect.Value{}, fmt.Errorf("negative value for %v", t)
+		}
+		bits := t.Size
+		if t.T == IntTy {
+			bits--
+		}
+		if n.BitLen() > bits {
+			return reflect.Value{}, fmt.Errorf("value out of range for %v", t)
+		}
+		if t.Type == bigT {
+			return reflect.ValueOf(n), nil
+		}
+		val := reflect.New(t.Type).Elem()
+		if t.T == IntTy {
+			val.SetInt(n.Int64())
+		} else {
+			val.SetUint(n.Uint64())
+		}
+		return val, nil
+
+	case BoolTy:
+		switch b := v.(type) {
+		case bool:
+			return reflect.ValueOf(b), nil
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(parsed), nil
+		}
+
+	case StringTy:
+		if s, ok := v.(string); ok {
+			return reflect.ValueOf(s), nil
+		}
+
+	case AddressTy:
+		b, err := parseBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if len(b) != common.AddressLength {
+			return reflect.Value{}, fmt.Errorf("address of %d bytes", len(b))
+		}
+		return reflect.ValueOf(common.BytesToAddress(b)), nil
+
+	case BytesTy:
+		b, err := parseBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(b), nil
+
+	case FixedBytesTy:
+		b, err := parseBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if len(b) != t.Size {
+			return reflect.Value{}, fmt.Errorf("%d bytes for %v", len(b), t)
+		}
+		val := reflect.New(t.Type).Elem()
+		reflect.Copy(val, reflect.ValueOf(b))
+		return val, nil
+
+	case SliceTy, ArrayTy:
+		elems, ok := v.([]interface{})
+		if !ok {
+			break
+		}
+		var val reflect.Value
+		if t.T == SliceTy {
+			val = reflect.MakeSlice(t.Type, len(elems), len(elems))
+		} else {
+			if len(elems) != t.Size {
+				return reflect.Value{}, fmt.Errorf("%d elements for %v", len(elems), t)
+			}
+			val = reflect.New(t.Type).Elem()
+		}
+		for i, elem := range elems {
+			e, err := parseValue(*t.Elem, elem)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			val.Index(i).Set(e)
+		}
+		return val, nil
+
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %v", t)
+	}
+	return reflect.Value{}, fmt.Errorf("invalid value %v for %v", v, t)
+}
+
+// FormatValues converts the values unpacked for the arguments to values which
+// encode to JSON the way ParseArguments parses them back, so integers are not
+// truncated by JSON clients.
+func FormatValues(arguments Arguments, values []interface{}) []interface{} {
+	formatted := make([]interface{}, len(values))
+	for i, arg := range arguments.NonIndexed() {
+		if i == len(values) {
+			break
+		}
+		formatted[i] = formatValue(arg.Type, reflect.ValueOf(values[i]))
+	}
+	return formatted
+}
+
+// formatValue converts a value of the Go type of t to a value encoding to
+// JSON as ParseArguments parses it.
+func formatValue(t Type, v reflect.Value) interface{} {
+	switch t.T {
+	case IntTy:
+		if t.Type == bigT {
+			return v.Interface().(*big.Int).String()
+		}
+		return strconv.FormatInt(v.Int(), 10)
+	case UintTy:
+		if t.Type == bigT {
+			return v.Interface().(*big.Int).String()
+		}
+		return strconv.FormatUint(v.Uint(), 10)
+	case AddressTy:
+		return hexutil.Encode(v.Interface().(common.Address).Bytes())
+	case BytesTy:
+		return hexutil.Encode(v.Bytes())
+	case FixedBytesTy, HashTy, FunctionTy:
+		return hexutil.Encode(mustArrayToByteSlice(v).Bytes())
+	case SliceTy, ArrayTy:
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elems[i] = formatValue(*t.Elem, v.Index(i))
+		}
+		return elems
+	case TupleTy:
+		fields := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[t.TupleRawNames[i]] = formatValue(*elem, v.Field(i))
+		}
+		return fields
+	}
+	return v.Interface()
+}
+
+// parseInteger converts an integer given as a string or a JSON number.
+func parseInteger(v interface{}) (*big.Int, error) {
+	switch n := v.(type) {
+	case string:
+		parsed, ok := new(big.Int).SetString(n, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", n)
+		}
+		return parsed, nil
+	case float64:
+		// JSON numbers above 2^53 may have lost their precision.
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return nil, fmt.Errorf("inexact integer %v, use a string", n)
+		}
+		return big.NewInt(int64(n)), nil
+	}
+	return nil, fmt.Errorf("invalid integer %v", v)
+}
+
+// parseBytes converts bytes given as a 0x prefixed hexadecimal string.
+func parseBytes(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid bytes %v", v)
+	}
+	return hexutil.Decode(s)
+}
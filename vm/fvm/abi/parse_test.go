@@ -0,0 +1,103 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package abi
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+)
+
+const parseTestABI = `[{"type":"constructor","inputs":[
+	{"name":"supply","type":"uint256"},
+	{"name":"decimals","type":"uint8"},
+	{"name":"offset","type":"int64"},
+	{"name":"owner","type":"address"},
+	{"name":"mintable","type":"bool"},
+	{"name":"name","type":"string"},
+	{"name":"salt","type":"bytes4"},
+	{"name":"data","type":"bytes"},
+	{"name":"limits","type":"uint32[]"},
+	{"name":"pair","type":"int16[2]"}]}]`
+
+// TestParseArguments ensures the values decoded from JSON pack the same way
+// as the native Go values.
+func TestParseArguments(t *testing.T) {
+	abi, err := JSON(strings.NewReader(parseTestABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := common.HexToAddress("0x66aabbccddeeff00112233445566778899aabbccdd")
+	supply, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	want, err := abi.Pack("", supply, uint8(18), int64(-5), owner, true, "token",
+		[4]byte{1, 2, 3, 4}, []byte{0xca, 0xfe}, []uint32{1, 2, 3}, [2]int16{-1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := []interface{}{"1000000000000000000000000", float64(18), "-0x5",
+		"0x66aabbccddeeff00112233445566778899aabbccdd", "true", "token",
+		"0x01020304", "0xcafe", []interface{}{"1", float64(2), "0x3"},
+		[]interface{}{float64(-1), "1"}}
+	args, err := ParseArguments(abi.Constructor.Inputs, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := abi.Pack("", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("packed %x, want %x", got, want)
+	}
+
+	// The unpacked values are formatted back to equivalent values.
+	unpacked, err := abi.Constructor.Inputs.UnpackValues(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := FormatValues(abi.Constructor.Inputs, unpacked)
+	args, err = ParseArguments(abi.Constructor.Inputs, formatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = abi.Pack("", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("formatted values packed %x, want %x", got, want)
+	}
+	if formatted[0] != "1000000000000000000000000" || formatted[2] != "-5" {
+		t.Fatalf("formatted integers %v and %v", formatted[0], formatted[2])
+	}
+
+	tests := []struct {
+		name  string
+		index int
+		value interface{}
+	}{
+		{"overflow", 1, "256"},
+		{"negative unsigned", 0, "-1"},
+		{"inexact number", 0, float64(1 << 60)},
+		{"short address", 3, "0x66aabb"},
+		{"fixed bytes size", 6, "0x0102"},
+		{"array length", 9, []interface{}{"1"}},
+		{"not a string", 5, float64(1)},
+	}
+	for _, test := range tests {
+		invalid := append([]interface{}(nil), values...)
+		invalid[test.index] = test.value
+		if _, err := ParseArguments(abi.Constructor.Inputs, invalid); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+	if _, err := ParseArguments(abi.Constructor.Inputs, values[1:]); err == nil {
+		t.Error("missing argument: no error")
+	}
+}
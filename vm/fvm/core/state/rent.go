@@ -0,0 +1,212 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/vm/fvm/core/vm"
+	"github.com/AsimovNetwork/asimov/vm/fvm/rlp"
+	"github.com/AsimovNetwork/asimov/vm/fvm/trie"
+)
+
+// emptyRoot is the root of an empty storage trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// StateRent configures the state rent of the block being processed.  The
+// storage of a contract left untouched for Period blocks is archived: it
+// leaves the state, and a transaction must carry a witness of the whole
+// storage to revive it.  The storage of an account is touched when it is read
+// or written and when the account is called.
+//
+// The bookkeeping of state rent is never reverted, a storage touched by a
+// failed call was touched all the same.
+type StateRent struct {
+	// Height is the height of the block being processed.
+	Height uint64
+
+	// Start is the height state rent was enabled at.  The storage of the
+	// accounts untouched since is considered touched at this height.
+	Start uint64
+
+	// Period is the number of blocks after which a storage left untouched
+	// is archived.
+	Period uint64
+}
+
+// AccountRent is the state rent record of an account.  It is only stored for
+// the accounts whose storage was touched since state rent was enabled, so the
+// other accounts keep their encoding.
+type AccountRent struct {
+	// Touched is the height the storage of the account was last touched.
+	Touched uint64
+
+	// Archived is the root of the archived storage of the account, zero
+	// while the storage is live.
+	Archived common.Hash
+}
+
+// rentRecord returns the state rent record of the account.  The storage of an
+// account without a record is considered touched at start.
+func (self *stateObject) rentRecord(start uint64) AccountRent {
+	if len(self.data.Rent) > 0 {
+		return self.data.Rent[0]
+	}
+	return AccountRent{Touched: start}
+}
+
+// hasStorage returns whether the live storage of the account is not empty.
+func (self *stateObject) hasStorage() bool {
+	return self.data.Root != (common.Hash{}) && self.data.Root != emptyRoot
+}
+
+// SetStateRent sets the state rent of the block being processed.  A nil rent
+// disables state rent, the archived storages staying archived.
+func (self *StateDB) SetStateRent(rent *StateRent) {
+	self.rent = rent
+}
+
+// archivedRoot returns the root of the archived storage of the account, zero
+// while the storage is live.  The storage is archived as soon as it expired,
+// even though it is only moved out of the state when next accessed.
+func (self *StateDB) archivedRoot(obj *stateObject) common.Hash {
+	if self.rent == nil {
+		return obj.rentRecord(0).Archived
+	}
+	record := obj.rentRecord(self.rent.Start)
+	if record.Archived != (common.Hash{}) || vm.IsSystemContract(obj.address.Big()) {
+		return record.Archived
+	}
+	if record.Touched+self.rent.Period <= self.rent.Height && obj.hasStorage() {
+		return obj.data.Root
+	}
+	return common.Hash{}
+}
+
+// rentStorage applies state rent to the storage of an account about to be
+// accessed, and returns false when the storage is archived.  A live storage is
+// touched, and an expired one is moved out of the state.
+func (self *StateDB) rentStorage(obj *stateObject) bool {
+	if self.rent == nil || vm.IsSystemContract(obj.address.Big()) {
+		return self.archivedRoot(obj) == (common.Hash{})
+	}
+	record := obj.rentRecord(self.rent.Start)
+	if archived := self.archivedRoot(obj); archived != (common.Hash{}) {
+		if record.Archived != archived {
+			obj.data.Rent = []AccountRent{{Touched: record.Touched, Archived: archived}}
+			obj.data.Root = common.Hash{}
+			obj.trie = nil
+			obj.cachedStorage = make(Storage)
+			self.journal.dirty(obj.address)
+		}
+		return false
+	}
+	if record.Touched != self.rent.Height {
+		obj.data.Rent = []AccountRent{{Touched: self.rent.Height}}
+		self.journal.dirty(obj.address)
+	}
+	return true
+}
+
+// StorageArchived returns whether the storage of the account is archived by
+// state rent.  The storage is touched, or archived first when it expired.
+func (self *StateDB) StorageArchived(addr common.Address) bool {
+	obj := self.getStateObject(addr)
+	return obj != nil && !self.rentStorage(obj)
+}
+
+// GetStorageRent returns the state rent record of the account, and false when
+// the account does not exist.
+func (self *StateDB) GetStorageRent(addr common.Address) (AccountRent, bool) {
+	obj := self.getStateObject(addr)
+	if obj == nil {
+		return AccountRent{}, false
+	}
+	start := uint64(0)
+	if self.rent != nil {
+		start = self.rent.Start
+	}
+	return obj.rentRecord(start), true
+}
+
+// ArchivedStorage returns the entries of the archived storage of the account,
+// which make the witness reviving the storage.  The archived storage must
+// still be in the trie database.
+func (self *StateDB) ArchivedStorage(addr common.Address) ([]protos.StorageEntry, error) {
+	record, ok := self.GetStorageRent(addr)
+	if !ok || record.Archived == (common.Hash{}) {
+		return nil, fmt.Errorf("storage of %x is not archived", addr)
+	}
+	tr, err := trie.New(record.Archived, self.db.TrieDB())
+	if err != nil {
+		return nil, err
+	}
+	var entries []protos.StorageEntry
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, protos.StorageEntry{
+			Key:   common.BytesToHash(it.Key),
+			Value: common.BytesToHash(content),
+		})
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+	return entries, nil
+}
+
+// ReviveStorage revives the archived storages witnessed by a transaction.  The
+// root of the storage trie built from a witness must be the root of the
+// archived storage.  The state is left untouched when an error is returned.
+func (self *StateDB) ReviveStorage(witnesses []protos.StorageWitness) error {
+	if self.rent == nil {
+		return fmt.Errorf("state rent is disabled")
+	}
+	objs := make([]*stateObject, len(witnesses))
+	tries := make([]*trie.Trie, len(witnesses))
+	for i, witness := range witnesses {
+		obj := self.getStateObject(witness.Address)
+		if obj == nil || self.archivedRoot(obj) == (common.Hash{}) {
+			return fmt.Errorf("storage of %x is not archived", witness.Address)
+		}
+		tr, err := trie.New(common.Hash{}, self.db.TrieDB())
+		if err != nil {
+			return err
+		}
+		for _, entry := range witness.Entries {
+			if entry.Value == (common.Hash{}) {
+				return fmt.Errorf("witness of %x has an empty slot %x",
+					witness.Address, entry.Key)
+			}
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ := rlp.EncodeToBytes(bytes.TrimLeft(entry.Value[:], "\x00"))
+			if err := tr.TryUpdate(entry.Key[:], v); err != nil {
+				return err
+			}
+		}
+		archived := self.archivedRoot(obj)
+		if root := tr.Hash(); root != archived {
+			return fmt.Errorf("witness of %x has root %x, archived root %x",
+				witness.Address, root, archived)
+		}
+		objs[i], tries[i] = obj, tr
+	}
+
+	for i, obj := range objs {
+		root, err := tries[i].Commit(nil)
+		if err != nil {
+			return err
+		}
+		obj.data.Root = root
+		obj.data.Rent = []AccountRent{{Touched: self.rent.Height}}
+		obj.trie = nil
+		obj.cachedStorage = make(Storage)
+		self.journal.dirty(obj.address)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/common"
+	"github.com/AsimovNetwork/asimov/database/dbimpl/ethdb"
+	"github.com/AsimovNetwork/asimov/protos"
+)
+
+// TestStateRent ensures a storage left untouched for the rent period is
+// archived, and is only revived by a witness of the whole storage.
+func TestStateRent(t *testing.T) {
+	db := NewDatabase(ethdb.NewMemDatabase())
+	addr := common.Address{0x63, 0x01}
+	key, value := common.Hash{0x01}, common.Hash{0x02}
+
+	state, _ := New(common.Hash{}, db)
+	state.SetStateRent(&StateRent{Height: 10, Period: 100})
+	state.SetNonce(addr, 1)
+	state.SetState(addr, key, value)
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// The storage is live within the rent period.
+	state, _ = New(root, db)
+	state.SetStateRent(&StateRent{Height: 109, Period: 100})
+	if state.Copy().StorageArchived(addr) {
+		t.Fatal("storage archived within the rent period")
+	}
+
+	// The storage is archived once the rent period elapsed.
+	state.SetStateRent(&StateRent{Height: 110, Period: 100})
+	if !state.StorageArchived(addr) {
+		t.Fatal("storage not archived after the rent period")
+	}
+	if got := state.GetState(addr, key); got != (common.Hash{}) {
+		t.Fatalf("read %x from archived storage", got)
+	}
+	root, err = state.Commit(false)
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	state, _ = New(root, db)
+	state.SetStateRent(&StateRent{Height: 120, Period: 100})
+	entries, err := state.ArchivedStorage(addr)
+	if err != nil {
+		t.Fatalf("ArchivedStorage: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Value != value {
+		t.Fatalf("ArchivedStorage: got %v", entries)
+	}
+
+	// A witness missing an entry is rejected.
+	err = state.ReviveStorage([]protos.StorageWitness{{Address: addr}})
+	if err == nil {
+		t.Fatal("ReviveStorage: revived from an empty witness")
+	}
+	err = state.ReviveStorage([]protos.StorageWitness{{Address: addr, Entries: entries}})
+	if err != nil {
+		t.Fatalf("ReviveStorage: %v", err)
+	}
+	if got := state.GetState(addr, key); got != value {
+		t.Fatalf("read %x from revived storage, want %x", got, value)
+	}
+	record, _ := state.GetStorageRent(addr)
+	if record.Touched != 120 || record.Archived != (common.Hash{}) {
+		t.Fatalf("revived storage has record %+v", record)
+	}
+	if err := state.ReviveStorage([]protos.StorageWitness{{Address: addr, Entries: entries}}); err == nil {
+		t.Fatal("ReviveStorage: revived a live storage")
+	}
+}
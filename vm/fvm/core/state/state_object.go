@@ -100,6 +100,11 @@ type Account struct {
 	Balance  *big.Int
 	Root     common.Hash // merkle root of the storage trie
 	CodeHash []byte
+
+	// Rent holds the state rent record of the account, at most one.  It is
+	// empty unless state rent is enabled, keeping the encoding of the
+	// account unchanged.
+	Rent []AccountRent `rlp:"tail"`
 }
 
 // newObject creates a state object.
@@ -27,6 +27,7 @@ import (
 
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/crypto"
+	"github.com/AsimovNetwork/asimov/protos"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/types"
 	"github.com/AsimovNetwork/asimov/vm/fvm/log"
 	"github.com/AsimovNetwork/asimov/vm/fvm/rlp"
@@ -77,6 +78,14 @@ type StateDB struct {
 
 	preimages map[common.Hash][]byte
 
+	// declared holds the accounts and storage slots declared by the access
+	// list of the running transaction.
+	declared map[common.Address]*declaredAccount
+
+	// rent is the state rent of the block being processed, nil when state
+	// rent is disabled.
+	rent *StateRent
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        *journal
@@ -172,6 +181,78 @@ func (self *StateDB) Preimages() map[common.Hash][]byte {
 	return self.preimages
 }
 
+// declaredAccount is an account declared by the access list of the running
+// transaction, along with the storage slots declared for it.  The flags record
+// whether the declaration was already used for a discount.
+type declaredAccount struct {
+	used  bool
+	slots map[common.Hash]bool
+}
+
+// PrepareAccessList sets the access list declared by the running transaction,
+// replacing the one of the previous transaction.
+func (self *StateDB) PrepareAccessList(list []protos.AccessTuple) {
+	self.declared = nil
+	if len(list) == 0 {
+		return
+	}
+	self.declared = make(map[common.Address]*declaredAccount, len(list))
+	for _, tuple := range list {
+		account := self.declared[tuple.Address]
+		if account == nil {
+			account = &declaredAccount{
+				slots: make(map[common.Hash]bool, len(tuple.StorageKeys)),
+			}
+			self.declared[tuple.Address] = account
+		}
+		for _, key := range tuple.StorageKeys {
+			account.slots[key] = false
+		}
+	}
+}
+
+// UseAccessListAddress returns whether the access list of the running
+// transaction declares the account and its declaration is not used yet, and
+// marks it used.  The transaction pays upfront for a single discounted access
+// per declaration, so a declaration stays used when a call is reverted.
+func (self *StateDB) UseAccessListAddress(addr common.Address) bool {
+	account := self.declared[addr]
+	if account == nil || account.used {
+		return false
+	}
+	account.used = true
+	return true
+}
+
+// UseAccessListSlot returns whether the access list of the running
+// transaction declares the storage slot of the account and its declaration is
+// not used yet, and marks it used.
+func (self *StateDB) UseAccessListSlot(addr common.Address, slot common.Hash) bool {
+	account := self.declared[addr]
+	if account == nil {
+		return false
+	}
+	if used, ok := account.slots[slot]; !ok || used {
+		return false
+	}
+	account.slots[slot] = true
+	return true
+}
+
+// AccessList returns the addresses of the accounts accessed so far along with
+// the storage slots read or written of every account.
+func (self *StateDB) AccessList() map[common.Address][]common.Hash {
+	list := make(map[common.Address][]common.Hash, len(self.stateObjects))
+	for addr, obj := range self.stateObjects {
+		slots := make([]common.Hash, 0, len(obj.cachedStorage))
+		for key := range obj.cachedStorage {
+			slots = append(slots, key)
+		}
+		list[addr] = slots
+	}
+	return list
+}
+
 func (self *StateDB) AddRefund(gas uint64) {
 	self.journal.append(refundChange{prev: self.refund})
 	self.refund += gas
@@ -241,7 +322,7 @@ func (self *StateDB) GetCodeHash(addr common.Address) common.Hash {
 
 func (self *StateDB) GetState(addr common.Address, bhash common.Hash) common.Hash {
 	stateObject := self.getStateObject(addr)
-	if stateObject != nil {
+	if stateObject != nil && self.rentStorage(stateObject) {
 		return stateObject.GetState(self.db, bhash)
 	}
 	return common.Hash{}
@@ -312,9 +393,11 @@ func (self *StateDB) SetCode(addr common.Address, code []byte) {
 	}
 }
 
+// SetState writes a value in the storage of the account.  The storage of an
+// account archived by state rent cannot be written until revived.
 func (self *StateDB) SetState(addr common.Address, key, value common.Hash) {
 	stateObject := self.GetOrNewStateObject(addr)
-	if stateObject != nil {
+	if stateObject != nil && self.rentStorage(stateObject) {
 		stateObject.SetState(self.db, key, value)
 	}
 }
@@ -470,6 +553,7 @@ func (self *StateDB) Copy() *StateDB {
 		logs:              make(map[common.Hash][]*types.Log, len(self.logs)),
 		logSize:           self.logSize,
 		preimages:         make(map[common.Hash][]byte),
+		rent:              self.rent,
 		journal:           newJournal(),
 	}
 	// Copy the dirty states, logs, and preimages
@@ -503,6 +587,16 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	if self.declared != nil {
+		state.declared = make(map[common.Address]*declaredAccount, len(self.declared))
+		for addr, account := range self.declared {
+			slots := make(map[common.Hash]bool, len(account.slots))
+			for key, used := range account.slots {
+				slots[key] = used
+			}
+			state.declared[addr] = &declaredAccount{used: account.used, slots: slots}
+		}
+	}
 	return state
 }
 
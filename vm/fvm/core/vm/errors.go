@@ -29,4 +29,5 @@ var (
 	ErrContractAddressCollision = errors.New("contract address collision")
 	ErrNoCompatibleInterpreter  = errors.New("no compatible interpreter")
 	ErrCalcGasFailed			= errors.New("calc gas failed")
+	ErrStorageArchived          = errors.New("contract storage archived by state rent")
 )
@@ -213,7 +213,7 @@ func (host *HostContext) SetStorage(addr common.Address, key common.Hash, value
 	if oldValue == zero {
 		return evmc.StorageAdded
 	} else if value == zero {
-		env.StateDB.AddRefund(params.SstoreRefundGas)
+		env.StateDB.AddRefund(env.chainConfig.GasTable(env.BlockNumber).SStoreRefund)
 		return evmc.StorageDeleted
 	}
 	return evmc.StorageModified
@@ -244,7 +244,7 @@ func (host *HostContext) Selfdestruct(addr common.Address, beneficiary common.Ad
 	env := host.env
 	db := env.StateDB
 	if !db.HasSuicided(addr) {
-		db.AddRefund(params.SuicideRefundGas)
+		db.AddRefund(env.chainConfig.GasTable(env.BlockNumber).SuicideRefund)
 	}
 	balance := db.GetBalance(addr)
 	db.AddBalance(beneficiary, balance)
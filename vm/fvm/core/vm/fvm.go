@@ -25,6 +25,7 @@ import (
 	"github.com/AsimovNetwork/asimov/common"
 	"github.com/AsimovNetwork/asimov/crypto"
 	"github.com/AsimovNetwork/asimov/protos"
+	"github.com/AsimovNetwork/asimov/tracing"
 	"github.com/AsimovNetwork/asimov/vm/fvm/core/virtualtx"
 	"github.com/AsimovNetwork/asimov/vm/fvm/params"
 	"math/big"
@@ -86,6 +87,29 @@ func run(fvm *FVM, contract *Contract, input []byte, readOnly bool) ([]byte, err
 	return nil, ErrNoCompatibleInterpreter
 }
 
+// runTraced runs the given contract like run within a span with the passed
+// name.  The span is a child of the span of the running execution, or of the
+// span of the context for the outermost one.
+func runTraced(fvm *FVM, name string, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
+	parent := fvm.traceSpan
+	span := tracing.StartSpan(name, parent)
+	gas := contract.Gas
+	if span.Sampled() {
+		span.SetAttr("vm.address", contract.Address().String())
+		span.SetAttr("vm.depth", fvm.depth)
+		span.SetAttr("vm.gas", gas)
+	}
+	fvm.traceSpan = span
+	ret, err := run(fvm, contract, input, readOnly)
+	fvm.traceSpan = parent
+	if span.Sampled() {
+		span.SetAttr("vm.gasused", gas-contract.Gas)
+	}
+	span.SetError(err)
+	span.End()
+	return ret, err
+}
+
 // Context provides the FVM with auxiliary information. Once provided
 // it shouldn't be modified.
 type Context struct {
@@ -118,6 +142,10 @@ type Context struct {
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
 	Block       *asiutil.Block // Block contains a balance cache which used in vm.
 	View        *txo.UtxoViewpoint // Provides UtxoViewPoint
+
+	// TraceSpan is the parent of the spans of the contract executions, nil
+	// when they start their own traces.
+	TraceSpan *tracing.Span
 }
 
 // FVM is the Asimov Virtual Machine base object and provides
@@ -153,6 +181,8 @@ type FVM struct {
 	callGasTemp uint64
 	// Virtual Transaction
 	Vtx *virtualtx.VirtualTransaction
+	// traceSpan is the span of the running contract execution.
+	traceSpan *tracing.Span
 }
 
 // append wasm
@@ -175,6 +205,7 @@ func NewFVMWithVtx(ctx Context, statedb StateDB, chainConfig *params.ChainConfig
 		chainConfig: chainConfig,
 		//chainRules:   chainConfig.Rules(ctx.BlockNumber),
 		interpreters: make([]Interpreter, 0, 1),
+		traceSpan:    ctx.TraceSpan,
 	}
 
 	// Keep the built-in FVM as the failover option.
@@ -213,6 +244,11 @@ func (fvm *FVM) Call(caller ContractRef, addr common.Address, input []byte,
 	if fvm.depth > int(params.CallCreateDepth) {
 		return nil, gas, -1, ErrDepth
 	}
+	// Fail if the storage of the contract is archived by state rent, a
+	// transaction must revive it first.
+	if fvm.StateDB.StorageArchived(addr) {
+		return nil, gas, -1, ErrStorageArchived
+	}
 
 	leftOverGas = gas
 	if doTransfer && !fvm.Context.CanTransfer(fvm.View, fvm.Block, fvm.StateDB, caller.Address(), value, fvm.Vtx, fvm.CalculateBalance, asset) {
@@ -252,7 +288,7 @@ func (fvm *FVM) Call(caller ContractRef, addr common.Address, input []byte,
 			fvm.vmConfig.Tracer.CaptureEnd(ret, leftOverGas-contract.Gas, time.Since(start), err)
 		}()
 	}
-	ret, err = run(fvm, contract, input, false)
+	ret, err = runTraced(fvm, "vm.Call", contract, input, false)
 
 	// When an error was returned by the FVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
@@ -300,7 +336,7 @@ func (fvm *FVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	contract := NewContract(caller, to, value, leftOverGas, assets)
 	contract.SetCallCode(&addr, fvm.StateDB.GetCodeHash(addr), fvm.StateDB.GetCode(addr))
 
-	ret, err = run(fvm, contract, input, false)
+	ret, err = runTraced(fvm, "vm.CallCode", contract, input, false)
 	if err != nil {
 		fvm.StateDB.RevertToSnapshot(snapshot)
 		if err != errExecutionReverted {
@@ -333,7 +369,7 @@ func (fvm *FVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	contract := NewContract(caller, to, nil, gas, nil).AsDelegate()
 	contract.SetCallCode(&addr, fvm.StateDB.GetCodeHash(addr), fvm.StateDB.GetCode(addr))
 
-	ret, err = run(fvm, contract, input, false)
+	ret, err = runTraced(fvm, "vm.DelegateCall", contract, input, false)
 	if err != nil {
 		fvm.StateDB.RevertToSnapshot(snapshot)
 		if err != errExecutionReverted {
@@ -378,7 +414,7 @@ func (fvm *FVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	// When an error was returned by the FVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in Homestead this also counts for code storage gas errors.
-	ret, err = run(fvm, contract, input, true)
+	ret, err = runTraced(fvm, "vm.StaticCall", contract, input, true)
 	if err != nil {
 		fvm.StateDB.RevertToSnapshot(snapshot)
 		if err != errExecutionReverted {
@@ -434,7 +470,7 @@ func (fvm *FVM) create(caller ContractRef, code []byte,
 	start := time.Now()
 
 	// paramBytes always nil when contract code is evm bytes
-	ret, err := run(fvm, contract, paramBytes, false)
+	ret, err := runTraced(fvm, "vm.Create", contract, paramBytes, false)
 
 	// check whether the max code size has been exceeded
 	maxCodeSizeExceeded := len(ret) > params.MaxCodeSize
@@ -443,7 +479,7 @@ func (fvm *FVM) create(caller ContractRef, code []byte,
 	// be stored due to not enough gas set an error and let it be handled
 	// by the error checking condition below.
 	if err == nil && !maxCodeSizeExceeded {
-		createDataGas := uint64(len(ret)) * params.CreateDataGas
+		createDataGas := uint64(len(ret)) * fvm.chainConfig.GasTable(fvm.BlockNumber).CreateData
 		if contract.UseGas(createDataGas) {
 			fvm.StateDB.SetCode(address, ret)
 		} else {
@@ -23,7 +23,7 @@ import (
 
 // memoryGasCosts calculates the quadratic gas for memory expansion. It does so
 // only for the memory region that is expanded, not the total memory.
-func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
+func memoryGasCost(gt params.GasTable, mem *Memory, newMemSize uint64) (uint64, error) {
 
 	if newMemSize == 0 {
 		return 0, nil
@@ -44,8 +44,8 @@ func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
 
 	if newMemSize > uint64(mem.Len()) {
 		square := newMemSizeWords * newMemSizeWords
-		linCoef := newMemSizeWords * params.MemoryGas
-		quadCoef := square / params.QuadCoeffDiv
+		linCoef := newMemSizeWords * gt.Memory
+		quadCoef := square / gt.QuadCoeffDiv
 		newTotalFee := linCoef + quadCoef
 
 		fee := newTotalFee - mem.lastGasCost
@@ -62,14 +62,42 @@ func constGasFunc(gas uint64) gasFunc {
 	}
 }
 
+func gasQuickStep(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.QuickStep, nil
+}
+
+func gasFastestStep(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.FastestStep, nil
+}
+
+func gasFastStep(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.FastStep, nil
+}
+
+func gasMidStep(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.MidStep, nil
+}
+
+func gasSlowStep(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.SlowStep, nil
+}
+
+func gasExtStep(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.ExtStep, nil
+}
+
+func gasJumpdest(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.Jumpdest, nil
+}
+
 func gasCallDataCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
 
 	var overflow bool
-	if gas, overflow = math.SafeAdd(gas, GasFastestStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.FastestStep); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -78,7 +106,7 @@ func gasCallDataCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *St
 		return 0, errGasUintOverflow
 	}
 
-	if words, overflow = math.SafeMul(toWordSize(words), params.CopyGas); overflow {
+	if words, overflow = math.SafeMul(toWordSize(words), gt.Copy); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -89,13 +117,13 @@ func gasCallDataCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *St
 }
 
 func gasReturnDataCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
 
 	var overflow bool
-	if gas, overflow = math.SafeAdd(gas, GasFastestStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.FastestStep); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -104,7 +132,7 @@ func gasReturnDataCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *
 		return 0, errGasUintOverflow
 	}
 
-	if words, overflow = math.SafeMul(toWordSize(words), params.CopyGas); overflow {
+	if words, overflow = math.SafeMul(toWordSize(words), gt.Copy); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -125,14 +153,14 @@ func gasSStore(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, m
 	// 3. From a non-zero to a non-zero                         (CHANGE)
 	if val == (common.Hash{}) && y.Sign() != 0 {
 		// 0 => non 0
-		return params.SstoreSetGas, nil
+		return gt.SStoreSet, nil
 	} else if val != (common.Hash{}) && y.Sign() == 0 {
 		// non 0 => 0
-		fvm.StateDB.AddRefund(params.SstoreRefundGas)
-		return params.SstoreClearGas, nil
+		fvm.StateDB.AddRefund(gt.SStoreRefund)
+		return gt.SStoreClear, nil
 	} else {
 		// non 0 => non 0 (or 0 => 0)
-		return params.SstoreResetGas, nil
+		return gt.SStoreReset, nil
 	}
 }
 
@@ -143,20 +171,20 @@ func makeGasLog(n uint64) gasFunc {
 			return 0, errGasUintOverflow
 		}
 
-		gas, err := memoryGasCost(mem, memorySize)
+		gas, err := memoryGasCost(gt, mem, memorySize)
 		if err != nil {
 			return 0, err
 		}
 
-		if gas, overflow = math.SafeAdd(gas, params.LogGas); overflow {
+		if gas, overflow = math.SafeAdd(gas, gt.Log); overflow {
 			return 0, errGasUintOverflow
 		}
-		if gas, overflow = math.SafeAdd(gas, n*params.LogTopicGas); overflow {
+		if gas, overflow = math.SafeAdd(gas, n*gt.LogTopic); overflow {
 			return 0, errGasUintOverflow
 		}
 
 		var memorySizeGas uint64
-		if memorySizeGas, overflow = math.SafeMul(requestedSize, params.LogDataGas); overflow {
+		if memorySizeGas, overflow = math.SafeMul(requestedSize, gt.LogData); overflow {
 			return 0, errGasUintOverflow
 		}
 		if gas, overflow = math.SafeAdd(gas, memorySizeGas); overflow {
@@ -168,12 +196,12 @@ func makeGasLog(n uint64) gasFunc {
 
 func gasSha3(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var overflow bool
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
 
-	if gas, overflow = math.SafeAdd(gas, params.Sha3Gas); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.Sha3); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -181,7 +209,7 @@ func gasSha3(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem
 	if overflow {
 		return 0, errGasUintOverflow
 	}
-	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), params.Sha3WordGas); overflow {
+	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), gt.Sha3Word); overflow {
 		return 0, errGasUintOverflow
 	}
 	if gas, overflow = math.SafeAdd(gas, wordGas); overflow {
@@ -191,13 +219,13 @@ func gasSha3(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem
 }
 
 func gasCodeCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
 
 	var overflow bool
-	if gas, overflow = math.SafeAdd(gas, GasFastestStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.FastestStep); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -205,7 +233,7 @@ func gasCodeCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack,
 	if overflow {
 		return 0, errGasUintOverflow
 	}
-	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), params.CopyGas); overflow {
+	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), gt.Copy); overflow {
 		return 0, errGasUintOverflow
 	}
 	if gas, overflow = math.SafeAdd(gas, wordGas); overflow {
@@ -215,7 +243,7 @@ func gasCodeCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack,
 }
 
 func gasExtCodeCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -230,7 +258,7 @@ func gasExtCodeCopy(gt params.GasTable, fvm *FVM, contract *Contract, stack *Sta
 		return 0, errGasUintOverflow
 	}
 
-	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), params.CopyGas); overflow {
+	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), gt.Copy); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -246,11 +274,11 @@ func gasExtCodeHash(gt params.GasTable, fvm *FVM, contract *Contract, stack *Sta
 
 func gasMLoad(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var overflow bool
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, errGasUintOverflow
 	}
-	if gas, overflow = math.SafeAdd(gas, GasFastestStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.FastestStep); overflow {
 		return 0, errGasUintOverflow
 	}
 	return gas, nil
@@ -258,11 +286,11 @@ func gasMLoad(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, me
 
 func gasMStore8(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var overflow bool
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, errGasUintOverflow
 	}
-	if gas, overflow = math.SafeAdd(gas, GasFastestStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.FastestStep); overflow {
 		return 0, errGasUintOverflow
 	}
 	return gas, nil
@@ -270,11 +298,11 @@ func gasMStore8(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack,
 
 func gasMStore(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var overflow bool
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, errGasUintOverflow
 	}
-	if gas, overflow = math.SafeAdd(gas, GasFastestStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.FastestStep); overflow {
 		return 0, errGasUintOverflow
 	}
 	return gas, nil
@@ -282,11 +310,11 @@ func gasMStore(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, m
 
 func gasCreate(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var overflow bool
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
-	if gas, overflow = math.SafeAdd(gas, params.CreateGas); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.Create); overflow {
 		return 0, errGasUintOverflow
 	}
 	return gas, nil
@@ -294,25 +322,47 @@ func gasCreate(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, m
 
 func gasCreate2(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var overflow bool
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
-	if gas, overflow = math.SafeAdd(gas, params.Create2Gas); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.Create2); overflow {
 		return 0, errGasUintOverflow
 	}
 	return gas, nil
 }
 
+// accessListCost returns the cost of the first access of a storage slot or an
+// account declared by the access list of the transaction.  The discount from
+// the full cost is capped to the gas paid upfront for the declaration.
+func accessListCost(cost, discounted, paid uint64) uint64 {
+	if discounted >= cost {
+		return cost
+	}
+	if cost-discounted > paid {
+		return cost - paid
+	}
+	return discounted
+}
+
 func gasBalance(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if fvm.StateDB.UseAccessListAddress(common.BigToAddress(stack.Back(0))) {
+		return accessListCost(gt.Balance, gt.AccessListAccount, params.TxAccessListAddressGas), nil
+	}
 	return gt.Balance, nil
 }
 
 func gasExtCodeSize(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if fvm.StateDB.UseAccessListAddress(common.BigToAddress(stack.Back(0))) {
+		return accessListCost(gt.ExtcodeSize, gt.AccessListAccount, params.TxAccessListAddressGas), nil
+	}
 	return gt.ExtcodeSize, nil
 }
 
 func gasSLoad(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if fvm.StateDB.UseAccessListSlot(contract.Address(), common.BigToHash(stack.Back(0))) {
+		return accessListCost(gt.SLoad, gt.AccessListSLoad, params.TxAccessListStorageKeyGas), nil
+	}
 	return gt.SLoad, nil
 }
 
@@ -323,7 +373,7 @@ func gasExp(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem
 		gas      = expByteLen * gt.ExpByte // no overflow check required. Max is 256 * ExpByte gas
 		overflow bool
 	)
-	if gas, overflow = math.SafeAdd(gas, GasSlowStep); overflow {
+	if gas, overflow = math.SafeAdd(gas, gt.SlowStep); overflow {
 		return 0, errGasUintOverflow
 	}
 	return gas, nil
@@ -337,13 +387,13 @@ func gasCall(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem
 	)
 
 	if transfersValue && fvm.StateDB.Empty(address) {
-		gas += params.CallNewAccountGas
+		gas += gt.CallNewAccount
 	}
 	if transfersValue {
-		gas += params.CallValueTransferGas
+		gas += gt.CallValueTransfer
 	}
 
-	memoryGas, err := memoryGasCost(mem, memorySize)
+	memoryGas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -365,9 +415,9 @@ func gasCall(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem
 func gasCallCode(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	gas := gt.Calls
 	if stack.Back(2).Sign() != 0 {
-		gas += params.CallValueTransferGas
+		gas += gt.CallValueTransfer
 	}
-	memoryGas, err := memoryGasCost(mem, memorySize)
+	memoryGas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -387,24 +437,24 @@ func gasCallCode(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack,
 }
 
 func gasReturn(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return memoryGasCost(mem, memorySize)
+	return memoryGasCost(gt, mem, memorySize)
 }
 
 func gasRevert(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return memoryGasCost(mem, memorySize)
+	return memoryGasCost(gt, mem, memorySize)
 }
 
 func gasSuicide(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var gas = gt.Suicide
 
 	if !fvm.StateDB.HasSuicided(contract.Address()) {
-		fvm.StateDB.AddRefund(params.SuicideRefundGas)
+		fvm.StateDB.AddRefund(gt.SuicideRefund)
 	}
 	return gas, nil
 }
 
 func gasDelegateCall(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -424,7 +474,7 @@ func gasDelegateCall(gt params.GasTable, fvm *FVM, contract *Contract, stack *St
 }
 
 func gasStaticCall(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas, err := memoryGasCost(mem, memorySize)
+	gas, err := memoryGasCost(gt, mem, memorySize)
 	if err != nil {
 		return 0, err
 	}
@@ -444,25 +494,25 @@ func gasStaticCall(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stac
 }
 
 func gasPush(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return GasFastestStep, nil
+	return gt.FastestStep, nil
 }
 
 func gasSwap(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return GasFastestStep, nil
+	return gt.FastestStep, nil
 }
 
 func gasDup(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return GasFastestStep, nil
+	return gt.FastestStep, nil
 }
 
 func gasFlowCreateAsset(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return 99999, nil
+	return gt.FlowCreateAsset, nil
 }
 
 func gasFlowMintAsset(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return 99999, nil
+	return gt.FlowMintAsset, nil
 }
 
 func gasFlowDeployContract(gt params.GasTable, fvm *FVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	return 188888, nil
+	return gt.FlowDeployContract, nil
 }
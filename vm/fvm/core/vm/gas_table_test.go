@@ -16,12 +16,16 @@
 
 package vm
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/AsimovNetwork/asimov/vm/fvm/params"
+)
 
 func TestMemoryGasCost(t *testing.T) {
 	//size := uint64(math.MaxUint64 - 64)
 	size := uint64(0xffffffffe0)
-	v, err := memoryGasCost(&Memory{}, size)
+	v, err := memoryGasCost(params.GasTableConstantinople, &Memory{}, size)
 	if err != nil {
 		t.Error("didn't expect error:", err)
 	}
@@ -29,8 +33,25 @@ func TestMemoryGasCost(t *testing.T) {
 		t.Errorf("Expected: 36028899963961341, got %d", v)
 	}
 
-	_, err = memoryGasCost(&Memory{}, size+1)
+	_, err = memoryGasCost(params.GasTableConstantinople, &Memory{}, size+1)
 	if err == nil {
 		t.Error("expected error")
 	}
 }
+
+func TestAccessListCost(t *testing.T) {
+	tests := []struct {
+		cost, discounted, paid, want uint64
+	}{
+		{200, 50, 150, 50},
+		{800, 50, 150, 650},
+		{700, 100, 600, 100},
+		{100, 200, 150, 100},
+	}
+	for _, test := range tests {
+		if got := accessListCost(test.cost, test.discounted, test.paid); got != test.want {
+			t.Errorf("accessListCost(%d, %d, %d) = %d, want %d",
+				test.cost, test.discounted, test.paid, got, test.want)
+		}
+	}
+}
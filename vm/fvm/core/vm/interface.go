@@ -62,6 +62,16 @@ type StateDB interface {
 	AddPreimage(common.Hash, []byte)
 
 	ForEachStorage(common.Address, func(common.Hash, common.Hash) bool)
+
+	// UseAccessListAddress and UseAccessListSlot report whether the access
+	// list of the running transaction declares an account or a storage slot
+	// not used yet for a discount, and mark the declaration used.
+	UseAccessListAddress(common.Address) bool
+	UseAccessListSlot(common.Address, common.Hash) bool
+
+	// StorageArchived reports whether the storage of an account is archived
+	// by state rent, so the account cannot be called.
+	StorageArchived(common.Address) bool
 }
 
 // CallContext provides a basic interface for the FVM calling conventions. The FVM FVM
@@ -67,55 +67,55 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		ADD: {
 			execute:       opAdd,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		MUL: {
 			execute:       opMul,
-			gasCost:       constGasFunc(GasFastStep),
+			gasCost:       gasFastStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SUB: {
 			execute:       opSub,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		DIV: {
 			execute:       opDiv,
-			gasCost:       constGasFunc(GasFastStep),
+			gasCost:       gasFastStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SDIV: {
 			execute:       opSdiv,
-			gasCost:       constGasFunc(GasFastStep),
+			gasCost:       gasFastStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		MOD: {
 			execute:       opMod,
-			gasCost:       constGasFunc(GasFastStep),
+			gasCost:       gasFastStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SMOD: {
 			execute:       opSmod,
-			gasCost:       constGasFunc(GasFastStep),
+			gasCost:       gasFastStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		ADDMOD: {
 			execute:       opAddmod,
-			gasCost:       constGasFunc(GasMidStep),
+			gasCost:       gasMidStep,
 			validateStack: makeStackFunc(3, 1),
 			valid:         true,
 		},
 		MULMOD: {
 			execute:       opMulmod,
-			gasCost:       constGasFunc(GasMidStep),
+			gasCost:       gasMidStep,
 			validateStack: makeStackFunc(3, 1),
 			valid:         true,
 		},
@@ -127,91 +127,91 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		SIGNEXTEND: {
 			execute:       opSignExtend,
-			gasCost:       constGasFunc(GasFastStep),
+			gasCost:       gasFastStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		LT: {
 			execute:       opLt,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		GT: {
 			execute:       opGt,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SLT: {
 			execute:       opSlt,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SGT: {
 			execute:       opSgt,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		EQ: {
 			execute:       opEq,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		ISZERO: {
 			execute:       opIszero,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(1, 1),
 			valid:         true,
 		},
 		AND: {
 			execute:       opAnd,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		XOR: {
 			execute:       opXor,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		OR: {
 			execute:       opOr,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		NOT: {
 			execute:       opNot,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(1, 1),
 			valid:         true,
 		},
 		BYTE: {
 			execute:       opByte,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SHL: {
 			execute:       opSHL,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SHR: {
 			execute:       opSHR,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		SAR: {
 			execute:       opSAR,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
@@ -224,7 +224,7 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		ADDRESS: {
 			execute:       opAddress,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
@@ -236,31 +236,31 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		ORIGIN: {
 			execute:       opOrigin,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		CALLER: {
 			execute:       opCaller,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		CALLVALUE: {
 			execute:       opCallValue,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		CALLDATALOAD: {
 			execute:       opCallDataLoad,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(1, 1),
 			valid:         true,
 		},
 		CALLDATASIZE: {
 			execute:       opCallDataSize,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
@@ -273,7 +273,7 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		CODESIZE: {
 			execute:       opCodeSize,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
@@ -286,7 +286,7 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		GASPRICE: {
 			execute:       opGasprice,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
@@ -305,7 +305,7 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		RETURNDATASIZE: {
 			execute:       opReturnDataSize,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
@@ -324,43 +324,43 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		BLOCKHASH: {
 			execute:       opBlockhash,
-			gasCost:       constGasFunc(GasExtStep),
+			gasCost:       gasExtStep,
 			validateStack: makeStackFunc(1, 1),
 			valid:         true,
 		},
 		COINBASE: {
 			execute:       opCoinbase,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		TIMESTAMP: {
 			execute:       opTimestamp,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		NUMBER: {
 			execute:       opNumber,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		DIFFICULTY: {
 			execute:       opDifficulty,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		GASLIMIT: {
 			execute:       opGasLimit,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		POP: {
 			execute:       opPop,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(1, 0),
 			valid:         true,
 		},
@@ -401,39 +401,39 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		JUMP: {
 			execute:       opJump,
-			gasCost:       constGasFunc(GasMidStep),
+			gasCost:       gasMidStep,
 			validateStack: makeStackFunc(1, 0),
 			jumps:         true,
 			valid:         true,
 		},
 		JUMPI: {
 			execute:       opJumpi,
-			gasCost:       constGasFunc(GasSlowStep),
+			gasCost:       gasSlowStep,
 			validateStack: makeStackFunc(2, 0),
 			jumps:         true,
 			valid:         true,
 		},
 		PC: {
 			execute:       opPc,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		MSIZE: {
 			execute:       opMsize,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		GAS: {
 			execute:       opGas,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		JUMPDEST: {
 			execute:       opJumpdest,
-			gasCost:       constGasFunc(params.JumpdestGas),
+			gasCost:       gasJumpdest,
 			validateStack: makeStackFunc(0, 0),
 			valid:         true,
 		},
@@ -938,7 +938,7 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		FLOWASSET: {
 			execute:       opFlowAssets,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
@@ -966,19 +966,19 @@ func newFrontierInstructionSet() [256]operation {
 		},
 		ROUND: {
 			execute:       opRound,
-			gasCost:       constGasFunc(GasQuickStep),
+			gasCost:       gasQuickStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
 		BLANCE: {
 			execute:       opFlowBalance,
-			gasCost:       constGasFunc(GasMidStep),
+			gasCost:       gasMidStep,
 			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		VOTEVALUE: {
 			execute:       opVoteValue,
-			gasCost:       constGasFunc(GasFastestStep),
+			gasCost:       gasFastestStep,
 			validateStack: makeStackFunc(0, 1),
 			valid:         true,
 		},
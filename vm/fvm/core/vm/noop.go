@@ -68,3 +68,6 @@ func (NoopStateDB) Snapshot() int
 func (NoopStateDB) AddLog(*types.Log)                                                  {}
 func (NoopStateDB) AddPreimage(common.Hash, []byte)                                    {}
 func (NoopStateDB) ForEachStorage(common.Address, func(common.Hash, common.Hash) bool) {}
+func (NoopStateDB) UseAccessListAddress(common.Address) bool                           { return false }
+func (NoopStateDB) UseAccessListSlot(common.Address, common.Hash) bool                 { return false }
+func (NoopStateDB) StorageArchived(common.Address) bool                                { return false }
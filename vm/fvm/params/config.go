@@ -48,14 +48,14 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), new(EthashConfig), nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
 )
 
 // ChainConfig is the core config which determines the blockchain settings.
@@ -68,6 +68,11 @@ type ChainConfig struct {
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
+
+	// GasSchedules are the gas schedules repricing the VM operations,
+	// ordered by activation height.  ConstantinopleGasSchedule is active
+	// until the first of them.
+	GasSchedules []GasSchedule `json:"gasSchedules,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -110,7 +115,52 @@ func (c *ChainConfig) String() string {
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
 func (c *ChainConfig) GasTable(num *big.Int) GasTable {
-	return GasTableConstantinople
+	return c.GasSchedule(num).Table
+}
+
+// GasSchedule returns the gas schedule active at the passed block height,
+// which is the last one activated at or below the height.
+func (c *ChainConfig) GasSchedule(num *big.Int) GasSchedule {
+	schedule := ConstantinopleGasSchedule
+	if num == nil {
+		return schedule
+	}
+	for _, s := range c.GasSchedules {
+		if num.Cmp(new(big.Int).SetUint64(s.Height)) < 0 {
+			break
+		}
+		schedule = s
+	}
+	return schedule
+}
+
+// NextGasSchedule returns the first gas schedule activated above the passed
+// block height, if any.
+func (c *ChainConfig) NextGasSchedule(num *big.Int) (GasSchedule, bool) {
+	for _, s := range c.GasSchedules {
+		if num == nil || num.Cmp(new(big.Int).SetUint64(s.Height)) < 0 {
+			return s, true
+		}
+	}
+	return GasSchedule{}, false
+}
+
+// CheckGasSchedules ensures the gas schedules are named, ordered by strictly
+// increasing activation height and have a memory cost divisor.
+func (c *ChainConfig) CheckGasSchedules() error {
+	for i, s := range c.GasSchedules {
+		if s.Name == "" {
+			return fmt.Errorf("gas schedule %d has no name", i)
+		}
+		if s.Table.QuadCoeffDiv == 0 {
+			return fmt.Errorf("gas schedule %s has no quadcoeffdiv", s.Name)
+		}
+		if i > 0 && s.Height <= c.GasSchedules[i-1].Height {
+			return fmt.Errorf("gas schedule %s activated at %d, not after %s at %d",
+				s.Name, s.Height, c.GasSchedules[i-1].Name, c.GasSchedules[i-1].Height)
+		}
+	}
+	return nil
 }
 
 // CheckCompatible checks whether scheduled fork transitions have been imported
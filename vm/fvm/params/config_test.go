@@ -17,6 +17,7 @@
 package params
 
 import (
+	"math/big"
 	"reflect"
 	"testing"
 )
@@ -45,3 +46,43 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestGasSchedule(t *testing.T) {
+	repriced := GasTableConstantinople
+	repriced.SLoad = 800
+	c := &ChainConfig{GasSchedules: []GasSchedule{
+		{Name: "repriced", Height: 100, Table: repriced},
+		{Name: "later", Height: 200, Table: GasTableConstantinople},
+	}}
+	if err := c.CheckGasSchedules(); err != nil {
+		t.Fatalf("CheckGasSchedules: %v", err)
+	}
+	tests := []struct {
+		height   int64
+		name     string
+		sload    uint64
+		next     string
+		nextOkay bool
+	}{
+		{0, "constantinople", 200, "repriced", true},
+		{99, "constantinople", 200, "repriced", true},
+		{100, "repriced", 800, "later", true},
+		{250, "later", 200, "", false},
+	}
+	for _, test := range tests {
+		num := big.NewInt(test.height)
+		if s := c.GasSchedule(num); s.Name != test.name || c.GasTable(num).SLoad != test.sload {
+			t.Errorf("height %d: got schedule %s with sload %d, want %s with %d",
+				test.height, s.Name, c.GasTable(num).SLoad, test.name, test.sload)
+		}
+		next, ok := c.NextGasSchedule(num)
+		if ok != test.nextOkay || next.Name != test.next {
+			t.Errorf("height %d: got next schedule %q, want %q", test.height, next.Name, test.next)
+		}
+	}
+
+	c.GasSchedules[1].Height = 100
+	if err := c.CheckGasSchedules(); err == nil {
+		t.Error("CheckGasSchedules: no error for unordered schedules")
+	}
+}
@@ -18,22 +18,90 @@ package params
 
 // GasTable organizes gas prices for different ethereum phases.
 type GasTable struct {
-	ExtcodeSize uint64
-	ExtcodeCopy uint64
-	ExtcodeHash uint64
-	Balance     uint64
-	SLoad       uint64
-	Calls       uint64
-	Suicide     uint64
+	ExtcodeSize uint64 `json:"extcodesize"`
+	ExtcodeCopy uint64 `json:"extcodecopy"`
+	ExtcodeHash uint64 `json:"extcodehash"`
+	Balance     uint64 `json:"balance"`
+	SLoad       uint64 `json:"sload"`
+	Calls       uint64 `json:"calls"`
+	Suicide     uint64 `json:"suicide"`
 
-	ExpByte uint64
+	ExpByte uint64 `json:"expbyte"`
 
 	// CreateBySuicide occurs when the
 	// refunded account is one that does
 	// not exist. This logic is similar
 	// to call. May be left nil. Nil means
 	// not charged.
-	CreateBySuicide uint64
+	CreateBySuicide uint64 `json:"createbysuicide"`
+
+	// SStoreSet, SStoreClear and SStoreReset are charged by SSTORE when
+	// it sets a zero slot, clears a slot and changes a slot otherwise.
+	// SStoreRefund is refunded when a slot is cleared.
+	SStoreSet    uint64 `json:"sstoreset"`
+	SStoreClear  uint64 `json:"sstoreclear"`
+	SStoreReset  uint64 `json:"sstorereset"`
+	SStoreRefund uint64 `json:"sstorerefund"`
+
+	// AccessListSLoad and AccessListAccount replace SLoad, and Balance and
+	// ExtcodeSize, for the first access of the storage slots and the
+	// accounts declared by the access list of the transaction.  The
+	// discounts are capped to TxAccessListStorageKeyGas and
+	// TxAccessListAddressGas, which the transaction pays for them upfront.
+	AccessListSLoad   uint64 `json:"accesslistsload"`
+	AccessListAccount uint64 `json:"accesslistaccount"`
+
+	// QuickStep, FastestStep, FastStep, MidStep, SlowStep and ExtStep are
+	// the costs of the opcodes of each tier, which the opcodes with a
+	// dynamic cost also charge as their base cost.
+	QuickStep   uint64 `json:"quickstep"`
+	FastestStep uint64 `json:"fasteststep"`
+	FastStep    uint64 `json:"faststep"`
+	MidStep     uint64 `json:"midstep"`
+	SlowStep    uint64 `json:"slowstep"`
+	ExtStep     uint64 `json:"extstep"`
+	Jumpdest    uint64 `json:"jumpdest"`
+
+	// Memory and QuadCoeffDiv are the linear cost and the quadratic divisor
+	// of the memory expansion.  Copy is charged per word copied by the
+	// *COPY opcodes.
+	Memory       uint64 `json:"memory"`
+	QuadCoeffDiv uint64 `json:"quadcoeffdiv"`
+	Copy         uint64 `json:"copy"`
+
+	Sha3     uint64 `json:"sha3"`
+	Sha3Word uint64 `json:"sha3word"`
+
+	// Log is charged per LOG* opcode, LogTopic per topic and LogData per
+	// byte of data.
+	Log      uint64 `json:"log"`
+	LogTopic uint64 `json:"logtopic"`
+	LogData  uint64 `json:"logdata"`
+
+	// Create and Create2 are charged by the CREATE opcodes, and CreateData
+	// per byte of the code of a created contract.
+	Create     uint64 `json:"create"`
+	Create2    uint64 `json:"create2"`
+	CreateData uint64 `json:"createdata"`
+
+	// CallValueTransfer and CallNewAccount are added to the cost of the
+	// calls transferring value, to an account which does not exist for the
+	// latter.
+	CallValueTransfer uint64 `json:"callvaluetransfer"`
+	CallNewAccount    uint64 `json:"callnewaccount"`
+
+	SuicideRefund uint64 `json:"suiciderefund"`
+
+	FlowCreateAsset    uint64 `json:"flowcreateasset"`
+	FlowMintAsset      uint64 `json:"flowmintasset"`
+	FlowDeployContract uint64 `json:"flowdeploycontract"`
+}
+
+// GasSchedule is a gas table activated at a block height.
+type GasSchedule struct {
+	Name   string   `json:"name"`
+	Height uint64   `json:"height"`
+	Table  GasTable `json:"table"`
 }
 
 // Variables containing gas prices for different ethereum phases.
@@ -51,5 +119,52 @@ var (
 		ExpByte:     50,
 
 		CreateBySuicide: 25000,
+
+		SStoreSet:    SstoreSetGas,
+		SStoreClear:  SstoreClearGas,
+		SStoreReset:  SstoreResetGas,
+		SStoreRefund: SstoreRefundGas,
+
+		AccessListSLoad:   AccessListSloadGas,
+		AccessListAccount: AccessListAccountGas,
+
+		QuickStep:   QuickStepGas,
+		FastestStep: FastestStepGas,
+		FastStep:    FastStepGas,
+		MidStep:     MidStepGas,
+		SlowStep:    SlowStepGas,
+		ExtStep:     ExtStepGas,
+		Jumpdest:    JumpdestGas,
+
+		Memory:       MemoryGas,
+		QuadCoeffDiv: QuadCoeffDiv,
+		Copy:         CopyGas,
+
+		Sha3:     Sha3Gas,
+		Sha3Word: Sha3WordGas,
+
+		Log:      LogGas,
+		LogTopic: LogTopicGas,
+		LogData:  LogDataGas,
+
+		Create:     CreateGas,
+		Create2:    Create2Gas,
+		CreateData: CreateDataGas,
+
+		CallValueTransfer: CallValueTransferGas,
+		CallNewAccount:    CallNewAccountGas,
+
+		SuicideRefund: SuicideRefundGas,
+
+		FlowCreateAsset:    FlowCreateAssetGas,
+		FlowMintAsset:      FlowMintAssetGas,
+		FlowDeployContract: FlowDeployContractGas,
+	}
+
+	// ConstantinopleGasSchedule is the gas schedule active from the genesis
+	// block.
+	ConstantinopleGasSchedule = GasSchedule{
+		Name:  "constantinople",
+		Table: GasTableConstantinople,
 	}
 )
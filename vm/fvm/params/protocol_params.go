@@ -27,6 +27,8 @@ const (
 
 	MaximumExtraDataSize  uint64 = 32    // Maximum size extra data may be after Genesis.
 	ExpByteGas            uint64 = 10    // Times ceil(log256(exponent)) for the EXP instruction.
+	AccessListSloadGas    uint64 = 50    // Paid by the first SLOAD operation of a storage slot declared by the access list of the transaction.
+	AccessListAccountGas  uint64 = 100   // Paid by the first BALANCE or EXTCODESIZE operation of an account declared by the access list of the transaction.
 	SloadGas              uint64 = 50    // Multiplied by the number of 32-byte words that are copied (round up) for any *COPY operation and added.
 	CallValueTransferGas  uint64 = 9000  // Paid for CALL when the value transfer is non-zero.
 	CallNewAccountGas     uint64 = 25000 // Paid for CALL when the destination address didn't exist prior.
@@ -38,6 +40,9 @@ const (
 	LogDataGas            uint64 = 8     // Per byte in a LOG* operation's data.
 	CallStipend           uint64 = 2300  // Free gas given at beginning of call.
 
+	TxAccessListAddressGas    uint64 = 600 // Per account declared by the access list of a transaction.
+	TxAccessListStorageKeyGas uint64 = 150 // Per storage slot declared by the access list of a transaction.
+
 	Sha3Gas          uint64 = 30    // Once per SHA3 operation.
 	Sha3WordGas      uint64 = 6     // Once per word of the SHA3 operation's data.
 	SstoreResetGas   uint64 = 5000  // Once per SSTORE operation if the zeroness changes from zero.
@@ -59,6 +64,17 @@ const (
 	MemoryGas        uint64 = 3     // Times the address of the (highest referenced byte in memory + 1). NOTE: referencing happens on read, write and in instructions such as RETURN and CALL.
 	TxDataNonZeroGas uint64 = 68    // Per byte of data attached to a transaction that is not equal to zero. NOTE: Not payable on data of calls between transactions.
 
+	QuickStepGas   uint64 = 2  // Once per operation of the quick tier.
+	FastestStepGas uint64 = 3  // Once per operation of the fastest tier.
+	FastStepGas    uint64 = 5  // Once per operation of the fast tier.
+	MidStepGas     uint64 = 8  // Once per operation of the mid tier.
+	SlowStepGas    uint64 = 10 // Once per operation of the slow tier.
+	ExtStepGas     uint64 = 20 // Once per operation of the ext tier.
+
+	FlowCreateAssetGas    uint64 = 99999  // Once per CREATEASSET operation.
+	FlowMintAssetGas      uint64 = 99999  // Once per MINTASSET operation.
+	FlowDeployContractGas uint64 = 188888 // Once per DEPLOYCONTRACT operation.
+
 	MaxCodeSize = 49152 // Maximum bytecode to permit for a contract
 
 	// Precompiled contract gas prices
@@ -0,0 +1,412 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies the kind of an event delivered to the webhooks.
+type EventType string
+
+// These constants define the event types which may be delivered.
+const (
+	// EventBlock is sent when a block is connected to the main chain.
+	EventBlock EventType = "block"
+
+	// EventWatchedTx is sent when a transaction in a connected block pays
+	// to one of the watched addresses.
+	EventWatchedTx EventType = "tx"
+
+	// EventContractLog is sent for every contract event log emitted by a
+	// connected block.
+	EventContractLog EventType = "contractevent"
+
+	// EventMissedSlot is sent when a validator did not produce a block in
+	// its slot.
+	EventMissedSlot EventType = "missedslot"
+
+	// EventDeposit is sent to the callback URL of a watched deposit
+	// address when the confirmation state of one of its deposits changes.
+	// It is not delivered to the configured webhooks.
+	EventDeposit EventType = "deposit"
+)
+
+// AllEventTypes lists every supported event type.
+var AllEventTypes = []EventType{EventBlock, EventWatchedTx, EventContractLog,
+	EventMissedSlot}
+
+// ParseEventType returns the event type named by s.
+func ParseEventType(s string) (EventType, error) {
+	for _, t := range AllEventTypes {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown webhook event type %q", s)
+}
+
+const (
+	// SignatureHeader is the HTTP header that carries the hex encoded
+	// HMAC-SHA256 of the request body when a secret is configured.
+	SignatureHeader = "X-Asimov-Signature"
+
+	// EventHeader is the HTTP header that carries the event type.
+	EventHeader = "X-Asimov-Event"
+
+	// defaultMaxRetries is the number of delivery retries when the
+	// configured one is negative.
+	defaultMaxRetries = 5
+
+	// defaultRetryInterval is the base delay between two delivery
+	// attempts.  It doubles after every failed attempt.
+	defaultRetryInterval = time.Second * 2
+
+	// maxRetryInterval caps the backoff between two delivery attempts.
+	maxRetryInterval = time.Minute * 5
+
+	// defaultTimeout is the timeout applied to every HTTP request.
+	defaultTimeout = time.Second * 10
+
+	// queueSize is the number of pending events buffered before new
+	// events are dropped.
+	queueSize = 1024
+)
+
+var (
+	// ErrQueueFull is returned by Notify when the pending queue is full.
+	ErrQueueFull = errors.New("webhook queue is full")
+
+	// ErrStopped is returned by Notify once the dispatcher is stopped.
+	ErrStopped = errors.New("webhook dispatcher is stopped")
+)
+
+// Config is a descriptor containing the webhook dispatcher configuration.
+type Config struct {
+	// URLs are the endpoints which receive every event.
+	URLs []string
+
+	// Secret is the key used to sign payloads.  Payloads are not signed
+	// when it is empty.
+	Secret string
+
+	// Events restricts the delivered event types.  Every event type is
+	// delivered when it is empty.
+	Events []EventType
+
+	// MaxRetries is the number of retries after the first failed
+	// delivery before an event is moved to the dead-letter log.  Events
+	// are not retried when it is 0, and defaultMaxRetries is used when it
+	// is negative.
+	MaxRetries int
+
+	// RetryInterval is the base delay of the exponential backoff.
+	RetryInterval time.Duration
+
+	// DeadLetterFile is the path of the file which records the events
+	// that could not be delivered.  Undeliverable events are only logged
+	// when it is empty.
+	DeadLetterFile string
+
+	// Workers is the number of concurrent deliveries.  There is one per
+	// URL when it is 0.
+	Workers int
+
+	// Client is the HTTP client used for deliveries.  A client with a
+	// default timeout is used when it is nil.
+	Client *http.Client
+}
+
+// Event is the envelope which is POSTed as JSON to the webhooks.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      EventType   `json:"type"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// delivery is a pending event for a single endpoint.
+type delivery struct {
+	url     string
+	event   EventType
+	payload []byte
+}
+
+// Dispatcher delivers events to the configured webhooks.  Deliveries are
+// performed asynchronously, retried with exponential backoff and recorded in
+// the dead-letter log once all retries are exhausted.
+type Dispatcher struct {
+	// The following variables must only be used atomically.
+	nextID    uint64
+	delivered uint64
+	failed    uint64
+	started   int32
+
+	cfg     Config
+	enabled map[EventType]struct{}
+	queue   chan *delivery
+	deadMtx sync.Mutex
+	wg      sync.WaitGroup
+	quit    chan struct{}
+
+	// mtx protects shutdown, so no event is queued once Stop drained the
+	// queue.
+	mtx      sync.Mutex
+	shutdown bool
+}
+
+// New returns a new webhook dispatcher.  Use Start to begin delivering events.
+func New(cfg *Config) *Dispatcher {
+	c := *cfg
+	if c.MaxRetries < 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = defaultRetryInterval
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	enabled := make(map[EventType]struct{})
+	events := c.Events
+	if len(events) == 0 {
+		events = AllEventTypes
+	}
+	for _, t := range events {
+		enabled[t] = struct{}{}
+	}
+	return &Dispatcher{
+		cfg:     c,
+		enabled: enabled,
+		queue:   make(chan *delivery, queueSize),
+		quit:    make(chan struct{}),
+	}
+}
+
+// Enabled returns whether events of the given type are delivered.
+func (d *Dispatcher) Enabled(t EventType) bool {
+	_, ok := d.enabled[t]
+	return ok && len(d.cfg.URLs) > 0
+}
+
+// Notify queues an event of the given type for delivery to every webhook.
+// Events of disabled types are silently ignored.
+//
+// This function is safe for concurrent access.
+func (d *Dispatcher) Notify(t EventType, data interface{}) error {
+	if !d.Enabled(t) {
+		return nil
+	}
+	return d.queueEvent(d.cfg.URLs, t, data)
+}
+
+// NotifyURL queues an event of the given type for delivery to the passed URL
+// only, whatever the configured webhooks and event types.  It is used for the
+// callbacks registered at runtime.
+//
+// This function is safe for concurrent access.
+func (d *Dispatcher) NotifyURL(url string, t EventType, data interface{}) error {
+	return d.queueEvent([]string{url}, t, data)
+}
+
+// queueEvent queues an event for delivery to the passed URLs.
+func (d *Dispatcher) queueEvent(urls []string, t EventType, data interface{}) error {
+	event := Event{
+		ID:        atomic.AddUint64(&d.nextID, 1),
+		Type:      t,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+	d.mtx.Lock()
+	if d.shutdown {
+		d.mtx.Unlock()
+		for _, url := range urls {
+			d.deadLetter(&delivery{url: url, event: t, payload: payload},
+				ErrStopped)
+		}
+		return ErrStopped
+	}
+	defer d.mtx.Unlock()
+	for _, url := range urls {
+		select {
+		case d.queue <- &delivery{url: url, event: t, payload: payload}:
+		default:
+			d.deadLetter(&delivery{url: url, event: t, payload: payload},
+				ErrQueueFull)
+			return ErrQueueFull
+		}
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload keyed with secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post performs a single delivery attempt.
+func (d *Dispatcher) post(dl *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, dl.url, bytes.NewReader(dl.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(dl.event))
+	if d.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, dl.payload))
+	}
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// deliver tries to post the delivery until it succeeds, the retries are
+// exhausted or the dispatcher is stopped.
+func (d *Dispatcher) deliver(dl *delivery) {
+	interval := d.cfg.RetryInterval
+	var err error
+	for attempt := 0; attempt <= d.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(interval):
+			case <-d.quit:
+				d.deadLetter(dl, err)
+				return
+			}
+			interval *= 2
+			if interval > maxRetryInterval {
+				interval = maxRetryInterval
+			}
+		}
+		if err = d.post(dl); err == nil {
+			atomic.AddUint64(&d.delivered, 1)
+			return
+		}
+		log.Debugf("Webhook delivery to %s failed (attempt %d): %v",
+			dl.url, attempt+1, err)
+	}
+	d.deadLetter(dl, err)
+}
+
+// deadLetter records a delivery which could not be performed.
+func (d *Dispatcher) deadLetter(dl *delivery, reason error) {
+	atomic.AddUint64(&d.failed, 1)
+	log.Warnf("Giving up webhook delivery of %s event to %s: %v",
+		dl.event, dl.url, reason)
+	if d.cfg.DeadLetterFile == "" {
+		return
+	}
+
+	record, err := json.Marshal(&struct {
+		Time    int64           `json:"time"`
+		URL     string          `json:"url"`
+		Error   string          `json:"error"`
+		Payload json.RawMessage `json:"payload"`
+	}{time.Now().Unix(), dl.url, fmt.Sprint(reason), dl.payload})
+	if err != nil {
+		return
+	}
+
+	d.deadMtx.Lock()
+	defer d.deadMtx.Unlock()
+	f, err := os.OpenFile(d.cfg.DeadLetterFile,
+		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Errorf("Unable to open webhook dead-letter log: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(record, '\n'))
+}
+
+// deliveryHandler delivers the queued events.  It must be run as a goroutine.
+func (d *Dispatcher) deliveryHandler() {
+out:
+	for {
+		select {
+		case dl := <-d.queue:
+			d.deliver(dl)
+		case <-d.quit:
+			break out
+		}
+	}
+	d.wg.Done()
+}
+
+// Stats returns the number of delivered and failed deliveries.
+func (d *Dispatcher) Stats() (uint64, uint64) {
+	return atomic.LoadUint64(&d.delivered), atomic.LoadUint64(&d.failed)
+}
+
+// Start begins delivering queued events.
+func (d *Dispatcher) Start() {
+	if atomic.AddInt32(&d.started, 1) != 1 {
+		return
+	}
+	// There is one worker per endpoint by default.  The workers share the
+	// queue, so an endpoint failing its deliveries holds one worker per
+	// event being retried, and only delays the other endpoints once its
+	// events hold all of them.
+	workers := d.cfg.Workers
+	if workers <= 0 {
+		workers = len(d.cfg.URLs)
+	}
+	if workers == 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.deliveryHandler()
+	}
+}
+
+// Stop shuts down the dispatcher.  Events still being retried or waiting in
+// the queue are moved to the dead-letter log.
+func (d *Dispatcher) Stop() {
+	d.mtx.Lock()
+	if d.shutdown {
+		d.mtx.Unlock()
+		return
+	}
+	d.shutdown = true
+	d.mtx.Unlock()
+
+	close(d.quit)
+	d.wg.Wait()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for {
+		select {
+		case dl := <-d.queue:
+			d.deadLetter(dl, ErrStopped)
+		default:
+			return
+		}
+	}
+}
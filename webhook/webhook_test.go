@@ -0,0 +1,244 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it returns true or the timeout expires.
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// TestDeliverySigned ensures events are delivered with a valid signature and
+// the expected envelope after transient failures.
+func TestDeliverySigned(t *testing.T) {
+	var attempts int32
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	d := New(&Config{
+		URLs:          []string{srv.URL},
+		Secret:        "secret",
+		MaxRetries:    3,
+		RetryInterval: time.Millisecond,
+	})
+	d.Start()
+	defer d.Stop()
+
+	if err := d.Notify(EventBlock, map[string]int{"height": 7}); err != nil {
+		t.Fatalf("Notify: unexpected error %v", err)
+	}
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(time.Second * 5):
+		t.Fatal("event was not delivered")
+	}
+	body := <-bodies
+
+	if got := r.Header.Get(EventHeader); got != string(EventBlock) {
+		t.Errorf("event header: got %q, want %q", got, EventBlock)
+	}
+	if got, want := r.Header.Get(SignatureHeader), Sign("secret", body); got != want {
+		t.Errorf("signature: got %q, want %q", got, want)
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("unable to decode event: %v", err)
+	}
+	if event.Type != EventBlock || event.ID != 1 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	waitFor(t, func() bool {
+		delivered, _ := d.Stats()
+		return delivered == 1
+	})
+}
+
+// TestDeadLetter ensures events are written to the dead-letter log once all
+// retries have failed.
+func TestDeadLetter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead.log")
+
+	d := New(&Config{
+		URLs:           []string{srv.URL},
+		MaxRetries:     2,
+		RetryInterval:  time.Millisecond,
+		DeadLetterFile: deadLetter,
+	})
+	d.Start()
+	defer d.Stop()
+
+	d.Notify(EventMissedSlot, "slot")
+	waitFor(t, func() bool {
+		_, failed := d.Stats()
+		return failed == 1
+	})
+
+	content, err := ioutil.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatalf("unable to read dead-letter log: %v", err)
+	}
+	if !strings.Contains(string(content), srv.URL) ||
+		!strings.Contains(string(content), `"type":"missedslot"`) {
+		t.Errorf("unexpected dead-letter log %q", content)
+	}
+}
+
+// TestNoRetries ensures an event is written to the dead-letter log after its
+// first failed delivery when retries are disabled.
+func TestNoRetries(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	d := New(&Config{
+		URLs:          []string{srv.URL},
+		MaxRetries:    0,
+		RetryInterval: time.Millisecond,
+	})
+	d.Start()
+	defer d.Stop()
+
+	d.Notify(EventBlock, "block")
+	waitFor(t, func() bool {
+		_, failed := d.Stats()
+		return failed == 1
+	})
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("got %d delivery attempts, want 1", n)
+	}
+}
+
+// TestStopDeadLetter ensures the events still queued when the dispatcher stops,
+// and those notified afterwards, are written to the dead-letter log.
+func TestStopDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead.log")
+
+	// The dispatcher is not started so the events stay queued.
+	d := New(&Config{
+		URLs:           []string{"http://127.0.0.1:1"},
+		DeadLetterFile: deadLetter,
+	})
+	for i := 0; i < 3; i++ {
+		if err := d.Notify(EventBlock, i); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	d.Stop()
+	if err := d.Notify(EventBlock, 3); err != ErrStopped {
+		t.Errorf("Notify after Stop = %v, want %v", err, ErrStopped)
+	}
+
+	if _, failed := d.Stats(); failed != 4 {
+		t.Errorf("got %d failed deliveries, want 4", failed)
+	}
+	content, err := ioutil.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatalf("unable to read dead-letter log: %v", err)
+	}
+	if n := strings.Count(string(content), "\n"); n != 4 {
+		t.Errorf("got %d dead-letter records, want 4", n)
+	}
+}
+
+// TestStopConcurrentNotify ensures no event queued while the dispatcher stops
+// is lost: every event is either dead-lettered or left for delivery.
+func TestStopConcurrentNotify(t *testing.T) {
+	const events = 200
+	d := New(&Config{URLs: []string{"http://127.0.0.1:1"}})
+
+	var wg sync.WaitGroup
+	wg.Add(events)
+	for i := 0; i < events; i++ {
+		go func(i int) {
+			defer wg.Done()
+			d.Notify(EventBlock, i)
+		}(i)
+	}
+	d.Stop()
+	wg.Wait()
+
+	if _, failed := d.Stats(); failed != events || len(d.queue) != 0 {
+		t.Errorf("got %d failed deliveries and %d queued events, want %d "+
+			"and 0", failed, len(d.queue), events)
+	}
+}
+
+// TestEventFilter ensures disabled event types are not delivered.
+func TestEventFilter(t *testing.T) {
+	d := New(&Config{
+		URLs:   []string{"http://127.0.0.1:1"},
+		Events: []EventType{EventBlock},
+	})
+	if !d.Enabled(EventBlock) {
+		t.Error("block events should be enabled")
+	}
+	if d.Enabled(EventContractLog) {
+		t.Error("contract events should be disabled")
+	}
+	if err := d.Notify(EventContractLog, nil); err != nil || len(d.queue) != 0 {
+		t.Errorf("disabled event was queued: %v", err)
+	}
+
+	// The events of a callback are queued for its URL only.
+	if err := d.NotifyURL("http://127.0.0.1:2", EventDeposit, nil); err != nil {
+		t.Fatalf("NotifyURL: %v", err)
+	}
+	if len(d.queue) != 1 || (<-d.queue).url != "http://127.0.0.1:2" {
+		t.Error("callback event was not queued for its URL")
+	}
+
+	if _, err := ParseEventType("unknown"); err == nil {
+		t.Error("ParseEventType: expected error for unknown type")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package workers
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Pool limits the number of concurrent tasks of a kind, such as the
+// goroutines validating scripts.  Its size can be changed while it is in use,
+// in which case the tasks already running are not interrupted.
+type Pool struct {
+	name        string
+	description string
+	defaultSize int
+
+	mtx    sync.Mutex
+	size   int
+	active int
+	wake   chan struct{}
+}
+
+// pools holds the registered pools by name.
+var (
+	poolsMtx sync.Mutex
+	pools    = make(map[string]*Pool)
+)
+
+// New returns a new pool with the given name and default size, and registers
+// it so it can be looked up by name.  It panics when a pool with the same
+// name is already registered, so it is meant to be called while the packages
+// are initialized.
+func New(name, description string, defaultSize int) *Pool {
+	if defaultSize < 1 {
+		defaultSize = 1
+	}
+	p := &Pool{
+		name:        name,
+		description: description,
+		defaultSize: defaultSize,
+		size:        defaultSize,
+		wake:        make(chan struct{}),
+	}
+	poolsMtx.Lock()
+	defer poolsMtx.Unlock()
+	if _, ok := pools[name]; ok {
+		panic("duplicate worker pool " + name)
+	}
+	pools[name] = p
+	return p
+}
+
+// Lookup returns the registered pool with the passed name, or nil.
+func Lookup(name string) *Pool {
+	poolsMtx.Lock()
+	defer poolsMtx.Unlock()
+	return pools[name]
+}
+
+// All returns the registered pools sorted by name.
+func All() []*Pool {
+	poolsMtx.Lock()
+	all := make([]*Pool, 0, len(pools))
+	for _, p := range pools {
+		all = append(all, p)
+	}
+	poolsMtx.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	return all
+}
+
+// PerCPU returns a default pool size of n workers per CPU.
+func PerCPU(n int) int {
+	return runtime.NumCPU() * n
+}
+
+// PerProc returns a default pool size of n workers per processor usable by the
+// Go scheduler, as set by GOMAXPROCS.  It suits the CPU bound tasks, which
+// can't run faster with more goroutines than processors.
+func PerProc(n int) int {
+	return runtime.GOMAXPROCS(0) * n
+}
+
+// Name returns the name of the pool.
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// Description returns what the pool limits.
+func (p *Pool) Description() string {
+	return p.description
+}
+
+// DefaultSize returns the size of the pool when it is not configured.
+func (p *Pool) DefaultSize() int {
+	return p.defaultSize
+}
+
+// Size returns the maximum number of concurrent tasks.
+func (p *Pool) Size() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.size
+}
+
+// Active returns the number of tasks currently running.
+func (p *Pool) Active() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.active
+}
+
+// SetSize changes the maximum number of concurrent tasks.  A size below one
+// restores the default size.
+func (p *Pool) SetSize(size int) {
+	if size < 1 {
+		size = p.defaultSize
+	}
+	p.mtx.Lock()
+	p.size = size
+	p.wakeWaiters()
+	p.mtx.Unlock()
+}
+
+// Acquire waits until fewer tasks than the size of the pool are running and
+// starts a task, which must be ended with Release.  It returns false without
+// starting a task when the quit channel, which may be nil, is closed first.
+func (p *Pool) Acquire(quit <-chan struct{}) bool {
+	for {
+		p.mtx.Lock()
+		if p.active < p.size {
+			p.active++
+			p.mtx.Unlock()
+			return true
+		}
+		wake := p.wake
+		p.mtx.Unlock()
+
+		select {
+		case <-wake:
+		case <-quit:
+			return false
+		}
+	}
+}
+
+// Release ends a task started by Acquire.
+func (p *Pool) Release() {
+	p.mtx.Lock()
+	p.active--
+	p.wakeWaiters()
+	p.mtx.Unlock()
+}
+
+// wakeWaiters wakes up the goroutines waiting in Acquire so they check the
+// pool again.  It must be called with the pool mutex held.
+func (p *Pool) wakeWaiters() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018-2020 The asimov developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package workers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := New("test", "tasks of the test", 2)
+	if Lookup("test") != p || Lookup("unknown") != nil {
+		t.Fatal("pool not registered")
+	}
+
+	if !p.Acquire(nil) || !p.Acquire(nil) || p.Active() != 2 {
+		t.Fatal("unable to start tasks up to the size of the pool")
+	}
+
+	// A third task waits until a task is released.
+	started := make(chan struct{})
+	go func() {
+		p.Acquire(nil)
+		close(started)
+	}()
+	select {
+	case <-started:
+		t.Fatal("task started above the size of the pool")
+	case <-time.After(time.Millisecond * 50):
+	}
+	p.Release()
+	select {
+	case <-started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("task not started after a release")
+	}
+
+	// Growing the pool starts a waiting task, and a closed quit channel
+	// gives up waiting.
+	quit := make(chan struct{})
+	close(quit)
+	if p.Acquire(quit) {
+		t.Fatal("task started above the size of the pool")
+	}
+	started = make(chan struct{})
+	go func() {
+		p.Acquire(nil)
+		close(started)
+	}()
+	p.SetSize(3)
+	select {
+	case <-started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("task not started after the pool grew")
+	}
+	if p.Active() != 3 {
+		t.Fatalf("active tasks = %d, want 3", p.Active())
+	}
+
+	p.SetSize(0)
+	if p.Size() != p.DefaultSize() {
+		t.Fatalf("size = %d after reset, want %d", p.Size(), p.DefaultSize())
+	}
+}